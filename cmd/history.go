@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// historyCmd represents the kube history command
+var historyCmd = &cobra.Command{
+	Use:   "history [!N | !!]",
+	Short: "Show recorded invocations or re-run one",
+	Long: `history shows the kube-* commands you ran, with context, namespace, time and
+whether they succeeded - useful to reconstruct what was done during an incident.
+
+Pass !N to re-run entry N, or !! to re-run the last command. Quote the argument
+in shells with history expansion (bash, zsh).
+
+Header, token and password flag values and the credentials of URLs are not
+recorded; such entries cannot be re-run. Recording can be disabled with
+KUBE_NO_HISTORY=1.
+
+Examples:
+  kube history                 # Show the last 20 commands
+  kube history --limit 100     # Show more
+  kube history --context prod  # Only commands run against prod
+  kube history '!42'           # Re-run entry 42`,
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: map[string]string{history.SkipAnnotation: "true"},
+	RunE:        runHistory,
+}
+
+// runHistory lists history entries or re-runs one of them
+func runHistory(cmd *cobra.Command, args []string) error {
+	entries, err := history.Load()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		return rerunHistory(entries, args[0])
+	}
+
+	limit, _ := cmd.Flags().GetInt("limit")
+	contextFilter, _ := cmd.Flags().GetString("context")
+	failedOnly, _ := cmd.Flags().GetBool("failed")
+
+	headers := []string{"#", "TIME", "CONTEXT", "NAMESPACE", "COMMAND", "RESULT"}
+	var rows [][]string
+	for i, e := range entries {
+		if contextFilter != "" && e.Context != contextFilter {
+			continue
+		}
+		if failedOnly && e.Success {
+			continue
+		}
+		result := "\033[32mok\033[0m"
+		if !e.Success {
+			result = "\033[31mfailed\033[0m"
+		}
+		rows = append(rows, []string{
+			strconv.Itoa(i + 1),
+			e.Time.Local().Format("2006-01-02 15:04:05") + " (" + utils.FormatAge(time.Since(e.Time)) + " ago)",
+			e.Context,
+			e.Namespace,
+			utils.TruncateString(commandLine(e), 80),
+			result,
+		})
+	}
+	if limit > 0 && len(rows) > limit {
+		rows = rows[len(rows)-limit:]
+	}
+
+	if len(rows) == 0 {
+		fmt.Println("No history recorded yet")
+		return nil
+	}
+	table.Render(headers, rows)
+	return nil
+}
+
+// rerunHistory runs entry referenced by !N or !! again with the current environment
+func rerunHistory(entries []history.Entry, ref string) error {
+	if len(entries) == 0 {
+		return fmt.Errorf("no history recorded yet")
+	}
+
+	index := len(entries) - 1
+	if ref != "!!" {
+		n, err := strconv.Atoi(strings.TrimPrefix(ref, "!"))
+		if err != nil || n < 1 || n > len(entries) {
+			return fmt.Errorf("invalid history reference '%s', expected !N (1-%d) or !!", ref, len(entries))
+		}
+		index = n - 1
+	}
+	entry := entries[index]
+	if entry.Redacted {
+		return fmt.Errorf("entry %d was recorded with its secrets redacted and cannot be re-run: %s", index+1, commandLine(entry))
+	}
+
+	// Commands without explicit --context run against the current context
+	if current := currentContextName(); entry.Context != "" && current != entry.Context {
+		fmt.Fprintf(os.Stderr, "Warning: entry was recorded against context '%s', current context is '%s'\n", entry.Context, current)
+	}
+	fmt.Fprintf(os.Stderr, "Re-running: %s\n", commandLine(entry))
+
+	child := exec.Command(entry.Command, entry.Args...)
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	if err := child.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() > 0 {
+			os.Exit(exitErr.ExitCode())
+		}
+		return fmt.Errorf("failed to run %s: %w", entry.Command, err)
+	}
+	return nil
+}
+
+// commandLine formats an entry as a shell-like command line
+func commandLine(e history.Entry) string {
+	parts := []string{e.Command}
+	for _, a := range e.Args {
+		if a == "" || strings.ContainsAny(a, " \t\"'$`\\|&;<>*?!") {
+			a = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		}
+		parts = append(parts, a)
+	}
+	return strings.Join(parts, " ")
+}
+
+// currentContextName returns current context from kubeconfig, or "" if unavailable
+func currentContextName() string {
+	config, err := k8s.LoadRawConfig()
+	if err != nil {
+		return ""
+	}
+	return config.CurrentContext
+}
+
+// init registers the history subcommand
+func init() {
+	historyCmd.Flags().Int("limit", 20, "Number of entries to show (0 for all)")
+	historyCmd.Flags().Bool("failed", false, "Only show failed commands")
+	rootCmd.AddCommand(historyCmd)
+}
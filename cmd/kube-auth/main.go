@@ -0,0 +1,519 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/contextgroups"
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authenticationv1beta1 "k8s.io/api/authentication/v1beta1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+var (
+	authKubeContext   string
+	authNamespace     string
+	authAllNamespaces bool
+	authAllContexts   bool
+	authList          bool
+	authTable         table.Options
+)
+
+const (
+	// contextTimeout bounds the identity lookup per context with --all-contexts
+	contextTimeout = 10 * time.Second
+	// maxErrorLength keeps failed contexts on one line
+	maxErrorLength = 80
+)
+
+// identity is who the API server thinks we are
+type identity struct {
+	context   string
+	mechanism string
+	username  string
+	uid       string
+	groups    []string
+	extra     map[string][]string
+	// source tells how the identity was determined
+	source string
+	err    error
+}
+
+// authRootCmd represents the kube-auth command
+var authRootCmd = &cobra.Command{
+	Use:   "kube-auth",
+	Short: "Show the current identity and its permissions",
+	Long: `kube-auth shows who you are in a cluster and what you are allowed to do.
+
+Examples:
+  kube-auth whoami                      # Identity in the current context
+  kube-auth whoami --all-contexts       # Identity and auth mechanism per context
+  kube-auth can-i --list -n payments    # Everything allowed in a namespace
+  kube-auth can-i delete pods           # yes, or exit code 4
+  kube-auth can-i get pods/log -A       # Subresource, all namespaces`,
+}
+
+// whoamiCmd represents the kube-auth whoami command
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show username, groups and auth mechanism",
+	Long: `whoami asks the API server who it authenticates you as (SelfSubjectReview,
+Kubernetes 1.27+) and shows the auth mechanism configured in the kubeconfig:
+client certificate, bearer token, exec plugin or auth provider.
+
+On older clusters the identity is read locally from the client certificate
+(CN and O) or the claims of a JWT bearer token, which is not verified.
+
+Examples:
+  kube-auth whoami
+  kube-auth whoami -c prod
+  kube-auth whoami --all-contexts       # Contexts of the active group only`,
+	Args: cobra.NoArgs,
+	RunE: runWhoami,
+}
+
+// canICmd represents the kube-auth can-i command
+var canICmd = &cobra.Command{
+	Use:   "can-i [verb resource[.group][/subresource] [name]]",
+	Short: "Check or list what the current identity may do",
+	Long: `can-i checks a single action with a SelfSubjectAccessReview and prints yes,
+or fails with exit code 4 when it is not allowed.
+
+With --list, all rules of the namespace are listed (SelfSubjectRulesReview).
+
+Examples:
+  kube-auth can-i create deployments.apps
+  kube-auth can-i get secrets db-password -n payments
+  kube-auth can-i --list`,
+	Args: cobra.RangeArgs(0, 3),
+	RunE: runCanI,
+}
+
+// runWhoami prints the identity of one or all contexts
+func runWhoami(cmd *cobra.Command, args []string) error {
+	if err := authTable.Validate(); err != nil {
+		return err
+	}
+
+	if authAllContexts && authKubeContext != "" {
+		return clierr.Usagef("--all-contexts and --context cannot be combined")
+	}
+	config, err := k8s.LoadRawConfig()
+	if err != nil {
+		return err
+	}
+
+	if !authAllContexts {
+		contextName := authKubeContext
+		if contextName == "" {
+			contextName = config.CurrentContext
+		}
+		id := resolveIdentity(context.Background(), config, contextName)
+		if id.err != nil {
+			return id.err
+		}
+		printIdentity(id)
+		return nil
+	}
+
+	contexts := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		contexts = append(contexts, name)
+	}
+	// --all-contexts covers the group selected with kube-switch-context use-group
+	contexts, _, err = contextgroups.Filter(contexts)
+	if err != nil {
+		return err
+	}
+
+	// Unreachable clusters should not hold up the others
+	ids := make([]identity, len(contexts))
+	k8s.FanOut(len(contexts), func(i int) {
+		ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+		defer cancel()
+		ids[i] = resolveIdentity(ctx, config, contexts[i])
+	})
+
+	headers := []string{"CONTEXT", "MECHANISM", "USERNAME", "GROUPS", "SOURCE"}
+	rows := make([][]string, 0, len(ids))
+	for _, id := range ids {
+		name := id.context
+		if name == config.CurrentContext {
+			name += " *"
+		}
+		if id.err != nil {
+			rows = append(rows, []string{name, id.mechanism, "\033[31merror\033[0m", "-", utils.TruncateString(utils.FirstLine(id.err.Error()), maxErrorLength)})
+			continue
+		}
+		rows = append(rows, []string{name, id.mechanism, id.username, formatGroups(id.groups), id.source})
+	}
+	authTable.Print(headers, rows, 0)
+	return nil
+}
+
+// resolveIdentity determines the identity of a context, asking the API server
+// first and falling back to the local credentials
+func resolveIdentity(ctx context.Context, config *api.Config, contextName string) identity {
+	id := identity{context: contextName, mechanism: "-"}
+	kubeContext, ok := config.Contexts[contextName]
+	if !ok {
+		id.err = clierr.Newf(clierr.NotFound, "context '%s' not found", contextName)
+		return id
+	}
+	if authInfo := config.AuthInfos[kubeContext.AuthInfo]; authInfo != nil {
+		id.mechanism = describeMechanism(authInfo)
+	}
+
+	client, err := k8s.SharedClient(contextName)
+	if err != nil {
+		id.err = fmt.Errorf("failed to create kubernetes client: %w", err)
+		return id
+	}
+
+	userInfo, source, err := selfSubjectReview(ctx, client)
+	switch {
+	case err == nil:
+		id.source = source
+	case apierrors.IsNotFound(err) || apierrors.IsForbidden(err):
+		// SelfSubjectReview is not served (or disabled), look at the credentials
+		var localErr error
+		userInfo, source, localErr = localIdentity(client)
+		if localErr != nil {
+			id.err = fmt.Errorf("SelfSubjectReview is not available (%v) and %w", err, localErr)
+			return id
+		}
+		id.source = source
+	default:
+		id.err = fmt.Errorf("failed to review identity: %w", err)
+		return id
+	}
+
+	id.username = userInfo.Username
+	id.uid = userInfo.UID
+	id.groups = userInfo.Groups
+	id.extra = map[string][]string{}
+	for key, values := range userInfo.Extra {
+		id.extra[key] = values
+	}
+	return id
+}
+
+// selfSubjectReview asks the API server for the authenticated user, trying
+// authentication.k8s.io/v1 (1.28+) before v1beta1 (1.27)
+func selfSubjectReview(ctx context.Context, client *k8s.Client) (authenticationv1.UserInfo, string, error) {
+	review, err := client.Clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err == nil {
+		return review.Status.UserInfo, "SelfSubjectReview", nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return authenticationv1.UserInfo{}, "", err
+	}
+
+	beta, err := client.Clientset.AuthenticationV1beta1().SelfSubjectReviews().Create(ctx, &authenticationv1beta1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err != nil {
+		return authenticationv1.UserInfo{}, "", err
+	}
+	return beta.Status.UserInfo, "SelfSubjectReview (v1beta1)", nil
+}
+
+// localIdentity reads the identity from the client certificate or the claims
+// of a JWT bearer token. Nothing of this is verified by the API server.
+func localIdentity(client *k8s.Client) (authenticationv1.UserInfo, string, error) {
+	config := client.Config
+
+	certData := config.TLSClientConfig.CertData
+	if len(certData) == 0 && config.TLSClientConfig.CertFile != "" {
+		certData, _ = os.ReadFile(config.TLSClientConfig.CertFile)
+	}
+	if block, _ := pem.Decode(certData); block != nil {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return authenticationv1.UserInfo{}, "", fmt.Errorf("failed to parse client certificate: %w", err)
+		}
+		return authenticationv1.UserInfo{
+			Username: cert.Subject.CommonName,
+			Groups:   cert.Subject.Organization,
+		}, "client certificate", nil
+	}
+
+	token := config.BearerToken
+	if token == "" && config.BearerTokenFile != "" {
+		data, _ := os.ReadFile(config.BearerTokenFile)
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		return tokenClaims(token)
+	}
+	return authenticationv1.UserInfo{}, "", fmt.Errorf("the credentials do not reveal the identity")
+}
+
+// tokenClaims decodes the payload of a JWT without verifying it
+func tokenClaims(token string) (authenticationv1.UserInfo, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return authenticationv1.UserInfo{}, "", fmt.Errorf("the bearer token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return authenticationv1.UserInfo{}, "", fmt.Errorf("failed to decode token claims: %w", err)
+	}
+
+	var claims struct {
+		Subject    string   `json:"sub"`
+		Email      string   `json:"email"`
+		Groups     []string `json:"groups"`
+		Kubernetes *struct {
+			Namespace      string `json:"namespace"`
+			ServiceAccount struct {
+				Name string `json:"name"`
+			} `json:"serviceaccount"`
+		} `json:"kubernetes.io"`
+		// Legacy service account tokens
+		LegacyNamespace      string `json:"kubernetes.io/serviceaccount/namespace"`
+		LegacyServiceAccount string `json:"kubernetes.io/serviceaccount/service-account.name"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return authenticationv1.UserInfo{}, "", fmt.Errorf("failed to decode token claims: %w", err)
+	}
+
+	info := authenticationv1.UserInfo{Username: claims.Subject, Groups: claims.Groups}
+	namespace, serviceAccount := claims.LegacyNamespace, claims.LegacyServiceAccount
+	if claims.Kubernetes != nil {
+		namespace, serviceAccount = claims.Kubernetes.Namespace, claims.Kubernetes.ServiceAccount.Name
+	}
+	switch {
+	case serviceAccount != "":
+		info.Username = "system:serviceaccount:" + namespace + ":" + serviceAccount
+		info.Groups = []string{"system:serviceaccounts", "system:serviceaccounts:" + namespace, "system:authenticated"}
+	case claims.Email != "":
+		info.Username = claims.Email
+	}
+	return info, "token claims (unverified)", nil
+}
+
+// describeMechanism names the credentials a kubeconfig user entry uses
+func describeMechanism(authInfo *api.AuthInfo) string {
+	switch {
+	case authInfo.Exec != nil:
+		return "exec: " + filepath.Base(authInfo.Exec.Command)
+	case authInfo.AuthProvider != nil:
+		return "auth-provider: " + authInfo.AuthProvider.Name
+	case len(authInfo.ClientCertificateData) > 0 || authInfo.ClientCertificate != "":
+		return "client certificate"
+	case authInfo.Token != "":
+		return "bearer token"
+	case authInfo.TokenFile != "":
+		return "bearer token file"
+	case authInfo.Username != "":
+		return "basic auth"
+	case authInfo.Impersonate != "":
+		return "impersonation"
+	}
+	return "none"
+}
+
+// printIdentity prints the identity of a single context
+func printIdentity(id identity) {
+	fmt.Printf("Context:    %s\n", id.context)
+	fmt.Printf("Mechanism:  %s\n", id.mechanism)
+	fmt.Printf("Username:   %s\n", id.username)
+	if id.uid != "" {
+		fmt.Printf("UID:        %s\n", id.uid)
+	}
+	fmt.Printf("Groups:     %s\n", formatGroups(id.groups))
+
+	keys := make([]string, 0, len(id.extra))
+	for key := range id.extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("Extra:      %s=%s\n", key, strings.Join(id.extra[key], ","))
+	}
+	fmt.Printf("Source:     %s\n", id.source)
+}
+
+// formatGroups joins groups, - when there are none
+func formatGroups(groups []string) string {
+	if len(groups) == 0 {
+		return "-"
+	}
+	return strings.Join(groups, ", ")
+}
+
+// runCanI checks a single action or lists all rules of the namespace
+func runCanI(cmd *cobra.Command, args []string) error {
+	if err := authTable.Validate(); err != nil {
+		return err
+	}
+
+	switch {
+	case authList && len(args) > 0:
+		return clierr.Usagef("--list does not take a verb or resource")
+	case !authList && len(args) < 2:
+		return clierr.Usagef("expected a verb and a resource, or --list")
+	case authList && authAllNamespaces:
+		return clierr.Usagef("--list works per namespace and cannot be combined with -A")
+	}
+
+	client, err := k8s.NewClient("", authKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	namespace := authNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(authKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	if authAllNamespaces {
+		namespace = ""
+	}
+
+	if authList {
+		return listRules(context.Background(), client, namespace)
+	}
+
+	attributes := resourceAttributes(args, namespace)
+	review, err := client.Clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(context.Background(), &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: attributes},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to review access: %w", err)
+	}
+
+	if !review.Status.Allowed {
+		reason := review.Status.Reason
+		if review.Status.EvaluationError != "" {
+			reason = strings.TrimSpace(reason + " " + review.Status.EvaluationError)
+		}
+		if reason != "" {
+			return clierr.Newf(clierr.Forbidden, "no: %s", reason)
+		}
+		return clierr.Newf(clierr.Forbidden, "no")
+	}
+	fmt.Println("yes")
+	return nil
+}
+
+// resourceAttributes parses verb resource[.group][/subresource] [name]
+func resourceAttributes(args []string, namespace string) *authorizationv1.ResourceAttributes {
+	attributes := &authorizationv1.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      args[0],
+	}
+	resource := args[1]
+	if before, sub, ok := strings.Cut(resource, "/"); ok {
+		resource, attributes.Subresource = before, sub
+	}
+	attributes.Resource, attributes.Group, _ = strings.Cut(resource, ".")
+	if len(args) > 2 {
+		attributes.Name = args[2]
+	}
+	return attributes
+}
+
+// listRules prints the resource and non-resource rules of the namespace
+func listRules(ctx context.Context, client *k8s.Client, namespace string) error {
+	review, err := client.Clientset.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx, &authorizationv1.SelfSubjectRulesReview{
+		Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: namespace},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to review rules: %w", err)
+	}
+
+	headers := []string{"RESOURCES", "NON-RESOURCE URLS", "RESOURCE NAMES", "VERBS"}
+	rows := make([][]string, 0, len(review.Status.ResourceRules)+len(review.Status.NonResourceRules))
+	for _, rule := range review.Status.ResourceRules {
+		var resources []string
+		for _, resource := range rule.Resources {
+			for _, group := range rule.APIGroups {
+				if group != "" {
+					resources = append(resources, resource+"."+group)
+				} else {
+					resources = append(resources, resource)
+				}
+			}
+		}
+		rows = append(rows, []string{
+			strings.Join(resources, ", "),
+			"[]",
+			"[" + strings.Join(rule.ResourceNames, ", ") + "]",
+			"[" + strings.Join(rule.Verbs, ", ") + "]",
+		})
+	}
+	for _, rule := range review.Status.NonResourceRules {
+		rows = append(rows, []string{
+			"",
+			"[" + strings.Join(rule.NonResourceURLs, ", ") + "]",
+			"[]",
+			"[" + strings.Join(rule.Verbs, ", ") + "]",
+		})
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i][0] != rows[j][0] {
+			return rows[i][0] < rows[j][0]
+		}
+		return rows[i][1] < rows[j][1]
+	})
+	authTable.Print(headers, rows, 0)
+
+	if review.Status.Incomplete {
+		fmt.Fprintf(os.Stderr, "Warning: the list may be incomplete: %s\n", review.Status.EvaluationError)
+	}
+	return nil
+}
+
+// init initializes flags for kube-auth command
+func init() {
+	authRootCmd.PersistentFlags().StringVarP(&authKubeContext, "context", "c", "", "Kubernetes context to use")
+	whoamiCmd.Flags().BoolVar(&authAllContexts, "all-contexts", false, "Show the identity in every context of the kubeconfig")
+	canICmd.Flags().StringVarP(&authNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	canICmd.Flags().BoolVarP(&authAllNamespaces, "all-namespaces", "A", false, "Check the action in all namespaces")
+	canICmd.Flags().BoolVar(&authList, "list", false, "List everything allowed in the namespace")
+	for _, cmd := range []*cobra.Command{whoamiCmd, canICmd} {
+		authTable.AddFlags(cmd)
+	}
+	authRootCmd.AddCommand(whoamiCmd, canICmd)
+
+	viper.BindPFlag("context", authRootCmd.PersistentFlags().Lookup("context"))
+	viper.BindPFlag("namespace", canICmd.Flags().Lookup("namespace"))
+}
+
+// main is the entry point of kube-auth
+func main() {
+	k8s.AddVerbosityFlag(authRootCmd)
+	k8s.AddRateLimitFlags(authRootCmd)
+	config.SetupDefaults(authRootCmd)
+	clierr.SetupUsage(authRootCmd)
+	cmd, err := authRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
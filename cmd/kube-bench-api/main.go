@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+var (
+	benchNamespace   string
+	benchKubeContext string
+	benchProbes      []string
+	benchRequests    int
+	benchConcurrency int
+	benchTimeout     time.Duration
+	benchInterval    time.Duration
+)
+
+const (
+	// slowNetwork is the TCP connect time above which the network is blamed
+	slowNetwork = 150 * time.Millisecond
+	// slowServer is how much slower than the network the API server may answer
+	slowServer = 200 * time.Millisecond
+	// slowList is the list latency above which lists are called out
+	slowList = time.Second
+	// maxErrorLength keeps error messages on one line
+	maxErrorLength = 100
+)
+
+// allProbes are the probes in the order they run
+var allProbes = []string{"tcp", "healthz", "get", "list", "watch"}
+
+// probeFunc runs one request and returns the number of objects it returned
+type probeFunc func(ctx context.Context) (int, error)
+
+// probeResult holds the measurements of one probe
+type probeResult struct {
+	name      string
+	detail    string
+	latencies []time.Duration
+	errors    int
+	firstErr  error
+	objects   int
+}
+
+// benchRootCmd represents the kube-bench-api command
+var benchRootCmd = &cobra.Command{
+	Use:   "kube-bench-api",
+	Short: "Measure API server latency and error rates",
+	Long: `kube-bench-api sends a series of requests to the API server of the current
+context and reports latency percentiles and error rates per probe:
+
+  tcp       TCP connect to the API server address (network round trip only)
+  healthz   GET /healthz, the cheapest authenticated round trip
+  get       GET of the namespace object
+  list      LIST of the pods in the namespace
+  watch     time until a watch on the namespace delivers its first event
+
+Comparing tcp with the other probes tells a slow network (VPN, proxy) from a
+slow API server: if tcp is already slow, every tool will be. Requests are not
+rate limited by the client, and failed requests count as errors; answers like
+403 still count for latency since the server responded.
+
+Examples:
+  kube-bench-api                               # 20 requests per probe
+  kube-bench-api -r 100 --concurrency 5        # More load, in parallel
+  kube-bench-api --probes tcp,healthz          # Network vs API server only
+  kube-bench-api -c prod -n payments           # List pods of a busy namespace`,
+	Args: cobra.NoArgs,
+	RunE: runBench,
+}
+
+// runBench runs the selected probes one after the other
+func runBench(cmd *cobra.Command, args []string) error {
+	for _, p := range benchProbes {
+		if !utils.Contains(allProbes, p) {
+			return clierr.Usagef("unknown probe %q (use %s)", p, strings.Join(allProbes, ", "))
+		}
+	}
+	switch {
+	case benchRequests < 1:
+		return clierr.Usagef("--requests must be at least 1")
+	case benchConcurrency < 1:
+		return clierr.Usagef("--concurrency must be at least 1")
+	case benchTimeout <= 0:
+		return clierr.Usagef("--timeout must be positive")
+	}
+
+	client, err := k8s.NewClient("", benchKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	namespace := benchNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(benchKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+
+	// The client rate limit (--qps) would measure itself
+	config := rest.CopyConfig(client.Config)
+	config.RateLimiter = flowcontrol.NewFakeAlwaysRateLimiter()
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create clientset: %w", err)
+	}
+	address, err := dialAddress(config.Host)
+	if err != nil {
+		return err
+	}
+
+	probes := map[string]struct {
+		detail string
+		run    probeFunc
+	}{
+		"tcp": {"connect " + address, func(ctx context.Context) (int, error) {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", address)
+			if err != nil {
+				return 0, err
+			}
+			return 0, conn.Close()
+		}},
+		"healthz": {"GET /healthz", func(ctx context.Context) (int, error) {
+			return 0, clientset.Discovery().RESTClient().Get().AbsPath("/healthz").Do(ctx).Error()
+		}},
+		"get": {"get namespace " + namespace, func(ctx context.Context) (int, error) {
+			_, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+			return 1, err
+		}},
+		"list": {"list pods in " + namespace, func(ctx context.Context) (int, error) {
+			pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return 0, err
+			}
+			return len(pods.Items), nil
+		}},
+		"watch": {"first event of a namespace watch", func(ctx context.Context) (int, error) {
+			w, err := clientset.CoreV1().Namespaces().Watch(ctx, metav1.ListOptions{
+				FieldSelector: fields.OneTermEqualSelector("metadata.name", namespace).String(),
+			})
+			if err != nil {
+				return 0, err
+			}
+			defer w.Stop()
+			select {
+			case event, ok := <-w.ResultChan():
+				if !ok {
+					return 0, fmt.Errorf("watch closed without events")
+				}
+				if status, isStatus := event.Object.(*metav1.Status); isStatus {
+					return 0, apierrors.FromObject(status)
+				}
+				return 1, nil
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}},
+	}
+
+	fmt.Printf("Benchmarking %s (%d request(s) per probe, concurrency %d)\n\n", config.Host, benchRequests, benchConcurrency)
+	ctx, stop := interrupt.Context(context.Background())
+	defer stop()
+	results := make([]probeResult, 0, len(benchProbes))
+	for _, name := range allProbes {
+		if !utils.Contains(benchProbes, name) {
+			continue
+		}
+		p := probes[name]
+		fmt.Fprintf(os.Stderr, "Running %s...\n", name)
+		r := runProbe(ctx, p.run)
+		if ctx.Err() != nil {
+			// Cancelled requests would skew the percentiles
+			return fmt.Errorf("benchmark stopped during %s: %w", name, context.Cause(ctx))
+		}
+		r.name, r.detail = name, p.detail
+		results = append(results, r)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	printResults(results)
+	for _, line := range verdict(results) {
+		fmt.Println(line)
+	}
+
+	failed, total := 0, 0
+	for _, r := range results {
+		failed += r.errors
+		total += benchRequests
+	}
+	if failed > 0 {
+		return clierr.Newf(clierr.Generic, "%d of %d requests failed", failed, total)
+	}
+	return nil
+}
+
+// runProbe sends --requests requests with --concurrency workers until ctx is done
+func runProbe(ctx context.Context, run probeFunc) probeResult {
+	var r probeResult
+	var mu sync.Mutex
+	jobs := make(chan struct{}, benchRequests)
+	for i := 0; i < benchRequests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	for w := 0; w < benchConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				requestCtx, cancel := context.WithTimeout(ctx, benchTimeout)
+				start := time.Now()
+				objects, err := run(requestCtx)
+				elapsed := time.Since(start)
+				cancel()
+
+				mu.Lock()
+				// An error answered by the server still measures its latency
+				if err == nil || clierr.IsServerResponse(err) {
+					r.latencies = append(r.latencies, elapsed)
+				}
+				if err != nil {
+					r.errors++
+					if r.firstErr == nil {
+						r.firstErr = err
+					}
+				} else {
+					r.objects = objects
+				}
+				mu.Unlock()
+
+				if benchInterval > 0 {
+					select {
+					case <-ctx.Done():
+					case <-time.After(benchInterval):
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	return r
+}
+
+// printResults prints the percentile table and the first error per probe
+func printResults(results []probeResult) {
+	const (
+		reset = "\033[0m"
+		red   = "\033[31m"
+	)
+	headers := []string{"PROBE", "OK", "ERRORS", "P50", "P90", "P99", "MAX", "DETAIL"}
+	rows := make([][]string, 0, len(results))
+	for _, r := range results {
+		failed := "0"
+		if r.errors > 0 {
+			failed = fmt.Sprintf("%s%d (%d%%)%s", red, r.errors, r.errors*100/benchRequests, reset)
+		}
+		detail := r.detail
+		if r.name == "list" && r.errors < benchRequests {
+			detail += fmt.Sprintf(" (%d items)", r.objects)
+		}
+		rows = append(rows, []string{
+			r.name,
+			fmt.Sprintf("%d", benchRequests-r.errors),
+			failed,
+			formatLatency(percentile(r.latencies, 50)),
+			formatLatency(percentile(r.latencies, 90)),
+			formatLatency(percentile(r.latencies, 99)),
+			formatLatency(percentile(r.latencies, 100)),
+			detail,
+		})
+	}
+	table.Render(headers, rows)
+
+	for _, r := range results {
+		if r.firstErr != nil {
+			msg, _, _ := strings.Cut(r.firstErr.Error(), "\n")
+			fmt.Printf("%s: %s\n", r.name, utils.TruncateString(msg, maxErrorLength))
+		}
+	}
+	fmt.Println()
+}
+
+// verdict compares the probes to tell network from API server slowness
+func verdict(results []probeResult) []string {
+	p50 := map[string]time.Duration{}
+	for _, r := range results {
+		if len(r.latencies) > 0 {
+			p50[r.name] = percentile(r.latencies, 50)
+		}
+	}
+	tcp, hasTCP := p50["tcp"]
+	server, hasServer := p50["healthz"]
+	if !hasServer {
+		server, hasServer = p50["get"]
+	}
+
+	var lines []string
+	switch {
+	case hasTCP && tcp > slowNetwork:
+		lines = append(lines, fmt.Sprintf("The network is slow: connecting takes %s (p50) before the API server is involved. Check VPN or proxy.", formatLatency(tcp)))
+	case hasTCP && hasServer && server-tcp > slowServer:
+		lines = append(lines, fmt.Sprintf("The API server is slow: %s (p50) against %s of network round trip.", formatLatency(server), formatLatency(tcp)))
+	case hasTCP && hasServer:
+		lines = append(lines, "Network and API server latency look healthy.")
+	}
+	if list, ok := p50["list"]; ok && list > slowList {
+		lines = append(lines, fmt.Sprintf("Lists are slow (%s p50): large namespaces or a loaded etcd.", formatLatency(list)))
+	}
+	return lines
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return -1
+	}
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// formatLatency formats a latency with millisecond precision
+func formatLatency(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "-"
+	case d < 10*time.Millisecond:
+		return d.Round(10 * time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// dialAddress returns host:port of the API server URL
+func dialAddress(host string) (string, error) {
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid API server address %q: %w", host, err)
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	if u.Scheme == "http" {
+		return net.JoinHostPort(u.Hostname(), "80"), nil
+	}
+	return net.JoinHostPort(u.Hostname(), "443"), nil
+}
+
+// init initializes flags for kube-bench-api command
+func init() {
+	benchRootCmd.Flags().StringVarP(&benchNamespace, "namespace", "n", "", "Namespace used by the get, list and watch probes")
+	benchRootCmd.Flags().StringVarP(&benchKubeContext, "context", "c", "", "Kubernetes context to use")
+	benchRootCmd.Flags().StringSliceVar(&benchProbes, "probes", allProbes, "Probes to run: tcp, healthz, get, list, watch")
+	benchRootCmd.Flags().IntVarP(&benchRequests, "requests", "r", 20, "Requests per probe")
+	benchRootCmd.Flags().IntVar(&benchConcurrency, "concurrency", 1, "Requests in flight at once per probe")
+	benchRootCmd.Flags().DurationVar(&benchTimeout, "timeout", 10*time.Second, "Timeout of a single request")
+	benchRootCmd.Flags().DurationVar(&benchInterval, "interval", 0, "Pause between requests of a worker")
+
+	viper.BindPFlag("namespace", benchRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", benchRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-bench-api
+func main() {
+	k8s.AddVerbosityFlag(benchRootCmd)
+	k8s.AddRateLimitFlags(benchRootCmd)
+	config.SetupDefaults(benchRootCmd)
+	clierr.SetupUsage(benchRootCmd)
+	cmd, err := benchRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
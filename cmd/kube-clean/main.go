@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/agefilter"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	cleanNamespace     string
+	cleanKubeContext   string
+	cleanAllNamespaces bool
+	cleanOlderThan     string
+	cleanOnly          []string
+	cleanDryRun        bool
+	cleanYes           bool
+)
+
+// Cleanup categories
+const (
+	categoryFinishedPods = "finished-pods"
+	categoryEvictedPods  = "evicted-pods"
+	categoryJobs         = "jobs"
+	categoryReplicaSets  = "replicasets"
+)
+
+var allCategories = []string{categoryFinishedPods, categoryEvictedPods, categoryJobs, categoryReplicaSets}
+
+// candidate is an object selected for deletion
+type candidate struct {
+	kind      string
+	namespace string
+	name      string
+	reason    string
+	age       time.Duration
+	delete    func(ctx context.Context) error
+}
+
+// cleanRootCmd represents the kube-clean command
+var cleanRootCmd = &cobra.Command{
+	Use:   "kube-clean",
+	Short: "Delete finished pods, completed Jobs and stale ReplicaSets",
+	Long: `kube-clean finds cruft left behind in a namespace (or the whole cluster with -A),
+shows it as a report and deletes it after confirmation.
+
+Categories (--only, default all):
+  finished-pods   Succeeded or Failed pods finished longer ago than --older-than
+                  (pods of Jobs are deleted together with their Job)
+  evicted-pods    Evicted pods, regardless of age
+  jobs            Completed or failed Jobs finished longer ago than --older-than
+                  (Jobs owned by a CronJob are left to its history limits)
+  replicasets     ReplicaSets scaled to zero that are orphaned or report a
+                  ReplicaFailure, older than --older-than
+
+Jobs are deleted with background propagation, so their pods go with them.
+
+Examples:
+  kube-clean --dry-run                  # Report what would be deleted
+  kube-clean -A --older-than 7d         # Whole cluster, keep the last week
+  kube-clean --only evicted-pods -y     # Delete evicted pods without asking`,
+	Args: cobra.NoArgs,
+	RunE: runClean,
+}
+
+// runClean collects candidates, prints the report and deletes them
+func runClean(cmd *cobra.Command, args []string) error {
+	threshold, err := agefilter.ParseAge(cleanOlderThan)
+	if err != nil {
+		return clierr.Usagef("invalid --older-than: %v", err)
+	}
+	categories := map[string]bool{}
+	for _, c := range cleanOnly {
+		if !utils.Contains(allCategories, c) {
+			return clierr.Usagef("unknown category %q (use %s)", c, strings.Join(allCategories, ", "))
+		}
+		categories[c] = true
+	}
+	if len(categories) == 0 {
+		for _, c := range allCategories {
+			categories[c] = true
+		}
+	}
+	if !cleanDryRun && !cleanYes && !term.IsTerminal(int(os.Stdin.Fd())) {
+		return clierr.Usagef("stdin is not a terminal, use --yes to delete or --dry-run to report")
+	}
+
+	client, err := k8s.NewClient("", cleanKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	namespace := cleanNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(cleanKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	if cleanAllNamespaces {
+		namespace = ""
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	now := time.Now()
+	var candidates []candidate
+
+	if categories[categoryFinishedPods] || categories[categoryEvictedPods] {
+		found, err := podCandidates(ctx, client, namespace, threshold, now, categories)
+		if err != nil {
+			return err
+		}
+		candidates = append(candidates, found...)
+	}
+	if categories[categoryJobs] {
+		found, err := jobCandidates(ctx, client, namespace, threshold, now)
+		if err != nil {
+			return err
+		}
+		candidates = append(candidates, found...)
+	}
+	if categories[categoryReplicaSets] {
+		found, err := replicaSetCandidates(ctx, client, namespace, threshold, now)
+		if err != nil {
+			return err
+		}
+		candidates = append(candidates, found...)
+	}
+
+	if len(candidates) == 0 {
+		fmt.Println("Nothing to clean up")
+		return nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].kind != candidates[j].kind {
+			return candidates[i].kind < candidates[j].kind
+		}
+		if candidates[i].namespace != candidates[j].namespace {
+			return candidates[i].namespace < candidates[j].namespace
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	printReport(candidates)
+
+	if cleanDryRun {
+		fmt.Printf("\n%d object(s) would be deleted (dry run)\n", len(candidates))
+		return nil
+	}
+
+	if !cleanYes {
+		if !utils.Confirm(ctx, os.Stdout, fmt.Sprintf("\nDelete %d object(s)? [y/N]: ", len(candidates))) {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+
+	var failed int
+	for i, c := range candidates {
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped after %d of %d object(s), %d failed: %w", i, len(candidates), failed, context.Cause(ctx))
+		}
+		// Pods of deleted Jobs may already be gone
+		if err := c.delete(ctx); err != nil && !apierrors.IsNotFound(err) {
+			fmt.Fprintf(os.Stderr, "Failed to delete %s %s/%s: %v\n", c.kind, c.namespace, c.name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Deleted %s %s/%s\n", c.kind, c.namespace, c.name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d of %d object(s)", failed, len(candidates))
+	}
+	return nil
+}
+
+// podCandidates returns finished and evicted pods
+func podCandidates(ctx context.Context, client *k8s.Client, namespace string, threshold time.Duration, now time.Time, categories map[string]bool) ([]candidate, error) {
+	pods, err := client.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	var found []candidate
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			continue
+		}
+
+		finished := podFinishedAt(&pod)
+		var reason string
+		switch {
+		case pod.Status.Reason == "Evicted":
+			if !categories[categoryEvictedPods] {
+				continue
+			}
+			reason = "Evicted"
+			if pod.Status.Message != "" {
+				reason += ": " + utils.TruncateString(pod.Status.Message, 60)
+			}
+		case categories[categoryFinishedPods] && now.Sub(finished) >= threshold && !ownedBy(pod.OwnerReferences, "Job"):
+			reason = string(pod.Status.Phase)
+		default:
+			continue
+		}
+
+		name, ns := pod.Name, pod.Namespace
+		found = append(found, candidate{
+			kind:      "Pod",
+			namespace: ns,
+			name:      name,
+			reason:    reason,
+			age:       now.Sub(finished),
+			delete: func(ctx context.Context) error {
+				return client.Clientset.CoreV1().Pods(ns).Delete(ctx, name, metav1.DeleteOptions{})
+			},
+		})
+	}
+	return found, nil
+}
+
+// podFinishedAt returns when the last container terminated, falling back to creation
+func podFinishedAt(pod *corev1.Pod) time.Time {
+	finished := pod.CreationTimestamp.Time
+	for _, cs := range pod.Status.ContainerStatuses {
+		if t := cs.State.Terminated; t != nil && t.FinishedAt.After(finished) {
+			finished = t.FinishedAt.Time
+		}
+	}
+	return finished
+}
+
+// jobCandidates returns completed and failed Jobs not managed by a CronJob
+func jobCandidates(ctx context.Context, client *k8s.Client, namespace string, threshold time.Duration, now time.Time) ([]candidate, error) {
+	jobs, err := client.Clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	var found []candidate
+	for _, job := range jobs.Items {
+		if job.DeletionTimestamp != nil || ownedBy(job.OwnerReferences, "CronJob") {
+			continue
+		}
+		state, finished := jobFinished(&job)
+		if state == "" || now.Sub(finished) < threshold {
+			continue
+		}
+
+		name, ns := job.Name, job.Namespace
+		found = append(found, candidate{
+			kind:      "Job",
+			namespace: ns,
+			name:      name,
+			reason:    state,
+			age:       now.Sub(finished),
+			delete: func(ctx context.Context) error {
+				propagation := metav1.DeletePropagationBackground
+				return client.Clientset.BatchV1().Jobs(ns).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+			},
+		})
+	}
+	return found, nil
+}
+
+// jobFinished returns "Complete" or "Failed" with the time of that condition,
+// or an empty state for a Job that is still running
+func jobFinished(job *batchv1.Job) (string, time.Time) {
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		if cond.Type == batchv1.JobComplete || cond.Type == batchv1.JobFailed {
+			finished := cond.LastTransitionTime.Time
+			if job.Status.CompletionTime != nil {
+				finished = job.Status.CompletionTime.Time
+			}
+			return string(cond.Type), finished
+		}
+	}
+	return "", time.Time{}
+}
+
+// replicaSetCandidates returns ReplicaSets scaled to zero that are orphaned or failed
+func replicaSetCandidates(ctx context.Context, client *k8s.Client, namespace string, threshold time.Duration, now time.Time) ([]candidate, error) {
+	list, err := client.Clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicasets: %w", err)
+	}
+
+	var found []candidate
+	for _, rs := range list.Items {
+		if rs.DeletionTimestamp != nil || rs.Status.Replicas > 0 {
+			continue
+		}
+		if rs.Spec.Replicas != nil && *rs.Spec.Replicas > 0 {
+			continue
+		}
+		if now.Sub(rs.CreationTimestamp.Time) < threshold {
+			continue
+		}
+
+		var reason string
+		switch {
+		case metav1.GetControllerOf(&rs) == nil:
+			reason = "Orphaned, 0 replicas"
+		case replicaFailure(&rs) != "":
+			reason = "ReplicaFailure: " + utils.TruncateString(replicaFailure(&rs), 60)
+		default:
+			// Old revisions of a Deployment are pruned by its revisionHistoryLimit
+			continue
+		}
+
+		name, ns := rs.Name, rs.Namespace
+		found = append(found, candidate{
+			kind:      "ReplicaSet",
+			namespace: ns,
+			name:      name,
+			reason:    reason,
+			age:       now.Sub(rs.CreationTimestamp.Time),
+			delete: func(ctx context.Context) error {
+				return client.Clientset.AppsV1().ReplicaSets(ns).Delete(ctx, name, metav1.DeleteOptions{})
+			},
+		})
+	}
+	return found, nil
+}
+
+// replicaFailure returns the message of a true ReplicaFailure condition
+func replicaFailure(rs *appsv1.ReplicaSet) string {
+	for _, cond := range rs.Status.Conditions {
+		if cond.Type == appsv1.ReplicaSetReplicaFailure && cond.Status == corev1.ConditionTrue {
+			if cond.Message != "" {
+				return cond.Message
+			}
+			return cond.Reason
+		}
+	}
+	return ""
+}
+
+// ownedBy reports whether a controller owner reference has the given kind
+func ownedBy(refs []metav1.OwnerReference, kind string) bool {
+	for _, ref := range refs {
+		if ref.Controller != nil && *ref.Controller && ref.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// printReport prints the candidates as a table
+func printReport(candidates []candidate) {
+	headers := []string{"KIND", "NAMESPACE", "NAME", "REASON", "AGE"}
+	rows := make([][]string, 0, len(candidates))
+	for _, c := range candidates {
+		rows = append(rows, []string{c.kind, c.namespace, c.name, c.reason, utils.FormatAge(c.age)})
+	}
+	table.Render(headers, rows)
+}
+
+// init initializes flags for kube-clean command
+func init() {
+	cleanRootCmd.Flags().StringVarP(&cleanNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	cleanRootCmd.Flags().StringVarP(&cleanKubeContext, "context", "c", "", "Kubernetes context to use")
+	cleanRootCmd.Flags().BoolVarP(&cleanAllNamespaces, "all-namespaces", "A", false, "Clean up in all namespaces")
+	cleanRootCmd.Flags().StringVar(&cleanOlderThan, "older-than", "1d", "Only delete objects finished (or created) longer ago than this, e.g. 12h, 7d")
+	cleanRootCmd.Flags().StringSliceVar(&cleanOnly, "only", nil, "Only these categories: finished-pods, evicted-pods, jobs, replicasets (default all)")
+	cleanRootCmd.Flags().BoolVar(&cleanDryRun, "dry-run", false, "Only print the report, delete nothing")
+	cleanRootCmd.Flags().BoolVarP(&cleanYes, "yes", "y", false, "Do not ask for confirmation")
+
+	viper.BindPFlag("namespace", cleanRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", cleanRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-clean
+func main() {
+	k8s.AddVerbosityFlag(cleanRootCmd)
+	k8s.AddRateLimitFlags(cleanRootCmd)
+	config.SetupDefaults(cleanRootCmd)
+	clierr.SetupUsage(cleanRootCmd)
+	cmd, err := cleanRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
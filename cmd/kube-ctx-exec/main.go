@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/tracing"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	ctxExecNamespace string
+)
+
+// ctxExecRootCmd represents the kube-ctx-exec command
+var ctxExecRootCmd = &cobra.Command{
+	Use:   "kube-ctx-exec <context> [-n namespace] -- [command...]",
+	Short: "Run a command against a context without switching",
+	Long: `kube-ctx-exec runs any command (kubectl, helm, scripts, kube-* tools) against
+the given context without changing the current context of your kubeconfig.
+
+A temporary minified kubeconfig containing only the selected context is written
+and exposed to the child process through KUBECONFIG. It is removed when the
+command exits. KUBE_CONTEXT and KUBE_NAMESPACE are also set for scripts.
+
+Examples:
+  kube-ctx-exec staging -- kubectl get pods              # kubectl against staging
+  kube-ctx-exec prod -n payments -- helm list            # helm in prod/payments
+  kube-ctx-exec dev -- kube-pods                         # any kube-* tool`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runCtxExec,
+}
+
+// runCtxExec writes the temporary kubeconfig and runs the child command
+// It uses Cobra's ArgsLenAtDash to split arguments at "--":
+//   - args[:dash] are positional args before "--" (expects: context name)
+//   - args[dash:] are the command and its arguments to run
+func runCtxExec(cmd *cobra.Command, args []string) error {
+	dashIndex := cmd.ArgsLenAtDash()
+
+	if dashIndex == -1 {
+		return clierr.Usagef("invalid syntax. Use: kube-ctx-exec <context> -- [command...]")
+	}
+	if dashIndex < 1 {
+		return clierr.Usagef("context name is required before --")
+	}
+	if dashIndex >= len(args) {
+		return clierr.Usagef("command is required after --")
+	}
+
+	contextName := args[0]
+	command := args[dashIndex:]
+
+	config, err := k8s.LoadRawConfig()
+	if err != nil {
+		return err
+	}
+
+	minified, err := k8s.MinifyForContext(config, contextName)
+	if err != nil {
+		return err
+	}
+
+	// Override namespace only in the temporary kubeconfig
+	if ctxExecNamespace != "" {
+		minified.Contexts[contextName].Namespace = ctxExecNamespace
+	}
+	namespace := minified.Contexts[contextName].Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	// Signals are caught before the temporary kubeconfig exists so it never
+	// outlives the command. Until the child runs, a signal removes the file and
+	// exits. Afterwards Ctrl+C reaches the child through the terminal; stay
+	// alive so the file is cleaned up, and forward SIGTERM explicitly.
+	var mu sync.Mutex
+	var tmpPath string
+	var process *os.Process
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signalCh)
+
+	go func() {
+		for sig := range signalCh {
+			mu.Lock()
+			if process == nil {
+				if tmpPath != "" {
+					os.Remove(tmpPath)
+				}
+				os.Exit(clierr.Interrupted)
+			}
+			if sig == syscall.SIGTERM {
+				process.Signal(sig)
+			}
+			mu.Unlock()
+		}
+	}()
+
+	// CreateTemp creates the file with 0600 permissions
+	mu.Lock()
+	tmp, err := os.CreateTemp("", "kube-ctx-exec-*.yaml")
+	if err == nil {
+		tmpPath = tmp.Name()
+		tmp.Close()
+	}
+	mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to create temporary kubeconfig: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	if err := clientcmd.WriteToFile(*minified, tmpPath); err != nil {
+		return fmt.Errorf("failed to write temporary kubeconfig: %w", err)
+	}
+
+	child := exec.Command(command[0], command[1:]...)
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	child.Env = append(os.Environ(),
+		"KUBECONFIG="+tmpPath,
+		"KUBE_CONTEXT="+contextName,
+		"KUBE_NAMESPACE="+namespace,
+	)
+
+	// Child kube-* tools continue the trace under this span
+	_, span := tracing.Start(context.Background(), "exec "+command[0], map[string]interface{}{
+		"k8s.context":        contextName,
+		"k8s.namespace.name": namespace,
+	})
+	if span != nil {
+		child.Env = append(child.Env, "TRACEPARENT="+span.TraceParent())
+	}
+
+	mu.Lock()
+	err = child.Start()
+	process = child.Process
+	mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", command[0], err)
+	}
+
+	err = child.Wait()
+	span.End(err)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// The child reported its own error, only pass on the exit code
+			code := exitErr.ExitCode()
+			if code < 0 {
+				code = clierr.Generic
+			}
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+			return clierr.Wrap(code, err)
+		}
+		return fmt.Errorf("failed to run %s: %w", command[0], err)
+	}
+
+	return nil
+}
+
+// init initializes flags for kube-ctx-exec command
+func init() {
+	ctxExecRootCmd.Flags().StringVarP(&ctxExecNamespace, "namespace", "n", "", "Namespace to set in the temporary kubeconfig")
+}
+
+// main is the entry point of kube-ctx-exec
+func main() {
+	config.SetupDefaults(ctxExecRootCmd)
+	clierr.SetupUsage(ctxExecRootCmd)
+	cmd, err := ctxExecRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(clierr.ExitCode(err))
+	}
+}
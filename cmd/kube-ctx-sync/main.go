@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"kube/pkg/kubernetes/ctxsync"
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	ctxSyncProfiles      []string
+	ctxSyncRegions       []string
+	ctxSyncProjects      []string
+	ctxSyncSubscriptions []string
+	ctxSyncDryRun        bool
+	ctxSyncTimeout       time.Duration
+)
+
+// ctxSyncTable holds the --quiet and --no-headers options of the result table
+var ctxSyncTable table.Options
+
+// ctxSyncRootCmd represents the kube-ctx-sync command
+var ctxSyncRootCmd = &cobra.Command{
+	Use:   "kube-ctx-sync [eks|gke|aks...]",
+	Short: "Sync kubeconfig contexts from cloud providers",
+	Long: `kube-ctx-sync discovers the managed clusters your cloud credentials can access
+and adds or updates their kubeconfig entries, so the credentials of a dozen
+clusters are current after one command.
+
+Backends call the provider APIs with the credentials of the provider SDKs:
+  eks   AWS profiles (aws configure, aws sso login), clusters of every
+        --profile and --region
+  gke   application default credentials (gcloud auth application-default
+        login), clusters of every --project (all locations)
+  aks   default Azure credentials (environment, managed identity, az login),
+        clusters of every --subscription (Entra ID enabled clusters)
+
+Every cluster gets a context, cluster and user entry named like the provider
+CLI names them (the ARN for EKS, gke_<project>_<location>_<name>, the AKS
+cluster name), so entries made by 'aws eks update-kubeconfig' and friends are
+updated in place. Users authenticate with an exec plugin (aws eks get-token,
+gke-gcloud-auth-plugin, kubelogin), never with stored tokens. The namespace of
+existing contexts is kept; contexts of other clusters are not touched.
+
+Without arguments the providers configured in ~/.kube.yaml are synced:
+
+  ctx-sync:
+    eks:
+      profiles: [prod, staging]
+      regions: [eu-west-1, us-east-1]
+    gke:
+      projects: [acme-prod]
+    aks:
+      subscriptions: [Production]
+
+Flags replace the lists of the config file. Empty lists use the configured
+region or project, and every subscription the Azure credentials can access.`,
+	Example: `
+  # Sync every provider configured in ~/.kube.yaml
+  kube-ctx-sync
+
+  # EKS clusters of two regions
+  kube-ctx-sync eks --region eu-west-1 --region us-east-1
+
+  # Show what would change without writing the kubeconfig
+  kube-ctx-sync gke --project acme-prod --dry-run
+`,
+	ValidArgs: ctxsync.Providers,
+	Args:      cobra.OnlyValidArgs,
+	RunE:      runCtxSync,
+}
+
+// runCtxSync discovers the clusters of the selected providers and merges them into the kubeconfig
+func runCtxSync(cmd *cobra.Command, args []string) error {
+	if err := ctxSyncTable.Validate(); err != nil {
+		return err
+	}
+	if ctxSyncTimeout <= 0 {
+		return clierr.Usagef("--timeout must be positive")
+	}
+
+	if err := config.Load(""); err != nil {
+		return err
+	}
+	providers := args
+	if len(providers) == 0 {
+		for _, provider := range ctxsync.Providers {
+			if viper.IsSet("ctx-sync." + provider) {
+				providers = append(providers, provider)
+			}
+		}
+	}
+	if len(providers) == 0 {
+		return clierr.Usagef("no provider given and none configured under ctx-sync in the config file, pass eks, gke or aks")
+	}
+
+	backends := make([]ctxsync.Backend, len(providers))
+	for i, provider := range providers {
+		var scope ctxsync.Scope
+		if err := config.UnmarshalKey("ctx-sync."+provider, &scope); err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("profile") {
+			scope.Profiles = ctxSyncProfiles
+		}
+		if cmd.Flags().Changed("region") {
+			scope.Regions = ctxSyncRegions
+		}
+		if cmd.Flags().Changed("project") {
+			scope.Projects = ctxSyncProjects
+		}
+		if cmd.Flags().Changed("subscription") {
+			scope.Subscriptions = ctxSyncSubscriptions
+		}
+		backend, err := ctxsync.New(provider, scope)
+		if err != nil {
+			return err
+		}
+		backends[i] = backend
+	}
+
+	// Providers are slow to answer, ask them all at once
+	fmt.Fprintf(os.Stderr, "Discovering clusters (%s)...\n", strings.Join(providers, ", "))
+	ctx, stop := interrupt.Context(context.Background())
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, ctxSyncTimeout)
+	defer cancel()
+	results := make([][]ctxsync.Cluster, len(backends))
+	errs := make([]error, len(backends))
+	var wg sync.WaitGroup
+	for i, backend := range backends {
+		wg.Add(1)
+		go func(i int, backend ctxsync.Backend) {
+			defer wg.Done()
+			results[i], errs[i] = backend.Discover(ctx)
+		}(i, backend)
+	}
+	wg.Wait()
+	if interrupt.Received() {
+		// Never write a kubeconfig from a partial discovery
+		return fmt.Errorf("sync stopped, kubeconfig left unchanged: %w", context.Cause(ctx))
+	}
+
+	var clusters []ctxsync.Cluster
+	var failed error
+	for i, err := range errs {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", providers[i], err)
+			failed = err
+		}
+		clusters = append(clusters, results[i]...)
+	}
+
+	kubeconfig := k8s.KubeconfigPath()
+	kubeConfig, err := ctxsync.LoadKubeconfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	statuses := ctxsync.Merge(kubeConfig, clusters)
+
+	const (
+		colorReset  = "\033[0m"
+		colorGreen  = "\033[32m"
+		colorYellow = "\033[33m"
+	)
+	headers := []string{"PROVIDER", "CONTEXT", "LOCATION", "ACCOUNT", "SERVER", "STATUS"}
+	rows := make([][]string, 0, len(clusters))
+	changed := 0
+	for i, c := range clusters {
+		status := string(statuses[i])
+		switch statuses[i] {
+		case ctxsync.Added:
+			status = colorGreen + status + colorReset
+			changed++
+		case ctxsync.Updated:
+			status = colorYellow + status + colorReset
+			changed++
+		}
+		account := c.Account
+		if account == "" {
+			account = "(default)"
+		}
+		rows = append(rows, []string{c.Provider, c.Context, c.Location, account, c.Server, status})
+	}
+	if len(rows) > 0 {
+		ctxSyncTable.Print(headers, rows, 1)
+	}
+
+	switch {
+	case changed == 0:
+		fmt.Fprintf(os.Stderr, "%d cluster(s) found, kubeconfig is up to date\n", len(clusters))
+	case ctxSyncDryRun:
+		fmt.Fprintf(os.Stderr, "Dry run: %d context(s) would be written to %s\n", changed, kubeconfig)
+	default:
+		if kubeConfig.CurrentContext == "" && len(clusters) > 0 {
+			kubeConfig.CurrentContext = clusters[0].Context
+		}
+		if err := clientcmd.WriteToFile(*kubeConfig, kubeconfig); err != nil {
+			return fmt.Errorf("failed to save kubeconfig: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d context(s) to %s\n", changed, kubeconfig)
+	}
+
+	if failed != nil {
+		return fmt.Errorf("%d of %d provider(s) failed, their clusters may be missing: %w", countErrors(errs), len(errs), failed)
+	}
+	return nil
+}
+
+// countErrors returns how many of errs are set
+func countErrors(errs []error) int {
+	n := 0
+	for _, err := range errs {
+		if err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// init initializes flags for kube-ctx-sync command
+func init() {
+	ctxSyncRootCmd.Flags().StringSliceVar(&ctxSyncProfiles, "profile", nil, "AWS CLI profiles to scan (eks, repeatable)")
+	ctxSyncRootCmd.Flags().StringSliceVar(&ctxSyncRegions, "region", nil, "AWS regions to scan (eks, repeatable)")
+	ctxSyncRootCmd.Flags().StringSliceVar(&ctxSyncProjects, "project", nil, "Google Cloud projects to scan (gke, repeatable)")
+	ctxSyncRootCmd.Flags().StringSliceVar(&ctxSyncSubscriptions, "subscription", nil, "Azure subscriptions to scan (aks, repeatable)")
+	ctxSyncRootCmd.Flags().BoolVar(&ctxSyncDryRun, "dry-run", false, "Show what would change without writing the kubeconfig")
+	ctxSyncRootCmd.Flags().DurationVar(&ctxSyncTimeout, "timeout", 2*time.Minute, "Maximum time to wait for the provider APIs")
+	ctxSyncTable.AddFlags(ctxSyncRootCmd)
+}
+
+// main is the entry point of kube-ctx-sync
+func main() {
+	config.SetupDefaults(ctxSyncRootCmd, ctxsync.Providers...)
+	clierr.SetupUsage(ctxSyncRootCmd)
+	cmd, err := ctxSyncRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
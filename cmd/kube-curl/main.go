@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/target"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+var (
+	curlNamespace   string
+	curlKubeContext string
+	curlMethod      string
+	curlData        string
+	curlHeaders     []string
+	curlPort        string
+	curlPortForward bool
+	curlHTTPS       bool
+	curlSilent      bool
+	curlOutput      string
+	curlFail        bool
+	curlTimeout     time.Duration
+)
+
+// Colors of the status line
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// curlRootCmd represents the kube-curl command
+var curlRootCmd = &cobra.Command{
+	Use:   "kube-curl <pod-name|svc/<service-name>> [path]",
+	Short: "Send an HTTP request to a pod or service",
+	Long: `kube-curl sends an HTTP request to a pod or service from your machine, so
+there is no need to exec into a pod that lacks curl. The status line, the
+response headers and the timing go to stderr, the body to stdout.
+
+By default the request goes through the proxy subresource of the API server
+(/api/v1/namespaces/<ns>/services/<name>:<port>/proxy/<path>); for a service
+the API server picks the endpoint. With --port-forward a temporary
+port-forward to the pod (for a service: a pod backing it) carries the request
+instead, which keeps headers like Host and Authorization intact and works
+where the API server cannot reach pod IPs.
+
+The port is a number or a port name; by default the first port of the service
+or the first container port of the pod. A service port is mapped to the
+target port of the pod with --port-forward.
+
+Targets are resolved like kube-exec: partial pod names, <ns>/<pod>,
+svc/<ns>/<name> and expressions such as @latest:deploy/<name>.
+
+Examples:
+  kube-curl svc/backend /healthz                      # GET through the API server
+  kube-curl svc/backend /api/orders -X POST -d '{"id": 1}' -H 'Content-Type: application/json'
+  kube-curl svc/backend /upload -d @payload.json      # Body from a file (@- for stdin)
+  kube-curl api-0 /metrics --port metrics -s          # Only the body
+  kube-curl svc/backend / --port-forward -H 'Host: shop.example.com'
+  kube-curl @latest:deploy/api /ready --fail          # Exit non-zero on HTTP errors`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runCurl,
+}
+
+// runCurl sends the request and prints the response
+func runCurl(cmd *cobra.Command, args []string) error {
+	ref, requestPath := args[0], "/"
+	if len(args) > 1 {
+		requestPath = args[1]
+	}
+	if !strings.HasPrefix(requestPath, "/") {
+		requestPath = "/" + requestPath
+	}
+	parsedPath, err := url.Parse(requestPath)
+	if err != nil {
+		return clierr.Usagef("invalid path %q: %v", requestPath, err)
+	}
+	header, err := parseHeaders(curlHeaders)
+	if err != nil {
+		return err
+	}
+	body, err := readBody(curlData)
+	if err != nil {
+		return err
+	}
+	method := strings.ToUpper(curlMethod)
+	if method == "" {
+		method = http.MethodGet
+		if body != nil {
+			method = http.MethodPost
+		}
+	}
+
+	client, err := k8s.NewClient("", curlKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	namespace := curlNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(curlKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, curlTimeout)
+	defer cancel()
+
+	start := time.Now()
+	var base *url.URL
+	var via string
+	var transport http.RoundTripper
+	if curlPortForward {
+		var stopForward func()
+		base, via, stopForward, err = forwardURL(ctx, client, namespace, ref)
+		if err != nil {
+			return err
+		}
+		defer stopForward()
+		// Certificates of pods rarely match 127.0.0.1, like curl -k
+		transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	} else {
+		if base, via, err = proxyURL(ctx, client, namespace, ref); err != nil {
+			return err
+		}
+		if transport, err = rest.TransportFor(client.Config); err != nil {
+			return fmt.Errorf("failed to create transport: %w", err)
+		}
+	}
+	setup := time.Since(start)
+
+	requestURL := *base
+	requestURL.Path = strings.TrimSuffix(base.Path, "/") + parsedPath.Path
+	requestURL.RawQuery = parsedPath.RawQuery
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestURL.String(), bodyReader)
+	if err != nil {
+		return clierr.Usagef("invalid request: %v", err)
+	}
+	for name, values := range header {
+		if strings.EqualFold(name, "Host") {
+			req.Host = values[0]
+			continue
+		}
+		req.Header[name] = values
+	}
+
+	var connected, firstByte time.Time
+	req = req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn:              func(httptrace.GotConnInfo) { connected = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}))
+
+	// Redirects are shown, not followed, like curl without -L
+	httpClient := &http.Client{
+		Transport:     transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	sent := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return clierr.Timeoutf("no response from %s within %s", via, curlTimeout)
+		}
+		return fmt.Errorf("request to %s failed: %w", via, err)
+	}
+	defer resp.Body.Close()
+
+	if !curlSilent {
+		printResponseHead(resp)
+	}
+
+	var out io.Writer = os.Stdout
+	if curlOutput != "" {
+		file, err := os.Create(curlOutput)
+		if err != nil {
+			return clierr.Wrap(clierr.Usage, err)
+		}
+		defer file.Close()
+		out = file
+	}
+	counter := &countingWriter{w: out}
+	_, err = io.Copy(counter, resp.Body)
+	done := time.Now()
+	if err != nil {
+		return fmt.Errorf("failed to read the response body: %w", err)
+	}
+
+	if !curlSilent {
+		// Keep the timing off the last line of a body without newline
+		if curlOutput == "" && counter.n > 0 && counter.last != '\n' {
+			fmt.Fprintln(os.Stderr)
+		}
+		timing := fmt.Sprintf("total %s", done.Sub(sent).Round(time.Millisecond))
+		if !connected.IsZero() && !firstByte.IsZero() {
+			timing = fmt.Sprintf("connect %s, first byte %s, %s",
+				connected.Sub(sent).Round(time.Millisecond), firstByte.Sub(sent).Round(time.Millisecond), timing)
+		}
+		if curlPortForward {
+			timing += fmt.Sprintf(", port-forward setup %s", setup.Round(time.Millisecond))
+		}
+		fmt.Fprintf(os.Stderr, "%s %s: %s (%s) via %s\n", method, requestPath, utils.FormatBytes(counter.n), timing, via)
+	}
+
+	if curlFail && resp.StatusCode >= 400 {
+		return clierr.Newf(clierr.Generic, "%s returned %s", via, resp.Status)
+	}
+	return nil
+}
+
+// printResponseHead prints the status line, colored by class, and the
+// headers sorted by name to stderr
+func printResponseHead(resp *http.Response) {
+	color := colorGreen
+	switch {
+	case resp.StatusCode >= 400:
+		color = colorRed
+	case resp.StatusCode >= 300:
+		color = colorYellow
+	}
+	fmt.Fprintf(os.Stderr, "%s%s %s%s\n", color, resp.Proto, resp.Status, colorReset)
+
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range resp.Header[name] {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, value)
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+// proxyURL returns the URL of the target's proxy subresource and a
+// description of the route. Services are addressed directly so the API
+// server picks the endpoint; other targets are resolved to a pod.
+func proxyURL(ctx context.Context, client *k8s.Client, namespace, ref string) (*url.URL, string, error) {
+	scheme := ""
+	if curlHTTPS {
+		scheme = "https:"
+	}
+
+	ns, name := target.SplitNamespace(ref)
+	if ns == "" {
+		ns = namespace
+	}
+	if kind, service, ok := strings.Cut(name, "/"); ok && (kind == "svc" || kind == "service") {
+		svc, err := client.Clientset.CoreV1().Services(ns).Get(ctx, service, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, "", clierr.Newf(clierr.NotFound, "service %s not found in namespace %s", service, ns)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get service %s: %w", service, err)
+		}
+		port, err := servicePort(svc, curlPort)
+		if err != nil {
+			return nil, "", err
+		}
+		u := client.Clientset.CoreV1().RESTClient().Get().
+			Namespace(ns).
+			Resource("services").
+			Name(fmt.Sprintf("%s%s:%d", scheme, svc.Name, port.Port)).
+			SubResource("proxy").URL()
+		return u, fmt.Sprintf("API server proxy to svc/%s:%d", svc.Name, port.Port), nil
+	}
+
+	pod, err := target.ResolvePod(ctx, client.Clientset, namespace, ref)
+	if err != nil {
+		return nil, "", err
+	}
+	port, err := containerPort(pod, curlPort)
+	if err != nil {
+		return nil, "", err
+	}
+	u := client.Clientset.CoreV1().RESTClient().Get().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(fmt.Sprintf("%s%s:%d", scheme, pod.Name, port)).
+		SubResource("proxy").URL()
+	return u, fmt.Sprintf("API server proxy to pod %s:%d", pod.Name, port), nil
+}
+
+// forwardURL starts a port-forward from a free local port to the pod of the
+// target and returns its URL, a description of the route and a function
+// stopping the forward
+func forwardURL(ctx context.Context, client *k8s.Client, namespace, ref string) (*url.URL, string, func(), error) {
+	pod, err := target.ResolvePod(ctx, client.Clientset, namespace, ref)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	// A service port is forwarded to its target port on the pod
+	var port int
+	ns, name := target.SplitNamespace(ref)
+	if ns == "" {
+		ns = namespace
+	}
+	if kind, service, ok := strings.Cut(name, "/"); ok && (kind == "svc" || kind == "service") {
+		svc, err := client.Clientset.CoreV1().Services(ns).Get(ctx, service, metav1.GetOptions{})
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to get service %s: %w", service, err)
+		}
+		svcPort, err := servicePort(svc, curlPort)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		switch {
+		case svcPort.TargetPort.IntValue() > 0:
+			port = svcPort.TargetPort.IntValue()
+		case svcPort.TargetPort.StrVal != "":
+			if port, err = containerPort(pod, svcPort.TargetPort.StrVal); err != nil {
+				return nil, "", nil, err
+			}
+		default:
+			port = int(svcPort.Port)
+		}
+	} else if port, err = containerPort(pod, curlPort); err != nil {
+		return nil, "", nil, err
+	}
+
+	forwardURL := client.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("portforward").URL()
+	transport, upgrader, err := spdy.RoundTripperFor(client.Config)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to create SPDY transport: %w", err)
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", forwardURL)
+
+	stopCh := make(chan struct{})
+	readyCh := make(chan struct{})
+	pf, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", port)}, stopCh, readyCh, io.Discard, os.Stderr)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to create port forwarder: %w", err)
+	}
+	forwardErr := make(chan error, 1)
+	go func() {
+		forwardErr <- pf.ForwardPorts()
+	}()
+
+	select {
+	case <-readyCh:
+	case err := <-forwardErr:
+		return nil, "", nil, fmt.Errorf("port forwarding failed: %w", err)
+	case <-ctx.Done():
+		close(stopCh)
+		return nil, "", nil, clierr.Timeoutf("timeout waiting for the port-forward to pod %s", pod.Name)
+	}
+	ports, err := pf.GetPorts()
+	if err != nil || len(ports) == 0 {
+		close(stopCh)
+		return nil, "", nil, fmt.Errorf("failed to get forwarded port: %v", err)
+	}
+
+	scheme := "http"
+	if curlHTTPS {
+		scheme = "https"
+	}
+	u := &url.URL{Scheme: scheme, Host: fmt.Sprintf("127.0.0.1:%d", ports[0].Local)}
+	return u, fmt.Sprintf("port-forward to pod %s:%d", pod.Name, port), func() { close(stopCh) }, nil
+}
+
+// servicePort returns the port of the service with the given number or name,
+// or its first port when spec is empty
+func servicePort(svc *corev1.Service, spec string) (*corev1.ServicePort, error) {
+	if len(svc.Spec.Ports) == 0 {
+		return nil, clierr.Usagef("service %s has no ports", svc.Name)
+	}
+	if spec == "" {
+		return &svc.Spec.Ports[0], nil
+	}
+	for i, port := range svc.Spec.Ports {
+		if port.Name == spec || strconv.Itoa(int(port.Port)) == spec {
+			return &svc.Spec.Ports[i], nil
+		}
+	}
+	return nil, clierr.Usagef("service %s has no port %s", svc.Name, spec)
+}
+
+// containerPort returns the port number for spec on the pod: a number, the
+// name of a container port, or the first container port when spec is empty
+func containerPort(pod *corev1.Pod, spec string) (int, error) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		return n, nil
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, port := range c.Ports {
+			if spec == "" || port.Name == spec {
+				return int(port.ContainerPort), nil
+			}
+		}
+	}
+	if spec == "" {
+		return 0, clierr.Usagef("pod %s declares no container ports, use --port", pod.Name)
+	}
+	return 0, clierr.Usagef("pod %s has no container port named %s", pod.Name, spec)
+}
+
+// parseHeaders parses -H values of the form "Name: value"
+func parseHeaders(values []string) (http.Header, error) {
+	header := http.Header{}
+	for _, value := range values {
+		name, v, ok := strings.Cut(value, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, clierr.Usagef("invalid header %q, expected 'Name: value'", value)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(v))
+	}
+	return header, nil
+}
+
+// readBody returns the request body of -d: the value itself, or the content
+// of a file with @<file> (@- for stdin). nil means no body.
+func readBody(data string) ([]byte, error) {
+	switch {
+	case data == "":
+		return nil, nil
+	case data == "@-":
+		body, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the body from stdin: %w", err)
+		}
+		return body, nil
+	case strings.HasPrefix(data, "@"):
+		body, err := os.ReadFile(data[1:])
+		if err != nil {
+			return nil, clierr.Wrap(clierr.Usage, err)
+		}
+		return body, nil
+	default:
+		return []byte(data), nil
+	}
+}
+
+// countingWriter counts the bytes written through it and keeps the last one
+type countingWriter struct {
+	w    io.Writer
+	n    int64
+	last byte
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if n > 0 {
+		c.last = p[n-1]
+	}
+	return n, err
+}
+
+// init initializes flags for kube-curl command
+func init() {
+	curlRootCmd.Flags().StringVarP(&curlNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	curlRootCmd.Flags().StringVarP(&curlKubeContext, "context", "c", "", "Kubernetes context to use")
+	curlRootCmd.Flags().StringVarP(&curlMethod, "request", "X", "", "HTTP method (default GET, or POST with -d)")
+	curlRootCmd.Flags().StringVarP(&curlData, "data", "d", "", "Request body, or @<file> to read it from a file (@- for stdin)")
+	curlRootCmd.Flags().StringArrayVarP(&curlHeaders, "header", "H", nil, "Request header 'Name: value' (repeatable)")
+	curlRootCmd.Flags().StringVarP(&curlPort, "port", "p", "", "Port number or name (default the first port of the service or pod)")
+	curlRootCmd.Flags().BoolVar(&curlPortForward, "port-forward", false, "Send the request through a temporary port-forward instead of the API server proxy")
+	curlRootCmd.Flags().BoolVar(&curlHTTPS, "https", false, "Use HTTPS to the pod or service (certificates are not verified)")
+	curlRootCmd.Flags().BoolVarP(&curlSilent, "silent", "s", false, "Only print the body, no status, headers or timing")
+	curlRootCmd.Flags().StringVarP(&curlOutput, "output", "o", "", "Write the body to this file instead of stdout")
+	curlRootCmd.Flags().BoolVarP(&curlFail, "fail", "f", false, "Exit with an error when the status is 400 or higher")
+	curlRootCmd.Flags().DurationVar(&curlTimeout, "timeout", 30*time.Second, "Maximum time for the whole request")
+
+	viper.BindPFlag("namespace", curlRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", curlRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-curl
+func main() {
+	k8s.AddVerbosityFlag(curlRootCmd)
+	k8s.AddRateLimitFlags(curlRootCmd)
+	config.SetupDefaults(curlRootCmd)
+	clierr.SetupUsage(curlRootCmd)
+	cmd, err := curlRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
@@ -2,31 +2,188 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"kube/pkg/kubernetes/changes"
 	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/podstatus"
+	"kube/pkg/kubernetes/rolloutstatus"
+	"kube/pkg/kubernetes/workloads"
+	"kube/pkg/shared/agefilter"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/imagepolicy"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
 	"kube/pkg/shared/utils"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
 )
 
 var (
-	deployNamespace   string
-	deployKubeContext string
+	deployNamespace     string
+	deployKubeContext   string
+	deployAllNamespaces bool
+	deploySelector      string
+	deployTimeout       time.Duration
+	deployTable         table.Options
+	deployAge           agefilter.Filter
+	deployReplicas      int32
+	deployViaHPA        bool
+	deployRolloutPlan   string
+	deployFromStage     string
+	deployYes           bool
+	deployForce         bool
+	deployProgress      string
+	deployMessage       string
+	deployNotesKey      string
+	deployWaitFor       []string
+	deployHistoryOut    table.Options
 )
 
+// defaultNotesAnnotation is the annotation --message writes by default
+const defaultNotesAnnotation = "kube-cmd/release-notes"
+
+// What --wait-for waits for after the rollout
+const (
+	waitForEndpoints = "endpoints"
+	waitForIngress   = "ingress"
+)
+
+// defaultWaitForTimeout bounds --wait-for when --timeout is not set
+const defaultWaitForTimeout = 5 * time.Minute
+
+// gkeBackendsAnnotation is where GKE Ingress reports the health of its
+// backend services, e.g. {"k8s-be-30123--abc":"HEALTHY"}
+const gkeBackendsAnnotation = "ingress.kubernetes.io/backends"
+
+// rolloutPlan is the file read by --rollout-plan
+type rolloutPlan struct {
+	Stages []rolloutStage `json:"stages"`
+}
+
+// rolloutStage is one namespace or context of a rollout plan
+type rolloutStage struct {
+	Name      string `json:"name"`
+	Context   string `json:"context"`
+	Namespace string `json:"namespace"`
+	// Confirm asks before the stage starts
+	Confirm bool `json:"confirm"`
+	// Soak waits after the rollout before the next stage starts
+	Soak metav1.Duration `json:"soak"`
+}
+
+// stageResult is one row of the rollout plan summary
+type stageResult struct {
+	stage     rolloutStage
+	context   string
+	namespace string
+	result    string
+	duration  time.Duration
+}
+
 var deployRootCmd = &cobra.Command{
-	Use:   "kube-deploy [deployment] --image <image[:tag]>",
-	Short: "Update Deployment image and wait for rollout, or list Deployments",
+	Use:   "kube-deploy [deployment|sts/<name>|ds/<name>|cronjob/<name>] [--image <image[:tag]>] [--replicas N [--via-hpa]]",
+	Short: "Update workload images and wait for rollout, or list Deployments",
 	Long: `kube-deploy can:
 
-- List Deployments in the current namespace (when no deployment is provided)
+- List Deployments in the current namespace (when no deployment is provided),
+  or in all namespaces (-A), optionally filtered by labels (-l)
 - Update image for all containers in a Deployment and wait for rollout to complete
+- Change the replica count of a Deployment (--replicas)
+- Update the image of a StatefulSet (sts/<name>), DaemonSet (ds/<name>) or
+  CronJob (cronjob/<name>) the same way
+
+StatefulSets and DaemonSets are waited for like 'kubectl rollout status'. A
+CronJob has no rollout: the new image is used from the next scheduled job on,
+jobs that are already running keep the old one.
+
+The wait follows 'kubectl rollout status': it honors the rollout strategy,
+stops on ProgressDeadlineExceeded or when the Deployment is paused, and
+completes immediately for Deployments scaled to zero.
+
+When a HorizontalPodAutoscaler manages the Deployment, a changed replica count
+is overridden by the HPA on its next sync. kube-deploy warns about that, and
+with --via-hpa sets the HPA minimum (raising the maximum if needed) instead of
+the Deployment replicas. After the rollout it reports whether the HPA already
+rescaled the Deployment.
+
+A complete rollout does not mean traffic reaches the new pods yet. --wait-for
+keeps waiting after it, up to --timeout (default 5m):
+  endpoints  every Service selecting the pods lists all ready pods of the
+             workload as ready endpoints
+  ingress    every Ingress routing to those Services, and Services of type
+             LoadBalancer, got an address from their controller; on GKE the
+             Ingress backends must also report HEALTHY. Other controllers do
+             not publish backend health on the Ingress.
+
+With --rollout-plan the same update is rolled out stage by stage, e.g. dev,
+staging, prod-canary and prod. Every stage names a context and/or namespace
+(the defaults are -c, -n and the context namespace), and the next stage only
+starts after the rollout of the previous one completed:
+
+  stages:
+  - name: dev
+    context: dev
+    namespace: shop
+  - name: staging
+    context: staging
+    namespace: shop
+    soak: 10m        # wait after the rollout before moving on
+  - name: prod
+    context: prod
+    namespace: shop
+    confirm: true    # ask before starting the stage (skip with -y)
+
+When a stage fails or is declined, fix the cause and continue with
+--from-stage <name>; updating a stage that already runs the image again is a
+no-op.
+
+Images are checked against deploy.imagePolicy of the config file
+($HOME/.kube.yaml or $KUBE_CMD_CONFIG) before anything is changed:
+
+  deploy:
+    imagePolicy:
+      denyLatest: true       # reject :latest
+      requireTag: true       # reject images without tag or digest
+      tagPattern: '^v?[0-9]+\.[0-9]+\.[0-9]+$'
+      verifyRegistry: true   # the tag must exist in the registry
+
+Images pinned by digest pass the tag rules. Registry credentials are read
+from the Docker config file. --force deploys a rejected image anyway.
+
+With --progress-format json the rollout wait prints JSON Lines events for CI
+systems instead of text, one per observed change, with the fields timestamp,
+phase (started, progressing, complete, failed, timeout, interrupted), kind,
+namespace, name, stage (rollout plans), revision, desiredReplicas,
+updatedReplicas, readyReplicas, availableReplicas, progressDeadline and
+message. Other output goes to stderr, so stdout only carries events.
+
+Every image update records itself on the workload: kubernetes.io/change-cause
+names the new image, and --message stores release notes in the annotation
+given by --notes-annotation (default kube-cmd/release-notes). Deployments,
+StatefulSets and DaemonSets copy both to the revision the update creates, so
+'kube-deploy history' shows what every revision released and why. An update
+without --message clears the notes, so they never describe a later revision.
 
 Tips:
 - Use --namespace/-n to target a namespace
@@ -38,8 +195,39 @@ Tips:
   # List deployments in namespace my-app
   kube-deploy -n my-app
 
+  # List deployments created in the last hour
+  kube-deploy --newer-than 1h
+
+  # List deployments of a team across all namespaces
+  kube-deploy -A -l team=payments
+
   # Update image for deployment backend and wait for rollout
   kube-deploy backend --image repo/backend:1.2.3
+
+  # Scale an HPA-managed deployment to at least 5 replicas
+  kube-deploy backend --replicas 5 --via-hpa
+
+  # Same release tooling for other workload types
+  kube-deploy sts/db --image postgres:16.2
+  kube-deploy ds/node-agent --image repo/agent:2.0
+  kube-deploy cronjob/report --image repo/report:1.4
+
+  # Deploy an image the image policy rejects
+  kube-deploy backend --image repo/backend:latest --force
+
+  # Roll out stage by stage, then resume at prod after a failure
+  kube-deploy backend --image repo/backend:1.2.3 --rollout-plan plan.yaml
+  kube-deploy backend --image repo/backend:1.2.3 --rollout-plan plan.yaml --from-stage prod
+
+  # Done only when the Service and Ingress serve the new pods
+  kube-deploy backend --image repo/backend:1.2.3 --wait-for endpoints,ingress
+
+  # Progress as JSON Lines for CI
+  kube-deploy backend --image repo/backend:1.2.3 --progress-format json
+
+  # Release with notes, then show the release history
+  kube-deploy backend --image repo/backend:1.2.4 --message "Fix checkout timeout (#812)"
+  kube-deploy history backend
 `,
 	Args: cobra.RangeArgs(0, 1),
 	RunE: runDeploy,
@@ -47,8 +235,84 @@ Tips:
 
 // runDeploy updates image for all containers in the Deployment
 func runDeploy(cmd *cobra.Command, args []string) error {
+	if err := deployTable.Validate(); err != nil {
+		return err
+	}
+
 	image, _ := cmd.Flags().GetString("image")
 
+	if err := deployAge.Validate(); err != nil {
+		return err
+	}
+	if len(args) > 0 && deployAge.Active() {
+		return clierr.Usagef("--older-than and --newer-than only apply when listing deployments")
+	}
+	if len(args) > 0 && (deployAllNamespaces || deploySelector != "") {
+		return clierr.Usagef("-A and --selector only apply when listing deployments")
+	}
+	if _, err := labels.Parse(deploySelector); err != nil {
+		return clierr.Usagef("invalid label selector %q: %v", deploySelector, err)
+	}
+	replicasSet := cmd.Flags().Changed("replicas")
+	if replicasSet && deployReplicas < 0 {
+		return clierr.Usagef("--replicas must not be negative")
+	}
+	if deployViaHPA && !replicasSet {
+		return clierr.Usagef("--via-hpa requires --replicas")
+	}
+	if len(args) == 0 && (replicasSet || strings.TrimSpace(image) != "") {
+		return clierr.Usagef("--image and --replicas require a deployment")
+	}
+	kind, name := workloads.KindDeployment, ""
+	if len(args) > 0 {
+		var err error
+		if kind, name, err = workloads.ParseTarget(args[0]); err != nil {
+			return err
+		}
+	}
+	for _, waitFor := range deployWaitFor {
+		if waitFor != waitForEndpoints && waitFor != waitForIngress {
+			return clierr.Usagef("invalid --wait-for %q, use endpoints and/or ingress", waitFor)
+		}
+	}
+	if len(deployWaitFor) > 0 && (len(args) == 0 || kind == workloads.KindCronJob) {
+		return clierr.Usagef("--wait-for requires a Deployment, StatefulSet or DaemonSet")
+	}
+	if kind != workloads.KindDeployment && replicasSet {
+		return clierr.Usagef("--replicas only applies to Deployments (use kube-sts scale for StatefulSets)")
+	}
+	if len(args) > 0 && strings.TrimSpace(image) == "" && !replicasSet {
+		return clierr.Usagef("--image or --replicas is required when specifying a workload")
+	}
+	if deployFromStage != "" && deployRolloutPlan == "" {
+		return clierr.Usagef("--from-stage requires --rollout-plan")
+	}
+	if deployRolloutPlan != "" && len(args) == 0 {
+		return clierr.Usagef("--rollout-plan requires a workload and --image or --replicas")
+	}
+	if deployProgress != "text" && deployProgress != "json" {
+		return clierr.Usagef("invalid --progress-format %q, use text or json", deployProgress)
+	}
+	if deployMessage != "" && strings.TrimSpace(image) == "" {
+		return clierr.Usagef("--message requires --image")
+	}
+	if errs := validation.IsQualifiedName(deployNotesKey); len(errs) > 0 {
+		return clierr.Usagef("invalid --notes-annotation %q: %s", deployNotesKey, strings.Join(errs, "; "))
+	}
+
+	// Ctrl+C stops waiting; a rollout already started goes on in the cluster
+	ctx, stop := interrupt.Context(context.Background())
+	defer stop()
+
+	if strings.TrimSpace(image) != "" {
+		if err := checkImagePolicy(ctx, image); err != nil {
+			return err
+		}
+	}
+	if deployRolloutPlan != "" {
+		return runRolloutPlan(ctx, kind, name, image, replicasSet)
+	}
+
 	client, err := k8s.NewClient("", deployKubeContext)
 	if err != nil {
 		return fmt.Errorf("failed to create kubernetes client: %w", err)
@@ -63,164 +327,947 @@ func runDeploy(cmd *cobra.Command, args []string) error {
 
 	// If no deployment is provided => list deployments
 	if len(args) == 0 {
-		return listDeployments(context.Background(), client, ns)
+		if deployAllNamespaces {
+			ns = ""
+		}
+		return listDeployments(ctx, client, ns)
 	}
 
-	deploymentName := args[0]
+	return updateWorkload(ctx, client, ns, kind, name, image, replicasSet, "")
+}
 
-	if strings.TrimSpace(image) == "" {
-		return fmt.Errorf("--image is required when specifying a deployment")
+// textOut is where human readable output goes. JSON progress events own
+// stdout, so with --progress-format json text is moved to stderr.
+func textOut() io.Writer {
+	if deployProgress == "json" {
+		return os.Stderr
 	}
+	return os.Stdout
+}
 
-	// Get current Deployment
-	dep, err := client.Clientset.AppsV1().Deployments(ns).Get(context.Background(), deploymentName, metav1.GetOptions{})
+// updateWorkload sets the image and/or replicas of a workload and waits for
+// its rollout. stage names the rollout plan stage in progress events.
+func updateWorkload(ctx context.Context, client *k8s.Client, ns, kind, name, image string, replicasSet bool, stage string) error {
+	w, err := workloads.Get(ctx, client.Clientset, kind, ns, name)
 	if err != nil {
-		return fmt.Errorf("failed to get deployment %s: %w", deploymentName, err)
+		return err
 	}
+	resource := strings.ToLower(kind)
 
-	// Update image for all containers
-	for i := range dep.Spec.Template.Spec.Containers {
-		dep.Spec.Template.Spec.Containers[i].Image = image
+	// Replicas and HPAs only concern Deployments
+	dep, isDeployment := w.(*workloads.Deployment)
+	var hpa *autoscalingv2.HorizontalPodAutoscaler
+	if isDeployment {
+		if hpa, err = findHPA(ctx, client, ns, name); err != nil {
+			return err
+		}
 	}
 
-	// Apply update
-	if _, err := client.Clientset.AppsV1().Deployments(ns).Update(context.Background(), dep, metav1.UpdateOptions{}); err != nil {
-		return fmt.Errorf("failed to update deployment: %w", err)
+	if deployViaHPA {
+		if hpa == nil {
+			return clierr.Newf(clierr.NotFound, "no HorizontalPodAutoscaler targets deployment %s", name)
+		}
+		if hpa, err = scaleHPA(ctx, client, hpa, deployReplicas); err != nil {
+			return err
+		}
+	} else if replicasSet && hpa != nil {
+		fmt.Fprintf(os.Stderr, "Warning: deployment %s is managed by HorizontalPodAutoscaler %s (%s); it will override --replicas %d on its next sync. Use --via-hpa to change the HPA instead.\n",
+			name, hpa.Name, describeHPABounds(hpa), deployReplicas)
 	}
 
-	fmt.Printf("Updated deployment %s image to %s. Waiting for rollout...\n", deploymentName, image)
+	before := w.Copy()
+	var updates []string
+	if strings.TrimSpace(image) != "" {
+		// Update image for all containers
+		if err := w.SetImage("", image); err != nil {
+			return err
+		}
+		// Rerunning a deploy must not rewrite the notes of the running revision
+		if templateImages(before.GetPodTemplate()) != templateImages(w.GetPodTemplate()) {
+			recordRelease(w, image)
+		}
+		updates = append(updates, "image to "+image)
+	}
+	if replicasSet && !deployViaHPA {
+		replicas := deployReplicas
+		dep.Spec.Replicas = &replicas
+		updates = append(updates, fmt.Sprintf("replicas to %d", replicas))
+	}
+
+	if len(updates) > 0 {
+		// Apply update
+		updated, err := w.Update(ctx, client.Clientset)
+		if err != nil {
+			return err
+		}
+		changes.Print(textOut(), resource, ns, name, updated.Changes(before))
+		w = updated
+		fmt.Fprintf(textOut(), "Updated %s %s %s. Waiting for rollout...\n", resource, name, strings.Join(updates, ", "))
+	} else {
+		fmt.Fprintf(textOut(), "Waiting for rollout of %s %s...\n", resource, name)
+	}
 
 	// Wait for rollout to complete
-	if err := waitForDeploymentRollout(context.Background(), client, ns, deploymentName); err != nil {
+	if isDeployment {
+		fmt.Fprintln(textOut(), rolloutstatus.DescribeStrategy(dep.Deployment))
+	}
+	onUpdate := statusPrinter()
+	var progress *rolloutstatus.Emitter
+	if deployProgress == "json" {
+		progress = rolloutstatus.NewEmitter(os.Stdout, kind, ns, name, stage)
+		message := "waiting for rollout"
+		if len(updates) > 0 {
+			message = "updated " + strings.Join(updates, ", ")
+		}
+		progress.Started(message)
+		onUpdate = progress.Update
+	}
+	err = w.Wait(ctx, client.Clientset, deployTimeout, onUpdate)
+	if progress != nil {
+		progress.Finish(err)
+	}
+	if err != nil {
 		return err
 	}
 
-	fmt.Println("Rollout completed")
+	if hpa != nil {
+		applied := rolloutstatus.DesiredReplicas(w.(*workloads.Deployment).Deployment)
+		reportHPA(ctx, client, ns, name, hpa.Name, applied)
+	}
+	if len(deployWaitFor) > 0 {
+		return waitForDependents(ctx, client, w)
+	}
 	return nil
 }
 
-func init() {
-	deployRootCmd.Flags().StringVarP(&deployNamespace, "namespace", "n", "", "Kubernetes namespace to use")
-	deployRootCmd.Flags().StringVarP(&deployKubeContext, "context", "c", "", "Kubernetes context to use")
-	deployRootCmd.Flags().String("image", "", "Container image to set (e.g. repo/app:tag)")
+// dependentCheck is one thing --wait-for waits for. check reports whether
+// it is done and its state, given the ready pods of the workload.
+type dependentCheck struct {
+	name  string
+	check func(ctx context.Context, readyPods map[string]bool) (bool, string, error)
+	done  bool
+	state string
 }
 
-// main is the entry point of kube-deploy
-func main() {
-	if err := deployRootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+// waitForDependents waits until the Services selecting the pods of the
+// workload route to all its ready pods, and/or the Ingresses and load
+// balancers in front of them are served (--wait-for)
+func waitForDependents(ctx context.Context, client *k8s.Client, w workloads.Workload) (err error) {
+	ns := w.GetNamespace()
+	what := strings.ToLower(w.Kind()) + " " + w.GetName()
+	selector, err := w.Selector()
+	if err != nil {
+		return err
+	}
+	services, err := client.Clientset.CoreV1().Services(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	podLabels := labels.Set(w.GetPodTemplate().Labels)
+	var selecting []*corev1.Service
+	for i := range services.Items {
+		svc := &services.Items[i]
+		if len(svc.Spec.Selector) > 0 && labels.SelectorFromSet(svc.Spec.Selector).Matches(podLabels) {
+			selecting = append(selecting, svc)
+		}
+	}
+	if len(selecting) == 0 {
+		return clierr.Newf(clierr.NotFound, "--wait-for: no Service selects the pods of %s", what)
 	}
-}
 
-// waitForDeploymentRollout waits until deployment available replicas == desired
-func waitForDeploymentRollout(ctx context.Context, client *k8s.Client, ns, name string) error {
-	// Simple polling with light backoff
-	for i := 0; i < 180; i++ { // max ~3 minutes (i * 1s)
-		dep, err := client.Clientset.AppsV1().Deployments(ns).Get(ctx, name, metav1.GetOptions{})
+	var checks []*dependentCheck
+	if utils.Contains(deployWaitFor, waitForEndpoints) {
+		for _, svc := range selecting {
+			checks = append(checks, endpointsCheck(client, svc))
+		}
+	}
+	if utils.Contains(deployWaitFor, waitForIngress) {
+		found, err := ingressChecks(ctx, client, ns, selecting)
 		if err != nil {
-			return fmt.Errorf("failed to get deployment during rollout: %w", err)
+			return err
+		}
+		if len(found) == 0 {
+			return clierr.Newf(clierr.NotFound, "--wait-for ingress: no Ingress or LoadBalancer Service routes to the pods of %s", what)
 		}
-		if dep.Status.UpdatedReplicas == *dep.Spec.Replicas &&
-			dep.Status.ReadyReplicas == *dep.Spec.Replicas &&
-			dep.Status.AvailableReplicas == *dep.Spec.Replicas &&
-			dep.Status.ObservedGeneration >= dep.Generation {
+		checks = append(checks, found...)
+	}
+
+	timeout := deployTimeout
+	if timeout == 0 {
+		timeout = defaultWaitForTimeout
+	}
+	fmt.Fprintf(textOut(), "Waiting until traffic reaches %s (%s)...\n", what, strings.Join(deployWaitFor, ", "))
+	ctx, span := tracing.Start(ctx, "dependents wait", map[string]interface{}{
+		"k8s.namespace.name": ns,
+		"workload":           what,
+		"checks":             len(checks),
+	})
+	defer func() { span.End(err) }()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		err := runChecks(ctx, client, ns, selector, checks)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			return err
+		case err == nil && len(pendingChecks(checks)) == 0:
 			return nil
 		}
-		time.Sleep(1 * time.Second)
+
+		select {
+		case <-ctx.Done():
+			waiting := strings.Join(pendingChecks(checks), "; ")
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return clierr.Timeoutf("timeout after %s waiting for %s", timeout, waiting)
+			}
+			return fmt.Errorf("stopped waiting for %s: %w", waiting, context.Cause(ctx))
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// runChecks runs the checks that are not done yet, printing their state
+// when it changed
+func runChecks(ctx context.Context, client *k8s.Client, ns string, selector labels.Selector, checks []*dependentCheck) error {
+	readyPods, err := workloadReadyPods(ctx, client, ns, selector)
+	if err != nil {
+		return err
+	}
+	for _, c := range checks {
+		if c.done {
+			continue
+		}
+		done, state, err := c.check(ctx, readyPods)
+		if err != nil {
+			return err
+		}
+		if state != c.state {
+			fmt.Fprintf(textOut(), "%s: %s\n", c.name, state)
+		}
+		c.done, c.state = done, state
+	}
+	return nil
+}
+
+// pendingChecks describes the checks that are not done yet
+func pendingChecks(checks []*dependentCheck) []string {
+	var pending []string
+	for _, c := range checks {
+		if !c.done {
+			pending = append(pending, c.name+" ("+c.state+")")
+		}
+	}
+	return pending
+}
+
+// workloadReadyPods returns the names of the ready pods of the workload that
+// are not terminating
+func workloadReadyPods(ctx context.Context, client *k8s.Client, ns string, selector labels.Selector) (map[string]bool, error) {
+	pods, err := client.Clientset.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	ready := map[string]bool{}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil && podstatus.IsReady(&pod) {
+			ready[pod.Name] = true
+		}
+	}
+	return ready, nil
+}
+
+// endpointsCheck waits until the EndpointSlices of the Service list every
+// ready pod of the workload as a ready endpoint
+func endpointsCheck(client *k8s.Client, svc *corev1.Service) *dependentCheck {
+	return &dependentCheck{
+		name: "Service " + svc.Name,
+		check: func(ctx context.Context, readyPods map[string]bool) (bool, string, error) {
+			if len(readyPods) == 0 {
+				return false, "no ready pods", nil
+			}
+			slices, err := client.Clientset.DiscoveryV1().EndpointSlices(svc.Namespace).List(ctx, metav1.ListOptions{
+				LabelSelector: discoveryv1.LabelServiceName + "=" + svc.Name,
+			})
+			if err != nil {
+				return false, "", fmt.Errorf("failed to list endpointslices: %w", err)
+			}
+			endpoints := map[string]bool{}
+			for _, slice := range slices.Items {
+				for _, ep := range slice.Endpoints {
+					ready := ep.Conditions.Ready == nil || *ep.Conditions.Ready
+					if ready && ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" {
+						endpoints[ep.TargetRef.Name] = true
+					}
+				}
+			}
+			routed := 0
+			for name := range readyPods {
+				if endpoints[name] {
+					routed++
+				}
+			}
+			message := fmt.Sprintf("%d/%d ready pods are ready endpoints", routed, len(readyPods))
+			return routed == len(readyPods), message, nil
+		},
+	}
+}
+
+// ingressChecks returns the checks of the Ingresses with a backend on one
+// of the Services and of the Services of type LoadBalancer
+func ingressChecks(ctx context.Context, client *k8s.Client, ns string, services []*corev1.Service) ([]*dependentCheck, error) {
+	names := map[string]bool{}
+	var checks []*dependentCheck
+	for _, svc := range services {
+		names[svc.Name] = true
+		if svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
+			checks = append(checks, loadBalancerCheck(client, svc))
+		}
+	}
+	ingresses, err := client.Clientset.NetworkingV1().Ingresses(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+	for i := range ingresses.Items {
+		ing := &ingresses.Items[i]
+		for _, backend := range ingressBackends(ing) {
+			if backend.Service != nil && names[backend.Service.Name] {
+				checks = append(checks, ingressCheck(client, ing))
+				break
+			}
+		}
+	}
+	return checks, nil
+}
+
+// ingressBackends returns the default backend and the backends of all rules
+func ingressBackends(ing *networkingv1.Ingress) []networkingv1.IngressBackend {
+	var backends []networkingv1.IngressBackend
+	if ing.Spec.DefaultBackend != nil {
+		backends = append(backends, *ing.Spec.DefaultBackend)
+	}
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			backends = append(backends, path.Backend)
+		}
+	}
+	return backends
+}
+
+// ingressCheck waits until the Ingress has an address and, when the
+// controller reports them (GKE), all its backends are healthy
+func ingressCheck(client *k8s.Client, ing *networkingv1.Ingress) *dependentCheck {
+	return &dependentCheck{
+		name: "Ingress " + ing.Name,
+		check: func(ctx context.Context, _ map[string]bool) (bool, string, error) {
+			current, err := client.Clientset.NetworkingV1().Ingresses(ing.Namespace).Get(ctx, ing.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, "", fmt.Errorf("failed to get ingress %s: %w", ing.Name, err)
+			}
+			var addresses []string
+			for _, lb := range current.Status.LoadBalancer.Ingress {
+				addresses = append(addresses, utils.OrDash(lb.IP+lb.Hostname))
+			}
+			if len(addresses) == 0 {
+				return false, "waiting for an address from the ingress controller", nil
+			}
+			address := "address " + strings.Join(addresses, ", ")
+
+			raw, ok := current.Annotations[gkeBackendsAnnotation]
+			if !ok {
+				return true, address + " (the controller does not report backend health)", nil
+			}
+			var backends map[string]string
+			if err := json.Unmarshal([]byte(raw), &backends); err != nil {
+				return false, "", fmt.Errorf("invalid %s annotation on ingress %s: %w", gkeBackendsAnnotation, ing.Name, err)
+			}
+			healthy := 0
+			var unhealthy []string
+			for backend, state := range backends {
+				if state == "HEALTHY" {
+					healthy++
+				} else {
+					unhealthy = append(unhealthy, backend+" "+state)
+				}
+			}
+			sort.Strings(unhealthy)
+			message := fmt.Sprintf("%s, %d/%d backends HEALTHY", address, healthy, len(backends))
+			if len(unhealthy) > 0 {
+				message += " (" + strings.Join(unhealthy, ", ") + ")"
+			}
+			return len(unhealthy) == 0, message, nil
+		},
+	}
+}
+
+// loadBalancerCheck waits until the Service of type LoadBalancer has an address
+func loadBalancerCheck(client *k8s.Client, svc *corev1.Service) *dependentCheck {
+	return &dependentCheck{
+		name: "LoadBalancer " + svc.Name,
+		check: func(ctx context.Context, _ map[string]bool) (bool, string, error) {
+			current, err := client.Clientset.CoreV1().Services(svc.Namespace).Get(ctx, svc.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, "", fmt.Errorf("failed to get service %s: %w", svc.Name, err)
+			}
+			var addresses []string
+			for _, lb := range current.Status.LoadBalancer.Ingress {
+				addresses = append(addresses, utils.OrDash(lb.IP+lb.Hostname))
+			}
+			if len(addresses) == 0 {
+				return false, "waiting for an address from the load balancer controller", nil
+			}
+			return true, "address " + strings.Join(addresses, ", "), nil
+		},
+	}
+}
+
+// recordRelease sets the change-cause and release notes annotations of an
+// image update. The controller copies them to the revision it creates.
+func recordRelease(w workloads.Workload, image string) {
+	annotations := w.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[rolloutstatus.ChangeCauseAnnotation] = "kube-deploy --image " + image
+	if deployMessage != "" {
+		annotations[deployNotesKey] = deployMessage
+	} else {
+		delete(annotations, deployNotesKey)
+	}
+	w.SetAnnotations(annotations)
+}
+
+// templateImages returns the container images of a pod template, for
+// comparing and listing them
+func templateImages(template *corev1.PodTemplateSpec) string {
+	images := make([]string, 0, len(template.Spec.Containers))
+	for _, c := range template.Spec.Containers {
+		images = append(images, c.Image)
+	}
+	return strings.Join(images, ",")
+}
+
+// runRolloutPlan applies the update to every stage of the plan in order,
+// starting at --from-stage
+func runRolloutPlan(ctx context.Context, kind, name, image string, replicasSet bool) error {
+	const (
+		colorReset  = "\033[0m"
+		colorRed    = "\033[31m"
+		colorGreen  = "\033[32m"
+		colorYellow = "\033[33m"
+	)
+
+	plan, err := loadRolloutPlan(deployRolloutPlan)
+	if err != nil {
+		return err
+	}
+	start := 0
+	if deployFromStage != "" {
+		start = -1
+		for i, stage := range plan.Stages {
+			if stage.Name == deployFromStage {
+				start = i
+			}
+		}
+		if start < 0 {
+			return clierr.Usagef("stage %q is not in %s", deployFromStage, deployRolloutPlan)
+		}
+	}
+
+	results := make([]stageResult, len(plan.Stages))
+	for i, stage := range plan.Stages {
+		results[i] = stageResult{stage: stage, result: "pending"}
+		results[i].context, results[i].namespace, err = stageTarget(stage)
+		if err != nil {
+			return err
+		}
+		if i < start {
+			results[i].result = "skipped"
+		}
+	}
+	printResults := func() {
+		headers := []string{"STAGE", "CONTEXT", "NAMESPACE", "RESULT", "DURATION"}
+		rows := make([][]string, 0, len(results))
+		for _, r := range results {
+			result := r.result
+			switch result {
+			case "done":
+				result = colorGreen + result + colorReset
+			case "failed":
+				result = colorRed + result + colorReset
+			case "declined":
+				result = colorYellow + result + colorReset
+			}
+			duration := "-"
+			if r.duration > 0 {
+				duration = r.duration.Round(time.Second).String()
+			}
+			rows = append(rows, []string{r.stage.Name, r.context, r.namespace, result, duration})
+		}
+		// The stage events tell the same in JSON mode
+		if deployProgress == "json" {
+			return
+		}
+		fmt.Println()
+		table.Render(headers, rows)
+	}
+
+	resource := strings.ToLower(kind)
+	for i := start; i < len(plan.Stages); i++ {
+		stage, r := plan.Stages[i], &results[i]
+		fmt.Fprintf(textOut(), "\n=== Stage %d/%d: %s (context %s, namespace %s) ===\n", i+1, len(plan.Stages), stage.Name, r.context, r.namespace)
+		if stage.Confirm && !deployYes {
+			if !utils.Confirm(ctx, textOut(), fmt.Sprintf("Roll out %s %s to %s? [y/N]: ", resource, name, stage.Name)) {
+				r.result = "declined"
+				printResults()
+				return clierr.Newf(clierr.Generic, "rollout stopped before stage %s, continue with --from-stage %s", stage.Name, stage.Name)
+			}
+		}
+
+		started := time.Now()
+		client, err := k8s.SharedClient(r.context)
+		if err == nil {
+			err = updateWorkload(ctx, client, r.namespace, kind, name, image, replicasSet, stage.Name)
+		}
+		r.duration = time.Since(started)
+		if err != nil {
+			r.result = "failed"
+			printResults()
+			return fmt.Errorf("stage %s failed, continue with --from-stage %s after fixing it: %w", stage.Name, stage.Name, err)
+		}
+		r.result = "done"
+
+		if soak := stage.Soak.Duration; soak > 0 && i < len(plan.Stages)-1 {
+			fmt.Fprintf(textOut(), "Soaking %s before the next stage...\n", soak)
+			select {
+			case <-ctx.Done():
+				printResults()
+				return fmt.Errorf("rollout stopped while soaking after stage %s, continue with --from-stage %s", stage.Name, plan.Stages[i+1].Name)
+			case <-time.After(soak):
+			}
+		}
+	}
+	printResults()
+	return nil
+}
+
+// loadRolloutPlan reads and checks a rollout plan file
+func loadRolloutPlan(path string) (*rolloutPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, clierr.Wrap(clierr.Usage, fmt.Errorf("failed to read rollout plan: %w", err))
+	}
+	var plan rolloutPlan
+	if err := yaml.UnmarshalStrict(data, &plan); err != nil {
+		return nil, clierr.Usagef("invalid rollout plan %s: %v", path, err)
+	}
+	if len(plan.Stages) == 0 {
+		return nil, clierr.Usagef("rollout plan %s has no stages", path)
+	}
+
+	seen := map[string]bool{}
+	for i := range plan.Stages {
+		stage := &plan.Stages[i]
+		if stage.Name == "" {
+			stage.Name = strings.Trim(stage.Context+"/"+stage.Namespace, "/")
+		}
+		if stage.Name == "" {
+			return nil, clierr.Usagef("stage %d of %s needs a name, context or namespace", i+1, path)
+		}
+		if seen[stage.Name] {
+			return nil, clierr.Usagef("stage %q appears twice in %s", stage.Name, path)
+		}
+		if stage.Soak.Duration < 0 {
+			return nil, clierr.Usagef("stage %q has a negative soak", stage.Name)
+		}
+		seen[stage.Name] = true
+	}
+	return &plan, nil
+}
+
+// stageTarget returns the context and namespace a stage rolls out to
+func stageTarget(stage rolloutStage) (string, string, error) {
+	contextName := stage.Context
+	if contextName == "" {
+		contextName = deployKubeContext
+	}
+	if contextName == "" {
+		rawCfg, err := k8s.LoadRawConfig()
+		if err != nil {
+			return "", "", err
+		}
+		contextName = rawCfg.CurrentContext
+	}
+
+	ns := stage.Namespace
+	if ns == "" {
+		ns = deployNamespace
+	}
+	if ns == "" {
+		var err error
+		if ns, err = k8s.GetCurrentNamespace(contextName); err != nil {
+			return "", "", fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	return contextName, ns, nil
+}
+
+// checkImagePolicy applies deploy.imagePolicy of the config file to the
+// image before anything is changed. With --force violations are reported
+// as warnings only.
+func checkImagePolicy(ctx context.Context, image string) error {
+	if err := config.Load(""); err != nil {
+		return err
+	}
+	var policy imagepolicy.Policy
+	if err := config.UnmarshalKey("deploy.imagePolicy", &policy); err != nil {
+		return err
+	}
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	violation := policy.Check(image)
+	if violation == nil && policy.VerifyRegistry {
+		fmt.Fprintf(textOut(), "Checking that %s exists in the registry...\n", image)
+		violation = imagepolicy.Verify(ctx, image)
+	}
+	switch {
+	case violation == nil:
+		return nil
+	case deployForce:
+		fmt.Fprintf(os.Stderr, "Warning: %v, deploying anyway (--force)\n", violation)
+		return nil
+	}
+	return fmt.Errorf("%w (deploy.imagePolicy in %s, use --force to deploy anyway)", violation, viper.ConfigFileUsed())
+}
+
+// statusPrinter returns a callback printing rollout messages when they change
+func statusPrinter() func(rolloutstatus.Status) {
+	lastMessage := ""
+	return func(st rolloutstatus.Status) {
+		if st.Message != lastMessage {
+			fmt.Fprintln(textOut(), st.Message)
+			lastMessage = st.Message
+		}
+	}
+}
+
+// findHPA returns the HorizontalPodAutoscaler targeting the Deployment, or nil
+func findHPA(ctx context.Context, client *k8s.Client, ns, name string) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	list, err := client.Clientset.AutoscalingV2().HorizontalPodAutoscalers(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list horizontal pod autoscalers: %w", err)
+	}
+	for i := range list.Items {
+		ref := list.Items[i].Spec.ScaleTargetRef
+		if ref.Kind == "Deployment" && ref.Name == name {
+			return &list.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// scaleHPA sets the HPA minimum to replicas, raising the maximum when it is lower
+func scaleHPA(ctx context.Context, client *k8s.Client, hpa *autoscalingv2.HorizontalPodAutoscaler, replicas int32) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	if replicas < 1 {
+		return nil, clierr.Usagef("--via-hpa needs --replicas of at least 1, HPA minimum cannot be zero")
+	}
+	before := describeHPABounds(hpa)
+	hpa.Spec.MinReplicas = &replicas
+	if hpa.Spec.MaxReplicas < replicas {
+		hpa.Spec.MaxReplicas = replicas
+	}
+
+	updated, err := client.Clientset.AutoscalingV2().HorizontalPodAutoscalers(hpa.Namespace).Update(ctx, hpa, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update horizontal pod autoscaler %s: %w", hpa.Name, err)
+	}
+	fmt.Fprintf(textOut(), "Updated HorizontalPodAutoscaler %s: %s -> %s\n", hpa.Name, before, describeHPABounds(updated))
+	return updated, nil
+}
+
+// describeHPABounds formats the replica range of an HPA
+func describeHPABounds(hpa *autoscalingv2.HorizontalPodAutoscaler) string {
+	minReplicas := int32(1)
+	if hpa.Spec.MinReplicas != nil {
+		minReplicas = *hpa.Spec.MinReplicas
+	}
+	return fmt.Sprintf("min %d, max %d", minReplicas, hpa.Spec.MaxReplicas)
+}
+
+// reportHPA tells whether the HPA already changed the replica count set by the rollout
+func reportHPA(ctx context.Context, client *k8s.Client, ns, name, hpaName string, applied int32) {
+	dep, err := client.Clientset.AppsV1().Deployments(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+	hpa, err := client.Clientset.AutoscalingV2().HorizontalPodAutoscalers(ns).Get(ctx, hpaName, metav1.GetOptions{})
+	if err != nil {
+		return
 	}
-	return fmt.Errorf("timeout waiting for rollout of deployment %s", name)
+
+	current := rolloutstatus.DesiredReplicas(dep)
+	if current != applied {
+		fmt.Fprintf(textOut(), "HorizontalPodAutoscaler %s scaled deployment %s from %d to %d replicas (%s)\n",
+			hpaName, name, applied, current, describeHPABounds(hpa))
+		return
+	}
+	fmt.Fprintf(textOut(), "HorizontalPodAutoscaler %s: %d replicas, desired %d (%s)\n",
+		hpaName, current, hpa.Status.DesiredReplicas, describeHPABounds(hpa))
+}
+
+func init() {
+	deployRootCmd.PersistentFlags().StringVarP(&deployNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	deployRootCmd.PersistentFlags().StringVarP(&deployKubeContext, "context", "c", "", "Kubernetes context to use")
+	deployRootCmd.Flags().BoolVarP(&deployAllNamespaces, "all-namespaces", "A", false, "List deployments from all namespaces")
+	deployRootCmd.Flags().StringVarP(&deploySelector, "selector", "l", "", "Only list deployments matching this label selector")
+	deployRootCmd.Flags().String("image", "", "Container image to set (e.g. repo/app:tag)")
+	deployRootCmd.Flags().Int32Var(&deployReplicas, "replicas", 0, "Replica count to set")
+	deployRootCmd.Flags().BoolVar(&deployViaHPA, "via-hpa", false, "With --replicas, set the minimum of the managing HorizontalPodAutoscaler instead of the Deployment replicas")
+	deployRootCmd.Flags().StringVar(&deployRolloutPlan, "rollout-plan", "", "Roll out stage by stage across the namespaces and contexts of this YAML file")
+	deployRootCmd.Flags().StringVar(&deployFromStage, "from-stage", "", "With --rollout-plan, start at this stage, e.g. after a failure")
+	deployRootCmd.Flags().BoolVarP(&deployYes, "yes", "y", false, "Do not ask for confirmation before rollout plan stages")
+	deployRootCmd.Flags().BoolVar(&deployForce, "force", false, "Deploy an image even if deploy.imagePolicy rejects it or the registry does not have it")
+	deployTable.AddFlags(deployRootCmd)
+	deployAge.AddFlags(deployRootCmd)
+	deployRootCmd.Flags().DurationVar(&deployTimeout, "timeout", 0, "Maximum time to wait for the rollout (default: progressDeadlineSeconds + 1m)")
+	deployRootCmd.Flags().StringVar(&deployProgress, "progress-format", "text", "Rollout progress output: text, or json for one JSON event per line")
+	deployRootCmd.Flags().StringVarP(&deployMessage, "message", "m", "", "Release notes of the image update, stored in the --notes-annotation annotation")
+	deployRootCmd.Flags().StringSliceVar(&deployWaitFor, "wait-for", nil, "After the rollout, also wait until traffic reaches the new pods: endpoints (Service endpoints) and/or ingress (Ingress and LoadBalancer addresses, GKE backend health)")
+	deployRootCmd.PersistentFlags().StringVar(&deployNotesKey, "notes-annotation", defaultNotesAnnotation, "Annotation holding the release notes of --message")
+	deployHistoryOut.AddFlags(deployHistoryCmd)
+	deployRootCmd.AddCommand(deployHistoryCmd)
 }
 
-// listDeployments displays a table of Deployments in the namespace
+// main is the entry point of kube-deploy
+func main() {
+	k8s.AddVerbosityFlag(deployRootCmd)
+	k8s.AddRateLimitFlags(deployRootCmd)
+	k8s.AddFromDirFlag(deployRootCmd)
+	config.SetupDefaults(deployRootCmd, "imagePolicy")
+	clierr.SetupUsage(deployRootCmd)
+	cmd, err := deployRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
+
+// listDeployments displays a table of Deployments in the namespace, or in
+// all namespaces when ns is empty
 func listDeployments(ctx context.Context, client *k8s.Client, ns string) error {
-	list, err := client.Clientset.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{})
+	list, err := client.Clientset.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{LabelSelector: deploySelector})
 	if err != nil {
 		return fmt.Errorf("failed to list deployments: %w", err)
 	}
 
 	headers := []string{"NAME", "READY", "UP-TO-DATE", "AVAILABLE", "AGE"}
-	var rows [][]string
+	if ns == "" {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+	now := time.Now()
+	rows := make([][]string, 0, len(list.Items))
 	for _, dep := range list.Items {
-		desired := int32(1)
-		if dep.Spec.Replicas != nil {
-			desired = *dep.Spec.Replicas
+		if !deployAge.Match(dep.CreationTimestamp.Time, now) {
+			continue
 		}
+		desired := rolloutstatus.DesiredReplicas(&dep)
 		ready := dep.Status.ReadyReplicas
 		upToDate := dep.Status.UpdatedReplicas
 		available := dep.Status.AvailableReplicas
 		age := time.Since(dep.CreationTimestamp.Time)
 
-		rows = append(rows, []string{
+		row := []string{
 			dep.Name,
 			fmt.Sprintf("%d/%d", ready, desired),
 			fmt.Sprintf("%d", upToDate),
 			fmt.Sprintf("%d", available),
 			utils.FormatAge(age),
-		})
+		}
+		if ns == "" {
+			row = append([]string{dep.Namespace}, row...)
+		}
+		rows = append(rows, row)
 	}
 
-	renderTable(headers, rows)
+	nameCol := 0
+	if ns == "" {
+		nameCol = 1
+	}
+	deployTable.Print(headers, rows, nameCol)
 	return nil
 }
 
-// Table helpers (similar to other commands)
-func renderTable(headers []string, rows [][]string) {
-	widths := make([]int, len(headers))
-	for c, h := range headers {
-		w := displayWidth(h)
-		if w > widths[c] {
-			widths[c] = w
-		}
+// deployHistoryCmd represents the kube-deploy history command
+var deployHistoryCmd = &cobra.Command{
+	Use:   "history <deployment|sts/<name>|ds/<name>>",
+	Short: "Show the revisions of a workload with their images, change-cause and release notes",
+	Long: `history lists the revisions of a Deployment (its ReplicaSets) or of a
+StatefulSet or DaemonSet (its ControllerRevisions), oldest first, with the
+images, the kubernetes.io/change-cause and the release notes kube-deploy
+recorded for them. The revision the workload currently runs is marked.
+
+Revisions pruned by revisionHistoryLimit are gone from the cluster and missing
+from the list.
+
+Examples:
+  kube-deploy history backend
+  kube-deploy history sts/db -n data
+  kube-deploy history backend -o json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDeployHistory,
+}
+
+// releaseRevision is one row of the release history
+type releaseRevision struct {
+	revision int64
+	images   string
+	created  time.Time
+	meta     metav1.ObjectMeta
+	current  bool
+}
+
+// runDeployHistory lists the revisions of a workload
+func runDeployHistory(cmd *cobra.Command, args []string) error {
+	if err := deployHistoryOut.Validate(); err != nil {
+		return err
 	}
-	for _, row := range rows {
-		for c, cell := range row {
-			w := displayWidth(cell)
-			if w > widths[c] {
-				widths[c] = w
-			}
+	kind, name, err := workloads.ParseTarget(args[0])
+	if err != nil {
+		return err
+	}
+	if kind != workloads.KindDeployment && kind != workloads.KindStatefulSet && kind != workloads.KindDaemonSet {
+		return clierr.Usagef("%s has no revisions, history applies to Deployments, StatefulSets and DaemonSets", strings.ToLower(kind))
+	}
+
+	client, err := k8s.NewClient("", deployKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	ns := deployNamespace
+	if ns == "" {
+		if ns, err = k8s.GetCurrentNamespace(deployKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
 		}
 	}
-	printSeparator(widths)
-	fmt.Println("| " + joinRow(headers, widths) + " |")
-	printSeparator(widths)
-	for _, row := range rows {
-		fmt.Println("| " + joinRow(row, widths) + " |")
+
+	ctx := context.Background()
+	w, err := workloads.Get(ctx, client.Clientset, kind, ns, name)
+	if err != nil {
+		return err
 	}
-	printSeparator(widths)
-}
+	var revisions []releaseRevision
+	if kind == workloads.KindDeployment {
+		revisions, err = replicaSetRevisions(ctx, client, w.(*workloads.Deployment))
+	} else {
+		revisions, err = controllerRevisions(ctx, client, w)
+	}
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		return clierr.Newf(clierr.NotFound, "no revisions found for %s %s", strings.ToLower(kind), name)
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].revision < revisions[j].revision })
 
-func displayWidth(s string) int {
-	return len(stripANSI(s))
+	headers := []string{"REVISION", "IMAGES", "CHANGE-CAUSE", "NOTES", "AGE"}
+	rows := make([][]string, 0, len(revisions))
+	for _, r := range revisions {
+		revision := strconv.FormatInt(r.revision, 10)
+		if r.current {
+			revision += " (current)"
+		}
+		rows = append(rows, []string{
+			revision,
+			r.images,
+			utils.OrDash(r.meta.Annotations[rolloutstatus.ChangeCauseAnnotation]),
+			utils.OrDash(r.meta.Annotations[deployNotesKey]),
+			utils.FormatAge(time.Since(r.created)),
+		})
+	}
+	deployHistoryOut.Print(headers, rows, 0)
+	return nil
 }
 
-func stripANSI(s string) string {
-	ansi := regexp.MustCompile("\\x1b\\[[0-9;]*m")
-	return ansi.ReplaceAllString(s, "")
-}
+// replicaSetRevisions returns the revisions of a Deployment from the
+// ReplicaSets it owns
+func replicaSetRevisions(ctx context.Context, client *k8s.Client, dep *workloads.Deployment) ([]releaseRevision, error) {
+	selector, err := dep.Selector()
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.Clientset.AppsV1().ReplicaSets(dep.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replica sets: %w", err)
+	}
 
-func joinRow(cols []string, widths []int) string {
-	parts := make([]string, len(cols))
-	for i, col := range cols {
-		pad := widths[i] - displayWidth(col)
-		if pad < 0 {
-			pad = 0
+	current := dep.Annotations[rolloutstatus.RevisionAnnotation]
+	var revisions []releaseRevision
+	for _, rs := range list.Items {
+		if !metav1.IsControlledBy(&rs, dep) {
+			continue
+		}
+		value := rs.Annotations[rolloutstatus.RevisionAnnotation]
+		revision, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
 		}
-		parts[i] = col + strings.Repeat(" ", pad)
+		revisions = append(revisions, releaseRevision{
+			revision: revision,
+			images:   templateImages(&rs.Spec.Template),
+			created:  rs.CreationTimestamp.Time,
+			meta:     rs.ObjectMeta,
+			current:  value == current,
+		})
 	}
-	return strings.Join(parts, " | ")
+	return revisions, nil
 }
 
-func printSeparator(widths []int) {
-	b := strings.Builder{}
-	b.WriteString("+")
-	for i, w := range widths {
-		b.WriteString(strings.Repeat("-", w+2))
-		if i == len(widths)-1 {
-			b.WriteString("+")
-		} else {
-			b.WriteString("+")
+// controllerRevisions returns the revisions of a StatefulSet or DaemonSet.
+// The pod template is read from the patch the controller stores.
+func controllerRevisions(ctx context.Context, client *k8s.Client, w workloads.Workload) ([]releaseRevision, error) {
+	selector, err := w.Selector()
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.Clientset.AppsV1().ControllerRevisions(w.GetNamespace()).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list controller revisions: %w", err)
+	}
+
+	var revisions []releaseRevision
+	latest := -1
+	for _, cr := range list.Items {
+		if !metav1.IsControlledBy(&cr, w) {
+			continue
+		}
+		var data struct {
+			Spec struct {
+				Template corev1.PodTemplateSpec `json:"template"`
+			} `json:"spec"`
+		}
+		images := "-"
+		if json.Unmarshal(cr.Data.Raw, &data) == nil {
+			images = templateImages(&data.Spec.Template)
 		}
+		revision := releaseRevision{revision: cr.Revision, images: images, created: cr.CreationTimestamp.Time, meta: cr.ObjectMeta}
+		if sts, ok := w.(*workloads.StatefulSet); ok {
+			revision.current = cr.Name == sts.Status.UpdateRevision
+		} else if latest < 0 || cr.Revision > revisions[latest].revision {
+			// A DaemonSet always rolls towards its newest revision
+			latest = len(revisions)
+		}
+		revisions = append(revisions, revision)
+	}
+	if latest >= 0 {
+		revisions[latest].current = true
 	}
-	fmt.Println(b.String())
+	return revisions, nil
 }
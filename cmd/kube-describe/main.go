@@ -0,0 +1,641 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/scheduling"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	describeKubeContext string
+	describeOutput      string
+)
+
+const (
+	// barWidth is the number of cells in an allocation bar
+	barWidth = 20
+	// maxConditionMessage keeps condition rows on one line
+	maxConditionMessage = 80
+)
+
+// describeRootCmd represents the kube-describe command
+var describeRootCmd = &cobra.Command{
+	Use:   "kube-describe",
+	Short: "Describe resources with a triage-oriented view",
+	Long: `kube-describe shows resources the way you need them when something is wrong.
+
+With -o json or -o yaml the same view is printed as data: the computed
+status, conditions with whether they are healthy, allocations with
+percentages and the joined pods and events, for scripts and runbooks.
+Quantities are Kubernetes quantities (500m, 2Gi), times are RFC 3339.
+
+Examples:
+  kube-describe node worker-1           # Conditions, allocations, taints, pods and events of a node
+  kube-describe node worker-1 -o json   # The same as JSON`,
+}
+
+// describeNodeCmd represents the kube-describe node subcommand
+var describeNodeCmd = &cobra.Command{
+	Use:   "node <name>",
+	Short: "Show node conditions, allocated resources, taints, pods and events",
+	Long: `node shows the capacity triage view of a node:
+
+- Status like kubectl: Ready, NotReady or Unknown, SchedulingDisabled when cordoned
+- Conditions (Ready, MemoryPressure, DiskPressure, PIDPressure, ...), with
+  unhealthy ones highlighted
+- Allocatable resources against the sum of pod requests and limits, with bars
+- Taints
+- The non-terminated pods on the node with their requests and limits
+- The events of the node, latest last
+
+Pod requests follow the scheduler: app containers and native sidecars add up,
+a regular init container counts when it asks for more, plus the pod overhead.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDescribeNode,
+}
+
+// podResources are the effective requests and limits of a pod
+type podResources struct {
+	requests corev1.ResourceList
+	limits   corev1.ResourceList
+}
+
+// nodeDescription is the node view: printed as text, or as is with -o json|yaml
+type nodeDescription struct {
+	Name string `json:"name"`
+	// Status is Ready, NotReady or Unknown like kubectl, plus
+	// SchedulingDisabled when the node is cordoned
+	Status           string          `json:"status"`
+	Roles            []string        `json:"roles"`
+	Created          time.Time       `json:"created"`
+	KubeletVersion   string          `json:"kubeletVersion"`
+	OSImage          string          `json:"osImage"`
+	ContainerRuntime string          `json:"containerRuntime"`
+	Addresses        []nodeAddress   `json:"addresses,omitempty"`
+	Unschedulable    bool            `json:"unschedulable"`
+	Conditions       []nodeCondition `json:"conditions"`
+	Taints           []string        `json:"taints"`
+	Allocations      []allocation    `json:"allocations"`
+	Pods             []nodePod       `json:"pods"`
+	Events           []nodeEvent     `json:"events"`
+}
+
+// nodeAddress is an internal or external IP of the node
+type nodeAddress struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+// nodeCondition is a node condition with whether its status is the healthy one
+type nodeCondition struct {
+	Type    string     `json:"type"`
+	Status  string     `json:"status"`
+	Healthy bool       `json:"healthy"`
+	Since   *time.Time `json:"since,omitempty"`
+	Reason  string     `json:"reason,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+// allocation is the allocatable amount of a resource against the sum of the
+// pod requests and limits on the node
+type allocation struct {
+	Resource        string             `json:"resource"`
+	Allocatable     resource.Quantity  `json:"allocatable"`
+	Requests        resource.Quantity  `json:"requests"`
+	RequestsPercent int                `json:"requestsPercent"`
+	Limits          *resource.Quantity `json:"limits,omitempty"`
+	LimitsPercent   *int               `json:"limitsPercent,omitempty"`
+}
+
+// nodePod is a non-terminated pod on the node with its effective requests and limits
+type nodePod struct {
+	Namespace string              `json:"namespace"`
+	Name      string              `json:"name"`
+	Requests  corev1.ResourceList `json:"requests"`
+	Limits    corev1.ResourceList `json:"limits"`
+	Created   time.Time           `json:"created"`
+}
+
+// nodeEvent is an event reported for the node
+type nodeEvent struct {
+	Type     string    `json:"type"`
+	Reason   string    `json:"reason"`
+	Message  string    `json:"message"`
+	Count    int32     `json:"count"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// runDescribeNode prints the node view
+func runDescribeNode(cmd *cobra.Command, args []string) error {
+	if err := validateOutput(); err != nil {
+		return err
+	}
+	name := args[0]
+	client, err := k8s.NewClient("", describeKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	node, err := client.Clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return clierr.Newf(clierr.NotFound, "node %s not found", name)
+		}
+		return fmt.Errorf("failed to get node %s: %w", name, err)
+	}
+
+	// Terminated pods no longer hold resources on the node
+	selector := fields.AndSelectors(
+		fields.OneTermEqualSelector("spec.nodeName", name),
+		fields.OneTermNotEqualSelector("status.phase", string(corev1.PodSucceeded)),
+		fields.OneTermNotEqualSelector("status.phase", string(corev1.PodFailed)),
+	)
+	pods, err := client.Clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{FieldSelector: selector.String()})
+	if err != nil {
+		return fmt.Errorf("failed to list pods on node %s: %w", name, err)
+	}
+
+	// The node view is still useful without events, e.g. when they may not be listed
+	eventSelector := fields.AndSelectors(
+		fields.OneTermEqualSelector("involvedObject.kind", "Node"),
+		fields.OneTermEqualSelector("involvedObject.name", name),
+	)
+	var events []corev1.Event
+	if list, err := client.Clientset.CoreV1().Events("").List(ctx, metav1.ListOptions{FieldSelector: eventSelector.String()}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to list events of node %s: %v\n", name, err)
+	} else {
+		events = list.Items
+	}
+
+	d := describeNode(node, pods.Items, events)
+	if describeOutput != "text" {
+		return printStructured(d)
+	}
+
+	now := time.Now()
+	printNodeSummary(d, now)
+	printConditions(d, now)
+	printTaints(d)
+	printAllocations(d)
+	printNodePods(d, now)
+	printNodeEvents(d, now)
+	return nil
+}
+
+// validateOutput checks -o
+func validateOutput() error {
+	switch describeOutput {
+	case "text", "json", "yaml":
+		return nil
+	}
+	return clierr.Usagef("unsupported output format %q (use text, json or yaml)", describeOutput)
+}
+
+// printStructured prints a description as indented JSON or YAML
+func printStructured(v interface{}) error {
+	if describeOutput == "yaml" {
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// describeNode builds the node view from the node, its non-terminated pods
+// and its events
+func describeNode(node *corev1.Node, pods []corev1.Pod, events []corev1.Event) *nodeDescription {
+	d := &nodeDescription{
+		Name:             node.Name,
+		Status:           nodeStatus(node),
+		Roles:            []string{},
+		Created:          node.CreationTimestamp.Time.UTC(),
+		KubeletVersion:   node.Status.NodeInfo.KubeletVersion,
+		OSImage:          node.Status.NodeInfo.OSImage,
+		ContainerRuntime: node.Status.NodeInfo.ContainerRuntimeVersion,
+		Unschedulable:    node.Spec.Unschedulable,
+		Conditions:       []nodeCondition{},
+		Taints:           []string{},
+		Allocations:      []allocation{},
+		Pods:             []nodePod{},
+		Events:           []nodeEvent{},
+	}
+	for label := range node.Labels {
+		if role, ok := strings.CutPrefix(label, "node-role.kubernetes.io/"); ok && role != "" {
+			d.Roles = append(d.Roles, role)
+		}
+	}
+	sort.Strings(d.Roles)
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeInternalIP || addr.Type == corev1.NodeExternalIP {
+			d.Addresses = append(d.Addresses, nodeAddress{Type: string(addr.Type), Address: addr.Address})
+		}
+	}
+
+	// Ready should be True, all pressure and unavailability conditions False
+	for _, cond := range node.Status.Conditions {
+		healthy := cond.Status == corev1.ConditionFalse
+		if cond.Type == corev1.NodeReady {
+			healthy = cond.Status == corev1.ConditionTrue
+		}
+		c := nodeCondition{
+			Type:    string(cond.Type),
+			Status:  string(cond.Status),
+			Healthy: healthy,
+			Reason:  cond.Reason,
+			Message: cond.Message,
+		}
+		if !cond.LastTransitionTime.IsZero() {
+			since := cond.LastTransitionTime.Time.UTC()
+			c.Since = &since
+		}
+		d.Conditions = append(d.Conditions, c)
+	}
+
+	for _, taint := range node.Spec.Taints {
+		d.Taints = append(d.Taints, taint.ToString())
+	}
+
+	requests := corev1.ResourceList{}
+	limits := corev1.ResourceList{}
+	for i := range pods {
+		res := effectiveResources(&pods[i])
+		scheduling.AddResources(requests, res.requests)
+		scheduling.AddResources(limits, res.limits)
+	}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage} {
+		allocatable, ok := node.Status.Allocatable[name]
+		if !ok {
+			continue
+		}
+		req, lim := requests[name], limits[name]
+		limitsPercent := percent(lim, allocatable)
+		d.Allocations = append(d.Allocations, allocation{
+			Resource:        string(name),
+			Allocatable:     allocatable,
+			Requests:        req,
+			RequestsPercent: percent(req, allocatable),
+			Limits:          &lim,
+			LimitsPercent:   &limitsPercent,
+		})
+	}
+	if allocatable, ok := node.Status.Allocatable[corev1.ResourcePods]; ok {
+		count := *resource.NewQuantity(int64(len(pods)), resource.DecimalSI)
+		d.Allocations = append(d.Allocations, allocation{
+			Resource:        string(corev1.ResourcePods),
+			Allocatable:     allocatable,
+			Requests:        count,
+			RequestsPercent: percent(count, allocatable),
+		})
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		res := effectiveResources(pod)
+		d.Pods = append(d.Pods, nodePod{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			Requests:  res.requests,
+			Limits:    res.limits,
+			Created:   pod.CreationTimestamp.Time.UTC(),
+		})
+	}
+	sort.Slice(d.Pods, func(i, j int) bool {
+		if d.Pods[i].Namespace != d.Pods[j].Namespace {
+			return d.Pods[i].Namespace < d.Pods[j].Namespace
+		}
+		return d.Pods[i].Name < d.Pods[j].Name
+	})
+
+	for i := range events {
+		d.Events = append(d.Events, toNodeEvent(&events[i]))
+	}
+	sort.SliceStable(d.Events, func(i, j int) bool {
+		return d.Events[i].LastSeen.Before(d.Events[j].LastSeen)
+	})
+	return d
+}
+
+// nodeStatus returns the status kubectl shows for a node
+func nodeStatus(node *corev1.Node) string {
+	status := "Unknown"
+	for _, cond := range node.Status.Conditions {
+		if cond.Type != corev1.NodeReady {
+			continue
+		}
+		switch cond.Status {
+		case corev1.ConditionTrue:
+			status = "Ready"
+		case corev1.ConditionFalse:
+			status = "NotReady"
+		}
+	}
+	if node.Spec.Unschedulable {
+		status += ",SchedulingDisabled"
+	}
+	return status
+}
+
+// toNodeEvent converts an event, taking the last time it was seen and its
+// count from whichever of the legacy and series fields the reporter filled in
+func toNodeEvent(e *corev1.Event) nodeEvent {
+	event := nodeEvent{
+		Type:     e.Type,
+		Reason:   e.Reason,
+		Message:  strings.TrimSpace(strings.ReplaceAll(e.Message, "\n", " ")),
+		Count:    e.Count,
+		LastSeen: e.LastTimestamp.Time,
+	}
+	if e.Series != nil {
+		event.Count = e.Series.Count
+		if event.LastSeen.IsZero() {
+			event.LastSeen = e.Series.LastObservedTime.Time
+		}
+	}
+	if event.LastSeen.IsZero() {
+		event.LastSeen = e.EventTime.Time
+	}
+	if event.LastSeen.IsZero() {
+		event.LastSeen = e.CreationTimestamp.Time
+	}
+	event.LastSeen = event.LastSeen.UTC()
+	if event.Count < 1 {
+		event.Count = 1
+	}
+	return event
+}
+
+// printNodeSummary prints the identity of the node
+func printNodeSummary(d *nodeDescription, now time.Time) {
+	const (
+		reset  = "\033[0m"
+		red    = "\033[31m"
+		green  = "\033[32m"
+		yellow = "\033[33m"
+	)
+	roles := d.Roles
+	if len(roles) == 0 {
+		roles = []string{"<none>"}
+	}
+	var addresses []string
+	for _, addr := range d.Addresses {
+		addresses = append(addresses, fmt.Sprintf("%s (%s)", addr.Address, addr.Type))
+	}
+	status := red + d.Status + reset
+	if strings.HasPrefix(d.Status, "Ready") {
+		status = green + d.Status + reset
+	}
+
+	fmt.Printf("Node:          %s\n", d.Name)
+	fmt.Printf("Status:        %s\n", status)
+	fmt.Printf("Roles:         %s\n", strings.Join(roles, ","))
+	fmt.Printf("Age:           %s\n", utils.FormatAge(now.Sub(d.Created)))
+	fmt.Printf("Version:       %s, %s\n", d.KubeletVersion, d.OSImage)
+	fmt.Printf("Runtime:       %s\n", d.ContainerRuntime)
+	if len(addresses) > 0 {
+		fmt.Printf("Addresses:     %s\n", strings.Join(addresses, ", "))
+	}
+	if d.Unschedulable {
+		fmt.Printf("Schedulable:   %sno (cordoned)%s\n", yellow, reset)
+	}
+	fmt.Println()
+}
+
+// printConditions prints the node conditions with unhealthy ones in red
+func printConditions(d *nodeDescription, now time.Time) {
+	const (
+		reset = "\033[0m"
+		red   = "\033[31m"
+		green = "\033[32m"
+	)
+	headers := []string{"CONDITION", "STATUS", "SINCE", "REASON", "MESSAGE"}
+	rows := make([][]string, 0, len(d.Conditions))
+	for _, cond := range d.Conditions {
+		status := green + cond.Status + reset
+		if !cond.Healthy {
+			status = red + cond.Status + reset
+		}
+		since := "-"
+		if cond.Since != nil {
+			since = utils.FormatAge(now.Sub(*cond.Since))
+		}
+		rows = append(rows, []string{
+			cond.Type,
+			status,
+			since,
+			cond.Reason,
+			utils.TruncateString(cond.Message, maxConditionMessage),
+		})
+	}
+	fmt.Println("Conditions:")
+	table.Render(headers, rows)
+	fmt.Println()
+}
+
+// printTaints prints the node taints, one per line
+func printTaints(d *nodeDescription) {
+	if len(d.Taints) == 0 {
+		fmt.Println("Taints:        <none>")
+		fmt.Println()
+		return
+	}
+	fmt.Println("Taints:")
+	for _, taint := range d.Taints {
+		fmt.Printf("  %s\n", taint)
+	}
+	fmt.Println()
+}
+
+// printAllocations prints allocatable resources against the sum of pod
+// requests and limits
+func printAllocations(d *nodeDescription) {
+	headers := []string{"RESOURCE", "ALLOCATABLE", "REQUESTS", "", "LIMITS"}
+	var rows [][]string
+	for _, a := range d.Allocations {
+		name := corev1.ResourceName(a.Resource)
+		if name == corev1.ResourcePods {
+			rows = append(rows, []string{
+				a.Resource,
+				a.Allocatable.String(),
+				fmt.Sprintf("%s (%d%%)", a.Requests.String(), a.RequestsPercent),
+				bar(a.RequestsPercent),
+				"-",
+			})
+			continue
+		}
+		rows = append(rows, []string{
+			a.Resource,
+			formatQuantity(name, a.Allocatable),
+			fmt.Sprintf("%s (%d%%)", formatQuantity(name, a.Requests), a.RequestsPercent),
+			bar(a.RequestsPercent),
+			fmt.Sprintf("%s (%d%%)", formatQuantity(name, *a.Limits), *a.LimitsPercent),
+		})
+	}
+	fmt.Println("Allocated resources:")
+	table.Render(headers, rows)
+	fmt.Println()
+}
+
+// printNodePods prints the non-terminated pods with their requests and limits
+func printNodePods(d *nodeDescription, now time.Time) {
+	headers := []string{"NAMESPACE", "NAME", "CPU REQ", "CPU LIM", "MEM REQ", "MEM LIM", "AGE"}
+	rows := make([][]string, 0, len(d.Pods))
+	for _, pod := range d.Pods {
+		rows = append(rows, []string{
+			pod.Namespace,
+			pod.Name,
+			formatResource(pod.Requests, corev1.ResourceCPU),
+			formatResource(pod.Limits, corev1.ResourceCPU),
+			formatResource(pod.Requests, corev1.ResourceMemory),
+			formatResource(pod.Limits, corev1.ResourceMemory),
+			utils.FormatAge(now.Sub(pod.Created)),
+		})
+	}
+	fmt.Printf("Pods (%d non-terminated):\n", len(d.Pods))
+	table.Render(headers, rows)
+}
+
+// printNodeEvents prints the events of the node, latest last
+func printNodeEvents(d *nodeDescription, now time.Time) {
+	const (
+		reset  = "\033[0m"
+		yellow = "\033[33m"
+	)
+	fmt.Println()
+	if len(d.Events) == 0 {
+		fmt.Println("Events:        <none>")
+		return
+	}
+	headers := []string{"LAST SEEN", "TYPE", "REASON", "COUNT", "MESSAGE"}
+	rows := make([][]string, 0, len(d.Events))
+	for _, e := range d.Events {
+		eventType := e.Type
+		if eventType == corev1.EventTypeWarning {
+			eventType = yellow + eventType + reset
+		}
+		rows = append(rows, []string{
+			utils.FormatAge(now.Sub(e.LastSeen)),
+			eventType,
+			e.Reason,
+			fmt.Sprintf("%d", e.Count),
+			utils.TruncateString(e.Message, maxConditionMessage),
+		})
+	}
+	fmt.Println("Events:")
+	table.Render(headers, rows)
+}
+
+// effectiveResources returns the requests and limits the scheduler accounts
+// for the pod
+func effectiveResources(pod *corev1.Pod) podResources {
+	return podResources{requests: scheduling.PodRequests(pod), limits: scheduling.PodLimits(pod)}
+}
+
+// percent returns used as a percentage of total
+func percent(used, total resource.Quantity) int {
+	if total.IsZero() {
+		return 0
+	}
+	return int(used.MilliValue() * 100 / total.MilliValue())
+}
+
+// bar draws a usage bar, yellow from 75% and red from 90%
+func bar(pct int) string {
+	const (
+		reset  = "\033[0m"
+		red    = "\033[31m"
+		green  = "\033[32m"
+		yellow = "\033[33m"
+	)
+	filled := pct * barWidth / 100
+	if filled > barWidth {
+		filled = barWidth
+	}
+	color := green
+	switch {
+	case pct >= 90:
+		color = red
+	case pct >= 75:
+		color = yellow
+	}
+	return "[" + color + strings.Repeat("#", filled) + reset + strings.Repeat(".", barWidth-filled) + "]"
+}
+
+// formatResource formats one resource of a list, or - when unset
+func formatResource(list corev1.ResourceList, name corev1.ResourceName) string {
+	q, ok := list[name]
+	if !ok || q.IsZero() {
+		return "-"
+	}
+	return formatQuantity(name, q)
+}
+
+// formatQuantity formats CPU as cores/millicores and memory and storage as
+// bytes. Fractional cores stay in millicores, 1500m is not 1 core.
+func formatQuantity(name corev1.ResourceName, q resource.Quantity) string {
+	switch name {
+	case corev1.ResourceCPU:
+		if m := q.MilliValue(); m%1000 != 0 {
+			return fmt.Sprintf("%dm", m)
+		}
+		return fmt.Sprintf("%d", q.MilliValue()/1000)
+	case corev1.ResourceMemory, corev1.ResourceEphemeralStorage:
+		return utils.FormatBytes(q.Value())
+	}
+	return q.String()
+}
+
+// init initializes flags for kube-describe command
+func init() {
+	describeRootCmd.PersistentFlags().StringVarP(&describeKubeContext, "context", "c", "", "Kubernetes context to use")
+	describeRootCmd.PersistentFlags().StringVarP(&describeOutput, "output", "o", "text", "Output format: text, json, yaml")
+	describeRootCmd.AddCommand(describeNodeCmd)
+
+	viper.BindPFlag("context", describeRootCmd.PersistentFlags().Lookup("context"))
+}
+
+// main is the entry point of kube-describe
+func main() {
+	k8s.AddVerbosityFlag(describeRootCmd)
+	k8s.AddRateLimitFlags(describeRootCmd)
+	k8s.AddFromDirFlag(describeRootCmd)
+	config.SetupDefaults(describeRootCmd)
+	clierr.SetupUsage(describeRootCmd)
+	cmd, err := describeRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
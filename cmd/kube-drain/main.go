@@ -0,0 +1,675 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/scheduling"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	drainKubeContext string
+)
+
+const (
+	// defaultGracePeriod is the terminationGracePeriodSeconds the API server defaults to
+	defaultGracePeriod = 30 * time.Second
+	// defaultStartup is assumed for pods whose time to become ready is not known
+	defaultStartup = 30 * time.Second
+	// maxStartup caps the startup time read from a pod, a Ready condition
+	// that flapped long after the start says nothing about the startup
+	maxStartup = 10 * time.Minute
+)
+
+// Checklist states of the summary
+const (
+	checkOK = iota
+	checkWarning
+	checkFailed
+)
+
+// drainRootCmd represents the kube-drain command
+var drainRootCmd = &cobra.Command{
+	Use:   "kube-drain",
+	Short: "Plan node drains before touching anything",
+	Long: `kube-drain helps taking a node out of service (reboot, upgrade, replacement)
+without surprises.
+
+Examples:
+  kube-drain plan worker-3        # What a drain of worker-3 would do, and where it gets stuck`,
+}
+
+// planDrainCmd represents the kube-drain plan subcommand
+var planDrainCmd = &cobra.Command{
+	Use:   "plan <node>",
+	Short: "Simulate the drain of a node",
+	Long: `plan simulates 'kubectl drain <node> --ignore-daemonsets' without cordoning or
+evicting anything:
+
+- the pods that would be evicted, and those that stay: DaemonSet pods and
+  static pods. Pods without a controller are deleted for good and pods with
+  emptyDir volumes lose that data; kubectl drain refuses both without
+  --force and --delete-emptydir-data.
+- the PodDisruptionBudgets covering the evicted pods: how many disruptions
+  they allow right now, and whether they let the drain through at once, one
+  batch at a time, or never (minAvailable equal to the replicas,
+  maxUnavailable 0).
+- where the replacements could be scheduled: the other ready, uncordoned
+  nodes are checked for nodeSelector, required node affinity, taints and
+  free allocatable resources against the pod requests, placing the biggest
+  pods first. Pod (anti-)affinity and topology spread are not simulated,
+  and neither are nodes a cluster autoscaler would add.
+- an estimated duration: pods limited by a budget are evicted in batches,
+  each waiting until the replacements are ready (as long as the evicted
+  pod took to become ready), the last one for its termination grace period.
+
+Exits with an error when the drain would not finish: a budget that never
+allows a disruption, or pods that fit on no other node.`,
+	Example: `  kube-drain plan worker-3
+  kube-drain plan ip-10-0-12-34.eu-west-1.compute.internal -c prod`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPlan,
+}
+
+// plannedPod is a pod on the node and what the drain does with it
+type plannedPod struct {
+	pod      *corev1.Pod
+	owner    string
+	evict    bool
+	notes    []string
+	requests corev1.ResourceList
+	budgets  []*plannedBudget
+	// target is the node the replacement fits on in the simulation, reason
+	// why none does when it is empty
+	target string
+	reason string
+}
+
+// plannedBudget is a PodDisruptionBudget covering evicted pods
+type plannedBudget struct {
+	pdb  *policyv1.PodDisruptionBudget
+	pods []*plannedPod
+}
+
+// candidateNode is a node the evicted pods may move to, with what is left of it
+type candidateNode struct {
+	node *corev1.Node
+	free corev1.ResourceList
+}
+
+// check is one line of the summary
+type check struct {
+	state   int
+	message string
+}
+
+// runPlan prints the drain plan of a node
+func runPlan(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	client, err := k8s.NewClient("", drainKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	node, err := client.Clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return clierr.Newf(clierr.NotFound, "node %s not found", name)
+		}
+		return fmt.Errorf("failed to get node %s: %w", name, err)
+	}
+	nodes, err := client.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	// Terminated pods hold no resources and are not evicted
+	running := fields.AndSelectors(
+		fields.OneTermNotEqualSelector("status.phase", string(corev1.PodSucceeded)),
+		fields.OneTermNotEqualSelector("status.phase", string(corev1.PodFailed)),
+	)
+	allPods, err := client.Clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{FieldSelector: running.String()})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	var planned []*plannedPod
+	podsByNode := map[string][]*corev1.Pod{}
+	for i := range allPods.Items {
+		pod := &allPods.Items[i]
+		if pod.Spec.NodeName == name {
+			planned = append(planned, planPod(pod))
+		} else if pod.Spec.NodeName != "" {
+			podsByNode[pod.Spec.NodeName] = append(podsByNode[pod.Spec.NodeName], pod)
+		}
+	}
+	sort.Slice(planned, func(i, j int) bool {
+		if planned[i].pod.Namespace != planned[j].pod.Namespace {
+			return planned[i].pod.Namespace < planned[j].pod.Namespace
+		}
+		return planned[i].pod.Name < planned[j].pod.Name
+	})
+
+	budgets, err := planBudgets(ctx, client, planned)
+	if err != nil {
+		return err
+	}
+	candidates := candidateNodes(nodes.Items, name, podsByNode)
+	placePods(planned, candidates)
+
+	now := time.Now()
+	printNodeSummary(node, planned)
+	printEvictions(planned)
+	printBudgets(budgets)
+	estimate, blocked := estimateDuration(planned, budgets)
+	if blocked {
+		fmt.Println("Estimated duration: none, the drain does not finish (see below)")
+	} else {
+		fmt.Printf("Estimated duration: ~%s\n", estimate.Round(time.Second))
+	}
+	fmt.Println()
+
+	checks := summarize(planned, budgets, now)
+	failed := 0
+	for _, c := range checks {
+		printCheck(c)
+		if c.state == checkFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return clierr.Newf(clierr.Generic, "the drain of %s would not finish: %d blocker(s)", name, failed)
+	}
+	return nil
+}
+
+// planPod decides what the drain does with a pod, like kubectl drain with
+// --ignore-daemonsets
+func planPod(pod *corev1.Pod) *plannedPod {
+	p := &plannedPod{pod: pod, evict: true, requests: podRequests(pod)}
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		p.owner = strings.ToLower(owner.Kind) + "/" + owner.Name
+	}
+	switch {
+	case pod.Annotations[corev1.MirrorPodAnnotationKey] != "":
+		p.evict = false
+		p.notes = append(p.notes, "static pod, stays with the kubelet")
+		return p
+	case strings.HasPrefix(p.owner, "daemonset/"):
+		p.evict = false
+		p.notes = append(p.notes, "DaemonSet pod, stays")
+		return p
+	case pod.DeletionTimestamp != nil:
+		p.evict = false
+		p.notes = append(p.notes, "already terminating")
+		return p
+	case p.owner == "":
+		p.notes = append(p.notes, "no controller, deleted for good")
+	}
+	for _, v := range pod.Spec.Volumes {
+		if v.EmptyDir != nil {
+			p.notes = append(p.notes, "emptyDir data is lost")
+			break
+		}
+	}
+	return p
+}
+
+// planBudgets returns the PodDisruptionBudgets covering the evicted pods
+func planBudgets(ctx context.Context, client *k8s.Client, planned []*plannedPod) ([]*plannedBudget, error) {
+	var budgets []*plannedBudget
+	seen := map[string]bool{}
+	for _, p := range planned {
+		if !p.evict || seen[p.pod.Namespace] {
+			continue
+		}
+		seen[p.pod.Namespace] = true
+		list, err := client.Clientset.PolicyV1().PodDisruptionBudgets(p.pod.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list poddisruptionbudgets: %w", err)
+		}
+		for i := range list.Items {
+			pdb := &list.Items[i]
+			selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+			if err != nil || selector.Empty() {
+				continue
+			}
+			budget := &plannedBudget{pdb: pdb}
+			for _, q := range planned {
+				if q.evict && q.pod.Namespace == pdb.Namespace && selector.Matches(labels.Set(q.pod.Labels)) {
+					budget.pods = append(budget.pods, q)
+					q.budgets = append(q.budgets, budget)
+				}
+			}
+			if len(budget.pods) > 0 {
+				budgets = append(budgets, budget)
+			}
+		}
+	}
+	return budgets, nil
+}
+
+// neverAllows reports whether the budget allows no disruption even with all
+// its pods healthy, e.g. minAvailable equal to the replicas
+func (b *plannedBudget) neverAllows() bool {
+	return b.pdb.Status.ExpectedPods > 0 && b.pdb.Status.DesiredHealthy >= b.pdb.Status.ExpectedPods
+}
+
+// candidateNodes returns the ready, uncordoned nodes other than the drained
+// one with their allocatable resources minus the requests of their pods
+func candidateNodes(nodes []corev1.Node, drained string, podsByNode map[string][]*corev1.Pod) []*candidateNode {
+	var candidates []*candidateNode
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Name == drained || node.Spec.Unschedulable || !isReady(node) {
+			continue
+		}
+		free := node.Status.Allocatable.DeepCopy()
+		for _, pod := range podsByNode[node.Name] {
+			subtractResources(free, podRequests(pod))
+		}
+		candidates = append(candidates, &candidateNode{node: node, free: free})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].node.Name < candidates[j].node.Name })
+	return candidates
+}
+
+// placePods simulates where the replacements of the evicted pods go,
+// biggest requests first, each on the matching node with the most free CPU
+func placePods(planned []*plannedPod, candidates []*candidateNode) {
+	var pods []*plannedPod
+	for _, p := range planned {
+		// Pods without a controller are not recreated
+		if p.evict && p.owner != "" {
+			pods = append(pods, p)
+		}
+	}
+	sort.SliceStable(pods, func(i, j int) bool {
+		ci, cj := pods[i].requests[corev1.ResourceCPU], pods[j].requests[corev1.ResourceCPU]
+		if c := ci.Cmp(cj); c != 0 {
+			return c > 0
+		}
+		mi, mj := pods[i].requests[corev1.ResourceMemory], pods[j].requests[corev1.ResourceMemory]
+		return mi.Cmp(mj) > 0
+	})
+
+	for _, p := range pods {
+		var best *candidateNode
+		matching := 0
+		short := map[corev1.ResourceName]bool{}
+		for _, c := range candidates {
+			if !scheduling.MatchesNode(p.pod, c.node) {
+				continue
+			}
+			matching++
+			if missing := missingResources(c.free, p.requests); len(missing) > 0 {
+				for _, name := range missing {
+					short[name] = true
+				}
+				continue
+			}
+			if best == nil {
+				best = c
+				continue
+			}
+			free, bestFree := c.free[corev1.ResourceCPU], best.free[corev1.ResourceCPU]
+			if free.Cmp(bestFree) > 0 {
+				best = c
+			}
+		}
+		switch {
+		case best != nil:
+			p.target = best.node.Name
+			subtractResources(best.free, p.requests)
+		case matching == 0:
+			p.reason = "no other node matches its selector, affinity and taints"
+		default:
+			names := make([]string, 0, len(short))
+			for name := range short {
+				names = append(names, string(name))
+			}
+			sort.Strings(names)
+			p.reason = fmt.Sprintf("not enough %s on the %d matching node(s)", strings.Join(names, ", "), matching)
+		}
+	}
+}
+
+// estimateDuration estimates how long the evictions take. Pods without a
+// budget go at once and take their grace period. Pods of a budget go in
+// batches of the allowed disruptions, each waiting until the replacements
+// are ready. blocked is set when a budget allows no disruption.
+func estimateDuration(planned []*plannedPod, budgets []*plannedBudget) (time.Duration, bool) {
+	var estimate time.Duration
+	for _, p := range planned {
+		if p.evict && len(p.budgets) == 0 {
+			estimate = max(estimate, gracePeriod(p.pod))
+		}
+	}
+	for _, b := range budgets {
+		allowed := int(b.pdb.Status.DisruptionsAllowed)
+		if allowed <= 0 {
+			return 0, true
+		}
+		var startup, grace time.Duration
+		for _, p := range b.pods {
+			startup = max(startup, startupTime(p.pod))
+			grace = max(grace, gracePeriod(p.pod))
+		}
+		batches := (len(b.pods) + allowed - 1) / allowed
+		estimate = max(estimate, time.Duration(batches-1)*startup+grace)
+	}
+	return estimate, false
+}
+
+// summarize lists what stands in the way of the drain
+func summarize(planned []*plannedPod, budgets []*plannedBudget, now time.Time) []check {
+	var checks []check
+	var unplaced, bare, emptyDir, evicted int
+	for _, p := range planned {
+		if !p.evict {
+			continue
+		}
+		evicted++
+		if p.owner == "" {
+			bare++
+		} else if p.target == "" {
+			unplaced++
+		}
+		for _, note := range p.notes {
+			if note == "emptyDir data is lost" {
+				emptyDir++
+			}
+		}
+	}
+
+	if unplaced > 0 {
+		checks = append(checks, check{checkFailed, fmt.Sprintf("%d pod(s) fit on no other node, their replacements would stay Pending", unplaced)})
+	} else if evicted > 0 {
+		checks = append(checks, check{checkOK, "every evicted pod fits on another node"})
+	}
+	blocking := 0
+	for _, b := range budgets {
+		name := b.pdb.Namespace + "/" + b.pdb.Name
+		switch {
+		case b.neverAllows():
+			blocking++
+			checks = append(checks, check{checkFailed, fmt.Sprintf("PodDisruptionBudget %s allows no disruption even with all pods healthy", name)})
+		case b.pdb.Status.DisruptionsAllowed == 0:
+			blocking++
+			checks = append(checks, check{checkFailed, fmt.Sprintf("PodDisruptionBudget %s allows no disruption now: %d of %d pods healthy, %d needed",
+				name, b.pdb.Status.CurrentHealthy, b.pdb.Status.ExpectedPods, b.pdb.Status.DesiredHealthy)})
+		case int(b.pdb.Status.DisruptionsAllowed) < len(b.pods):
+			checks = append(checks, check{checkWarning, fmt.Sprintf("PodDisruptionBudget %s allows %d of the %d pod(s) at a time, the drain waits for replacements",
+				name, b.pdb.Status.DisruptionsAllowed, len(b.pods))})
+		}
+	}
+	if blocking == 0 && len(budgets) > 0 {
+		checks = append(checks, check{checkOK, fmt.Sprintf("%d PodDisruptionBudget(s) let the drain through", len(budgets))})
+	}
+	if bare > 0 {
+		checks = append(checks, check{checkWarning, fmt.Sprintf("%d pod(s) without a controller are deleted for good (kubectl drain needs --force)", bare)})
+	}
+	if emptyDir > 0 {
+		checks = append(checks, check{checkWarning, fmt.Sprintf("%d pod(s) lose their emptyDir data (kubectl drain needs --delete-emptydir-data)", emptyDir)})
+	}
+	if evicted == 0 {
+		checks = append(checks, check{checkOK, "nothing to evict"})
+	}
+	return checks
+}
+
+// printNodeSummary prints the node and what happens to its pods
+func printNodeSummary(node *corev1.Node, planned []*plannedPod) {
+	const (
+		reset  = "\033[0m"
+		yellow = "\033[33m"
+	)
+	state := "Ready"
+	if !isReady(node) {
+		state = "NotReady"
+	}
+	if node.Spec.Unschedulable {
+		state += ", " + yellow + "cordoned" + reset
+	}
+	var evict, stay int
+	for _, p := range planned {
+		if p.evict {
+			evict++
+		} else {
+			stay++
+		}
+	}
+	fmt.Printf("Node:          %s (%s)\n", node.Name, state)
+	fmt.Printf("Pods:          %d to evict, %d stay\n", evict, stay)
+	fmt.Println()
+}
+
+// printEvictions prints every pod of the node with what happens to it
+func printEvictions(planned []*plannedPod) {
+	const (
+		reset = "\033[0m"
+		red   = "\033[31m"
+		gray  = "\033[90m"
+	)
+	if len(planned) == 0 {
+		return
+	}
+	headers := []string{"NAMESPACE", "POD", "OWNER", "CPU", "MEMORY", "BUDGET", "RESCHEDULE", "NOTES"}
+	rows := make([][]string, 0, len(planned))
+	for _, p := range planned {
+		var budgets []string
+		for _, b := range p.budgets {
+			budgets = append(budgets, b.pdb.Name)
+		}
+		reschedule := p.target
+		switch {
+		case !p.evict:
+			reschedule = gray + "stays" + reset
+		case p.owner == "":
+			reschedule = gray + "not recreated" + reset
+		case p.target == "":
+			reschedule = red + "nowhere: " + p.reason + reset
+		}
+		rows = append(rows, []string{
+			p.pod.Namespace,
+			p.pod.Name,
+			utils.OrDash(p.owner),
+			formatQuantity(corev1.ResourceCPU, p.requests),
+			formatQuantity(corev1.ResourceMemory, p.requests),
+			utils.OrDash(strings.Join(budgets, ", ")),
+			reschedule,
+			strings.Join(p.notes, ", "),
+		})
+	}
+	fmt.Println("Pods:")
+	table.Render(headers, rows)
+	fmt.Println()
+}
+
+// printBudgets prints the PodDisruptionBudgets covering the evicted pods
+func printBudgets(budgets []*plannedBudget) {
+	const (
+		reset  = "\033[0m"
+		red    = "\033[31m"
+		yellow = "\033[33m"
+	)
+	if len(budgets) == 0 {
+		fmt.Println("Disruption budgets: none cover the evicted pods")
+		fmt.Println()
+		return
+	}
+	headers := []string{"NAMESPACE", "BUDGET", "PODS-HERE", "ALLOWED", "HEALTHY", "DRAIN"}
+	rows := make([][]string, 0, len(budgets))
+	for _, b := range budgets {
+		allowed := int(b.pdb.Status.DisruptionsAllowed)
+		verdict := "all at once"
+		switch {
+		case b.neverAllows():
+			verdict = red + "blocked for good" + reset
+		case allowed == 0:
+			verdict = red + "blocked until pods are healthy" + reset
+		case allowed < len(b.pods):
+			verdict = yellow + fmt.Sprintf("%d batches", (len(b.pods)+allowed-1)/allowed) + reset
+		}
+		rows = append(rows, []string{
+			b.pdb.Namespace,
+			b.pdb.Name,
+			fmt.Sprintf("%d", len(b.pods)),
+			fmt.Sprintf("%d", allowed),
+			fmt.Sprintf("%d/%d (%d needed)", b.pdb.Status.CurrentHealthy, b.pdb.Status.ExpectedPods, b.pdb.Status.DesiredHealthy),
+			verdict,
+		})
+	}
+	fmt.Println("Disruption budgets:")
+	table.Render(headers, rows)
+	fmt.Println()
+}
+
+// printCheck prints one summary line with its mark
+func printCheck(c check) {
+	const (
+		reset  = "\033[0m"
+		red    = "\033[31m"
+		green  = "\033[32m"
+		yellow = "\033[33m"
+	)
+	mark := green + "✓" + reset
+	switch c.state {
+	case checkWarning:
+		mark = yellow + "!" + reset
+	case checkFailed:
+		mark = red + "✗" + reset
+	}
+	fmt.Printf("%s %s\n", mark, c.message)
+}
+
+// isReady reports whether the Ready condition of the node is True
+func isReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// gracePeriod returns how long the pod may take to shut down
+func gracePeriod(pod *corev1.Pod) time.Duration {
+	if pod.Spec.TerminationGracePeriodSeconds == nil {
+		return defaultGracePeriod
+	}
+	return time.Duration(*pod.Spec.TerminationGracePeriodSeconds) * time.Second
+}
+
+// startupTime returns how long the pod took from creation to ready, which
+// its replacement will take about as well
+func startupTime(pod *corev1.Pod) time.Duration {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type != corev1.PodReady || cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		if startup := cond.LastTransitionTime.Sub(pod.CreationTimestamp.Time); startup > 0 && startup <= maxStartup {
+			return startup
+		}
+	}
+	return defaultStartup
+}
+
+// podRequests returns what the scheduler accounts for a pod, including the
+// pod slot it takes on the node
+func podRequests(pod *corev1.Pod) corev1.ResourceList {
+	requests := scheduling.PodRequests(pod)
+	requests[corev1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+	return requests
+}
+
+// subtractResources subtracts src from dst
+func subtractResources(dst, src corev1.ResourceList) {
+	for name, q := range src {
+		if left, ok := dst[name]; ok {
+			left.Sub(q)
+			dst[name] = left
+		}
+	}
+}
+
+// missingResources returns the requested resources free does not have
+// enough of. Resources the node does not offer at all count as missing.
+func missingResources(free, requests corev1.ResourceList) []corev1.ResourceName {
+	var missing []corev1.ResourceName
+	for name, q := range requests {
+		if q.IsZero() {
+			continue
+		}
+		if left, ok := free[name]; !ok || left.Cmp(q) < 0 {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// formatQuantity formats the CPU request in cores or millicores and the
+// memory request in bytes, - when unset
+func formatQuantity(name corev1.ResourceName, list corev1.ResourceList) string {
+	q, ok := list[name]
+	if !ok || q.IsZero() {
+		return "-"
+	}
+	if name == corev1.ResourceCPU {
+		if m := q.MilliValue(); m%1000 != 0 {
+			return fmt.Sprintf("%dm", m)
+		}
+		return fmt.Sprintf("%d", q.MilliValue()/1000)
+	}
+	return utils.FormatBytes(q.Value())
+}
+
+// init initializes flags for kube-drain command
+func init() {
+	drainRootCmd.PersistentFlags().StringVarP(&drainKubeContext, "context", "c", "", "Kubernetes context to use")
+	drainRootCmd.AddCommand(planDrainCmd)
+
+	viper.BindPFlag("context", drainRootCmd.PersistentFlags().Lookup("context"))
+}
+
+// main is the entry point of kube-drain
+func main() {
+	k8s.AddVerbosityFlag(drainRootCmd)
+	k8s.AddRateLimitFlags(drainRootCmd)
+	k8s.AddFromDirFlag(drainRootCmd)
+	config.SetupDefaults(drainRootCmd)
+	clierr.SetupUsage(drainRootCmd)
+	cmd, err := drainRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
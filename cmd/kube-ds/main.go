@@ -0,0 +1,390 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/podstatus"
+	"kube/pkg/kubernetes/scheduling"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	dsNamespace     string
+	dsKubeContext   string
+	dsAllNamespaces bool
+	dsMissingOnly   bool
+)
+
+// dsRootCmd represents the kube-ds command
+var dsRootCmd = &cobra.Command{
+	Use:   "kube-ds",
+	Short: "List DaemonSets and report node coverage",
+	Long: `kube-ds works with DaemonSets:
+
+- List DaemonSets with desired/current/ready/up-to-date/misscheduled counts
+- Show which nodes lack a running pod of a DaemonSet and why (coverage)
+
+Examples:
+  kube-ds                              # List DaemonSets
+  kube-ds -n kube-system               # List DaemonSets in kube-system
+  kube-ds coverage node-exporter       # Pod per node, or why there is none
+  kube-ds coverage fluent-bit --missing # Only nodes without a ready pod`,
+	Args: cobra.NoArgs,
+	RunE: runDs,
+}
+
+// coverageDsCmd represents the kube-ds coverage subcommand
+var coverageDsCmd = &cobra.Command{
+	Use:   "coverage <daemonset>",
+	Short: "Show which nodes run a pod of the DaemonSet and why others do not",
+	Long: `coverage lists every node with the DaemonSet pod running on it. For nodes
+without a pod the reason is derived the same way the DaemonSet controller
+decides placement:
+
+- nodeSelector or required node affinity does not match the node labels
+- the node has a NoSchedule/NoExecute taint the pod does not tolerate
+  (including the tolerations the controller adds to every DaemonSet pod)
+
+Nodes that are eligible but still have no ready pod are reported as MISSING,
+together with hints such as a NotReady or cordoned node. Pods running on nodes
+they should not be on are reported as MISSCHEDULED.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCoverage,
+}
+
+// runDs lists DaemonSets
+func runDs(cmd *cobra.Command, args []string) error {
+	client, ns, err := dsClient()
+	if err != nil {
+		return err
+	}
+	if dsAllNamespaces {
+		ns = ""
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	list, err := client.Clientset.AppsV1().DaemonSets(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+
+	headers := []string{"NAME", "DESIRED", "CURRENT", "READY", "UP-TO-DATE", "AVAILABLE", "MISSCHEDULED", "NODE SELECTOR", "AGE"}
+	if dsAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+
+	rows := make([][]string, 0, len(list.Items))
+	for _, ds := range list.Items {
+		row := []string{
+			ds.Name,
+			fmt.Sprintf("%d", ds.Status.DesiredNumberScheduled),
+			fmt.Sprintf("%d", ds.Status.CurrentNumberScheduled),
+			fmt.Sprintf("%d", ds.Status.NumberReady),
+			fmt.Sprintf("%d", ds.Status.UpdatedNumberScheduled),
+			fmt.Sprintf("%d", ds.Status.NumberAvailable),
+			fmt.Sprintf("%d", ds.Status.NumberMisscheduled),
+			formatSelector(ds.Spec.Template.Spec.NodeSelector),
+			utils.FormatAge(time.Since(ds.CreationTimestamp.Time)),
+		}
+		if dsAllNamespaces {
+			row = append([]string{ds.Namespace}, row...)
+		}
+		rows = append(rows, row)
+	}
+
+	table.Render(headers, rows)
+	return nil
+}
+
+// dsClient creates the client and resolves the target namespace
+func dsClient() (*k8s.Client, string, error) {
+	client, err := k8s.NewClient("", dsKubeContext)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	ns := dsNamespace
+	if ns == "" {
+		if ns, err = k8s.GetCurrentNamespace(dsKubeContext); err != nil {
+			return nil, "", fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	return client, ns, nil
+}
+
+// runCoverage prints one row per node with the DaemonSet pod or the reason it is absent
+func runCoverage(cmd *cobra.Command, args []string) error {
+	client, ns, err := dsClient()
+	if err != nil {
+		return err
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	ds, err := client.Clientset.AppsV1().DaemonSets(ns).Get(ctx, args[0], metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get daemonset %s: %w", args[0], err)
+	}
+
+	nodes, err := client.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	pods, err := client.Clientset.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(ds.Spec.Selector),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	podsByNode := map[string]corev1.Pod{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != "" {
+			podsByNode[pod.Spec.NodeName] = pod
+		}
+	}
+
+	sort.Slice(nodes.Items, func(i, j int) bool { return nodes.Items[i].Name < nodes.Items[j].Name })
+
+	rows := make([][]string, 0, len(nodes.Items))
+	var covered, missing, excluded, misscheduled int
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		pod, hasPod := podsByNode[node.Name]
+		exclusion := excludedReason(ds, node, hasPod)
+
+		var state, podName, status, reason string
+		switch {
+		case hasPod && exclusion != "":
+			state, podName, status, reason = "MISSCHEDULED", pod.Name, podstatus.Reason(&pod), exclusion
+			misscheduled++
+		case hasPod && podstatus.IsReady(&pod):
+			state, podName, status = "OK", pod.Name, podstatus.Reason(&pod)
+			covered++
+		case hasPod:
+			state, podName, status, reason = "NOT READY", pod.Name, podstatus.Reason(&pod), notReadyReason(&pod)
+			missing++
+		case exclusion != "":
+			state, podName, status, reason = "EXCLUDED", "-", "-", exclusion
+			excluded++
+		default:
+			state, podName, status, reason = "MISSING", "-", "-", missingHint(node)
+			missing++
+		}
+
+		if dsMissingOnly && (state == "OK" || state == "EXCLUDED") {
+			continue
+		}
+		rows = append(rows, []string{node.Name, colorState(state), podName, status, reason})
+	}
+
+	fmt.Printf("DaemonSet %s/%s: %d desired, %d ready, %d misscheduled\n\n",
+		ds.Namespace, ds.Name, ds.Status.DesiredNumberScheduled, ds.Status.NumberReady, ds.Status.NumberMisscheduled)
+
+	if len(rows) == 0 {
+		fmt.Println("All eligible nodes run a ready pod")
+	} else {
+		table.Render([]string{"NODE", "STATE", "POD", "STATUS", "REASON"}, rows)
+	}
+
+	fmt.Printf("\nNodes: %d total, %d covered, %d missing, %d excluded, %d misscheduled\n",
+		len(nodes.Items), covered, missing, excluded, misscheduled)
+	return nil
+}
+
+// excludedReason returns why the DaemonSet does not place a pod on the node,
+// or "" when the node is eligible. For a node that already runs the pod
+// (running) only NoExecute taints count, as NoSchedule taints do not evict.
+func excludedReason(ds *appsv1.DaemonSet, node *corev1.Node, running bool) string {
+	spec := ds.Spec.Template.Spec
+
+	for key, value := range spec.NodeSelector {
+		if actual, ok := node.Labels[key]; !ok || actual != value {
+			return fmt.Sprintf("nodeSelector %s=%s not matched", key, value)
+		}
+	}
+
+	if spec.Affinity != nil && spec.Affinity.NodeAffinity != nil {
+		if required := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution; required != nil {
+			if !scheduling.MatchNodeSelector(required, node) {
+				return "required node affinity not matched"
+			}
+		}
+	}
+
+	tolerations := append(daemonSetTolerations(&spec), spec.Tolerations...)
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule || (running && taint.Effect == corev1.TaintEffectNoSchedule) {
+			continue
+		}
+		if !toleratesTaint(tolerations, taint) {
+			return fmt.Sprintf("taint %s not tolerated", formatTaint(taint))
+		}
+	}
+	return ""
+}
+
+// daemonSetTolerations returns the tolerations the DaemonSet controller adds
+// to every pod it creates
+func daemonSetTolerations(spec *corev1.PodSpec) []corev1.Toleration {
+	tolerations := []corev1.Toleration{
+		{Key: "node.kubernetes.io/not-ready", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+		{Key: "node.kubernetes.io/unreachable", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+		{Key: "node.kubernetes.io/disk-pressure", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+		{Key: "node.kubernetes.io/memory-pressure", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+		{Key: "node.kubernetes.io/pid-pressure", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+		{Key: "node.kubernetes.io/unschedulable", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	}
+	if spec.HostNetwork {
+		tolerations = append(tolerations, corev1.Toleration{
+			Key: "node.kubernetes.io/network-unavailable", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule,
+		})
+	}
+	return tolerations
+}
+
+// toleratesTaint reports whether any toleration matches the taint
+func toleratesTaint(tolerations []corev1.Toleration, taint *corev1.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// missingHint explains why an eligible node may still have no pod
+func missingHint(node *corev1.Node) string {
+	var hints []string
+	if !isNodeReady(node) {
+		hints = append(hints, "node NotReady")
+	}
+	if node.Spec.Unschedulable {
+		hints = append(hints, "node cordoned (tolerated by DaemonSet pods)")
+	}
+	if len(hints) == 0 {
+		return "eligible but no pod, check 'kubectl get events' for the daemonset"
+	}
+	return strings.Join(hints, ", ")
+}
+
+// notReadyReason returns the first waiting or terminated container reason of the pod
+func notReadyReason(pod *corev1.Pod) string {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+			return fmt.Sprintf("%s: %s", cs.Name, cs.State.Waiting.Reason)
+		}
+		if cs.State.Terminated != nil && cs.State.Terminated.Reason != "" {
+			return fmt.Sprintf("%s: %s", cs.Name, cs.State.Terminated.Reason)
+		}
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status != corev1.ConditionTrue {
+			return cond.Message
+		}
+	}
+	return "pod not ready"
+}
+
+// isNodeReady reports whether the node Ready condition is true
+func isNodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// formatTaint renders a taint as key=value:Effect
+func formatTaint(taint *corev1.Taint) string {
+	if taint.Value == "" {
+		return fmt.Sprintf("%s:%s", taint.Key, taint.Effect)
+	}
+	return fmt.Sprintf("%s=%s:%s", taint.Key, taint.Value, taint.Effect)
+}
+
+// formatSelector renders a node selector as sorted key=value pairs
+func formatSelector(selector map[string]string) string {
+	if len(selector) == 0 {
+		return "<none>"
+	}
+	pairs := make([]string, 0, len(selector))
+	for k, v := range selector {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// colorState adds ANSI color to a coverage state
+func colorState(state string) string {
+	const (
+		reset  = "\033[0m"
+		green  = "\033[32m"
+		yellow = "\033[33m"
+		red    = "\033[31m"
+		gray   = "\033[90m"
+	)
+	switch state {
+	case "OK":
+		return green + state + reset
+	case "NOT READY":
+		return yellow + state + reset
+	case "MISSING", "MISSCHEDULED":
+		return red + state + reset
+	default:
+		return gray + state + reset
+	}
+}
+
+// init initializes flags and subcommands for kube-ds command
+func init() {
+	dsRootCmd.PersistentFlags().StringVarP(&dsNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	dsRootCmd.PersistentFlags().StringVarP(&dsKubeContext, "context", "c", "", "Kubernetes context to use")
+	dsRootCmd.Flags().BoolVarP(&dsAllNamespaces, "all-namespaces", "A", false, "Show daemonsets from all namespaces")
+
+	coverageDsCmd.Flags().BoolVar(&dsMissingOnly, "missing", false, "Only show nodes without a ready pod or with a misscheduled pod")
+
+	dsRootCmd.AddCommand(coverageDsCmd)
+
+	viper.BindPFlag("namespace", dsRootCmd.PersistentFlags().Lookup("namespace"))
+	viper.BindPFlag("context", dsRootCmd.PersistentFlags().Lookup("context"))
+}
+
+// main is the entry point of kube-ds
+func main() {
+	k8s.AddVerbosityFlag(dsRootCmd)
+	k8s.AddRateLimitFlags(dsRootCmd)
+	k8s.AddFromDirFlag(dsRootCmd)
+	config.SetupDefaults(dsRootCmd)
+	clierr.SetupUsage(dsRootCmd)
+	cmd, err := dsRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
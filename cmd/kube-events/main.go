@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/agefilter"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	eventsNamespace     string
+	eventsKubeContext   string
+	eventsAllNamespaces bool
+	eventsDedupe        bool
+	eventsSince         string
+	eventsTypes         []string
+	eventsReasons       []string
+	eventsTable         table.Options
+)
+
+// maxMessageLength keeps event rows on one line
+const maxMessageLength = 120
+
+// eventGroup is one event, or all events of the same object and reason with --dedupe
+type eventGroup struct {
+	namespace string
+	eventType string
+	reason    string
+	object    string
+	message   string
+	count     int32
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// eventsRootCmd represents the kube-events command
+var eventsRootCmd = &cobra.Command{
+	Use:   "kube-events",
+	Short: "List events, optionally grouped and filtered",
+	Long: `kube-events lists events of the current namespace (or all with -A), oldest first,
+so the latest events end up next to the prompt.
+
+On busy clusters the same event is repeated for every retry. --dedupe groups
+events by object, type and reason, with the total count, first and last seen
+time and the latest message.
+
+Filters:
+  --since      only events seen within this time, e.g. 30m, 2h, 1d
+  --type       only these types: Normal, Warning (case-insensitive)
+  --reason     only these reasons, e.g. BackOff,FailedScheduling
+
+Examples:
+  kube-events                                 # Events of the current namespace
+  kube-events -A --type warning --since 1h    # Recent warnings in the cluster
+  kube-events -A --dedupe                     # One line per object and reason
+  kube-events --reason BackOff,Unhealthy --dedupe`,
+	Args: cobra.NoArgs,
+	RunE: runEvents,
+}
+
+// runEvents lists events according to the filters
+func runEvents(cmd *cobra.Command, args []string) error {
+	if err := eventsTable.Validate(); err != nil {
+		return err
+	}
+
+	var since time.Duration
+	if eventsSince != "" {
+		var err error
+		if since, err = agefilter.ParseAge(eventsSince); err != nil {
+			return clierr.Usagef("invalid --since: %v", err)
+		}
+	}
+	types := map[string]bool{}
+	for _, t := range eventsTypes {
+		switch strings.ToLower(t) {
+		case "normal":
+			types[corev1.EventTypeNormal] = true
+		case "warning":
+			types[corev1.EventTypeWarning] = true
+		default:
+			return clierr.Usagef("unknown --type %q (use Normal or Warning)", t)
+		}
+	}
+	reasons := map[string]bool{}
+	for _, r := range eventsReasons {
+		reasons[strings.ToLower(r)] = true
+	}
+
+	client, err := k8s.NewClient("", eventsKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	namespace := eventsNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(eventsKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	if eventsAllNamespaces {
+		namespace = ""
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	list, err := client.Clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list events: %w", err)
+	}
+
+	now := time.Now()
+	groups := make([]*eventGroup, 0, len(list.Items))
+	byKey := map[string]*eventGroup{}
+	for i := range list.Items {
+		e := toGroup(&list.Items[i])
+		if since > 0 && now.Sub(e.lastSeen) > since {
+			continue
+		}
+		if len(types) > 0 && !types[e.eventType] {
+			continue
+		}
+		if len(reasons) > 0 && !reasons[strings.ToLower(e.reason)] {
+			continue
+		}
+
+		if !eventsDedupe {
+			groups = append(groups, e)
+			continue
+		}
+		key := e.namespace + "/" + e.object + "/" + e.eventType + "/" + e.reason
+		g, ok := byKey[key]
+		if !ok {
+			byKey[key] = e
+			groups = append(groups, e)
+			continue
+		}
+		g.count += e.count
+		if e.firstSeen.Before(g.firstSeen) {
+			g.firstSeen = e.firstSeen
+		}
+		if !e.lastSeen.Before(g.lastSeen) {
+			g.lastSeen = e.lastSeen
+			g.message = e.message
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].lastSeen.Before(groups[j].lastSeen)
+	})
+
+	headers := []string{"LAST SEEN", "TYPE", "REASON", "OBJECT", "MESSAGE"}
+	if eventsDedupe {
+		headers = []string{"LAST SEEN", "FIRST SEEN", "COUNT", "TYPE", "REASON", "OBJECT", "MESSAGE"}
+	}
+	if eventsAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+
+	rows := make([][]string, 0, len(groups))
+	for _, g := range groups {
+		row := []string{utils.FormatAge(now.Sub(g.lastSeen))}
+		if eventsDedupe {
+			row = append(row, utils.FormatAge(now.Sub(g.firstSeen)), fmt.Sprintf("%d", g.count))
+		}
+		row = append(row,
+			colorType(g.eventType),
+			g.reason,
+			g.object,
+			utils.TruncateString(g.message, maxMessageLength),
+		)
+		if eventsAllNamespaces {
+			row = append([]string{g.namespace}, row...)
+		}
+		rows = append(rows, row)
+	}
+
+	// --quiet prints the involved objects
+	nameColumn := len(headers) - 2
+	eventsTable.Print(headers, rows, nameColumn)
+	return nil
+}
+
+// toGroup converts an event, taking the timestamps and count from whichever
+// of the legacy and series fields the reporting component filled in
+func toGroup(e *corev1.Event) *eventGroup {
+	g := &eventGroup{
+		namespace: e.Namespace,
+		eventType: e.Type,
+		reason:    e.Reason,
+		object:    strings.ToLower(e.InvolvedObject.Kind) + "/" + e.InvolvedObject.Name,
+		message:   strings.TrimSpace(strings.ReplaceAll(e.Message, "\n", " ")),
+		count:     e.Count,
+		firstSeen: e.FirstTimestamp.Time,
+		lastSeen:  e.LastTimestamp.Time,
+	}
+	if g.firstSeen.IsZero() {
+		g.firstSeen = e.EventTime.Time
+	}
+	if e.Series != nil {
+		g.count = e.Series.Count
+		if g.lastSeen.IsZero() {
+			g.lastSeen = e.Series.LastObservedTime.Time
+		}
+	}
+	if g.lastSeen.IsZero() {
+		g.lastSeen = e.EventTime.Time
+	}
+	if g.firstSeen.IsZero() {
+		g.firstSeen = e.CreationTimestamp.Time
+	}
+	if g.lastSeen.IsZero() {
+		g.lastSeen = e.CreationTimestamp.Time
+	}
+	if g.count < 1 {
+		g.count = 1
+	}
+	return g
+}
+
+// colorType colors warnings
+func colorType(eventType string) string {
+	const (
+		reset  = "\033[0m"
+		yellow = "\033[33m"
+	)
+	if eventType == corev1.EventTypeWarning {
+		return yellow + eventType + reset
+	}
+	return eventType
+}
+
+// init initializes flags for kube-events command
+func init() {
+	eventsRootCmd.Flags().StringVarP(&eventsNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	eventsRootCmd.Flags().StringVarP(&eventsKubeContext, "context", "c", "", "Kubernetes context to use")
+	eventsRootCmd.Flags().BoolVarP(&eventsAllNamespaces, "all-namespaces", "A", false, "Show events from all namespaces")
+	eventsRootCmd.Flags().BoolVar(&eventsDedupe, "dedupe", false, "Group events by object, type and reason with count and first/last seen")
+	eventsRootCmd.Flags().StringVar(&eventsSince, "since", "", "Only events seen within this time, e.g. 30m, 2h, 1d")
+	eventsRootCmd.Flags().StringSliceVar(&eventsTypes, "type", nil, "Only these event types: Normal, Warning")
+	eventsRootCmd.Flags().StringSliceVar(&eventsReasons, "reason", nil, "Only these reasons, e.g. BackOff,FailedScheduling")
+	eventsTable.AddFlags(eventsRootCmd)
+
+	viper.BindPFlag("namespace", eventsRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", eventsRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-events
+func main() {
+	k8s.AddVerbosityFlag(eventsRootCmd)
+	k8s.AddRateLimitFlags(eventsRootCmd)
+	k8s.AddFromDirFlag(eventsRootCmd)
+	config.SetupDefaults(eventsRootCmd)
+	clierr.SetupUsage(eventsRootCmd)
+	cmd, err := eventsRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
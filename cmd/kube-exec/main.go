@@ -1,18 +1,37 @@
 package main
 
 import (
-	"context"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/target"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/sanitize"
+	"kube/pkg/shared/state"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/term"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
 var (
@@ -21,19 +40,77 @@ var (
 	execContainer   string
 	execTty         bool
 	execStdin       bool
+	execPut         string
+	execGet         string
+	execSelector    string
+	execAll         bool
+	execOutputDir   string
+	execParallel    int
+	execPlain       bool
+	execLog         string
 )
 
 // execRootCmd represents the kube-exec command
 var execRootCmd = &cobra.Command{
-	Use:   "kube-exec [pod-name] -- [command...]",
+	Use:   "kube-exec [pod-name | -l selector] -- [command...]",
 	Short: "Execute command in pod",
 	Long: `kube-exec allows executing commands inside a pod's container.
+
+If no pod has the exact name, a unique pod whose name starts with (or contains)
+the given name is used; when several match, a picker is shown.
+
+A workload picks its newest ready pod, so there is no need to look up the
+pod name first: deploy/backend, sts/db, ds/agent, rs/<name> or job/migrate.
+Target expressions pick a ready pod of a workload or selector:
+  @latest:deploy/<name>    newest ready pod (also sts/, ds/, rs/, job/, svc/)
+  @random:-l <selector>    random ready pod matching the label selector
+
+A namespace in the target replaces -n: my-ns/my-pod, svc/my-ns/my-svc
+(a pod backing the service), deploy/my-ns/api or @latest:deploy/my-ns/api.
+
+- is the pod (and container) last used by kube-logs, kube-exec or
+kube-port-forward, in the context it was used in.
 	
 Examples:
   kube-exec my-pod -- bash                       # Open bash shell
   kube-exec my-pod -- ls -la /app                # Execute specific command
-  kube-exec my-pod -c container-name -- env      # Exec into specific container`,
-	Args: cobra.MinimumNArgs(1),
+  kube-exec my-pod -c container-name -- env      # Exec into specific container
+  kube-exec backend -- sh                        # Partial name, e.g. backend-7f9c4d5b6-xk2lp
+  kube-exec deploy/backend -- sh                 # Newest ready pod of a deployment
+  kube-exec '@random:-l app=worker' -- sh        # Random ready pod of a selector
+  kube-exec - -- sh                              # The pod last used again
+
+Single files can be copied without kube-cp; the content is streamed through
+the exec connection, so the container only needs sh and cat:
+  kube-exec my-pod --put ./app.yaml:/tmp/app.yaml          # Upload
+  kube-exec my-pod --put ./app.yaml:/tmp/                  # Keep the file name
+  kube-exec my-pod --get /etc/nginx/nginx.conf:./nginx.conf # Download
+  kube-exec my-pod --get /etc/hosts:-                      # Print to stdout
+
+With -l the command runs in every running pod matching the selector, and with
+--all in every running pod of a workload target, without TTY or stdin. Output
+lines are prefixed with the pod name, or with --output-dir written to
+<pod>.stdout and <pod>.stderr files. A summary table of exit codes is printed
+at the end:
+  kube-exec -l app=web -- cat /proc/meminfo                       # Prefixed output
+  kube-exec -l app=web --output-dir ./diag -- sh -c 'ss -tan'     # One file per pod
+  kube-exec sts/db --all -- df -h /data                           # Every pod of a StatefulSet
+
+Container output can contain terminal escape sequences that change the window
+title, write to the clipboard or hide text. --plain strips control sequences
+and carriage returns from the output, so it is safe to show and to copy. It
+turns the TTY off unless -t is given; TTY sessions are never scrubbed since
+shells and editors need the sequences. --log appends the output of the session
+(after --plain) to a file:
+  kube-exec my-pod --plain -- cat /var/log/app.log               # Scrubbed output
+  kube-exec my-pod --log session.log -- bash                     # Keep a record of the session
+
+When the cluster rejects the credentials, e.g. because an SSO token expired
+while the terminal sat idle, the credential plugin of the kubeconfig is run
+again and the session is opened again. If that is not enough, kube-exec asks
+to log in (in another terminal) and press Enter, like sudo asks for the
+password again, instead of failing.`,
+	Args: cobra.ArbitraryArgs,
 	RunE: runExec,
 }
 
@@ -43,21 +120,101 @@ Examples:
 //   - args[dash+1:] are the command and its arguments to run inside the pod
 func runExec(cmd *cobra.Command, args []string) error {
 	dashIndex := cmd.ArgsLenAtDash()
+	transfer := execPut != "" || execGet != ""
 
-	if dashIndex == -1 {
+	switch {
+	case execLog != "" && transfer:
+		return clierr.Usagef("--log cannot be used with --put or --get")
+	case execLog != "" && execOutputDir != "":
+		return clierr.Usagef("--log cannot be used with --output-dir, the output is already written to files")
+	case execPlain && (execPut != "" || (execGet != "" && !strings.HasSuffix(execGet, ":-"))):
+		return clierr.Usagef("--plain only applies to output printed to the terminal, not to --put or --get to a file")
+	}
+	if execPlain {
+		if cmd.Flags().Changed("tty") && execTty {
+			fmt.Fprintln(os.Stderr, "Warning: --plain does not scrub TTY sessions, use -t=false for scrubbed output")
+		} else {
+			execTty = false
+		}
+	}
+
+	if execSelector != "" || execAll {
+		switch {
+		case execSelector != "" && execAll:
+			return clierr.Usagef("--all and --selector cannot be combined")
+		case transfer:
+			return clierr.Usagef("--put and --get cannot be used with --selector or --all")
+		case execSelector != "" && dashIndex != 0:
+			return clierr.Usagef("--selector replaces the pod name. Use: kube-exec -l selector -- [command...]")
+		case execAll && dashIndex != 1:
+			return clierr.Usagef("--all takes one workload. Use: kube-exec deploy/<name> --all -- [command...]")
+		case len(args) == dashIndex:
+			return clierr.Usagef("a command is required after --")
+		case execParallel < 1:
+			return clierr.Usagef("--parallel must be at least 1")
+		}
+		return runBatch(args[:dashIndex], args[dashIndex:])
+	}
+	if execOutputDir != "" {
+		return clierr.Usagef("--output-dir requires --selector or --all")
+	}
+
+	switch {
+	case len(args) == 0:
+		return clierr.Usagef("pod name or --selector is required")
+	case execPut != "" && execGet != "":
+		return clierr.Usagef("--put and --get cannot be combined")
+	case transfer && dashIndex != -1:
+		return clierr.Usagef("--put and --get do not take a command after --")
+	case transfer && len(args) != 1:
+		return clierr.Usagef("--put and --get take exactly one pod name")
+	case dashIndex == -1 && !transfer:
 		return fmt.Errorf("invalid syntax. Use: kube-exec [pod-name] -- [command...]")
+	case dashIndex == 0:
+		return clierr.Usagef("pod name is required before --")
 	}
-	if dashIndex < 1 {
-		return fmt.Errorf("pod name is required before --")
+
+	// Transfer specs are local:remote for --put and remote:local for --get
+	var source, dest string
+	if transfer {
+		spec, flag := execPut, "--put"
+		if execGet != "" {
+			spec, flag = execGet, "--get"
+		}
+		var ok bool
+		if source, dest, ok = strings.Cut(spec, ":"); !ok || source == "" || dest == "" {
+			return clierr.Usagef("invalid %s %q, expected source:destination", flag, spec)
+		}
 	}
 
 	podName := args[0]
-	command := args[dashIndex:]
+	var command []string
+	if dashIndex > 0 {
+		command = args[dashIndex:]
+	}
+
+	// - repeats the pod of the last kube-logs, kube-exec or kube-port-forward
+	if podName == state.Last {
+		last, err := state.LastPod()
+		if err != nil {
+			return err
+		}
+		podName = last.Namespace + "/" + last.Name
+		if execKubeContext == "" {
+			execKubeContext = last.Context
+		}
+		if execContainer == "" {
+			execContainer = last.Container
+		}
+	}
 
 	client, err := k8s.NewClient("", execKubeContext)
 	if err != nil {
 		return fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+	client.Context = ctx
 
 	targetNamespace := execNamespace
 	if targetNamespace == "" {
@@ -69,11 +226,13 @@ func runExec(cmd *cobra.Command, args []string) error {
 		targetNamespace = ns
 	}
 
-	// Get pod information to check containers
-	pod, err := client.Clientset.CoreV1().Pods(targetNamespace).Get(context.Background(), podName, metav1.GetOptions{})
+	// Get pod information to check containers, resolving partial names
+	pod, err := target.ResolvePod(client.Context, client.Clientset, targetNamespace, podName)
 	if err != nil {
-		return fmt.Errorf("failed to get pod %s: %w", podName, err)
+		return err
 	}
+	podName = pod.Name
+	targetNamespace = pod.Namespace
 
 	// If no container is specified and pod has multiple containers
 	if execContainer == "" && len(pod.Spec.Containers) > 1 {
@@ -81,28 +240,146 @@ func runExec(cmd *cobra.Command, args []string) error {
 		for i, container := range pod.Spec.Containers {
 			fmt.Printf("  %d. %s\n", i+1, container.Name)
 		}
-		return fmt.Errorf("please specify container with -c flag")
+		return clierr.Usagef("please specify container with -c flag")
 	}
 
 	// Use first container if not specified
 	if execContainer == "" {
 		execContainer = pod.Spec.Containers[0].Name
 	}
+	state.RememberPod(state.Pod{Context: execKubeContext, Namespace: targetNamespace, Name: podName, Container: execContainer})
+
+	if execPut != "" {
+		return putFile(client, targetNamespace, podName, source, dest)
+	}
+	if execGet != "" {
+		return getFile(client, targetNamespace, podName, source, dest)
+	}
+
+	var stdin io.Reader
+	if execStdin {
+		stdin = os.Stdin
+	}
 
+	// A TTY session gets the keystrokes unprocessed, Ctrl+C included, so the
+	// terminal is raw until the session ends, even when killed by signals
+	raw := execTty && stdin != nil && term.IsTerminal(int(os.Stdin.Fd()))
+	var rawState *term.State
+	restore := func() {
+		if rawState != nil {
+			term.Restore(int(os.Stdin.Fd()), rawState)
+			rawState = nil
+		}
+	}
+	makeRaw := func() error {
+		if !raw {
+			return nil
+		}
+		state, err := term.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			return fmt.Errorf("failed to set the terminal to raw mode: %w", err)
+		}
+		rawState = state
+		return nil
+	}
+	if err := makeRaw(); err != nil {
+		return err
+	}
+	defer restore()
+	defer interrupt.OnExit(restore)()
+
+	var log *sessionLog
+	if execLog != "" {
+		header := fmt.Sprintf("%s/%s (%s): %s", targetNamespace, podName, execContainer, strings.Join(command, " "))
+		if log, err = openSessionLog(execLog, header); err != nil {
+			return err
+		}
+		defer log.Close()
+	}
+	stdout, stderr := sessionWriters(os.Stdout, os.Stderr, log, execPlain && !execTty)
+	for {
+		err := streamExec(client, targetNamespace, podName, execContainer, command, stdin, stdout, stderr, execTty)
+		if err == nil {
+			return nil
+		}
+		// Credentials are checked when the stream is opened, so a rejected
+		// session never ran the command and is safe to start again
+		if !k8s.IsAuthError(err) || ctx.Err() != nil {
+			return fmt.Errorf("failed to execute command: %w", err)
+		}
+		restore()
+		if client, err = client.Reauthenticate(ctx); err != nil {
+			return fmt.Errorf("failed to re-authenticate: %w", err)
+		}
+		client.Context = ctx
+		if err := makeRaw(); err != nil {
+			return err
+		}
+	}
+}
+
+// sessionWriters wraps the output streams of a session: both are copied to
+// log when set, and with plain the control sequences are removed first
+func sessionWriters(stdout, stderr io.Writer, log *sessionLog, plain bool) (io.Writer, io.Writer) {
+	if log != nil {
+		stdout, stderr = io.MultiWriter(stdout, log), io.MultiWriter(stderr, log)
+	}
+	if plain {
+		stdout, stderr = sanitize.NewWriter(stdout), sanitize.NewWriter(stderr)
+	}
+	return stdout, stderr
+}
+
+// sessionLog is the --log file. The stdout and stderr streams are copied by
+// separate goroutines, so writes are serialized.
+type sessionLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openSessionLog opens path for appending and writes a header naming the
+// session. The file is only readable by the user since sessions may print
+// secrets.
+func openSessionLog(path, header string) (*sessionLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, clierr.Wrap(clierr.Usage, err)
+	}
+	if _, err := fmt.Fprintf(file, "--- %s %s\n", time.Now().Format(time.RFC3339), header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return &sessionLog{file: file}, nil
+}
+
+func (l *sessionLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Write(p)
+}
+
+// Close closes the log file
+func (l *sessionLog) Close() error {
+	return l.file.Close()
+}
+
+// streamExec runs command in the selected container, connecting the given streams.
+// A nil stdin does not open the stdin stream.
+func streamExec(client *k8s.Client, namespace, podName, container string, command []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
 	// Set up exec request
 	req := client.Clientset.CoreV1().RESTClient().Post().
 		Resource("pods").
 		Name(podName).
-		Namespace(targetNamespace).
+		Namespace(namespace).
 		SubResource("exec")
 
 	req.VersionedParams(&corev1.PodExecOptions{
-		Container: execContainer,
+		Container: container,
 		Command:   command,
-		Stdin:     execStdin,
+		Stdin:     stdin != nil,
 		Stdout:    true,
 		Stderr:    true,
-		TTY:       execTty,
+		TTY:       tty,
 	}, scheme.ParameterCodec)
 
 	// Create executor
@@ -111,20 +388,330 @@ func runExec(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create executor: %w", err)
 	}
 
-	// Execute command
-	err = executor.Stream(remotecommand.StreamOptions{
-		Stdin:  os.Stdin,
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
-		Tty:    execTty,
+	return executor.StreamWithContext(client.Context, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+		Tty:    tty,
 	})
+}
+
+// putFile uploads a local file. A remote path ending in / is a directory
+// and keeps the local file name.
+func putFile(client *k8s.Client, namespace, podName, local, remote string) error {
+	if strings.HasSuffix(remote, "/") {
+		remote += filepath.Base(local)
+	}
+
+	file, err := os.Open(local)
+	if err != nil {
+		return clierr.Wrap(clierr.Usage, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return clierr.Usagef("%s is a directory, only single files can be copied", local)
+	}
+
+	// The path is passed as $0 so it is never interpreted by the shell
+	var stderr bytes.Buffer
+	command := []string{"sh", "-c", `cat > "$0"`, remote}
+	if err := streamExec(client, namespace, podName, execContainer, command, file, io.Discard, &stderr, false); err != nil {
+		return transferError("upload to "+remote, err, stderr.String())
+	}
+
+	fmt.Fprintf(os.Stderr, "Uploaded %s to %s:%s (%s)\n", local, podName, remote, utils.FormatBytes(info.Size()))
+	return nil
+}
+
+// getFile downloads a remote file. A local path of - prints the content to
+// stdout; an existing local directory keeps the remote file name. The local
+// file is only replaced when the download succeeded.
+func getFile(client *k8s.Client, namespace, podName, remote, local string) error {
+	var stderr bytes.Buffer
+	command := []string{"cat", remote}
+	if local == "-" {
+		var stdout io.Writer = os.Stdout
+		if execPlain {
+			stdout = sanitize.NewWriter(stdout)
+		}
+		if err := streamExec(client, namespace, podName, execContainer, command, nil, stdout, &stderr, false); err != nil {
+			return transferError("download of "+remote, err, stderr.String())
+		}
+		return nil
+	}
+
+	if info, err := os.Stat(local); err == nil && info.IsDir() {
+		local = filepath.Join(local, path.Base(remote))
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(local), ".kube-exec-*")
 	if err != nil {
-		return fmt.Errorf("failed to execute command: %w", err)
+		return fmt.Errorf("failed to create %s: %w", local, err)
 	}
+	defer os.Remove(tmp.Name())
 
+	counter := &countingWriter{w: tmp}
+	err = streamExec(client, namespace, podName, execContainer, command, nil, counter, &stderr, false)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return transferError("download of "+remote, err, stderr.String())
+	}
+	if err := os.Rename(tmp.Name(), local); err != nil {
+		return fmt.Errorf("failed to write %s: %w", local, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Downloaded %s:%s to %s (%s)\n", podName, remote, local, utils.FormatBytes(counter.n))
 	return nil
 }
 
+// transferError adds the remote stderr (e.g. "No such file or directory") to err
+func transferError(what string, err error, stderr string) error {
+	if msg := strings.TrimSpace(stderr); msg != "" {
+		return fmt.Errorf("%s failed: %s", what, msg)
+	}
+	return fmt.Errorf("%s failed: %w", what, err)
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// batchResult is the outcome of the command in one pod
+type batchResult struct {
+	pod      string
+	exitCode int
+	stdout   int64
+	stderr   int64
+	duration time.Duration
+	err      error
+}
+
+// runBatch runs command in every running pod matching --selector, or of the
+// workload in refs with --all, at most --parallel at a time, and prints a
+// summary of exit codes
+func runBatch(refs, command []string) error {
+	if execOutputDir != "" {
+		if err := os.MkdirAll(execOutputDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", execOutputDir, err)
+		}
+	}
+
+	client, err := k8s.NewClient("", execKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+	client.Context = ctx
+
+	namespace := execNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(execKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+
+	selector, source := execSelector, "-l "+execSelector
+	if len(refs) > 0 {
+		ref := refs[0]
+		if ns, name := target.SplitNamespace(ref); ns != "" {
+			namespace, ref = ns, name
+		}
+		if selector, err = target.Selector(client.Context, client.Clientset, namespace, ref); err != nil {
+			return err
+		}
+		source = ref
+	}
+
+	list, err := client.Clientset.CoreV1().Pods(namespace).List(client.Context, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	var pods []corev1.Pod
+	for _, pod := range list.Items {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			pods = append(pods, pod)
+		}
+	}
+	if len(pods) == 0 {
+		return clierr.Newf(clierr.NotFound, "no running pods of %s in namespace %s", source, namespace)
+	}
+
+	var log *sessionLog
+	if execLog != "" {
+		header := fmt.Sprintf("%s in %s: %s", source, namespace, strings.Join(command, " "))
+		if log, err = openSessionLog(execLog, header); err != nil {
+			return err
+		}
+		defer log.Close()
+	}
+
+	results := make([]batchResult, len(pods))
+	var outputMu sync.Mutex
+	sem := make(chan struct{}, execParallel)
+	var wg sync.WaitGroup
+	for i := range pods {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = execInPod(client, namespace, &pods[i], command, &outputMu, log)
+		}(i)
+	}
+	wg.Wait()
+
+	return printBatchSummary(results)
+}
+
+// execInPod runs command in one pod, writing its output to the output
+// directory or, prefixed with the pod name, to stdout and stderr (and log)
+func execInPod(client *k8s.Client, namespace string, pod *corev1.Pod, command []string, outputMu *sync.Mutex, log *sessionLog) batchResult {
+	result := batchResult{pod: pod.Name}
+	container := execContainer
+	if container == "" {
+		container = pod.Spec.Containers[0].Name
+	}
+
+	var stdout, stderr io.Writer
+	if execOutputDir != "" {
+		outFile, err := os.Create(filepath.Join(execOutputDir, pod.Name+".stdout"))
+		if err != nil {
+			result.err = err
+			return result
+		}
+		defer outFile.Close()
+		errFile, err := os.Create(filepath.Join(execOutputDir, pod.Name+".stderr"))
+		if err != nil {
+			result.err = err
+			return result
+		}
+		defer errFile.Close()
+		stdout, stderr = outFile, errFile
+	} else {
+		var out, errOut io.Writer = os.Stdout, os.Stderr
+		if log != nil {
+			out, errOut = io.MultiWriter(out, log), io.MultiWriter(errOut, log)
+		}
+		outLines := &prefixWriter{prefix: pod.Name, w: out, mu: outputMu}
+		errLines := &prefixWriter{prefix: pod.Name, w: errOut, mu: outputMu}
+		defer outLines.Flush()
+		defer errLines.Flush()
+		stdout, stderr = outLines, errLines
+	}
+	if execPlain {
+		// Scrubbed before the prefix is added, which must stay intact
+		stdout, stderr = sanitize.NewWriter(stdout), sanitize.NewWriter(stderr)
+	}
+
+	outCounter := &countingWriter{w: stdout}
+	errCounter := &countingWriter{w: stderr}
+	start := time.Now()
+	err := streamExec(client, namespace, pod.Name, container, command, nil, outCounter, errCounter, false)
+	result.duration = time.Since(start)
+	result.stdout, result.stderr = outCounter.n, errCounter.n
+
+	var exitErr utilexec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result.exitCode = exitErr.ExitStatus()
+	default:
+		result.err = err
+	}
+	return result
+}
+
+// printBatchSummary prints one row per pod and fails when any pod failed
+func printBatchSummary(results []batchResult) error {
+	const (
+		reset = "\033[0m"
+		red   = "\033[31m"
+		green = "\033[32m"
+	)
+	headers := []string{"POD", "EXIT", "STDOUT", "STDERR", "DURATION"}
+	if execOutputDir != "" {
+		headers[2], headers[3] = "STDOUT FILE", "STDERR FILE"
+	}
+
+	failed := 0
+	rows := make([][]string, 0, len(results))
+	for _, r := range results {
+		exit := green + "0" + reset
+		switch {
+		case r.err != nil:
+			failed++
+			msg, _, _ := strings.Cut(r.err.Error(), "\n")
+			exit = red + utils.TruncateString(msg, 50) + reset
+		case r.exitCode != 0:
+			failed++
+			exit = fmt.Sprintf("%s%d%s", red, r.exitCode, reset)
+		}
+		stdout, stderr := utils.FormatBytes(r.stdout), utils.FormatBytes(r.stderr)
+		if execOutputDir != "" {
+			stdout = fmt.Sprintf("%s (%s)", filepath.Join(execOutputDir, r.pod+".stdout"), stdout)
+			stderr = fmt.Sprintf("%s (%s)", filepath.Join(execOutputDir, r.pod+".stderr"), stderr)
+		}
+		rows = append(rows, []string{r.pod, exit, stdout, stderr, r.duration.Round(time.Millisecond).String()})
+	}
+
+	fmt.Fprintln(os.Stderr)
+	table.Render(headers, rows)
+	if failed > 0 {
+		return clierr.Newf(clierr.Generic, "command failed in %d of %d pods", failed, len(results))
+	}
+	return nil
+}
+
+// prefixWriter writes complete lines prefixed with [prefix]. Lines of
+// concurrent pods are written under mu so they do not interleave.
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+	return len(data), nil
+}
+
+// Flush writes a final line without newline
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "[%s] %s", p.prefix, line)
+}
+
 // init initializes configuration for kube-exec command
 func init() {
 	// Define flags
@@ -133,6 +720,14 @@ func init() {
 	execRootCmd.Flags().StringVar(&execContainer, "container", "", "Container name (required if pod has multiple containers)")
 	execRootCmd.Flags().BoolVarP(&execTty, "tty", "t", true, "Allocate a TTY")
 	execRootCmd.Flags().BoolVarP(&execStdin, "stdin", "i", true, "Keep STDIN open")
+	execRootCmd.Flags().StringVar(&execPut, "put", "", "Upload a single file, local:remote")
+	execRootCmd.Flags().StringVar(&execGet, "get", "", "Download a single file, remote:local (local - for stdout)")
+	execRootCmd.Flags().StringVarP(&execSelector, "selector", "l", "", "Run the command in every running pod matching this label selector")
+	execRootCmd.Flags().BoolVar(&execAll, "all", false, "Run the command in every running pod of the workload (deploy/<name>, sts/, job/, svc/...) instead of the newest ready one")
+	execRootCmd.Flags().StringVar(&execOutputDir, "output-dir", "", "With --selector or --all, write each pod's stdout and stderr to files in this directory")
+	execRootCmd.Flags().IntVar(&execParallel, "parallel", 10, "With --selector or --all, number of pods to run the command in at once")
+	execRootCmd.Flags().BoolVar(&execPlain, "plain", false, "Strip terminal control sequences from the output (turns the TTY off)")
+	execRootCmd.Flags().StringVar(&execLog, "log", "", "Append the output of the session to this file")
 
 	// Bind flags with viper
 	viper.BindPFlag("namespace", execRootCmd.Flags().Lookup("namespace"))
@@ -141,8 +736,16 @@ func init() {
 
 // main is the entry point of kube-exec
 func main() {
-	if err := execRootCmd.Execute(); err != nil {
+	k8s.AddVerbosityFlag(execRootCmd)
+	k8s.AddRateLimitFlags(execRootCmd)
+	config.SetupDefaults(execRootCmd)
+	clierr.SetupUsage(execRootCmd)
+	cmd, err := execRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(clierr.ExitCode(err))
 	}
 }
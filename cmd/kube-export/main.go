@@ -0,0 +1,655 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	exportNamespace     string
+	exportKubeContext   string
+	exportAllNamespaces bool
+	exportSelector      string
+	exportOutputDir     string
+	exportIncludeOwned  bool
+	exportDryRun        bool
+	snapshotDir         string
+)
+
+// defaultKinds are exported when no kinds are given. Secrets are left out
+// so a backup does not leak credentials by accident.
+var defaultKinds = []string{
+	"deployments", "statefulsets", "daemonsets", "cronjobs", "services",
+	"ingresses", "configmaps", "serviceaccounts", "roles", "rolebindings",
+	"persistentvolumeclaims", "horizontalpodautoscalers", "poddisruptionbudgets",
+	"networkpolicies",
+}
+
+// clusterDir holds cluster-scoped resources in the output directory
+const clusterDir = "_cluster"
+
+// strippedAnnotations are written by controllers and kubectl, not by users
+var strippedAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"deployment.kubernetes.io/revision",
+	"pv.kubernetes.io/bind-completed",
+	"pv.kubernetes.io/bound-by-controller",
+	"volume.beta.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/selected-node",
+}
+
+// exportRootCmd represents the kube-export command
+var exportRootCmd = &cobra.Command{
+	Use:   "kube-export [kind...]",
+	Short: "Export resources to YAML files",
+	Long: `kube-export writes resources to one YAML file each, ready for a backup or to
+seed a GitOps repository:
+
+  <output-dir>/<namespace>/<resource>/<name>.yaml
+  <output-dir>/_cluster/<resource>/<name>.yaml      (cluster-scoped kinds)
+
+Server-managed fields are stripped: status, uid, resourceVersion, generation,
+creationTimestamp, managedFields, the last-applied annotation and values
+assigned by the cluster such as a Service clusterIP or a bound volumeName.
+Objects owned by a controller (ReplicaSets of Deployments, Jobs of CronJobs)
+are skipped unless --include-owned is set.
+
+Kinds accept the same names as kubectl (deploy, svc, cm, crontabs.example.com).
+Without kinds, common workload and config kinds are exported; Secrets are
+only exported when asked for explicitly.
+
+Examples:
+  kube-export                                  # Common kinds of the namespace to ./export
+  kube-export deploy svc cm -o ./gitops/app    # Some kinds into a repo
+  kube-export -A -l team=payments              # Everything of a team, all namespaces
+  kube-export secrets -n prod                  # Secrets, explicitly
+  kube-export --dry-run                        # Only show what would be written
+
+Use 'kube-export snapshot' and 'kube-export diff-snapshot <dir>' to detect drift.`,
+	Args: cobra.ArbitraryArgs,
+	RunE: runExport,
+}
+
+// snapshotExportCmd represents the kube-export snapshot subcommand
+var snapshotExportCmd = &cobra.Command{
+	Use:   "snapshot [kind...]",
+	Short: "Export resources and record their checksums",
+	Long: `snapshot exports like kube-export and writes snapshot.json next to the files.
+The manifest records the context, the resolved kinds, namespace, selector and
+a checksum of every file, so 'kube-export diff-snapshot' can list the same
+objects again later.
+
+Examples:
+  kube-export snapshot                              # ./snapshot-<timestamp>
+  kube-export snapshot deploy,svc,cm -o before-upgrade
+  kube-export snapshot -A -l app.kubernetes.io/part-of=shop`,
+	RunE: runSnapshot,
+}
+
+// diffSnapshotExportCmd represents the kube-export diff-snapshot subcommand
+var diffSnapshotExportCmd = &cobra.Command{
+	Use:   "diff-snapshot <dir>",
+	Short: "Compare live objects with a snapshot",
+	Long: `diff-snapshot lists the kinds recorded in a snapshot with the same namespace
+and selector and reports objects that were added, removed or changed since.
+Changed objects show the fields that differ; server-managed fields are
+stripped on both sides, so only real changes count.
+
+The command exits with 1 when anything drifted, so it can gate a pipeline.
+
+Examples:
+  kube-export diff-snapshot before-upgrade
+  kube-export diff-snapshot snapshot-20240601-120000 -c staging`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDiffSnapshot,
+}
+
+// snapshotManifest is the file name of the snapshot manifest
+const snapshotManifest = "snapshot.json"
+
+// exportScope selects what is exported. A snapshot records it, so
+// diff-snapshot lists exactly the same objects again.
+type exportScope struct {
+	Kinds        []string `json:"kinds"`
+	Namespace    string   `json:"namespace,omitempty"`
+	Selector     string   `json:"selector,omitempty"`
+	IncludeOwned bool     `json:"includeOwned,omitempty"`
+}
+
+// exportedObject is one cleaned object and its file in the output directory
+type exportedObject struct {
+	file      string
+	resource  string
+	namespace string
+	obj       *unstructured.Unstructured
+	data      []byte
+}
+
+// manifest describes a snapshot and the checksum of every file in it
+type manifest struct {
+	Created time.Time `json:"created"`
+	Context string    `json:"context,omitempty"`
+	exportScope
+	Objects []manifestEntry `json:"objects"`
+}
+
+// manifestEntry is one object of a snapshot
+type manifestEntry struct {
+	File       string `json:"file"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	SHA256     string `json:"sha256"`
+}
+
+// exportCount is the number of files per resource and namespace
+type exportCount struct {
+	resource  string
+	namespace string
+	files     int
+}
+
+// runExport lists every kind and writes the cleaned objects
+func runExport(cmd *cobra.Command, args []string) error {
+	if exportOutputDir == "" {
+		return clierr.Usagef("--output-dir must not be empty")
+	}
+	client, scope, err := newExportScope(args)
+	if err != nil {
+		return err
+	}
+	objects, _, err := collectObjects(client, scope, len(args) > 0)
+	if err != nil {
+		return err
+	}
+
+	if !exportDryRun {
+		if err := writeObjects(exportOutputDir, objects); err != nil {
+			return err
+		}
+	}
+	printCounts(objects)
+	if exportDryRun {
+		fmt.Printf("Would write %d file(s) to %s\n", len(objects), exportOutputDir)
+	} else {
+		fmt.Printf("Wrote %d file(s) to %s\n", len(objects), exportOutputDir)
+	}
+	return nil
+}
+
+// runSnapshot exports like runExport and records the scope and the
+// checksum of every file in the snapshot manifest
+func runSnapshot(cmd *cobra.Command, args []string) error {
+	dir := snapshotDir
+	if dir == "" {
+		dir = "snapshot-" + time.Now().Format("20060102-150405")
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotManifest)); err == nil {
+		return clierr.Newf(clierr.Conflict, "%s already holds a snapshot", dir)
+	}
+
+	client, scope, err := newExportScope(args)
+	if err != nil {
+		return err
+	}
+	objects, kinds, err := collectObjects(client, scope, len(args) > 0)
+	if err != nil {
+		return err
+	}
+	// Record the resolved kinds, so a diff does not depend on short names
+	scope.Kinds = kinds
+
+	contextName := exportKubeContext
+	if contextName == "" {
+		if rawCfg, err := k8s.LoadRawConfig(); err == nil {
+			contextName = rawCfg.CurrentContext
+		}
+	}
+	m := manifest{Created: time.Now().UTC().Truncate(time.Second), Context: contextName, exportScope: *scope}
+	for _, o := range objects {
+		sum := sha256.Sum256(o.data)
+		m.Objects = append(m.Objects, manifestEntry{
+			File:       o.file,
+			APIVersion: o.obj.GetAPIVersion(),
+			Kind:       o.obj.GetKind(),
+			Namespace:  o.obj.GetNamespace(),
+			Name:       o.obj.GetName(),
+			SHA256:     hex.EncodeToString(sum[:]),
+		})
+	}
+
+	if err := writeObjects(dir, objects); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, snapshotManifest), data, 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot manifest: %w", err)
+	}
+
+	printCounts(objects)
+	fmt.Printf("Snapshot of %d object(s) written to %s\n", len(objects), dir)
+	fmt.Printf("Compare it later with: kube-export diff-snapshot %s\n", dir)
+	return nil
+}
+
+// runDiffSnapshot lists the objects of a snapshot again and reports what
+// was added, removed or changed since
+func runDiffSnapshot(cmd *cobra.Command, args []string) error {
+	const (
+		colorReset  = "\033[0m"
+		colorRed    = "\033[31m"
+		colorGreen  = "\033[32m"
+		colorYellow = "\033[33m"
+	)
+
+	dir := args[0]
+	data, err := os.ReadFile(filepath.Join(dir, snapshotManifest))
+	if os.IsNotExist(err) {
+		return clierr.Newf(clierr.NotFound, "%s is not a snapshot: %s is missing", dir, snapshotManifest)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot manifest: %w", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("invalid snapshot manifest %s: %w", filepath.Join(dir, snapshotManifest), err)
+	}
+
+	client, err := k8s.NewClient("", exportKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	contextName := exportKubeContext
+	if contextName == "" {
+		if rawCfg, err := k8s.LoadRawConfig(); err == nil {
+			contextName = rawCfg.CurrentContext
+		}
+	}
+	if m.Context != "" && contextName != m.Context {
+		fmt.Fprintf(os.Stderr, "Warning: snapshot was taken in context %s, comparing with %s\n", m.Context, contextName)
+	}
+
+	// Kinds that are no longer served count as removed, so they are not explicit
+	objects, _, err := collectObjects(client, &m.exportScope, false)
+	if err != nil {
+		return err
+	}
+	live := make(map[string]exportedObject, len(objects))
+	for _, o := range objects {
+		live[o.file] = o
+	}
+
+	headers := []string{"CHANGE", "KIND", "NAMESPACE", "NAME", "FIELDS"}
+	var rows [][]string
+	var added, removed, changed int
+	for _, entry := range m.Objects {
+		o, ok := live[entry.File]
+		if !ok {
+			removed++
+			rows = append(rows, []string{colorRed + "removed" + colorReset, entry.Kind, entry.Namespace, entry.Name, ""})
+			continue
+		}
+		delete(live, entry.File)
+		sum := sha256.Sum256(o.data)
+		if hex.EncodeToString(sum[:]) == entry.SHA256 {
+			continue
+		}
+		changed++
+		fields := "-"
+		// The file may have been edited or removed since, the checksum is authoritative
+		if before, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(entry.File))); err == nil {
+			fields = strings.Join(changedFields(before, o.data), ", ")
+		}
+		rows = append(rows, []string{colorYellow + "changed" + colorReset, entry.Kind, entry.Namespace, entry.Name, utils.TruncateString(fields, 60)})
+	}
+	for _, o := range objects {
+		if _, ok := live[o.file]; !ok {
+			continue
+		}
+		added++
+		rows = append(rows, []string{colorGreen + "added" + colorReset, o.obj.GetKind(), o.obj.GetNamespace(), o.obj.GetName(), ""})
+	}
+
+	age := utils.FormatAge(time.Since(m.Created))
+	if len(rows) == 0 {
+		fmt.Printf("No drift: %d object(s) match the snapshot from %s ago\n", len(m.Objects), age)
+		return nil
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i][2] != rows[j][2] {
+			return rows[i][2] < rows[j][2]
+		}
+		if rows[i][1] != rows[j][1] {
+			return rows[i][1] < rows[j][1]
+		}
+		return rows[i][3] < rows[j][3]
+	})
+	table.Render(headers, rows)
+	fmt.Printf("%d added, %d removed, %d changed since the snapshot from %s ago\n", added, removed, changed, age)
+	return clierr.Newf(clierr.Generic, "%d object(s) drifted from the snapshot", added+removed+changed)
+}
+
+// newExportScope creates the client and resolves the namespace and kinds
+// from the flags and arguments
+func newExportScope(args []string) (*k8s.Client, *exportScope, error) {
+	kinds := defaultKinds
+	if len(args) > 0 {
+		kinds = nil
+		for _, arg := range args {
+			for _, kind := range strings.Split(arg, ",") {
+				if kind = strings.TrimSpace(kind); kind != "" {
+					kinds = append(kinds, kind)
+				}
+			}
+		}
+	}
+
+	client, err := k8s.NewClient("", exportKubeContext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	namespace := exportNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(exportKubeContext); err != nil {
+			return nil, nil, fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	if exportAllNamespaces {
+		namespace = ""
+	}
+
+	return client, &exportScope{Kinds: kinds, Namespace: namespace, Selector: exportSelector, IncludeOwned: exportIncludeOwned}, nil
+}
+
+// collectObjects lists every kind of the scope and returns the cleaned
+// objects with the kinds that were served. Unknown kinds are an error only
+// when explicit, otherwise they are skipped.
+func collectObjects(client *k8s.Client, scope *exportScope, explicit bool) ([]exportedObject, []string, error) {
+	dyn, err := client.Dynamic()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Discovery does not take a context, so it runs before the lists that
+	// an interrupt stops
+	var mappings []*k8s.ResourceMapping
+	for _, kind := range scope.Kinds {
+		mapping, err := client.ResolveResource(kind)
+		if err != nil {
+			// Kinds from the default list may not be served by every cluster
+			if !explicit && meta.IsNoMatchError(err) {
+				continue
+			}
+			if meta.IsNoMatchError(err) {
+				return nil, nil, clierr.Wrap(clierr.Usage, err)
+			}
+			return nil, nil, err
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	var objects []exportedObject
+	var served []string
+	for _, mapping := range mappings {
+		var resource dynamic.ResourceInterface = dyn.Resource(mapping.Resource)
+		if mapping.Namespaced {
+			resource = dyn.Resource(mapping.Resource).Namespace(scope.Namespace)
+		}
+		list, err := resource.List(ctx, metav1.ListOptions{LabelSelector: scope.Selector})
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("stopped while listing %s, nothing written: %w", mapping.Resource.Resource, context.Cause(ctx))
+		}
+		if apierrors.IsForbidden(err) {
+			fmt.Fprintf(os.Stderr, "Warning: not allowed to list %s, skipped\n", mapping.Resource.Resource)
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list %s: %w", mapping.Resource.Resource, err)
+		}
+
+		resourceDir := mapping.Resource.Resource
+		if group := mapping.Resource.Group; group != "" && !isBuiltinGroup(group) {
+			resourceDir += "." + group
+		}
+		served = append(served, mapping.Resource.GroupResource().String())
+		for i := range list.Items {
+			obj := &list.Items[i]
+			if !scope.IncludeOwned && metav1.GetControllerOf(obj) != nil {
+				continue
+			}
+			dir := clusterDir
+			if mapping.Namespaced {
+				dir = obj.GetNamespace()
+			}
+
+			clean := obj.DeepCopy()
+			stripServerFields(clean)
+			data, err := yaml.Marshal(clean.Object)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to encode %s: %w", obj.GetName(), err)
+			}
+			objects = append(objects, exportedObject{
+				file:      path.Join(dir, resourceDir, obj.GetName()+".yaml"),
+				resource:  resourceDir,
+				namespace: dir,
+				obj:       clean,
+				data:      data,
+			})
+		}
+	}
+	return objects, served, nil
+}
+
+// writeObjects writes every object below dir
+func writeObjects(dir string, objects []exportedObject) error {
+	for _, o := range objects {
+		if err := writeObject(filepath.Join(dir, filepath.FromSlash(o.file)), o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printCounts prints the number of files per namespace and resource
+func printCounts(objects []exportedObject) {
+	perResource := map[[2]string]int{}
+	for _, o := range objects {
+		perResource[[2]string{o.namespace, o.resource}]++
+	}
+	counts := make([]exportCount, 0, len(perResource))
+	for key, n := range perResource {
+		counts = append(counts, exportCount{namespace: key[0], resource: key[1], files: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].namespace != counts[j].namespace {
+			return counts[i].namespace < counts[j].namespace
+		}
+		return counts[i].resource < counts[j].resource
+	})
+
+	headers := []string{"NAMESPACE", "RESOURCE", "FILES"}
+	rows := make([][]string, 0, len(counts))
+	for _, c := range counts {
+		rows = append(rows, []string{c.namespace, c.resource, fmt.Sprintf("%d", c.files)})
+	}
+	table.Render(headers, rows)
+}
+
+// changedFields returns the paths of the fields that differ between two
+// YAML documents. Lists are compared as a whole.
+func changedFields(before, after []byte) []string {
+	var a, b interface{}
+	if yaml.Unmarshal(before, &a) != nil || yaml.Unmarshal(after, &b) != nil {
+		return nil
+	}
+	var fields []string
+	var walk func(prefix string, a, b interface{})
+	walk = func(prefix string, a, b interface{}) {
+		am, aok := a.(map[string]interface{})
+		bm, bok := b.(map[string]interface{})
+		if !aok || !bok {
+			if !reflect.DeepEqual(a, b) {
+				fields = append(fields, prefix)
+			}
+			return
+		}
+		keys := map[string]bool{}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			field := k
+			if prefix != "" {
+				field = prefix + "." + k
+			}
+			walk(field, am[k], bm[k])
+		}
+	}
+	walk("", a, b)
+	return fields
+}
+
+// writeObject writes the YAML of an exported object to path
+func writeObject(file string, o exportedObject) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(file), err)
+	}
+	// Secrets stay readable by the owner only
+	mode := os.FileMode(0644)
+	if o.obj.GetKind() == "Secret" {
+		mode = 0600
+	}
+	if err := os.WriteFile(file, o.data, mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return nil
+}
+
+// stripServerFields removes what the API server or controllers set, so the
+// object can be applied to another cluster
+func stripServerFields(obj *unstructured.Unstructured) {
+	unstructured.RemoveNestedField(obj.Object, "status")
+	for _, field := range []string{"uid", "resourceVersion", "generation", "creationTimestamp", "managedFields", "selfLink", "deletionTimestamp", "deletionGracePeriodSeconds", "ownerReferences"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+
+	annotations := obj.GetAnnotations()
+	for _, key := range strippedAnnotations {
+		delete(annotations, key)
+	}
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(obj.Object, "metadata", "annotations")
+	} else {
+		obj.SetAnnotations(annotations)
+	}
+
+	switch obj.GetKind() {
+	case "Service":
+		// Cluster IPs are allocated by the cluster, except for headless services
+		if ip, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterIP"); ip != "None" {
+			unstructured.RemoveNestedField(obj.Object, "spec", "clusterIP")
+			unstructured.RemoveNestedField(obj.Object, "spec", "clusterIPs")
+		}
+	case "PersistentVolumeClaim":
+		unstructured.RemoveNestedField(obj.Object, "spec", "volumeName")
+	case "ServiceAccount":
+		unstructured.RemoveNestedField(obj.Object, "secrets")
+	case "Job":
+		// The controller generates the selector and its labels
+		unstructured.RemoveNestedField(obj.Object, "spec", "selector")
+		for _, key := range []string{"controller-uid", "batch.kubernetes.io/controller-uid"} {
+			unstructured.RemoveNestedField(obj.Object, "spec", "template", "metadata", "labels", key)
+		}
+	}
+}
+
+// isBuiltinGroup reports whether group is served by Kubernetes itself, so
+// its resources need no group suffix in the directory name
+func isBuiltinGroup(group string) bool {
+	return !strings.Contains(group, ".") || strings.HasSuffix(group, ".k8s.io")
+}
+
+// init initializes flags for kube-export command
+func init() {
+	exportRootCmd.Flags().StringVarP(&exportNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	exportRootCmd.Flags().StringVarP(&exportKubeContext, "context", "c", "", "Kubernetes context to use")
+	exportRootCmd.Flags().BoolVarP(&exportAllNamespaces, "all-namespaces", "A", false, "Export from all namespaces")
+	exportRootCmd.Flags().StringVarP(&exportSelector, "selector", "l", "", "Only export objects matching this label selector")
+	exportRootCmd.Flags().StringVarP(&exportOutputDir, "output-dir", "o", "export", "Directory to write the YAML files to")
+	exportRootCmd.Flags().BoolVar(&exportIncludeOwned, "include-owned", false, "Also export objects owned by a controller")
+	exportRootCmd.Flags().BoolVar(&exportDryRun, "dry-run", false, "Only count what would be written")
+
+	// Namespace and context are shared with subcommands
+	exportRootCmd.PersistentFlags().AddFlag(exportRootCmd.Flags().Lookup("namespace"))
+	exportRootCmd.PersistentFlags().AddFlag(exportRootCmd.Flags().Lookup("context"))
+
+	snapshotExportCmd.Flags().BoolVarP(&exportAllNamespaces, "all-namespaces", "A", false, "Snapshot all namespaces")
+	snapshotExportCmd.Flags().StringVarP(&exportSelector, "selector", "l", "", "Only snapshot objects matching this label selector")
+	snapshotExportCmd.Flags().StringVarP(&snapshotDir, "output-dir", "o", "", "Snapshot directory (default snapshot-<timestamp>)")
+	snapshotExportCmd.Flags().BoolVar(&exportIncludeOwned, "include-owned", false, "Also snapshot objects owned by a controller")
+	exportRootCmd.AddCommand(snapshotExportCmd, diffSnapshotExportCmd)
+
+	viper.BindPFlag("namespace", exportRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", exportRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-export
+func main() {
+	k8s.AddVerbosityFlag(exportRootCmd)
+	k8s.AddRateLimitFlags(exportRootCmd)
+	config.SetupDefaults(exportRootCmd)
+	clierr.SetupUsage(exportRootCmd)
+	cmd, err := exportRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
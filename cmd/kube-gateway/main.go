@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/gatewayapi"
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	gatewayNamespace     string
+	gatewayKubeContext   string
+	gatewayAllNamespaces bool
+	gatewayTable         table.Options
+)
+
+// Colors of states, shared by all listings
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// gatewayRootCmd represents the kube-gateway command
+var gatewayRootCmd = &cobra.Command{
+	Use:   "kube-gateway",
+	Short: "List Gateway API Gateways, GatewayClasses and HTTPRoutes",
+	Long: `kube-gateway shows the Gateway API resources that replace Ingress, with the
+status their controllers report and what kube-gateway checks itself:
+
+- Gateways with their class, addresses, listeners and attached routes, and
+  whether they are Accepted and Programmed
+- Listeners of the Gateways, with conflicts: listeners sharing a port need
+  compatible protocols and distinct hostnames (listeners)
+- GatewayClasses with their controller and how many Gateways use them (classes)
+- HTTPRoutes with their attachment to every parent Gateway and the health of
+  their backend Services: ready endpoints for the port (routes)
+
+A route that is not attached shows the reason from its controller, e.g.
+NotAllowedByListeners or NoMatchingListenerHostname; Pending means no
+controller reported on it yet, which usually means the parent Gateway or its
+class does not exist or has no running controller.
+
+Examples:
+  kube-gateway                          # Gateways of the current namespace
+  kube-gateway -A                       # Gateways of all namespaces
+  kube-gateway listeners public         # Listeners of Gateway public
+  kube-gateway classes                  # GatewayClasses and their controllers
+  kube-gateway routes -A                # HTTPRoutes, attachment and backend health`,
+	Args: cobra.NoArgs,
+	RunE: runGateways,
+}
+
+// classesGatewayCmd represents the kube-gateway classes subcommand
+var classesGatewayCmd = &cobra.Command{
+	Use:   "classes",
+	Short: "List GatewayClasses with their controller and Gateways",
+	Args:  cobra.NoArgs,
+	RunE:  runClasses,
+}
+
+// listenersGatewayCmd represents the kube-gateway listeners subcommand
+var listenersGatewayCmd = &cobra.Command{
+	Use:   "listeners [gateway]",
+	Short: "List the listeners of Gateways with attached routes and conflicts",
+	Long: `listeners prints one row per listener of every Gateway, or of the named one.
+
+CONFLICT shows conflicts the controller reports (Conflicted condition) and
+those found in the spec: listeners on the same port with incompatible
+protocols (only HTTPS and TLS can share a port, TCP and UDP cannot share at
+all) or with the same hostname. A conflicted listener does not accept routes.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runListeners,
+}
+
+// routesGatewayCmd represents the kube-gateway routes subcommand
+var routesGatewayCmd = &cobra.Command{
+	Use:   "routes",
+	Short: "List HTTPRoutes with their parent attachment and backend health",
+	Long: `routes prints every HTTPRoute with its hostnames, its state at each parent
+Gateway and its backends.
+
+PARENTS is Accepted, NotAccepted or RefsUnresolved with the reason the
+controller gives, or Pending when no controller reported on the route.
+BACKENDS shows the ready endpoints of every Service backend for the route
+port; Services without ready endpoints or that do not exist are red. Other
+backend kinds are listed without health.`,
+	Args: cobra.NoArgs,
+	RunE: runRoutes,
+}
+
+// gatewayClient returns the client, the Gateway API reader and the namespace
+// to list, empty for --all-namespaces
+func gatewayClient() (*k8s.Client, *gatewayapi.Reader, string, error) {
+	if err := gatewayTable.Validate(); err != nil {
+		return nil, nil, "", err
+	}
+	client, err := k8s.NewClient("", gatewayKubeContext)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	reader, err := gatewayapi.NewReader(client)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	ns := gatewayNamespace
+	if ns == "" {
+		if ns, err = k8s.GetCurrentNamespace(gatewayKubeContext); err != nil {
+			return nil, nil, "", fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	if gatewayAllNamespaces {
+		ns = ""
+	}
+	return client, reader, ns, nil
+}
+
+// runGateways lists Gateways
+func runGateways(cmd *cobra.Command, args []string) error {
+	client, reader, ns, err := gatewayClient()
+	if err != nil {
+		return err
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	gateways, err := reader.Gateways(ctx, ns)
+	if err != nil {
+		return err
+	}
+
+	headers := []string{"NAME", "CLASS", "ADDRESSES", "LISTENERS", "ROUTES", "ACCEPTED", "PROGRAMMED", "AGE"}
+	rows := make([][]string, 0, len(gateways))
+	for i := range gateways {
+		gw := &gateways[i]
+		addresses := make([]string, 0, len(gw.Status.Addresses))
+		for _, a := range gw.Status.Addresses {
+			addresses = append(addresses, a.Value)
+		}
+		routes := int32(0)
+		for _, l := range gw.Status.Listeners {
+			routes += l.AttachedRoutes
+		}
+		listeners := fmt.Sprintf("%d", len(gw.Spec.Listeners))
+		if conflicts := len(gatewayapi.ListenerConflicts(gw)); conflicts > 0 {
+			listeners = fmt.Sprintf("%s%s (%d conflicted)%s", colorRed, listeners, conflicts, colorReset)
+		}
+		rows = append(rows, []string{
+			gw.Name,
+			gw.Spec.GatewayClassName,
+			utils.OrDash(strings.Join(addresses, ",")),
+			listeners,
+			fmt.Sprintf("%d", routes),
+			colorCondition(gw.Status.Conditions, "Accepted"),
+			colorCondition(gw.Status.Conditions, "Programmed"),
+			utils.FormatAge(time.Since(gw.CreationTimestamp.Time)),
+		})
+	}
+	printRows(headers, rows, namespaces(gateways, func(gw gatewayapi.Gateway) string { return gw.Namespace }))
+	return nil
+}
+
+// runClasses lists GatewayClasses with the number of Gateways using each
+func runClasses(cmd *cobra.Command, args []string) error {
+	client, reader, _, err := gatewayClient()
+	if err != nil {
+		return err
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	classes, err := reader.GatewayClasses(ctx)
+	if err != nil {
+		return err
+	}
+	// Classes are cluster scoped, count their Gateways everywhere
+	gateways, err := reader.Gateways(ctx, "")
+	if err != nil {
+		return err
+	}
+	used := map[string]int{}
+	for _, gw := range gateways {
+		used[gw.Spec.GatewayClassName]++
+	}
+
+	headers := []string{"NAME", "CONTROLLER", "ACCEPTED", "GATEWAYS", "AGE"}
+	rows := make([][]string, 0, len(classes))
+	for _, class := range classes {
+		rows = append(rows, []string{
+			class.Name,
+			class.Spec.ControllerName,
+			colorCondition(class.Status.Conditions, "Accepted"),
+			fmt.Sprintf("%d", used[class.Name]),
+			utils.FormatAge(time.Since(class.CreationTimestamp.Time)),
+		})
+		delete(used, class.Name)
+	}
+	gatewayTable.Print(headers, rows, 0)
+
+	// Gateways of a class that does not exist are never programmed
+	for _, name := range sortedKeys(used) {
+		fmt.Fprintf(os.Stderr, "Warning: %d Gateway(s) use GatewayClass %s, which does not exist\n", used[name], name)
+	}
+	return nil
+}
+
+// runListeners lists the listeners of all Gateways, or of one
+func runListeners(cmd *cobra.Command, args []string) error {
+	client, reader, ns, err := gatewayClient()
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 && gatewayAllNamespaces {
+		return clierr.Usagef("--all-namespaces cannot be used with a gateway name")
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	gateways, err := reader.Gateways(ctx, ns)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		var found []gatewayapi.Gateway
+		for _, gw := range gateways {
+			if gw.Name == args[0] {
+				found = append(found, gw)
+			}
+		}
+		if len(found) == 0 {
+			return clierr.Newf(clierr.NotFound, "gateway %s not found in namespace %s", args[0], ns)
+		}
+		gateways = found
+	}
+
+	headers := []string{"GATEWAY", "LISTENER", "PROTOCOL", "PORT", "HOSTNAME", "ROUTES", "PROGRAMMED", "CONFLICT"}
+	var rows [][]string
+	var rowNamespaces []string
+	for i := range gateways {
+		gw := &gateways[i]
+		conflicts := gatewayapi.ListenerConflicts(gw)
+		statuses := map[string]gatewayapi.ListenerStatus{}
+		for _, s := range gw.Status.Listeners {
+			statuses[s.Name] = s
+		}
+		for _, l := range gw.Spec.Listeners {
+			status, reported := statuses[l.Name]
+			routes := "-"
+			if reported {
+				routes = fmt.Sprintf("%d", status.AttachedRoutes)
+			}
+			conflict := "-"
+			if reason := conflicts[l.Name]; reason != "" {
+				conflict = colorRed + reason + colorReset
+			}
+			rows = append(rows, []string{
+				gw.Name,
+				l.Name,
+				l.Protocol,
+				fmt.Sprintf("%d", l.Port),
+				utils.OrDash(l.Hostname),
+				routes,
+				colorCondition(status.Conditions, "Programmed"),
+				conflict,
+			})
+			rowNamespaces = append(rowNamespaces, gw.Namespace)
+		}
+	}
+	printRows(headers, rows, rowNamespaces)
+	return nil
+}
+
+// runRoutes lists HTTPRoutes with their attachment and backend health
+func runRoutes(cmd *cobra.Command, args []string) error {
+	client, reader, ns, err := gatewayClient()
+	if err != nil {
+		return err
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	routes, err := reader.HTTPRoutes(ctx, ns)
+	if err != nil {
+		return err
+	}
+
+	backends := gatewayapi.NewBackendChecker(client)
+	headers := []string{"NAME", "HOSTNAMES", "PARENTS", "BACKENDS", "AGE"}
+	rows := make([][]string, 0, len(routes))
+	for i := range routes {
+		route := &routes[i]
+		parents := make([]string, 0, len(route.Spec.ParentRefs))
+		for _, a := range gatewayapi.Attachments(route) {
+			parents = append(parents, formatAttachment(a))
+		}
+		backendList, err := formatBackends(ctx, backends, route)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []string{
+			route.Name,
+			utils.OrDash(strings.Join(route.Spec.Hostnames, ",")),
+			utils.OrDash(strings.Join(parents, " ")),
+			utils.OrDash(strings.Join(backendList, " ")),
+			utils.FormatAge(time.Since(route.CreationTimestamp.Time)),
+		})
+	}
+	printRows(headers, rows, namespaces(routes, func(r gatewayapi.HTTPRoute) string { return r.Namespace }))
+	return nil
+}
+
+// formatAttachment colors the state of a route at one parent
+func formatAttachment(a gatewayapi.Attachment) string {
+	state := a.State
+	if a.Reason != "" {
+		state += ":" + a.Reason
+	}
+	switch a.State {
+	case "Accepted":
+		return a.Parent + " " + colorGreen + state + colorReset
+	case "Pending":
+		return a.Parent + " " + colorYellow + state + colorReset
+	}
+	return a.Parent + " " + colorRed + state + colorReset
+}
+
+// formatBackends lists the distinct backends of all rules of a route with
+// their health
+func formatBackends(ctx context.Context, checker *gatewayapi.BackendChecker, route *gatewayapi.HTTPRoute) ([]string, error) {
+	seen := map[string]bool{}
+	var backends []string
+	for _, rule := range route.Spec.Rules {
+		for _, ref := range rule.BackendRefs {
+			name := ref.Name
+			if ref.Namespace != "" && ref.Namespace != route.Namespace {
+				name = ref.Namespace + "/" + name
+			}
+			if ref.Port != nil {
+				name += fmt.Sprintf(":%d", *ref.Port)
+			}
+			if !ref.IsService() {
+				kind := ""
+				if ref.Kind != nil {
+					kind = strings.ToLower(*ref.Kind) + "/"
+				}
+				name = kind + name
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if !ref.IsService() {
+				backends = append(backends, name)
+				continue
+			}
+
+			b, err := checker.Check(ctx, route.Namespace, ref)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case !b.Found:
+				backends = append(backends, name+" "+colorRed+"missing"+colorReset)
+			case b.Ready == 0:
+				backends = append(backends, fmt.Sprintf("%s %s0/%d%s", name, colorRed, b.NotReady, colorReset))
+			case b.NotReady > 0:
+				backends = append(backends, fmt.Sprintf("%s %s%d/%d%s", name, colorYellow, b.Ready, b.Ready+b.NotReady, colorReset))
+			default:
+				backends = append(backends, fmt.Sprintf("%s %s%d/%d%s", name, colorGreen, b.Ready, b.Ready, colorReset))
+			}
+		}
+	}
+	return backends, nil
+}
+
+// colorCondition formats a condition, green when true, red when false and
+// yellow when not reported
+func colorCondition(conditions []metav1.Condition, conditionType string) string {
+	status, text := gatewayapi.ConditionSummary(conditions, conditionType)
+	switch status {
+	case metav1.ConditionTrue:
+		return colorGreen + text + colorReset
+	case metav1.ConditionFalse:
+		return colorRed + text + colorReset
+	}
+	return colorYellow + text + colorReset
+}
+
+// printRows prints the rows, with a NAMESPACE column for --all-namespaces
+func printRows(headers []string, rows [][]string, rowNamespaces []string) {
+	if gatewayAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+		for i := range rows {
+			rows[i] = append([]string{rowNamespaces[i]}, rows[i]...)
+		}
+	}
+	nameColumn := 0
+	if gatewayAllNamespaces {
+		nameColumn = 1
+	}
+	gatewayTable.Print(headers, rows, nameColumn)
+}
+
+// namespaces returns the namespace of every item
+func namespaces[T any](items []T, namespace func(T) string) []string {
+	result := make([]string, len(items))
+	for i, item := range items {
+		result[i] = namespace(item)
+	}
+	return result
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// init initializes flags for kube-gateway command
+func init() {
+	gatewayRootCmd.PersistentFlags().StringVarP(&gatewayNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	gatewayRootCmd.PersistentFlags().StringVarP(&gatewayKubeContext, "context", "c", "", "Kubernetes context to use")
+	gatewayRootCmd.PersistentFlags().BoolVarP(&gatewayAllNamespaces, "all-namespaces", "A", false, "List resources of all namespaces")
+
+	for _, cmd := range []*cobra.Command{gatewayRootCmd, classesGatewayCmd, listenersGatewayCmd, routesGatewayCmd} {
+		gatewayTable.AddFlags(cmd)
+	}
+	gatewayRootCmd.AddCommand(classesGatewayCmd, listenersGatewayCmd, routesGatewayCmd)
+
+	viper.BindPFlag("namespace", gatewayRootCmd.PersistentFlags().Lookup("namespace"))
+	viper.BindPFlag("context", gatewayRootCmd.PersistentFlags().Lookup("context"))
+}
+
+// main is the entry point of kube-gateway
+func main() {
+	k8s.AddVerbosityFlag(gatewayRootCmd)
+	k8s.AddRateLimitFlags(gatewayRootCmd)
+	k8s.AddFromDirFlag(gatewayRootCmd)
+	config.SetupDefaults(gatewayRootCmd)
+	clierr.SetupUsage(gatewayRootCmd)
+	cmd, err := gatewayRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	leasesNamespace     string
+	leasesKubeContext   string
+	leasesAllNamespaces bool
+	leasesControllers   bool
+	leasesStale         bool
+	leasesTable         table.Options
+)
+
+// nodeLeaseNamespace holds one heartbeat lease per node, left out of -A
+const nodeLeaseNamespace = "kube-node-lease"
+
+// knownLeases maps the lease names of control plane components and common
+// operators to the controller holding them. The namespace depends on how
+// they are installed, so only the name is matched.
+var knownLeases = map[string]string{
+	"kube-scheduler":                          "kube-scheduler",
+	"kube-controller-manager":                 "kube-controller-manager",
+	"cloud-controller-manager":                "cloud-controller-manager",
+	"cluster-autoscaler":                      "cluster-autoscaler",
+	"karpenter-leader-election":               "karpenter",
+	"cert-manager-controller":                 "cert-manager",
+	"cert-manager-cainjector-leader-election": "cert-manager-cainjector",
+	"ingress-nginx-leader":                    "ingress-nginx",
+	"ingress-controller-leader":               "ingress-nginx",
+	"aws-load-balancer-controller-leader":     "aws-load-balancer-controller",
+	"external-secrets-controller":             "external-secrets",
+	"operator.keda.sh":                        "keda",
+	"istio-leader":                            "istiod",
+	"istio-namespace-controller-election":     "istiod",
+	"source-controller-leader-election":       "flux source-controller",
+	"kustomize-controller-leader-election":    "flux kustomize-controller",
+	"helm-controller-leader-election":         "flux helm-controller",
+	"notification-controller-leader-election": "flux notification-controller",
+}
+
+// leasesRootCmd represents the kube-leases command
+var leasesRootCmd = &cobra.Command{
+	Use:   "kube-leases [name...]",
+	Short: "Show leader election leases and who holds them",
+	Long: `kube-leases lists the coordination.k8s.io Leases of the current namespace (or
+all with -A) with their holder, when the holder renewed them last and how
+long the lease lasts: a quick answer to "which replica is the leader".
+
+HOLDER is the holder identity without the random suffix many leader
+election libraries append, which usually leaves the pod name or host name.
+STATE is:
+  held      the holder renewed the lease within its duration
+  expired   the last renewal is older than the lease duration: the leader
+            stopped renewing and no other replica took over (yet)
+  released  nobody holds the lease
+
+With --controllers the leases of kube-scheduler, kube-controller-manager,
+cloud-controller-manager and common operators (cluster-autoscaler,
+Karpenter, cert-manager, ingress-nginx, AWS Load Balancer Controller,
+External Secrets, KEDA, Istio, Flux) are looked up in every namespace.
+
+The heartbeat leases of kube-node-lease, one per node, are left out of -A;
+use -n kube-node-lease to see them.
+
+Examples:
+  kube-leases                                  # Leases of the current namespace
+  kube-leases --controllers                    # Who leads the control plane and operators
+  kube-leases -n kube-system kube-scheduler    # One lease
+  kube-leases -A --stale                       # Leases whose holder stopped renewing
+  kube-leases -n kube-node-lease --stale       # Nodes that stopped sending heartbeats`,
+	RunE: runLeases,
+}
+
+// runLeases lists the leases with their holders
+func runLeases(cmd *cobra.Command, args []string) error {
+	if err := leasesTable.Validate(); err != nil {
+		return err
+	}
+	if leasesControllers && len(args) > 0 {
+		return clierr.Usagef("lease names cannot be combined with --controllers")
+	}
+
+	client, err := k8s.NewClient("", leasesKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	namespace := leasesNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(leasesKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	allNamespaces := leasesAllNamespaces || leasesControllers
+	if allNamespaces {
+		namespace = ""
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	list, err := client.Clientset.CoordinationV1().Leases(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list leases: %w", err)
+	}
+
+	names := map[string]bool{}
+	for _, name := range args {
+		names[name] = true
+	}
+	now := time.Now()
+	leases := make([]coordinationv1.Lease, 0, len(list.Items))
+	for _, lease := range list.Items {
+		switch {
+		case allNamespaces && lease.Namespace == nodeLeaseNamespace:
+			continue
+		case leasesControllers && knownLeases[lease.Name] == "":
+			continue
+		case len(names) > 0 && !names[lease.Name]:
+			continue
+		case leasesStale && leaseState(&lease, now) != stateExpired:
+			continue
+		}
+		leases = append(leases, lease)
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		if leases[i].Namespace != leases[j].Namespace {
+			return leases[i].Namespace < leases[j].Namespace
+		}
+		return leases[i].Name < leases[j].Name
+	})
+
+	if len(leases) == 0 && leasesTable.Output == "table" && !leasesTable.Quiet {
+		switch {
+		case leasesControllers:
+			fmt.Fprintln(os.Stderr, "No leases of known controllers found")
+		case leasesStale:
+			fmt.Fprintln(os.Stderr, "No expired leases found")
+		default:
+			fmt.Fprintln(os.Stderr, "No leases found")
+		}
+		return nil
+	}
+
+	headers := []string{"NAME", "HOLDER", "STATE", "RENEWED", "DURATION", "TRANSITIONS", "AGE"}
+	if leasesControllers {
+		headers = append([]string{"NAME", "CONTROLLER"}, headers[1:]...)
+	}
+	if allNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+
+	rows := make([][]string, 0, len(leases))
+	for _, lease := range leases {
+		state := leaseState(&lease, now)
+		row := []string{lease.Name}
+		if leasesControllers {
+			row = append(row, knownLeases[lease.Name])
+		}
+		row = append(row,
+			utils.OrDash(holderName(&lease)),
+			colorState(state),
+			formatRenewed(&lease, state, now),
+			formatDuration(lease.Spec.LeaseDurationSeconds),
+			formatTransitions(lease.Spec.LeaseTransitions),
+			utils.FormatAge(now.Sub(lease.CreationTimestamp.Time)),
+		)
+		if allNamespaces {
+			row = append([]string{lease.Namespace}, row...)
+		}
+		rows = append(rows, row)
+	}
+
+	nameColumn := 0
+	if allNamespaces {
+		nameColumn = 1
+	}
+	leasesTable.Print(headers, rows, nameColumn)
+	return nil
+}
+
+// Lease states
+const (
+	stateHeld     = "held"
+	stateExpired  = "expired"
+	stateReleased = "released"
+)
+
+// leaseState tells whether the holder still renews the lease. A lease
+// without a duration or renew time counts as held, there is nothing to
+// compare against.
+func leaseState(lease *coordinationv1.Lease, now time.Time) string {
+	if holderName(lease) == "" {
+		return stateReleased
+	}
+	renewed := lastRenewed(lease)
+	if lease.Spec.LeaseDurationSeconds == nil || renewed.IsZero() {
+		return stateHeld
+	}
+	if now.Sub(renewed) > time.Duration(*lease.Spec.LeaseDurationSeconds)*time.Second {
+		return stateExpired
+	}
+	return stateHeld
+}
+
+// lastRenewed returns the renew time, or the acquire time for a lease that
+// was not renewed yet
+func lastRenewed(lease *coordinationv1.Lease) time.Time {
+	if lease.Spec.RenewTime != nil {
+		return lease.Spec.RenewTime.Time
+	}
+	if lease.Spec.AcquireTime != nil {
+		return lease.Spec.AcquireTime.Time
+	}
+	return time.Time{}
+}
+
+// holderName returns the holder identity without the suffix client-go
+// leader election and controller-runtime append to the host name, e.g.
+// kube-scheduler-cp-1_1f0e2c3a-... -> kube-scheduler-cp-1
+func holderName(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	holder, _, _ := strings.Cut(*lease.Spec.HolderIdentity, "_")
+	return holder
+}
+
+// formatRenewed shows how long ago the lease was renewed, red when expired
+func formatRenewed(lease *coordinationv1.Lease, state string, now time.Time) string {
+	renewed := lastRenewed(lease)
+	if renewed.IsZero() {
+		return "-"
+	}
+	// Renewals by a node whose clock is ahead would show as negative
+	text := utils.FormatAge(max(now.Sub(renewed), 0)) + " ago"
+	if state == stateExpired {
+		return "\033[31m" + text + "\033[0m"
+	}
+	return text
+}
+
+// formatDuration shows the lease duration in seconds
+func formatDuration(seconds *int32) string {
+	if seconds == nil {
+		return "-"
+	}
+	return (time.Duration(*seconds) * time.Second).String()
+}
+
+// formatTransitions shows how often the lease changed hands
+func formatTransitions(transitions *int32) string {
+	if transitions == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d", *transitions)
+}
+
+// colorState colors held green, expired red and released gray
+func colorState(state string) string {
+	const (
+		reset = "\033[0m"
+		green = "\033[32m"
+		red   = "\033[31m"
+		gray  = "\033[90m"
+	)
+	switch state {
+	case stateHeld:
+		return green + state + reset
+	case stateExpired:
+		return red + state + reset
+	default:
+		return gray + state + reset
+	}
+}
+
+// init initializes flags for kube-leases command
+func init() {
+	leasesRootCmd.Flags().StringVarP(&leasesNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	leasesRootCmd.Flags().StringVarP(&leasesKubeContext, "context", "c", "", "Kubernetes context to use")
+	leasesRootCmd.Flags().BoolVarP(&leasesAllNamespaces, "all-namespaces", "A", false, "Show leases from all namespaces (except kube-node-lease)")
+	leasesRootCmd.Flags().BoolVar(&leasesControllers, "controllers", false, "Only the leases of the control plane and common operators, in any namespace")
+	leasesRootCmd.Flags().BoolVar(&leasesStale, "stale", false, "Only leases whose holder stopped renewing them")
+	leasesTable.AddFlags(leasesRootCmd)
+
+	viper.BindPFlag("namespace", leasesRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", leasesRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-leases
+func main() {
+	k8s.AddVerbosityFlag(leasesRootCmd)
+	k8s.AddRateLimitFlags(leasesRootCmd)
+	k8s.AddFromDirFlag(leasesRootCmd)
+	config.SetupDefaults(leasesRootCmd)
+	clierr.SetupUsage(leasesRootCmd)
+	cmd, err := leasesRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
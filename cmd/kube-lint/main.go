@@ -0,0 +1,526 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	lintNamespace   string
+	lintKubeContext string
+	lintOffline     bool
+	lintRules       []string
+	lintFailOn      string
+	lintTable       table.Options
+)
+
+// Severities from most to least important; off disables a rule
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityInfo    = "info"
+	severityOff     = "off"
+)
+
+// severityRank orders severities for --fail-on
+var severityRank = map[string]int{severityError: 3, severityWarning: 2, severityInfo: 1, severityOff: 0}
+
+// lintRule is a check and its default severity
+type lintRule struct {
+	name     string
+	severity string
+}
+
+// rules are all checks of kube-lint, described in the help text
+var rules = []lintRule{
+	{"schema", severityError},
+	{"missing-probes", severityWarning},
+	{"latest-tag", severityWarning},
+	{"no-requests", severityWarning},
+	{"privileged", severityError},
+}
+
+// finding is one problem of a manifest
+type finding struct {
+	File      string `json:"file"`
+	Document  int    `json:"document"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Container string `json:"container,omitempty"`
+	Rule      string `json:"rule"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+}
+
+// report is the JSON output of kube-lint
+type report struct {
+	Files    int            `json:"files"`
+	Objects  int            `json:"objects"`
+	Findings []finding      `json:"findings"`
+	Summary  map[string]int `json:"summary"`
+}
+
+// manifest is one object read from a file
+type manifest struct {
+	file     string
+	document int
+	obj      *unstructured.Unstructured
+}
+
+// lintRootCmd represents the kube-lint command
+var lintRootCmd = &cobra.Command{
+	Use:   "kube-lint <file|dir|->...",
+	Short: "Validate manifests against the cluster and best practices",
+	Long: `kube-lint checks local manifests before they are applied. Directories are
+searched for .yaml, .yml and .json files; - reads stdin. Multi-document files
+and List objects are supported.
+
+Every object is sent to the cluster as a server-side apply dry-run with strict
+field validation, so the API server checks it against its OpenAPI schema and
+admission: unknown or misspelled fields, wrong types and invalid values are
+reported without changing anything. --offline skips this step.
+
+Pod templates of Pods, Deployments, StatefulSets, DaemonSets, ReplicaSets,
+Jobs and CronJobs are also checked by these rules:
+
+  schema           error    rejected by the API server in the dry-run
+  missing-probes   warning  long-running container without readiness or liveness probe
+  latest-tag       warning  image without tag or with the latest tag
+  no-requests      warning  container without CPU or memory request
+  privileged       error    container runs privileged
+
+Change the severity of a rule with --rule <name>=<error|warning|info|off>. The
+command exits with 1 when a finding reaches the --fail-on severity.
+
+Examples:
+  kube-lint deploy/                              # All manifests of a directory
+  helm template shop ./chart | kube-lint -       # Rendered chart from stdin
+  kube-lint app.yaml --rule latest-tag=error --rule missing-probes=off
+  kube-lint k8s/ --offline --fail-on warning     # Without a cluster, strict
+  kube-lint k8s/ -o json > lint-report.json      # Report for CI`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runLint,
+}
+
+// runLint reads the manifests and reports the findings of every rule
+func runLint(cmd *cobra.Command, args []string) error {
+	if err := lintTable.Validate(); err != nil {
+		return err
+	}
+	severities, err := ruleSeverities()
+	if err != nil {
+		return err
+	}
+	if _, ok := severityRank[lintFailOn]; !ok || lintFailOn == severityOff {
+		return clierr.Usagef("unsupported --fail-on %q (use error, warning or info)", lintFailOn)
+	}
+
+	manifests, files, err := readManifests(args)
+	if err != nil {
+		return err
+	}
+
+	var findings []finding
+	add := func(m manifest, container, rule, message string) {
+		if severities[rule] == severityOff {
+			return
+		}
+		findings = append(findings, finding{
+			File:      m.file,
+			Document:  m.document,
+			Kind:      m.obj.GetKind(),
+			Namespace: m.obj.GetNamespace(),
+			Name:      m.obj.GetName(),
+			Container: container,
+			Rule:      rule,
+			Severity:  severities[rule],
+			Message:   message,
+		})
+	}
+
+	if !lintOffline && severities["schema"] != severityOff {
+		if err := dryRun(manifests, add); err != nil {
+			return err
+		}
+	}
+	for _, m := range manifests {
+		checkPodTemplate(m, add)
+	}
+
+	summary := map[string]int{}
+	failed := 0
+	for _, f := range findings {
+		summary[f.Severity]++
+		if severityRank[f.Severity] >= severityRank[lintFailOn] {
+			failed++
+		}
+	}
+
+	if lintTable.Output == "json" {
+		if findings == nil {
+			findings = []finding{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		// File names like <stdin> stay readable
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(report{Files: files, Objects: len(manifests), Findings: findings, Summary: summary}); err != nil {
+			return err
+		}
+	} else if len(findings) == 0 {
+		fmt.Printf("No problems found in %d object(s) of %d file(s)\n", len(manifests), files)
+	} else {
+		printFindings(findings)
+	}
+
+	if failed > 0 {
+		return clierr.Newf(clierr.Generic, "found %d problem(s) at or above %s", failed, lintFailOn)
+	}
+	return nil
+}
+
+// ruleSeverities returns the severity of every rule after --rule overrides
+func ruleSeverities() (map[string]string, error) {
+	severities := map[string]string{}
+	for _, r := range rules {
+		severities[r.name] = r.severity
+	}
+	for _, override := range lintRules {
+		name, severity, ok := strings.Cut(override, "=")
+		if !ok {
+			return nil, clierr.Usagef("invalid --rule %q (use <name>=<severity>)", override)
+		}
+		if _, known := severities[name]; !known {
+			names := make([]string, 0, len(rules))
+			for _, r := range rules {
+				names = append(names, r.name)
+			}
+			return nil, clierr.Usagef("unknown rule %q (use %s)", name, strings.Join(names, ", "))
+		}
+		if _, known := severityRank[severity]; !known {
+			return nil, clierr.Usagef("unsupported severity %q for rule %s (use error, warning, info or off)", severity, name)
+		}
+		severities[name] = severity
+	}
+	return severities, nil
+}
+
+// readManifests decodes every object of the given files and directories and
+// returns them with the number of files read
+func readManifests(paths []string) ([]manifest, int, error) {
+	var manifests []manifest
+	files := 0
+	read := func(name string, r io.Reader) error {
+		files++
+		decoder := yamlutil.NewYAMLOrJSONDecoder(r, 4096)
+		for document := 1; ; document++ {
+			var obj map[string]interface{}
+			err := decoder.Decode(&obj)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return clierr.Usagef("%s: document %d: %v", name, document, err)
+			}
+			// Empty documents between separators
+			if len(obj) == 0 {
+				continue
+			}
+			u := &unstructured.Unstructured{Object: obj}
+			if u.IsList() {
+				list, err := u.ToList()
+				if err != nil {
+					return clierr.Usagef("%s: document %d: %v", name, document, err)
+				}
+				for i := range list.Items {
+					manifests = append(manifests, manifest{file: name, document: document, obj: &list.Items[i]})
+				}
+				continue
+			}
+			manifests = append(manifests, manifest{file: name, document: document, obj: u})
+		}
+	}
+
+	for _, path := range paths {
+		if path == "-" {
+			if err := read("<stdin>", os.Stdin); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			// Files named explicitly are read whatever their extension
+			switch strings.ToLower(filepath.Ext(file)) {
+			case ".yaml", ".yml", ".json":
+			default:
+				if file != path {
+					return nil
+				}
+			}
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return read(file, f)
+		})
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, 0, clierr.Newf(clierr.NotFound, "%s does not exist", path)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return manifests, files, nil
+}
+
+// dryRun sends every object as a server-side apply dry-run with strict field
+// validation and reports what the API server rejects
+func dryRun(manifests []manifest, add func(manifest, string, string, string)) error {
+	client, err := k8s.NewClient("", lintKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	namespace := lintNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(lintKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	dyn, err := client.Dynamic()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	for _, m := range manifests {
+		gvk := m.obj.GroupVersionKind()
+		if gvk.Kind == "" || gvk.Version == "" {
+			add(m, "", "schema", "apiVersion and kind are required")
+			continue
+		}
+		if m.obj.GetName() == "" {
+			// generateName objects cannot be applied, only created
+			add(m, "", "schema", "metadata.name is required for a dry-run")
+			continue
+		}
+		mapping, err := client.ResolveKind(gvk)
+		if meta.IsNoMatchError(err) {
+			add(m, "", "schema", fmt.Sprintf("%s is not served by the cluster", gvk.GroupVersion().WithKind(gvk.Kind)))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var resource dynamic.ResourceInterface = dyn.Resource(mapping.Resource)
+		if mapping.Namespaced {
+			ns := m.obj.GetNamespace()
+			if ns == "" {
+				ns = namespace
+			}
+			resource = dyn.Resource(mapping.Resource).Namespace(ns)
+		}
+		data, err := json.Marshal(m.obj.Object)
+		if err != nil {
+			return err
+		}
+		force := true
+		_, err = resource.Patch(ctx, m.obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+			DryRun:          []string{metav1.DryRunAll},
+			FieldManager:    "kube-lint",
+			Force:           &force,
+			FieldValidation: "Strict",
+		})
+		if err == nil {
+			continue
+		}
+		// Only answers of the API server are findings, connection errors stop the run
+		var status apierrors.APIStatus
+		if !errors.As(err, &status) {
+			return fmt.Errorf("dry-run of %s %s failed: %w", m.obj.GetKind(), m.obj.GetName(), err)
+		}
+		add(m, "", "schema", status.Status().Message)
+	}
+	return nil
+}
+
+// checkPodTemplate runs the container rules on the pod template of workloads
+func checkPodTemplate(m manifest, add func(manifest, string, string, string)) {
+	var path []string
+	longRunning := true
+	switch m.obj.GetKind() {
+	case "Pod":
+		path = []string{"spec"}
+		policy, _, _ := unstructured.NestedString(m.obj.Object, "spec", "restartPolicy")
+		longRunning = policy == "" || policy == string(corev1.RestartPolicyAlways)
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet":
+		path = []string{"spec", "template", "spec"}
+	case "Job":
+		path = []string{"spec", "template", "spec"}
+		longRunning = false
+	case "CronJob":
+		path = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+		longRunning = false
+	default:
+		return
+	}
+	raw, found, err := unstructured.NestedMap(m.obj.Object, path...)
+	if !found || err != nil {
+		return
+	}
+	var spec corev1.PodSpec
+	// Malformed specs are reported by the schema rule
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &spec); err != nil {
+		return
+	}
+
+	check := func(c corev1.Container, init bool) {
+		if !init && longRunning && c.ReadinessProbe == nil && c.LivenessProbe == nil {
+			add(m, c.Name, "missing-probes", "no readiness or liveness probe")
+		}
+		if tag, ok := imageTag(c.Image); !ok {
+			add(m, c.Name, "latest-tag", fmt.Sprintf("image %s has no tag and pulls latest", c.Image))
+		} else if tag == "latest" {
+			add(m, c.Name, "latest-tag", fmt.Sprintf("image %s uses the latest tag", c.Image))
+		}
+		var missing []string
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			if _, ok := c.Resources.Requests[name]; !ok {
+				// Requests default to the limits when only those are set
+				if _, ok := c.Resources.Limits[name]; !ok {
+					missing = append(missing, string(name))
+				}
+			}
+		}
+		if len(missing) > 0 {
+			add(m, c.Name, "no-requests", fmt.Sprintf("no %s request", strings.Join(missing, " and ")))
+		}
+		if sc := c.SecurityContext; sc != nil && sc.Privileged != nil && *sc.Privileged {
+			add(m, c.Name, "privileged", "container runs privileged")
+		}
+	}
+	for _, c := range spec.InitContainers {
+		check(c, true)
+	}
+	for _, c := range spec.Containers {
+		check(c, false)
+	}
+}
+
+// imageTag returns the tag of an image reference and whether it has one.
+// Images pinned by digest count as tagged.
+func imageTag(image string) (string, bool) {
+	if image == "" || strings.Contains(image, "@") {
+		return "", true
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	i := strings.LastIndex(name, ":")
+	if i < 0 {
+		return "", false
+	}
+	return name[i+1:], true
+}
+
+// printFindings prints the findings sorted by file, document and severity
+func printFindings(findings []finding) {
+	const (
+		colorReset  = "\033[0m"
+		colorRed    = "\033[31m"
+		colorYellow = "\033[33m"
+	)
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Document != b.Document {
+			return a.Document < b.Document
+		}
+		return severityRank[a.Severity] > severityRank[b.Severity]
+	})
+
+	headers := []string{"FILE", "KIND", "NAME", "CONTAINER", "RULE", "SEVERITY", "MESSAGE"}
+	rows := make([][]string, 0, len(findings))
+	for _, f := range findings {
+		severity := f.Severity
+		switch severity {
+		case severityError:
+			severity = colorRed + severity + colorReset
+		case severityWarning:
+			severity = colorYellow + severity + colorReset
+		}
+		name := f.Name
+		if f.Namespace != "" {
+			name = f.Namespace + "/" + f.Name
+		}
+		rows = append(rows, []string{fmt.Sprintf("%s#%d", f.File, f.Document), f.Kind, name, f.Container, f.Rule, severity, f.Message})
+	}
+	lintTable.Print(headers, rows, 2)
+}
+
+// init initializes flags for kube-lint command
+func init() {
+	lintRootCmd.Flags().StringVarP(&lintNamespace, "namespace", "n", "", "Namespace for objects without one in the dry-run")
+	lintRootCmd.Flags().StringVarP(&lintKubeContext, "context", "c", "", "Kubernetes context to validate against")
+	lintRootCmd.Flags().BoolVar(&lintOffline, "offline", false, "Skip the server-side dry-run, only run the local rules")
+	lintRootCmd.Flags().StringArrayVar(&lintRules, "rule", nil, "Set the severity of a rule, e.g. latest-tag=error or missing-probes=off (repeatable)")
+	lintRootCmd.Flags().StringVar(&lintFailOn, "fail-on", severityError, "Exit with 1 when a finding has at least this severity: error, warning or info")
+	lintTable.AddFlags(lintRootCmd, "json")
+
+	viper.BindPFlag("namespace", lintRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", lintRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-lint
+func main() {
+	k8s.AddVerbosityFlag(lintRootCmd)
+	k8s.AddRateLimitFlags(lintRootCmd)
+	config.SetupDefaults(lintRootCmd)
+	clierr.SetupUsage(lintRootCmd)
+	cmd, err := lintRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
@@ -3,17 +3,36 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/target"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/logpush"
+	"kube/pkg/shared/state"
+	"kube/pkg/shared/tracing"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
 )
 
 var (
@@ -24,6 +43,28 @@ var (
 	logsSinceSeconds  int64
 	logsContainerName string
 	logsTimestamps    bool
+	logsPush          []string
+	logsLimitBytes    int64
+	logsMaxLines      int
+	logsBufferLines   int
+	logsMarkers       bool
+	logsSample        string
+	logsRateLimit     string
+	logsRetry         int
+	logsAll           bool
+)
+
+// dropGracePeriod is how long a full buffer may block reading before lines are dropped
+const dropGracePeriod = 250 * time.Millisecond
+
+// markerDrainPeriod is how long to wait for lifecycle markers after the log
+// stream ended, since a crash ends the stream before the status update arrives
+const markerDrainPeriod = 2 * time.Second
+
+// Delays between attempts to reconnect a dropped log stream
+const (
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = 30 * time.Second
 )
 
 // logsRootCmd represents the kube-logs command
@@ -32,25 +73,159 @@ var logsRootCmd = &cobra.Command{
 	Short: "Show pod logs",
 	Long: `kube-logs shows logs for a specific pod.
 
+If no pod has the exact name, a unique pod whose name starts with (or contains)
+the given name is used; when several match, a picker is shown.
+
+A workload picks its newest ready pod, so there is no need to look up the
+pod name first: deploy/backend, sts/db, ds/agent, rs/<name> or job/migrate.
+Target expressions pick a ready pod of a workload or selector:
+  @latest:deploy/<name>    newest ready pod (also sts/, ds/, rs/, job/, svc/)
+  @random:-l <selector>    random ready pod matching the label selector
+
+A namespace in the target replaces -n: my-ns/my-pod, svc/my-ns/my-svc
+(a pod backing the service), deploy/my-ns/api or @latest:deploy/my-ns/api.
+
+- is the pod (and container) last used by kube-logs, kube-exec or
+kube-port-forward, in the context it was used in.
+
+With --all, the logs of every started pod of a workload or service target are
+shown together, each line prefixed with the pod name. 'kube-logs session'
+does the same for named sets of services defined in the config file.
+
 Features:
 - Follow logs in real-time (-f)
 - Show last N lines (-t, --tail)
 - Show logs since seconds ago (--since)
 - Select a specific container (-c, --container)
 - Include timestamps (--timestamps)
+- Ship lines to a log backend while printing them (--push)
+- Stop after a byte or line budget (--limit-bytes, --max-lines)
+
+While following, the pod is watched and lifecycle markers are printed inline
+where they happen: container restarts with the last exit reason (e.g.
+OOMKilled), termination, readiness changes, deletion and a pod of the same
+name recreated on another node. Disable them with --markers=false.
+
+When a followed stream drops (API server restart, container restart, network
+blip), it is reopened from the timestamp of the last line, without repeating
+lines, and a "log stream reconnected" marker shows the gap. kube-logs only
+exits when the pod is gone or the container will not log anymore, or after
+--retry failed attempts in a row (--retry 0 exits when the stream drops).
+When the cluster rejects the credentials, e.g. after an SSO token expired, the
+credential plugin is run again, and if that is not enough kube-logs asks to
+log in (in another terminal) and press Enter before resuming.
+
+A firehose can be thinned out on the terminal: --sample 1/10 shows a random
+tenth of the lines, --rate-limit 100/s shows at most 100 lines per second (in
+bursts of up to 100). Skipped lines are counted and reported on stderr; --push
+backends still receive every line.
+
+Lines are read into a bounded buffer (--buffer-lines). When the terminal cannot
+keep up with a very chatty pod, new lines are dropped instead of growing memory,
+and the number of dropped lines is reported on stderr.
+
+Push targets (repeatable), lines are labeled with namespace, pod and container:
+  loki=<url>      Loki push API, e.g. loki=http://loki:3100
+  elastic=<url>   Elasticsearch bulk API, url includes the index
+  http=<url>      Any endpoint accepting newline-delimited JSON
 
 Examples:
   kube-logs my-pod                       # Show logs of a pod
   kube-logs my-pod -f                    # Follow logs in real-time
-  kube-logs my-pod -c container-name     # Logs for a specific container`,
+  kube-logs backend -f                   # Partial name, e.g. backend-7f9c4d5b6-xk2lp
+  kube-logs deploy/backend -f            # Newest ready pod of a deployment
+  kube-logs job/migrate --all            # Every pod of a job, prefixed
+  kube-logs - -f                         # Follow the pod last used again
+  kube-logs my-pod -c container-name     # Logs for a specific container
+  kube-logs my-pod --max-lines 1000      # Stop after 1000 lines
+  kube-logs my-pod --limit-bytes 10485760  # Stop after 10MiB of logs
+  kube-logs my-pod --sample 1/10 --rate-limit 100/s  # Tame a debug-level firehose
+  kube-logs my-pod --push loki=http://loki.monitoring:3100
+  kube-logs session payments-debug       # A named session of the config file`,
 	Args: cobra.ExactArgs(1),
 	RunE: runLogs,
 }
 
+// sessionLogsCmd represents the kube-logs session subcommand
+var sessionLogsCmd = &cobra.Command{
+	Use:   "session [name]",
+	Short: "Follow a named log session of the config file",
+	Long: `session follows the logs of a named session of logs.sessions in the config
+file ($HOME/.kube.yaml or $KUBE_CMD_CONFIG), so a recurring debugging setup
+spanning several services is one command. Without a name, the sessions are
+listed.
+
+A session has sources, each selecting pods by label selector or by workload
+or service target, in its own namespace or the namespace of the session:
+
+  logs:
+    sessions:
+      payments-debug:
+        context: prod           # -c wins
+        namespace: payments     # default of the sources, -n wins
+        tail: 50                # also follow and since (e.g. 15m), flags win
+        sources:
+          - name: api
+            target: deploy/payments-api
+            container: api
+            grep: 'ERROR|WARN|payment_id='
+            color: red
+          - name: ledger
+            selector: app=ledger,tier=backend
+            color: cyan
+          - name: gateway
+            namespace: ingress
+            target: svc/gateway
+            grep: '/payments/'
+
+Every started pod of a source is followed, lines prefixed with the pod name
+(and the container when the source names one) in the color of the source:
+red, green, yellow, blue, magenta, cyan or gray; sources without a color get
+one in turn. grep is a regular expression, non-matching lines are neither
+shown nor pushed. Pods started later are not picked up. Session names are
+case-insensitive.
+
+The flags of kube-logs (--timestamps, --max-lines, --sample, --push...)
+apply to the whole session.
+
+Examples:
+  kube-logs session                      # List the sessions
+  kube-logs session payments-debug       # Follow them all
+  kube-logs session payments-debug -c staging --tail 0`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSession,
+}
+
 // runLogs executes the logic to display logs
 func runLogs(cmd *cobra.Command, args []string) error {
 	podName := args[0]
 
+	// - repeats the pod of the last kube-logs, kube-exec or kube-port-forward
+	if podName == state.Last {
+		last, err := state.LastPod()
+		if err != nil {
+			return err
+		}
+		podName = last.Namespace + "/" + last.Name
+		if logsKubeContext == "" {
+			logsKubeContext = last.Context
+		}
+		if logsContainerName == "" {
+			logsContainerName = last.Container
+		}
+	}
+
+	if logsLimitBytes < 0 || logsMaxLines < 0 {
+		return clierr.Usagef("--limit-bytes and --max-lines must not be negative")
+	}
+	if logsBufferLines < 1 {
+		return clierr.Usagef("--buffer-lines must be at least 1")
+	}
+	throttle, err := newThrottle(logsSample, logsRateLimit)
+	if err != nil {
+		return err
+	}
+
 	client, err := k8s.NewClient("", logsKubeContext)
 	if err != nil {
 		return fmt.Errorf("failed to create kubernetes client: %w", err)
@@ -66,11 +241,21 @@ func runLogs(cmd *cobra.Command, args []string) error {
 		targetNamespace = ns
 	}
 
-	// Get pod information to check containers
-	pod, err := client.Clientset.CoreV1().Pods(targetNamespace).Get(context.Background(), podName, metav1.GetOptions{})
+	// Stop streaming on Ctrl+C so queued lines are still flushed to backends
+	ctx, stop := interrupt.Context(context.Background())
+	defer stop()
+
+	if logsAll {
+		return runLogsAll(ctx, client, targetNamespace, podName, throttle)
+	}
+
+	// Get pod information to check containers, resolving partial names
+	pod, err := target.ResolvePod(ctx, client.Clientset, targetNamespace, podName)
 	if err != nil {
-		return fmt.Errorf("failed to get pod %s: %w", podName, err)
+		return err
 	}
+	podName = pod.Name
+	targetNamespace = pod.Namespace
 
 	// If no container is specified and pod has multiple containers
 	if logsContainerName == "" && len(pod.Spec.Containers) > 1 {
@@ -78,80 +263,1198 @@ func runLogs(cmd *cobra.Command, args []string) error {
 		for i, container := range pod.Spec.Containers {
 			fmt.Printf("  %d. %s\n", i+1, container.Name)
 		}
-		return fmt.Errorf("please specify container with -c flag")
+		return clierr.Usagef("please specify container with -c flag")
 	}
 
 	// Use first container if not specified
 	if logsContainerName == "" {
 		logsContainerName = pod.Spec.Containers[0].Name
 	}
+	state.RememberPod(state.Pod{Context: logsKubeContext, Namespace: targetNamespace, Name: podName, Container: logsContainerName})
 
-	// Set up options for logs
-	logOptions := &corev1.PodLogOptions{
-		Container:  logsContainerName,
-		Follow:     logsFollow,
-		Timestamps: logsTimestamps,
+	reconnect := logsFollow && logsRetry > 0
+	logOptions := newLogOptions(logsContainerName, reconnect)
+
+	// Set up log backends before streaming
+	pushers, err := openPushers()
+	if err != nil {
+		return err
+	}
+	labels := map[string]string{
+		"namespace": targetNamespace,
+		"pod":       podName,
+		"container": logsContainerName,
+		"source":    "kube-logs",
 	}
 
-	if logsTailLines > 0 {
-		logOptions.TailLines = &logsTailLines
+	ctx, span := tracing.Start(ctx, "logs stream", map[string]interface{}{
+		"k8s.namespace.name": targetNamespace,
+		"k8s.pod.name":       podName,
+		"k8s.container.name": logsContainerName,
+		"follow":             logsFollow,
+	})
+
+	// Get logs stream
+	req := client.Clientset.CoreV1().Pods(targetNamespace).GetLogs(podName, logOptions)
+	stream, err := req.Stream(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to get logs stream: %w", err)
+		span.End(err)
+		return err
+	}
+
+	// Read lines into a bounded buffer. When following and output falls
+	// behind, new lines are dropped rather than buffering the stream in memory;
+	// a finite dump applies backpressure instead so no line is lost.
+	lines := make(chan logLine, logsBufferLines)
+	var dropped atomic.Int64
+	var bytesRead int64
+	var readCount int
+	var streamErr error
+	resume := &reconnector{client: client, pod: pod, options: logOptions, backoff: minReconnectBackoff}
+	go func() {
+		defer close(lines)
+		defer func() { stream.Close() }()
+		reader := bufio.NewReader(stream)
+		var reconnected string
+		for logsMaxLines == 0 || readCount < logsMaxLines {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if !reconnect {
+					bytesRead += int64(len(line))
+					if err != io.EOF {
+						streamErr = fmt.Errorf("error reading logs: %w", err)
+					}
+					return
+				}
+				// A partial last line is read again from the new stream
+				next, text, err := resume.reconnect(ctx, err)
+				if next == nil {
+					streamErr = err
+					return
+				}
+				stream.Close()
+				stream, reader, reconnected = next, bufio.NewReader(next), text
+				continue
+			}
+			if reconnect {
+				var ok bool
+				if line, ok = resume.advance(line); !ok {
+					continue
+				}
+				if reconnected != "" {
+					lines <- logLine{text: reconnected, marker: true}
+					reconnected = ""
+				}
+			}
+			bytesRead += int64(len(line))
+			readCount++
+			if !logsFollow {
+				lines <- logLine{text: line}
+				continue
+			}
+			if logsLimitBytes > 0 && bytesRead >= logsLimitBytes {
+				lines <- logLine{text: line}
+				return
+			}
+			select {
+			case lines <- logLine{text: line}:
+				continue
+			default:
+			}
+			// Short bursts (like the initial backlog) get a moment to drain
+			if dropped.Load() == 0 {
+				select {
+				case lines <- logLine{text: line}:
+					continue
+				case <-time.After(dropGracePeriod):
+				}
+			}
+			dropped.Add(1)
+		}
+	}()
+
+	// Lifecycle markers are interleaved with the lines while following
+	var markers <-chan string
+	if logsFollow && logsMarkers {
+		markers = watchLifecycle(ctx, client, pod, logsContainerName)
+	}
+
+	// Display lines, flushing whenever the buffer is drained
+	out := bufio.NewWriterSize(os.Stdout, 64*1024)
+	var lineCount int
+	var totalDropped int64
+	var drain <-chan time.Time
+display:
+	for {
+		var line string
+		select {
+		case marker, ok := <-markers:
+			if !ok {
+				markers = nil
+				if lines == nil {
+					break display
+				}
+				continue
+			}
+			fmt.Fprintln(out, marker)
+			out.Flush()
+			continue
+		case <-drain:
+			break display
+		case l, ok := <-lines:
+			if !ok {
+				limited := (logsMaxLines > 0 && readCount >= logsMaxLines) || (logsLimitBytes > 0 && bytesRead >= logsLimitBytes)
+				if markers == nil || ctx.Err() != nil || limited {
+					break display
+				}
+				lines, drain = nil, time.After(markerDrainPeriod)
+				continue
+			}
+			if l.marker {
+				fmt.Fprintln(out, l.text)
+				out.Flush()
+				continue
+			}
+			line = l.text
+		}
+
+		if n := dropped.Swap(0); n > 0 {
+			out.Flush()
+			totalDropped += n
+			fmt.Fprintf(os.Stderr, "... %d line(s) dropped, output could not keep up\n", n)
+		}
+
+		lineCount++
+		line = strings.TrimSuffix(line, "\n")
+		// Throttled lines are not displayed but still pushed
+		show, skipped := throttle.allow(time.Now())
+		if skipped > 0 {
+			out.Flush()
+			fmt.Fprintf(os.Stderr, "... %d line(s) skipped, over --rate-limit %s\n", skipped, logsRateLimit)
+		}
+		switch {
+		case !show:
+		case logsContainerName != "" && len(pod.Spec.Containers) > 1:
+			fmt.Fprintf(out, "[%s] %s\n", logsContainerName, line)
+		default:
+			fmt.Fprintln(out, line)
+		}
+		if len(lines) == 0 {
+			out.Flush()
+		}
+
+		for _, pusher := range pushers {
+			pusher.Push(logEntry(line, labels))
+		}
 	}
+	out.Flush()
+	totalDropped += dropped.Swap(0)
+
+	throttle.report(os.Stderr)
+	if totalDropped > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d log line(s) dropped because output could not keep up, increase --buffer-lines\n", totalDropped)
+	}
+	if logsMaxLines > 0 && readCount >= logsMaxLines {
+		fmt.Fprintf(os.Stderr, "Stopped after %d line(s) (--max-lines)\n", readCount)
+	}
+	if logsLimitBytes > 0 && bytesRead >= logsLimitBytes {
+		fmt.Fprintf(os.Stderr, "Stopped after %d bytes (--limit-bytes)\n", bytesRead)
+	}
+
+	span.SetAttr("log.lines", lineCount)
+	span.SetAttr("log.dropped", totalDropped)
+	span.SetAttr("log.sampled_out", throttle.sampledOut)
+	span.SetAttr("log.rate_limited", throttle.rateLimited)
+	span.End(streamErr)
+
+	for _, pusher := range pushers {
+		if err := pusher.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	return streamErr
+}
 
+// newLogOptions returns the options of a log stream of container.
+// Reconnecting needs the timestamps of the lines to resume from, they are
+// removed again unless --timestamps is set.
+func newLogOptions(container string, reconnect bool) *corev1.PodLogOptions {
+	options := &corev1.PodLogOptions{
+		Container:  container,
+		Follow:     logsFollow,
+		Timestamps: logsTimestamps || reconnect,
+	}
+	if logsTailLines > 0 {
+		options.TailLines = &logsTailLines
+	}
 	if logsSinceSeconds > 0 {
-		logOptions.SinceSeconds = &logsSinceSeconds
+		options.SinceSeconds = &logsSinceSeconds
+	}
+	// The limit spans reconnects, so it is enforced while reading then
+	if logsLimitBytes > 0 && !reconnect {
+		options.LimitBytes = &logsLimitBytes
 	}
+	return options
+}
 
-	// Get logs stream
-	req := client.Clientset.CoreV1().Pods(targetNamespace).GetLogs(podName, logOptions)
-	stream, err := req.Stream(context.Background())
+// openPushers sets up the --push log backends
+func openPushers() ([]*logpush.Pusher, error) {
+	var pushers []*logpush.Pusher
+	for _, spec := range logsPush {
+		pusher, err := logpush.New(spec)
+		if err != nil {
+			return nil, err
+		}
+		pushers = append(pushers, pusher)
+	}
+	return pushers, nil
+}
+
+// runLogsAll shows the logs of every started pod of the workload or service
+// ref (--all), each line prefixed with the pod name
+func runLogsAll(ctx context.Context, client *k8s.Client, namespace, ref string, throttle *throttle) error {
+	if ns, name := target.SplitNamespace(ref); ns != "" {
+		namespace, ref = ns, name
+	}
+	selector, err := target.Selector(ctx, client.Clientset, namespace, ref)
+	if err != nil {
+		return err
+	}
+	list, err := client.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
 	if err != nil {
-		return fmt.Errorf("failed to get logs stream: %w", err)
+		return fmt.Errorf("failed to list pods: %w", err)
 	}
-	defer stream.Close()
+	// Pending pods have not logged anything yet
+	var pods []corev1.Pod
+	for _, pod := range list.Items {
+		if pod.Status.Phase != corev1.PodPending {
+			pods = append(pods, pod)
+		}
+	}
+	if len(pods) == 0 {
+		return clierr.Newf(clierr.NotFound, "no started pods of %s in namespace %s", ref, namespace)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
 
-	// Read and display logs
+	if logsContainerName == "" && len(pods[0].Spec.Containers) > 1 {
+		fmt.Println("Pods have multiple containers:")
+		for i, container := range pods[0].Spec.Containers {
+			fmt.Printf("  %d. %s\n", i+1, container.Name)
+		}
+		return clierr.Usagef("please specify container with -c flag")
+	}
+	fmt.Fprintf(os.Stderr, "Showing logs of %d pod(s) of %s\n", len(pods), ref)
+
+	streams := make([]*logStream, 0, len(pods))
+	for i := range pods {
+		container := logsContainerName
+		if container == "" {
+			container = pods[i].Spec.Containers[0].Name
+		}
+		streams = append(streams, newLogStream(&pods[i], container))
+	}
+	return followStreams(ctx, client, streams, throttle, map[string]interface{}{
+		"k8s.namespace.name": namespace,
+		"workload":           ref,
+		"pods":               len(pods),
+		"follow":             logsFollow,
+	})
+}
+
+// logStream is the log of one container followed with --all or in a
+// session, and how its lines are shown
+type logStream struct {
+	pod       *corev1.Pod
+	container string
+	// prefix is shown before each line; only lines matching grep are kept
+	prefix string
+	grep   *regexp.Regexp
+	labels map[string]string
+}
+
+// newLogStream returns the stream of a container prefixed with the pod name
+func newLogStream(pod *corev1.Pod, container string) *logStream {
+	return &logStream{
+		pod:       pod,
+		container: container,
+		prefix:    "[" + pod.Name + "]",
+		labels: map[string]string{
+			"namespace": pod.Namespace,
+			"pod":       pod.Name,
+			"container": container,
+			"source":    "kube-logs",
+		},
+	}
+}
+
+// followStreams shows the lines of several streams together, each with its
+// prefix. Dropped streams are reopened like the stream of a single pod;
+// lifecycle markers are left out.
+func followStreams(ctx context.Context, client *k8s.Client, streams []*logStream, throttle *throttle, attrs map[string]interface{}) error {
+	pushers, err := openPushers()
+	if err != nil {
+		return err
+	}
+
+	ctx, span := tracing.Start(ctx, "logs stream", attrs)
+	// Reaching --max-lines or --limit-bytes stops the other streams
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	reconnect := logsFollow && logsRetry > 0
+	lines := make(chan logLine, logsBufferLines)
+	var dropped atomic.Int64
+	var wg sync.WaitGroup
+	errs := make([]error, len(streams))
+	for i, s := range streams {
+		wg.Add(1)
+		go func(i int, s *logStream) {
+			defer wg.Done()
+			errs[i] = readPodLogs(ctx, client, i, s.pod, newLogOptions(s.container, reconnect), reconnect, lines, &dropped)
+		}(i, s)
+	}
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	out := bufio.NewWriterSize(os.Stdout, 64*1024)
+	var lineCount int
+	var byteCount, totalDropped int64
+	for l := range lines {
+		if n := dropped.Swap(0); n > 0 {
+			out.Flush()
+			totalDropped += n
+			fmt.Fprintf(os.Stderr, "... %d line(s) dropped, output could not keep up\n", n)
+		}
+		s := streams[l.stream]
+		line := strings.TrimSuffix(l.text, "\n")
+		if l.marker {
+			fmt.Fprintf(out, "%s %s\n", s.prefix, line)
+			out.Flush()
+			continue
+		}
+		if s.grep != nil && !s.grep.MatchString(line) {
+			continue
+		}
+
+		lineCount++
+		byteCount += int64(len(l.text))
+		show, skipped := throttle.allow(time.Now())
+		if skipped > 0 {
+			out.Flush()
+			fmt.Fprintf(os.Stderr, "... %d line(s) skipped, over --rate-limit %s\n", skipped, logsRateLimit)
+		}
+		if show {
+			fmt.Fprintf(out, "%s %s\n", s.prefix, line)
+		}
+		if len(lines) == 0 {
+			out.Flush()
+		}
+		for _, pusher := range pushers {
+			pusher.Push(logEntry(line, s.labels))
+		}
+		if (logsMaxLines > 0 && lineCount >= logsMaxLines) || (logsLimitBytes > 0 && byteCount >= logsLimitBytes) {
+			cancel()
+			break
+		}
+	}
+	out.Flush()
+	totalDropped += dropped.Swap(0)
+
+	throttle.report(os.Stderr)
+	if totalDropped > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d log line(s) dropped because output could not keep up, increase --buffer-lines\n", totalDropped)
+	}
+	if logsMaxLines > 0 && lineCount >= logsMaxLines {
+		fmt.Fprintf(os.Stderr, "Stopped after %d line(s) (--max-lines)\n", lineCount)
+	}
+	if logsLimitBytes > 0 && byteCount >= logsLimitBytes {
+		fmt.Fprintf(os.Stderr, "Stopped after %d bytes (--limit-bytes)\n", byteCount)
+	}
+
+	for _, pusher := range pushers {
+		if err := pusher.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	// Readers stopped by --max-lines or --limit-bytes return no error
+	wg.Wait()
+	err = errors.Join(errs...)
+	span.SetAttr("log.lines", lineCount)
+	span.SetAttr("log.dropped", totalDropped)
+	span.End(err)
+	return err
+}
+
+// readPodLogs sends the lines of the log of pod to lines, tagged with index,
+// reopening the stream when it drops while following. When following, lines
+// are dropped rather than blocking while the output cannot keep up.
+func readPodLogs(ctx context.Context, client *k8s.Client, index int, pod *corev1.Pod, options *corev1.PodLogOptions, reconnect bool, lines chan<- logLine, dropped *atomic.Int64) error {
+	stream, err := client.Clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, options).Stream(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to get logs stream of %s: %w", pod.Name, err)
+	}
+	defer func() { stream.Close() }()
+
+	resume := &reconnector{client: client, pod: pod, options: options, backoff: minReconnectBackoff}
 	reader := bufio.NewReader(stream)
 	for {
 		line, err := reader.ReadString('\n')
 		if err != nil {
-			if err == io.EOF {
-				break
+			switch {
+			case ctx.Err() != nil:
+				return nil
+			case !reconnect && err == io.EOF:
+				return nil
+			case !reconnect:
+				return fmt.Errorf("error reading logs of %s: %w", pod.Name, err)
+			}
+			next, text, err := resume.reconnect(ctx, err)
+			if next == nil {
+				if err != nil {
+					return fmt.Errorf("%s: %w", pod.Name, err)
+				}
+				return nil
+			}
+			stream.Close()
+			stream, reader = next, bufio.NewReader(next)
+			// Markers are never dropped
+			select {
+			case lines <- logLine{stream: index, text: text, marker: true}:
+			case <-ctx.Done():
+				return nil
+			}
+			continue
+		}
+		if reconnect {
+			var ok bool
+			if line, ok = resume.advance(line); !ok {
+				continue
 			}
-			return fmt.Errorf("error reading logs: %w", err)
 		}
 
-		// Process and display line
-		line = strings.TrimSuffix(line, "\n")
-		if logsContainerName != "" && len(pod.Spec.Containers) > 1 {
-			fmt.Printf("[%s] %s\n", logsContainerName, line)
-		} else {
-			fmt.Println(line)
+		l := logLine{stream: index, text: line}
+		if !logsFollow {
+			select {
+			case lines <- l:
+			case <-ctx.Done():
+				return nil
+			}
+			continue
+		}
+		select {
+		case lines <- l:
+			continue
+		default:
+		}
+		// Short bursts (like the initial backlog) get a moment to drain
+		if dropped.Load() == 0 {
+			select {
+			case lines <- l:
+				continue
+			case <-time.After(dropGracePeriod):
+			}
+		}
+		dropped.Add(1)
+	}
+}
+
+// logLine is a line of the log, or an inline marker of the reader. stream
+// is the index of the stream with --all and sessions.
+type logLine struct {
+	stream int
+	text   string
+	marker bool
+}
+
+// reconnector reopens a followed log stream that dropped. It remembers the
+// timestamp of the last line and how many lines had that timestamp, since the
+// API resumes at the start of that second and repeats them.
+type reconnector struct {
+	client  *k8s.Client
+	pod     *corev1.Pod
+	options *corev1.PodLogOptions
+	last    time.Time
+	count   int
+	skip    int
+	backoff time.Duration
+}
+
+// advance removes the timestamp the API added to line, unless --timestamps
+// is set, and reports whether the line is new
+func (r *reconnector) advance(line string) (string, bool) {
+	ts, rest, ok := strings.Cut(line, " ")
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if !ok || err != nil {
+		return line, true
+	}
+	switch {
+	case t.Before(r.last):
+		return "", false
+	case t.Equal(r.last) && r.skip > 0:
+		r.skip--
+		return "", false
+	case t.Equal(r.last):
+		r.count++
+	default:
+		r.last, r.count = t, 1
+	}
+	r.skip = 0
+	r.backoff = minReconnectBackoff
+	if logsTimestamps {
+		return line, true
+	}
+	return rest, true
+}
+
+// reconnect opens a new stream after the previous one ended with cause. It
+// waits while the container is not running, e.g. in CrashLoopBackOff, and
+// returns a nil stream when the container will not log anymore, or with an
+// error after --retry failed attempts in a row. The text is the marker to
+// show before the next new line.
+func (r *reconnector) reconnect(ctx context.Context, cause error) (io.ReadCloser, string, error) {
+	pods := r.client.Clientset.CoreV1().Pods(r.pod.Namespace)
+	dropped := "stream ended"
+	if cause != io.EOF {
+		dropped = cause.Error()
+	}
+	start := time.Now()
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, "", nil
+		case <-time.After(r.backoff):
+		}
+		// Streams that end again without new lines back off as well
+		r.backoff = min(r.backoff*2, maxReconnectBackoff)
+
+		pod, err := pods.Get(ctx, r.pod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, "", nil
+		}
+		if err == nil {
+			alive, running := logState(pod, r.options.Container)
+			if !alive {
+				return nil, "", nil
+			}
+			if !running {
+				continue
+			}
+			options := *r.options
+			if !r.last.IsZero() {
+				since := metav1.NewTime(r.last)
+				options.TailLines, options.SinceSeconds, options.SinceTime = nil, nil, &since
+			}
+			var stream io.ReadCloser
+			if stream, err = pods.GetLogs(r.pod.Name, &options).Stream(ctx); err == nil {
+				r.skip = r.count
+				text := marker(markerYellow, "log stream reconnected after %s (%s)", time.Since(start).Round(time.Second), dropped)
+				return stream, text, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, "", nil
+		}
+		// An expired token is renewed instead of counted as a failed attempt
+		if k8s.IsAuthError(err) {
+			fresh, rerr := r.client.Reauthenticate(ctx)
+			if rerr != nil {
+				if ctx.Err() != nil {
+					return nil, "", nil
+				}
+				return nil, "", fmt.Errorf("log stream lost (%s), failed to re-authenticate: %w", dropped, rerr)
+			}
+			fresh.Context = r.client.Context
+			r.client, r.backoff = fresh, minReconnectBackoff
+			pods = fresh.Clientset.CoreV1().Pods(r.pod.Namespace)
+			continue
+		}
+		failures++
+		if failures >= logsRetry {
+			return nil, "", fmt.Errorf("log stream lost (%s), %d reconnect attempt(s) failed: %w", dropped, failures, err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: reconnecting log stream (attempt %d of %d): %v\n", failures, logsRetry, err)
+	}
+}
+
+// logState reports whether the container may still write log lines, and
+// whether it is running now
+func logState(pod *corev1.Pod, container string) (alive, running bool) {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false, false
+	}
+	status := containerStatus(pod, container)
+	switch {
+	case status == nil:
+		return pod.DeletionTimestamp == nil, false
+	case status.State.Running != nil:
+		return true, true
+	case status.State.Terminated != nil:
+		restarts := pod.Spec.RestartPolicy == corev1.RestartPolicyAlways ||
+			(pod.Spec.RestartPolicy == corev1.RestartPolicyOnFailure && status.State.Terminated.ExitCode != 0)
+		return restarts && pod.DeletionTimestamp == nil, false
+	default:
+		return true, false
+	}
+}
+
+// watchLifecycle watches the pod and sends a marker line for every lifecycle
+// change of the container. The channel is closed when ctx is done or the
+// watch fails; markers are best effort and never fail the log stream.
+func watchLifecycle(ctx context.Context, client *k8s.Client, pod *corev1.Pod, container string) <-chan string {
+	markers := make(chan string, 16)
+	go func() {
+		defer close(markers)
+		prev := pod
+		resourceVersion := pod.ResourceVersion
+		selector := fields.OneTermEqualSelector("metadata.name", pod.Name).String()
+		for ctx.Err() == nil {
+			w, err := client.Clientset.CoreV1().Pods(pod.Namespace).Watch(ctx, metav1.ListOptions{
+				FieldSelector:   selector,
+				ResourceVersion: resourceVersion,
+			})
+			if err != nil {
+				if ctx.Err() == nil {
+					fmt.Fprintf(os.Stderr, "Warning: lifecycle markers stopped: %v\n", err)
+				}
+				return
+			}
+			for event := range w.ResultChan() {
+				if event.Type == watch.Error {
+					w.Stop()
+					if ctx.Err() == nil {
+						fmt.Fprintf(os.Stderr, "Warning: lifecycle markers stopped: %v\n", apierrors.FromObject(event.Object))
+					}
+					return
+				}
+				cur, ok := event.Object.(*corev1.Pod)
+				if !ok {
+					continue
+				}
+				resourceVersion = cur.ResourceVersion
+				var texts []string
+				if event.Type == watch.Deleted {
+					texts = []string{marker(markerRed, "pod %s deleted", cur.Name)}
+				} else {
+					texts = lifecycleMarkers(prev, cur, container)
+				}
+				prev = cur
+				for _, text := range texts {
+					select {
+					case markers <- text:
+					case <-ctx.Done():
+						w.Stop()
+						return
+					}
+				}
+			}
+			w.Stop()
+		}
+	}()
+	return markers
+}
+
+// Marker colors
+const (
+	markerRed    = "\033[31m"
+	markerGreen  = "\033[32m"
+	markerYellow = "\033[33m"
+)
+
+// marker formats an inline lifecycle marker
+func marker(color, format string, args ...interface{}) string {
+	const reset = "\033[0m"
+	return fmt.Sprintf("%s--- %s %s ---%s", color, time.Now().Format("15:04:05"), fmt.Sprintf(format, args...), reset)
+}
+
+// lifecycleMarkers compares two versions of the pod and describes what
+// happened to it and to the container
+func lifecycleMarkers(prev, cur *corev1.Pod, container string) []string {
+	var markers []string
+	if prev.UID != cur.UID {
+		// A pod of the same name (e.g. a StatefulSet replica) was recreated
+		markers = append(markers, marker(markerYellow, "pod %s recreated on node %s (was %s)", cur.Name, orNone(cur.Spec.NodeName), orNone(prev.Spec.NodeName)))
+		prev = &corev1.Pod{}
+	} else if prev.Spec.NodeName == "" && cur.Spec.NodeName != "" {
+		markers = append(markers, marker(markerGreen, "pod scheduled on node %s", cur.Spec.NodeName))
+	}
+	if prev.DeletionTimestamp == nil && cur.DeletionTimestamp != nil {
+		grace := int64(0)
+		if cur.DeletionGracePeriodSeconds != nil {
+			grace = *cur.DeletionGracePeriodSeconds
+		}
+		markers = append(markers, marker(markerYellow, "pod terminating (grace period %ds)", grace))
+	}
+
+	before, after := containerStatus(prev, container), containerStatus(cur, container)
+	if after == nil {
+		return markers
+	}
+	if before == nil {
+		before = &corev1.ContainerStatus{}
+	}
+	switch {
+	case after.RestartCount > before.RestartCount:
+		text := fmt.Sprintf("container %s restarted (restart %d)", container, after.RestartCount)
+		if t := after.LastTerminationState.Terminated; t != nil {
+			text += ", last exit: " + describeExit(t)
+		}
+		markers = append(markers, marker(markerRed, "%s", text))
+	case before.State.Terminated == nil && after.State.Terminated != nil:
+		markers = append(markers, marker(markerRed, "container %s terminated: %s", container, describeExit(after.State.Terminated)))
+	}
+	if before.Ready != after.Ready {
+		if after.Ready {
+			markers = append(markers, marker(markerGreen, "container %s ready", container))
+		} else if after.State.Terminated == nil {
+			markers = append(markers, marker(markerYellow, "container %s became unready", container))
+		}
+	}
+	return markers
+}
+
+// containerStatus returns the status of the named container, or nil
+func containerStatus(pod *corev1.Pod, container string) *corev1.ContainerStatus {
+	for i := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[i].Name == container {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+	return nil
+}
+
+// describeExit describes a terminated container, e.g. "OOMKilled, exit code 137"
+func describeExit(t *corev1.ContainerStateTerminated) string {
+	reason := t.Reason
+	if reason == "" {
+		reason = "exited"
+	}
+	return fmt.Sprintf("%s, exit code %d", reason, t.ExitCode)
+}
+
+// orNone returns s, or <none> when it is empty
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+// throttle decides which lines are displayed: a random sample of keep out of
+// every lines, then a token bucket allowing limit lines per period
+type throttle struct {
+	keep, every   int
+	limit         int
+	period        time.Duration
+	tokens        float64
+	last          time.Time
+	sampledOut    int64
+	rateLimited   int64
+	pendingLimits int64
+	lastReport    time.Time
+}
+
+// skipReportInterval is the minimum time between two notices about lines
+// skipped by --rate-limit, so a steady overload doesn't add a notice per line
+const skipReportInterval = time.Second
+
+// newThrottle parses --sample (<keep>/<every>) and --rate-limit
+// (<lines>/<unit>, e.g. 100/s, 1000/m or 50/10s); empty values disable them
+func newThrottle(sample, rateLimit string) (*throttle, error) {
+	t := &throttle{}
+	if sample != "" {
+		keep, every, ok := parseFraction(sample)
+		if !ok || keep < 1 || every < keep {
+			return nil, clierr.Usagef("invalid --sample %q, expected <keep>/<every> like 1/10", sample)
+		}
+		t.keep, t.every = keep, every
+	}
+	if rateLimit != "" {
+		count, unit, _ := strings.Cut(rateLimit, "/")
+		limit, err := strconv.Atoi(count)
+		if unit != "" && !strings.ContainsAny(unit[:1], "0123456789") {
+			unit = "1" + unit
+		}
+		period, perr := time.ParseDuration(unit)
+		if err != nil || perr != nil || limit < 1 || period <= 0 {
+			return nil, clierr.Usagef("invalid --rate-limit %q, expected <lines>/<unit> like 100/s or 1000/m", rateLimit)
+		}
+		t.limit, t.period, t.tokens = limit, period, float64(limit)
+	}
+	return t, nil
+}
+
+// parseFraction parses <a>/<b> into two integers
+func parseFraction(s string) (int, int, bool) {
+	a, b, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, false
+	}
+	x, err1 := strconv.Atoi(a)
+	y, err2 := strconv.Atoi(b)
+	return x, y, err1 == nil && err2 == nil
+}
+
+// allow reports whether the line read at now is displayed. When it is, the
+// number of lines skipped by the rate limit since the last notice may be
+// returned as well, so the gap can be shown.
+func (t *throttle) allow(now time.Time) (bool, int64) {
+	if t.every > 0 && rand.Intn(t.every) >= t.keep {
+		t.sampledOut++
+		return false, 0
+	}
+	if t.limit == 0 {
+		return true, 0
+	}
+	if !t.last.IsZero() {
+		t.tokens += float64(t.limit) * float64(now.Sub(t.last)) / float64(t.period)
+		if t.tokens > float64(t.limit) {
+			t.tokens = float64(t.limit)
+		}
+	}
+	t.last = now
+	if t.tokens < 1 {
+		t.rateLimited++
+		t.pendingLimits++
+		return false, 0
+	}
+	t.tokens--
+	if t.pendingLimits == 0 || now.Sub(t.lastReport) < skipReportInterval {
+		return true, 0
+	}
+	skipped := t.pendingLimits
+	t.pendingLimits, t.lastReport = 0, now
+	return true, skipped
+}
+
+// report prints how many lines the throttles kept off the terminal
+func (t *throttle) report(w io.Writer) {
+	if t.sampledOut > 0 {
+		fmt.Fprintf(w, "Sampled %d/%d: %d line(s) not shown (--sample)\n", t.keep, t.every, t.sampledOut)
+	}
+	if t.rateLimited > 0 {
+		fmt.Fprintf(w, "Rate limited: %d line(s) not shown (--rate-limit %s)\n", t.rateLimited, logsRateLimit)
+	}
+}
+
+// logEntry builds a push entry, using the line's timestamp when --timestamps is set
+func logEntry(line string, labels map[string]string) logpush.Entry {
+	entry := logpush.Entry{Time: time.Now(), Line: line, Labels: labels}
+	if logsTimestamps {
+		if ts, rest, ok := strings.Cut(line, " "); ok {
+			if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+				entry.Time = t
+				entry.Line = rest
+			}
 		}
 	}
+	return entry
+}
+
+// logSession is a named session of logs.sessions in the config file
+type logSession struct {
+	Context   string      `mapstructure:"context"`
+	Namespace string      `mapstructure:"namespace"`
+	Follow    *bool       `mapstructure:"follow"`
+	Tail      int64       `mapstructure:"tail"`
+	Since     string      `mapstructure:"since"`
+	Sources   []logSource `mapstructure:"sources"`
+}
+
+// logSource selects the pods of a session and how their lines are shown
+type logSource struct {
+	// Name is shown in warnings, the selector or target by default
+	Name      string `mapstructure:"name"`
+	Namespace string `mapstructure:"namespace"`
+	Selector  string `mapstructure:"selector"`
+	Target    string `mapstructure:"target"`
+	Container string `mapstructure:"container"`
+	Grep      string `mapstructure:"grep"`
+	Color     string `mapstructure:"color"`
+}
+
+// sourceColors are the colors of session sources, the order is the one
+// sources without a color get them in
+var sourceColors = []struct{ name, code string }{
+	{"cyan", "\033[36m"},
+	{"magenta", "\033[35m"},
+	{"yellow", "\033[33m"},
+	{"green", "\033[32m"},
+	{"blue", "\033[34m"},
+	{"red", "\033[31m"},
+	{"gray", "\033[90m"},
+}
+
+// runSession follows the logs of a named session, or lists the sessions
+func runSession(cmd *cobra.Command, args []string) error {
+	var sessions map[string]logSession
+	if err := config.UnmarshalKey("logs.sessions", &sessions); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return listSessions(sessions)
+	}
+
+	// Viper lowercases keys, names are matched case-insensitively
+	name := strings.ToLower(args[0])
+	session, ok := sessions[name]
+	if !ok {
+		if viper.ConfigFileUsed() == "" {
+			return clierr.Newf(clierr.NotFound, "no log session %s, no config file found ($HOME/.kube.yaml or $%s)", args[0], config.FileEnv)
+		}
+		return clierr.Newf(clierr.NotFound, "no log session %s in %s, see kube-logs session", args[0], viper.ConfigFileUsed())
+	}
+	if len(session.Sources) == 0 {
+		return clierr.Usagef("log session %s has no sources", name)
+	}
+
+	// Flags on the command line win over the session
+	flags := cmd.Flags()
+	if session.Context != "" && !flags.Changed("context") {
+		logsKubeContext = session.Context
+	}
+	if session.Namespace != "" && !flags.Changed("namespace") {
+		logsNamespace = session.Namespace
+	}
+	if session.Follow != nil && !flags.Changed("follow") {
+		logsFollow = *session.Follow
+	}
+	if session.Tail > 0 && !flags.Changed("tail") {
+		logsTailLines = session.Tail
+	}
+	if session.Since != "" && !flags.Changed("since") {
+		since, err := time.ParseDuration(session.Since)
+		if err != nil || since <= 0 {
+			return clierr.Usagef("invalid since %q of log session %s, expected a duration like 15m", session.Since, name)
+		}
+		logsSinceSeconds = int64(since.Seconds())
+	}
+
+	if logsLimitBytes < 0 || logsMaxLines < 0 {
+		return clierr.Usagef("--limit-bytes and --max-lines must not be negative")
+	}
+	if logsBufferLines < 1 {
+		return clierr.Usagef("--buffer-lines must be at least 1")
+	}
+	throttle, err := newThrottle(logsSample, logsRateLimit)
+	if err != nil {
+		return err
+	}
+
+	client, err := k8s.NewClient("", logsKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	namespace := logsNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(logsKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+
+	ctx, stop := interrupt.Context(context.Background())
+	defer stop()
+
+	var streams []*logStream
+	for i, source := range session.Sources {
+		sourceStreams, err := sessionStreams(ctx, client, name, i, source, namespace)
+		if err != nil {
+			return err
+		}
+		streams = append(streams, sourceStreams...)
+	}
+	if len(streams) == 0 {
+		return clierr.Newf(clierr.NotFound, "no started pods in any source of log session %s", name)
+	}
+	fmt.Fprintf(os.Stderr, "Showing logs of %d container(s) of log session %s\n", len(streams), name)
 
+	return followStreams(ctx, client, streams, throttle, map[string]interface{}{
+		"session": name,
+		"sources": len(session.Sources),
+		"pods":    len(streams),
+		"follow":  logsFollow,
+	})
+}
+
+// sessionStreams returns the streams of the started pods of the i-th source
+// of a session
+func sessionStreams(ctx context.Context, client *k8s.Client, session string, i int, source logSource, namespace string) ([]*logStream, error) {
+	ref := source.Target
+	switch {
+	case source.Target != "" && source.Selector != "":
+		return nil, clierr.Usagef("source %d of log session %s has both a target and a selector", i+1, session)
+	case source.Selector != "":
+		ref = "-l " + source.Selector
+	case source.Target == "":
+		return nil, clierr.Usagef("source %d of log session %s needs a target (deploy/<name>, svc/<name>...) or a selector", i+1, session)
+	}
+	name := source.Name
+	if name == "" {
+		name = strings.TrimPrefix(ref, "-l ")
+	}
+
+	var grep *regexp.Regexp
+	if source.Grep != "" {
+		var err error
+		if grep, err = regexp.Compile(source.Grep); err != nil {
+			return nil, clierr.Usagef("invalid grep of source %s of log session %s: %v", name, session, err)
+		}
+	}
+	color := sourceColors[i%len(sourceColors)].code
+	if source.Color != "" {
+		names := make([]string, 0, len(sourceColors))
+		color = ""
+		for _, c := range sourceColors {
+			names = append(names, c.name)
+			if strings.EqualFold(c.name, source.Color) {
+				color = c.code
+			}
+		}
+		if color == "" {
+			return nil, clierr.Usagef("invalid color %q of source %s of log session %s, expected one of %s", source.Color, name, session, strings.Join(names, ", "))
+		}
+	}
+
+	if source.Namespace != "" {
+		namespace = source.Namespace
+	}
+	if ns, rest := target.SplitNamespace(ref); ns != "" && source.Target != "" {
+		namespace, ref = ns, rest
+	}
+	selector, err := target.Selector(ctx, client.Clientset, namespace, ref)
+	if err != nil {
+		return nil, fmt.Errorf("source %s of log session %s: %w", name, session, err)
+	}
+	list, err := client.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Name < list.Items[j].Name })
+
+	const reset = "\033[0m"
+	var streams []*logStream
+	for j := range list.Items {
+		pod := &list.Items[j]
+		// Pending pods have not logged anything yet
+		if pod.Status.Phase == corev1.PodPending {
+			continue
+		}
+		container, prefix := pod.Spec.Containers[0].Name, "["+pod.Name+"]"
+		if source.Container != "" {
+			if !hasContainer(pod, source.Container) {
+				continue
+			}
+			container, prefix = source.Container, "["+pod.Name+"/"+source.Container+"]"
+		}
+		s := newLogStream(pod, container)
+		s.prefix = color + prefix + reset
+		s.grep = grep
+		s.labels["session"] = session
+		streams = append(streams, s)
+	}
+	if len(streams) == 0 {
+		fmt.Fprintf(os.Stderr, "Warning: no started pods of source %s of log session %s in namespace %s\n", name, session, namespace)
+	}
+	return streams, nil
+}
+
+// hasContainer reports whether the pod has an app or init container of that name
+func hasContainer(pod *corev1.Pod, name string) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// listSessions prints the log sessions of the config file with their sources
+func listSessions(sessions map[string]logSession) error {
+	if len(sessions) == 0 {
+		file := viper.ConfigFileUsed()
+		if file == "" {
+			file = "$HOME/.kube.yaml"
+		}
+		fmt.Fprintf(os.Stderr, "No log sessions in %s, see kube-logs session --help\n", file)
+		return nil
+	}
+	names := make([]string, 0, len(sessions))
+	for name := range sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var sources []string
+		for _, source := range sessions[name].Sources {
+			switch {
+			case source.Name != "":
+				sources = append(sources, source.Name)
+			case source.Target != "":
+				sources = append(sources, source.Target)
+			default:
+				sources = append(sources, source.Selector)
+			}
+		}
+		fmt.Printf("%s: %s\n", name, strings.Join(sources, ", "))
+	}
 	return nil
 }
 
 // init initializes configuration for kube-logs command
 func init() {
 	// Define flags
-	logsRootCmd.Flags().StringVarP(&logsNamespace, "namespace", "n", "", "Kubernetes namespace to use")
-	logsRootCmd.Flags().StringVarP(&logsKubeContext, "context", "c", "", "Kubernetes context to use")
-	logsRootCmd.Flags().BoolVarP(&logsFollow, "follow", "f", true, "Follow logs output (real-time)")
-	logsRootCmd.Flags().Int64VarP(&logsTailLines, "tail", "t", 0, "Number of lines to show from the end of the logs")
-	logsRootCmd.Flags().Int64Var(&logsSinceSeconds, "since", 0, "Show logs since this many seconds ago")
+	logsRootCmd.PersistentFlags().StringVarP(&logsNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	logsRootCmd.PersistentFlags().StringVarP(&logsKubeContext, "context", "c", "", "Kubernetes context to use")
+	logsRootCmd.PersistentFlags().BoolVarP(&logsFollow, "follow", "f", true, "Follow logs output (real-time)")
+	logsRootCmd.PersistentFlags().Int64VarP(&logsTailLines, "tail", "t", 0, "Number of lines to show from the end of the logs")
+	logsRootCmd.PersistentFlags().Int64Var(&logsSinceSeconds, "since", 0, "Show logs since this many seconds ago")
 	logsRootCmd.Flags().StringVar(&logsContainerName, "container", "", "Container name (required if pod has multiple containers)")
-	logsRootCmd.Flags().BoolVar(&logsTimestamps, "timestamps", false, "Include timestamps in output")
+	logsRootCmd.PersistentFlags().BoolVar(&logsTimestamps, "timestamps", false, "Include timestamps in output")
+	logsRootCmd.PersistentFlags().Int64Var(&logsLimitBytes, "limit-bytes", 0, "Stop after this many bytes of logs (0 for no limit)")
+	logsRootCmd.PersistentFlags().IntVar(&logsMaxLines, "max-lines", 0, "Stop after this many lines (0 for no limit)")
+	logsRootCmd.PersistentFlags().IntVar(&logsBufferLines, "buffer-lines", 10000, "Lines buffered before new lines are dropped when output cannot keep up")
+	logsRootCmd.Flags().BoolVar(&logsMarkers, "markers", true, "While following, print restarts, readiness changes and deletion of the pod inline")
+	logsRootCmd.PersistentFlags().StringVar(&logsSample, "sample", "", "Show a random sample of the lines, e.g. 1/10 for one in ten")
+	logsRootCmd.PersistentFlags().IntVar(&logsRetry, "retry", 10, "While following, reconnect a dropped log stream; give up after this many failed attempts in a row (0 exits when the stream drops)")
+	logsRootCmd.PersistentFlags().StringVar(&logsRateLimit, "rate-limit", "", "Show at most this many lines per period, e.g. 100/s or 1000/m (skipped lines are counted)")
+	logsRootCmd.Flags().BoolVar(&logsAll, "all", false, "Show the logs of every pod of a workload target (deploy/<name>, sts/, job/, svc/...) instead of the newest ready one")
+	logsRootCmd.PersistentFlags().StringArrayVar(&logsPush, "push", nil, "Also ship lines to a log backend: loki=<url>, elastic=<url> or http=<url> (repeatable)")
+
+	logsRootCmd.AddCommand(sessionLogsCmd)
 
 	// Bind flags with viper
-	viper.BindPFlag("namespace", logsRootCmd.Flags().Lookup("namespace"))
-	viper.BindPFlag("context", logsRootCmd.Flags().Lookup("context"))
+	viper.BindPFlag("namespace", logsRootCmd.PersistentFlags().Lookup("namespace"))
+	viper.BindPFlag("context", logsRootCmd.PersistentFlags().Lookup("context"))
 }
 
 // main is the entry point of kube-logs
 func main() {
-	if err := logsRootCmd.Execute(); err != nil {
+	k8s.AddVerbosityFlag(logsRootCmd)
+	k8s.AddRateLimitFlags(logsRootCmd)
+	config.SetupDefaults(logsRootCmd, "sessions")
+	clierr.SetupUsage(logsRootCmd)
+	cmd, err := logsRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(clierr.ExitCode(err))
 	}
 }
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/scheduling"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	namespacesKubeContext string
+	namespacesSortBy      string
+	namespacesTable       table.Options
+	namespacesSelector    string
+	namespacesOverwrite   bool
+	namespacesDryRun      bool
+)
+
+// namespacesRootCmd represents the kube-namespaces command
+var namespacesRootCmd = &cobra.Command{
+	Use:   "kube-namespaces",
+	Short: "List namespaces with their resource footprint",
+	Long: `kube-namespaces lists namespaces with status, age and what runs in them:
+
+- Number of active pods and deployments
+- Aggregate CPU and memory requested by active pods
+- The most saturated ResourceQuota entry (used/hard)
+
+Use --sort-by to find the heaviest tenants.
+
+Examples:
+  kube-namespaces                   # Sorted by name
+  kube-namespaces --sort-by cpu     # Highest requested CPU first
+  kube-namespaces --sort-by pods -q # Names only, busiest first
+  kube-namespaces label team-a team-b owner=payments
+  kube-namespaces label -l env=prod pod-security.kubernetes.io/enforce=baseline`,
+	Args: cobra.NoArgs,
+	RunE: runNamespaces,
+}
+
+// labelNamespacesCmd represents the kube-namespaces label subcommand
+var labelNamespacesCmd = &cobra.Command{
+	Use:   "label [namespace...] key=value... [key-...]",
+	Short: "Add, update or remove labels on namespaces",
+	Long: `label changes labels of the given namespaces, or of all namespaces matching
+--selector. key=value sets a label, key- removes it.
+
+Like kubectl, changing the value of an existing label requires --overwrite.
+Use --dry-run to preview a bulk change.
+
+Examples:
+  kube-namespaces label team-a istio-injection=enabled
+  kube-namespaces label -l env=prod pod-security.kubernetes.io/enforce=restricted --overwrite
+  kube-namespaces label team-a istio-injection-`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runMetadataChange("labels", args)
+	},
+}
+
+// annotateNamespacesCmd represents the kube-namespaces annotate subcommand
+var annotateNamespacesCmd = &cobra.Command{
+	Use:   "annotate [namespace...] key=value... [key-...]",
+	Short: "Add, update or remove annotations on namespaces",
+	Long: `annotate changes annotations of the given namespaces, or of all namespaces
+matching --selector. key=value sets an annotation, key- removes it.
+
+Changing the value of an existing annotation requires --overwrite.
+
+Examples:
+  kube-namespaces annotate team-a owner=payments@example.com
+  kube-namespaces annotate -l tier=sandbox cleanup/after=2024-12-31 --dry-run`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runMetadataChange("annotations", args)
+	},
+}
+
+// namespaceUsage is the aggregated footprint of one namespace
+type namespaceUsage struct {
+	pods        int
+	deployments int
+	cpuMilli    int64
+	memoryBytes int64
+	quota       string
+	quotaRatio  float64
+}
+
+// runNamespaces lists namespaces with their resource footprint
+func runNamespaces(cmd *cobra.Command, args []string) error {
+	if err := namespacesTable.Validate(); err != nil {
+		return err
+	}
+
+	switch namespacesSortBy {
+	case "name", "pods", "cpu", "memory":
+	default:
+		return clierr.Usagef("unsupported --sort-by %q (use name, pods, cpu or memory)", namespacesSortBy)
+	}
+
+	client, err := k8s.NewClient("", namespacesKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	namespaces, err := client.Clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	usage, err := collectUsage(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	items := namespaces.Items
+	for _, ns := range items {
+		if usage[ns.Name] == nil {
+			usage[ns.Name] = &namespaceUsage{}
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := usage[items[i].Name], usage[items[j].Name]
+		switch namespacesSortBy {
+		case "pods":
+			if a.pods != b.pods {
+				return a.pods > b.pods
+			}
+		case "cpu":
+			if a.cpuMilli != b.cpuMilli {
+				return a.cpuMilli > b.cpuMilli
+			}
+		case "memory":
+			if a.memoryBytes != b.memoryBytes {
+				return a.memoryBytes > b.memoryBytes
+			}
+		}
+		return items[i].Name < items[j].Name
+	})
+
+	headers := []string{"NAME", "STATUS", "PODS", "DEPLOYMENTS", "CPU REQ", "MEM REQ", "QUOTA", "AGE"}
+	rows := make([][]string, 0, len(items))
+	for _, ns := range items {
+		u := usage[ns.Name]
+		rows = append(rows, []string{
+			ns.Name,
+			colorPhase(string(ns.Status.Phase)),
+			fmt.Sprintf("%d", u.pods),
+			fmt.Sprintf("%d", u.deployments),
+			utils.FormatCPU(u.cpuMilli),
+			utils.FormatBytes(u.memoryBytes),
+			formatQuota(u),
+			utils.FormatAge(time.Since(ns.CreationTimestamp.Time)),
+		})
+	}
+
+	namespacesTable.Print(headers, rows, 0)
+	return nil
+}
+
+// collectUsage aggregates pods, deployments, requests and quota saturation per namespace
+func collectUsage(ctx context.Context, client *k8s.Client) (map[string]*namespaceUsage, error) {
+	usage := map[string]*namespaceUsage{}
+	get := func(ns string) *namespaceUsage {
+		if usage[ns] == nil {
+			usage[ns] = &namespaceUsage{}
+		}
+		return usage[ns]
+	}
+
+	pods, err := client.Clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	for _, pod := range pods.Items {
+		// Completed pods no longer hold their requests
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		u := get(pod.Namespace)
+		u.pods++
+		requests := scheduling.PodRequests(&pod)
+		u.cpuMilli += requests.Cpu().MilliValue()
+		u.memoryBytes += requests.Memory().Value()
+	}
+
+	deployments, err := client.Clientset.AppsV1().Deployments("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, dep := range deployments.Items {
+		get(dep.Namespace).deployments++
+	}
+
+	quotas, err := client.Clientset.CoreV1().ResourceQuotas("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resourcequotas: %w", err)
+	}
+	for _, quota := range quotas.Items {
+		u := get(quota.Namespace)
+		for name, hard := range quota.Status.Hard {
+			used, ok := quota.Status.Used[name]
+			if !ok || hard.IsZero() {
+				continue
+			}
+			ratio := used.AsApproximateFloat64() / hard.AsApproximateFloat64()
+			if ratio >= u.quotaRatio {
+				u.quotaRatio = ratio
+				u.quota = string(name)
+			}
+		}
+	}
+	return usage, nil
+}
+
+// formatQuota renders the most saturated quota entry, colored by saturation
+func formatQuota(u *namespaceUsage) string {
+	if u.quota == "" {
+		return "-"
+	}
+	const (
+		reset  = "\033[0m"
+		yellow = "\033[33m"
+		red    = "\033[31m"
+	)
+	text := fmt.Sprintf("%.0f%% %s", u.quotaRatio*100, u.quota)
+	switch {
+	case u.quotaRatio >= 0.9:
+		return red + text + reset
+	case u.quotaRatio >= 0.75:
+		return yellow + text + reset
+	}
+	return text
+}
+
+// runMetadataChange applies key=value / key- changes to labels or annotations of
+// the selected namespaces with a merge patch. Conflicting values are skipped
+// without --overwrite and reported as a conflict error at the end.
+func runMetadataChange(field string, args []string) error {
+	var names []string
+	set := map[string]string{}
+	var remove []string
+	for _, arg := range args {
+		switch {
+		case strings.Contains(arg, "="):
+			key, value, _ := strings.Cut(arg, "=")
+			if err := validateMetadata(field, key, value); err != nil {
+				return err
+			}
+			set[key] = value
+		case strings.HasSuffix(arg, "-"):
+			key := strings.TrimSuffix(arg, "-")
+			if err := validateMetadata(field, key, ""); err != nil {
+				return err
+			}
+			remove = append(remove, key)
+		default:
+			names = append(names, arg)
+		}
+	}
+
+	if len(set) == 0 && len(remove) == 0 {
+		return clierr.Usagef("no changes given, use key=value or key-")
+	}
+	if (len(names) == 0) == (namespacesSelector == "") {
+		return clierr.Usagef("specify either namespace names or --selector")
+	}
+
+	client, err := k8s.NewClient("", namespacesKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	var namespaces []corev1.Namespace
+	if namespacesSelector != "" {
+		list, err := client.Clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: namespacesSelector})
+		if err != nil {
+			return fmt.Errorf("failed to list namespaces: %w", err)
+		}
+		if len(list.Items) == 0 {
+			return clierr.Newf(clierr.NotFound, "no namespaces match selector %s", namespacesSelector)
+		}
+		namespaces = list.Items
+	} else {
+		for _, name := range names {
+			ns, err := client.Clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to get namespace %s: %w", name, err)
+			}
+			namespaces = append(namespaces, *ns)
+		}
+	}
+
+	verb := "labeled"
+	if field == "annotations" {
+		verb = "annotated"
+	}
+
+	var conflicts []string
+	for i, ns := range namespaces {
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped after %d of %d namespace(s): %w", i, len(namespaces), context.Cause(ctx))
+		}
+		current := ns.Labels
+		if field == "annotations" {
+			current = ns.Annotations
+		}
+
+		changes := map[string]interface{}{}
+		var blocked []string
+		for key, value := range set {
+			old, exists := current[key]
+			switch {
+			case exists && old == value:
+			case exists && !namespacesOverwrite:
+				blocked = append(blocked, fmt.Sprintf("%s=%s", key, old))
+			default:
+				changes[key] = value
+			}
+		}
+		for _, key := range remove {
+			if _, exists := current[key]; exists {
+				changes[key] = nil // null removes the key in a merge patch
+			}
+		}
+
+		if len(blocked) > 0 {
+			sort.Strings(blocked)
+			fmt.Fprintf(os.Stderr, "namespace/%s not %s: already has %s (use --overwrite)\n", ns.Name, verb, strings.Join(blocked, ", "))
+			conflicts = append(conflicts, ns.Name)
+			continue
+		}
+		if len(changes) == 0 {
+			fmt.Printf("namespace/%s unchanged\n", ns.Name)
+			continue
+		}
+		if namespacesDryRun {
+			fmt.Printf("namespace/%s %s (dry run)\n", ns.Name, verb)
+			continue
+		}
+
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{field: changes},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := client.Clientset.CoreV1().Namespaces().Patch(ctx, ns.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("failed to patch namespace %s: %w", ns.Name, err)
+		}
+		fmt.Printf("namespace/%s %s\n", ns.Name, verb)
+	}
+
+	if len(conflicts) > 0 {
+		return clierr.Newf(clierr.Conflict, "%d namespace(s) not changed without --overwrite: %s", len(conflicts), strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// validateMetadata checks a label or annotation key (and label value)
+func validateMetadata(field, key, value string) error {
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return clierr.Usagef("invalid key %q: %s", key, strings.Join(errs, "; "))
+	}
+	if field == "labels" {
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return clierr.Usagef("invalid label value %q: %s", value, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// colorPhase colors the namespace phase
+func colorPhase(phase string) string {
+	const (
+		reset  = "\033[0m"
+		green  = "\033[32m"
+		yellow = "\033[33m"
+	)
+	switch phase {
+	case "Active":
+		return green + phase + reset
+	case "Terminating":
+		return yellow + phase + reset
+	}
+	return phase
+}
+
+// init initializes flags for kube-namespaces command
+func init() {
+	namespacesRootCmd.PersistentFlags().StringVarP(&namespacesKubeContext, "context", "c", "", "Kubernetes context to use")
+	namespacesRootCmd.Flags().StringVar(&namespacesSortBy, "sort-by", "name", "Sort by name, pods, cpu or memory")
+	namespacesTable.AddFlags(namespacesRootCmd)
+
+	for _, cmd := range []*cobra.Command{labelNamespacesCmd, annotateNamespacesCmd} {
+		cmd.Flags().StringVarP(&namespacesSelector, "selector", "l", "", "Change all namespaces matching this label selector")
+		cmd.Flags().BoolVar(&namespacesOverwrite, "overwrite", false, "Allow changing the value of existing keys")
+		cmd.Flags().BoolVar(&namespacesDryRun, "dry-run", false, "Only print which namespaces would change")
+	}
+	namespacesRootCmd.AddCommand(labelNamespacesCmd, annotateNamespacesCmd)
+
+	viper.BindPFlag("context", namespacesRootCmd.PersistentFlags().Lookup("context"))
+}
+
+// main is the entry point of kube-namespaces
+func main() {
+	k8s.AddVerbosityFlag(namespacesRootCmd)
+	k8s.AddRateLimitFlags(namespacesRootCmd)
+	k8s.AddFromDirFlag(namespacesRootCmd)
+	config.SetupDefaults(namespacesRootCmd)
+	clierr.SetupUsage(namespacesRootCmd)
+	cmd, err := namespacesRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
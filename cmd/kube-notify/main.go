@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/tracing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	notifyNamespace     string
+	notifyKubeContext   string
+	notifyAllNamespaces bool
+	notifySelector      string
+	notifyWebhook       string
+	notifyHeaders       []string
+	notifyExec          string
+	notifyOn            []string
+	notifyIgnoreStatus  bool
+	notifyTimeout       time.Duration
+	notifyRetries       int
+)
+
+// listPageSize is the number of objects requested per page of the initial list
+const listPageSize = 500
+
+// Event types
+const (
+	eventAdded    = "added"
+	eventModified = "modified"
+	eventDeleted  = "deleted"
+)
+
+// ignoredPaths change on every write and are left out of diffs
+var ignoredPaths = map[string]bool{
+	"metadata.resourceVersion": true,
+	"metadata.managedFields":   true,
+	"metadata.annotations.kubectl.kubernetes.io/last-applied-configuration": true,
+}
+
+// notifyRootCmd represents the kube-notify command
+var notifyRootCmd = &cobra.Command{
+	Use:   "kube-notify <resource> [name]",
+	Short: "Send change events of a resource to a webhook or command",
+	Long: `kube-notify watches a resource type, optionally one object or the objects
+matching a label selector, and turns every change into a JSON event:
+
+  {
+    "type": "modified",              // added, modified or deleted
+    "time": "2024-06-01T12:00:00Z",
+    "context": "prod",
+    "apiVersion": "apps/v1",
+    "kind": "Deployment",
+    "namespace": "shop",
+    "name": "api",
+    "changes": [                     // modified only
+      {"path": "spec.replicas", "old": 2, "new": 3}
+    ],
+    "object": { ... }                // the object after the change, or
+  }                                  // its last state when deleted
+
+Events are POSTed to --webhook, and/or written to the stdin of --exec, a
+shell command run once per event with KUBE_EVENT, KUBE_KIND, KUBE_NAMESPACE
+and KUBE_NAME set. Without either, events are printed as JSON Lines. That
+makes a lightweight automation trigger without deploying an operator.
+
+Objects that exist when kube-notify starts are not reported, only what
+changes afterwards. Lists in the diff are compared as a whole. Writes that do
+not change anything (only resourceVersion or managedFields) are skipped,
+and with --ignore-status so are changes of the status alone.
+
+A webhook answering with an error or not at all is retried --retries times,
+then the event is reported as failed and the watch goes on. When the watch
+expires, the objects are listed again and the changes in between are
+reported from the difference.
+
+Examples:
+  kube-notify deployments -n shop --webhook https://hooks.example.com/deploy
+  kube-notify nodes --on added,deleted --exec 'notify-send "node $KUBE_NAME $KUBE_EVENT"'
+  kube-notify cm app-config --exec 'jq -c .changes'
+  kube-notify pods -A -l team=payments --on deleted
+  kube-notify deploy -A --ignore-status --webhook https://hooks.slack.example/x \
+    -H 'Authorization: Bearer $TOKEN'`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runNotify,
+}
+
+// fieldChange is a field that differs between two versions of an object
+type fieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// notifyEvent is the JSON document sent for a change
+type notifyEvent struct {
+	Type       string                 `json:"type"`
+	Time       time.Time              `json:"time"`
+	Context    string                 `json:"context,omitempty"`
+	APIVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Namespace  string                 `json:"namespace,omitempty"`
+	Name       string                 `json:"name"`
+	Changes    []fieldChange          `json:"changes,omitempty"`
+	Object     map[string]interface{} `json:"object"`
+}
+
+// notifier keeps the last known state of every watched object, so changes
+// can be diffed and a new list can be compared after the watch expired
+type notifier struct {
+	client      *k8s.Client
+	resource    dynamic.ResourceInterface
+	resourceFor func(*k8s.Client) (dynamic.ResourceInterface, error)
+	options     metav1.ListOptions
+	context     string
+	on          map[string]bool
+	headers     http.Header
+	httpClient  *http.Client
+	known       map[types.UID]*unstructured.Unstructured
+	failed      int
+}
+
+// runNotify resolves the resource and delivers its changes until interrupted
+func runNotify(cmd *cobra.Command, args []string) error {
+	on := map[string]bool{}
+	for _, t := range notifyOn {
+		switch t = strings.ToLower(strings.TrimSpace(t)); t {
+		case eventAdded, eventModified, eventDeleted:
+			on[t] = true
+		default:
+			return clierr.Usagef("invalid --on %q, expected added, modified or deleted", t)
+		}
+	}
+	if notifyWebhook != "" && !strings.HasPrefix(notifyWebhook, "http://") && !strings.HasPrefix(notifyWebhook, "https://") {
+		return clierr.Usagef("invalid --webhook %q, must start with http:// or https://", notifyWebhook)
+	}
+	headers := http.Header{}
+	for _, h := range notifyHeaders {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return clierr.Usagef("invalid --header %q, expected 'Name: value'", h)
+		}
+		headers.Add(strings.TrimSpace(name), os.ExpandEnv(strings.TrimSpace(value)))
+	}
+	if len(notifyHeaders) > 0 && notifyWebhook == "" {
+		return clierr.Usagef("--header requires --webhook")
+	}
+	if notifyTimeout <= 0 {
+		return clierr.Usagef("--timeout must be positive")
+	}
+	if notifyRetries < 0 {
+		return clierr.Usagef("--retries must not be negative")
+	}
+	if _, err := labels.Parse(notifySelector); err != nil {
+		return clierr.Usagef("invalid label selector %q: %v", notifySelector, err)
+	}
+	if len(args) > 1 && notifyAllNamespaces {
+		return clierr.Usagef("a name cannot be combined with -A")
+	}
+
+	client, err := k8s.NewClient("", notifyKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	namespace := notifyNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(notifyKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	if notifyAllNamespaces {
+		namespace = ""
+	}
+
+	mapping, err := client.ResolveResource(args[0])
+	if err != nil {
+		return clierr.Wrap(clierr.Usage, err)
+	}
+	resourceFor := func(c *k8s.Client) (dynamic.ResourceInterface, error) {
+		dyn, err := c.Dynamic()
+		if err != nil {
+			return nil, err
+		}
+		if mapping.Namespaced {
+			return dyn.Resource(mapping.Resource).Namespace(namespace), nil
+		}
+		return dyn.Resource(mapping.Resource), nil
+	}
+	resource, err := resourceFor(client)
+	if err != nil {
+		return err
+	}
+
+	n := &notifier{
+		client:      client,
+		resource:    resource,
+		resourceFor: resourceFor,
+		options:     metav1.ListOptions{LabelSelector: notifySelector},
+		context:     notifyKubeContext,
+		on:          on,
+		headers:     headers,
+		httpClient:  &http.Client{Timeout: notifyTimeout},
+	}
+	if len(args) > 1 {
+		n.options.FieldSelector = fields.OneTermEqualSelector("metadata.name", args[1]).String()
+	}
+	if n.context == "" {
+		if raw, err := k8s.LoadRawConfig(); err == nil {
+			n.context = raw.CurrentContext
+		}
+	}
+
+	ctx, stop := interrupt.Context(context.Background())
+	defer stop()
+
+	items, resourceVersion, err := n.list(ctx)
+	if err != nil {
+		return err
+	}
+	n.known = items
+	scope := "in all namespaces"
+	switch {
+	case !mapping.Namespaced:
+		scope = "(cluster-scoped)"
+	case namespace != "":
+		scope = "in namespace " + namespace
+	}
+	fmt.Fprintf(os.Stderr, "Watching %d %s %s for %s, Ctrl+C to stop\n", len(items), mapping.Resource.Resource, scope, strings.Join(notifyOn, ", "))
+
+	err = n.watch(ctx, resourceVersion)
+	if n.failed > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d event(s) could not be delivered\n", n.failed)
+	}
+	return err
+}
+
+// list returns the current objects by UID and the resourceVersion to watch from
+func (n *notifier) list(ctx context.Context) (map[types.UID]*unstructured.Unstructured, string, error) {
+	items := map[types.UID]*unstructured.Unstructured{}
+	opts := n.options
+	opts.Limit = listPageSize
+	for {
+		page, err := n.resource.List(ctx, opts)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to list: %w", err)
+		}
+		for i := range page.Items {
+			items[page.Items[i].GetUID()] = &page.Items[i]
+		}
+		if page.GetContinue() == "" {
+			return items, page.GetResourceVersion(), nil
+		}
+		opts.Continue = page.GetContinue()
+	}
+}
+
+// watch reports changes from resourceVersion until ctx is cancelled. The
+// watch is re-established when the server closes it, and the objects are
+// listed again when it expired.
+func (n *notifier) watch(ctx context.Context, resourceVersion string) error {
+	for {
+		opts := n.options
+		opts.ResourceVersion = resourceVersion
+		opts.AllowWatchBookmarks = true
+		w, err := n.resource.Watch(ctx, opts)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case k8s.IsAuthError(err):
+			if err := n.reauthenticate(ctx); err != nil {
+				return err
+			}
+			continue
+		case err != nil:
+			return fmt.Errorf("failed to watch: %w", err)
+		}
+
+		expired := false
+		for event := range w.ResultChan() {
+			if event.Type == watch.Error {
+				w.Stop()
+				if ctx.Err() != nil {
+					return nil
+				}
+				if status, ok := event.Object.(*metav1.Status); ok && status.Code == http.StatusGone {
+					expired = true
+					break
+				}
+				return fmt.Errorf("watch failed: %w", apierrors.FromObject(event.Object))
+			}
+			obj, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			resourceVersion = obj.GetResourceVersion()
+			switch event.Type {
+			case watch.Added:
+				n.added(obj)
+			case watch.Modified:
+				n.modified(obj)
+			case watch.Deleted:
+				n.deleted(obj)
+			}
+		}
+		w.Stop()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		if expired {
+			if resourceVersion, err = n.resync(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// reauthenticate renews the credentials after the API server rejected them
+func (n *notifier) reauthenticate(ctx context.Context) error {
+	fresh, err := n.client.Reauthenticate(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to re-authenticate: %w", err)
+	}
+	resource, err := n.resourceFor(fresh)
+	if err != nil {
+		return err
+	}
+	n.client, n.resource = fresh, resource
+	return nil
+}
+
+// resync lists the objects again after the watch expired and reports what
+// changed compared to the last known state
+func (n *notifier) resync(ctx context.Context) (string, error) {
+	fmt.Fprintln(os.Stderr, "Watch expired, listing again")
+	items, resourceVersion, err := n.list(ctx)
+	if err != nil {
+		return "", err
+	}
+	uids := make([]types.UID, 0, len(n.known))
+	for uid := range n.known {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	for _, uid := range uids {
+		if _, ok := items[uid]; !ok {
+			n.deleted(n.known[uid])
+		}
+	}
+	for _, obj := range sortedObjects(items) {
+		prev, ok := n.known[obj.GetUID()]
+		switch {
+		case !ok:
+			n.added(obj)
+		case prev.GetResourceVersion() != obj.GetResourceVersion():
+			n.modified(obj)
+		}
+	}
+	n.known = items
+	return resourceVersion, nil
+}
+
+// added reports a new object
+func (n *notifier) added(obj *unstructured.Unstructured) {
+	n.known[obj.GetUID()] = obj
+	n.send(eventAdded, obj, nil)
+}
+
+// modified reports the fields that changed since the last known state
+func (n *notifier) modified(obj *unstructured.Unstructured) {
+	prev, ok := n.known[obj.GetUID()]
+	n.known[obj.GetUID()] = obj
+	if !ok {
+		n.send(eventModified, obj, nil)
+		return
+	}
+	changes := diffObjects(prev.Object, obj.Object)
+	if len(changes) == 0 {
+		return
+	}
+	if notifyIgnoreStatus && onlyStatus(changes) {
+		return
+	}
+	n.send(eventModified, obj, changes)
+}
+
+// deleted reports an object that is gone, with its last state
+func (n *notifier) deleted(obj *unstructured.Unstructured) {
+	delete(n.known, obj.GetUID())
+	n.send(eventDeleted, obj, nil)
+}
+
+// send delivers an event to the webhook and the command, or prints it
+func (n *notifier) send(eventType string, obj *unstructured.Unstructured, changes []fieldChange) {
+	if !n.on[eventType] {
+		return
+	}
+	event := notifyEvent{
+		Type:       eventType,
+		Time:       time.Now().UTC(),
+		Context:    n.context,
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		Changes:    changes,
+		Object:     obj.Object,
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to encode event of %s: %v\n", event.Name, err)
+		n.failed++
+		return
+	}
+	if notifyWebhook == "" && notifyExec == "" {
+		fmt.Println(string(data))
+		return
+	}
+
+	subject := event.Name
+	if event.Namespace != "" {
+		subject = event.Namespace + "/" + event.Name
+	}
+	prefix := fmt.Sprintf("%s %-8s %s %s", time.Now().Format("15:04:05"), eventType, strings.ToLower(event.Kind), subject)
+	if notifyWebhook != "" {
+		start := time.Now()
+		if err := n.post(data); err != nil {
+			n.failed++
+			fmt.Fprintf(os.Stderr, "%s -> webhook failed: %v\n", prefix, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s -> webhook ok in %s\n", prefix, time.Since(start).Round(time.Millisecond))
+		}
+	}
+	if notifyExec != "" {
+		if err := runCommand(data, event); err != nil {
+			n.failed++
+			fmt.Fprintf(os.Stderr, "%s -> command failed: %v\n", prefix, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s -> command ok\n", prefix)
+		}
+	}
+}
+
+// post sends the event to the webhook, retrying network errors and 5xx or
+// 429 answers with a growing delay
+func (n *notifier) post(data []byte) error {
+	delay := time.Second
+	var err error
+	for attempt := 0; attempt <= notifyRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		var retry bool
+		if retry, err = n.postOnce(data); err == nil || !retry {
+			return err
+		}
+	}
+	return fmt.Errorf("%w (after %d retries)", err, notifyRetries)
+}
+
+// postOnce sends the event once and reports whether a failure is worth retrying
+func (n *notifier) postOnce(data []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, notifyWebhook, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	req.Header = n.headers.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kube-notify")
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("%s %s", resp.Status, strings.TrimSpace(string(body)))
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// runCommand runs --exec with the event on stdin and its subject in the
+// environment. Its output goes to the terminal.
+func runCommand(data []byte, event notifyEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", notifyExec)
+	cmd.Stdin = bytes.NewReader(append(data, '\n'))
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		"KUBE_EVENT="+event.Type,
+		"KUBE_KIND="+event.Kind,
+		"KUBE_NAMESPACE="+event.Namespace,
+		"KUBE_NAME="+event.Name,
+		"KUBE_CONTEXT="+event.Context,
+	)
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return fmt.Errorf("timed out after %s", notifyTimeout)
+	}
+	return err
+}
+
+// diffObjects returns the fields that differ between two versions of an
+// object, by dotted path. Lists are compared as a whole.
+func diffObjects(before, after map[string]interface{}) []fieldChange {
+	var changes []fieldChange
+	var walk func(path string, a, b interface{})
+	walk = func(path string, a, b interface{}) {
+		if ignoredPaths[path] {
+			return
+		}
+		am, aok := a.(map[string]interface{})
+		bm, bok := b.(map[string]interface{})
+		if !aok || !bok {
+			if !reflect.DeepEqual(a, b) {
+				changes = append(changes, fieldChange{Path: path, Old: a, New: b})
+			}
+			return
+		}
+		keys := map[string]bool{}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			field := k
+			if path != "" {
+				field = path + "." + k
+			}
+			walk(field, am[k], bm[k])
+		}
+	}
+	walk("", before, after)
+	return changes
+}
+
+// onlyStatus reports whether all changes are in the status of the object
+func onlyStatus(changes []fieldChange) bool {
+	for _, c := range changes {
+		if c.Path != "status" && !strings.HasPrefix(c.Path, "status.") {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedObjects returns the objects ordered by namespace and name, so
+// changes found by a new list are reported in a stable order
+func sortedObjects(items map[types.UID]*unstructured.Unstructured) []*unstructured.Unstructured {
+	objects := make([]*unstructured.Unstructured, 0, len(items))
+	for _, obj := range items {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].GetNamespace() != objects[j].GetNamespace() {
+			return objects[i].GetNamespace() < objects[j].GetNamespace()
+		}
+		return objects[i].GetName() < objects[j].GetName()
+	})
+	return objects
+}
+
+// init initializes flags for kube-notify command
+func init() {
+	notifyRootCmd.Flags().StringVarP(&notifyNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	notifyRootCmd.Flags().StringVarP(&notifyKubeContext, "context", "c", "", "Kubernetes context to use")
+	notifyRootCmd.Flags().BoolVarP(&notifyAllNamespaces, "all-namespaces", "A", false, "Watch all namespaces")
+	notifyRootCmd.Flags().StringVarP(&notifySelector, "selector", "l", "", "Only watch objects matching this label selector")
+	notifyRootCmd.Flags().StringVar(&notifyWebhook, "webhook", "", "POST every event as JSON to this URL")
+	notifyRootCmd.Flags().StringArrayVarP(&notifyHeaders, "header", "H", nil, "Header sent to the webhook, 'Name: value' ($VARS are expanded, repeatable)")
+	notifyRootCmd.Flags().StringVar(&notifyExec, "exec", "", "Shell command run per event with the event JSON on stdin")
+	notifyRootCmd.Flags().StringSliceVar(&notifyOn, "on", []string{eventAdded, eventModified, eventDeleted}, "Event types to report: added, modified, deleted")
+	notifyRootCmd.Flags().BoolVar(&notifyIgnoreStatus, "ignore-status", false, "Skip modifications that only change the status")
+	notifyRootCmd.Flags().DurationVar(&notifyTimeout, "timeout", 10*time.Second, "Time limit of a webhook request or command")
+	notifyRootCmd.Flags().IntVar(&notifyRetries, "retries", 3, "Retries of a webhook request that failed or got a 5xx or 429 answer")
+
+	viper.BindPFlag("namespace", notifyRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", notifyRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-notify
+func main() {
+	k8s.AddVerbosityFlag(notifyRootCmd)
+	k8s.AddRateLimitFlags(notifyRootCmd)
+	config.SetupDefaults(notifyRootCmd)
+	clierr.SetupUsage(notifyRootCmd)
+	cmd, err := notifyRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
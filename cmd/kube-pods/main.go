@@ -1,37 +1,298 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"kube/pkg/kubernetes/capacity"
+	"kube/pkg/kubernetes/drift"
 	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/podstatus"
+	"kube/pkg/kubernetes/rolloutstatus"
+	"kube/pkg/kubernetes/target"
+	"kube/pkg/shared/agefilter"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
 	"kube/pkg/shared/utils"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
 )
 
 var (
-	podsNamespace     string
-	podsContext       string
-	podsAllNamespaces bool
+	podsNamespace         string
+	podsContext           string
+	podsAllNamespaces     bool
+	podsStuckTerminating  bool
+	podsForceDelete       bool
+	podsForceDeleteAssume bool
+	podsWatch             bool
+	podsRefresh           time.Duration
+	podsConditions        bool
+	podsMemoryPressure    bool
+	podsMemoryThreshold   int
+	podsOnSpot            bool
+	podsOnDemand          bool
+	podsNode              string
+	podsNodeSelector      string
+	podsSelector          string
+	podsTable             table.Options
+	podsAge               agefilter.Filter
+	podsDriftRegistry     bool
+	podsDriftTable        table.Options
+	podsRestartForce      bool
+	podsRestartWait       bool
+	podsRestartTimeout    time.Duration
+	podsRestartGrace      int64
+	podsEvictSelector     string
+	podsEvictMax          int
+	podsEvictForce        bool
+	podsEvictTimeout      time.Duration
+	podsEvictDryRun       bool
+	podsEvictAssume       bool
 )
 
+// listPageSize is the number of pods fetched per request when streaming JSON Lines
+const listPageSize = 500
+
 // podsRootCmd represents the kube-pods command
 var podsRootCmd = &cobra.Command{
 	Use:   "kube-pods",
 	Short: "List pods",
 	Long: `kube-pods lists pods in your Kubernetes cluster with a clean table output.
 
-It is similar to 'kubectl get pods' but adds colored status, IP, node and image versions columns.`,
+It is similar to 'kubectl get pods' but adds colored status, IP, node and image versions columns.
+
+With -o jsonl one JSON object is printed per pod as soon as each page is
+fetched, so pipelines do not wait for the full list. Adding --watch keeps
+streaming add/update/delete events until interrupted.
+
+Pods being deleted are shown as Terminating with how long they have been
+terminating and the finalizers that still block them.
+
+--conditions replaces the IP, NODE and IMAGE-VERSIONS columns with the pod
+conditions PodScheduled, Initialized, ContainersReady and Ready plus the
+readiness gates, as ✓ (true), ✗ (false) or · (not reported yet). WAITING-ON
+shows the first condition that is not true with its reason, which is where a
+Pending pod is stuck.
+
+--refresh keeps the table on screen and re-renders it on an interval from a
+watch, like watch(1) without a new list per tick. Pods added since the last
+refresh are green, changed cells are shown in reverse video and removed pods
+stay struck through for one refresh.
+
+--memory-pressure shows one row per container with its memory usage from
+metrics-server next to its request and limit, sorted by how close it is to
+being OOM killed. Usage at or above --memory-threshold percent of the limit is
+red; containers without a limit or without metrics are listed last. LAST-OOM
+shows when the container was last OOMKilled.
+
+REVISION shows the pod-template-hash of Deployment pods and the
+controller-revision-hash of StatefulSet and DaemonSet pods. During a rollout,
+pods still on a revision their controller is moving away from are marked
+"(old)" in yellow: those are the pods about to be replaced. Pods of one
+ReplicaSet share a name prefix, so they are listed next to each other.
+
+-l/--selector only shows the pods matching a label selector, selected by the
+API server like 'kubectl get pods -l', also with -A, --watch and -o jsonl.
+
+--node only shows the pods scheduled on one node, --node-selector the pods
+on the nodes matching a label selector (a node pool, a zone, cordoned
+nodes labelled for maintenance), which is what a drain moves.
+
+CAPACITY tells whether the node of a pod is spot (preemptible) or on-demand
+capacity, from the node labels of Karpenter, EKS, GKE, AKS, kops, eksctl and
+spot.io; - when the labels do not tell or nodes may not be listed. --on-spot
+and --on-demand only show the pods on that capacity, e.g. to check that
+every replica of a service is not on capacity that can vanish at once.
+
+While a pod initializes, STATUS shows the init progress like kubectl
+(Init:1/3, Init:CrashLoopBackOff, Init:ExitCode:1). Native sidecars (init
+containers with restartPolicy Always) count towards READY and are shown
+separately, e.g. 2/2 (1/1 sidecar).
+
+Examples:
+  kube-pods                                    # List pods in current namespace
+  kube-pods --stuck-terminating -A             # Pods past their grace period
+  kube-pods -A --older-than 7d                 # Stale pods, e.g. forgotten debug pods
+  kube-pods --newer-than 1h                    # Did the deploy recreate the pods?
+  kube-pods --stuck-terminating --force-delete # Force delete them (asks first)
+  kube-pods -q | xargs -n1 kube-logs -t 100    # Names only, for pipelines
+  kube-pods -A -o jsonl | jq -r .name          # One JSON object per pod
+  kube-pods -o jsonl --watch                   # Stream add/update/delete events
+  kube-pods --refresh 5s                       # Live table, changes highlighted
+  kube-pods --conditions                       # Which stage are pending pods stuck at?
+  kube-pods -A --memory-pressure               # Containers closest to their memory limit
+  kube-pods -A --on-spot                       # Pods that a spot reclaim would hit
+  kube-pods -l app=backend                     # Pods of one app
+  kube-pods -A -l 'tier in (web,api)'          # Set-based selectors work too
+  kube-pods -A --node worker-3                 # Everything a drain of worker-3 moves
+  kube-pods -A --node-selector topology.kubernetes.io/zone=eu-west-1a
+  kube-pods drift -A                           # Pods not running what their workload specifies
+  kube-pods restart web-7f9c --wait            # Replace one pod, wait until the new one is ready
+  kube-pods evict -l app=worker                # Evict pods one by one, respecting PDBs`,
 	RunE: runPods,
 }
 
+// driftPodsCmd represents the kube-pods drift subcommand
+var driftPodsCmd = &cobra.Command{
+	Use:   "drift [pod]",
+	Short: "Find containers not running what their spec and workload say",
+	Long: `drift compares what the containers of a pod run with what they should run.
+Without a pod name every pod of the namespace (or all namespaces with -A) is
+checked and only pods with drift are listed.
+
+- template: image, command, args, env and envFrom of the pod against the
+  current template of its Deployment, StatefulSet or DaemonSet. Pods of a
+  rollout that is stuck or paused halfway show up here. Env vars only set on
+  the pod and containers missing from the template are ignored, admission
+  webhooks add those.
+- digest: the image digest a running container reports (imageID) against the
+  digest pinned in the spec, or the digest the newest pod of the workload runs
+  for the same tag. A tag pushed again (latest, main) after some pods pulled
+  it shows up here. With --registry the tag is resolved in the registry
+  instead, which also catches workloads that all run an outdated image.
+- configmap/secret: ConfigMaps and Secrets changed after the container
+  started that it only reads at start: env, envFrom and subPath mounts. Other
+  mounts are updated by the kubelet; these need a restart.
+
+Exits with an error when drift is found, so it can run in CI.`,
+	Example: `  kube-pods drift web-7f9c4d5b6-xk2lp          # One pod, partial names work
+  kube-pods drift -A                           # Every pod of the cluster
+  kube-pods drift --registry                   # Compare tags with the registry`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runDrift,
+}
+
+// restartPodsCmd represents the kube-pods restart subcommand
+var restartPodsCmd = &cobra.Command{
+	Use:   "restart <pod>",
+	Short: "Delete a pod so its controller replaces it",
+	Long: `restart deletes one pod after checking that a controller (ReplicaSet,
+StatefulSet, DaemonSet, Job) will create a replacement, which is the way to
+restart a single pod.
+
+A pod without a controller is gone for good once deleted, so restart refuses
+it unless --force is given. Static pods are refused: they belong to the
+kubelet and deleting their mirror pod does not restart them.
+
+With --wait the replacement pod is followed until it is Ready and its name is
+printed. A StatefulSet pod is replaced under the same name once the old one
+is gone.`,
+	Example: `  kube-pods restart web-7f9c4d5b6-xk2lp          # Partial names work
+  kube-pods restart web-7f9c --wait --timeout 2m  # Wait for the replacement
+  kube-pods restart debug-shell --force           # A bare pod, not recreated`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRestart,
+}
+
+// evictPodsCmd represents the kube-pods evict subcommand
+var evictPodsCmd = &cobra.Command{
+	Use:   "evict -l <selector>",
+	Short: "Evict the pods of a selector gradually, respecting PodDisruptionBudgets",
+	Long: `evict moves the pods matching a label selector away with the Eviction API, a
+few at a time, which is safer than deleting them in a loop:
+
+- at most --max-unavailable pods are evicted and not yet replaced at any time;
+  a pod counts as replaced once its controller created a new pod that is Ready
+- PodDisruptionBudgets are enforced by the API server: an eviction the budget
+  does not allow yet is retried until it does
+- pods without a controller are not recreated and are skipped unless --force
+  is given; static pods are always skipped
+
+Use --dry-run to see the pods and the budgets that cover them.`,
+	Example: `  kube-pods evict -l app=worker                       # One at a time, asks first
+  kube-pods evict -l app=worker --max-unavailable 3 -y
+  kube-pods evict -A -l tier=batch --dry-run`,
+	Args: cobra.NoArgs,
+	RunE: runEvict,
+}
+
 // runPods executes the logic to list pods
 func runPods(cmd *cobra.Command, args []string) error {
+	if podsForceDelete && !podsStuckTerminating {
+		return clierr.Usagef("--force-delete can only be used together with --stuck-terminating")
+	}
+	if err := podsTable.Validate(); err != nil {
+		return err
+	}
+	switch podsTable.Output {
+	case "jsonl":
+		if podsForceDelete {
+			return clierr.Usagef("--force-delete cannot be used with -o jsonl")
+		}
+	default:
+		if podsWatch {
+			return clierr.Usagef("--watch requires -o jsonl")
+		}
+	}
+	if err := podsAge.Validate(); err != nil {
+		return err
+	}
+	if podsConditions && podsTable.Output == "jsonl" {
+		return clierr.Usagef("--conditions cannot be used with -o jsonl")
+	}
+	if podsMemoryPressure {
+		switch {
+		case podsTable.Output == "jsonl":
+			return clierr.Usagef("--memory-pressure cannot be used with -o jsonl")
+		case podsConditions:
+			return clierr.Usagef("--memory-pressure cannot be used with --conditions")
+		case podsRefresh != 0:
+			return clierr.Usagef("--memory-pressure cannot be used with --refresh")
+		case podsForceDelete:
+			return clierr.Usagef("--memory-pressure cannot be used with --force-delete")
+		}
+	}
+	if podsOnSpot && podsOnDemand {
+		return clierr.Usagef("--on-spot and --on-demand cannot be used together")
+	}
+	if (podsOnSpot || podsOnDemand) && podsTable.Output == "jsonl" {
+		return clierr.Usagef("--on-spot and --on-demand cannot be used with -o jsonl")
+	}
+	if podsNode != "" && podsNodeSelector != "" {
+		return clierr.Usagef("--node and --node-selector cannot be used together")
+	}
+	if _, err := labels.Parse(podsSelector); err != nil {
+		return clierr.Usagef("invalid --selector %q: %v", podsSelector, err)
+	}
+	if _, err := labels.Parse(podsNodeSelector); err != nil {
+		return clierr.Usagef("invalid --node-selector %q: %v", podsNodeSelector, err)
+	}
+	if podsMemoryThreshold < 1 || podsMemoryThreshold > 100 {
+		return clierr.Usagef("--memory-threshold must be between 1 and 100")
+	}
+	if podsRefresh != 0 {
+		switch {
+		case podsRefresh < time.Second:
+			return clierr.Usagef("--refresh must be at least 1s")
+		case podsTable.Output != "table":
+			return clierr.Usagef("--refresh cannot be used with -o %s", podsTable.Output)
+		case podsForceDelete:
+			return clierr.Usagef("--refresh cannot be used with --force-delete")
+		}
+	}
+
 	client, err := k8s.NewClient("", podsContext)
 	if err != nil {
 		return fmt.Errorf("failed to create kubernetes client: %w", err)
@@ -52,37 +313,251 @@ func runPods(cmd *cobra.Command, args []string) error {
 		targetNamespace = ""
 	}
 
-	pods, err := client.Clientset.CoreV1().Pods(targetNamespace).List(client.Context, metav1.ListOptions{})
+	nodes, err := selectedNodes(client.Context, client)
+	if err != nil {
+		return err
+	}
+
+	if podsTable.Output == "jsonl" {
+		return streamPods(client, targetNamespace, nodes)
+	}
+
+	if podsRefresh > 0 {
+		return refreshPods(client, targetNamespace, nodes)
+	}
+
+	pods, err := client.Clientset.CoreV1().Pods(targetNamespace).List(client.Context, podListOptions())
 	if err != nil {
 		return fmt.Errorf("failed to list pods: %w", err)
 	}
+	capacities, err := nodeCapacities(client.Context, client)
+	if err != nil {
+		return err
+	}
+	pods.Items = filterPods(pods.Items, capacities, nodes, time.Now())
 
-	// Prepare table data
-	var headers []string
-	if podsAllNamespaces {
-		headers = []string{"NAMESPACE", "NAME", "READY", "STATUS", "IP", "NODE", "IMAGE-VERSIONS", "RESTARTS", "AGE"}
-	} else {
-		headers = []string{"NAME", "READY", "STATUS", "IP", "NODE", "IMAGE-VERSIONS", "RESTARTS", "AGE"}
+	if podsMemoryPressure {
+		usage, err := podMemoryUsage(client, targetNamespace)
+		if err != nil {
+			return err
+		}
+		headers, rows := memoryRows(pods.Items, usage, time.Now())
+		podsTable.Print(headers, rows, nameColumn())
+		return nil
 	}
 
-	var rows [][]string
-	for _, pod := range pods.Items {
-		ready := 0
-		total := len(pod.Spec.Containers)
-		for _, status := range pod.Status.ContainerStatuses {
-			if status.Ready {
-				ready++
+	revisions := currentRevisions(client.Context, client, targetNamespace)
+	headers, rows := podRows(pods.Items, capacities, revisions, time.Now())
+	podsTable.Print(headers, rows, nameColumn())
+
+	if podsForceDelete {
+		return forceDeletePods(client, pods.Items)
+	}
+	return nil
+}
+
+// filterPods applies --stuck-terminating, --on-spot, --on-demand,
+// --node-selector and the age filters. nodes is nil without --node-selector.
+func filterPods(pods []corev1.Pod, capacities map[string]string, nodes map[string]bool, now time.Time) []corev1.Pod {
+	matched := pods[:0]
+	for _, pod := range pods {
+		if podsStuckTerminating && !isStuckTerminating(&pod, now) {
+			continue
+		}
+		if nodes != nil && !nodes[pod.Spec.NodeName] {
+			continue
+		}
+		if podsOnSpot && capacities[pod.Spec.NodeName] != capacity.Spot {
+			continue
+		}
+		if podsOnDemand && capacities[pod.Spec.NodeName] != capacity.OnDemand {
+			continue
+		}
+		if !podsAge.Match(pod.CreationTimestamp.Time, now) {
+			continue
+		}
+		matched = append(matched, pod)
+	}
+	return matched
+}
+
+// podListOptions selects the pods of --selector and --node on the server
+func podListOptions() metav1.ListOptions {
+	opts := metav1.ListOptions{LabelSelector: podsSelector}
+	if podsNode != "" {
+		opts.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", podsNode).String()
+	}
+	return opts
+}
+
+// selectedNodes returns the names of the nodes matching --node-selector, or
+// nil without it. Pods are joined with their node by name on the client,
+// the API server cannot select pods by node labels.
+func selectedNodes(ctx context.Context, client *k8s.Client) (map[string]bool, error) {
+	if podsNodeSelector == "" {
+		return nil, nil
+	}
+	list, err := client.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: podsNodeSelector})
+	if err != nil {
+		return nil, fmt.Errorf("--node-selector needs the node labels: %w", err)
+	}
+	if len(list.Items) == 0 {
+		return nil, clierr.Newf(clierr.NotFound, "no nodes match --node-selector %s", podsNodeSelector)
+	}
+	nodes := make(map[string]bool, len(list.Items))
+	for _, node := range list.Items {
+		nodes[node.Name] = true
+	}
+	return nodes, nil
+}
+
+// nodeCapacities returns the capacity types of the nodes by name. Without
+// permission to list nodes the CAPACITY column stays empty, only --on-spot
+// and --on-demand cannot do without it.
+func nodeCapacities(ctx context.Context, client *k8s.Client) (map[string]string, error) {
+	capacities, err := capacity.Nodes(ctx, client.Clientset)
+	if err != nil {
+		if podsOnSpot || podsOnDemand {
+			return nil, fmt.Errorf("--on-spot and --on-demand need the node labels: %w", err)
+		}
+		return map[string]string{}, nil
+	}
+	return capacities, nil
+}
+
+// formatCapacity shows spot capacity as a yellow badge
+func formatCapacity(capacityType string) string {
+	switch capacityType {
+	case capacity.Spot:
+		return "\033[33m" + capacityType + "\033[0m"
+	case "":
+		return "-"
+	}
+	return capacityType
+}
+
+// currentRevisions returns the revision each controller rolls its pods
+// towards, by controller UID: the pod-template-hash of the newest ReplicaSet
+// of a Deployment for all its ReplicaSets, the update revision of a
+// StatefulSet and the newest ControllerRevision of a DaemonSet. Controllers
+// that may not be listed are left out, their pods are not flagged.
+func currentRevisions(ctx context.Context, client *k8s.Client, namespace string) map[types.UID]string {
+	current := map[types.UID]string{}
+	if podsConditions || podsMemoryPressure {
+		return current
+	}
+	apps := client.Clientset.AppsV1()
+
+	if list, err := apps.ReplicaSets(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+		newest := map[types.UID]*appsv1.ReplicaSet{}
+		for i := range list.Items {
+			rs := &list.Items[i]
+			owner := metav1.GetControllerOf(rs)
+			if owner == nil {
+				continue
+			}
+			if prev, ok := newest[owner.UID]; !ok || replicaSetRevision(rs) > replicaSetRevision(prev) {
+				newest[owner.UID] = rs
 			}
 		}
+		for _, rs := range list.Items {
+			if owner := metav1.GetControllerOf(&rs); owner != nil {
+				current[rs.UID] = newest[owner.UID].Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+			}
+		}
+	}
 
-		restarts := int32(0)
-		for _, status := range pod.Status.ContainerStatuses {
-			restarts += status.RestartCount
+	if list, err := apps.StatefulSets(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+		for _, sts := range list.Items {
+			if sts.Status.UpdateRevision != "" {
+				current[sts.UID] = sts.Status.UpdateRevision
+			}
 		}
+	}
 
-		age := metav1.Now().Time.Sub(pod.CreationTimestamp.Time)
+	if list, err := apps.ControllerRevisions(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+		newest := map[types.UID]*appsv1.ControllerRevision{}
+		for i := range list.Items {
+			cr := &list.Items[i]
+			owner := metav1.GetControllerOf(cr)
+			if owner == nil || owner.Kind != "DaemonSet" {
+				continue
+			}
+			if prev, ok := newest[owner.UID]; !ok || cr.Revision > prev.Revision {
+				newest[owner.UID] = cr
+			}
+		}
+		for uid, cr := range newest {
+			current[uid] = cr.Labels[appsv1.ControllerRevisionHashLabelKey]
+		}
+	}
+	return current
+}
+
+// replicaSetRevision returns the rollout number the deployment controller
+// gave a ReplicaSet, 0 when it has none
+func replicaSetRevision(rs *appsv1.ReplicaSet) int64 {
+	revision, _ := strconv.ParseInt(rs.Annotations[rolloutstatus.RevisionAnnotation], 10, 64)
+	return revision
+}
+
+// podRevision returns the revision label of a pod and the label a controller
+// compares it with: pod-template-hash for ReplicaSet pods, controller-revision-hash
+// for StatefulSet and DaemonSet pods
+func podRevision(pod *corev1.Pod) string {
+	if hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; hash != "" {
+		return hash
+	}
+	return pod.Labels[appsv1.ControllerRevisionHashLabelKey]
+}
+
+// shortRevision drops the StatefulSet name a controller-revision-hash
+// starts with, e.g. web-6d4b8c7f9 -> 6d4b8c7f9
+func shortRevision(pod *corev1.Pod, revision string) string {
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		return strings.TrimPrefix(revision, owner.Name+"-")
+	}
+	return revision
+}
+
+// formatRevision shows the revision hash of a pod, flagged yellow as old when
+// its controller already rolls towards a newer one: those pods are replaced
+// as the rollout goes on
+func formatRevision(pod *corev1.Pod, revisions map[types.UID]string) string {
+	revision := podRevision(pod)
+	if revision == "" {
+		return "-"
+	}
+	text := shortRevision(pod, revision)
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		if current, ok := revisions[owner.UID]; ok && current != "" && current != revision {
+			return "\033[33m" + text + " (old)\033[0m"
+		}
+	}
+	return text
+}
+
+// podRows builds the table headers and one row per pod
+func podRows(pods []corev1.Pod, capacities map[string]string, revisions map[types.UID]string, now time.Time) ([]string, [][]string) {
+	if podsConditions {
+		return conditionRows(pods, now)
+	}
+
+	// Prepare table data
+	var headers []string
+	if podsAllNamespaces {
+		headers = []string{"NAMESPACE", "NAME", "READY", "STATUS", "IP", "NODE", "CAPACITY", "REVISION", "IMAGE-VERSIONS", "RESTARTS", "AGE"}
+	} else {
+		headers = []string{"NAME", "READY", "STATUS", "IP", "NODE", "CAPACITY", "REVISION", "IMAGE-VERSIONS", "RESTARTS", "AGE"}
+	}
+
+	rows := make([][]string, 0, len(pods))
+	for _, pod := range pods {
+		counts := podstatus.ContainerCounts(&pod)
+
+		age := now.Sub(pod.CreationTimestamp.Time)
 		ip := pod.Status.PodIP
-		statusColored := colorStatus(string(pod.Status.Phase))
+		statusColored := formatStatus(&pod, now)
 		node := pod.Spec.NodeName
 		// Aggregate image versions from containers (including initContainers)
 		versionSet := map[string]struct{}{}
@@ -96,117 +571,1163 @@ func runPods(cmd *cobra.Command, args []string) error {
 		for v := range versionSet {
 			versions = append(versions, v)
 		}
+		sort.Strings(versions)
 		versionsStr := strings.Join(versions, ",")
 		versionsStr = utils.TruncateString(versionsStr, 60)
 
+		row := []string{
+			pod.Name,
+			formatReady(counts),
+			statusColored,
+			ip,
+			node,
+			formatCapacity(capacities[node]),
+			formatRevision(&pod, revisions),
+			versionsStr,
+			fmt.Sprintf("%d", counts.Restarts),
+			utils.FormatAge(age),
+		}
 		if podsAllNamespaces {
-			rows = append(rows, []string{
-				pod.Namespace,
-				pod.Name,
-				fmt.Sprintf("%d/%d", ready, total),
-				statusColored,
-				ip,
-				node,
-				versionsStr,
-				fmt.Sprintf("%d", restarts),
-				utils.FormatAge(age),
-			})
-		} else {
-			rows = append(rows, []string{
-				pod.Name,
-				fmt.Sprintf("%d/%d", ready, total),
-				statusColored,
-				ip,
-				node,
-				versionsStr,
-				fmt.Sprintf("%d", restarts),
-				utils.FormatAge(age),
-			})
+			row = append([]string{pod.Namespace}, row...)
 		}
+		rows = append(rows, row)
+	}
+	return headers, rows
+}
+
+// conditionRows builds the --conditions view: one glyph per pod condition
+// and readiness gate, and the first condition the pod is waiting on
+func conditionRows(pods []corev1.Pod, now time.Time) ([]string, [][]string) {
+	headers := []string{"NAME", "STATUS", "SCHEDULED", "INITIALIZED", "CONTAINERS-READY", "READY", "GATES", "WAITING-ON", "AGE"}
+	if podsAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
 	}
 
-	renderTable(headers, rows)
-	return nil
+	rows := make([][]string, 0, len(pods))
+	for _, pod := range pods {
+		stages := podstatus.Stages(&pod)
+		row := []string{pod.Name, formatStatus(&pod, now)}
+		gates := ""
+		for _, stage := range stages {
+			if stage.Gate {
+				gates += stageGlyph(stage.Status)
+			} else {
+				row = append(row, stageGlyph(stage.Status))
+			}
+		}
+		if gates == "" {
+			gates = "-"
+		}
+		row = append(row, gates, waitingOn(stages), utils.FormatAge(now.Sub(pod.CreationTimestamp.Time)))
+		if podsAllNamespaces {
+			row = append([]string{pod.Namespace}, row...)
+		}
+		rows = append(rows, row)
+	}
+	return headers, rows
 }
 
-// init initializes flags for kube-pods command
-func init() {
-	// Define flags
-	podsRootCmd.Flags().StringVarP(&podsNamespace, "namespace", "n", "", "Kubernetes namespace to use")
-	podsRootCmd.Flags().StringVarP(&podsContext, "context", "c", "", "Kubernetes context to use")
-	podsRootCmd.Flags().BoolVarP(&podsAllNamespaces, "all-namespaces", "A", false, "Show pods from all namespaces")
+// podMemoryUsage returns the current working set of every container from
+// metrics-server (metrics.k8s.io), keyed by namespace/pod/container
+func podMemoryUsage(client *k8s.Client, namespace string) (map[string]int64, error) {
+	path := "/apis/metrics.k8s.io/v1beta1/pods"
+	if namespace != "" {
+		path = "/apis/metrics.k8s.io/v1beta1/namespaces/" + namespace + "/pods"
+	}
+	data, err := client.Clientset.CoreV1().RESTClient().Get().AbsPath(path).DoRaw(client.Context)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod metrics (is metrics-server installed?): %w", err)
+	}
 
-	// Bind flags with viper
-	viper.BindPFlag("namespace", podsRootCmd.Flags().Lookup("namespace"))
-	viper.BindPFlag("context", podsRootCmd.Flags().Lookup("context"))
+	var list struct {
+		Items []struct {
+			Metadata   metav1.ObjectMeta `json:"metadata"`
+			Containers []struct {
+				Name  string              `json:"name"`
+				Usage corev1.ResourceList `json:"usage"`
+			} `json:"containers"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode pod metrics: %w", err)
+	}
+
+	usage := map[string]int64{}
+	for _, pod := range list.Items {
+		for _, c := range pod.Containers {
+			usage[pod.Metadata.Namespace+"/"+pod.Metadata.Name+"/"+c.Name] = c.Usage.Memory().Value()
+		}
+	}
+	return usage, nil
+}
+
+// memoryRows builds the --memory-pressure view: one row per container with
+// its usage as a percentage of the memory limit, closest to OOM first
+func memoryRows(pods []corev1.Pod, usage map[string]int64, now time.Time) ([]string, [][]string) {
+	const (
+		reset  = "\033[0m"
+		red    = "\033[31m"
+		yellow = "\033[33m"
+	)
+	headers := []string{"NAME", "CONTAINER", "USAGE", "REQUEST", "LIMIT", "%LIMIT", "RESTARTS", "LAST-OOM"}
+	if podsAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+
+	// percent is -1 without a limit and -2 without metrics, so they sort last
+	type entry struct {
+		row     []string
+		percent float64
+	}
+	var entries []entry
+	for _, pod := range pods {
+		statuses := map[string]corev1.ContainerStatus{}
+		for _, status := range pod.Status.ContainerStatuses {
+			statuses[status.Name] = status
+		}
+		for _, c := range pod.Spec.Containers {
+			request := c.Resources.Requests.Memory().Value()
+			limit := c.Resources.Limits.Memory().Value()
+			used, ok := usage[pod.Namespace+"/"+pod.Name+"/"+c.Name]
+
+			e := entry{percent: -2}
+			usageText, percentText := "-", "-"
+			if ok {
+				usageText = utils.FormatBytes(used)
+				e.percent = -1
+				if limit > 0 {
+					e.percent = float64(used) * 100 / float64(limit)
+					percentText = fmt.Sprintf("%.0f%%", e.percent)
+					if e.percent >= float64(podsMemoryThreshold) {
+						percentText = red + percentText + reset
+					}
+				} else {
+					percentText = "no limit"
+				}
+			}
+
+			status := statuses[c.Name]
+			lastOOM := "-"
+			if t := status.LastTerminationState.Terminated; t != nil && t.Reason == "OOMKilled" {
+				lastOOM = yellow + utils.FormatAge(now.Sub(t.FinishedAt.Time)) + " ago" + reset
+			}
+			if t := status.State.Terminated; t != nil && t.Reason == "OOMKilled" {
+				lastOOM = red + utils.FormatAge(now.Sub(t.FinishedAt.Time)) + " ago" + reset
+			}
+
+			e.row = []string{pod.Name, c.Name, usageText, formatMemoryQuantity(request), formatMemoryQuantity(limit),
+				percentText, fmt.Sprintf("%d", status.RestartCount), lastOOM}
+			if podsAllNamespaces {
+				e.row = append([]string{pod.Namespace}, e.row...)
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].percent > entries[j].percent })
+	rows := make([][]string, len(entries))
+	for i, e := range entries {
+		rows[i] = e.row
+	}
+	return headers, rows
+}
+
+// formatMemoryQuantity formats a request or limit in bytes, - when unset
+func formatMemoryQuantity(bytes int64) string {
+	if bytes == 0 {
+		return "-"
+	}
+	return utils.FormatBytes(bytes)
 }
 
-// renderTable prints an ASCII table with simple borders
-// headers: column headers, rows: row data
-func renderTable(headers []string, rows [][]string) {
-	widths := make([]int, len(headers))
-	// Calculate width based on content (excluding ANSI color codes)
-	for c, h := range headers {
-		w := displayWidth(h)
-		if w > widths[c] {
-			widths[c] = w
+// stageGlyph shows a condition status as a colored glyph
+func stageGlyph(status corev1.ConditionStatus) string {
+	const (
+		reset = "\033[0m"
+		red   = "\033[31m"
+		green = "\033[32m"
+		gray  = "\033[90m"
+	)
+	switch status {
+	case corev1.ConditionTrue:
+		return green + "✓" + reset
+	case corev1.ConditionFalse:
+		return red + "✗" + reset
+	default:
+		return gray + "·" + reset
+	}
+}
+
+// waitingOn describes the first condition that is not true, e.g.
+// "PodScheduled: Unschedulable (0/3 nodes are available...)"
+func waitingOn(stages []podstatus.Stage) string {
+	for _, stage := range stages {
+		if stage.Status == corev1.ConditionTrue {
+			continue
 		}
+		text := string(stage.Type)
+		switch {
+		case stage.Status == "":
+			text += ": not reported"
+		case stage.Reason != "" && stage.Message != "":
+			text += ": " + stage.Reason + " (" + stage.Message + ")"
+		case stage.Reason != "":
+			text += ": " + stage.Reason
+		case stage.Message != "":
+			text += ": " + stage.Message
+		}
+		return utils.TruncateString(text, 80)
+	}
+	return "-"
+}
+
+// nameColumn is the index of the NAME column
+func nameColumn() int {
+	if podsAllNamespaces {
+		return 1
+	}
+	return 0
+}
+
+// refreshPods keeps a pod cache up to date with a watch and re-renders the
+// table every --refresh interval. New pods are green, changed cells are
+// highlighted and removed pods are shown struck through for one refresh.
+func refreshPods(client *k8s.Client, namespace string, nodes map[string]bool) error {
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	list, err := client.Clientset.CoreV1().Pods(namespace).List(ctx, podListOptions())
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
 	}
-	for _, row := range rows {
-		for c, cell := range row {
-			w := displayWidth(cell)
-			if w > widths[c] {
-				widths[c] = w
+	var mu sync.Mutex
+	cache := map[string]corev1.Pod{}
+	for _, pod := range list.Items {
+		cache[pod.Namespace+"/"+pod.Name] = pod
+	}
+
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- watchPods(ctx, client, namespace, list.ResourceVersion, func(event string, pod *corev1.Pod) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if event == "delete" {
+				delete(cache, pod.Namespace+"/"+pod.Name)
+			} else {
+				cache[pod.Namespace+"/"+pod.Name] = *pod
 			}
+			return nil
+		})
+	}()
+
+	capacities, err := nodeCapacities(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	var previous map[string][]string
+	var notice string
+	ticker := time.NewTicker(podsRefresh)
+	defer ticker.Stop()
+	for {
+		// Edits of the config file apply from the next refresh on
+		if reloaded, err := config.ReloadDefaults(); err != nil {
+			notice = fmt.Sprintf("Warning: %v, keeping the previous defaults", err)
+		} else if reloaded {
+			notice = "Reloaded defaults from " + viper.ConfigFileUsed()
+		}
+
+		now := time.Now()
+		mu.Lock()
+		pods := make([]corev1.Pod, 0, len(cache))
+		for _, pod := range cache {
+			pods = append(pods, pod)
+		}
+		mu.Unlock()
+		sort.Slice(pods, func(i, j int) bool {
+			if pods[i].Namespace != pods[j].Namespace {
+				return pods[i].Namespace < pods[j].Namespace
+			}
+			return pods[i].Name < pods[j].Name
+		})
+		// New nodes show up on the next refresh, a failed lookup keeps the last one
+		if latest, err := nodeCapacities(ctx, client); err == nil {
+			capacities = latest
+		}
+		if latest, err := selectedNodes(ctx, client); err == nil {
+			nodes = latest
+		}
+		pods = filterPods(pods, capacities, nodes, now)
+
+		headers, rows := podRows(pods, capacities, currentRevisions(ctx, client, namespace), now)
+		var current map[string][]string
+		rows, current = highlightChanges(rows, previous)
+		previous = current
+
+		fmt.Print("\033[H\033[2J")
+		fmt.Printf("Every %s: %d pods, %s (Ctrl+C to stop)\n", podsRefresh, len(pods), now.Format("15:04:05"))
+		if notice != "" {
+			fmt.Println(notice)
+			notice = ""
+		}
+		fmt.Println()
+		podsTable.Print(headers, rows, nameColumn())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watchErr:
+			if err != nil {
+				return err
+			}
+			return nil
+		case <-ticker.C:
 		}
 	}
+}
 
-	printSeparator(widths)
-	fmt.Println("| " + joinRow(headers, widths) + " |")
-	printSeparator(widths)
-	for _, row := range rows {
-		fmt.Println("| " + joinRow(row, widths) + " |")
+// highlightChanges marks rows against the previous refresh: new pods green,
+// changed cells in reverse video and removed pods struck through. AGE is
+// left out since it changes all the time. It returns the marked rows and the
+// plain rows by pod to compare against next time.
+func highlightChanges(rows [][]string, previous map[string][]string) ([][]string, map[string][]string) {
+	const (
+		reset   = "\033[0m"
+		green   = "\033[32m"
+		reverse = "\033[7m"
+		strike  = "\033[9m"
+	)
+	current := make(map[string][]string, len(rows))
+	keys := make([]string, len(rows))
+	for i, row := range rows {
+		keys[i] = rowKey(row)
+		plain := make([]string, len(row))
+		for j, cell := range row {
+			plain[j] = table.StripANSI(cell)
+		}
+		current[keys[i]] = plain
+	}
+	// The first render has nothing to compare with
+	if previous == nil {
+		return rows, current
 	}
-	printSeparator(widths)
+
+	marked := make([][]string, 0, len(rows))
+	index := map[string]int{}
+	for i, row := range rows {
+		before, existed := previous[keys[i]]
+		out := make([]string, len(row))
+		for j, cell := range row {
+			switch {
+			case !existed:
+				out[j] = green + current[keys[i]][j] + reset
+			case j < len(row)-1 && before[j] != current[keys[i]][j]:
+				out[j] = reverse + current[keys[i]][j] + reset
+			default:
+				out[j] = cell
+			}
+		}
+		index[keys[i]] = len(marked)
+		marked = append(marked, out)
+	}
+
+	// Removed pods are inserted where they used to sort
+	var removed []string
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		out := make([]string, len(previous[key]))
+		for j, cell := range previous[key] {
+			out[j] = strike + cell + reset
+		}
+		pos := sort.Search(len(marked), func(i int) bool {
+			return rowKey(marked[i]) > key
+		})
+		marked = append(marked[:pos], append([][]string{out}, marked[pos:]...)...)
+	}
+	return marked, current
 }
 
-// displayWidth returns display length (excluding ANSI codes)
-func displayWidth(s string) int {
-	return len(stripANSI(s))
+// rowKey identifies the pod of a table row, sorting like the rows do
+func rowKey(row []string) string {
+	if podsAllNamespaces {
+		return table.StripANSI(row[0]) + "/" + table.StripANSI(row[1])
+	}
+	return table.StripANSI(row[0])
 }
 
-// stripANSI removes ANSI color codes for accurate width calculation
-func stripANSI(s string) string {
-	ansi := regexp.MustCompile("\\x1b\\[[0-9;]*m")
-	return ansi.ReplaceAllString(s, "")
+// podRecord is the JSON Lines representation of a pod
+type podRecord struct {
+	Event      string            `json:"event"`
+	Time       time.Time         `json:"time"`
+	Namespace  string            `json:"namespace"`
+	Name       string            `json:"name"`
+	Status     string            `json:"status"`
+	Ready      int               `json:"ready"`
+	Containers int               `json:"containers"`
+	Sidecars   int               `json:"sidecars,omitempty"` // native sidecars, included in ready and containers
+	Restarts   int32             `json:"restarts"`
+	IP         string            `json:"ip,omitempty"`
+	Node       string            `json:"node,omitempty"`
+	Images     []string          `json:"images"`
+	Created    time.Time         `json:"created"`
+	Deleted    *time.Time        `json:"deletion_timestamp,omitempty"`
+	Finalizers []string          `json:"finalizers,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Revision   string            `json:"revision,omitempty"` // pod-template-hash or controller-revision-hash
+}
+
+// streamPods prints pods as JSON Lines page by page, then follows changes with --watch.
+// Snapshot records have event "list", watch records "add", "update" or "delete".
+func streamPods(client *k8s.Client, namespace string, nodes map[string]bool) error {
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	enc := json.NewEncoder(os.Stdout)
+	emit := func(event string, pod *corev1.Pod) error {
+		if podsStuckTerminating && event != "delete" && !isStuckTerminating(pod, time.Now()) {
+			return nil
+		}
+		if event != "delete" && !podsAge.Match(pod.CreationTimestamp.Time, time.Now()) {
+			return nil
+		}
+		if nodes != nil && !nodes[pod.Spec.NodeName] {
+			return nil
+		}
+		return enc.Encode(newPodRecord(event, pod))
+	}
+
+	opts := podListOptions()
+	opts.Limit = listPageSize
+	var resourceVersion string
+	for {
+		page, err := client.Clientset.CoreV1().Pods(namespace).List(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list pods: %w", err)
+		}
+		for i := range page.Items {
+			if err := emit("list", &page.Items[i]); err != nil {
+				return err
+			}
+		}
+		resourceVersion = page.ResourceVersion
+		if page.Continue == "" {
+			break
+		}
+		opts.Continue = page.Continue
+	}
+
+	if !podsWatch {
+		return nil
+	}
+	return watchPods(ctx, client, namespace, resourceVersion, emit)
 }
 
-// joinRow left-aligns each cell and joins with column separator
-func joinRow(cols []string, widths []int) string {
-	parts := make([]string, len(cols))
-	for i, col := range cols {
-		pad := widths[i] - displayWidth(col)
-		if pad < 0 {
-			pad = 0
+// watchPods emits watch events from resourceVersion until ctx is cancelled.
+// The watch is re-established when the server closes it; an expired
+// resourceVersion is an error since events in between would be lost.
+func watchPods(ctx context.Context, client *k8s.Client, namespace, resourceVersion string, emit func(string, *corev1.Pod) error) error {
+	for {
+		opts := podListOptions()
+		opts.ResourceVersion = resourceVersion
+		w, err := client.Clientset.CoreV1().Pods(namespace).Watch(ctx, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to watch pods: %w", err)
+		}
+
+		for event := range w.ResultChan() {
+			if event.Type == watch.Error {
+				w.Stop()
+				if status, ok := event.Object.(*metav1.Status); ok && status.Code == 410 {
+					return fmt.Errorf("watch expired (%s), restart to get a fresh list", status.Message)
+				}
+				return fmt.Errorf("watch failed: %w", apierrors.FromObject(event.Object))
+			}
+
+			pod, ok := event.Object.(*corev1.Pod)
+			if !ok {
+				continue
+			}
+			resourceVersion = pod.ResourceVersion
+
+			var name string
+			switch event.Type {
+			case watch.Added:
+				name = "add"
+			case watch.Modified:
+				name = "update"
+			case watch.Deleted:
+				name = "delete"
+			default:
+				continue
+			}
+			if err := emit(name, pod); err != nil {
+				w.Stop()
+				return err
+			}
 		}
-		parts[i] = col + strings.Repeat(" ", pad)
+		w.Stop()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// newPodRecord converts a pod into its JSON Lines record
+func newPodRecord(event string, pod *corev1.Pod) podRecord {
+	counts := podstatus.ContainerCounts(pod)
+
+	images := make([]string, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	for _, c := range pod.Spec.InitContainers {
+		images = append(images, c.Image)
+	}
+	for _, c := range pod.Spec.Containers {
+		images = append(images, c.Image)
 	}
-	return strings.Join(parts, " | ")
+
+	record := podRecord{
+		Event:      event,
+		Time:       time.Now().UTC(),
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		Status:     podstatus.Reason(pod),
+		Ready:      counts.Ready + counts.SidecarsReady,
+		Containers: counts.Total + counts.Sidecars,
+		Sidecars:   counts.Sidecars,
+		Restarts:   counts.Restarts,
+		IP:         pod.Status.PodIP,
+		Node:       pod.Spec.NodeName,
+		Images:     images,
+		Created:    pod.CreationTimestamp.Time.UTC(),
+		Finalizers: pod.Finalizers,
+		Labels:     pod.Labels,
+	}
+	if revision := podRevision(pod); revision != "" {
+		record.Revision = shortRevision(pod, revision)
+	}
+	if pod.DeletionTimestamp != nil {
+		deleted := pod.DeletionTimestamp.Time.UTC()
+		record.Deleted = &deleted
+	}
+	return record
+}
+
+// formatReady renders ready/total like kubectl, which counts native sidecars,
+// and adds the sidecar share so they are not mistaken for app containers
+func formatReady(counts podstatus.Counts) string {
+	ready := fmt.Sprintf("%d/%d", counts.Ready+counts.SidecarsReady, counts.Total+counts.Sidecars)
+	if counts.Sidecars > 0 {
+		ready += fmt.Sprintf(" (%d/%d sidecar)", counts.SidecarsReady, counts.Sidecars)
+	}
+	return ready
+}
+
+// formatStatus renders the kubectl status with pending readiness gates and,
+// for pods being deleted, how long they have been terminating
+func formatStatus(pod *corev1.Pod, now time.Time) string {
+	status := podstatus.Reason(pod)
+	colored := colorStatus(status)
+	if status == "Terminating" {
+		return colored + terminatingDetails(pod, now)
+	}
+	if ready, total := podstatus.ReadinessGates(pod); ready < total {
+		colored += fmt.Sprintf(" (readiness gates %d/%d)", ready, total)
+	}
+	return colored
+}
+
+// terminatingSince returns when deletion of the pod was requested.
+// DeletionTimestamp is the deadline (request time + grace period).
+func terminatingSince(pod *corev1.Pod) time.Time {
+	since := pod.DeletionTimestamp.Time
+	if pod.DeletionGracePeriodSeconds != nil {
+		since = since.Add(-time.Duration(*pod.DeletionGracePeriodSeconds) * time.Second)
+	}
+	return since
+}
+
+// terminatingDetails describes how long the pod has been terminating and the
+// finalizers that still block its removal
+func terminatingDetails(pod *corev1.Pod, now time.Time) string {
+	details := " (" + utils.FormatAge(now.Sub(terminatingSince(pod)))
+	if len(pod.Finalizers) > 0 {
+		details += ", finalizers: " + strings.Join(pod.Finalizers, ",")
+	}
+	return details + ")"
+}
+
+// isStuckTerminating reports whether the pod is still present after its
+// deletion grace period has expired
+func isStuckTerminating(pod *corev1.Pod, now time.Time) bool {
+	return pod.DeletionTimestamp != nil && now.After(pod.DeletionTimestamp.Time)
 }
 
-// printSeparator prints border line based on column widths
-func printSeparator(widths []int) {
-	b := strings.Builder{}
-	b.WriteString("+")
-	for i, w := range widths {
-		b.WriteString(strings.Repeat("-", w+2))
-		if i == len(widths)-1 {
-			b.WriteString("+")
+// forceDeletePods deletes the given pods with a zero grace period after confirmation.
+// Pods that are blocked by finalizers stay until the finalizers are removed.
+func forceDeletePods(client *k8s.Client, pods []corev1.Pod) error {
+	if len(pods) == 0 {
+		fmt.Println("No stuck terminating pods found")
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Println("Force deletion skips graceful shutdown; the containers may still be running on the node.")
+	if !podsForceDeleteAssume {
+		if !utils.Confirm(client.Context, os.Stdout, fmt.Sprintf("Force delete %d pod(s)? [y/N]: ", len(pods))) {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+
+	grace := int64(0)
+	var failed int
+	for _, pod := range pods {
+		err := client.Clientset.CoreV1().Pods(pod.Namespace).Delete(client.Context, pod.Name, metav1.DeleteOptions{
+			GracePeriodSeconds: &grace,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to delete %s/%s: %v\n", pod.Namespace, pod.Name, err)
+			failed++
+			continue
+		}
+		if len(pod.Finalizers) > 0 {
+			fmt.Printf("Force deleted %s/%s (still blocked by finalizers: %s, see kube-unstick pod/%s -n %s)\n",
+				pod.Namespace, pod.Name, strings.Join(pod.Finalizers, ","), pod.Name, pod.Namespace)
 		} else {
-			b.WriteString("+")
+			fmt.Printf("Force deleted %s/%s\n", pod.Namespace, pod.Name)
 		}
 	}
-	fmt.Println(b.String())
+
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d pod(s)", failed)
+	}
+	return nil
+}
+
+// runDrift checks one pod in detail, or all pods of the namespace
+func runDrift(cmd *cobra.Command, args []string) error {
+	if err := podsDriftTable.Validate(); err != nil {
+		return err
+	}
+	if len(args) == 1 && podsAllNamespaces {
+		return clierr.Usagef("--all-namespaces cannot be used with a pod name")
+	}
+
+	client, err := k8s.NewClient("", podsContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	namespace := podsNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(podsContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	if podsAllNamespaces {
+		namespace = ""
+	}
+
+	var pods []corev1.Pod
+	if len(args) == 1 {
+		pod, err := target.ResolvePod(ctx, client.Clientset, namespace, args[0])
+		if err != nil {
+			return err
+		}
+		pods = []corev1.Pod{*pod}
+	} else {
+		list, err := client.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list pods: %w", err)
+		}
+		pods = list.Items
+	}
+
+	const (
+		reset = "\033[0m"
+		red   = "\033[31m"
+	)
+	checker := drift.NewChecker(client.Clientset, podsDriftRegistry)
+	now := time.Now()
+	var rows [][]string
+	checked, drifted := 0, 0
+	warned := map[string]bool{}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		report, err := checker.Pod(ctx, pod, now)
+		if err != nil {
+			return err
+		}
+		checked++
+		if len(args) == 1 {
+			owner := report.Owner
+			if owner == "" {
+				owner = "no workload, template not compared"
+			}
+			fmt.Fprintf(os.Stderr, "Pod %s/%s (%s)\n", pod.Namespace, pod.Name, owner)
+		}
+		for _, warning := range report.Warnings {
+			// Unreadable Secrets are shared by all pods of a workload, say it once
+			if !warned[warning] {
+				warned[warning] = true
+				fmt.Fprintf(os.Stderr, "Warning: %s/%s: %s\n", pod.Namespace, pod.Name, warning)
+			}
+		}
+		if len(report.Findings) > 0 {
+			drifted++
+		}
+		for _, f := range report.Findings {
+			row := []string{pod.Name, f.Container, f.Check, f.Expected, red + f.Actual + reset}
+			if len(args) == 0 {
+				owner := report.Owner
+				if owner == "" {
+					owner = "-"
+				}
+				row = append([]string{pod.Name, owner}, row[1:]...)
+			}
+			if podsAllNamespaces {
+				row = append([]string{pod.Namespace}, row...)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if drifted == 0 {
+		fmt.Println("No drift found")
+		return nil
+	}
+	headers := []string{"POD", "CONTAINER", "CHECK", "EXPECTED", "ACTUAL"}
+	if len(args) == 0 {
+		headers = []string{"POD", "OWNER", "CONTAINER", "CHECK", "EXPECTED", "ACTUAL"}
+	}
+	if podsAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+	podsDriftTable.Print(headers, rows, nameColumn())
+	return clierr.Newf(clierr.Generic, "found drift in %d of %d pods", drifted, checked)
+}
+
+// runRestart deletes a pod and optionally waits for its replacement
+func runRestart(cmd *cobra.Command, args []string) error {
+	if podsAllNamespaces {
+		return clierr.Usagef("--all-namespaces cannot be used with restart")
+	}
+	if podsRestartTimeout <= 0 {
+		return clierr.Usagef("--timeout must be positive")
+	}
+
+	client, err := k8s.NewClient("", podsContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	namespace := podsNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(podsContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	pod, err := target.ResolvePod(ctx, client.Clientset, namespace, args[0])
+	if err != nil {
+		return err
+	}
+	if pod.DeletionTimestamp != nil {
+		return clierr.Newf(clierr.Conflict, "pod %s/%s is already terminating", pod.Namespace, pod.Name)
+	}
+
+	owner := metav1.GetControllerOf(pod)
+	switch {
+	case owner != nil && owner.Kind == "Node":
+		return clierr.Newf(clierr.Generic, "pod %s/%s is a static pod of node %s: deleting it does not restart it, change its manifest on the node instead", pod.Namespace, pod.Name, owner.Name)
+	case owner == nil && !podsRestartForce:
+		return clierr.Usagef("pod %s/%s has no controller and will not be recreated, use --force to delete it anyway", pod.Namespace, pod.Name)
+	case owner == nil:
+		fmt.Fprintf(os.Stderr, "Warning: pod %s/%s has no controller, nothing will replace it\n", pod.Namespace, pod.Name)
+	}
+
+	// Pods of the controller that exist now are not the replacement
+	existing := map[string]bool{}
+	if owner != nil {
+		list, err := client.Clientset.CoreV1().Pods(pod.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list pods: %w", err)
+		}
+		for _, p := range list.Items {
+			existing[string(p.UID)] = true
+		}
+	}
+
+	// The UID precondition keeps a StatefulSet pod recreated meanwhile safe
+	options := metav1.DeleteOptions{Preconditions: metav1.NewUIDPreconditions(string(pod.UID))}
+	if podsRestartGrace >= 0 {
+		options.GracePeriodSeconds = &podsRestartGrace
+	}
+	if err := client.Clientset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, options); err != nil {
+		return fmt.Errorf("failed to delete pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	if owner == nil {
+		fmt.Printf("Deleted pod %s/%s\n", pod.Namespace, pod.Name)
+		return nil
+	}
+	fmt.Printf("Deleted pod %s/%s, %s %s will replace it\n", pod.Namespace, pod.Name, owner.Kind, owner.Name)
+	if !podsRestartWait {
+		return nil
+	}
+
+	started := time.Now()
+	deadline := started.Add(podsRestartTimeout)
+	last := ""
+	for {
+		replacement, err := findReplacement(ctx, client, pod.Namespace, owner.UID, existing)
+		if err != nil {
+			return err
+		}
+		if replacement != nil && podstatus.IsReady(replacement) {
+			fmt.Printf("Replacement pod %s is ready after %s\n", replacement.Name, time.Since(started).Round(time.Second))
+			return nil
+		}
+
+		state := "waiting for the controller to create it"
+		if replacement != nil {
+			state = fmt.Sprintf("%s %s", replacement.Name, podstatus.Reason(replacement))
+		}
+		if state != last {
+			fmt.Printf("Replacement: %s\n", state)
+			last = state
+		}
+		if time.Now().After(deadline) {
+			return clierr.Timeoutf("timeout waiting for the replacement of pod %s/%s to become ready", pod.Namespace, pod.Name)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// findReplacement returns the newest pod of the controller that did not
+// exist before the restart, nil while there is none
+func findReplacement(ctx context.Context, client *k8s.Client, namespace string, owner types.UID, existing map[string]bool) (*corev1.Pod, error) {
+	list, err := client.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	var newest *corev1.Pod
+	for i := range list.Items {
+		p := &list.Items[i]
+		ref := metav1.GetControllerOf(p)
+		if ref == nil || ref.UID != owner || existing[string(p.UID)] || p.DeletionTimestamp != nil {
+			continue
+		}
+		if newest == nil || p.CreationTimestamp.After(newest.CreationTimestamp.Time) {
+			newest = p
+		}
+	}
+	return newest, nil
+}
+
+// pendingEviction is an evicted pod whose replacement is not ready yet
+type pendingEviction struct {
+	pod      corev1.Pod
+	owner    *metav1.OwnerReference
+	existing map[string]bool
+	started  time.Time
+}
+
+// runEvict evicts the pods of a selector, keeping at most --max-unavailable
+// of them evicted and not replaced
+func runEvict(cmd *cobra.Command, args []string) error {
+	if podsEvictSelector == "" {
+		return clierr.Usagef("a label selector is required (-l app=worker)")
+	}
+	if podsEvictMax < 1 {
+		return clierr.Usagef("--max-unavailable must be at least 1")
+	}
+	if podsEvictTimeout <= 0 {
+		return clierr.Usagef("--timeout must be positive")
+	}
+
+	client, err := k8s.NewClient("", podsContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	namespace := podsNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(podsContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	if podsAllNamespaces {
+		namespace = ""
+	}
+
+	list, err := client.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: podsEvictSelector})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	var pods []corev1.Pod
+	for _, pod := range list.Items {
+		owner := metav1.GetControllerOf(&pod)
+		switch {
+		case pod.DeletionTimestamp != nil, pod.Status.Phase == corev1.PodSucceeded, pod.Status.Phase == corev1.PodFailed:
+			continue
+		case owner != nil && owner.Kind == "Node":
+			fmt.Fprintf(os.Stderr, "Warning: skipping static pod %s/%s, it belongs to the kubelet\n", pod.Namespace, pod.Name)
+			continue
+		case owner == nil && !podsEvictForce:
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s/%s, it has no controller and would not be recreated (use --force)\n", pod.Namespace, pod.Name)
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	if len(pods) == 0 {
+		fmt.Println("No pods to evict")
+		return nil
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
+
+	budgets, err := podBudgets(ctx, client, pods)
+	if err != nil {
+		return err
+	}
+	headers := []string{"POD", "NODE", "OWNER", "DISRUPTION-BUDGET"}
+	rows := make([][]string, 0, len(pods))
+	for _, pod := range pods {
+		owner := "-"
+		if ref := metav1.GetControllerOf(&pod); ref != nil {
+			owner = ref.Kind + "/" + ref.Name
+		}
+		row := []string{pod.Name, utils.OrDash(pod.Spec.NodeName), owner, utils.OrDash(budgets[string(pod.UID)])}
+		if podsAllNamespaces {
+			row = append([]string{pod.Namespace}, row...)
+		}
+		rows = append(rows, row)
+	}
+	if podsAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+	table.Render(headers, rows)
+	if podsEvictDryRun {
+		fmt.Printf("\n%d pod(s) would be evicted, at most %d at a time (dry run)\n", len(pods), podsEvictMax)
+		return nil
+	}
+	if !podsEvictAssume {
+		if !utils.Confirm(ctx, os.Stdout, fmt.Sprintf("\nEvict %d pod(s), at most %d at a time? [y/N]: ", len(pods), podsEvictMax)) {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+	fmt.Println()
+
+	queue := pods
+	var pending []pendingEviction
+	evicted, replaced := 0, 0
+	blocked := map[string]string{}
+	deadline := time.Now().Add(podsEvictTimeout)
+	for len(queue) > 0 || len(pending) > 0 {
+		// Settle evictions whose replacement became ready
+		var still []pendingEviction
+		for _, p := range pending {
+			done, replacement, err := evictionSettled(ctx, client, p)
+			if err != nil {
+				return err
+			}
+			if !done {
+				still = append(still, p)
+				continue
+			}
+			replaced++
+			if replacement == nil {
+				fmt.Printf("[%d/%d] %s/%s is gone\n", replaced, len(pods), p.pod.Namespace, p.pod.Name)
+				continue
+			}
+			fmt.Printf("[%d/%d] %s/%s replaced by %s, ready after %s\n", replaced, len(pods), p.pod.Namespace, p.pod.Name,
+				replacement.Name, time.Since(p.started).Round(time.Second))
+			// Another eviction of the same controller must not count this pod too
+			for _, other := range pending {
+				other.existing[string(replacement.UID)] = true
+			}
+		}
+		pending = still
+
+		for len(pending) < podsEvictMax && len(queue) > 0 {
+			pod := queue[0]
+			existing, err := namespacePodUIDs(ctx, client, pod.Namespace)
+			if err != nil {
+				return err
+			}
+			err = client.Clientset.CoreV1().Pods(pod.Namespace).EvictV1(ctx, &policyv1.Eviction{
+				ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+				DeleteOptions: &metav1.DeleteOptions{Preconditions: metav1.NewUIDPreconditions(string(pod.UID))},
+			})
+			if apierrors.IsTooManyRequests(err) {
+				// The budget allows no disruption now, retry once replacements are ready
+				if message := apierrors.ReasonForError(err); blocked[pod.Name] != string(message) {
+					blocked[pod.Name] = string(message)
+					fmt.Printf("Waiting: eviction of %s/%s is not allowed yet: %v\n", pod.Namespace, pod.Name, err)
+				}
+				break
+			}
+			queue = queue[1:]
+			if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+				// Deleted or recreated meanwhile, nothing left to evict
+				fmt.Printf("%s/%s is already gone\n", pod.Namespace, pod.Name)
+				replaced++
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to evict %s/%s after %d evictions: %w", pod.Namespace, pod.Name, evicted, err)
+			}
+			evicted++
+			fmt.Printf("Evicted %s/%s (%d/%d)\n", pod.Namespace, pod.Name, evicted, len(pods))
+			pending = append(pending, pendingEviction{pod: pod, owner: metav1.GetControllerOf(&pod), existing: existing, started: time.Now()})
+		}
+
+		if len(queue) == 0 && len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return clierr.Timeoutf("timeout after evicting %d of %d pods (%d not replaced yet)", evicted, len(pods), len(pending))
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped after evicting %d of %d pods (%d not replaced yet)", evicted, len(pods), len(pending))
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	fmt.Printf("\nEvicted %d pod(s)\n", evicted)
+	return nil
+}
+
+// evictionSettled reports whether an evicted pod was replaced by a ready pod
+// of its controller, or is gone when it has none
+func evictionSettled(ctx context.Context, client *k8s.Client, p pendingEviction) (bool, *corev1.Pod, error) {
+	if p.owner == nil {
+		current, err := client.Clientset.CoreV1().Pods(p.pod.Namespace).Get(ctx, p.pod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) || (err == nil && current.UID != p.pod.UID) {
+			return true, nil, nil
+		}
+		return false, nil, err
+	}
+	replacement, err := findReplacement(ctx, client, p.pod.Namespace, p.owner.UID, p.existing)
+	if err != nil || replacement == nil || !podstatus.IsReady(replacement) {
+		return false, nil, err
+	}
+	return true, replacement, nil
+}
+
+// namespacePodUIDs returns the UIDs of the pods of a namespace
+func namespacePodUIDs(ctx context.Context, client *k8s.Client, namespace string) (map[string]bool, error) {
+	list, err := client.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	uids := make(map[string]bool, len(list.Items))
+	for _, p := range list.Items {
+		uids[string(p.UID)] = true
+	}
+	return uids, nil
+}
+
+// podBudgets returns the PodDisruptionBudgets covering each pod, by pod UID,
+// with the disruptions they currently allow
+func podBudgets(ctx context.Context, client *k8s.Client, pods []corev1.Pod) (map[string]string, error) {
+	budgets := map[string]string{}
+	seen := map[string]bool{}
+	for _, pod := range pods {
+		if seen[pod.Namespace] {
+			continue
+		}
+		seen[pod.Namespace] = true
+		list, err := client.Clientset.PolicyV1().PodDisruptionBudgets(pod.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list poddisruptionbudgets: %w", err)
+		}
+		for _, pdb := range list.Items {
+			selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+			if err != nil || selector.Empty() {
+				continue
+			}
+			for _, p := range pods {
+				if p.Namespace != pdb.Namespace || !selector.Matches(labels.Set(p.Labels)) {
+					continue
+				}
+				entry := fmt.Sprintf("%s (%d allowed)", pdb.Name, pdb.Status.DisruptionsAllowed)
+				if budgets[string(p.UID)] != "" {
+					entry = budgets[string(p.UID)] + ", " + entry
+				}
+				budgets[string(p.UID)] = entry
+			}
+		}
+	}
+	return budgets, nil
+}
+
+// init initializes flags for kube-pods command
+func init() {
+	// Define flags
+	podsRootCmd.PersistentFlags().StringVarP(&podsNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	podsRootCmd.PersistentFlags().StringVarP(&podsContext, "context", "c", "", "Kubernetes context to use")
+	podsRootCmd.PersistentFlags().BoolVarP(&podsAllNamespaces, "all-namespaces", "A", false, "Show pods from all namespaces")
+	podsRootCmd.Flags().BoolVar(&podsStuckTerminating, "stuck-terminating", false, "Only show pods still terminating after their grace period")
+	podsRootCmd.Flags().BoolVar(&podsForceDelete, "force-delete", false, "Force delete the listed stuck terminating pods (grace period 0)")
+	podsRootCmd.Flags().BoolVarP(&podsForceDeleteAssume, "yes", "y", false, "Do not ask for confirmation with --force-delete")
+	// jsonl prints one JSON object per pod
+	podsTable.AddFlags(podsRootCmd, "jsonl")
+	podsAge.AddFlags(podsRootCmd)
+	podsRootCmd.Flags().BoolVarP(&podsWatch, "watch", "w", false, "With -o jsonl, keep streaming add/update/delete events")
+	podsRootCmd.Flags().BoolVar(&podsConditions, "conditions", false, "Show pod conditions and readiness gates instead of IP, node and images")
+	podsRootCmd.Flags().BoolVar(&podsOnSpot, "on-spot", false, "Only show pods on spot/preemptible nodes")
+	podsRootCmd.Flags().BoolVar(&podsOnDemand, "on-demand", false, "Only show pods on on-demand nodes")
+	podsRootCmd.Flags().StringVarP(&podsSelector, "selector", "l", "", "Only show pods matching this label selector, e.g. app=backend")
+	podsRootCmd.Flags().StringVar(&podsNode, "node", "", "Only show pods on this node")
+	podsRootCmd.Flags().StringVar(&podsNodeSelector, "node-selector", "", "Only show pods on nodes matching this label selector, e.g. karpenter.sh/nodepool=gpu")
+	podsRootCmd.Flags().BoolVar(&podsMemoryPressure, "memory-pressure", false, "Show memory usage of every container against its limit, closest to OOM first (needs metrics-server)")
+	podsRootCmd.Flags().IntVar(&podsMemoryThreshold, "memory-threshold", 80, "With --memory-pressure, highlight usage at or above this percentage of the limit")
+	podsRootCmd.Flags().DurationVar(&podsRefresh, "refresh", 0, "Re-render the table on this interval, highlighting changes (e.g. 5s)")
+
+	driftPodsCmd.Flags().BoolVar(&podsDriftRegistry, "registry", false, "Resolve image tags in the registry instead of comparing with sibling pods")
+	podsDriftTable.AddFlags(driftPodsCmd)
+	restartPodsCmd.Flags().BoolVar(&podsRestartForce, "force", false, "Delete the pod even when no controller will recreate it")
+	restartPodsCmd.Flags().BoolVar(&podsRestartWait, "wait", false, "Wait until the replacement pod is ready and print its name")
+	restartPodsCmd.Flags().DurationVar(&podsRestartTimeout, "timeout", 5*time.Minute, "Maximum time to wait with --wait")
+	restartPodsCmd.Flags().Int64Var(&podsRestartGrace, "grace-period", -1, "Seconds to let the pod shut down (default: the pod's terminationGracePeriodSeconds)")
+	evictPodsCmd.Flags().StringVarP(&podsEvictSelector, "selector", "l", "", "Label selector of the pods to evict (required)")
+	evictPodsCmd.Flags().IntVar(&podsEvictMax, "max-unavailable", 1, "Maximum number of evicted pods not replaced by a ready pod yet")
+	evictPodsCmd.Flags().BoolVar(&podsEvictForce, "force", false, "Also evict pods without a controller, they are not recreated")
+	evictPodsCmd.Flags().DurationVar(&podsEvictTimeout, "timeout", 30*time.Minute, "Maximum time for all evictions")
+	evictPodsCmd.Flags().BoolVar(&podsEvictDryRun, "dry-run", false, "Only list the pods and their disruption budgets")
+	evictPodsCmd.Flags().BoolVarP(&podsEvictAssume, "yes", "y", false, "Do not ask for confirmation")
+	podsRootCmd.AddCommand(driftPodsCmd, restartPodsCmd, evictPodsCmd)
+
+	// Bind flags with viper
+	viper.BindPFlag("namespace", podsRootCmd.PersistentFlags().Lookup("namespace"))
+	viper.BindPFlag("context", podsRootCmd.PersistentFlags().Lookup("context"))
 }
 
 // extractImageVersion extracts the version part (tag or shortened digest) from image name
@@ -230,13 +1751,13 @@ func extractImageVersion(image string) string {
 	return "latest"
 }
 
-// colorStatus colors STATUS text by phase for easy identification
+// colorStatus colors STATUS text for easy identification
 // - Running: green
-// - Pending: yellow
-// - Succeeded: light blue
-// - Failed: red
+// - Pending, Terminating, NotReady and progress (Init:1/3, ContainerCreating): yellow
+// - Succeeded/Completed: light blue
+// - Failed and error reasons (CrashLoopBackOff, ImagePullBackOff, Init:Error, ...): red
 // - Unknown: gray
-func colorStatus(phase string) string {
+func colorStatus(status string) string {
 	const (
 		reset  = "\033[0m"
 		green  = "\033[32m"
@@ -245,24 +1766,42 @@ func colorStatus(phase string) string {
 		blue   = "\033[36m"
 		gray   = "\033[90m"
 	)
-	switch phase {
+	if strings.HasPrefix(status, "Init:") {
+		// Init:1/3 is progress, anything else is an init failure
+		if _, progress, _ := strings.Cut(status, ":"); strings.Contains(progress, "/") {
+			return yellow + status + reset
+		}
+		return red + status + reset
+	}
+
+	switch status {
 	case "Running":
-		return green + phase + reset
-	case "Pending":
-		return yellow + phase + reset
-	case "Failed":
-		return red + phase + reset
-	case "Succeeded":
-		return blue + phase + reset
+		return green + status + reset
+	case "Pending", "Terminating", "NotReady", "ContainerCreating", "PodInitializing", "SchedulingGated":
+		return yellow + status + reset
+	case "Succeeded", "Completed":
+		return blue + status + reset
+	case "Unknown":
+		return gray + status + reset
 	default:
-		return gray + phase + reset
+		// Failed and container reasons like CrashLoopBackOff, ErrImagePull, OOMKilled, Evicted
+		return red + status + reset
 	}
 }
 
 // main is the entry point of kube-pods
 func main() {
-	if err := podsRootCmd.Execute(); err != nil {
+	k8s.AddVerbosityFlag(podsRootCmd)
+	k8s.AddRateLimitFlags(podsRootCmd)
+	k8s.AddFromDirFlag(podsRootCmd)
+	config.SetupDefaults(podsRootCmd)
+	clierr.SetupUsage(podsRootCmd)
+	cmd, err := podsRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(clierr.ExitCode(err))
 	}
 }
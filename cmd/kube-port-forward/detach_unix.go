@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts the tunnel process in its own session, so it has no
+// controlling terminal and closing the terminal does not stop it
+func detach(child *exec.Cmd) {
+	child.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts the tunnel process in its own process group, so Ctrl+C in
+// the console does not reach it
+func detach(child *exec.Cmd) {
+	child.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
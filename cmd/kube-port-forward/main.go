@@ -1,29 +1,83 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/target"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/state"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/portforward"
 	"k8s.io/client-go/transport/spdy"
 )
 
 var (
-	portForwardNamespace   string
-	portForwardKubeContext string
+	portForwardNamespace      string
+	portForwardKubeContext    string
+	portForwardLogConnections bool
+	portForwardHTTPLog        bool
+	portForwardStatsInterval  time.Duration
+	portForwardDaemonize      bool
+	portForwardTable          table.Options
 )
 
+// tunnelEnv carries the tunnel ID to the background process started by
+// --daemonize; the local port doubles as the ID
+const tunnelEnv = "KUBE_PORT_FORWARD_TUNNEL"
+
+// tunnel is the state file of a backgrounded port-forward
+type tunnel struct {
+	ID         string    `json:"id"`
+	PID        int       `json:"pid"`
+	Context    string    `json:"context"`
+	Namespace  string    `json:"namespace"`
+	Target     string    `json:"target"`
+	Pod        string    `json:"pod"`
+	LocalPort  int       `json:"localPort"`
+	RemotePort int       `json:"remotePort"`
+	Started    time.Time `json:"started"`
+	Log        string    `json:"log"`
+}
+
+// maxLoggedURI keeps access log lines on one line
+const maxLoggedURI = 100
+
+// connStats counts connections and bytes through the local listener
+type connStats struct {
+	next     atomic.Int64
+	active   atomic.Int64
+	total    atomic.Int64
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
 var portForwardRootCmd = &cobra.Command{
 	Use:   "kube-port-forward [pod-name|svc/<service-name>] [local-port]:[remote-port]",
 	Short: "Port-forward a local port to a pod (or service)",
@@ -31,27 +85,117 @@ var portForwardRootCmd = &cobra.Command{
     
 You can target a pod directly or a service via svc/<service-name>.
 When targeting a service, the tool will select a backing pod from the Endpoints of that service.
+Prefix the name with a namespace to skip -n: my-ns/my-pod or svc/my-ns/my-svc.
+Target expressions pick a ready pod of a workload or selector:
+  @latest:deploy/<name>    newest ready pod (also sts/, ds/, rs/, job/, svc/)
+  @random:-l <selector>    random ready pod matching the label selector
 
 Port format: [local-port]:[remote-port]
 If only one port is provided, it will be used for both local and remote.
 
+- alone repeats the last port-forward, with its target, ports and context.
+With ports, - is the pod last used by kube-logs, kube-exec or
+kube-port-forward.
+
+With --log-connections every accepted local connection is logged with the
+bytes sent and received when it closes, and a stats line (active and total
+connections, total bytes) is printed every --stats-interval. Handy to tell
+whether an app is hitting the tunnel at all.
+
+With --http-log the traffic is read as HTTP/1.x and every request is logged
+with its method, path, status, latency until the response headers and the
+response body size, like an access log. Inspection never slows the tunnel
+down: connections that are not plain HTTP (TLS, HTTP/2, databases) are
+relayed without it, and so is traffic the log cannot keep up with.
+
+With -d/--daemonize the forward keeps running in the background once the
+tunnel is up, like ssh -f. Its ID is the local port and its output goes to a
+log file in $XDG_STATE_HOME/kube-cmd/port-forward. Use the status and stop
+subcommands to manage backgrounded tunnels.
+
 Examples:
   kube-port-forward my-pod 8080:80         # Forward local 8080 -> pod 80
-  kube-port-forward svc/my-service 3000    # Forward local 3000 -> service 3000`,
-	Args: cobra.ExactArgs(2),
+  kube-port-forward svc/my-service 3000    # Forward local 3000 -> service 3000
+  kube-port-forward @latest:deploy/api 80  # Newest ready pod of deployment api
+  kube-port-forward svc/db/postgres 5432   # Service postgres in namespace db
+  kube-port-forward -                      # Repeat the last port-forward
+  kube-port-forward - 9090:9090            # The pod last used, another port
+  kube-port-forward my-pod 8080:80 --log-connections --stats-interval 10s
+  kube-port-forward svc/api 8080:80 --http-log  # Access log of the requests
+  kube-port-forward svc/postgres 5432 -d   # Keep forwarding in the background
+  kube-port-forward status                 # List backgrounded tunnels
+  kube-port-forward stop 5432              # Stop one (or: stop all)`,
+	Args: cobra.RangeArgs(1, 2),
 	RunE: runPortForward,
 }
 
+var portForwardStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List port-forwards running in the background",
+	Args:  cobra.NoArgs,
+	RunE:  runStatus,
+}
+
+var portForwardStopCmd = &cobra.Command{
+	Use:   "stop <id|all>...",
+	Short: "Stop port-forwards running in the background",
+	Long: `Stop backgrounded port-forwards by ID (their local port), or all of them.
+
+Examples:
+  kube-port-forward stop 8080
+  kube-port-forward stop all`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runStop,
+}
+
 // runPortForward executes port-forward logic
 func runPortForward(cmd *cobra.Command, args []string) error {
-	target := args[0]
-	portSpec := args[1]
+	targetRef := args[0]
+	portSpec := ""
+	if len(args) == 2 {
+		portSpec = args[1]
+	}
+
+	// - repeats the last port-forward, or with ports the last used pod
+	switch {
+	case targetRef == state.Last && portSpec == "":
+		last, err := state.LastForward()
+		if err != nil {
+			return err
+		}
+		targetRef, portSpec = last.Target, last.Ports
+		if portForwardKubeContext == "" {
+			portForwardKubeContext = last.Context
+		}
+		if portForwardNamespace == "" {
+			portForwardNamespace = last.Namespace
+		}
+		fmt.Fprintf(os.Stderr, "Repeating port-forward %s %s\n", targetRef, portSpec)
+	case targetRef == state.Last:
+		last, err := state.LastPod()
+		if err != nil {
+			return err
+		}
+		targetRef = last.Namespace + "/" + last.Name
+		if portForwardKubeContext == "" {
+			portForwardKubeContext = last.Context
+		}
+	case portSpec == "":
+		return clierr.Usagef("a port specification is required, e.g. 8080:80")
+	}
 
 	// Parse port specification
 	localPort, remotePort, err := parsePortSpec(portSpec)
 	if err != nil {
 		return fmt.Errorf("invalid port specification '%s': %w", portSpec, err)
 	}
+	if portForwardStatsInterval <= 0 {
+		return clierr.Usagef("--stats-interval must be positive")
+	}
+	tunnelID := os.Getenv(tunnelEnv)
+	if portForwardDaemonize && tunnelID == "" {
+		return daemonize(localPort)
+	}
 
 	client, err := k8s.NewClient("", portForwardKubeContext)
 	if err != nil {
@@ -68,11 +212,20 @@ func runPortForward(cmd *cobra.Command, args []string) error {
 		targetNamespace = ns
 	}
 
-	// Resolve target pod: direct pod or svc/<name>
-	podName, err := resolveTargetPod(context.Background(), client, targetNamespace, target)
+	// Ctrl+C stops the forward, also while the target is still being resolved
+	ctx, stop := interrupt.Context(context.Background())
+	defer stop()
+
+	// Resolve target pod: direct pod, svc/<name> or an expression, optionally
+	// qualified with a namespace
+	pod, err := target.ResolvePod(ctx, client.Clientset, targetNamespace, targetRef)
 	if err != nil {
 		return err
 	}
+	podName := pod.Name
+	targetNamespace = pod.Namespace
+	state.RememberPod(state.Pod{Context: portForwardKubeContext, Namespace: targetNamespace, Name: podName})
+	state.RememberForward(state.Forward{Context: portForwardKubeContext, Namespace: targetNamespace, Target: targetRef, Ports: portSpec})
 
 	// Create URL for port-forward request
 	url := client.Clientset.CoreV1().RESTClient().Post().
@@ -81,10 +234,19 @@ func runPortForward(cmd *cobra.Command, args []string) error {
 		Name(podName).
 		SubResource("portforward").URL()
 
+	_, span := tracing.Start(ctx, "port-forward", map[string]interface{}{
+		"k8s.namespace.name": targetNamespace,
+		"k8s.pod.name":       podName,
+		"local.port":         localPort,
+		"remote.port":        remotePort,
+	})
+
 	// Create SPDY transport
 	transport, upgrader, err := spdy.RoundTripperFor(client.Config)
 	if err != nil {
-		return fmt.Errorf("failed to create SPDY transport: %w", err)
+		err = fmt.Errorf("failed to create SPDY transport: %w", err)
+		span.End(err)
+		return err
 	}
 
 	// Create dialer
@@ -94,42 +256,585 @@ func runPortForward(cmd *cobra.Command, args []string) error {
 	stopCh := make(chan struct{}, 1)
 	readyCh := make(chan struct{})
 
-	// Setup signal handling
-	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
-
+	// Close the tunnel on a signal or when returning early
 	go func() {
-		<-signalCh
-		fmt.Println("\nStopping port forward...")
+		<-ctx.Done()
+		if interrupt.Received() {
+			fmt.Println("\nStopping port forward...")
+		}
 		close(stopCh)
 	}()
 
+	// With --log-connections and --http-log we accept local connections
+	// ourselves and relay them to the tunnel on a random loopback port,
+	// counting the bytes and reading the HTTP requests
+	var listener net.Listener
+	forwardPort := localPort
+	var pfOut io.Writer = os.Stdout
+	if portForwardLogConnections || portForwardHTTPLog {
+		listener, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+		if err != nil {
+			err = fmt.Errorf("failed to listen on port %d: %w", localPort, err)
+			span.End(err)
+			return err
+		}
+		defer listener.Close()
+		forwardPort = 0
+		pfOut = io.Discard
+	}
+
 	// Create port forwarder
-	ports := []string{fmt.Sprintf("%d:%d", localPort, remotePort)}
-	pf, err := portforward.New(dialer, ports, stopCh, readyCh, os.Stdout, os.Stderr)
+	ports := []string{fmt.Sprintf("%d:%d", forwardPort, remotePort)}
+	pf, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, ports, stopCh, readyCh, pfOut, os.Stderr)
 	if err != nil {
-		return fmt.Errorf("failed to create port forwarder: %w", err)
+		err = fmt.Errorf("failed to create port forwarder: %w", err)
+		span.End(err)
+		return err
 	}
 
 	// Start port-forwarding in a goroutine
+	forwardErr := make(chan error, 1)
 	go func() {
-		if err := pf.ForwardPorts(); err != nil {
-			fmt.Fprintf(os.Stderr, "Port forwarding error: %v\n", err)
-		}
+		forwardErr <- pf.ForwardPorts()
 	}()
 
-	// Wait for ready signal
-	<-readyCh
+	// Wait for ready signal, or the forwarder failing to start
+	select {
+	case <-readyCh:
+	case err := <-forwardErr:
+		err = fmt.Errorf("port forwarding failed: %w", err)
+		span.End(err)
+		return err
+	}
 
 	fmt.Printf("Forwarding from 127.0.0.1:%d -> %s:%d\n", localPort, podName, remotePort)
-	fmt.Printf("Press Ctrl+C to stop\n")
+	if tunnelID == "" {
+		fmt.Printf("Press Ctrl+C to stop\n")
+	} else {
+		// Running in the background: the terminal may go away, and the
+		// state file tells the starting process the tunnel is up
+		signal.Ignore(syscall.SIGHUP)
+		state := tunnel{
+			ID:         tunnelID,
+			PID:        os.Getpid(),
+			Context:    portForwardKubeContext,
+			Namespace:  targetNamespace,
+			Target:     targetRef,
+			Pod:        podName,
+			LocalPort:  localPort,
+			RemotePort: remotePort,
+			Started:    time.Now(),
+			Log:        tunnelPath(tunnelID, ".log"),
+		}
+		if state.Context == "" {
+			if rawCfg, err := k8s.LoadRawConfig(); err == nil {
+				state.Context = rawCfg.CurrentContext
+			}
+		}
+		if err := writeTunnel(state); err != nil {
+			span.End(err)
+			return err
+		}
+		defer os.Remove(tunnelPath(tunnelID, ".json"))
+	}
 
-	// Wait for stop signal
-	<-stopCh
+	if listener != nil {
+		forwarded, err := pf.GetPorts()
+		if err != nil || len(forwarded) == 0 {
+			err = fmt.Errorf("failed to get forwarded port: %v", err)
+			span.End(err)
+			return err
+		}
+		stats := &connStats{}
+		go relayConnections(listener, fmt.Sprintf("127.0.0.1:%d", forwarded[0].Local), stats)
+		if portForwardLogConnections {
+			go printStats(stats, portForwardStatsInterval, stopCh)
+		}
+	}
+
+	// Wait for stop signal; a lost tunnel ends the command too, so
+	// backgrounded forwards do not linger without a connection
+	select {
+	case <-stopCh:
+	case err := <-forwardErr:
+		if err != nil {
+			err = fmt.Errorf("port forwarding failed: %w", err)
+			span.End(err)
+			return err
+		}
+	}
+	span.End(nil)
 
 	return nil
 }
 
+// daemonize starts the same command in the background with its output in a
+// log file, and returns once the tunnel is up or the background process died
+func daemonize(localPort int) error {
+	id := strconv.Itoa(localPort)
+	if running, err := readTunnel(id); err == nil && processRunning(running.PID) {
+		return clierr.Newf(clierr.Conflict, "tunnel %s is already running (pid %d), stop it with: kube-port-forward stop %s", id, running.PID, id)
+	}
+	os.Remove(tunnelPath(id, ".json"))
+
+	logPath := tunnelPath(id, ".log")
+	if err := os.MkdirAll(filepath.Dir(logPath), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer logFile.Close()
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", os.DevNull, err)
+	}
+	defer devNull.Close()
+
+	child := exec.Command(self, os.Args[1:]...)
+	child.Env = append(os.Environ(), tunnelEnv+"="+id, "KUBE_NO_HISTORY=1")
+	child.Stdin = devNull
+	child.Stdout = logFile
+	child.Stderr = logFile
+	detach(child)
+	if err := child.Start(); err != nil {
+		return fmt.Errorf("failed to start background process: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- child.Wait() }()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(time.Minute)
+	for {
+		select {
+		case <-exited:
+			code := child.ProcessState.ExitCode()
+			if code <= 0 {
+				code = clierr.Generic
+			}
+			return clierr.Newf(code, "background port-forward exited: %s (log: %s)", lastError(logPath), logPath)
+		case <-timeout:
+			child.Process.Kill()
+			return fmt.Errorf("timed out waiting for the tunnel, see %s", logPath)
+		case <-ticker.C:
+			state, err := readTunnel(id)
+			if err != nil || state.PID != child.Process.Pid {
+				continue
+			}
+			fmt.Printf("Forwarding from 127.0.0.1:%d -> %s:%d in the background (id %s, pid %d)\n",
+				state.LocalPort, state.Pod, state.RemotePort, id, state.PID)
+			fmt.Printf("Logs: %s\n", logPath)
+			fmt.Printf("Stop with: kube-port-forward stop %s\n", id)
+			return nil
+		}
+	}
+}
+
+// lastError returns the last error line printed to a tunnel log
+func lastError(logPath string) string {
+	output, _ := os.ReadFile(logPath)
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if msg, ok := strings.CutPrefix(lines[i], "Error: "); ok {
+			return msg
+		}
+	}
+	return lines[len(lines)-1]
+}
+
+// runStatus lists backgrounded tunnels. Tunnels whose process is gone are
+// reported once and then forgotten.
+func runStatus(cmd *cobra.Command, args []string) error {
+	if err := portForwardTable.Validate(); err != nil {
+		return err
+	}
+	tunnels, err := listTunnels()
+	if err != nil {
+		return err
+	}
+	if len(tunnels) == 0 {
+		if portForwardTable.Bordered() {
+			fmt.Println("No port-forwards running in the background")
+		}
+		return nil
+	}
+
+	const (
+		colorReset = "\033[0m"
+		colorRed   = "\033[31m"
+		colorGreen = "\033[32m"
+	)
+	headers := []string{"ID", "PID", "CONTEXT", "NAMESPACE", "TARGET", "POD", "PORTS", "AGE", "STATUS"}
+	rows := make([][]string, 0, len(tunnels))
+	for _, t := range tunnels {
+		status := colorGreen + "Running" + colorReset
+		if !processRunning(t.PID) {
+			status = colorRed + "Exited" + colorReset
+			os.Remove(tunnelPath(t.ID, ".json"))
+		}
+		rows = append(rows, []string{
+			t.ID,
+			strconv.Itoa(t.PID),
+			t.Context,
+			t.Namespace,
+			t.Target,
+			t.Pod,
+			fmt.Sprintf("%d:%d", t.LocalPort, t.RemotePort),
+			utils.FormatAge(time.Since(t.Started)),
+			status,
+		})
+	}
+	portForwardTable.Print(headers, rows, 0)
+	return nil
+}
+
+// runStop stops backgrounded tunnels and waits for them to exit
+func runStop(cmd *cobra.Command, args []string) error {
+	tunnels, err := listTunnels()
+	if err != nil {
+		return err
+	}
+	var selected []tunnel
+	if len(args) == 1 && args[0] == "all" {
+		selected = tunnels
+	} else {
+		for _, id := range args {
+			t, err := readTunnel(id)
+			if errors.Is(err, os.ErrNotExist) {
+				return clierr.Newf(clierr.NotFound, "no port-forward %q running in the background", id)
+			} else if err != nil {
+				return err
+			}
+			selected = append(selected, *t)
+		}
+	}
+	if len(selected) == 0 {
+		fmt.Println("No port-forwards running in the background")
+		return nil
+	}
+
+	for _, t := range selected {
+		if processRunning(t.PID) {
+			if err := stopProcess(t.PID); err != nil {
+				return fmt.Errorf("failed to stop port-forward %s (pid %d): %w", t.ID, t.PID, err)
+			}
+		}
+		os.Remove(tunnelPath(t.ID, ".json"))
+		fmt.Printf("Stopped port-forward %s (127.0.0.1:%d -> %s:%d)\n", t.ID, t.LocalPort, t.Pod, t.RemotePort)
+	}
+	return nil
+}
+
+// stopProcess sends SIGTERM and waits up to 5s before killing the process
+func stopProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if !processRunning(pid) {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return process.Kill()
+}
+
+// processRunning reports whether a process with the given pid exists
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// tunnelPath returns the state or log file of a tunnel.
+// Uses $XDG_STATE_HOME/kube-cmd/port-forward (default ~/.local/state).
+func tunnelPath(id, ext string) string {
+	return filepath.Join(state.Dir(), "port-forward", id+ext)
+}
+
+// writeTunnel saves the state file of a tunnel
+func writeTunnel(t tunnel) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := tunnelPath(t.ID, ".json")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	// Write then rename, so readers never see a partial file
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write tunnel state: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// readTunnel loads the state file of a tunnel
+func readTunnel(id string) (*tunnel, error) {
+	data, err := os.ReadFile(tunnelPath(id, ".json"))
+	if err != nil {
+		return nil, err
+	}
+	var t tunnel
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid tunnel state %s: %w", tunnelPath(id, ".json"), err)
+	}
+	return &t, nil
+}
+
+// listTunnels loads all tunnel state files ordered by local port
+func listTunnels() ([]tunnel, error) {
+	paths, err := filepath.Glob(tunnelPath("*", ".json"))
+	if err != nil {
+		return nil, err
+	}
+	tunnels := make([]tunnel, 0, len(paths))
+	for _, path := range paths {
+		t, err := readTunnel(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			continue
+		}
+		tunnels = append(tunnels, *t)
+	}
+	sort.Slice(tunnels, func(i, j int) bool { return tunnels[i].LocalPort < tunnels[j].LocalPort })
+	return tunnels, nil
+}
+
+// relayConnections accepts local connections and copies them to the tunnel
+func relayConnections(listener net.Listener, tunnelAddr string, stats *connStats) {
+	for {
+		local, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go relayConnection(local, tunnelAddr, stats)
+	}
+}
+
+// relayConnection copies one connection in both directions until both sides
+// are done and logs the bytes transferred
+func relayConnection(local net.Conn, tunnelAddr string, stats *connStats) {
+	defer local.Close()
+	id := stats.next.Add(1)
+	stats.active.Add(1)
+	stats.total.Add(1)
+	defer stats.active.Add(-1)
+
+	start := time.Now()
+	if portForwardLogConnections {
+		logConnection("#%d accepted from %s", id, local.RemoteAddr())
+	}
+
+	remote, err := net.Dial("tcp", tunnelAddr)
+	if err != nil {
+		logConnection("#%d failed: %v", id, err)
+		return
+	}
+	defer remote.Close()
+
+	// With --http-log both directions are also copied to the HTTP parser
+	var toRemote, toLocal io.Writer = remote, local
+	var requests, responses *streamTap
+	if portForwardHTTPLog {
+		requests, responses = newStreamTap(), newStreamTap()
+		toRemote = io.MultiWriter(remote, requests)
+		toLocal = io.MultiWriter(local, responses)
+		go inspectHTTP(id, requests, responses)
+	}
+
+	var sent, received int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sent, _ = io.Copy(toRemote, local)
+		closeWrite(remote)
+		if requests != nil {
+			requests.close()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		received, _ = io.Copy(toLocal, remote)
+		closeWrite(local)
+		if responses != nil {
+			responses.close()
+		}
+	}()
+	wg.Wait()
+
+	stats.sent.Add(sent)
+	stats.received.Add(received)
+	if portForwardLogConnections {
+		logConnection("#%d closed after %s, sent %s, received %s", id,
+			time.Since(start).Round(time.Millisecond), utils.FormatBytes(sent), utils.FormatBytes(received))
+	}
+}
+
+// streamTap hands a copy of what the relay writes to a parser without ever
+// blocking the relay: when the parser falls behind or gave up, the tap
+// turns off and the connection is only relayed
+type streamTap struct {
+	chunks chan []byte
+	off    atomic.Bool
+	buf    []byte
+}
+
+// newStreamTap returns a tap buffering up to 256 writes
+func newStreamTap() *streamTap {
+	return &streamTap{chunks: make(chan []byte, 256)}
+}
+
+// Write queues a copy of p for the parser. It never fails, so the relay
+// goes on whatever happens to the parser.
+func (t *streamTap) Write(p []byte) (int, error) {
+	if t.off.Load() {
+		return len(p), nil
+	}
+	select {
+	case t.chunks <- append([]byte(nil), p...):
+	default:
+		t.off.Store(true)
+	}
+	return len(p), nil
+}
+
+// close ends the stream for the parser. Only the relay writing to the tap
+// may call it, after its last write.
+func (t *streamTap) close() {
+	close(t.chunks)
+}
+
+// Read returns the queued bytes in order, and io.EOF once the stream ended
+// or the tap turned off, since what follows would have gaps
+func (t *streamTap) Read(p []byte) (int, error) {
+	for len(t.buf) == 0 {
+		chunk, ok := <-t.chunks
+		if !ok || t.off.Load() {
+			return 0, io.EOF
+		}
+		t.buf = chunk
+	}
+	n := copy(p, t.buf)
+	t.buf = t.buf[n:]
+	return n, nil
+}
+
+// pendingRequest is a request waiting for its response
+type pendingRequest struct {
+	req     *http.Request
+	started time.Time
+}
+
+// notHTTPLogged makes --http-log say only once that a connection is not
+// HTTP/1.x, a TLS port would say it for every connection
+var notHTTPLogged atomic.Bool
+
+// inspectHTTP reads the requests and responses of one connection from the
+// taps and logs every exchange. Responses come in request order on HTTP/1.x,
+// so they are paired through a queue.
+func inspectHTTP(id int64, requests, responses *streamTap) {
+	pending := make(chan pendingRequest, 64)
+	go func() {
+		defer close(pending)
+		br := bufio.NewReader(requests)
+		for first := true; ; first = false {
+			req, err := http.ReadRequest(br)
+			if err == nil && req.ProtoMajor != 1 {
+				err = errors.New("not HTTP/1.x")
+			}
+			if err != nil {
+				if first && err != io.EOF && !notHTTPLogged.Swap(true) {
+					logConnection("#%d is not plain HTTP/1.x (TLS, HTTP/2 or another protocol), relayed without --http-log", id)
+				}
+				requests.off.Store(true)
+				responses.off.Store(true)
+				return
+			}
+			pending <- pendingRequest{req: req, started: time.Now()}
+			io.Copy(io.Discard, req.Body)
+			req.Body.Close()
+		}
+	}()
+	// Unblock the request parser when responses cannot be followed anymore
+	defer func() {
+		for range pending {
+		}
+	}()
+
+	br := bufio.NewReader(responses)
+	for p := range pending {
+		for {
+			resp, err := http.ReadResponse(br, p.req)
+			if err != nil {
+				if err == io.EOF && !responses.off.Load() {
+					logConnection("#%d %s %s -> no response", id, p.req.Method, utils.TruncateString(p.req.RequestURI, maxLoggedURI))
+				}
+				responses.off.Store(true)
+				return
+			}
+			latency := time.Since(p.started)
+			size, _ := io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			// 100 Continue and other interim responses precede the real one
+			if resp.StatusCode < 200 && resp.StatusCode != http.StatusSwitchingProtocols {
+				continue
+			}
+			logConnection("#%d %s %s -> %d %s, %s", id, p.req.Method, utils.TruncateString(p.req.RequestURI, maxLoggedURI),
+				resp.StatusCode, latency.Round(100*time.Microsecond), utils.FormatBytes(size))
+			if resp.StatusCode == http.StatusSwitchingProtocols {
+				// A WebSocket or other upgrade, the rest is not HTTP
+				requests.off.Store(true)
+				responses.off.Store(true)
+				return
+			}
+			break
+		}
+	}
+}
+
+// closeWrite half-closes a TCP connection so the other side sees EOF
+func closeWrite(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+}
+
+// printStats prints a stats line every interval until stopped
+func printStats(stats *connStats, interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			logConnection("stats: %d active, %d total connections, sent %s, received %s",
+				stats.active.Load(), stats.total.Load(),
+				utils.FormatBytes(stats.sent.Load()), utils.FormatBytes(stats.received.Load()))
+		}
+	}
+}
+
+// logConnection prints a timestamped connection log line
+func logConnection(format string, args ...interface{}) {
+	fmt.Printf("%s %s\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
+}
+
 // parsePortSpec parses port specification
 // Supported formats: port, local:remote
 func parsePortSpec(spec string) (int, int, error) {
@@ -163,43 +868,17 @@ func parsePortSpec(spec string) (int, int, error) {
 	}
 }
 
-// resolveTargetPod resolves the target to a pod name.
-// Supports: "<pod-name>" or "svc/<service-name>" / "service/<service-name>"
-func resolveTargetPod(ctx context.Context, client *k8s.Client, namespace string, target string) (string, error) {
-	lower := strings.ToLower(target)
-	if strings.HasPrefix(lower, "svc/") || strings.HasPrefix(lower, "service/") {
-		parts := strings.SplitN(target, "/", 2)
-		if len(parts) != 2 || parts[1] == "" {
-			return "", fmt.Errorf("invalid service target, expected svc/<name>")
-		}
-		svcName := parts[1]
-
-		eps, err := client.Clientset.CoreV1().Endpoints(namespace).Get(ctx, svcName, metav1.GetOptions{})
-		if err != nil {
-			return "", fmt.Errorf("failed to get endpoints for service %s: %w", svcName, err)
-		}
-		for _, subset := range eps.Subsets {
-			for _, addr := range subset.Addresses {
-				if addr.TargetRef != nil && addr.TargetRef.Kind == "Pod" && addr.TargetRef.Name != "" {
-					return addr.TargetRef.Name, nil
-				}
-			}
-		}
-		return "", fmt.Errorf("no backing pod found for service %s", svcName)
-	}
-
-	// Default: treat target as pod name; validate existence.
-	if _, err := client.Clientset.CoreV1().Pods(namespace).Get(ctx, target, metav1.GetOptions{}); err != nil {
-		return "", fmt.Errorf("failed to get pod %s: %w", target, err)
-	}
-	return target, nil
-}
-
 // init initializes configuration for kube-port-forward command
 func init() {
 	// Define flags
 	portForwardRootCmd.Flags().StringVarP(&portForwardNamespace, "namespace", "n", "", "Kubernetes namespace to use")
 	portForwardRootCmd.Flags().StringVarP(&portForwardKubeContext, "context", "c", "", "Kubernetes context to use")
+	portForwardRootCmd.Flags().BoolVar(&portForwardLogConnections, "log-connections", false, "Log each local connection with bytes transferred, plus periodic stats")
+	portForwardRootCmd.Flags().BoolVar(&portForwardHTTPLog, "http-log", false, "Log HTTP/1.x requests through the tunnel with method, path, status, latency and size")
+	portForwardRootCmd.Flags().DurationVar(&portForwardStatsInterval, "stats-interval", 30*time.Second, "How often to print the stats line with --log-connections")
+	portForwardRootCmd.Flags().BoolVarP(&portForwardDaemonize, "daemonize", "d", false, "Keep forwarding in the background once the tunnel is up")
+	portForwardTable.AddFlags(portForwardStatusCmd)
+	portForwardRootCmd.AddCommand(portForwardStatusCmd, portForwardStopCmd)
 
 	// Bind flags with viper
 	viper.BindPFlag("namespace", portForwardRootCmd.Flags().Lookup("namespace"))
@@ -208,8 +887,16 @@ func init() {
 
 // main is the entry point of kube-port-forward
 func main() {
-	if err := portForwardRootCmd.Execute(); err != nil {
+	k8s.AddVerbosityFlag(portForwardRootCmd)
+	k8s.AddRateLimitFlags(portForwardRootCmd)
+	config.SetupDefaults(portForwardRootCmd)
+	clierr.SetupUsage(portForwardRootCmd)
+	cmd, err := portForwardRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(clierr.ExitCode(err))
 	}
 }
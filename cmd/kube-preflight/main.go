@@ -0,0 +1,626 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	preflightNamespace   string
+	preflightKubeContext string
+	preflightTimeout     time.Duration
+)
+
+const (
+	// skewWarning and skewFailure bound the clock difference to the API
+	// server. Tokens and certificates are checked against the clock, so a
+	// few minutes off makes fresh credentials look expired or not yet valid.
+	skewWarning = 30 * time.Second
+	skewFailure = 5 * time.Minute
+	// certWarning is how long before expiry a client certificate is flagged
+	certWarning = 7 * 24 * time.Hour
+	// maxDetailLength keeps error messages on one line
+	maxDetailLength = 120
+)
+
+// checkState is the verdict of one check
+type checkState int
+
+const (
+	checkOK checkState = iota
+	checkWarning
+	checkFailed
+	checkSkipped
+)
+
+// check is one line of the checklist
+type check struct {
+	name    string
+	state   checkState
+	summary string
+	details []string
+}
+
+// commonAction is an action the tools need, checked with a
+// SelfSubjectAccessReview
+type commonAction struct {
+	verb        string
+	resource    string
+	group       string
+	subresource string
+	// usedBy names what stops working without it
+	usedBy string
+}
+
+// commonActions are checked in the namespace by the RBAC check
+var commonActions = []commonAction{
+	{verb: "list", resource: "pods", usedBy: "kube-pods"},
+	{verb: "watch", resource: "pods", usedBy: "kube-pods --watch"},
+	{verb: "get", resource: "pods", subresource: "log", usedBy: "kube-logs"},
+	{verb: "create", resource: "pods", subresource: "exec", usedBy: "kube-exec"},
+	{verb: "create", resource: "pods", subresource: "portforward", usedBy: "kube-port-forward"},
+	{verb: "list", resource: "deployments", group: "apps", usedBy: "kube-deploy"},
+	{verb: "patch", resource: "deployments", group: "apps", usedBy: "kube-deploy --image, kube-rollout"},
+	{verb: "list", resource: "services", usedBy: "kube-services"},
+	{verb: "list", resource: "events", usedBy: "kube-events"},
+	{verb: "list", resource: "configmaps", usedBy: "kube-describe"},
+}
+
+// preflightRootCmd represents the kube-preflight command
+var preflightRootCmd = &cobra.Command{
+	Use:   "kube-preflight",
+	Short: "Check the active context end to end",
+	Long: `kube-preflight checks everything a command needs to work against the active
+context, in order, and prints a checklist. It is the first thing to run when
+nothing works:
+
+  kubeconfig   the file parses, the context and its cluster and user exist
+  credentials  the exec plugin is installed, the client certificate is valid
+  API server   /version answers, with the server version and latency
+  auth         the credentials are accepted, and who they authenticate as
+  clock skew   the local clock agrees with the API server, since tokens and
+               certificates are validated against it
+  namespace    the namespace of the context (or -n) exists
+  RBAC         common actions of the tools are allowed in the namespace
+  metrics      the metrics API (metrics-server) answers
+
+Checks that depend on a failed one are skipped. The exit code is 1 when a
+check failed; warnings do not fail.
+
+Examples:
+  kube-preflight                      # Current context and namespace
+  kube-preflight -c prod -n payments
+  kube-preflight --timeout 3s         # Give up on slow answers sooner`,
+	Args: cobra.NoArgs,
+	RunE: runPreflight,
+}
+
+// preflight runs the checks and prints each as soon as it is done
+type preflight struct {
+	ctx       context.Context // cancelled on interrupt, parent of the check timeouts
+	client    *k8s.Client
+	namespace string
+	checks    []check
+}
+
+// runPreflight runs the checks in order, skipping those that depend on a failed one
+func runPreflight(cmd *cobra.Command, args []string) error {
+	if preflightTimeout <= 0 {
+		return clierr.Usagef("--timeout must be positive")
+	}
+	if k8s.FromDir != "" {
+		return clierr.Usagef("kube-preflight checks a live cluster and cannot read --from-dir")
+	}
+
+	ctx, stop := interrupt.Context(context.Background())
+	defer stop()
+
+	p := &preflight{ctx: ctx}
+	ok := p.checkKubeconfig()
+	ok = ok && p.checkCredentials()
+	var serverTime time.Time
+	var roundTrip time.Duration
+	if ok {
+		serverTime, roundTrip, ok = p.checkAPIServer()
+	}
+	authenticated := ok && p.checkAuth()
+	if ok {
+		p.checkClockSkew(serverTime, roundTrip)
+	}
+	if authenticated {
+		p.checkNamespace()
+		p.checkRBAC()
+		p.checkMetrics()
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("preflight stopped after %d check(s): %w", len(p.checks), context.Cause(ctx))
+	}
+	for _, name := range []string{"credentials", "API server", "auth", "clock skew", "namespace", "RBAC", "metrics"} {
+		if !p.has(name) {
+			p.add(check{name: name, state: checkSkipped, summary: "skipped"})
+		}
+	}
+
+	failed := 0
+	for _, c := range p.checks {
+		if c.state == checkFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return clierr.Newf(clierr.Generic, "%d of %d checks failed", failed, len(p.checks))
+	}
+	return nil
+}
+
+// checkKubeconfig loads the kubeconfig, finds the context and creates the client
+func (p *preflight) checkKubeconfig() bool {
+	c := check{name: "kubeconfig"}
+	path := k8s.KubeconfigPath()
+	if env := os.Getenv("KUBECONFIG"); strings.Contains(env, string(filepath.ListSeparator)) {
+		c.details = append(c.details, "only the first file of KUBECONFIG is used: "+path)
+	}
+
+	raw, err := k8s.LoadRawConfig()
+	if err != nil {
+		c.state, c.summary = checkFailed, utils.TruncateString(utils.FirstLine(err.Error()), maxDetailLength)
+		if errors.Is(err, os.ErrNotExist) {
+			c.details = append(c.details, "set KUBECONFIG or create "+path)
+		}
+		p.add(c)
+		return false
+	}
+
+	name := preflightKubeContext
+	if name == "" {
+		name = raw.CurrentContext
+	}
+	kubeContext, found := raw.Contexts[name]
+	switch {
+	case name == "":
+		c.state, c.summary = checkFailed, path+": no current context"
+		c.details = append(c.details, "pick one with kube-switch-context")
+	case !found:
+		c.state, c.summary = checkFailed, fmt.Sprintf("%s: context %q not found", path, name)
+		c.details = append(c.details, fmt.Sprintf("%d context(s) in the file, list them with kube-switch-context", len(raw.Contexts)))
+	case raw.Clusters[kubeContext.Cluster] == nil:
+		c.state, c.summary = checkFailed, fmt.Sprintf("%s: cluster %q of context %s not found", path, kubeContext.Cluster, name)
+	case raw.AuthInfos[kubeContext.AuthInfo] == nil:
+		c.state, c.summary = checkFailed, fmt.Sprintf("%s: user %q of context %s not found", path, kubeContext.AuthInfo, name)
+	}
+	if c.state == checkFailed {
+		p.add(c)
+		return false
+	}
+
+	p.namespace = preflightNamespace
+	if p.namespace == "" {
+		p.namespace = kubeContext.Namespace
+	}
+	if p.namespace == "" {
+		p.namespace = "default"
+	}
+
+	p.client, err = k8s.NewClient("", preflightKubeContext)
+	if err != nil {
+		c.state, c.summary = checkFailed, utils.TruncateString(utils.FirstLine(err.Error()), maxDetailLength)
+		p.add(c)
+		return false
+	}
+	c.summary = fmt.Sprintf("%s: context %s, cluster %s, user %s", path, name, kubeContext.Cluster, kubeContext.AuthInfo)
+	p.add(c)
+	return true
+}
+
+// checkCredentials checks what can be checked locally: the exec plugin is
+// installed, the client certificate is valid, a token file is readable
+func (p *preflight) checkCredentials() bool {
+	c := check{name: "credentials"}
+	config := p.client.Config
+
+	certData := config.TLSClientConfig.CertData
+	if len(certData) == 0 && config.TLSClientConfig.CertFile != "" {
+		var err error
+		if certData, err = os.ReadFile(config.TLSClientConfig.CertFile); err != nil {
+			c.state, c.summary = checkFailed, fmt.Sprintf("client certificate not readable: %v", err)
+			p.add(c)
+			return false
+		}
+	}
+
+	switch {
+	case config.ExecProvider != nil:
+		command := config.ExecProvider.Command
+		path, err := exec.LookPath(command)
+		if err != nil {
+			c.state, c.summary = checkFailed, fmt.Sprintf("exec plugin %s not found", command)
+			if config.ExecProvider.InstallHint != "" {
+				c.details = append(c.details, strings.Split(strings.TrimSpace(config.ExecProvider.InstallHint), "\n")...)
+			}
+			p.add(c)
+			return false
+		}
+		c.summary = fmt.Sprintf("exec plugin %s (%s)", filepath.Base(command), path)
+	case len(certData) > 0:
+		block, _ := pem.Decode(certData)
+		if block == nil {
+			c.state, c.summary = checkFailed, "client certificate is not PEM encoded"
+			p.add(c)
+			return false
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			c.state, c.summary = checkFailed, fmt.Sprintf("failed to parse client certificate: %v", err)
+			p.add(c)
+			return false
+		}
+		now := time.Now()
+		c.summary = fmt.Sprintf("client certificate %s, valid until %s", cert.Subject.CommonName, cert.NotAfter.Local().Format(time.RFC3339))
+		switch {
+		case now.After(cert.NotAfter):
+			c.state, c.summary = checkFailed, fmt.Sprintf("client certificate %s expired %s ago", cert.Subject.CommonName, utils.FormatAge(now.Sub(cert.NotAfter)))
+			p.add(c)
+			return false
+		case now.Before(cert.NotBefore):
+			c.state = checkWarning
+			c.details = append(c.details, "the certificate is not valid yet, check the clock")
+		case cert.NotAfter.Sub(now) < certWarning:
+			c.state = checkWarning
+			c.details = append(c.details, fmt.Sprintf("expires in %s", utils.FormatAge(cert.NotAfter.Sub(now))))
+		}
+	case config.BearerTokenFile != "":
+		if _, err := os.ReadFile(config.BearerTokenFile); err != nil {
+			c.state, c.summary = checkFailed, fmt.Sprintf("token file not readable: %v", err)
+			p.add(c)
+			return false
+		}
+		c.summary = "bearer token from " + config.BearerTokenFile
+	case config.BearerToken != "":
+		c.summary = "bearer token"
+	case config.AuthProvider != nil:
+		c.summary = "auth provider " + config.AuthProvider.Name
+		if config.AuthProvider.Name != "oidc" {
+			c.state = checkWarning
+			c.details = append(c.details, "auth providers other than oidc were removed from client-go, use the exec plugin of the provider")
+		}
+	case config.Username != "":
+		c.summary = "basic auth as " + config.Username
+	default:
+		c.state, c.summary = checkWarning, "no credentials, requests are anonymous"
+	}
+	p.add(c)
+	return true
+}
+
+// checkAPIServer requests /version and returns the time of the server from
+// the Date header and the round trip time, so the clock can be compared
+func (p *preflight) checkAPIServer() (time.Time, time.Duration, bool) {
+	c := check{name: "API server"}
+	ctx, cancel := context.WithTimeout(p.ctx, preflightTimeout)
+	defer cancel()
+
+	httpClient, err := rest.HTTPClientFor(p.client.Config)
+	if err != nil {
+		c.state, c.summary = checkFailed, utils.TruncateString(utils.FirstLine(err.Error()), maxDetailLength)
+		p.add(c)
+		return time.Time{}, 0, false
+	}
+	url := p.client.Clientset.Discovery().RESTClient().Get().AbsPath("/version").URL()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		c.state, c.summary = checkFailed, err.Error()
+		p.add(c)
+		return time.Time{}, 0, false
+	}
+
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	roundTrip := time.Since(start)
+	if err != nil {
+		c.state, c.summary = checkFailed, utils.TruncateString(utils.FirstLine(err.Error()), maxDetailLength)
+		switch {
+		case ctx.Err() != nil:
+			c.summary = fmt.Sprintf("%s: no answer within %s", p.client.Config.Host, preflightTimeout)
+			c.details = append(c.details, "check VPN, proxy and firewall; a private endpoint is only reachable from its network")
+		case k8s.IsAuthError(err):
+			c.details = append(c.details, "the credential plugin failed, log in again with the tool of your provider")
+		}
+		p.add(c)
+		return time.Time{}, 0, false
+	}
+	defer resp.Body.Close()
+
+	// /version is readable anonymously on most clusters; any answer of the
+	// API server shows it is reachable
+	serverVersion := "version not readable"
+	var info version.Info
+	if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&info) == nil && info.GitVersion != "" {
+		serverVersion = info.GitVersion
+	}
+	c.summary = fmt.Sprintf("%s %s, %s", p.client.Config.Host, serverVersion, roundTrip.Round(time.Millisecond))
+	p.add(c)
+
+	serverTime, _ := http.ParseTime(resp.Header.Get("Date"))
+	return serverTime, roundTrip, true
+}
+
+// checkAuth asks who the credentials authenticate as (SelfSubjectReview),
+// falling back to an endpoint every authenticated user may read
+func (p *preflight) checkAuth() bool {
+	c := check{name: "auth"}
+	ctx, cancel := context.WithTimeout(p.ctx, preflightTimeout)
+	defer cancel()
+
+	review, err := p.client.Clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+		// Before Kubernetes 1.28, or not allowed to ask: any answer other
+		// than 401 means the credentials were accepted
+		err = p.client.Clientset.Discovery().RESTClient().Get().AbsPath("/api").Do(ctx).Error()
+		if err == nil || (!apierrors.IsUnauthorized(err) && clierr.IsServerResponse(err)) {
+			c.summary = "credentials accepted"
+			p.add(c)
+			return true
+		}
+	}
+	switch {
+	case err == nil:
+		user := review.Status.UserInfo
+		c.summary = "authenticated as " + user.Username
+		if groups := userGroups(user.Groups); groups != "" {
+			c.details = append(c.details, "groups: "+groups)
+		}
+		p.add(c)
+		return true
+	case k8s.IsAuthError(err):
+		c.state, c.summary = checkFailed, "credentials rejected (expired or revoked?)"
+		c.details = append(c.details, "log in again, then check with kube-auth whoami")
+	default:
+		c.state, c.summary = checkFailed, utils.TruncateString(utils.FirstLine(err.Error()), maxDetailLength)
+	}
+	p.add(c)
+	return false
+}
+
+// checkClockSkew compares the local clock with the Date of the API server
+// answer, which has a resolution of a second
+func (p *preflight) checkClockSkew(serverTime time.Time, roundTrip time.Duration) {
+	c := check{name: "clock skew"}
+	if serverTime.IsZero() {
+		c.state, c.summary = checkSkipped, "the API server sent no Date header"
+		p.add(c)
+		return
+	}
+	// The server answered about half a round trip ago
+	skew := time.Until(serverTime.Add(roundTrip / 2)).Round(time.Second)
+	direction := "ahead of"
+	if skew > 0 {
+		direction = "behind"
+	}
+	if skew < 0 {
+		skew = -skew
+	}
+	switch {
+	case skew < 2*time.Second:
+		c.summary = "in sync with the API server"
+	case skew < skewWarning:
+		c.summary = fmt.Sprintf("local clock is %s %s the API server", skew, direction)
+	case skew < skewFailure:
+		c.state, c.summary = checkWarning, fmt.Sprintf("local clock is %s %s the API server", skew, direction)
+		c.details = append(c.details, "enable time sync (NTP) on this machine")
+	default:
+		c.state, c.summary = checkFailed, fmt.Sprintf("local clock is %s %s the API server", skew, direction)
+		c.details = append(c.details, "tokens and certificates look expired or not yet valid, enable time sync (NTP)")
+	}
+	p.add(c)
+}
+
+// checkNamespace checks that the namespace exists and is not being deleted
+func (p *preflight) checkNamespace() {
+	c := check{name: "namespace"}
+	ctx, cancel := context.WithTimeout(p.ctx, preflightTimeout)
+	defer cancel()
+
+	ns, err := p.client.Clientset.CoreV1().Namespaces().Get(ctx, p.namespace, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		c.state, c.summary = checkFailed, p.namespace+" does not exist"
+		c.details = append(c.details, "pick an existing one with kube-switch-namespace or -n")
+	case apierrors.IsForbidden(err):
+		c.state, c.summary = checkWarning, p.namespace+": not allowed to get namespaces, cannot tell whether it exists"
+	case err != nil:
+		c.state, c.summary = checkFailed, utils.TruncateString(utils.FirstLine(err.Error()), maxDetailLength)
+	case ns.Status.Phase == corev1.NamespaceTerminating:
+		c.state, c.summary = checkWarning, p.namespace+" is being deleted"
+	default:
+		c.summary = p.namespace + " exists"
+	}
+	p.add(c)
+}
+
+// checkRBAC reviews the common actions in the namespace concurrently
+func (p *preflight) checkRBAC() {
+	c := check{name: "RBAC"}
+	ctx, cancel := context.WithTimeout(p.ctx, preflightTimeout)
+	defer cancel()
+
+	allowed := make([]bool, len(commonActions))
+	errs := make([]error, len(commonActions))
+	k8s.FanOut(len(commonActions), func(i int) {
+		a := commonActions[i]
+		review, err := p.client.Clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   p.namespace,
+				Verb:        a.verb,
+				Group:       a.group,
+				Resource:    a.resource,
+				Subresource: a.subresource,
+			}},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		allowed[i] = review.Status.Allowed
+	})
+
+	count := 0
+	for i, a := range commonActions {
+		switch {
+		case errs[i] != nil:
+			c.details = append(c.details, fmt.Sprintf("%s: %s", a, utils.TruncateString(utils.FirstLine(errs[i].Error()), maxDetailLength)))
+		case allowed[i]:
+			count++
+		default:
+			c.details = append(c.details, fmt.Sprintf("no: %s (%s)", a, a.usedBy))
+		}
+	}
+	c.summary = fmt.Sprintf("%d of %d common actions allowed in %s", count, len(commonActions), p.namespace)
+	switch count {
+	case len(commonActions):
+	case 0:
+		c.state = checkFailed
+	default:
+		c.state = checkWarning
+	}
+	p.add(c)
+}
+
+// String formats the action like kube-auth can-i takes it
+func (a commonAction) String() string {
+	resource := a.resource
+	if a.group != "" {
+		resource += "." + a.group
+	}
+	if a.subresource != "" {
+		resource += "/" + a.subresource
+	}
+	return a.verb + " " + resource
+}
+
+// checkMetrics checks that the metrics API answers. A registered but
+// unavailable aggregated API also makes discovery of all APIs incomplete.
+func (p *preflight) checkMetrics() {
+	c := check{name: "metrics"}
+	ctx, cancel := context.WithTimeout(p.ctx, preflightTimeout)
+	defer cancel()
+
+	err := p.client.Clientset.Discovery().RESTClient().Get().AbsPath("/apis/metrics.k8s.io/v1beta1").Do(ctx).Error()
+	switch {
+	case err == nil:
+		c.summary = "metrics.k8s.io available"
+	case apierrors.IsNotFound(err):
+		c.state, c.summary = checkWarning, "metrics.k8s.io is not served, CPU and memory usage are not available"
+		c.details = append(c.details, "install metrics-server; kube-resources can read usage from Prometheus instead")
+	case apierrors.IsForbidden(err):
+		c.state, c.summary = checkWarning, "not allowed to read metrics.k8s.io"
+	default:
+		c.state, c.summary = checkFailed, "metrics.k8s.io is registered but unavailable: "+utils.TruncateString(utils.FirstLine(err.Error()), maxDetailLength)
+		c.details = append(c.details, "discovery of all APIs fails while it is down, check the metrics-server pods in kube-system")
+	}
+	p.add(c)
+}
+
+// add records a check and prints it
+func (p *preflight) add(c check) {
+	const (
+		reset  = "\033[0m"
+		red    = "\033[31m"
+		green  = "\033[32m"
+		yellow = "\033[33m"
+		gray   = "\033[90m"
+	)
+	// Checks that end after an interrupt only saw cancelled requests
+	if p.ctx.Err() != nil {
+		return
+	}
+	p.checks = append(p.checks, c)
+
+	mark := green + "✓" + reset
+	switch c.state {
+	case checkWarning:
+		mark = yellow + "!" + reset
+	case checkFailed:
+		mark = red + "✗" + reset
+	case checkSkipped:
+		mark = gray + "-" + reset
+	}
+	fmt.Printf("%s %-12s %s\n", mark, c.name, c.summary)
+	for _, d := range c.details {
+		fmt.Printf("    %s\n", d)
+	}
+}
+
+// has reports whether a check of that name was recorded
+func (p *preflight) has(name string) bool {
+	for _, c := range p.checks {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// userGroups lists the groups of a user without the ones every user has
+func userGroups(groups []string) string {
+	var shown []string
+	for _, g := range groups {
+		if g != "system:authenticated" {
+			shown = append(shown, g)
+		}
+	}
+	return strings.Join(shown, ", ")
+}
+
+// init initializes flags for kube-preflight command
+func init() {
+	preflightRootCmd.Flags().StringVarP(&preflightNamespace, "namespace", "n", "", "Kubernetes namespace to check (default: the namespace of the context)")
+	preflightRootCmd.Flags().StringVarP(&preflightKubeContext, "context", "c", "", "Kubernetes context to check")
+	preflightRootCmd.Flags().DurationVar(&preflightTimeout, "timeout", 10*time.Second, "Time to wait for each check")
+
+	viper.BindPFlag("namespace", preflightRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", preflightRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-preflight
+func main() {
+	k8s.AddVerbosityFlag(preflightRootCmd)
+	k8s.AddRateLimitFlags(preflightRootCmd)
+	config.SetupDefaults(preflightRootCmd)
+	clierr.SetupUsage(preflightRootCmd)
+	cmd, err := preflightRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/tracing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	proxyNamespace   string
+	proxyKubeContext string
+	proxyAddress     string
+	proxyPort        int
+	proxyAcceptPaths []string
+	proxyRejectPaths []string
+	proxyServices    []string
+	proxyPods        []string
+)
+
+// defaultRejectPaths keep interactive subresources closed, like kubectl proxy
+var defaultRejectPaths = []string{
+	`^/api/.*/pods/.*/exec`,
+	`^/api/.*/pods/.*/attach`,
+}
+
+// proxyRootCmd represents the kube-proxy command
+var proxyRootCmd = &cobra.Command{
+	Use:   "kube-proxy",
+	Short: "Local authenticated proxy to the API server",
+	Long: `kube-proxy starts a local HTTP proxy to the API server of the current context,
+like kubectl proxy. Requests are authenticated with the kubeconfig credentials,
+so dashboards, curl and webhook tests need no token.
+
+Only paths matching --accept-paths and none of --reject-paths are proxied
+(exec and attach are rejected by default). Other requests get 403.
+
+On startup the proxy prints ready-to-use URLs for the services of the namespace
+through their proxy subresource. --service and --pod pick what to print, with
+an optional port, e.g. --service grafana:3000 or --pod api-0:8080.
+
+Examples:
+  kube-proxy                                   # Proxy on 127.0.0.1:8001
+  kube-proxy -p 9000 -n monitoring             # Other port, URLs of monitoring services
+  kube-proxy --service grafana:3000            # Print the Grafana URL only
+  kube-proxy --pod api-0:8080                  # URL of a pod port
+  kube-proxy --accept-paths '^/api/v1/namespaces/dev/'  # Only the dev namespace`,
+	Args: cobra.NoArgs,
+	RunE: runProxy,
+}
+
+// runProxy serves the proxy until interrupted
+func runProxy(cmd *cobra.Command, args []string) error {
+	accept, err := compilePaths(proxyAcceptPaths)
+	if err != nil {
+		return clierr.Usagef("invalid --accept-paths: %v", err)
+	}
+	reject, err := compilePaths(proxyRejectPaths)
+	if err != nil {
+		return clierr.Usagef("invalid --reject-paths: %v", err)
+	}
+	if proxyPort < 0 || proxyPort > 65535 {
+		return clierr.Usagef("invalid --port %d", proxyPort)
+	}
+
+	client, err := k8s.NewClient("", proxyKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	namespace := proxyNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(proxyKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+
+	handler, err := newProxyHandler(client.Config, accept, reject)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(proxyAddress, fmt.Sprintf("%d", proxyPort)))
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	base := "http://" + listener.Addr().String()
+
+	fmt.Printf("Proxying %s -> %s\n", base, client.Config.Host)
+	printURLs(client, namespace, base)
+	fmt.Println("Press Ctrl+C to stop")
+
+	// Requests in flight, like long watches, are cancelled with the server
+	ctx, stop := interrupt.Context(context.Background())
+	defer stop()
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 30 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		if !interrupt.Received() {
+			return
+		}
+		fmt.Println("\nStopping proxy...")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("proxy failed: %w", err)
+	}
+	return nil
+}
+
+// newProxyHandler returns a reverse proxy to the API server that adds the
+// kubeconfig credentials and enforces the path filters
+func newProxyHandler(config *rest.Config, accept, reject []*regexp.Regexp) (http.Handler, error) {
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transport: %w", err)
+	}
+	host := config.Host
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	target, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API server address %q: %w", config.Host, err)
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = transport
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		// The API server checks the host of the request, not the proxy's
+		req.Host = target.Host
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !pathAllowed(req.URL.Path, accept, reject) {
+			http.Error(w, "Forbidden by kube-proxy path filters", http.StatusForbidden)
+			fmt.Fprintf(os.Stderr, "rejected %s %s\n", req.Method, req.URL.Path)
+			return
+		}
+		proxy.ServeHTTP(w, req)
+	}), nil
+}
+
+// pathAllowed reports whether the path matches an accept pattern and no reject pattern
+func pathAllowed(path string, accept, reject []*regexp.Regexp) bool {
+	for _, re := range reject {
+		if re.MatchString(path) {
+			return false
+		}
+	}
+	for _, re := range accept {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// compilePaths compiles the path patterns
+func compilePaths(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// printURLs prints proxy URLs for the requested services and pods, or for
+// every service port in the namespace when none were requested
+func printURLs(client *k8s.Client, namespace, base string) {
+	prefix := fmt.Sprintf("%s/api/v1/namespaces/%s", base, namespace)
+	if len(proxyServices) == 0 && len(proxyPods) == 0 {
+		services, err := client.Clientset.CoreV1().Services(namespace).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to list services: %v\n", err)
+			return
+		}
+		if len(services.Items) == 0 {
+			return
+		}
+		fmt.Printf("Services in %s:\n", namespace)
+		for _, svc := range services.Items {
+			for _, port := range svc.Spec.Ports {
+				ref := fmt.Sprintf("%s:%d", svc.Name, port.Port)
+				if port.Name != "" {
+					ref = svc.Name + ":" + port.Name
+				}
+				fmt.Printf("  %s/services/%s/proxy/\n", prefix, ref)
+			}
+		}
+		return
+	}
+
+	for _, svc := range proxyServices {
+		fmt.Printf("  %s/services/%s/proxy/\n", prefix, svc)
+	}
+	for _, pod := range proxyPods {
+		fmt.Printf("  %s/pods/%s/proxy/\n", prefix, pod)
+	}
+}
+
+// init initializes flags for kube-proxy command
+func init() {
+	proxyRootCmd.Flags().StringVarP(&proxyNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	proxyRootCmd.Flags().StringVarP(&proxyKubeContext, "context", "c", "", "Kubernetes context to use")
+	proxyRootCmd.Flags().StringVar(&proxyAddress, "address", "127.0.0.1", "Local address to listen on")
+	proxyRootCmd.Flags().IntVarP(&proxyPort, "port", "p", 8001, "Local port to listen on (0 picks a free port)")
+	proxyRootCmd.Flags().StringSliceVar(&proxyAcceptPaths, "accept-paths", []string{"^.*"}, "Regular expressions of paths to proxy")
+	proxyRootCmd.Flags().StringSliceVar(&proxyRejectPaths, "reject-paths", defaultRejectPaths, "Regular expressions of paths to reject, checked first")
+	proxyRootCmd.Flags().StringSliceVar(&proxyServices, "service", nil, "Print the proxy URL of these services, as name or name:port")
+	proxyRootCmd.Flags().StringSliceVar(&proxyPods, "pod", nil, "Print the proxy URL of these pods, as name or name:port")
+
+	viper.BindPFlag("namespace", proxyRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", proxyRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-proxy
+func main() {
+	k8s.AddVerbosityFlag(proxyRootCmd)
+	k8s.AddRateLimitFlags(proxyRootCmd)
+	config.SetupDefaults(proxyRootCmd)
+	clierr.SetupUsage(proxyRootCmd)
+	cmd, err := proxyRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
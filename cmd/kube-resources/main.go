@@ -0,0 +1,797 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/agefilter"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var (
+	resourcesNamespace     string
+	resourcesKubeContext   string
+	resourcesAllNamespaces bool
+	resourcesMaxRatio      float64
+	resourcesIssuesOnly    bool
+	resourcesTable         table.Options
+	resourcesRecommend     bool
+	resourcesPrometheus    string
+	resourcesWindow        string
+	resourcesApply         bool
+	resourcesYes           bool
+)
+
+// Suggested requests are rounded up to these steps and never go below them
+const (
+	cpuStepMilli = 10
+	memoryStep   = 1024 * 1024
+	minMemory    = 16 * memoryStep
+)
+
+// workload is a pod template with the number of pods it runs
+type workload struct {
+	namespace string
+	kind      string
+	name      string
+	replicas  int32
+	selector  *metav1.LabelSelector
+	spec      corev1.PodSpec
+}
+
+// String returns the kubectl short form, e.g. deploy/web
+func (w workload) String() string {
+	return w.kind + "/" + w.name
+}
+
+// containerResources are the requests and limits of one container.
+// CPU is in millicores, memory in bytes; zero means not set.
+type containerResources struct {
+	cpuRequest    int64
+	cpuLimit      int64
+	memoryRequest int64
+	memoryLimit   int64
+}
+
+// namespaceTotals aggregates requests and limits of all replicas in a namespace
+type namespaceTotals struct {
+	workloads  int
+	containers int
+	issues     int
+	resources  containerResources
+}
+
+// resourcesRootCmd represents the kube-resources command
+var resourcesRootCmd = &cobra.Command{
+	Use:   "kube-resources",
+	Short: "Audit CPU/memory requests and limits of workloads",
+	Long: `kube-resources lists the CPU and memory requests and limits of every container
+of Deployments, StatefulSets and DaemonSets, and flags:
+
+- containers without a CPU or memory request
+- limits more than --max-ratio times the request
+
+Below the containers, a summary shows the namespace totals (requests and
+limits multiplied by the desired replicas), as a starting point for right-sizing.
+
+With --recommend, actual usage is compared to the requests and a request is
+suggested per container: the p90 of the usage samples of the workload's pods,
+rounded up and capped at the limit.
+
+- With --prometheus, each pod contributes its p90 CPU and working set memory
+  over --window (cAdvisor metrics), so the suggestion reflects daily peaks.
+- Otherwise the current usage from metrics-server is used. That is a single
+  snapshot per pod, so run it at peak time or prefer Prometheus.
+
+--apply patches the suggested requests into Deployments after confirmation
+(this starts a rollout). StatefulSets and DaemonSets are only reported.
+
+Examples:
+  kube-resources                      # Current namespace
+  kube-resources -A --issues-only     # Only problematic containers, whole cluster
+  kube-resources --max-ratio 2        # Stricter limit/request ratio
+  kube-resources --recommend          # Suggestions from metrics-server
+  kube-resources --recommend --issues-only   # Only containers whose request would change
+  kube-resources --recommend --prometheus http://prometheus:9090 --window 14d
+  kube-resources --recommend --prometheus http://prometheus:9090 --apply`,
+	Args: cobra.NoArgs,
+	RunE: runResources,
+}
+
+// runResources prints the per-container audit and the namespace totals
+func runResources(cmd *cobra.Command, args []string) error {
+	if err := resourcesTable.Validate(); err != nil {
+		return err
+	}
+
+	if resourcesMaxRatio < 1 {
+		return clierr.Usagef("--max-ratio must be at least 1")
+	}
+	if !resourcesRecommend {
+		for _, flag := range []string{"prometheus", "window", "apply"} {
+			if cmd.Flags().Changed(flag) {
+				return clierr.Usagef("--%s requires --recommend", flag)
+			}
+		}
+	}
+	if _, err := agefilter.ParseAge(resourcesWindow); err != nil {
+		return clierr.Usagef("invalid --window: %v", err)
+	}
+	if resourcesApply && !resourcesYes && !term.IsTerminal(int(os.Stdin.Fd())) {
+		return clierr.Usagef("stdin is not a terminal, use --yes to apply")
+	}
+
+	client, err := k8s.NewClient("", resourcesKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	namespace := resourcesNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(resourcesKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	if resourcesAllNamespaces {
+		namespace = ""
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	workloads, err := listWorkloads(ctx, client, namespace)
+	if err != nil {
+		return err
+	}
+	if resourcesRecommend {
+		return runRecommend(ctx, client, namespace, workloads)
+	}
+
+	headers := []string{"WORKLOAD", "CONTAINER", "REPLICAS", "CPU REQ", "CPU LIM", "MEM REQ", "MEM LIM", "ISSUES"}
+	if resourcesAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+
+	totals := map[string]*namespaceTotals{}
+	var rows [][]string
+	for _, w := range workloads {
+		t := totals[w.namespace]
+		if t == nil {
+			t = &namespaceTotals{}
+			totals[w.namespace] = t
+		}
+		t.workloads++
+
+		for _, c := range w.spec.Containers {
+			res := resourcesOf(c)
+			issues := auditContainer(res)
+
+			t.containers++
+			t.issues += len(issues)
+			replicas := int64(w.replicas)
+			t.resources.cpuRequest += res.cpuRequest * replicas
+			t.resources.cpuLimit += res.cpuLimit * replicas
+			t.resources.memoryRequest += res.memoryRequest * replicas
+			t.resources.memoryLimit += res.memoryLimit * replicas
+
+			if resourcesIssuesOnly && len(issues) == 0 {
+				continue
+			}
+			row := []string{
+				w.String(),
+				c.Name,
+				fmt.Sprintf("%d", w.replicas),
+				formatCPU(res.cpuRequest),
+				formatCPU(res.cpuLimit),
+				formatMemory(res.memoryRequest),
+				formatMemory(res.memoryLimit),
+				formatIssues(issues),
+			}
+			if resourcesAllNamespaces {
+				row = append([]string{w.namespace}, row...)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	nameColumn := 0
+	if resourcesAllNamespaces {
+		nameColumn = 1
+	}
+	resourcesTable.Print(headers, rows, nameColumn)
+
+	// Totals only make sense next to the full table
+	if !resourcesTable.Bordered() || len(totals) == 0 {
+		return nil
+	}
+	fmt.Println()
+	printTotals(totals)
+	return nil
+}
+
+// listWorkloads returns Deployments, StatefulSets and DaemonSets sorted by namespace and name
+func listWorkloads(ctx context.Context, client *k8s.Client, namespace string) ([]workload, error) {
+	var workloads []workload
+
+	deployments, err := client.Clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, d := range deployments.Items {
+		workloads = append(workloads, workload{d.Namespace, "deploy", d.Name, replicasOf(d.Spec.Replicas), d.Spec.Selector, d.Spec.Template.Spec})
+	}
+
+	statefulSets, err := client.Clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, s := range statefulSets.Items {
+		workloads = append(workloads, workload{s.Namespace, "sts", s.Name, replicasOf(s.Spec.Replicas), s.Spec.Selector, s.Spec.Template.Spec})
+	}
+
+	daemonSets, err := client.Clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+	for _, d := range daemonSets.Items {
+		// A DaemonSet runs one pod per scheduled node
+		workloads = append(workloads, workload{d.Namespace, "ds", d.Name, d.Status.DesiredNumberScheduled, d.Spec.Selector, d.Spec.Template.Spec})
+	}
+
+	sort.SliceStable(workloads, func(i, j int) bool {
+		if workloads[i].namespace != workloads[j].namespace {
+			return workloads[i].namespace < workloads[j].namespace
+		}
+		return workloads[i].String() < workloads[j].String()
+	})
+	return workloads, nil
+}
+
+// replicasOf returns the desired replicas, defaulting to 1 like the API server
+func replicasOf(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// resourcesOf returns the requests and limits of a container. As in the API
+// server, a limit without a request makes the request equal to the limit.
+func resourcesOf(c corev1.Container) containerResources {
+	res := containerResources{
+		cpuRequest:    c.Resources.Requests.Cpu().MilliValue(),
+		cpuLimit:      c.Resources.Limits.Cpu().MilliValue(),
+		memoryRequest: c.Resources.Requests.Memory().Value(),
+		memoryLimit:   c.Resources.Limits.Memory().Value(),
+	}
+	if res.cpuRequest == 0 {
+		res.cpuRequest = res.cpuLimit
+	}
+	if res.memoryRequest == 0 {
+		res.memoryRequest = res.memoryLimit
+	}
+	return res
+}
+
+// auditContainer returns the problems found in a container's resources
+func auditContainer(res containerResources) []string {
+	var issues []string
+	if res.cpuRequest == 0 {
+		issues = append(issues, "no cpu request")
+	}
+	if res.memoryRequest == 0 {
+		issues = append(issues, "no memory request")
+	}
+	if res.cpuRequest > 0 && res.cpuLimit > 0 {
+		if ratio := float64(res.cpuLimit) / float64(res.cpuRequest); ratio > resourcesMaxRatio {
+			issues = append(issues, fmt.Sprintf("cpu limit %.1fx request", ratio))
+		}
+	}
+	if res.memoryRequest > 0 && res.memoryLimit > 0 {
+		if ratio := float64(res.memoryLimit) / float64(res.memoryRequest); ratio > resourcesMaxRatio {
+			issues = append(issues, fmt.Sprintf("memory limit %.1fx request", ratio))
+		}
+	}
+	return issues
+}
+
+// printTotals prints requests and limits summed per namespace
+func printTotals(totals map[string]*namespaceTotals) {
+	namespaces := make([]string, 0, len(totals))
+	for ns := range totals {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	headers := []string{"NAMESPACE", "WORKLOADS", "CONTAINERS", "CPU REQ", "CPU LIM", "MEM REQ", "MEM LIM", "ISSUES"}
+	rows := make([][]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		t := totals[ns]
+		rows = append(rows, []string{
+			ns,
+			fmt.Sprintf("%d", t.workloads),
+			fmt.Sprintf("%d", t.containers),
+			formatCPU(t.resources.cpuRequest),
+			formatCPU(t.resources.cpuLimit),
+			formatMemory(t.resources.memoryRequest),
+			formatMemory(t.resources.memoryLimit),
+			fmt.Sprintf("%d", t.issues),
+		})
+	}
+	table.Render(headers, rows)
+}
+
+// recommendation is the suggested requests of one container
+type recommendation struct {
+	workload  workload
+	container string
+	current   containerResources
+	// p90 usage across the samples, -1 when there were none
+	cpuUsage    int64
+	memoryUsage int64
+	samples     int
+	suggested   containerResources
+}
+
+// changed reports whether applying the suggestion changes the requests
+func (r recommendation) changed() bool {
+	return r.samples > 0 &&
+		(r.suggested.cpuRequest != r.current.cpuRequest || r.suggested.memoryRequest != r.current.memoryRequest)
+}
+
+// usageSamples maps namespace/pod/container to usage samples: CPU in
+// millicores and memory in bytes
+type usageSamples map[string]containerResources
+
+// runRecommend prints request suggestions and optionally applies them
+func runRecommend(ctx context.Context, client *k8s.Client, namespace string, workloads []workload) error {
+	var usage usageSamples
+	var err error
+	if resourcesPrometheus != "" {
+		usage, err = prometheusUsage(ctx, namespace)
+	} else {
+		usage, err = metricsServerUsage(ctx, client, namespace)
+	}
+	if err != nil {
+		return err
+	}
+
+	pods, err := client.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	var recommendations []recommendation
+	for _, w := range workloads {
+		selector, err := metav1.LabelSelectorAsSelector(w.selector)
+		if err != nil || selector.Empty() {
+			continue
+		}
+		var podNames []string
+		for _, pod := range pods.Items {
+			if pod.Namespace == w.namespace && selector.Matches(labels.Set(pod.Labels)) {
+				podNames = append(podNames, pod.Name)
+			}
+		}
+
+		for _, c := range w.spec.Containers {
+			var cpu, memory []int64
+			for _, pod := range podNames {
+				if sample, ok := usage[w.namespace+"/"+pod+"/"+c.Name]; ok {
+					cpu = append(cpu, sample.cpuRequest)
+					memory = append(memory, sample.memoryRequest)
+				}
+			}
+			recommendations = append(recommendations, recommend(w, c, cpu, memory))
+		}
+	}
+
+	printRecommendations(recommendations)
+	if !resourcesApply || resourcesTable.Quiet {
+		return nil
+	}
+	return applyRecommendations(ctx, client, recommendations)
+}
+
+// recommend suggests requests for a container from its usage samples
+func recommend(w workload, c corev1.Container, cpu, memory []int64) recommendation {
+	current := resourcesOf(c)
+	r := recommendation{
+		workload:    w,
+		container:   c.Name,
+		current:     current,
+		cpuUsage:    -1,
+		memoryUsage: -1,
+		samples:     len(cpu),
+		suggested:   current,
+	}
+	if len(cpu) == 0 {
+		return r
+	}
+
+	r.cpuUsage = percentile(cpu, 0.9)
+	r.memoryUsage = percentile(memory, 0.9)
+	r.suggested.cpuRequest = roundUp(r.cpuUsage, cpuStepMilli, cpuStepMilli)
+	r.suggested.memoryRequest = roundUp(r.memoryUsage, memoryStep, minMemory)
+	// A request above the limit is rejected by the API server
+	if current.cpuLimit > 0 && r.suggested.cpuRequest > current.cpuLimit {
+		r.suggested.cpuRequest = current.cpuLimit
+	}
+	if current.memoryLimit > 0 && r.suggested.memoryRequest > current.memoryLimit {
+		r.suggested.memoryRequest = current.memoryLimit
+	}
+	return r
+}
+
+// percentile returns the nearest-rank percentile p (0..1] of values
+func percentile(values []int64, p float64) int64 {
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// roundUp rounds v up to a multiple of step, with a minimum of floor
+func roundUp(v, step, floor int64) int64 {
+	if v < floor {
+		return floor
+	}
+	return (v + step - 1) / step * step
+}
+
+// metricsServerUsage returns the current usage of every container from
+// metrics-server (metrics.k8s.io)
+func metricsServerUsage(ctx context.Context, client *k8s.Client, namespace string) (usageSamples, error) {
+	path := "/apis/metrics.k8s.io/v1beta1/pods"
+	if namespace != "" {
+		path = "/apis/metrics.k8s.io/v1beta1/namespaces/" + namespace + "/pods"
+	}
+	data, err := client.Clientset.CoreV1().RESTClient().Get().AbsPath(path).DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod metrics (is metrics-server installed? use --prometheus otherwise): %w", err)
+	}
+
+	var list struct {
+		Items []struct {
+			Metadata   metav1.ObjectMeta `json:"metadata"`
+			Containers []struct {
+				Name  string              `json:"name"`
+				Usage corev1.ResourceList `json:"usage"`
+			} `json:"containers"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode pod metrics: %w", err)
+	}
+
+	usage := usageSamples{}
+	for _, pod := range list.Items {
+		for _, c := range pod.Containers {
+			usage[pod.Metadata.Namespace+"/"+pod.Metadata.Name+"/"+c.Name] = containerResources{
+				cpuRequest:    c.Usage.Cpu().MilliValue(),
+				memoryRequest: c.Usage.Memory().Value(),
+			}
+		}
+	}
+	return usage, nil
+}
+
+// prometheusUsage returns the p90 usage over --window of every container from
+// the cAdvisor metrics in Prometheus
+func prometheusUsage(ctx context.Context, namespace string) (usageSamples, error) {
+	filter := `container!="",container!="POD"`
+	if namespace != "" {
+		filter += `,namespace="` + namespace + `"`
+	}
+	queries := map[string]string{
+		"cpu": fmt.Sprintf(`quantile_over_time(0.9, (sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{%s}[5m])))[%s:5m])`,
+			filter, resourcesWindow),
+		"memory": fmt.Sprintf(`quantile_over_time(0.9, (sum by (namespace, pod, container) (container_memory_working_set_bytes{%s}))[%s:5m])`,
+			filter, resourcesWindow),
+	}
+
+	usage := usageSamples{}
+	for _, resourceName := range []string{"cpu", "memory"} {
+		results, err := queryPrometheus(ctx, queries[resourceName])
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range results {
+			sample := usage[key]
+			if resourceName == "cpu" {
+				// Cores to millicores
+				sample.cpuRequest = int64(math.Ceil(value * 1000))
+			} else {
+				sample.memoryRequest = int64(math.Ceil(value))
+			}
+			usage[key] = sample
+		}
+	}
+	return usage, nil
+}
+
+// queryPrometheus runs an instant query and returns the values keyed by
+// namespace/pod/container
+func queryPrometheus(ctx context.Context, query string) (map[string]float64, error) {
+	endpoint := strings.TrimSuffix(resourcesPrometheus, "/") + "/api/v1/query?query=" + url.QueryEscape(query)
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, clierr.Usagef("invalid --prometheus: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query prometheus: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prometheus response: %w", err)
+	}
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			Result []struct {
+				Metric map[string]string `json:"metric"`
+				Value  [2]interface{}    `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode prometheus response (%s): %w", resp.Status, err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed: %s", result.Error)
+	}
+
+	values := map[string]float64{}
+	for _, r := range result.Data.Result {
+		text, _ := r.Value[1].(string)
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsNaN(value) {
+			continue
+		}
+		values[r.Metric["namespace"]+"/"+r.Metric["pod"]+"/"+r.Metric["container"]] = value
+	}
+	return values, nil
+}
+
+// printRecommendations prints current requests, p90 usage and suggestions
+func printRecommendations(recommendations []recommendation) {
+	headers := []string{"WORKLOAD", "CONTAINER", "CPU REQ", "CPU P90", "CPU SUGGESTED", "MEM REQ", "MEM P90", "MEM SUGGESTED", "SAMPLES"}
+	if resourcesAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+
+	rows := make([][]string, 0, len(recommendations))
+	for _, r := range recommendations {
+		if resourcesIssuesOnly && !r.changed() {
+			continue
+		}
+		row := []string{
+			r.workload.String(),
+			r.container,
+			formatCPU(r.current.cpuRequest),
+			"-",
+			"-",
+			formatMemory(r.current.memoryRequest),
+			"-",
+			"-",
+			fmt.Sprintf("%d", r.samples),
+		}
+		if r.samples > 0 {
+			row[3] = formatCPU(r.cpuUsage)
+			row[4] = formatSuggestion(r.suggested.cpuRequest, r.current.cpuRequest, formatCPU)
+			row[6] = formatMemory(r.memoryUsage)
+			row[7] = formatSuggestion(r.suggested.memoryRequest, r.current.memoryRequest, formatMemory)
+		}
+		if resourcesAllNamespaces {
+			row = append([]string{r.workload.namespace}, row...)
+		}
+		rows = append(rows, row)
+	}
+
+	nameColumn := 0
+	if resourcesAllNamespaces {
+		nameColumn = 1
+	}
+	resourcesTable.Print(headers, rows, nameColumn)
+}
+
+// formatSuggestion colors a suggestion green when it lowers the request and
+// yellow when it raises it
+func formatSuggestion(suggested, current int64, format func(int64) string) string {
+	const (
+		reset  = "\033[0m"
+		green  = "\033[32m"
+		yellow = "\033[33m"
+	)
+	text := format(suggested)
+	switch {
+	case suggested < current:
+		return green + text + reset
+	case suggested > current:
+		return yellow + text + reset
+	}
+	return text
+}
+
+// applyRecommendations patches the suggested requests into Deployments after confirmation
+func applyRecommendations(ctx context.Context, client *k8s.Client, recommendations []recommendation) error {
+	// Group container changes per Deployment, so each one rolls out once
+	type target struct {
+		workload   workload
+		containers []recommendation
+	}
+	var targets []*target
+	byWorkload := map[string]*target{}
+	skipped := 0
+	for _, r := range recommendations {
+		if !r.changed() {
+			continue
+		}
+		if r.workload.kind != "deploy" {
+			skipped++
+			continue
+		}
+		key := r.workload.namespace + "/" + r.workload.name
+		if byWorkload[key] == nil {
+			byWorkload[key] = &target{workload: r.workload}
+			targets = append(targets, byWorkload[key])
+		}
+		byWorkload[key].containers = append(byWorkload[key].containers, r)
+	}
+
+	if skipped > 0 {
+		fmt.Printf("\nSkipping %d container(s) of StatefulSets and DaemonSets, --apply only patches Deployments\n", skipped)
+	}
+	if len(targets) == 0 {
+		fmt.Println("\nNo Deployment requests to change")
+		return nil
+	}
+
+	if !resourcesYes {
+		if !utils.Confirm(ctx, os.Stdout, fmt.Sprintf("\nPatch requests of %d Deployment(s)? This restarts their pods. [y/N]: ", len(targets))) {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+
+	var failed int
+	for i, t := range targets {
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped after %d of %d Deployment(s), %d failed: %w", i, len(targets), failed, context.Cause(ctx))
+		}
+		containers := make([]map[string]interface{}, 0, len(t.containers))
+		for _, r := range t.containers {
+			containers = append(containers, map[string]interface{}{
+				"name": r.container,
+				"resources": map[string]interface{}{
+					"requests": map[string]string{
+						"cpu":    resource.NewMilliQuantity(r.suggested.cpuRequest, resource.DecimalSI).String(),
+						"memory": resource.NewQuantity(r.suggested.memoryRequest, resource.BinarySI).String(),
+					},
+				},
+			})
+		}
+		// Strategic merge patches merge containers by name
+		patch, _ := json.Marshal(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{"containers": containers},
+				},
+			},
+		})
+
+		_, err := client.Clientset.AppsV1().Deployments(t.workload.namespace).Patch(ctx, t.workload.name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to patch %s/%s: %v\n", t.workload.namespace, t.workload, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Patched %s/%s (%d container(s))\n", t.workload.namespace, t.workload, len(t.containers))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to patch %d of %d Deployment(s)", failed, len(targets))
+	}
+	return nil
+}
+
+// formatCPU renders millicores, - when not set
+func formatCPU(millicores int64) string {
+	if millicores == 0 {
+		return "-"
+	}
+	if millicores%1000 != 0 && millicores > 1000 {
+		return fmt.Sprintf("%.1f", float64(millicores)/1000)
+	}
+	return utils.FormatCPU(millicores)
+}
+
+// formatMemory renders bytes, - when not set
+func formatMemory(bytes int64) string {
+	if bytes == 0 {
+		return "-"
+	}
+	return utils.FormatBytes(bytes)
+}
+
+// formatIssues joins issues, colored yellow
+func formatIssues(issues []string) string {
+	if len(issues) == 0 {
+		return "-"
+	}
+	const (
+		reset  = "\033[0m"
+		yellow = "\033[33m"
+	)
+	return yellow + strings.Join(issues, ", ") + reset
+}
+
+// init initializes flags for kube-resources command
+func init() {
+	resourcesRootCmd.Flags().StringVarP(&resourcesNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	resourcesRootCmd.Flags().StringVarP(&resourcesKubeContext, "context", "c", "", "Kubernetes context to use")
+	resourcesRootCmd.Flags().BoolVarP(&resourcesAllNamespaces, "all-namespaces", "A", false, "Audit workloads in all namespaces")
+	resourcesRootCmd.Flags().Float64Var(&resourcesMaxRatio, "max-ratio", 4, "Flag limits more than this many times the request")
+	resourcesRootCmd.Flags().BoolVar(&resourcesIssuesOnly, "issues-only", false, "Only list containers with issues (totals still cover all)")
+	resourcesRootCmd.Flags().BoolVar(&resourcesRecommend, "recommend", false, "Suggest requests from actual usage (p90)")
+	resourcesRootCmd.Flags().StringVar(&resourcesPrometheus, "prometheus", "", "Prometheus URL for usage over --window (default: metrics-server snapshot)")
+	resourcesRootCmd.Flags().StringVar(&resourcesWindow, "window", "7d", "Usage window for --prometheus, e.g. 24h, 7d")
+	resourcesRootCmd.Flags().BoolVar(&resourcesApply, "apply", false, "Patch the suggested requests into Deployments after confirmation")
+	resourcesRootCmd.Flags().BoolVarP(&resourcesYes, "yes", "y", false, "Do not ask for confirmation with --apply")
+	resourcesTable.AddFlags(resourcesRootCmd)
+
+	viper.BindPFlag("namespace", resourcesRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", resourcesRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-resources
+func main() {
+	k8s.AddVerbosityFlag(resourcesRootCmd)
+	k8s.AddRateLimitFlags(resourcesRootCmd)
+	k8s.AddFromDirFlag(resourcesRootCmd)
+	config.SetupDefaults(resourcesRootCmd)
+	clierr.SetupUsage(resourcesRootCmd)
+	cmd, err := resourcesRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
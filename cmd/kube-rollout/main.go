@@ -3,13 +3,22 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"time"
 
+	"kube/pkg/kubernetes/changes"
 	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/rolloutstatus"
+	"kube/pkg/kubernetes/workloads"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/tracing"
 
 	"github.com/spf13/cobra"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var (
@@ -18,12 +27,29 @@ var (
 )
 
 var rolloutRootCmd = &cobra.Command{
-	Use:   "kube-rollout <deployment> [--restart]",
-	Short: "Show rollout status or restart a Deployment",
+	Use:   "kube-rollout <deployment|sts/<name>|ds/<name>> [--restart]",
+	Short: "Show rollout status or restart a workload",
 	Long: `kube-rollout can:
 
-- Restart a Deployment by touching the restartedAt annotation
+- Restart a Deployment, StatefulSet (sts/<name>) or DaemonSet (ds/<name>) by
+  touching the restartedAt annotation
 - Wait for rollout to complete, or just print current status once
+- Show the status of a Job (job/<name>) or wait for it to complete
+
+For Deployments the revision and its kubernetes.io/change-cause annotation
+are shown, and while the rollout is unfinished ProgressDeadlineIn tells how
+long the controller keeps waiting for progress before it marks the rollout
+as failed (progressDeadlineSeconds, restarted whenever a replica progresses).
+
+With --progress-format json the progress is printed as JSON Lines events for
+CI systems instead of text, one per observed change:
+
+  {"timestamp":"...","phase":"progressing","kind":"Deployment","namespace":"shop",
+   "name":"backend","revision":"7","desiredReplicas":3,"updatedReplicas":2,
+   "readyReplicas":2,"availableReplicas":2,"progressDeadline":"...","message":"..."}
+
+phase is started, progressing, complete, failed, timeout or interrupted. Other
+output goes to stderr, so stdout only carries events.
 
 Tips:
 - Use --namespace/-n to target a namespace
@@ -34,14 +60,36 @@ Tips:
 
   # Restart a deployment then wait for rollout to complete
   kube-rollout backend -n my-ns --restart
+
+  # Restart a DaemonSet
+  kube-rollout ds/node-agent --restart
+
+  # Wait for a Job to complete
+  kube-rollout job/migrate --wait
+
+  # Progress as JSON Lines for CI
+  kube-rollout backend --progress-format json | jq -r '"\(.phase) \(.readyReplicas)/\(.desiredReplicas)"'
 `,
 	Args: cobra.ExactArgs(1),
 	RunE: runRollout,
 }
 
 func runRollout(cmd *cobra.Command, args []string) error {
-	deploymentName := args[0]
 	doRestart, _ := cmd.Flags().GetBool("restart")
+	if rolloutProgressFormat != "text" && rolloutProgressFormat != "json" {
+		return clierr.Usagef("invalid --progress-format %q, use text or json", rolloutProgressFormat)
+	}
+	kind, name, err := workloads.ParseTarget(args[0])
+	if err != nil {
+		return err
+	}
+	// Restart is the default, so only complain when it was asked for explicitly
+	if kind == workloads.KindJob || kind == workloads.KindCronJob {
+		if cmd.Flags().Changed("restart") && doRestart {
+			return clierr.Usagef("%s %s cannot be restarted, it has no rollout", strings.ToLower(kind), name)
+		}
+		doRestart = false
+	}
 
 	client, err := k8s.NewClient("", rolloutKubeContext)
 	if err != nil {
@@ -55,62 +103,135 @@ func runRollout(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// Ctrl+C stops waiting; the rollout itself goes on in the cluster
+	ctx, stop := interrupt.Context(context.Background())
+	defer stop()
+
+	w, err := workloads.Get(ctx, client.Clientset, kind, ns, name)
+	if err != nil {
+		return err
+	}
+	resource := strings.ToLower(kind)
+
+	// JSON progress owns stdout, everything else is moved to stderr
+	var out io.Writer = os.Stdout
+	var progress *rolloutstatus.Emitter
+	if rolloutProgressFormat == "json" {
+		out = os.Stderr
+		progress = rolloutstatus.NewEmitter(os.Stdout, kind, ns, name, "")
+	}
+
 	if doRestart {
 		// Restart by touching annotation to trigger a new rollout
-		dep, err := client.Clientset.AppsV1().Deployments(ns).Get(context.Background(), deploymentName, metav1.GetOptions{})
+		before := w.Copy()
+		if err := workloads.Restart(w, time.Now()); err != nil {
+			return err
+		}
+		updated, err := w.Update(ctx, client.Clientset)
 		if err != nil {
-			return fmt.Errorf("failed to get deployment %s: %w", deploymentName, err)
+			return err
 		}
-		if dep.Spec.Template.ObjectMeta.Annotations == nil {
-			dep.Spec.Template.ObjectMeta.Annotations = map[string]string{}
+		changes.Print(out, resource, ns, name, updated.Changes(before))
+		fmt.Fprintf(out, "%s restarted. Waiting for rollout...\n", kind)
+	}
+
+	// Status-only: print current state once
+	if !doRestart && !rolloutWait {
+		st, err := w.RolloutStatus()
+		if progress != nil {
+			progress.Update(st)
+			progress.Finish(err)
+			return err
 		}
-		dep.Spec.Template.ObjectMeta.Annotations["kubectl.kubernetes.io/restartedAt"] = time.Now().Format(time.RFC3339)
-		if _, err := client.Clientset.AppsV1().Deployments(ns).Update(context.Background(), dep, metav1.UpdateOptions{}); err != nil {
-			return fmt.Errorf("failed to update deployment: %w", err)
+		statusPrinter()(st)
+		if err != nil {
+			return err
 		}
-		fmt.Println("Deployment restarted. Waiting for rollout...")
+		fmt.Println(st.Message)
+		return nil
 	}
 
-	// Wait for rollout to complete or just print current status
-	for i := 0; i < 180; i++ {
-		dep, err := client.Clientset.AppsV1().Deployments(ns).Get(context.Background(), deploymentName, metav1.GetOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to get deployment: %w", err)
+	// Wait for rollout to complete
+	if progress != nil {
+		message := "waiting for rollout"
+		if doRestart {
+			message = "restarted, waiting for rollout"
 		}
-		fmt.Printf("ObservedGeneration=%d/%d Updated=%d Ready=%d Available=%d Desired=%d\n",
-			dep.Status.ObservedGeneration, dep.Generation,
-			dep.Status.UpdatedReplicas,
-			dep.Status.ReadyReplicas,
-			dep.Status.AvailableReplicas,
-			*dep.Spec.Replicas,
-		)
-		if dep.Status.UpdatedReplicas == *dep.Spec.Replicas &&
-			dep.Status.ReadyReplicas == *dep.Spec.Replicas &&
-			dep.Status.AvailableReplicas == *dep.Spec.Replicas &&
-			dep.Status.ObservedGeneration >= dep.Generation {
-			fmt.Println("Rollout is complete")
-			return nil
+		progress.Started(message)
+		err = w.Wait(ctx, client.Clientset, rolloutTimeout, progress.Update)
+		progress.Finish(err)
+		return err
+	}
+	err = w.Wait(ctx, client.Clientset, rolloutTimeout, statusPrinter())
+	if err != nil {
+		return err
+	}
+	fmt.Println("Rollout is complete")
+	return nil
+}
+
+// statusPrinter returns a callback that prints a one-line summary of the
+// rollout counters, with the time left until the progress deadline while a
+// Deployment rollout is unfinished. The revision and its change-cause are
+// printed whenever the revision changes.
+func statusPrinter() func(rolloutstatus.Status) {
+	lastRevision := ""
+	return func(st rolloutstatus.Status) {
+		if st.Revision != "" && st.Revision != lastRevision {
+			cause := st.ChangeCause
+			if cause == "" {
+				cause = "<none>"
+			}
+			fmt.Printf("Revision %s, change-cause: %s\n", st.Revision, cause)
+			lastRevision = st.Revision
 		}
-		time.Sleep(1 * time.Second)
-		if !doRestart { // status-only: print once and exit
-			return nil
+
+		line := fmt.Sprintf("ObservedGeneration=%d/%d Updated=%d Ready=%d Available=%d Desired=%d",
+			st.ObservedGeneration, st.Generation,
+			st.Updated,
+			st.Ready,
+			st.Available,
+			st.Desired,
+		)
+		if !st.Done && !st.ProgressDeadline.IsZero() {
+			remaining := time.Until(st.ProgressDeadline).Round(time.Second)
+			if remaining < 0 {
+				remaining = 0
+			}
+			line += fmt.Sprintf(" ProgressDeadlineIn=%s", remaining)
 		}
+		fmt.Println(line)
 	}
-	return fmt.Errorf("timeout waiting for rollout of deployment %s", deploymentName)
 }
 
 func init() {
 	rolloutRootCmd.Flags().StringVarP(&rolloutNamespace, "namespace", "n", "", "Kubernetes namespace to use")
 	rolloutRootCmd.Flags().StringVarP(&rolloutKubeContext, "context", "c", "", "Kubernetes context to use")
-	rolloutRootCmd.Flags().BoolVar(&rolloutRestart, "restart", true, "Restart the deployment before waiting for rollout")
+	rolloutRootCmd.Flags().BoolVar(&rolloutRestart, "restart", true, "Restart the workload before waiting for rollout")
+	rolloutRootCmd.Flags().BoolVar(&rolloutWait, "wait", false, "Without --restart, wait for the rollout (or Job) to complete instead of printing the status once")
+	rolloutRootCmd.Flags().DurationVar(&rolloutTimeout, "timeout", 0, "Maximum time to wait for the rollout (default: progressDeadlineSeconds + 1m)")
+	rolloutRootCmd.Flags().StringVar(&rolloutProgressFormat, "progress-format", "text", "Progress output: text, or json for one JSON event per line")
 }
 
-var rolloutRestart bool
+var (
+	rolloutRestart        bool
+	rolloutWait           bool
+	rolloutTimeout        time.Duration
+	rolloutProgressFormat string
+)
 
 // main is the entry point of kube-rollout
 func main() {
-	if err := rolloutRootCmd.Execute(); err != nil {
+	k8s.AddVerbosityFlag(rolloutRootCmd)
+	k8s.AddRateLimitFlags(rolloutRootCmd)
+	config.SetupDefaults(rolloutRootCmd)
+	clierr.SetupUsage(rolloutRootCmd)
+	cmd, err := rolloutRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(clierr.ExitCode(err))
 	}
 }
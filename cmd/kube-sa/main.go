@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	saNamespace     string
+	saKubeContext   string
+	saAllNamespaces bool
+	saTable         table.Options
+	saDuration      time.Duration
+	saAudiences     []string
+)
+
+// minTokenDuration is the shortest expiration the TokenRequest API accepts
+const minTokenDuration = 10 * time.Minute
+
+// saRootCmd represents the kube-sa command
+var saRootCmd = &cobra.Command{
+	Use:   "kube-sa",
+	Short: "List ServiceAccounts with their roles and mint tokens",
+	Long: `kube-sa lists ServiceAccounts with the roles bound to them and mints
+short-lived tokens for testing and CI.
+
+Roles are resolved from the RoleBindings of the namespace and from
+ClusterRoleBindings, including bindings to the system:serviceaccounts groups;
+cluster-wide grants are marked with (cluster). TOKEN SECRETS counts legacy
+long-lived token Secrets of the ServiceAccount, which the token subcommand
+makes unnecessary.
+
+Examples:
+  kube-sa                              # ServiceAccounts of the current namespace
+  kube-sa -A
+  kube-sa token deployer --duration 1h # Print a token valid for one hour
+  kube-sa token ci -n build --duration 30m --audience vault`,
+	Args: cobra.NoArgs,
+	RunE: runList,
+}
+
+// saTokenCmd mints a token with the TokenRequest API
+var saTokenCmd = &cobra.Command{
+	Use:   "token <name>",
+	Short: "Mint a short-lived token for a ServiceAccount",
+	Long: `Mint a token for a ServiceAccount with the TokenRequest API.
+
+The token is printed alone on stdout, so it can be captured in scripts; the
+expiration goes to stderr. The API server may shorten the duration to its
+configured maximum. Tokens cannot be revoked before they expire except by
+deleting the ServiceAccount, so keep the duration short.
+
+Examples:
+  kube-sa token deployer --duration 1h
+  TOKEN=$(kube-sa token ci -n build --duration 15m)
+  curl -H "Authorization: Bearer $(kube-sa token deployer)" https://api.example.com/...`,
+	Args: cobra.ExactArgs(1),
+	RunE: runToken,
+}
+
+// serviceAccountRow is one ServiceAccount with what is bound to it
+type serviceAccountRow struct {
+	namespace    string
+	name         string
+	roles        []string
+	tokenSecrets int
+	age          time.Duration
+}
+
+// runList prints the ServiceAccounts with their bound roles
+func runList(cmd *cobra.Command, args []string) error {
+	if err := saTable.Validate(); err != nil {
+		return err
+	}
+
+	client, err := k8s.NewClient("", saKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	namespace, err := resolveNamespace()
+	if err != nil {
+		return err
+	}
+	if saAllNamespaces {
+		namespace = ""
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	accounts, err := client.Clientset.CoreV1().ServiceAccounts(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list serviceaccounts: %w", err)
+	}
+	if len(accounts.Items) == 0 {
+		if saTable.Bordered() {
+			fmt.Println("No ServiceAccounts found")
+		}
+		return nil
+	}
+
+	roles, err := boundRoles(ctx, client, namespace)
+	rbacKnown := true
+	if apierrors.IsForbidden(err) {
+		fmt.Fprintf(os.Stderr, "Warning: not allowed to list RBAC bindings, roles are not shown\n")
+		rbacKnown = false
+	} else if err != nil {
+		return err
+	}
+
+	tokenSecrets, err := legacyTokenSecrets(ctx, client, namespace)
+	secretsKnown := true
+	if apierrors.IsForbidden(err) {
+		secretsKnown = false
+	} else if err != nil {
+		return err
+	}
+
+	rows := make([]serviceAccountRow, 0, len(accounts.Items))
+	for _, sa := range accounts.Items {
+		key := sa.Namespace + "/" + sa.Name
+		var saRoles []string
+		saRoles = append(saRoles, roles[key]...)
+		saRoles = append(saRoles, roles[sa.Namespace+"/*"]...)
+		saRoles = append(saRoles, roles["*"]...)
+		rows = append(rows, serviceAccountRow{
+			namespace:    sa.Namespace,
+			name:         sa.Name,
+			roles:        dedupe(saRoles),
+			tokenSecrets: tokenSecrets[key],
+			age:          time.Since(sa.CreationTimestamp.Time),
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].namespace != rows[j].namespace {
+			return rows[i].namespace < rows[j].namespace
+		}
+		return rows[i].name < rows[j].name
+	})
+
+	printServiceAccounts(rows, rbacKnown, secretsKnown)
+	return nil
+}
+
+// boundRoles returns the roles bound to ServiceAccounts, keyed by
+// namespace/name. Roles bound to all ServiceAccounts of a namespace are keyed
+// namespace/*, roles bound to all ServiceAccounts of the cluster *.
+func boundRoles(ctx context.Context, client *k8s.Client, namespace string) (map[string][]string, error) {
+	rbac := client.Clientset.RbacV1()
+	clusterBindings, err := rbac.ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clusterrolebindings: %w", err)
+	}
+	bindings, err := rbac.RoleBindings(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rolebindings: %w", err)
+	}
+
+	roles := map[string][]string{}
+	bind := func(subject rbacv1.Subject, bindingNamespace, role string) {
+		switch {
+		case subject.Kind == rbacv1.ServiceAccountKind:
+			ns := subject.Namespace
+			if ns == "" {
+				ns = bindingNamespace
+			}
+			roles[ns+"/"+subject.Name] = append(roles[ns+"/"+subject.Name], role)
+		case subject.Kind == rbacv1.GroupKind && subject.Name == "system:serviceaccounts":
+			roles["*"] = append(roles["*"], role)
+		case subject.Kind == rbacv1.GroupKind && strings.HasPrefix(subject.Name, "system:serviceaccounts:"):
+			key := strings.TrimPrefix(subject.Name, "system:serviceaccounts:") + "/*"
+			roles[key] = append(roles[key], role)
+		}
+	}
+	for _, b := range clusterBindings.Items {
+		for _, s := range b.Subjects {
+			bind(s, "", b.RoleRef.Kind+"/"+b.RoleRef.Name+" (cluster)")
+		}
+	}
+	for _, b := range bindings.Items {
+		for _, s := range b.Subjects {
+			bind(s, b.Namespace, b.RoleRef.Kind+"/"+b.RoleRef.Name)
+		}
+	}
+	return roles, nil
+}
+
+// legacyTokenSecrets counts the long-lived token Secrets per ServiceAccount,
+// keyed by namespace/name
+func legacyTokenSecrets(ctx context.Context, client *k8s.Client, namespace string) (map[string]int, error) {
+	secrets, err := client.Clientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "type=" + string(corev1.SecretTypeServiceAccountToken),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	counts := map[string]int{}
+	for _, s := range secrets.Items {
+		if name := s.Annotations[corev1.ServiceAccountNameKey]; name != "" {
+			counts[s.Namespace+"/"+name]++
+		}
+	}
+	return counts, nil
+}
+
+// dedupe sorts values and drops duplicates
+func dedupe(values []string) []string {
+	sort.Strings(values)
+	out := values[:0]
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// printServiceAccounts prints one row per ServiceAccount
+func printServiceAccounts(rows []serviceAccountRow, rbacKnown, secretsKnown bool) {
+	const (
+		colorReset  = "\033[0m"
+		colorYellow = "\033[33m"
+	)
+
+	headers := []string{"NAME", "ROLES", "TOKEN SECRETS", "AGE"}
+	if saAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+	tableRows := make([][]string, 0, len(rows))
+	for _, r := range rows {
+		roles := strings.Join(r.roles, ", ")
+		switch {
+		case !rbacKnown:
+			roles = "?"
+		case roles == "":
+			roles = "-"
+		}
+		secrets := fmt.Sprintf("%d", r.tokenSecrets)
+		switch {
+		case !secretsKnown:
+			secrets = "?"
+		case r.tokenSecrets > 0:
+			// Long-lived tokens never expire, worth replacing
+			secrets = colorYellow + secrets + colorReset
+		}
+
+		row := []string{r.name, roles, secrets, utils.FormatAge(r.age)}
+		if saAllNamespaces {
+			row = append([]string{r.namespace}, row...)
+		}
+		tableRows = append(tableRows, row)
+	}
+
+	nameColumn := 0
+	if saAllNamespaces {
+		nameColumn = 1
+	}
+	saTable.Print(headers, tableRows, nameColumn)
+}
+
+// runToken mints a token for the ServiceAccount and prints it
+func runToken(cmd *cobra.Command, args []string) error {
+	if saDuration < minTokenDuration {
+		return clierr.Usagef("--duration must be at least %s", minTokenDuration)
+	}
+
+	client, err := k8s.NewClient("", saKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	namespace, err := resolveNamespace()
+	if err != nil {
+		return err
+	}
+
+	seconds := int64(saDuration / time.Second)
+	request := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: &seconds,
+			Audiences:         saAudiences,
+		},
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	resp, err := client.Clientset.CoreV1().ServiceAccounts(namespace).CreateToken(ctx, args[0], request, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create token for serviceaccount %s: %w", args[0], err)
+	}
+
+	expires := resp.Status.ExpirationTimestamp.Time
+	fmt.Fprintf(os.Stderr, "Token for %s/%s expires at %s (in %s)\n", namespace, args[0],
+		expires.Local().Format(time.RFC3339), time.Until(expires).Round(time.Second))
+	if lifetime := time.Until(expires); lifetime < saDuration-time.Minute {
+		fmt.Fprintf(os.Stderr, "Warning: the API server shortened the requested duration of %s\n", saDuration)
+	}
+	fmt.Println(resp.Status.Token)
+	return nil
+}
+
+// resolveNamespace returns --namespace or the namespace of the context
+func resolveNamespace() (string, error) {
+	if saNamespace != "" {
+		return saNamespace, nil
+	}
+	namespace, err := k8s.GetCurrentNamespace(saKubeContext)
+	if err != nil {
+		return "", fmt.Errorf("failed to get current namespace: %w", err)
+	}
+	return namespace, nil
+}
+
+// init initializes flags for kube-sa command
+func init() {
+	saRootCmd.PersistentFlags().StringVarP(&saNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	saRootCmd.PersistentFlags().StringVarP(&saKubeContext, "context", "c", "", "Kubernetes context to use")
+	saRootCmd.Flags().BoolVarP(&saAllNamespaces, "all-namespaces", "A", false, "List ServiceAccounts of all namespaces")
+	saTable.AddFlags(saRootCmd)
+	saTokenCmd.Flags().DurationVar(&saDuration, "duration", time.Hour, "How long the token is valid (at least 10m)")
+	saTokenCmd.Flags().StringSliceVar(&saAudiences, "audience", nil, "Audience of the token, repeatable (default: the API server)")
+	saRootCmd.AddCommand(saTokenCmd)
+
+	viper.BindPFlag("namespace", saRootCmd.PersistentFlags().Lookup("namespace"))
+	viper.BindPFlag("context", saRootCmd.PersistentFlags().Lookup("context"))
+}
+
+// main is the entry point of kube-sa
+func main() {
+	k8s.AddVerbosityFlag(saRootCmd)
+	k8s.AddRateLimitFlags(saRootCmd)
+	k8s.AddFromDirFlag(saRootCmd)
+	config.SetupDefaults(saRootCmd)
+	clierr.SetupUsage(saRootCmd)
+	cmd, err := saRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	securityNamespace     string
+	securityKubeContext   string
+	securityAllNamespaces bool
+	securityTable         table.Options
+)
+
+// Severities of findings and the points they cost
+const (
+	severityCritical = "critical"
+	severityHigh     = "high"
+	severityMedium   = "medium"
+	severityLow      = "low"
+)
+
+// severityPenalty is subtracted from a score of 100 per finding
+var severityPenalty = map[string]int{severityCritical: 40, severityHigh: 25, severityMedium: 10, severityLow: 5}
+
+// grades maps the lowest score of a grade to the grade, best first
+var grades = []struct {
+	minScore int
+	grade    string
+}{{90, "A"}, {75, "B"}, {60, "C"}, {40, "D"}, {0, "F"}}
+
+// securityFinding is one weakness of a pod
+type securityFinding struct {
+	Check     string `json:"check"`
+	Severity  string `json:"severity"`
+	Container string `json:"container,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+// podPosture is the graded result of one pod
+type podPosture struct {
+	Namespace      string            `json:"namespace"`
+	Name           string            `json:"name"`
+	ServiceAccount string            `json:"serviceAccount"`
+	Score          int               `json:"score"`
+	Grade          string            `json:"grade"`
+	Findings       []securityFinding `json:"findings"`
+}
+
+// postureReport is the JSON export of kube-security
+type postureReport struct {
+	Generated time.Time      `json:"generated"`
+	Context   string         `json:"context,omitempty"`
+	Namespace string         `json:"namespace,omitempty"`
+	Pods      []podPosture   `json:"pods"`
+	Grades    map[string]int `json:"grades"`
+}
+
+// securityRootCmd represents the kube-security command
+var securityRootCmd = &cobra.Command{
+	Use:   "kube-security",
+	Short: "Grade the security posture of pods",
+	Long: `kube-security scans the pods of a namespace and grades each one from A to F.
+Every pod starts at 100 points and loses points per finding:
+
+  privileged           critical  container runs privileged
+  wildcard-rbac        critical  the ServiceAccount is granted * verbs on * resources
+                       high      the ServiceAccount is granted * verbs or * resources
+  host-path            high      hostPath volume
+  host-network         high      hostNetwork, hostPID or hostIPC
+  run-as-root          high      runAsUser 0
+                       medium    neither runAsNonRoot nor a non-root runAsUser is set
+  no-security-context  low       neither the pod nor the container set a securityContext
+
+Critical costs 40 points, high 25, medium 10 and low 5. A is 90 and more,
+B 75, C 60, D 40, anything lower is F.
+
+RBAC is read from the RoleBindings and ClusterRoleBindings of the
+ServiceAccount and the system:serviceaccounts groups. Without permission to
+list RBAC the wildcard-rbac check is skipped with a warning.
+
+-o json exports every finding with a timestamp, e.g. for compliance snapshots.
+
+Examples:
+  kube-security                         # Pods of the current namespace
+  kube-security -n payments
+  kube-security -A -o json > posture-$(date +%F).json`,
+	RunE: runSecurity,
+}
+
+// runSecurity grades every pod and prints the table or the JSON report
+func runSecurity(cmd *cobra.Command, args []string) error {
+	if err := securityTable.Validate(); err != nil {
+		return err
+	}
+
+	client, err := k8s.NewClient("", securityKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	namespace := securityNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(securityKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	if securityAllNamespaces {
+		namespace = ""
+	}
+
+	ctx := context.Background()
+	pods, err := client.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	grants, err := wildcardGrants(ctx, client, namespace)
+	if apierrors.IsForbidden(err) {
+		fmt.Fprintf(os.Stderr, "Warning: not allowed to list RBAC, skipping the wildcard-rbac check\n")
+		grants = nil
+	} else if err != nil {
+		return err
+	}
+
+	postures := make([]podPosture, 0, len(pods.Items))
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		// Finished pods run nothing anymore
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		postures = append(postures, gradePod(pod, grants))
+	}
+	sort.Slice(postures, func(i, j int) bool {
+		if postures[i].Score != postures[j].Score {
+			return postures[i].Score < postures[j].Score
+		}
+		if postures[i].Namespace != postures[j].Namespace {
+			return postures[i].Namespace < postures[j].Namespace
+		}
+		return postures[i].Name < postures[j].Name
+	})
+
+	counts := map[string]int{}
+	for _, p := range postures {
+		counts[p.Grade]++
+	}
+
+	if securityTable.Output == "json" {
+		contextName := securityKubeContext
+		if contextName == "" {
+			if rawCfg, err := k8s.LoadRawConfig(); err == nil {
+				contextName = rawCfg.CurrentContext
+			}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(postureReport{
+			Generated: time.Now().UTC().Truncate(time.Second),
+			Context:   contextName,
+			Namespace: namespace,
+			Pods:      postures,
+			Grades:    counts,
+		})
+	}
+
+	if len(postures) == 0 {
+		fmt.Println("No running pods found")
+		return nil
+	}
+	printPostures(postures)
+	if securityTable.Bordered() {
+		var summary []string
+		for _, g := range grades {
+			summary = append(summary, fmt.Sprintf("%s %d", g.grade, counts[g.grade]))
+		}
+		fmt.Printf("\n%d pod(s): %s\n", len(postures), strings.Join(summary, ", "))
+	}
+	return nil
+}
+
+// gradePod collects the findings of a pod and scores them
+func gradePod(pod *corev1.Pod, grants map[string][]string) podPosture {
+	sa := pod.Spec.ServiceAccountName
+	if sa == "" {
+		sa = "default"
+	}
+	p := podPosture{Namespace: pod.Namespace, Name: pod.Name, ServiceAccount: sa, Findings: []securityFinding{}}
+	add := func(check, severity, container, detail string) {
+		p.Findings = append(p.Findings, securityFinding{Check: check, Severity: severity, Container: container, Detail: detail})
+	}
+
+	spec := &pod.Spec
+	if spec.HostNetwork {
+		add("host-network", severityHigh, "", "hostNetwork: true")
+	}
+	if spec.HostPID {
+		add("host-network", severityHigh, "", "hostPID: true")
+	}
+	if spec.HostIPC {
+		add("host-network", severityHigh, "", "hostIPC: true")
+	}
+	for _, v := range spec.Volumes {
+		if v.HostPath != nil {
+			add("host-path", severityHigh, "", fmt.Sprintf("volume %s mounts %s", v.Name, v.HostPath.Path))
+		}
+	}
+
+	podSC := spec.SecurityContext
+	if podSC == nil {
+		podSC = &corev1.PodSecurityContext{}
+	}
+	podSCSet := spec.SecurityContext != nil && !equality.Semantic.DeepEqual(*spec.SecurityContext, corev1.PodSecurityContext{})
+	containers := append(append([]corev1.Container(nil), spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		sc := c.SecurityContext
+		if sc == nil {
+			if !podSCSet {
+				add("no-security-context", severityLow, c.Name, "no securityContext on pod or container")
+			}
+			sc = &corev1.SecurityContext{}
+		}
+		if sc.Privileged != nil && *sc.Privileged {
+			add("privileged", severityCritical, c.Name, "privileged: true")
+		}
+
+		runAsUser, runAsNonRoot := podSC.RunAsUser, podSC.RunAsNonRoot
+		if sc.RunAsUser != nil {
+			runAsUser = sc.RunAsUser
+		}
+		if sc.RunAsNonRoot != nil {
+			runAsNonRoot = sc.RunAsNonRoot
+		}
+		switch {
+		case runAsUser != nil && *runAsUser == 0:
+			add("run-as-root", severityHigh, c.Name, "runAsUser: 0")
+		case runAsUser == nil && (runAsNonRoot == nil || !*runAsNonRoot):
+			add("run-as-root", severityMedium, c.Name, "may run as root, neither runAsNonRoot nor runAsUser is set")
+		}
+	}
+
+	var granted []string
+	for _, key := range []string{pod.Namespace + "/" + sa, pod.Namespace + "/*", "*"} {
+		granted = append(granted, grants[key]...)
+	}
+	for _, grant := range granted {
+		severity := severityHigh
+		if strings.HasPrefix(grant, "* on *") {
+			severity = severityCritical
+		}
+		add("wildcard-rbac", severity, "", grant)
+	}
+
+	p.Score = 100
+	for _, f := range p.Findings {
+		p.Score -= severityPenalty[f.Severity]
+	}
+	if p.Score < 0 {
+		p.Score = 0
+	}
+	for _, g := range grades {
+		if p.Score >= g.minScore {
+			p.Grade = g.grade
+			break
+		}
+	}
+	return p
+}
+
+// wildcardGrants returns the wildcard rules granted to ServiceAccounts, keyed
+// by namespace/name. Grants to all ServiceAccounts of a namespace are keyed
+// namespace/*, grants to all ServiceAccounts of the cluster *.
+func wildcardGrants(ctx context.Context, client *k8s.Client, namespace string) (map[string][]string, error) {
+	rbac := client.Clientset.RbacV1()
+	clusterRoles, err := rbac.ClusterRoles().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clusterroles: %w", err)
+	}
+	roles, err := rbac.Roles(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	clusterBindings, err := rbac.ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clusterrolebindings: %w", err)
+	}
+	bindings, err := rbac.RoleBindings(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rolebindings: %w", err)
+	}
+
+	rules := map[string][]rbacv1.PolicyRule{}
+	for _, r := range clusterRoles.Items {
+		rules["ClusterRole/"+r.Name] = r.Rules
+	}
+	for _, r := range roles.Items {
+		rules[r.Namespace+"/Role/"+r.Name] = r.Rules
+	}
+
+	grants := map[string][]string{}
+	grant := func(subject rbacv1.Subject, bindingNamespace string, roleRules []rbacv1.PolicyRule, via string) {
+		wildcards := wildcardRules(roleRules)
+		if len(wildcards) == 0 {
+			return
+		}
+		var keys []string
+		switch {
+		case subject.Kind == rbacv1.ServiceAccountKind:
+			ns := subject.Namespace
+			if ns == "" {
+				ns = bindingNamespace
+			}
+			keys = []string{ns + "/" + subject.Name}
+		case subject.Kind == rbacv1.GroupKind && subject.Name == "system:serviceaccounts":
+			keys = []string{"*"}
+		case subject.Kind == rbacv1.GroupKind && strings.HasPrefix(subject.Name, "system:serviceaccounts:"):
+			keys = []string{strings.TrimPrefix(subject.Name, "system:serviceaccounts:") + "/*"}
+		}
+		for _, key := range keys {
+			for _, w := range wildcards {
+				grants[key] = append(grants[key], fmt.Sprintf("%s via %s", w, via))
+			}
+		}
+	}
+	for _, b := range clusterBindings.Items {
+		for _, s := range b.Subjects {
+			grant(s, "", rules["ClusterRole/"+b.RoleRef.Name], "ClusterRoleBinding/"+b.Name)
+		}
+	}
+	for _, b := range bindings.Items {
+		key := "ClusterRole/" + b.RoleRef.Name
+		if b.RoleRef.Kind == "Role" {
+			key = b.Namespace + "/Role/" + b.RoleRef.Name
+		}
+		for _, s := range b.Subjects {
+			grant(s, b.Namespace, rules[key], b.Namespace+"/RoleBinding/"+b.Name)
+		}
+	}
+	return grants, nil
+}
+
+// wildcardRules describes the rules that use * for verbs or resources.
+// Non-resource URLs only cover endpoints like /healthz and are ignored.
+func wildcardRules(rules []rbacv1.PolicyRule) []string {
+	var wildcards []string
+	for _, r := range rules {
+		if len(r.Resources) == 0 {
+			continue
+		}
+		if !utils.Contains(r.Verbs, "*") && !utils.Contains(r.Resources, "*") {
+			continue
+		}
+		wildcards = append(wildcards, fmt.Sprintf("%s on %s", strings.Join(r.Verbs, ","), strings.Join(r.Resources, ",")))
+	}
+	return wildcards
+}
+
+// printPostures prints one row per pod, worst first
+func printPostures(postures []podPosture) {
+	const (
+		colorReset  = "\033[0m"
+		colorRed    = "\033[31m"
+		colorGreen  = "\033[32m"
+		colorYellow = "\033[33m"
+	)
+
+	headers := []string{"POD", "SERVICEACCOUNT", "GRADE", "SCORE", "FINDINGS"}
+	if securityAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+	rows := make([][]string, 0, len(postures))
+	for _, p := range postures {
+		grade := p.Grade
+		switch grade {
+		case "A", "B":
+			grade = colorGreen + grade + colorReset
+		case "C":
+			grade = colorYellow + grade + colorReset
+		default:
+			grade = colorRed + grade + colorReset
+		}
+		// One entry per check, with the number of containers or grants
+		var checks []string
+		perCheck := map[string]int{}
+		for _, f := range p.Findings {
+			if perCheck[f.Check] == 0 {
+				checks = append(checks, f.Check)
+			}
+			perCheck[f.Check]++
+		}
+		for i, check := range checks {
+			if n := perCheck[check]; n > 1 {
+				checks[i] = fmt.Sprintf("%s(%d)", check, n)
+			}
+		}
+		findings := strings.Join(checks, ", ")
+		if findings == "" {
+			findings = "-"
+		}
+
+		row := []string{p.Name, p.ServiceAccount, grade, fmt.Sprintf("%d", p.Score), findings}
+		if securityAllNamespaces {
+			row = append([]string{p.Namespace}, row...)
+		}
+		rows = append(rows, row)
+	}
+
+	nameColumn := 0
+	if securityAllNamespaces {
+		nameColumn = 1
+	}
+	securityTable.Print(headers, rows, nameColumn)
+}
+
+// init initializes flags for kube-security command
+func init() {
+	securityRootCmd.Flags().StringVarP(&securityNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	securityRootCmd.Flags().StringVarP(&securityKubeContext, "context", "c", "", "Kubernetes context to use")
+	securityRootCmd.Flags().BoolVarP(&securityAllNamespaces, "all-namespaces", "A", false, "Scan pods of all namespaces")
+	securityTable.AddFlags(securityRootCmd, "json")
+
+	viper.BindPFlag("namespace", securityRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", securityRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-security
+func main() {
+	k8s.AddVerbosityFlag(securityRootCmd)
+	k8s.AddRateLimitFlags(securityRootCmd)
+	k8s.AddFromDirFlag(securityRootCmd)
+	config.SetupDefaults(securityRootCmd)
+	clierr.SetupUsage(securityRootCmd)
+	cmd, err := securityRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
@@ -1,35 +1,163 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
 	"kube/pkg/shared/utils"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
 )
 
 var (
 	servicesNamespace     string
 	servicesContext       string
 	servicesAllNamespaces bool
+	servicesTable         table.Options
+	servicesURLs          bool
+	servicesCheckURLs     bool
+	servicesDialTimeout   time.Duration
 )
 
+// serviceURL is one address a NodePort or LoadBalancer service is reached at
+// from outside the cluster
+type serviceURL struct {
+	svc  *corev1.Service
+	port corev1.ServicePort
+	via  string
+	host string
+	// skip tells why the address is not checked, e.g. UDP
+	skip string
+}
+
 // servicesRootCmd represents the kube-services command
 var servicesRootCmd = &cobra.Command{
 	Use:   "kube-services",
 	Short: "List services",
-	Long:  `kube-services lists services in your Kubernetes cluster with a clean table output.`,
-	RunE:  runServices,
+	Long: `kube-services lists services in your Kubernetes cluster with a clean table output.
+
+Headless services (ClusterIP None) and ExternalName services have no service
+IP; their CLUSTER-IP and EXTERNAL-IP columns say so and show the CNAME target.
+
+--urls lists where NodePort and LoadBalancer services are reached from
+outside the cluster: every node (external IP, or internal IP when a node has
+none) with the nodePort, the load balancer hostname or IP with the service
+port, and spec.externalIPs. Each address is checked with a TCP connect from
+this machine. With externalTrafficPolicy Local kube-proxy only answers on
+nodes running a ready endpoint, so the other nodes are listed as skipped.
+
+Use 'kube-services check <name>' to test DNS resolution and TCP connectivity of a service.
+Use 'kube-services dns <name>' to see the DNS records a service gets.
+Use 'kube-services lint' to find selectors that silently match nothing.`,
+	RunE: runServices,
+}
+
+// checkServiceCmd represents the kube-services check subcommand
+var checkServiceCmd = &cobra.Command{
+	Use:   "check <service-name>",
+	Short: "Check DNS and connectivity of a service from inside the cluster",
+	Long: `check runs connectivity triage for a service from a small test pod in the
+service namespace:
+
+- resolves the service DNS name
+- connects to every TCP port on the service ClusterIP
+- connects to every TCP port on each endpoint (pod) directly
+
+Results tell whether the problem is DNS, the service/kube-proxy layer, or the
+application itself. An existing check pod is reused; a pod created by the check
+is deleted afterwards unless --keep is set.
+
+Examples:
+  kube-services check backend
+  kube-services check backend -n payments --keep`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCheckService,
+}
+
+// lintServicesCmd represents the kube-services lint subcommand
+var lintServicesCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Find selectors that match nothing",
+	Long: `lint looks for selector mismatches that Kubernetes accepts without complaint:
+
+- Services whose selector matches no pods (no endpoints, requests fail)
+- Deployments, StatefulSets and DaemonSets whose selector does not match
+  their own pod template labels
+- NetworkPolicies whose pod selector matches no pods (the policy does nothing)
+
+Exits with an error when problems are found, so it can run in CI.
+
+Examples:
+  kube-services lint          # Current namespace
+  kube-services lint -A       # Whole cluster`,
+	Args: cobra.NoArgs,
+	RunE: runLintServices,
+}
+
+// dnsServiceCmd represents the kube-services dns subcommand
+var dnsServiceCmd = &cobra.Command{
+	Use:   "dns <service-name>",
+	Short: "Show the DNS records cluster DNS serves for a service",
+	Long: `dns lists the records the cluster DNS (CoreDNS) derives from a service and
+its endpoints, and explains how clients reach the pods:
+
+- ClusterIP services get an A record for the service IP, kube-proxy balances
+  connections across the ready endpoints
+- Headless services (ClusterIP None) get one A record per ready pod on the
+  service name, plus a record per pod: <hostname>.<service> for pods with a
+  hostname and subdomain (StatefulSets), <dashed-ip>.<service> otherwise
+- ExternalName services get a CNAME to the external name, nothing is proxied
+- Named ports get SRV records
+
+Records are computed from the API, not resolved; use 'kube-services check' to
+resolve from inside the cluster.
+
+Examples:
+  kube-services dns backend
+  kube-services dns kafka-headless -n streaming`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDNSService,
+}
+
+// selectorProblem is one selector that matches nothing
+type selectorProblem struct {
+	namespace string
+	kind      string
+	name      string
+	problem   string
 }
 
 // runServices executes the logic to list services
 func runServices(cmd *cobra.Command, args []string) error {
+	if err := servicesTable.Validate(); err != nil {
+		return err
+	}
+
 	client, err := k8s.NewClient("", servicesContext)
 	if err != nil {
 		return fmt.Errorf("failed to create kubernetes client: %w", err)
@@ -54,6 +182,9 @@ func runServices(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to list services: %w", err)
 	}
+	if servicesURLs {
+		return printServiceURLs(client, services.Items)
+	}
 
 	// Prepare table data
 	var headers []string
@@ -63,8 +194,9 @@ func runServices(cmd *cobra.Command, args []string) error {
 		headers = []string{"NAME", "TYPE", "CLUSTER-IP", "EXTERNAL-IP", "PORT(S)", "AGE"}
 	}
 
-	var rows [][]string
+	rows := make([][]string, 0, len(services.Items))
 	for _, svc := range services.Items {
+		clusterIP := svc.Spec.ClusterIP
 		externalIP := "<none>"
 		if len(svc.Status.LoadBalancer.Ingress) > 0 {
 			if svc.Status.LoadBalancer.Ingress[0].IP != "" {
@@ -73,6 +205,16 @@ func runServices(cmd *cobra.Command, args []string) error {
 				externalIP = svc.Status.LoadBalancer.Ingress[0].Hostname
 			}
 		}
+		switch {
+		case svc.Spec.Type == corev1.ServiceTypeExternalName:
+			// No IP at all, the name is a CNAME to the target
+			clusterIP = "-"
+			externalIP = "CNAME " + svc.Spec.ExternalName
+		case svc.Spec.ClusterIP == corev1.ClusterIPNone:
+			// Headless, the name resolves to the pod IPs
+			clusterIP = "None (headless)"
+			externalIP = "-"
+		}
 
 		ports := ""
 		for i, port := range svc.Spec.Ports {
@@ -85,6 +227,9 @@ func runServices(cmd *cobra.Command, args []string) error {
 				ports += fmt.Sprintf("%d/%s", port.Port, port.Protocol)
 			}
 		}
+		if ports == "" {
+			ports = "-"
+		}
 
 		age := metav1.Now().Time.Sub(svc.CreationTimestamp.Time)
 
@@ -93,7 +238,7 @@ func runServices(cmd *cobra.Command, args []string) error {
 				svc.Namespace,
 				svc.Name,
 				string(svc.Spec.Type),
-				svc.Spec.ClusterIP,
+				clusterIP,
 				externalIP,
 				ports,
 				utils.FormatAge(age),
@@ -102,7 +247,7 @@ func runServices(cmd *cobra.Command, args []string) error {
 			rows = append(rows, []string{
 				svc.Name,
 				string(svc.Spec.Type),
-				svc.Spec.ClusterIP,
+				clusterIP,
 				externalIP,
 				ports,
 				utils.FormatAge(age),
@@ -110,94 +255,933 @@ func runServices(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	renderTable(headers, rows)
+	nameColumn := 0
+	if servicesAllNamespaces {
+		nameColumn = 1
+	}
+	servicesTable.Print(headers, rows, nameColumn)
+	return nil
+}
+
+// printServiceURLs lists the outside addresses of the NodePort and
+// LoadBalancer services and checks that they accept TCP connections
+func printServiceURLs(client *k8s.Client, services []corev1.Service) error {
+	if servicesDialTimeout <= 0 {
+		return clierr.Usagef("--timeout must be positive")
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	var urls []serviceURL
+	var nodes []corev1.Node
+	nodesLoaded := false
+	for i := range services {
+		svc := &services[i]
+		if svc.Spec.Type != corev1.ServiceTypeNodePort && svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			continue
+		}
+
+		if !nodesLoaded {
+			list, err := client.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				// Load balancer addresses do not need the nodes
+				fmt.Fprintf(os.Stderr, "Warning: failed to list nodes, NodePort addresses are left out: %v\n", err)
+			} else {
+				nodes = list.Items
+				sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+			}
+			nodesLoaded = true
+		}
+
+		var endpointNodes map[string]bool
+		if svc.Spec.ExternalTrafficPolicy == corev1.ServiceExternalTrafficPolicyLocal {
+			var err error
+			if endpointNodes, err = readyEndpointNodes(ctx, client, svc); err != nil {
+				return err
+			}
+		}
+
+		for _, port := range svc.Spec.Ports {
+			skip := ""
+			if port.Protocol != corev1.ProtocolTCP && port.Protocol != "" {
+				skip = string(port.Protocol) + " is not checked"
+			}
+			if port.NodePort != 0 {
+				for _, node := range nodes {
+					host, kind := nodeAddress(&node)
+					if host == "" {
+						continue
+					}
+					u := serviceURL{svc: svc, port: port, via: "node " + node.Name + kind, host: net.JoinHostPort(host, strconv.Itoa(int(port.NodePort))), skip: skip}
+					if endpointNodes != nil && !endpointNodes[node.Name] {
+						u.skip = "no ready endpoint on this node (externalTrafficPolicy Local)"
+					}
+					urls = append(urls, u)
+				}
+			}
+			for _, ingress := range svc.Status.LoadBalancer.Ingress {
+				host := ingress.Hostname
+				if host == "" {
+					host = ingress.IP
+				}
+				urls = append(urls, serviceURL{svc: svc, port: port, via: "load balancer", host: net.JoinHostPort(host, strconv.Itoa(int(port.Port))), skip: skip})
+			}
+			for _, ip := range svc.Spec.ExternalIPs {
+				urls = append(urls, serviceURL{svc: svc, port: port, via: "external IP", host: net.JoinHostPort(ip, strconv.Itoa(int(port.Port))), skip: skip})
+			}
+		}
+	}
+
+	// Unreachable addresses take the whole timeout, dial them all at once
+	results := make([]checkResult, len(urls))
+	k8s.FanOut(len(urls), func(i int) {
+		results[i] = dialURL(ctx, urls[i])
+	})
+
+	headers := []string{"NAME", "PORT", "VIA", "URL", "RESULT", "LATENCY", "DETAIL"}
+	if servicesAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+	rows := make([][]string, 0, len(urls))
+	for i, u := range urls {
+		r := results[i]
+		result := colorResult("OK")
+		switch {
+		case r.skipped:
+			result = colorResult("SKIPPED")
+		case !r.ok:
+			result = colorResult("FAIL")
+		}
+		port := strconv.Itoa(int(u.port.Port))
+		if u.port.Name != "" {
+			port = u.port.Name + "/" + port
+		}
+		row := []string{u.svc.Name, port, u.via, urlScheme(u.port) + u.host, result, r.latency, r.detail}
+		if servicesAllNamespaces {
+			row = append([]string{u.svc.Namespace}, row...)
+		}
+		rows = append(rows, row)
+	}
+
+	nameColumn := 0
+	if servicesAllNamespaces {
+		nameColumn = 1
+	}
+	servicesTable.Print(headers, rows, nameColumn)
 	return nil
 }
 
+// readyEndpointNodes returns the nodes running a ready endpoint of the service
+func readyEndpointNodes(ctx context.Context, client *k8s.Client, svc *corev1.Service) (map[string]bool, error) {
+	slices, err := client.Clientset.DiscoveryV1().EndpointSlices(svc.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + svc.Name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list endpoint slices of service %s: %w", svc.Name, err)
+	}
+	nodes := map[string]bool{}
+	for _, slice := range slices.Items {
+		for _, ep := range slice.Endpoints {
+			if ep.NodeName != nil && (ep.Conditions.Ready == nil || *ep.Conditions.Ready) {
+				nodes[*ep.NodeName] = true
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// nodeAddress returns the external IP of a node, or its internal IP when it
+// has none, e.g. private clusters reached over a VPN
+func nodeAddress(node *corev1.Node) (string, string) {
+	internal := ""
+	for _, addr := range node.Status.Addresses {
+		switch addr.Type {
+		case corev1.NodeExternalIP:
+			return addr.Address, ""
+		case corev1.NodeInternalIP:
+			if internal == "" {
+				internal = addr.Address
+			}
+		}
+	}
+	if internal == "" {
+		return "", ""
+	}
+	return internal, " (internal IP)"
+}
+
+// urlScheme guesses the scheme from the port name or number, tcp:// when
+// neither tells
+func urlScheme(port corev1.ServicePort) string {
+	if port.Protocol != corev1.ProtocolTCP && port.Protocol != "" {
+		return strings.ToLower(string(port.Protocol)) + "://"
+	}
+	name := strings.ToLower(port.Name)
+	if port.AppProtocol != nil {
+		name = strings.ToLower(*port.AppProtocol)
+	}
+	switch {
+	case strings.HasPrefix(name, "https"), port.Port == 443, port.Port == 8443:
+		return "https://"
+	case strings.HasPrefix(name, "http"), port.Port == 80, port.Port == 8080:
+		return "http://"
+	}
+	return "tcp://"
+}
+
+// dialURL connects to the address of u from this machine
+func dialURL(ctx context.Context, u serviceURL) checkResult {
+	r := checkResult{check: "tcp", target: u.host, latency: "-"}
+	switch {
+	case u.skip != "":
+		r.skipped, r.detail = true, u.skip
+		return r
+	case !servicesCheckURLs:
+		r.skipped, r.detail = true, "not checked"
+		return r
+	}
+
+	started := time.Now()
+	dialer := net.Dialer{Timeout: servicesDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", u.host)
+	if err != nil {
+		r.detail = dialError(err)
+		return r
+	}
+	conn.Close()
+	r.ok = true
+	r.latency = "<1ms"
+	if latency := time.Since(started).Round(time.Millisecond); latency > 0 {
+		r.latency = latency.String()
+	}
+	return r
+}
+
+// dialError shortens the usual connect errors
+func dialError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout, filtered by a firewall or security group?"
+	case strings.Contains(err.Error(), "connection refused"):
+		return "connection refused"
+	case strings.Contains(err.Error(), "no such host"):
+		return "hostname does not resolve"
+	}
+	return err.Error()
+}
+
 // init initializes flags for kube-services command
 func init() {
 	// Define flags
 	servicesRootCmd.Flags().StringVarP(&servicesNamespace, "namespace", "n", "", "Kubernetes namespace to use")
 	servicesRootCmd.Flags().StringVarP(&servicesContext, "context", "c", "", "Kubernetes context to use")
 	servicesRootCmd.Flags().BoolVarP(&servicesAllNamespaces, "all-namespaces", "A", false, "Show services from all namespaces")
+	servicesTable.AddFlags(servicesRootCmd)
+	servicesRootCmd.Flags().BoolVar(&servicesURLs, "urls", false, "List the addresses NodePort and LoadBalancer services are reached at from outside and check them")
+	servicesRootCmd.Flags().BoolVar(&servicesCheckURLs, "check", true, "With --urls, check that every address accepts TCP connections")
+	servicesRootCmd.Flags().DurationVar(&servicesDialTimeout, "timeout", 3*time.Second, "With --urls, how long to wait for each connection")
+
+	// Namespace and context are shared with subcommands
+	servicesRootCmd.PersistentFlags().AddFlag(servicesRootCmd.Flags().Lookup("namespace"))
+	servicesRootCmd.PersistentFlags().AddFlag(servicesRootCmd.Flags().Lookup("context"))
+
+	checkServiceCmd.Flags().String("image", "busybox:1.36", "Image for the test pod (needs sh, nslookup and nc)")
+	checkServiceCmd.Flags().Bool("keep", false, "Keep the test pod after the check for reuse")
+	lintServicesCmd.Flags().BoolVarP(&servicesAllNamespaces, "all-namespaces", "A", false, "Lint all namespaces")
+	servicesTable.AddFlags(lintServicesCmd)
+	dnsServiceCmd.Flags().String("cluster-domain", "cluster.local", "DNS domain of the cluster")
+	servicesTable.AddFlags(dnsServiceCmd)
+	servicesRootCmd.AddCommand(checkServiceCmd, lintServicesCmd, dnsServiceCmd)
 
 	// Bind flags with viper
 	viper.BindPFlag("namespace", servicesRootCmd.Flags().Lookup("namespace"))
 	viper.BindPFlag("context", servicesRootCmd.Flags().Lookup("context"))
 }
 
-// renderTable prints an ASCII table with simple borders
-// headers: column headers, rows: row data
-func renderTable(headers []string, rows [][]string) {
-	widths := make([]int, len(headers))
-	// Calculate width based on content (excluding ANSI color codes if any)
-	for c, h := range headers {
-		w := displayWidth(h)
-		if w > widths[c] {
-			widths[c] = w
+// runLintServices checks the selectors of services, workloads and network policies
+func runLintServices(cmd *cobra.Command, args []string) error {
+	if err := servicesTable.Validate(); err != nil {
+		return err
+	}
+
+	client, err := k8s.NewClient("", servicesContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	namespace := servicesNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(servicesContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	if servicesAllNamespaces {
+		namespace = ""
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	pods, err := client.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	podLabels := map[string][]labels.Set{}
+	for _, pod := range pods.Items {
+		// Finished pods are not selected by anything that matters here
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		podLabels[pod.Namespace] = append(podLabels[pod.Namespace], labels.Set(pod.Labels))
+	}
+	matchesAny := func(ns string, selector labels.Selector) bool {
+		for _, set := range podLabels[ns] {
+			if selector.Matches(set) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var problems []selectorProblem
+
+	services, err := client.Clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	for _, svc := range services.Items {
+		// Services without selector have manually managed endpoints
+		if svc.Spec.Type == corev1.ServiceTypeExternalName || len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		selector := labels.SelectorFromSet(svc.Spec.Selector)
+		if !matchesAny(svc.Namespace, selector) {
+			problems = append(problems, selectorProblem{svc.Namespace, "Service", svc.Name,
+				fmt.Sprintf("selector %s matches no pods", selector)})
+		}
+	}
+
+	workloadSelectors, err := listWorkloadSelectors(ctx, client, namespace)
+	if err != nil {
+		return err
+	}
+	for _, w := range workloadSelectors {
+		selector, err := metav1.LabelSelectorAsSelector(w.selector)
+		if err != nil {
+			problems = append(problems, selectorProblem{w.namespace, w.kind, w.name, fmt.Sprintf("invalid selector: %v", err)})
+			continue
+		}
+		if !selector.Matches(labels.Set(w.templateLabels)) {
+			problems = append(problems, selectorProblem{w.namespace, w.kind, w.name,
+				fmt.Sprintf("selector %s does not match template labels %s", selector, labels.Set(w.templateLabels))})
+		}
+	}
+
+	policies, err := client.Clientset.NetworkingV1().NetworkPolicies(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list networkpolicies: %w", err)
+	}
+	for _, np := range policies.Items {
+		selector, err := metav1.LabelSelectorAsSelector(&np.Spec.PodSelector)
+		if err != nil {
+			problems = append(problems, selectorProblem{np.Namespace, "NetworkPolicy", np.Name, fmt.Sprintf("invalid pod selector: %v", err)})
+			continue
+		}
+		// An empty selector selects every pod of the namespace, even future ones
+		if selector.Empty() {
+			continue
+		}
+		if !matchesAny(np.Namespace, selector) {
+			problems = append(problems, selectorProblem{np.Namespace, "NetworkPolicy", np.Name,
+				fmt.Sprintf("pod selector %s matches no pods", selector)})
+		}
+	}
+
+	if len(problems) == 0 {
+		fmt.Println("No selector problems found")
+		return nil
+	}
+
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].namespace != problems[j].namespace {
+			return problems[i].namespace < problems[j].namespace
+		}
+		if problems[i].kind != problems[j].kind {
+			return problems[i].kind < problems[j].kind
+		}
+		return problems[i].name < problems[j].name
+	})
+	headers := []string{"NAMESPACE", "KIND", "NAME", "PROBLEM"}
+	rows := make([][]string, 0, len(problems))
+	for _, p := range problems {
+		rows = append(rows, []string{p.namespace, p.kind, p.name, p.problem})
+	}
+	servicesTable.Print(headers, rows, 2)
+	return clierr.Newf(clierr.Generic, "found %d selector problems", len(problems))
+}
+
+// workloadSelector is the selector and pod template labels of a workload
+type workloadSelector struct {
+	namespace      string
+	kind           string
+	name           string
+	selector       *metav1.LabelSelector
+	templateLabels map[string]string
+}
+
+// listWorkloadSelectors collects the selectors of Deployments, StatefulSets and DaemonSets
+func listWorkloadSelectors(ctx context.Context, client *k8s.Client, namespace string) ([]workloadSelector, error) {
+	var out []workloadSelector
+	deployments, err := client.Clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, d := range deployments.Items {
+		out = append(out, workloadSelector{d.Namespace, "Deployment", d.Name, d.Spec.Selector, d.Spec.Template.Labels})
+	}
+	statefulSets, err := client.Clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, s := range statefulSets.Items {
+		out = append(out, workloadSelector{s.Namespace, "StatefulSet", s.Name, s.Spec.Selector, s.Spec.Template.Labels})
+	}
+	daemonSets, err := client.Clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+	for _, ds := range daemonSets.Items {
+		out = append(out, workloadSelector{ds.Namespace, "DaemonSet", ds.Name, ds.Spec.Selector, ds.Spec.Template.Labels})
+	}
+	return out, nil
+}
+
+const checkPodName = "kube-services-check"
+
+// dnsRecord is a record cluster DNS serves for a service
+type dnsRecord struct {
+	name  string
+	kind  string
+	value string
+}
+
+// runDNSService prints the DNS records of a service and how they behave
+func runDNSService(cmd *cobra.Command, args []string) error {
+	serviceName := args[0]
+	domain, _ := cmd.Flags().GetString("cluster-domain")
+	if err := servicesTable.Validate(); err != nil {
+		return err
+	}
+	if domain = strings.Trim(domain, "."); domain == "" {
+		return clierr.Usagef("--cluster-domain cannot be empty")
+	}
+
+	client, err := k8s.NewClient("", servicesContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	targetNamespace := servicesNamespace
+	if targetNamespace == "" {
+		ns, err := k8s.GetCurrentNamespace(servicesContext)
+		if err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+		targetNamespace = ns
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	svc, err := client.Clientset.CoreV1().Services(targetNamespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return clierr.Newf(clierr.NotFound, "service %s not found in namespace %s", serviceName, targetNamespace)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get service %s: %w", serviceName, err)
+	}
+
+	var eps *corev1.Endpoints
+	if svc.Spec.Type != corev1.ServiceTypeExternalName {
+		eps, err = client.Clientset.CoreV1().Endpoints(targetNamespace).Get(ctx, serviceName, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get endpoints for service %s: %w", serviceName, err)
+		}
+	}
+
+	records, notes := serviceDNSRecords(svc, eps, domain)
+	headers := []string{"NAME", "TYPE", "VALUE"}
+	rows := make([][]string, 0, len(records))
+	for _, r := range records {
+		rows = append(rows, []string{r.name, r.kind, r.value})
+	}
+	servicesTable.Print(headers, rows, 0)
+
+	if servicesTable.Bordered() {
+		fmt.Println()
+		for _, note := range notes {
+			fmt.Println(note)
+		}
+	}
+	return nil
+}
+
+// serviceDNSRecords computes the records CoreDNS serves for a service, following
+// the Kubernetes DNS specification, with notes on how clients reach the pods
+func serviceDNSRecords(svc *corev1.Service, eps *corev1.Endpoints, domain string) ([]dnsRecord, []string) {
+	fqdn := fmt.Sprintf("%s.%s.svc.%s", svc.Name, svc.Namespace, domain)
+	var records []dnsRecord
+	var notes []string
+
+	if svc.Spec.Type == corev1.ServiceTypeExternalName {
+		records = append(records, dnsRecord{fqdn, "CNAME", svc.Spec.ExternalName})
+		notes = append(notes,
+			fmt.Sprintf("ExternalName: %s is an alias of %s at the DNS level only.", svc.Name, svc.Spec.ExternalName),
+			"Nothing is proxied: ports are not remapped and TLS certificates and Host headers must match the external name.")
+		if net.ParseIP(svc.Spec.ExternalName) != nil {
+			notes = append(notes, fmt.Sprintf("Warning: %s is an IP address, a CNAME to an IP does not resolve; use a service without selector and an Endpoints object instead.", svc.Spec.ExternalName))
 		}
+		return records, notes
 	}
-	for _, row := range rows {
-		for c, cell := range row {
-			w := displayWidth(cell)
-			if w > widths[c] {
-				widths[c] = w
+
+	// Ready addresses are published, not-ready ones only when the service asks
+	var addresses, notReady []corev1.EndpointAddress
+	var ports []corev1.EndpointPort
+	if eps != nil {
+		for _, subset := range eps.Subsets {
+			addresses = append(addresses, subset.Addresses...)
+			notReady = append(notReady, subset.NotReadyAddresses...)
+			if len(ports) == 0 {
+				ports = subset.Ports
+			}
+		}
+	}
+	if svc.Spec.PublishNotReadyAddresses {
+		addresses = append(addresses, notReady...)
+	}
+
+	headless := svc.Spec.ClusterIP == corev1.ClusterIPNone
+	if headless {
+		for _, addr := range addresses {
+			records = append(records, dnsRecord{fqdn, recordType(addr.IP), addr.IP})
+		}
+		for _, addr := range addresses {
+			value := addr.IP
+			if addr.TargetRef != nil && addr.TargetRef.Kind == "Pod" {
+				value += " (pod " + addr.TargetRef.Name + ")"
+			}
+			records = append(records, dnsRecord{endpointDNSName(addr) + "." + fqdn, recordType(addr.IP), value})
+		}
+	} else {
+		for _, ip := range svc.Spec.ClusterIPs {
+			records = append(records, dnsRecord{fqdn, recordType(ip), ip})
+		}
+	}
+
+	// SRV records exist for named ports; headless services point them at
+	// every pod, other services at the service name
+	for _, port := range svc.Spec.Ports {
+		if port.Name == "" {
+			continue
+		}
+		srv := fmt.Sprintf("_%s._%s.%s", port.Name, strings.ToLower(string(port.Protocol)), fqdn)
+		if !headless {
+			records = append(records, dnsRecord{srv, "SRV", fmt.Sprintf("%d %s", port.Port, fqdn)})
+			continue
+		}
+		target := port.TargetPort.String()
+		for _, p := range ports {
+			if p.Name == port.Name {
+				target = strconv.Itoa(int(p.Port))
 			}
 		}
+		for _, addr := range addresses {
+			records = append(records, dnsRecord{srv, "SRV", fmt.Sprintf("%s %s.%s", target, endpointDNSName(addr), fqdn)})
+		}
 	}
 
-	printSeparator(widths)
-	fmt.Println("| " + joinRow(headers, widths) + " |")
-	printSeparator(widths)
-	for _, row := range rows {
-		fmt.Println("| " + joinRow(row, widths) + " |")
+	switch {
+	case !headless:
+		notes = append(notes, fmt.Sprintf("ClusterIP: %s resolves to the service IP, kube-proxy balances connections across %d ready endpoint(s).", svc.Name, len(addresses)))
+	case len(addresses) == 0:
+		notes = append(notes, fmt.Sprintf("Headless: %s has no published endpoints, the name does not resolve (NXDOMAIN).", svc.Name))
+	default:
+		notes = append(notes,
+			fmt.Sprintf("Headless: %s resolves to the IPs of %d endpoint(s) directly, without a service IP or kube-proxy.", svc.Name, len(addresses)),
+			"Clients pick an address themselves and keep it as long as they cache the answer; each pod also has its own name.")
+	}
+	if headless && len(svc.Spec.Selector) == 0 {
+		notes = append(notes, "No selector: the records come from an Endpoints object managed outside of Kubernetes.")
+	}
+	if headless && !svc.Spec.PublishNotReadyAddresses && len(notReady) > 0 {
+		notes = append(notes, fmt.Sprintf("%d not-ready pod(s) are not published until they are ready (see publishNotReadyAddresses).", len(notReady)))
 	}
-	printSeparator(widths)
+	return records, notes
 }
 
-// displayWidth returns display length (excluding ANSI codes)
-func displayWidth(s string) int {
-	return len(stripANSI(s))
+// endpointDNSName returns the label of an endpoint of a headless service: the
+// pod hostname when it has one, its IP with dashes otherwise
+func endpointDNSName(addr corev1.EndpointAddress) string {
+	if addr.Hostname != "" {
+		return addr.Hostname
+	}
+	return strings.NewReplacer(".", "-", ":", "-").Replace(addr.IP)
 }
 
-// stripANSI removes ANSI color codes for accurate width calculation
-func stripANSI(s string) string {
-	ansi := regexp.MustCompile("\\x1b\\[[0-9;]*m")
-	return ansi.ReplaceAllString(s, "")
+// recordType returns the address record type of an IP
+func recordType(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "AAAA"
+	}
+	return "A"
 }
 
-// joinRow left-aligns each cell and joins with column separator
-func joinRow(cols []string, widths []int) string {
-	parts := make([]string, len(cols))
-	for i, col := range cols {
-		pad := widths[i] - displayWidth(col)
-		if pad < 0 {
-			pad = 0
+// checkResult is a single DNS or TCP probe result
+type checkResult struct {
+	check   string
+	target  string
+	ok      bool
+	skipped bool
+	latency string
+	detail  string
+}
+
+// runCheckService probes DNS and TCP connectivity of a service from a test pod
+func runCheckService(cmd *cobra.Command, args []string) error {
+	serviceName := args[0]
+	image, _ := cmd.Flags().GetString("image")
+	keep, _ := cmd.Flags().GetBool("keep")
+
+	client, err := k8s.NewClient("", servicesContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	targetNamespace := servicesNamespace
+	if targetNamespace == "" {
+		ns, err := k8s.GetCurrentNamespace(servicesContext)
+		if err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
 		}
-		parts[i] = col + strings.Repeat(" ", pad)
+		targetNamespace = ns
 	}
-	return strings.Join(parts, " | ")
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	svc, err := client.Clientset.CoreV1().Services(targetNamespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get service %s: %w", serviceName, err)
+	}
+
+	eps, err := client.Clientset.CoreV1().Endpoints(targetNamespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get endpoints for service %s: %w", serviceName, err)
+	}
+
+	created, err := ensureCheckPod(ctx, client, targetNamespace, image)
+	if created && !keep {
+		cleanup := sync.OnceFunc(func() {
+			client.Clientset.CoreV1().Pods(targetNamespace).Delete(context.Background(), checkPodName, metav1.DeleteOptions{})
+		})
+		defer cleanup()
+		defer interrupt.OnExit(cleanup)()
+	}
+	if err != nil {
+		return err
+	}
+
+	script, probes := buildCheckScript(svc, eps)
+	var stdout, stderr bytes.Buffer
+	if err := execInPod(ctx, client, targetNamespace, checkPodName, []string{"sh", "-c", script}, &stdout, &stderr); err != nil {
+		return fmt.Errorf("failed to run checks in pod %s: %w (%s)", checkPodName, err, strings.TrimSpace(stderr.String()))
+	}
+
+	results := parseCheckOutput(stdout.String(), probes)
+
+	headers := []string{"CHECK", "TARGET", "RESULT", "LATENCY", "DETAIL"}
+	rows := make([][]string, 0, len(results))
+	for _, r := range results {
+		result := colorResult("OK")
+		switch {
+		case r.skipped:
+			result = colorResult("SKIPPED")
+		case !r.ok:
+			result = colorResult("FAIL")
+		}
+		rows = append(rows, []string{r.check, r.target, result, r.latency, r.detail})
+	}
+	table.Render(headers, rows)
+
+	fmt.Println()
+	fmt.Println(checkVerdict(svc, eps, results))
+	return nil
 }
 
-// printSeparator prints border line based on column widths
-func printSeparator(widths []int) {
-	b := strings.Builder{}
-	b.WriteString("+")
-	for i, w := range widths {
-		b.WriteString(strings.Repeat("-", w+2))
-		if i == len(widths)-1 {
-			b.WriteString("+")
+// ensureCheckPod reuses a running check pod or creates a new one.
+// Returns true when the pod was created by this invocation.
+func ensureCheckPod(ctx context.Context, client *k8s.Client, namespace, image string) (bool, error) {
+	pods := client.Clientset.CoreV1().Pods(namespace)
+
+	existing, err := pods.Get(ctx, checkPodName, metav1.GetOptions{})
+	if err == nil && existing.DeletionTimestamp == nil && existing.Status.Phase == corev1.PodRunning {
+		fmt.Printf("Reusing test pod %s/%s\n", namespace, checkPodName)
+		return false, nil
+	}
+	if err == nil {
+		// Not usable (finished or terminating): replace it
+		if err := pods.Delete(ctx, checkPodName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return false, fmt.Errorf("failed to delete stale test pod: %w", err)
+		}
+		for i := 0; i < 60; i++ {
+			if _, err := pods.Get(ctx, checkPodName, metav1.GetOptions{}); apierrors.IsNotFound(err) {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-time.After(1 * time.Second):
+			}
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to get test pod: %w", err)
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   checkPodName,
+			Labels: map[string]string{"app.kubernetes.io/managed-by": "kube-services"},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{{
+				Name:    "check",
+				Image:   image,
+				Command: []string{"sleep", "3600"},
+			}},
+		},
+	}
+	if _, err := pods.Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return false, fmt.Errorf("failed to create test pod: %w", err)
+	}
+
+	fmt.Printf("Starting test pod %s/%s (%s)...\n", namespace, checkPodName, image)
+	for i := 0; i < 120; i++ {
+		current, err := pods.Get(ctx, checkPodName, metav1.GetOptions{})
+		if err == nil && current.Status.Phase == corev1.PodRunning {
+			return true, nil
+		}
+		if err == nil && (current.Status.Phase == corev1.PodFailed || current.Status.Phase == corev1.PodSucceeded) {
+			return true, fmt.Errorf("test pod exited with phase %s", current.Status.Phase)
+		}
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
+	}
+	return true, clierr.Timeoutf("timeout waiting for test pod %s to start", checkPodName)
+}
+
+// checkProbe is a probe planned by buildCheckScript
+type checkProbe struct {
+	check  string
+	target string
+	skip   string
+}
+
+// buildCheckScript builds a shell script that prints one result line per probe:
+// "<index> <exit-code> <start-ns> <end-ns> <detail...>"
+func buildCheckScript(svc *corev1.Service, eps *corev1.Endpoints) (string, []checkProbe) {
+	var probes []checkProbe
+	var b strings.Builder
+	b.WriteString("t() { date +%s%N; }\n")
+
+	add := func(p checkProbe, body string) {
+		idx := len(probes)
+		probes = append(probes, p)
+		if p.skip != "" {
+			return
+		}
+		fmt.Fprintf(&b, "s=$(t); %s; e=$(t); echo \"%d $rc $s $e $out\"\n", body, idx)
+	}
+
+	fqdn := fmt.Sprintf("%s.%s.svc.cluster.local", svc.Name, svc.Namespace)
+	if svc.Spec.Type == corev1.ServiceTypeExternalName {
+		fqdn = svc.Spec.ExternalName
+	}
+	add(checkProbe{check: "DNS", target: fqdn},
+		fmt.Sprintf("out=$(nslookup %s 2>&1 | awk '/^Name:/{n=1} n && /^Address/{print ($1 == \"Address:\") ? $2 : $3}' | tr '\\n' ','); rc=$?; [ -n \"$out\" ] || rc=1", fqdn))
+
+	tcp := func(check, host string, port int32, protocol corev1.Protocol) {
+		p := checkProbe{check: check, target: fmt.Sprintf("%s:%d", host, port)}
+		if protocol != "" && protocol != corev1.ProtocolTCP {
+			p.skip = fmt.Sprintf("%s not probed", protocol)
+		}
+		add(p, fmt.Sprintf("nc -z -w 3 %s %d >/dev/null 2>&1; rc=$?; out=", host, port))
+	}
+
+	if svc.Spec.ClusterIP != "" && svc.Spec.ClusterIP != corev1.ClusterIPNone {
+		for _, port := range svc.Spec.Ports {
+			tcp("SERVICE", svc.Spec.ClusterIP, port.Port, port.Protocol)
+		}
+	}
+
+	if eps != nil {
+		for _, subset := range eps.Subsets {
+			addresses := append([]corev1.EndpointAddress{}, subset.Addresses...)
+			addresses = append(addresses, subset.NotReadyAddresses...)
+			for i, addr := range addresses {
+				check := "ENDPOINT"
+				if i >= len(subset.Addresses) {
+					check = "ENDPOINT (not ready)"
+				}
+				if addr.TargetRef != nil {
+					check += " " + addr.TargetRef.Name
+				}
+				for _, port := range subset.Ports {
+					tcp(check, addr.IP, port.Port, port.Protocol)
+				}
+			}
+		}
+	}
+
+	return b.String(), probes
+}
+
+// parseCheckOutput maps script output lines back to the planned probes
+func parseCheckOutput(output string, probes []checkProbe) []checkResult {
+	results := make([]checkResult, len(probes))
+	for i, p := range probes {
+		results[i] = checkResult{check: p.check, target: p.target, latency: "-"}
+		if p.skip != "" {
+			results[i].skipped = true
+			results[i].detail = p.skip
 		} else {
-			b.WriteString("+")
+			results[i].detail = "no result"
+		}
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 5)
+		if len(fields) < 4 {
+			continue
+		}
+		idx, err := strconv.Atoi(fields[0])
+		if err != nil || idx < 0 || idx >= len(results) {
+			continue
+		}
+		r := &results[idx]
+		r.ok = fields[1] == "0"
+		r.detail = ""
+		if len(fields) == 5 {
+			r.detail = strings.TrimSuffix(fields[4], ",")
+		}
+		if !r.ok && r.detail == "" {
+			r.detail = "connection failed or timed out"
+		}
+		start, err1 := strconv.ParseInt(fields[2], 10, 64)
+		end, err2 := strconv.ParseInt(fields[3], 10, 64)
+		if err1 == nil && err2 == nil && end >= start {
+			r.latency = fmt.Sprintf("%.1fms", float64(end-start)/1e6)
+		}
+	}
+	return results
+}
+
+// checkVerdict summarizes where the problem most likely is
+func checkVerdict(svc *corev1.Service, eps *corev1.Endpoints, results []checkResult) string {
+	var dnsOK, anyService, serviceOK, anyEndpoint, endpointOK bool
+	for _, r := range results {
+		if r.skipped {
+			continue
+		}
+		switch {
+		case r.check == "DNS":
+			dnsOK = r.ok
+		case r.check == "SERVICE":
+			anyService = true
+			serviceOK = serviceOK || r.ok
+		case strings.HasPrefix(r.check, "ENDPOINT"):
+			anyEndpoint = true
+			endpointOK = endpointOK || r.ok
+		}
+	}
+
+	ready := 0
+	if eps != nil {
+		for _, subset := range eps.Subsets {
+			ready += len(subset.Addresses)
 		}
 	}
-	fmt.Println(b.String())
+
+	switch {
+	case !dnsOK:
+		return "Verdict: DNS resolution failed - check CoreDNS and the service name/namespace"
+	case svc.Spec.Type != corev1.ServiceTypeExternalName && ready == 0:
+		return "Verdict: service has no ready endpoints - check the selector and pod readiness"
+	case anyEndpoint && !endpointOK:
+		return "Verdict: pods do not accept connections - the application is the problem (port, bind address, crash)"
+	case anyService && !serviceOK:
+		return "Verdict: pods accept connections but the service IP does not - check kube-proxy, targetPort and NetworkPolicies"
+	default:
+		return "Verdict: DNS and connectivity look healthy - the problem is likely at the application level"
+	}
+}
+
+// execInPod runs a non-interactive command in the first container of the pod
+func execInPod(ctx context.Context, client *k8s.Client, namespace, podName string, command []string, stdout, stderr io.Writer) error {
+	req := client.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("exec")
+
+	req.VersionedParams(&corev1.PodExecOptions{
+		Command: command,
+		Stdout:  true,
+		Stderr:  true,
+	}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(client.Config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create executor: %w", err)
+	}
+	return executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: stdout, Stderr: stderr})
+}
+
+// colorResult colors probe results
+func colorResult(result string) string {
+	const (
+		reset = "\033[0m"
+		green = "\033[32m"
+		red   = "\033[31m"
+		gray  = "\033[90m"
+	)
+	switch result {
+	case "OK":
+		return green + result + reset
+	case "FAIL":
+		return red + result + reset
+	default:
+		return gray + result + reset
+	}
 }
 
 // main is the entry point of kube-services
 func main() {
-	if err := servicesRootCmd.Execute(); err != nil {
+	k8s.AddVerbosityFlag(servicesRootCmd)
+	k8s.AddRateLimitFlags(servicesRootCmd)
+	k8s.AddFromDirFlag(servicesRootCmd)
+	config.SetupDefaults(servicesRootCmd)
+	clierr.SetupUsage(servicesRootCmd)
+	cmd, err := servicesRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(clierr.ExitCode(err))
 	}
 }
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/tracing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+var (
+	sniffNamespace   string
+	sniffKubeContext string
+	sniffContainer   string
+	sniffInterface   string
+	sniffPorts       []int
+	sniffHosts       []string
+	sniffFilter      string
+	sniffOutput      string
+	sniffWireshark   bool
+	sniffEphemeral   bool
+	sniffImage       string
+	sniffDuration    time.Duration
+)
+
+// sniffRootCmd represents the kube-sniff command
+var sniffRootCmd = &cobra.Command{
+	Use:   "kube-sniff <pod-name>",
+	Short: "Capture network traffic of a pod with tcpdump",
+	Long: `kube-sniff runs tcpdump inside a pod and streams the pcap to your machine.
+
+By default tcpdump is executed in the target container, which must have tcpdump
+installed. With --ephemeral a privileged debug container (default image
+nicolaka/netshoot) is added to the pod instead; it shares the pod's network
+namespace, so the capture sees the same traffic.
+
+The capture is written to a local pcap file, or piped into a locally launched
+Wireshark with --wireshark. Stop with Ctrl+C or use --duration.
+
+Examples:
+  kube-sniff my-pod                              # Capture to my-pod-<time>.pcap
+  kube-sniff my-pod --port 8080 -w api.pcap      # Only port 8080
+  kube-sniff my-pod --host 10.0.3.7 --wireshark  # Live view in Wireshark
+  kube-sniff my-pod --ephemeral --duration 30s   # No tcpdump in the image`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSniff,
+}
+
+// runSniff starts tcpdump in the pod and streams its output locally
+func runSniff(cmd *cobra.Command, args []string) error {
+	podName := args[0]
+
+	client, err := k8s.NewClient("", sniffKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	targetNamespace := sniffNamespace
+	if targetNamespace == "" {
+		ns, err := k8s.GetCurrentNamespace(sniffKubeContext)
+		if err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+		targetNamespace = ns
+	}
+
+	ctx, stop := interrupt.Context(context.Background())
+	defer stop()
+	if sniffDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sniffDuration)
+		defer cancel()
+	}
+
+	pod, err := client.Clientset.CoreV1().Pods(targetNamespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get pod %s: %w", podName, err)
+	}
+
+	container := sniffContainer
+	if sniffEphemeral {
+		container, err = addDebugContainer(ctx, client, pod)
+		if err != nil {
+			return err
+		}
+	} else if container == "" {
+		if len(pod.Spec.Containers) > 1 {
+			fmt.Println("Pod has multiple containers:")
+			for i, c := range pod.Spec.Containers {
+				fmt.Printf("  %d. %s\n", i+1, c.Name)
+			}
+			return clierr.Usagef("please specify container with --container flag")
+		}
+		container = pod.Spec.Containers[0].Name
+	}
+
+	// Choose destination: wireshark on stdin or a pcap file
+	var out io.WriteCloser
+	var viewer *exec.Cmd
+	if sniffWireshark {
+		viewer = exec.Command("wireshark", "-k", "-i", "-")
+		viewer.Stdout = os.Stdout
+		viewer.Stderr = os.Stderr
+		if out, err = viewer.StdinPipe(); err != nil {
+			return fmt.Errorf("failed to connect to wireshark: %w", err)
+		}
+		if err := viewer.Start(); err != nil {
+			return fmt.Errorf("failed to start wireshark: %w", err)
+		}
+	} else {
+		path := sniffOutput
+		if path == "" {
+			path = fmt.Sprintf("%s-%s.pcap", podName, time.Now().Format("20060102-150405"))
+		}
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		out = file
+		fmt.Fprintf(os.Stderr, "Writing capture to %s\n", path)
+	}
+
+	command := append([]string{"tcpdump", "-i", sniffInterface, "-U", "-w", "-"}, captureFilter()...)
+	fmt.Fprintf(os.Stderr, "Running '%s' in %s/%s (container %s). Press Ctrl+C to stop\n",
+		strings.Join(command, " "), targetNamespace, podName, container)
+
+	counter := &countingWriter{w: out}
+	err = streamExec(ctx, client, targetNamespace, podName, container, command, counter)
+	out.Close()
+	if viewer != nil {
+		viewer.Wait()
+	}
+
+	fmt.Fprintf(os.Stderr, "Captured %d bytes\n", counter.n)
+
+	// Cancellation (Ctrl+C or --duration) is the normal way to end a capture
+	if err != nil && ctx.Err() == nil {
+		if strings.Contains(err.Error(), "executable file not found") {
+			return fmt.Errorf("tcpdump is not available in container %s, retry with --ephemeral", container)
+		}
+		return fmt.Errorf("capture failed: %w", err)
+	}
+	return nil
+}
+
+// captureFilter builds the tcpdump filter expression from flags
+func captureFilter() []string {
+	var parts []string
+	for _, port := range sniffPorts {
+		parts = append(parts, fmt.Sprintf("port %d", port))
+	}
+	if len(parts) > 1 {
+		parts = []string{"(" + strings.Join(parts, " or ") + ")"}
+	}
+
+	var hosts []string
+	for _, host := range sniffHosts {
+		hosts = append(hosts, "host "+host)
+	}
+	if len(hosts) > 1 {
+		hosts = []string{"(" + strings.Join(hosts, " or ") + ")"}
+	}
+	parts = append(parts, hosts...)
+
+	if sniffFilter != "" {
+		parts = append(parts, "("+sniffFilter+")")
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return []string{strings.Join(parts, " and ")}
+}
+
+// addDebugContainer adds a privileged ephemeral container to the pod and
+// waits until it is running
+func addDebugContainer(ctx context.Context, client *k8s.Client, pod *corev1.Pod) (string, error) {
+	name := fmt.Sprintf("kube-sniff-%d", time.Now().Unix())
+	privileged := true
+
+	debug := corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:    name,
+			Image:   sniffImage,
+			Command: []string{"sleep", "infinity"},
+			SecurityContext: &corev1.SecurityContext{
+				Privileged: &privileged,
+			},
+		},
+	}
+	if sniffContainer != "" {
+		debug.TargetContainerName = sniffContainer
+	}
+
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, debug)
+	if _, err := client.Clientset.CoreV1().Pods(pod.Namespace).UpdateEphemeralContainers(ctx, pod.Name, pod, metav1.UpdateOptions{}); err != nil {
+		return "", fmt.Errorf("failed to add ephemeral container: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Added ephemeral container %s (%s), waiting for it to start...\n", name, sniffImage)
+	for i := 0; i < 120; i++ {
+		current, err := client.Clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to get pod %s: %w", pod.Name, err)
+		}
+		for _, status := range current.Status.EphemeralContainerStatuses {
+			if status.Name != name {
+				continue
+			}
+			if status.State.Running != nil {
+				return name, nil
+			}
+			if status.State.Terminated != nil {
+				return "", fmt.Errorf("ephemeral container %s terminated: %s", name, status.State.Terminated.Reason)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
+	}
+	return "", clierr.Timeoutf("timeout waiting for ephemeral container %s", name)
+}
+
+// streamExec runs command in the container and copies stdout to out
+func streamExec(ctx context.Context, client *k8s.Client, namespace, podName, container string, command []string, out io.Writer) error {
+	req := client.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("exec")
+
+	req.VersionedParams(&corev1.PodExecOptions{
+		Container: container,
+		Command:   command,
+		Stdout:    true,
+		Stderr:    true,
+	}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(client.Config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create executor: %w", err)
+	}
+
+	return executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdout: out,
+		Stderr: os.Stderr,
+	})
+}
+
+// countingWriter counts bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// init initializes flags for kube-sniff command
+func init() {
+	sniffRootCmd.Flags().StringVarP(&sniffNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	sniffRootCmd.Flags().StringVarP(&sniffKubeContext, "context", "c", "", "Kubernetes context to use")
+	sniffRootCmd.Flags().StringVar(&sniffContainer, "container", "", "Container to capture in (or to target with --ephemeral)")
+	sniffRootCmd.Flags().StringVarP(&sniffInterface, "interface", "i", "any", "Network interface to capture on")
+	sniffRootCmd.Flags().IntSliceVar(&sniffPorts, "port", nil, "Only capture traffic on these ports")
+	sniffRootCmd.Flags().StringSliceVar(&sniffHosts, "host", nil, "Only capture traffic to/from these hosts")
+	sniffRootCmd.Flags().StringVar(&sniffFilter, "filter", "", "Additional raw tcpdump filter expression")
+	sniffRootCmd.Flags().StringVarP(&sniffOutput, "write", "w", "", "Write pcap to this file (default <pod>-<time>.pcap)")
+	sniffRootCmd.Flags().BoolVar(&sniffWireshark, "wireshark", false, "Pipe the capture into a locally launched Wireshark")
+	sniffRootCmd.Flags().BoolVar(&sniffEphemeral, "ephemeral", false, "Capture from a privileged ephemeral debug container")
+	sniffRootCmd.Flags().StringVar(&sniffImage, "image", "nicolaka/netshoot", "Image for the ephemeral debug container")
+	sniffRootCmd.Flags().DurationVar(&sniffDuration, "duration", 0, "Stop capturing after this duration (e.g. 30s)")
+
+	viper.BindPFlag("namespace", sniffRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", sniffRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-sniff
+func main() {
+	k8s.AddVerbosityFlag(sniffRootCmd)
+	k8s.AddRateLimitFlags(sniffRootCmd)
+	config.SetupDefaults(sniffRootCmd)
+	clierr.SetupUsage(sniffRootCmd)
+	cmd, err := sniffRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/changes"
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/podstatus"
+	"kube/pkg/kubernetes/rolloutstatus"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var (
+	stsNamespace     string
+	stsKubeContext   string
+	stsAllNamespaces bool
+	stsTimeout       time.Duration
+)
+
+// stsRootCmd represents the kube-sts command
+var stsRootCmd = &cobra.Command{
+	Use:   "kube-sts [statefulset]",
+	Short: "List StatefulSets or show pods and PVCs per ordinal",
+	Long: `kube-sts works with StatefulSets:
+
+- List StatefulSets with ready/current/updated replicas and update strategy
+- Show one StatefulSet per ordinal: pod status, revision and PVC status
+- Scale with ordinal-aware progress (scale)
+- Roll out with partition support (rollout)
+
+Examples:
+  kube-sts                                # List StatefulSets
+  kube-sts db                             # Pods and PVCs per ordinal
+  kube-sts scale db 5                     # Scale and follow ordinal creation
+  kube-sts rollout db --partition 2       # Only update ordinals >= 2
+  kube-sts rollout db --restart           # Restart pods in reverse ordinal order`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSts,
+}
+
+// scaleStsCmd represents the kube-sts scale subcommand
+var scaleStsCmd = &cobra.Command{
+	Use:   "scale <statefulset> <replicas>",
+	Short: "Scale a StatefulSet and follow ordinal creation or removal",
+	Long: `scale changes the replica count and follows the controller: with the
+OrderedReady policy pods are created in increasing ordinal order (each must be
+Ready before the next) and removed in decreasing order.
+
+Scaling down keeps the PVCs of removed ordinals unless the StatefulSet's
+persistentVolumeClaimRetentionPolicy deletes them.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runScaleSts,
+}
+
+// rolloutStsCmd represents the kube-sts rollout subcommand
+var rolloutStsCmd = &cobra.Command{
+	Use:   "rollout <statefulset>",
+	Short: "Restart or stage a StatefulSet rollout and wait for it",
+	Long: `rollout waits for a StatefulSet rolling update. Pods are updated from the
+highest ordinal down; only ordinals >= partition receive the new revision.
+
+--partition N sets the partition before waiting (use it to canary the top ordinals,
+then lower it step by step). --restart triggers a new rollout by touching the
+restartedAt annotation.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRolloutSts,
+}
+
+// runSts lists StatefulSets or shows details of one StatefulSet
+func runSts(cmd *cobra.Command, args []string) error {
+	client, ns, err := stsClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	if len(args) == 0 {
+		return listStatefulSets(ctx, client, ns)
+	}
+	return showStatefulSet(ctx, client, ns, args[0])
+}
+
+// stsClient creates the client and resolves the target namespace
+func stsClient() (*k8s.Client, string, error) {
+	client, err := k8s.NewClient("", stsKubeContext)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	ns := stsNamespace
+	if ns == "" {
+		if ns, err = k8s.GetCurrentNamespace(stsKubeContext); err != nil {
+			return nil, "", fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	return client, ns, nil
+}
+
+// listStatefulSets displays a table of StatefulSets
+func listStatefulSets(ctx context.Context, client *k8s.Client, ns string) error {
+	if stsAllNamespaces {
+		ns = ""
+	}
+
+	list, err := client.Clientset.AppsV1().StatefulSets(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+
+	headers := []string{"NAME", "READY", "CURRENT", "UPDATED", "STRATEGY", "POLICY", "AGE"}
+	if stsAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+
+	rows := make([][]string, 0, len(list.Items))
+	for _, sts := range list.Items {
+		desired := rolloutstatus.StatefulSetDesiredReplicas(&sts)
+		row := []string{
+			sts.Name,
+			fmt.Sprintf("%d/%d", sts.Status.ReadyReplicas, desired),
+			fmt.Sprintf("%d", sts.Status.CurrentReplicas),
+			fmt.Sprintf("%d", sts.Status.UpdatedReplicas),
+			describeStrategy(&sts),
+			string(sts.Spec.PodManagementPolicy),
+			utils.FormatAge(time.Since(sts.CreationTimestamp.Time)),
+		}
+		if stsAllNamespaces {
+			row = append([]string{sts.Namespace}, row...)
+		}
+		rows = append(rows, row)
+	}
+
+	table.Render(headers, rows)
+	return nil
+}
+
+// describeStrategy renders the update strategy including the partition
+func describeStrategy(sts *appsv1.StatefulSet) string {
+	if sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return "OnDelete"
+	}
+	if partition := rolloutstatus.StatefulSetPartition(sts); partition > 0 {
+		return fmt.Sprintf("RollingUpdate (partition=%d)", partition)
+	}
+	return "RollingUpdate"
+}
+
+// showStatefulSet prints pod and PVC status per ordinal
+func showStatefulSet(ctx context.Context, client *k8s.Client, ns, name string) error {
+	sts, err := client.Clientset.AppsV1().StatefulSets(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get statefulset %s: %w", name, err)
+	}
+
+	pods, err := client.Clientset.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(sts.Spec.Selector),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	podsByOrdinal := map[int]corev1.Pod{}
+	maxOrdinal := int(rolloutstatus.StatefulSetDesiredReplicas(sts)) - 1
+	for _, pod := range pods.Items {
+		if ordinal, ok := podOrdinal(sts.Name, pod.Name); ok {
+			podsByOrdinal[ordinal] = pod
+			if ordinal > maxOrdinal {
+				maxOrdinal = ordinal
+			}
+		}
+	}
+
+	pvcs, err := client.Clientset.CoreV1().PersistentVolumeClaims(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list persistentvolumeclaims: %w", err)
+	}
+	pvcsByName := map[string]corev1.PersistentVolumeClaim{}
+	for _, pvc := range pvcs.Items {
+		pvcsByName[pvc.Name] = pvc
+	}
+
+	// PVCs of removed ordinals are retained by default, include them as well
+	for _, tmpl := range sts.Spec.VolumeClaimTemplates {
+		prefix := tmpl.Name + "-" + sts.Name + "-"
+		for pvcName := range pvcsByName {
+			if ordinal, err := strconv.Atoi(strings.TrimPrefix(pvcName, prefix)); err == nil && strings.HasPrefix(pvcName, prefix) && ordinal > maxOrdinal {
+				maxOrdinal = ordinal
+			}
+		}
+	}
+
+	fmt.Printf("StatefulSet: %s/%s\n", ns, sts.Name)
+	fmt.Printf("Strategy:    %s, pod management %s\n", describeStrategy(sts), sts.Spec.PodManagementPolicy)
+	fmt.Printf("Revision:    current %s, update %s\n", sts.Status.CurrentRevision, sts.Status.UpdateRevision)
+	if st, err := rolloutstatus.ComputeStatefulSet(sts); err == nil {
+		fmt.Printf("Status:      %s\n", st.Message)
+	}
+	fmt.Println()
+
+	desired := int(rolloutstatus.StatefulSetDesiredReplicas(sts))
+	headers := []string{"ORDINAL", "POD", "STATUS", "READY", "REVISION", "PVCS"}
+	rows := make([][]string, 0, maxOrdinal+1)
+	for ordinal := 0; ordinal <= maxOrdinal; ordinal++ {
+		podName := fmt.Sprintf("%s-%d", sts.Name, ordinal)
+		status, ready, revision := "<missing>", "-", "-"
+		if pod, ok := podsByOrdinal[ordinal]; ok {
+			status = podstatus.Reason(&pod)
+			ready = "false"
+			if podstatus.IsReady(&pod) {
+				ready = "true"
+			}
+			revision = pod.Labels[appsv1.StatefulSetRevisionLabel]
+			if revision != "" && revision == sts.Status.UpdateRevision {
+				revision += " (updated)"
+			}
+		} else if ordinal >= desired {
+			status = "<scaled down>"
+		}
+
+		var claims []string
+		for _, tmpl := range sts.Spec.VolumeClaimTemplates {
+			claimName := fmt.Sprintf("%s-%s-%d", tmpl.Name, sts.Name, ordinal)
+			pvc, ok := pvcsByName[claimName]
+			if !ok {
+				claims = append(claims, claimName+": <none>")
+				continue
+			}
+			capacity := ""
+			if q, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+				capacity = " " + q.String()
+			}
+			claims = append(claims, fmt.Sprintf("%s: %s%s", claimName, pvc.Status.Phase, capacity))
+		}
+
+		rows = append(rows, []string{
+			strconv.Itoa(ordinal),
+			podName,
+			status,
+			ready,
+			revision,
+			strings.Join(claims, ", "),
+		})
+	}
+
+	table.Render(headers, rows)
+	return nil
+}
+
+// podOrdinal extracts the ordinal from a StatefulSet pod name (<sts>-<ordinal>)
+func podOrdinal(stsName, podName string) (int, bool) {
+	suffix, ok := strings.CutPrefix(podName, stsName+"-")
+	if !ok {
+		return 0, false
+	}
+	ordinal, err := strconv.Atoi(suffix)
+	if err != nil || ordinal < 0 {
+		return 0, false
+	}
+	return ordinal, true
+}
+
+// runScaleSts scales the StatefulSet and follows ordinal progress
+func runScaleSts(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	replicas, err := strconv.Atoi(args[1])
+	if err != nil || replicas < 0 {
+		return fmt.Errorf("invalid replica count '%s'", args[1])
+	}
+
+	client, ns, err := stsClient()
+	if err != nil {
+		return err
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	sts, err := client.Clientset.AppsV1().StatefulSets(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get statefulset %s: %w", name, err)
+	}
+	current := int(rolloutstatus.StatefulSetDesiredReplicas(sts))
+
+	if replicas < current && len(sts.Spec.VolumeClaimTemplates) > 0 {
+		policy := sts.Spec.PersistentVolumeClaimRetentionPolicy
+		if policy == nil || policy.WhenScaled != appsv1.DeletePersistentVolumeClaimRetentionPolicyType {
+			fmt.Printf("Note: PVCs of ordinals %d..%d are retained and reused when scaling up again\n", replicas, current-1)
+		} else {
+			fmt.Printf("Warning: PVCs of ordinals %d..%d will be deleted (whenScaled: Delete)\n", replicas, current-1)
+		}
+	}
+
+	patch := []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas))
+	updated, err := client.Clientset.AppsV1().StatefulSets(ns).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to scale statefulset: %w", err)
+	}
+	fmt.Printf("Scaled statefulset %s from %d to %d replicas\n", name, current, replicas)
+	changes.Print(os.Stdout, "statefulset", ns, name, changes.StatefulSet(sts, updated))
+
+	if replicas == current {
+		return nil
+	}
+
+	// Follow ordinal creation/removal until the pod set matches
+	deadline := time.Now().Add(stsTimeoutOrDefault())
+	last := ""
+	for time.Now().Before(deadline) {
+		pods, err := client.Clientset.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
+			LabelSelector: metav1.FormatLabelSelector(sts.Spec.Selector),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list pods: %w", err)
+		}
+
+		var states []string
+		ready, total := 0, 0
+		for ordinal := 0; ordinal < max(replicas, current); ordinal++ {
+			state := "-"
+			for _, pod := range pods.Items {
+				if pod.Name != fmt.Sprintf("%s-%d", name, ordinal) {
+					continue
+				}
+				total++
+				state = podstatus.Reason(&pod)
+				if pod.DeletionTimestamp == nil && podstatus.IsReady(&pod) {
+					state = "Ready"
+					if ordinal < replicas {
+						ready++
+					}
+				}
+			}
+			states = append(states, fmt.Sprintf("%d:%s", ordinal, state))
+		}
+
+		line := strings.Join(states, " ")
+		if line != last {
+			fmt.Println(line)
+			last = line
+		}
+		if ready == replicas && total == replicas {
+			fmt.Println("Scale complete")
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for statefulset %s to scale to %d: %w", name, replicas, context.Cause(ctx))
+		case <-time.After(1 * time.Second):
+		}
+	}
+	return clierr.Timeoutf("timeout waiting for statefulset %s to scale to %d", name, replicas)
+}
+
+// runRolloutSts optionally sets the partition / restarts, then waits for the rollout
+func runRolloutSts(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	restart, _ := cmd.Flags().GetBool("restart")
+
+	client, ns, err := stsClient()
+	if err != nil {
+		return err
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	spec := map[string]interface{}{}
+	if cmd.Flags().Changed("partition") {
+		partition, _ := cmd.Flags().GetInt32("partition")
+		if partition < 0 {
+			return clierr.Usagef("--partition must be >= 0")
+		}
+		spec["updateStrategy"] = map[string]interface{}{
+			"type":          "RollingUpdate",
+			"rollingUpdate": map[string]interface{}{"partition": partition},
+		}
+	}
+	if restart {
+		spec["template"] = map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{"kubectl.kubernetes.io/restartedAt": time.Now().Format(time.RFC3339)},
+			},
+		}
+	}
+	if len(spec) > 0 {
+		patch, err := json.Marshal(map[string]interface{}{"spec": spec})
+		if err != nil {
+			return fmt.Errorf("failed to build patch: %w", err)
+		}
+		before, err := client.Clientset.AppsV1().StatefulSets(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get statefulset %s: %w", name, err)
+		}
+		updated, err := client.Clientset.AppsV1().StatefulSets(ns).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to update statefulset: %w", err)
+		}
+		changes.Print(os.Stdout, "statefulset", ns, name, changes.StatefulSet(before, updated))
+		fmt.Printf("Updated statefulset %s. Waiting for rollout...\n", name)
+	}
+
+	last := ""
+	return rolloutstatus.WaitStatefulSet(ctx, client.Clientset, ns, name, stsTimeout, func(sts *appsv1.StatefulSet, st rolloutstatus.Status) {
+		msg := st.Message
+		if !st.Done {
+			if next := nextOrdinalToUpdate(ctx, client, sts); next != "" {
+				msg += " next: " + next
+			}
+		}
+		if msg != last {
+			fmt.Println(msg)
+			last = msg
+		}
+	})
+}
+
+// nextOrdinalToUpdate returns the highest ordinal >= partition not yet at the
+// update revision, which is the pod the controller replaces next
+func nextOrdinalToUpdate(ctx context.Context, client *k8s.Client, sts *appsv1.StatefulSet) string {
+	if sts.Status.UpdateRevision == "" {
+		return ""
+	}
+	partition := int(rolloutstatus.StatefulSetPartition(sts))
+	for ordinal := int(rolloutstatus.StatefulSetDesiredReplicas(sts)) - 1; ordinal >= partition; ordinal-- {
+		podName := fmt.Sprintf("%s-%d", sts.Name, ordinal)
+		pod, err := client.Clientset.CoreV1().Pods(sts.Namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil || pod.Labels[appsv1.StatefulSetRevisionLabel] != sts.Status.UpdateRevision || !podstatus.IsReady(pod) {
+			return podName
+		}
+	}
+	return ""
+}
+
+// stsTimeoutOrDefault returns --timeout or 10 minutes
+func stsTimeoutOrDefault() time.Duration {
+	if stsTimeout > 0 {
+		return stsTimeout
+	}
+	return 10 * time.Minute
+}
+
+// init initializes flags and subcommands for kube-sts command
+func init() {
+	stsRootCmd.PersistentFlags().StringVarP(&stsNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	stsRootCmd.PersistentFlags().StringVarP(&stsKubeContext, "context", "c", "", "Kubernetes context to use")
+	stsRootCmd.Flags().BoolVarP(&stsAllNamespaces, "all-namespaces", "A", false, "Show statefulsets from all namespaces")
+
+	scaleStsCmd.Flags().DurationVar(&stsTimeout, "timeout", 0, "Maximum time to wait (default 10m)")
+	rolloutStsCmd.Flags().DurationVar(&stsTimeout, "timeout", 0, "Maximum time to wait (default 10m)")
+	rolloutStsCmd.Flags().Int32("partition", 0, "Set the rolling update partition before waiting")
+	rolloutStsCmd.Flags().Bool("restart", false, "Restart pods by touching the restartedAt annotation")
+
+	stsRootCmd.AddCommand(scaleStsCmd, rolloutStsCmd)
+
+	viper.BindPFlag("namespace", stsRootCmd.PersistentFlags().Lookup("namespace"))
+	viper.BindPFlag("context", stsRootCmd.PersistentFlags().Lookup("context"))
+}
+
+// main is the entry point of kube-sts
+func main() {
+	k8s.AddVerbosityFlag(stsRootCmd)
+	k8s.AddRateLimitFlags(stsRootCmd)
+	k8s.AddFromDirFlag(stsRootCmd)
+	config.SetupDefaults(stsRootCmd)
+	clierr.SetupUsage(stsRootCmd)
+	cmd, err := stsRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
@@ -1,19 +1,52 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
-	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"path/filepath"
 
+	"kube/pkg/kubernetes/contextgroups"
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/state"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
 	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/client-go/util/homedir"
 )
 
+// switchContextTable holds the --quiet and --no-headers options of the context list
+var switchContextTable table.Options
+
+// maxDetailLength keeps failed contexts on one line in the status table
+const maxDetailLength = 70
+
+// contextHealth is the result of checking one context
+type contextHealth struct {
+	name      string
+	cluster   string
+	namespace string
+	api       string
+	auth      string
+	version   string
+	latency   time.Duration
+	detail    string
+}
+
 // switchContextRootCmd represents the kube-switch-context command
 var switchContextRootCmd = &cobra.Command{
 	Use:   "kube-switch-context [context-name]",
@@ -21,15 +54,96 @@ var switchContextRootCmd = &cobra.Command{
 	Long: `kube-switch-context allows quick switching between Kubernetes contexts.
 	
 If no context name is provided, displays list of available contexts.
+
+Large kubeconfigs can be split into named groups in ~/.kube.yaml:
+
+  contextGroups:
+    payments: [prod-eu, prod-us, staging]
+    dev: ["dev-*"]                         # shell patterns work too
+
+After 'use-group payments' the context list, completions, status and
+--all-contexts of other tools only cover that group. KUBE_CONTEXT_GROUP
+selects a group for the current shell only.
+
+'kube prompt' shows the current context in your shell prompt.
 	
 Examples:
   kube-switch-context                    # Display list of contexts
-  kube-switch-context production         # Switch to production context`,
-	RunE: runSwitchContext,
+  kube-switch-context production         # Switch to production context
+  kube-switch-context -                  # Switch back to the previous context
+  kube-switch-context export staging     # Export standalone kubeconfig for staging
+  kube-switch-context status             # Health of every context
+  kube-switch-context use-group payments # Only show the payments contexts`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeContexts,
+	RunE:              runSwitchContext,
+}
+
+// useGroupCmd represents the kube-switch-context use-group subcommand
+var useGroupCmd = &cobra.Command{
+	Use:   "use-group [group]",
+	Short: "Restrict contexts to a group from ~/.kube.yaml",
+	Long: `use-group selects the context group that the context list, completions,
+status and --all-contexts of other tools are restricted to. Without a group
+name the defined groups are listed.
+
+Examples:
+  kube-switch-context use-group              # List groups
+  kube-switch-context use-group payments     # Use the payments group
+  kube-switch-context use-group --clear      # Back to all contexts`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeGroups,
+	RunE:              runUseGroup,
+}
+
+// statusContextCmd represents the kube-switch-context status subcommand
+var statusContextCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Check API reachability and credentials of every context",
+	Long: `status checks all contexts of the kubeconfig (or of the active group) concurrently and shows a dashboard:
+
+- API:       ok, unreachable or timeout (GET /version)
+- AUTH:      ok, or invalid when the API server rejects the credentials (401),
+             e.g. expired tokens, rotated certificates or a failing exec plugin
+- VERSION:   the server version
+- NAMESPACE: the namespace of the context
+
+Handy after credential rotation or VPN changes. Exits with an error when a
+context is unhealthy, so it can gate scripts.
+
+Examples:
+  kube-switch-context status                 # All contexts
+  kube-switch-context status --timeout 2s    # Give up on slow clusters sooner`,
+	Args: cobra.NoArgs,
+	RunE: runStatusContexts,
+}
+
+// exportContextCmd represents the kube-switch-context export subcommand
+var exportContextCmd = &cobra.Command{
+	Use:   "export <context-name>",
+	Short: "Export a standalone kubeconfig for a context",
+	Long: `export writes a kubeconfig that only depends on itself, suitable for sharing
+with CI or teammates.
+
+By default the output is minified (only the given context, its cluster and user)
+and flattened (certificate and key files are embedded as *-data fields).
+Credentials contained in the output are listed as warnings on stderr.
+
+Examples:
+  kube-switch-context export staging                  # Print to stdout
+  kube-switch-context export staging -o ci.yaml       # Write to a file (0600)
+  kube-switch-context export staging --flatten=false  # Keep file references`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeContexts,
+	RunE:              runExportContext,
 }
 
 // runSwitchContext executes the context switching logic
 func runSwitchContext(cmd *cobra.Command, args []string) error {
+	if err := switchContextTable.Validate(); err != nil {
+		return err
+	}
+
 	kubeconfig := switchContextGetKubeconfigPath()
 
 	// Load kubeconfig
@@ -45,12 +159,28 @@ func runSwitchContext(cmd *cobra.Command, args []string) error {
 
 	contextName := args[0]
 
+	// - switches back to the previous context, like cd -
+	if contextName == state.Last {
+		last, err := state.Load()
+		if err != nil {
+			return err
+		}
+		if last.PreviousContext == "" {
+			return clierr.Newf(clierr.NotFound, "no previous context to switch back to")
+		}
+		contextName = last.PreviousContext
+	}
+
 	// Check if context exists
 	if _, exists := config.Contexts[contextName]; !exists {
 		return fmt.Errorf("context '%s' not found", contextName)
 	}
+	if names, group, err := contextgroups.Filter([]string{contextName}); err == nil && group != "" && len(names) == 0 {
+		fmt.Fprintf(os.Stderr, "Warning: context '%s' is not in the active group '%s'\n", contextName, group)
+	}
 
 	// Update current context
+	previous := config.CurrentContext
 	config.CurrentContext = contextName
 
 	// Save configuration
@@ -58,17 +188,234 @@ func runSwitchContext(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to save kubeconfig: %w", err)
 	}
+	if previous != "" && previous != contextName {
+		state.Update(func(s *state.State) { s.PreviousContext = previous })
+	}
 
 	fmt.Printf("Switched to context '%s'\n", contextName)
 	return nil
 }
 
+// runExportContext writes a standalone kubeconfig for the given context
+func runExportContext(cmd *cobra.Command, args []string) error {
+	contextName := args[0]
+	minify, _ := cmd.Flags().GetBool("minify")
+	flatten, _ := cmd.Flags().GetBool("flatten")
+	output, _ := cmd.Flags().GetString("output")
+
+	config, err := clientcmd.LoadFromFile(switchContextGetKubeconfigPath())
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	if _, exists := config.Contexts[contextName]; !exists {
+		return fmt.Errorf("context '%s' not found", contextName)
+	}
+	config.CurrentContext = contextName
+
+	if minify {
+		if err := api.MinifyConfig(config); err != nil {
+			return fmt.Errorf("failed to minify kubeconfig: %w", err)
+		}
+	}
+
+	if flatten {
+		if err := api.FlattenConfig(config); err != nil {
+			return fmt.Errorf("failed to flatten kubeconfig: %w", err)
+		}
+	}
+
+	data, err := clientcmd.Write(*config)
+	if err != nil {
+		return fmt.Errorf("failed to serialize kubeconfig: %w", err)
+	}
+
+	for _, warning := range credentialWarnings(config) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if err := os.WriteFile(output, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", output, err)
+	}
+	fmt.Fprintf(os.Stderr, "Exported context '%s' to %s\n", contextName, output)
+	return nil
+}
+
+// runStatusContexts checks every context concurrently and prints the dashboard
+func runStatusContexts(cmd *cobra.Command, args []string) error {
+	if err := switchContextTable.Validate(); err != nil {
+		return err
+	}
+
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	if timeout <= 0 {
+		return clierr.Usagef("--timeout must be positive")
+	}
+
+	config, err := k8s.LoadRawConfig()
+	if err != nil {
+		return err
+	}
+	names, _, err := groupContexts(config)
+	if err != nil {
+		return err
+	}
+
+	// Unreachable clusters should not hold up the others
+	results := make([]contextHealth, len(names))
+	k8s.FanOut(len(names), func(i int) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		results[i] = checkContext(ctx, config.Contexts[names[i]], names[i])
+	})
+
+	const (
+		reset = "\033[0m"
+		red   = "\033[31m"
+		green = "\033[32m"
+	)
+	color := func(s string) string {
+		switch s {
+		case "ok":
+			return green + s + reset
+		case "-":
+			return s
+		}
+		return red + s + reset
+	}
+
+	headers := []string{"CURRENT", "NAME", "CLUSTER", "NAMESPACE", "API", "AUTH", "VERSION", "LATENCY", "DETAILS"}
+	rows := make([][]string, 0, len(results))
+	unhealthy := 0
+	for _, r := range results {
+		current := ""
+		if r.name == config.CurrentContext {
+			current = "*"
+		}
+		if r.api != "ok" || r.auth != "ok" {
+			unhealthy++
+		}
+		latency := "-"
+		if r.latency > 0 {
+			latency = r.latency.Round(time.Millisecond).String()
+		}
+		rows = append(rows, []string{
+			current, r.name, r.cluster, r.namespace,
+			color(r.api), color(r.auth), r.version, latency,
+			utils.TruncateString(r.detail, maxDetailLength),
+		})
+	}
+	switchContextTable.Print(headers, rows, 1)
+
+	if unhealthy > 0 {
+		return clierr.Newf(clierr.Generic, "%d of %d contexts are unhealthy", unhealthy, len(results))
+	}
+	return nil
+}
+
+// checkContext asks the API server for its version, then checks that the
+// credentials are accepted on an endpoint that requires authentication
+func checkContext(ctx context.Context, kubeContext *api.Context, name string) contextHealth {
+	r := contextHealth{name: name, cluster: kubeContext.Cluster, namespace: kubeContext.Namespace, api: "-", auth: "-", version: "-"}
+	if r.namespace == "" {
+		r.namespace = "default"
+	}
+
+	client, err := k8s.SharedClient(name)
+	if err != nil {
+		r.api, r.detail = "error", utils.FirstLine(err.Error())
+		return r
+	}
+	rest := client.Clientset.Discovery().RESTClient()
+
+	// /version is readable anonymously on most clusters, so it tells
+	// reachability apart from authentication
+	start := time.Now()
+	raw, err := rest.Get().AbsPath("/version").Do(ctx).Raw()
+	r.latency = time.Since(start)
+	switch {
+	case err == nil:
+		r.api = "ok"
+		var info version.Info
+		if json.Unmarshal(raw, &info) == nil && info.GitVersion != "" {
+			r.version = info.GitVersion
+		}
+	case apierrors.IsUnauthorized(err):
+		r.api, r.auth, r.detail = "ok", "invalid", "credentials rejected (expired or revoked?)"
+		return r
+	case clierr.IsServerResponse(err):
+		// Anonymous access is disabled or /version is not served, but the server answered
+		r.api = "ok"
+	case ctx.Err() != nil:
+		r.api, r.detail, r.latency = "timeout", "no answer within the timeout", 0
+		return r
+	default:
+		r.api, r.detail, r.latency = "unreachable", utils.FirstLine(err.Error()), 0
+		return r
+	}
+
+	// Authentication runs before authorization and routing, so any answer
+	// other than 401 means the credentials were accepted
+	err = rest.Get().AbsPath("/api").Do(ctx).Error()
+	switch {
+	case apierrors.IsUnauthorized(err):
+		r.auth, r.detail = "invalid", "credentials rejected (expired or revoked?)"
+	case err == nil, clierr.IsServerResponse(err):
+		r.auth = "ok"
+	default:
+		r.auth, r.detail = "error", utils.FirstLine(err.Error())
+	}
+	return r
+}
+
+// credentialWarnings lists secrets and machine-specific auth contained in config
+// so the user can decide whether the file is safe to share
+func credentialWarnings(config *api.Config) []string {
+	var warnings []string
+	for name, user := range config.AuthInfos {
+		if len(user.ClientKeyData) > 0 || user.ClientKey != "" {
+			warnings = append(warnings, fmt.Sprintf("user '%s' contains a client private key", name))
+		}
+		if user.Token != "" || user.TokenFile != "" {
+			warnings = append(warnings, fmt.Sprintf("user '%s' contains a bearer token", name))
+		}
+		if user.Password != "" {
+			warnings = append(warnings, fmt.Sprintf("user '%s' contains a basic-auth password", name))
+		}
+		if user.Exec != nil {
+			warnings = append(warnings, fmt.Sprintf("user '%s' uses exec plugin '%s' which must be installed where the kubeconfig is used", name, user.Exec.Command))
+		}
+		if user.AuthProvider != nil {
+			warnings = append(warnings, fmt.Sprintf("user '%s' uses auth provider '%s' and may embed refresh tokens", name, user.AuthProvider.Name))
+		}
+	}
+	sort.Strings(warnings)
+	if len(warnings) > 0 {
+		warnings = append(warnings, "treat the exported kubeconfig as a secret")
+	}
+	return warnings
+}
+
 // listContexts displays list of all contexts
 func listContexts(config *api.Config) error {
 	headers := []string{"CURRENT", "NAME", "CLUSTER", "USER", "NAMESPACE"}
-	var rows [][]string
+	rows := make([][]string, 0, len(config.Contexts))
 
-	for name, context := range config.Contexts {
+	names, group, err := groupContexts(config)
+	if err != nil {
+		return err
+	}
+	if group != "" {
+		fmt.Fprintf(os.Stderr, "Context group '%s': %d of %d contexts (use-group --clear shows all)\n", group, len(names), len(config.Contexts))
+	}
+
+	for _, name := range names {
+		context := config.Contexts[name]
 		current := ""
 		if name == config.CurrentContext {
 			current = "*"
@@ -82,75 +429,129 @@ func listContexts(config *api.Config) error {
 		rows = append(rows, []string{current, name, context.Cluster, context.AuthInfo, namespace})
 	}
 
-	renderTable(headers, rows)
+	switchContextTable.Print(headers, rows, 1)
 	return nil
 }
 
-// renderTable prints an ASCII table with simple borders
-// headers: column headers, rows: row data
-func renderTable(headers []string, rows [][]string) {
-	widths := make([]int, len(headers))
-	for c, h := range headers {
-		w := displayWidth(h)
-		if w > widths[c] {
-			widths[c] = w
-		}
+// groupContexts returns the sorted context names of the active group, or of
+// the whole kubeconfig when no group is active
+func groupContexts(config *api.Config) ([]string, string, error) {
+	names := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		names = append(names, name)
 	}
-	for _, row := range rows {
-		for c, cell := range row {
-			w := displayWidth(cell)
-			if w > widths[c] {
-				widths[c] = w
-			}
+	return contextgroups.Filter(names)
+}
+
+// runUseGroup lists the groups or changes the active group
+func runUseGroup(cmd *cobra.Command, args []string) error {
+	if err := switchContextTable.Validate(); err != nil {
+		return err
+	}
+
+	clearGroup, _ := cmd.Flags().GetBool("clear")
+	if clearGroup && len(args) > 0 {
+		return clierr.Usagef("--clear does not take a group name")
+	}
+	if _, ok := os.LookupEnv(contextgroups.EnvGroup); ok && (clearGroup || len(args) > 0) {
+		fmt.Fprintf(os.Stderr, "Warning: %s is set and overrides the group in this shell\n", contextgroups.EnvGroup)
+	}
+	if clearGroup {
+		if err := contextgroups.SetActive(""); err != nil {
+			return err
 		}
+		fmt.Println("Using all contexts")
+		return nil
 	}
 
-	printSeparator(widths)
-	fmt.Println("| " + joinRow(headers, widths) + " |")
-	printSeparator(widths)
-	for _, row := range rows {
-		fmt.Println("| " + joinRow(row, widths) + " |")
+	groups, err := contextgroups.Load()
+	if err != nil {
+		return err
+	}
+	config, err := clientcmd.LoadFromFile(switchContextGetKubeconfigPath())
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	all := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		all = append(all, name)
 	}
-	printSeparator(widths)
-}
 
-// displayWidth returns display length (excluding ANSI codes)
-func displayWidth(s string) int {
-	return len(stripANSI(s))
-}
+	if len(args) == 0 {
+		if len(groups) == 0 {
+			fmt.Printf("No context groups defined in %s\n", contextgroups.ConfigPath())
+			return nil
+		}
+		active := contextgroups.Active()
+		names := make([]string, 0, len(groups))
+		for name := range groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		headers := []string{"ACTIVE", "GROUP", "CONTEXTS", "MEMBERS"}
+		rows := make([][]string, 0, len(names))
+		for _, name := range names {
+			marker := ""
+			if strings.EqualFold(name, active) {
+				marker = "*"
+			}
+			rows = append(rows, []string{
+				marker, name,
+				fmt.Sprintf("%d", len(contextgroups.Match(groups[name], all))),
+				utils.TruncateString(strings.Join(groups[name], ", "), maxDetailLength),
+			})
+		}
+		switchContextTable.Print(headers, rows, 1)
+		return nil
+	}
 
-// stripANSI removes ANSI color codes for accurate width calculation
-func stripANSI(s string) string {
-	ansi := regexp.MustCompile("\\x1b\\[[0-9;]*m")
-	return ansi.ReplaceAllString(s, "")
+	group := args[0]
+	members, ok := contextgroups.Members(groups, group)
+	if !ok {
+		return clierr.Newf(clierr.NotFound, "context group %q is not defined in %s", group, contextgroups.ConfigPath())
+	}
+	matched := contextgroups.Match(members, all)
+	if len(matched) == 0 {
+		return clierr.Newf(clierr.NotFound, "context group %q matches no context of the kubeconfig", group)
+	}
+	if err := contextgroups.SetActive(group); err != nil {
+		return err
+	}
+	fmt.Printf("Using context group '%s' (%d contexts)\n", group, len(matched))
+	if len(contextgroups.Match(members, []string{config.CurrentContext})) == 0 {
+		fmt.Fprintf(os.Stderr, "Warning: the current context '%s' is not in the group\n", config.CurrentContext)
+	}
+	return nil
 }
 
-// joinRow left-aligns each cell and joins with column separator
-func joinRow(cols []string, widths []int) string {
-	parts := make([]string, len(cols))
-	for i, col := range cols {
-		pad := widths[i] - displayWidth(col)
-		if pad < 0 {
-			pad = 0
-		}
-		parts[i] = col + strings.Repeat(" ", pad)
+// completeContexts completes context names of the active group
+func completeContexts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	config, err := clientcmd.LoadFromFile(switchContextGetKubeconfigPath())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names, _, err := groupContexts(config)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
 	}
-	return strings.Join(parts, " | ")
+	return names, cobra.ShellCompDirectiveNoFileComp
 }
 
-// printSeparator prints border line based on column widths
-func printSeparator(widths []int) {
-	b := strings.Builder{}
-	b.WriteString("+")
-	for i, w := range widths {
-		b.WriteString(strings.Repeat("-", w+2))
-		if i == len(widths)-1 {
-			b.WriteString("+")
-		} else {
-			b.WriteString("+")
-		}
+// completeGroups completes the group names
+func completeGroups(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	groups, err := contextgroups.Load()
+	if err != nil || len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
 	}
-	fmt.Println(b.String())
+	sort.Strings(names)
+	return names, cobra.ShellCompDirectiveNoFileComp
 }
 
 // switchContextGetKubeconfigPath returns path to kubeconfig file
@@ -168,10 +569,33 @@ func switchContextGetKubeconfigPath() string {
 	return ""
 }
 
+// init registers subcommands and flags for kube-switch-context
+func init() {
+	exportContextCmd.Flags().Bool("minify", true, "Only include the exported context, its cluster and user")
+	exportContextCmd.Flags().Bool("flatten", true, "Embed referenced certificate and key files")
+	exportContextCmd.Flags().StringP("output", "o", "", "Write to file instead of stdout")
+
+	switchContextTable.AddFlags(switchContextRootCmd)
+	switchContextTable.AddFlags(statusContextCmd)
+
+	statusContextCmd.Flags().Duration("timeout", 5*time.Second, "How long to wait for each API server")
+	k8s.AddRateLimitFlags(statusContextCmd)
+
+	switchContextTable.AddFlags(useGroupCmd)
+	useGroupCmd.Flags().Bool("clear", false, "Leave the group and use all contexts")
+
+	switchContextRootCmd.AddCommand(exportContextCmd, statusContextCmd, useGroupCmd)
+}
+
 // main is the entry point of kube-switch-context
 func main() {
-	if err := switchContextRootCmd.Execute(); err != nil {
+	config.SetupDefaults(switchContextRootCmd)
+	clierr.SetupUsage(switchContextRootCmd)
+	cmd, err := switchContextRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(clierr.ExitCode(err))
 	}
 }
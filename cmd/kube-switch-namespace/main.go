@@ -1,16 +1,31 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
-
 	"path/filepath"
+	"strconv"
+	"strings"
+
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/state"
+	"kube/pkg/shared/tracing"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 )
 
+// maxRecentNamespaces is the number of namespaces remembered per context
+const maxRecentNamespaces = 10
+
+var switchNamespaceRecent bool
+
 // switchNamespaceRootCmd represents the kube-switch-namespace command
 var switchNamespaceRootCmd = &cobra.Command{
 	Use:   "kube-switch-namespace [namespace-name]",
@@ -18,10 +33,19 @@ var switchNamespaceRootCmd = &cobra.Command{
 	Long: `kube-switch-namespace allows switching namespace in the current context.
 	
 If no namespace name is provided, displays current namespace.
+
+Recently used namespaces are remembered per context, so '-' switches back to
+the previous one and --recent lists them (and lets you pick one when run in a
+terminal).
+
+'kube prompt' shows the current context and namespace in your shell prompt.
 	
 Examples:
   kube-switch-namespace                  # Display current namespace
-  kube-switch-namespace my-app           # Switch to namespace my-app`,
+  kube-switch-namespace my-app           # Switch to namespace my-app
+  kube-switch-namespace -                # Switch back to the previous namespace
+  kube-switch-namespace --recent         # Show and pick a recent namespace`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: runSwitchNamespace,
 }
 
@@ -45,18 +69,37 @@ func runSwitchNamespace(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("current context '%s' not found", currentContext)
 	}
 
-	// If no argument, display current namespace
-	if len(args) == 0 {
-		currentNamespace := context.Namespace
-		if currentNamespace == "" {
-			currentNamespace = "default"
+	currentNamespace := context.Namespace
+	if currentNamespace == "" {
+		currentNamespace = "default"
+	}
+
+	recent := loadRecentNamespaces()
+
+	var namespaceName string
+	switch {
+	case switchNamespaceRecent:
+		if len(args) > 0 {
+			return clierr.Usagef("--recent does not take a namespace")
+		}
+		picked, err := pickRecentNamespace(recent[currentContext], currentNamespace)
+		if err != nil || picked == "" {
+			return err
 		}
+		namespaceName = picked
+	case len(args) == 0:
+		// If no argument, display current namespace
 		fmt.Printf("Current namespace: %s\n", currentNamespace)
 		return nil
+	case args[0] == "-":
+		namespaceName = previousNamespace(recent[currentContext], currentNamespace)
+		if namespaceName == "" {
+			return clierr.Newf(clierr.NotFound, "no previous namespace recorded for context '%s'", currentContext)
+		}
+	default:
+		namespaceName = args[0]
 	}
 
-	namespaceName := args[0]
-
 	// Update namespace in context
 	context.Namespace = namespaceName
 	config.Contexts[currentContext] = context
@@ -67,10 +110,106 @@ func runSwitchNamespace(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to save kubeconfig: %w", err)
 	}
 
+	// Remember where we came from, so '-' can toggle back
+	recent[currentContext] = pushRecent(recent[currentContext], currentNamespace)
+	recent[currentContext] = pushRecent(recent[currentContext], namespaceName)
+	if err := saveRecentNamespaces(recent); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
 	fmt.Printf("Switched to namespace '%s' in context '%s'\n", namespaceName, currentContext)
 	return nil
 }
 
+// recentNamespacesPath returns the state file of the recent namespaces
+func recentNamespacesPath() string {
+	return state.Path("namespaces.json")
+}
+
+// loadRecentNamespaces returns recently used namespaces per context, most recent first
+func loadRecentNamespaces() map[string][]string {
+	recent := map[string][]string{}
+	data, err := os.ReadFile(recentNamespacesPath())
+	if err != nil {
+		return recent
+	}
+	// A corrupted file only loses the history
+	json.Unmarshal(data, &recent)
+	return recent
+}
+
+// saveRecentNamespaces writes the namespace history
+func saveRecentNamespaces(recent map[string][]string) error {
+	path := recentNamespacesPath()
+	if path == "" {
+		return fmt.Errorf("cannot determine state location")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(recent, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save namespace history: %w", err)
+	}
+	return nil
+}
+
+// pushRecent moves namespace to the front of the list
+func pushRecent(list []string, namespace string) []string {
+	out := []string{namespace}
+	for _, ns := range list {
+		if ns != namespace && len(out) < maxRecentNamespaces {
+			out = append(out, ns)
+		}
+	}
+	return out
+}
+
+// previousNamespace returns the most recent namespace other than current
+func previousNamespace(list []string, current string) string {
+	for _, ns := range list {
+		if ns != current {
+			return ns
+		}
+	}
+	return ""
+}
+
+// pickRecentNamespace prints the recent namespaces and, in a terminal, lets
+// the user choose one by number. It returns "" when nothing was picked.
+func pickRecentNamespace(list []string, current string) (string, error) {
+	if len(list) == 0 {
+		fmt.Println("No recent namespaces recorded for this context")
+		return "", nil
+	}
+
+	for i, ns := range list {
+		marker := " "
+		if ns == current {
+			marker = "*"
+		}
+		fmt.Printf("%s %d. %s\n", marker, i+1, ns)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", nil
+	}
+
+	fmt.Printf("Select namespace [1-%d, Enter to keep %s]: ", len(list), current)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return "", nil
+	}
+	choice, err := strconv.Atoi(answer)
+	if err != nil || choice < 1 || choice > len(list) {
+		return "", clierr.Usagef("invalid selection %q", answer)
+	}
+	return list[choice-1], nil
+}
+
 // switchNamespaceGetKubeconfigPath returns path to kubeconfig file
 func switchNamespaceGetKubeconfigPath() string {
 	// Check KUBECONFIG environment variable
@@ -86,10 +225,20 @@ func switchNamespaceGetKubeconfigPath() string {
 	return ""
 }
 
+// init initializes flags for kube-switch-namespace command
+func init() {
+	switchNamespaceRootCmd.Flags().BoolVar(&switchNamespaceRecent, "recent", false, "Show recently used namespaces of the current context and pick one")
+}
+
 // main is the entry point of kube-switch-namespace
 func main() {
-	if err := switchNamespaceRootCmd.Execute(); err != nil {
+	config.SetupDefaults(switchNamespaceRootCmd)
+	clierr.SetupUsage(switchNamespaceRootCmd)
+	cmd, err := switchNamespaceRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(clierr.ExitCode(err))
 	}
 }
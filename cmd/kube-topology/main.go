@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"kube/pkg/kubernetes/capacity"
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	topologyNamespace     string
+	topologyKubeContext   string
+	topologyAllNamespaces bool
+	topologyConcentrated  bool
+	topologyZoneLabel     string
+	topologyTable         table.Options
+)
+
+// Spread verdicts of a workload
+const (
+	spreadOK            = "spread"
+	spreadSingleNode    = "single node"
+	spreadSingleZone    = "single zone"
+	spreadPartial       = "not all zones"
+	spreadSingleReplica = "single replica"
+)
+
+// topologyRootCmd represents the kube-topology command
+var topologyRootCmd = &cobra.Command{
+	Use:   "kube-topology",
+	Short: "Show how workloads are spread across zones and node pools",
+	Long: `kube-topology shows how the pods of every Deployment, StatefulSet and bare
+pod are distributed across the zones (topology.kubernetes.io/zone) and node
+pools of the cluster, and flags the workloads one zone or node outage would
+take down completely:
+
+- single node:    every pod runs on the same node
+- single zone:    every pod runs in the same zone of a multi-zone cluster
+- not all zones:  fewer zones used than the workload could cover, e.g. four
+                  pods in two of three zones
+- single replica: one pod, nothing to spread
+
+Only scheduled pods that are not finished count. DaemonSets run on every node
+by design and Jobs are short-lived, both are left out. Node pools are read
+from the labels of Karpenter, EKS, GKE, AKS, DigitalOcean and kops.
+
+Use 'kube-topology nodes' to see the zones, regions and node pools with their
+node and pod counts.
+
+Examples:
+  kube-topology                       # Workloads of the current namespace
+  kube-topology -A --concentrated     # Resilience review: what is not spread
+  kube-topology nodes                 # Nodes per zone and pool
+  kube-topology --zone-label failure-domain.beta.kubernetes.io/zone`,
+	Args: cobra.NoArgs,
+	RunE: runTopology,
+}
+
+// topologyNodesCmd represents the kube-topology nodes command
+var topologyNodesCmd = &cobra.Command{
+	Use:   "nodes",
+	Short: "Show nodes and pods per region, zone and node pool",
+	Long: `nodes counts the nodes per region, zone and node pool, how many of them
+are ready and spot capacity, and the pods running on them.
+
+Examples:
+  kube-topology nodes
+  kube-topology nodes -o csv`,
+	Args: cobra.NoArgs,
+	RunE: runTopologyNodes,
+}
+
+// nodeInfo is where a node is
+type nodeInfo struct {
+	region   string
+	zone     string
+	pool     string
+	capacity string
+	ready    bool
+}
+
+// workloadSpread is where the pods of one workload run
+type workloadSpread struct {
+	namespace string
+	kind      string
+	name      string
+	pods      int
+	zones     map[string]int
+	pools     map[string]int
+	nodes     map[string]bool
+}
+
+// runTopology prints the spread of every workload
+func runTopology(cmd *cobra.Command, args []string) error {
+	if err := topologyTable.Validate(); err != nil {
+		return err
+	}
+	client, namespace, err := topologyClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	nodes, err := loadNodes(ctx, client)
+	if err != nil {
+		return err
+	}
+	zones := map[string]bool{}
+	for _, n := range nodes {
+		if n.zone != "" {
+			zones[n.zone] = true
+		}
+	}
+
+	pods, err := client.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	owners, err := deploymentsByReplicaSet(ctx, client, namespace)
+	if err != nil {
+		return err
+	}
+
+	spreads := map[string]*workloadSpread{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		kind, name := podWorkload(pod, owners)
+		if kind == "" {
+			continue
+		}
+		key := pod.Namespace + "/" + kind + "/" + name
+		s, ok := spreads[key]
+		if !ok {
+			s = &workloadSpread{namespace: pod.Namespace, kind: kind, name: name, zones: map[string]int{}, pools: map[string]int{}, nodes: map[string]bool{}}
+			spreads[key] = s
+		}
+		node := nodes[pod.Spec.NodeName]
+		s.pods++
+		s.zones[utils.OrDash(node.zone)]++
+		s.pools[utils.OrDash(node.pool)]++
+		s.nodes[pod.Spec.NodeName] = true
+	}
+
+	list := make([]*workloadSpread, 0, len(spreads))
+	for _, s := range spreads {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].namespace != list[j].namespace {
+			return list[i].namespace < list[j].namespace
+		}
+		if list[i].kind != list[j].kind {
+			return list[i].kind < list[j].kind
+		}
+		return list[i].name < list[j].name
+	})
+
+	headers := []string{"WORKLOAD", "PODS", "NODES", "ZONES", "POOLS", "SPREAD"}
+	if topologyAllNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+	rows := make([][]string, 0, len(list))
+	concentrated := 0
+	for _, s := range list {
+		verdict := spreadVerdict(s, len(zones))
+		if verdict == spreadSingleNode || verdict == spreadSingleZone {
+			concentrated++
+		}
+		if topologyConcentrated && verdict == spreadOK {
+			continue
+		}
+		row := []string{
+			strings.ToLower(s.kind) + "/" + s.name,
+			fmt.Sprintf("%d", s.pods),
+			fmt.Sprintf("%d", len(s.nodes)),
+			formatCounts(s.zones),
+			formatCounts(s.pools),
+			colorVerdict(verdict),
+		}
+		if topologyAllNamespaces {
+			row = append([]string{s.namespace}, row...)
+		}
+		rows = append(rows, row)
+	}
+
+	if topologyTable.Bordered() {
+		fmt.Println(zoneSummary(nodes))
+		fmt.Println()
+	}
+	nameColumn := 0
+	if topologyAllNamespaces {
+		nameColumn = 1
+	}
+	topologyTable.Print(headers, rows, nameColumn)
+	if topologyTable.Bordered() && concentrated > 0 {
+		fmt.Printf("\n%d of %d workloads would be down completely after one node or zone outage\n", concentrated, len(list))
+	}
+	return nil
+}
+
+// runTopologyNodes prints the nodes and pods per region, zone and node pool
+func runTopologyNodes(cmd *cobra.Command, args []string) error {
+	if err := topologyTable.Validate(); err != nil {
+		return err
+	}
+	client, _, err := topologyClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	nodes, err := loadNodes(ctx, client)
+	if err != nil {
+		return err
+	}
+	pods, err := client.Clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	podsPerNode := map[string]int{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != "" && pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			podsPerNode[pod.Spec.NodeName]++
+		}
+	}
+
+	type group struct {
+		region, zone, pool       string
+		nodes, ready, spot, pods int
+	}
+	groups := map[string]*group{}
+	for name, n := range nodes {
+		key := n.region + "\x00" + n.zone + "\x00" + n.pool
+		g, ok := groups[key]
+		if !ok {
+			g = &group{region: utils.OrDash(n.region), zone: utils.OrDash(n.zone), pool: utils.OrDash(n.pool)}
+			groups[key] = g
+		}
+		g.nodes++
+		if n.ready {
+			g.ready++
+		}
+		if n.capacity == capacity.Spot {
+			g.spot++
+		}
+		g.pods += podsPerNode[name]
+	}
+	list := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.region != b.region {
+			return a.region < b.region
+		}
+		if a.zone != b.zone {
+			return a.zone < b.zone
+		}
+		return a.pool < b.pool
+	})
+
+	headers := []string{"REGION", "ZONE", "POOL", "NODES", "READY", "SPOT", "PODS"}
+	rows := make([][]string, 0, len(list))
+	for _, g := range list {
+		rows = append(rows, []string{
+			g.region, g.zone, g.pool,
+			fmt.Sprintf("%d", g.nodes),
+			fmt.Sprintf("%d", g.ready),
+			fmt.Sprintf("%d", g.spot),
+			fmt.Sprintf("%d", g.pods),
+		})
+	}
+	topologyTable.Print(headers, rows, 1)
+	return nil
+}
+
+// topologyClient returns the client and the namespace to look at, "" for all
+func topologyClient() (*k8s.Client, string, error) {
+	client, err := k8s.NewClient("", topologyKubeContext)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	if topologyAllNamespaces {
+		return client, "", nil
+	}
+	namespace := topologyNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(topologyKubeContext); err != nil {
+			return nil, "", fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	return client, namespace, nil
+}
+
+// loadNodes returns the location of every node by name
+func loadNodes(ctx context.Context, client *k8s.Client) (map[string]nodeInfo, error) {
+	list, err := client.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	nodes := make(map[string]nodeInfo, len(list.Items))
+	for _, node := range list.Items {
+		info := nodeInfo{
+			region:   node.Labels[corev1.LabelTopologyRegion],
+			zone:     node.Labels[topologyZoneLabel],
+			pool:     capacity.Pool(node.Labels),
+			capacity: capacity.Type(node.Labels),
+		}
+		for _, cond := range node.Status.Conditions {
+			if cond.Type == corev1.NodeReady {
+				info.ready = cond.Status == corev1.ConditionTrue
+			}
+		}
+		nodes[node.Name] = info
+	}
+	return nodes, nil
+}
+
+// deploymentsByReplicaSet maps ReplicaSets to the Deployment owning them,
+// by namespace/name
+func deploymentsByReplicaSet(ctx context.Context, client *k8s.Client, namespace string) (map[string]string, error) {
+	list, err := client.Clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replica sets: %w", err)
+	}
+	owners := make(map[string]string, len(list.Items))
+	for _, rs := range list.Items {
+		if ref := metav1.GetControllerOf(&rs); ref != nil && ref.Kind == "Deployment" {
+			owners[rs.Namespace+"/"+rs.Name] = ref.Name
+		}
+	}
+	return owners, nil
+}
+
+// podWorkload returns the kind and name of the workload a pod belongs to, or
+// "" for the pods of DaemonSets and Jobs
+func podWorkload(pod *corev1.Pod, deployments map[string]string) (string, string) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return "Pod", pod.Name
+	}
+	switch ref.Kind {
+	case "ReplicaSet":
+		if name, ok := deployments[pod.Namespace+"/"+ref.Name]; ok {
+			return "Deployment", name
+		}
+		return "ReplicaSet", ref.Name
+	case "DaemonSet", "Job":
+		return "", ""
+	}
+	return ref.Kind, ref.Name
+}
+
+// spreadVerdict tells whether one node or zone outage takes down every pod
+// of the workload
+func spreadVerdict(s *workloadSpread, clusterZones int) string {
+	switch {
+	case s.pods == 1:
+		return spreadSingleReplica
+	case len(s.nodes) == 1:
+		return spreadSingleNode
+	case s.zones["-"] > 0 || clusterZones < 2:
+		// Zones unknown or nothing to spread across
+		return spreadOK
+	case len(s.zones) == 1:
+		return spreadSingleZone
+	case len(s.zones) < min(s.pods, clusterZones):
+		return spreadPartial
+	}
+	return spreadOK
+}
+
+// colorVerdict shows outage risks in red and weaker spreads in yellow
+func colorVerdict(verdict string) string {
+	const (
+		colorReset  = "\033[0m"
+		colorRed    = "\033[31m"
+		colorGreen  = "\033[32m"
+		colorYellow = "\033[33m"
+	)
+	switch verdict {
+	case spreadSingleNode, spreadSingleZone:
+		return colorRed + verdict + colorReset
+	case spreadPartial, spreadSingleReplica:
+		return colorYellow + verdict + colorReset
+	}
+	return colorGreen + verdict + colorReset
+}
+
+// formatCounts prints pod counts by zone or pool, e.g. eu-1a:2 eu-1b:1
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s:%d", k, counts[k]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// zoneSummary describes the zones of the cluster in one line
+func zoneSummary(nodes map[string]nodeInfo) string {
+	perZone := map[string]int{}
+	for _, n := range nodes {
+		perZone[utils.OrDash(n.zone)]++
+	}
+	if len(perZone) == 0 {
+		return "No nodes found"
+	}
+	zones := make([]string, 0, len(perZone))
+	for zone := range perZone {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	parts := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		parts = append(parts, fmt.Sprintf("%s %d", zone, perZone[zone]))
+	}
+	return "Nodes per zone: " + strings.Join(parts, ", ")
+}
+
+// init initializes flags for kube-topology command
+func init() {
+	topologyRootCmd.PersistentFlags().StringVarP(&topologyNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	topologyRootCmd.PersistentFlags().StringVarP(&topologyKubeContext, "context", "c", "", "Kubernetes context to use")
+	topologyRootCmd.PersistentFlags().StringVar(&topologyZoneLabel, "zone-label", corev1.LabelTopologyZone, "Node label holding the zone")
+	topologyRootCmd.Flags().BoolVarP(&topologyAllNamespaces, "all-namespaces", "A", false, "Show workloads of all namespaces")
+	topologyRootCmd.Flags().BoolVar(&topologyConcentrated, "concentrated", false, "Only show workloads that are not spread across nodes and zones")
+	topologyTable.AddFlags(topologyRootCmd)
+	topologyTable.AddFlags(topologyNodesCmd)
+	topologyRootCmd.AddCommand(topologyNodesCmd)
+
+	viper.BindPFlag("namespace", topologyRootCmd.PersistentFlags().Lookup("namespace"))
+	viper.BindPFlag("context", topologyRootCmd.PersistentFlags().Lookup("context"))
+}
+
+// main is the entry point of kube-topology
+func main() {
+	k8s.AddVerbosityFlag(topologyRootCmd)
+	k8s.AddRateLimitFlags(topologyRootCmd)
+	k8s.AddFromDirFlag(topologyRootCmd)
+	config.SetupDefaults(topologyRootCmd)
+	clierr.SetupUsage(topologyRootCmd)
+	cmd, err := topologyRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
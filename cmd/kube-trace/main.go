@@ -0,0 +1,580 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/podstatus"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/tracing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var (
+	traceNamespace     string
+	traceKubeContext   string
+	traceAllNamespaces bool
+)
+
+// hopState is the verdict on one hop of the request path
+type hopState int
+
+const (
+	hopOK hopState = iota
+	hopWarning
+	hopBroken
+)
+
+// hop is one step of the request path
+type hop struct {
+	kind    string
+	name    string
+	state   hopState
+	details []string
+}
+
+// tracer walks the request path and collects the hops
+type tracer struct {
+	client    *k8s.Client
+	namespace string
+	hops      []hop
+}
+
+// traceRootCmd represents the kube-trace command
+var traceRootCmd = &cobra.Command{
+	Use:   "kube-trace <host[/path]|svc/<name>[:port]>",
+	Short: "Trace the request path from Ingress to container port",
+	Long: `kube-trace follows a request the way the cluster routes it:
+
+  Ingress -> Service -> EndpointSlice -> Pod -> Container port
+
+Each hop is printed with its health, and the first broken link is flagged:
+no Ingress rule for the host/path, a missing Service or port, a selector that
+matches no pods, no ready endpoints, not-ready pods or a target port that no
+container declares.
+
+Start from an Ingress host with an optional path (the longest matching rule
+wins, like in most controllers), or from a Service with svc/<name>[:port].
+
+Examples:
+  kube-trace shop.example.com              # Ingress rule for / of the host
+  kube-trace shop.example.com/api -A       # Find the Ingress in any namespace
+  kube-trace svc/api                       # Start at the Service
+  kube-trace svc/api:http                  # Only trace one Service port`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTrace,
+}
+
+// runTrace resolves the start of the path and walks it
+func runTrace(cmd *cobra.Command, args []string) error {
+	ref := args[0]
+	serviceRef, isService := strings.CutPrefix(ref, "svc/")
+	if !isService {
+		serviceRef, isService = strings.CutPrefix(ref, "service/")
+	}
+	if isService && serviceRef == "" {
+		return clierr.Usagef("invalid service target, expected svc/<name>[:port]")
+	}
+	if isService && traceAllNamespaces {
+		return clierr.Usagef("-A only applies to Ingress hosts")
+	}
+
+	client, err := k8s.NewClient("", traceKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	namespace := traceNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(traceKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+
+	t := &tracer{client: client, namespace: namespace}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	if isService {
+		name, port, _ := strings.Cut(serviceRef, ":")
+		var servicePort *networkingv1.ServiceBackendPort
+		if port != "" {
+			servicePort = parseBackendPort(port)
+		}
+		err = t.traceService(ctx, name, servicePort)
+	} else {
+		err = t.traceIngress(ctx, ref)
+	}
+	if err != nil {
+		return err
+	}
+
+	t.print()
+	for _, h := range t.hops {
+		if h.state == hopBroken {
+			return clierr.Newf(clierr.Generic, "request path is broken at %s %s", h.kind, h.name)
+		}
+	}
+	return nil
+}
+
+// traceIngress finds the Ingress rule for host/path and continues with its backend
+func (t *tracer) traceIngress(ctx context.Context, ref string) error {
+	host, path, _ := strings.Cut(ref, "/")
+	path = "/" + path
+
+	namespace := t.namespace
+	if traceAllNamespaces {
+		namespace = ""
+	}
+	ingresses, err := t.client.Clientset.NetworkingV1().Ingresses(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list ingresses: %w", err)
+	}
+
+	ing, backend, rulePath := matchIngress(ingresses.Items, host, path)
+	if ing == nil {
+		t.add(hop{kind: "Ingress", name: host + path, state: hopBroken,
+			details: []string{"no Ingress rule matches this host and path"}})
+		return nil
+	}
+	t.namespace = ing.Namespace
+
+	h := hop{kind: "Ingress", name: ing.Namespace + "/" + ing.Name}
+	h.details = append(h.details, fmt.Sprintf("rule %s%s", hostOrAny(host, ing), rulePath))
+	if ing.Spec.IngressClassName != nil {
+		h.details = append(h.details, "class "+*ing.Spec.IngressClassName)
+	}
+	var addresses []string
+	for _, lb := range ing.Status.LoadBalancer.Ingress {
+		if lb.IP != "" {
+			addresses = append(addresses, lb.IP)
+		} else if lb.Hostname != "" {
+			addresses = append(addresses, lb.Hostname)
+		}
+	}
+	if len(addresses) == 0 {
+		h.state = hopWarning
+		h.details = append(h.details, "no load balancer address yet")
+	} else {
+		h.details = append(h.details, "address "+strings.Join(addresses, ", "))
+	}
+	if backend.Service == nil {
+		h.state = hopBroken
+		h.details = append(h.details, "backend is not a Service")
+		t.add(h)
+		return nil
+	}
+	t.add(h)
+	return t.traceService(ctx, backend.Service.Name, &backend.Service.Port)
+}
+
+// matchIngress returns the Ingress and backend serving host and path. Exact
+// hosts win over wildcards, longer paths over shorter ones, and the default
+// backend is the fallback.
+func matchIngress(ingresses []networkingv1.Ingress, host, path string) (*networkingv1.Ingress, *networkingv1.IngressBackend, string) {
+	var best *networkingv1.Ingress
+	var bestBackend *networkingv1.IngressBackend
+	bestPath, bestScore := "", -1
+	for i := range ingresses {
+		ing := &ingresses[i]
+		for _, rule := range ing.Spec.Rules {
+			hostScore := hostMatch(rule.Host, host)
+			if hostScore == 0 || rule.HTTP == nil {
+				continue
+			}
+			for j := range rule.HTTP.Paths {
+				p := &rule.HTTP.Paths[j]
+				if !pathMatch(p, path) {
+					continue
+				}
+				score := hostScore*10000 + len(p.Path)
+				if score > bestScore {
+					best, bestBackend, bestPath, bestScore = ing, &p.Backend, p.Path, score
+				}
+			}
+		}
+	}
+	if best != nil {
+		return best, bestBackend, bestPath
+	}
+	for i := range ingresses {
+		if ingresses[i].Spec.DefaultBackend != nil {
+			return &ingresses[i], ingresses[i].Spec.DefaultBackend, " (default backend)"
+		}
+	}
+	return nil, nil, ""
+}
+
+// hostMatch scores a rule host: 3 exact, 2 wildcard, 1 any host, 0 no match
+func hostMatch(ruleHost, host string) int {
+	switch {
+	case ruleHost == host:
+		return 3
+	case strings.HasPrefix(ruleHost, "*."):
+		// A wildcard covers exactly one label
+		if _, rest, ok := strings.Cut(host, "."); ok && rest == ruleHost[2:] {
+			return 2
+		}
+		return 0
+	case ruleHost == "":
+		return 1
+	}
+	return 0
+}
+
+// pathMatch checks a request path against an Ingress path by its type.
+// ImplementationSpecific is treated as Prefix.
+func pathMatch(p *networkingv1.HTTPIngressPath, path string) bool {
+	rulePath := p.Path
+	if rulePath == "" {
+		rulePath = "/"
+	}
+	if p.PathType != nil && *p.PathType == networkingv1.PathTypeExact {
+		return path == rulePath
+	}
+	if rulePath == "/" {
+		return true
+	}
+	// Prefix matches whole path elements: /api matches /api/v1, not /apix
+	rulePath = strings.TrimSuffix(rulePath, "/")
+	return path == rulePath || strings.HasPrefix(path, rulePath+"/")
+}
+
+// hostOrAny prints the host of a matched rule
+func hostOrAny(host string, ing *networkingv1.Ingress) string {
+	for _, rule := range ing.Spec.Rules {
+		if rule.Host == host {
+			return host
+		}
+	}
+	return "*"
+}
+
+// traceService checks the Service, its endpoints and the pods behind them
+func (t *tracer) traceService(ctx context.Context, name string, port *networkingv1.ServiceBackendPort) error {
+	svc, err := t.client.Clientset.CoreV1().Services(t.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			t.add(hop{kind: "Service", name: t.namespace + "/" + name, state: hopBroken,
+				details: []string{"service does not exist"}})
+			return nil
+		}
+		return fmt.Errorf("failed to get service %s: %w", name, err)
+	}
+
+	h := hop{kind: "Service", name: svc.Namespace + "/" + svc.Name}
+	h.details = append(h.details, fmt.Sprintf("type %s, cluster IP %s", svc.Spec.Type, svc.Spec.ClusterIP))
+
+	ports := svc.Spec.Ports
+	if port != nil {
+		var matched []corev1.ServicePort
+		for _, sp := range svc.Spec.Ports {
+			if (port.Name != "" && sp.Name == port.Name) || (port.Name == "" && sp.Port == port.Number) {
+				matched = append(matched, sp)
+			}
+		}
+		if len(matched) == 0 {
+			h.state = hopBroken
+			h.details = append(h.details, fmt.Sprintf("port %s is not a port of the service (has %s)",
+				formatBackendPort(port), formatServicePorts(svc.Spec.Ports)))
+			t.add(h)
+			return nil
+		}
+		ports = matched
+	}
+	for _, sp := range ports {
+		h.details = append(h.details, fmt.Sprintf("port %s -> target %s", formatServicePort(sp), sp.TargetPort.String()))
+	}
+
+	if svc.Spec.Type == corev1.ServiceTypeExternalName {
+		h.details = append(h.details, "ExternalName to "+svc.Spec.ExternalName+", no endpoints in the cluster")
+		t.add(h)
+		return nil
+	}
+	if len(svc.Spec.Selector) == 0 {
+		h.state = hopWarning
+		h.details = append(h.details, "no selector, endpoints are managed manually")
+	}
+	t.add(h)
+
+	pods, err := t.selectedPods(ctx, svc)
+	if err != nil {
+		return err
+	}
+	slices, err := t.client.Clientset.DiscoveryV1().EndpointSlices(svc.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + svc.Name,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list endpointslices: %w", err)
+	}
+
+	t.traceEndpoints(svc, ports, slices.Items, pods)
+	t.tracePods(ports, slices.Items, pods)
+	return nil
+}
+
+// selectedPods returns the pods matching the service selector
+func (t *tracer) selectedPods(ctx context.Context, svc *corev1.Service) ([]corev1.Pod, error) {
+	if len(svc.Spec.Selector) == 0 {
+		return nil, nil
+	}
+	selector := labels.SelectorFromSet(svc.Spec.Selector).String()
+	pods, err := t.client.Clientset.CoreV1().Pods(svc.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	sort.Slice(pods.Items, func(i, j int) bool { return pods.Items[i].Name < pods.Items[j].Name })
+	return pods.Items, nil
+}
+
+// traceEndpoints checks that the EndpointSlices have ready endpoints for the ports
+func (t *tracer) traceEndpoints(svc *corev1.Service, ports []corev1.ServicePort, slices []discoveryv1.EndpointSlice, pods []corev1.Pod) {
+	h := hop{kind: "EndpointSlice", name: svc.Namespace + "/" + svc.Name}
+	ready, notReady := 0, 0
+	slicePorts := map[string]bool{}
+	for _, slice := range slices {
+		for _, p := range slice.Ports {
+			if p.Name != nil {
+				slicePorts[*p.Name] = true
+			}
+		}
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready == nil || *ep.Conditions.Ready {
+				ready++
+			} else {
+				notReady++
+			}
+		}
+	}
+	h.details = append(h.details, fmt.Sprintf("%d slices, %d ready, %d not ready endpoints", len(slices), ready, notReady))
+
+	switch {
+	case len(svc.Spec.Selector) > 0 && len(pods) == 0:
+		h.state = hopBroken
+		h.details = append(h.details, fmt.Sprintf("selector %s matches no pods",
+			labels.SelectorFromSet(svc.Spec.Selector).String()))
+	case ready == 0 && notReady > 0:
+		h.state = hopBroken
+		h.details = append(h.details, "no ready endpoints, traffic is dropped")
+	case ready == 0:
+		h.state = hopBroken
+		h.details = append(h.details, "no endpoints")
+	case notReady > 0:
+		h.state = hopWarning
+	}
+	for _, sp := range ports {
+		if len(slices) > 0 && !slicePorts[sp.Name] {
+			h.state = hopBroken
+			h.details = append(h.details, fmt.Sprintf("port %s is not published by the endpoints", formatServicePort(sp)))
+		}
+	}
+	t.add(h)
+}
+
+// tracePods checks readiness of the selected pods and that a container
+// exposes the target port
+func (t *tracer) tracePods(ports []corev1.ServicePort, slices []discoveryv1.EndpointSlice, pods []corev1.Pod) {
+	// Manually managed endpoints point at pods we cannot find by selector
+	if len(pods) == 0 {
+		for _, slice := range slices {
+			for _, ep := range slice.Endpoints {
+				if ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" {
+					t.add(hop{kind: "Pod", name: ep.TargetRef.Namespace + "/" + ep.TargetRef.Name, state: hopOK,
+						details: []string{"referenced by endpoints"}})
+				}
+			}
+		}
+		return
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		h := hop{kind: "Pod", name: pod.Namespace + "/" + pod.Name}
+		status := podstatus.Reason(pod)
+		counts := podstatus.ContainerCounts(pod)
+		h.details = append(h.details, fmt.Sprintf("%s, %d/%d ready, node %s", status, counts.Ready, counts.Total, valueOrNone(pod.Spec.NodeName)))
+		if !podstatus.IsReady(pod) {
+			h.state = hopBroken
+			h.details = append(h.details, "not ready, removed from the endpoints")
+		}
+		t.add(h)
+
+		for _, sp := range ports {
+			t.add(containerPortHop(pod, sp))
+		}
+	}
+}
+
+// containerPortHop checks that a container of the pod serves the target port.
+// Named target ports must be declared; numeric ones usually are but need not be.
+func containerPortHop(pod *corev1.Pod, sp corev1.ServicePort) hop {
+	h := hop{kind: "Port", name: fmt.Sprintf("%s %s", pod.Name, sp.TargetPort.String())}
+	target := sp.TargetPort
+	if target.Type == intstr.Int && target.IntVal == 0 {
+		target = intstr.FromInt32(sp.Port)
+	}
+
+	var declared []string
+	for _, c := range pod.Spec.Containers {
+		for _, cp := range c.Ports {
+			declared = append(declared, fmt.Sprintf("%s:%d", c.Name, cp.ContainerPort))
+			protocol := cp.Protocol
+			if protocol == "" {
+				protocol = corev1.ProtocolTCP
+			}
+			spProtocol := sp.Protocol
+			if spProtocol == "" {
+				spProtocol = corev1.ProtocolTCP
+			}
+			if protocol != spProtocol {
+				continue
+			}
+			if (target.Type == intstr.String && cp.Name == target.StrVal) ||
+				(target.Type == intstr.Int && cp.ContainerPort == target.IntVal) {
+				h.details = append(h.details, fmt.Sprintf("container %s port %d/%s", c.Name, cp.ContainerPort, protocol))
+				return h
+			}
+		}
+	}
+
+	if len(declared) == 0 {
+		declared = []string{"none"}
+	}
+	if target.Type == intstr.String {
+		h.state = hopBroken
+		h.details = append(h.details, fmt.Sprintf("no container declares port %q (declared: %s)", target.StrVal, strings.Join(declared, ", ")))
+		return h
+	}
+	h.state = hopWarning
+	h.details = append(h.details, fmt.Sprintf("no container declares port %d (declared: %s), check the app listens on it",
+		target.IntVal, strings.Join(declared, ", ")))
+	return h
+}
+
+// add appends a hop
+func (t *tracer) add(h hop) {
+	t.hops = append(t.hops, h)
+}
+
+// print shows the hops and flags the first broken one
+func (t *tracer) print() {
+	const (
+		reset  = "\033[0m"
+		red    = "\033[31m"
+		green  = "\033[32m"
+		yellow = "\033[33m"
+	)
+	firstBroken := -1
+	for i, h := range t.hops {
+		if h.state == hopBroken {
+			firstBroken = i
+			break
+		}
+	}
+
+	for i, h := range t.hops {
+		mark := green + "✓" + reset
+		switch h.state {
+		case hopWarning:
+			mark = yellow + "!" + reset
+		case hopBroken:
+			mark = red + "✗" + reset
+		}
+		fmt.Printf("%s %-13s %s\n", mark, h.kind, h.name)
+		for _, d := range h.details {
+			fmt.Printf("    %s\n", d)
+		}
+		if i == firstBroken {
+			fmt.Printf("    %s^ first broken link%s\n", red, reset)
+		}
+	}
+}
+
+// parseBackendPort parses a port number or name
+func parseBackendPort(port string) *networkingv1.ServiceBackendPort {
+	p := intstr.Parse(port)
+	if p.Type == intstr.Int {
+		return &networkingv1.ServiceBackendPort{Number: p.IntVal}
+	}
+	return &networkingv1.ServiceBackendPort{Name: p.StrVal}
+}
+
+// formatBackendPort prints a backend port by name or number
+func formatBackendPort(port *networkingv1.ServiceBackendPort) string {
+	if port.Name != "" {
+		return port.Name
+	}
+	return fmt.Sprintf("%d", port.Number)
+}
+
+// formatServicePort prints a service port as name:port or port
+func formatServicePort(sp corev1.ServicePort) string {
+	if sp.Name != "" {
+		return fmt.Sprintf("%s:%d", sp.Name, sp.Port)
+	}
+	return fmt.Sprintf("%d", sp.Port)
+}
+
+// formatServicePorts prints all ports of a service
+func formatServicePorts(ports []corev1.ServicePort) string {
+	if len(ports) == 0 {
+		return "none"
+	}
+	out := make([]string, 0, len(ports))
+	for _, sp := range ports {
+		out = append(out, formatServicePort(sp))
+	}
+	return strings.Join(out, ", ")
+}
+
+// valueOrNone returns <none> for empty values
+func valueOrNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+// init initializes flags for kube-trace command
+func init() {
+	traceRootCmd.Flags().StringVarP(&traceNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	traceRootCmd.Flags().StringVarP(&traceKubeContext, "context", "c", "", "Kubernetes context to use")
+	traceRootCmd.Flags().BoolVarP(&traceAllNamespaces, "all-namespaces", "A", false, "Look for the Ingress in all namespaces")
+
+	viper.BindPFlag("namespace", traceRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", traceRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-trace
+func main() {
+	k8s.AddVerbosityFlag(traceRootCmd)
+	k8s.AddRateLimitFlags(traceRootCmd)
+	k8s.AddFromDirFlag(traceRootCmd)
+	config.SetupDefaults(traceRootCmd)
+	clierr.SetupUsage(traceRootCmd)
+	cmd, err := traceRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
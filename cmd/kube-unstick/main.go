@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	unstickNamespace   string
+	unstickKubeContext string
+	unstickFinalizers  []string
+	unstickYes         bool
+	unstickForce       bool
+)
+
+// knownFinalizers describes which component handles well-known finalizers
+var knownFinalizers = map[string]string{
+	"kubernetes":                                  "namespace controller: waits until all resources in the namespace are deleted",
+	"kubernetes.io/pvc-protection":                "pvc-protection controller: waits until no pod uses the PVC",
+	"kubernetes.io/pv-protection":                 "pv-protection controller: waits until the PV is no longer bound",
+	"foregroundDeletion":                          "garbage collector: waits until dependents are deleted",
+	"orphan":                                      "garbage collector: orphans dependents before deletion",
+	"batch.kubernetes.io/job-tracking":            "job controller: waits until the pod is counted in the Job status",
+	"service.kubernetes.io/load-balancer-cleanup": "service controller: waits until the cloud load balancer is removed",
+}
+
+// unstickRootCmd represents the kube-unstick command
+var unstickRootCmd = &cobra.Command{
+	Use:   "kube-unstick <kind>/<name>",
+	Short: "Inspect and remove finalizers blocking deletion",
+	Long: `kube-unstick inspects the finalizers that keep an object from being deleted,
+shows which controller is expected to handle them and who owns the object, and
+after confirmation patches the finalizers away.
+
+Removing a finalizer skips the cleanup its controller would have done (e.g.
+cloud load balancers, volumes). Prefer fixing the controller when possible.
+
+The patch includes a test operation, so it fails instead of overwriting when
+the finalizers changed since they were inspected.
+
+Namespaces stuck in Terminating are handled through the finalize subresource.
+
+Examples:
+  kube-unstick pod/backend-7f9c4d5b6-xk2lp             # Inspect and remove all finalizers
+  kube-unstick pvc/data-db-0 --finalizer kubernetes.io/pvc-protection
+  kube-unstick namespace/old-team                      # Unstick a Terminating namespace`,
+	Args: cobra.ExactArgs(1),
+	RunE: runUnstick,
+}
+
+// runUnstick inspects the target object and removes the selected finalizers
+func runUnstick(cmd *cobra.Command, args []string) error {
+	kind, name, ok := strings.Cut(args[0], "/")
+	if !ok || kind == "" || name == "" {
+		return fmt.Errorf("invalid target '%s', expected <kind>/<name>", args[0])
+	}
+
+	client, err := k8s.NewClient("", unstickKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	targetNamespace := unstickNamespace
+	if targetNamespace == "" {
+		ns, err := k8s.GetCurrentNamespace(unstickKubeContext)
+		if err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+		targetNamespace = ns
+	}
+
+	mapping, err := client.ResolveResource(kind)
+	if err != nil {
+		return err
+	}
+
+	dyn, err := client.Dynamic()
+	if err != nil {
+		return err
+	}
+
+	var resource dynamic.ResourceInterface = dyn.Resource(mapping.Resource)
+	if mapping.Namespaced {
+		resource = dyn.Resource(mapping.Resource).Namespace(targetNamespace)
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	obj, err := resource.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get %s %s: %w", mapping.Kind, name, err)
+	}
+
+	// Namespaces are usually blocked by spec.finalizers, not metadata.finalizers
+	specFinalizers, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "finalizers")
+	useNamespaceFinalize := mapping.Kind == "Namespace" && len(obj.GetFinalizers()) == 0 && len(specFinalizers) > 0
+
+	current := obj.GetFinalizers()
+	if useNamespaceFinalize {
+		current = specFinalizers
+	}
+
+	printObjectInfo(mapping.Kind, obj)
+	printFinalizers(current)
+
+	if len(current) == 0 {
+		fmt.Println("Nothing to remove")
+		return nil
+	}
+
+	remove, keep, err := selectFinalizers(current, unstickFinalizers)
+	if err != nil {
+		return err
+	}
+
+	if obj.GetDeletionTimestamp() == nil && !unstickForce {
+		return fmt.Errorf("%s %s is not being deleted; removing finalizers from a live object skips its cleanup, use --force to proceed", mapping.Kind, name)
+	}
+
+	fmt.Println()
+	fmt.Printf("Will remove: %s\n", strings.Join(remove, ", "))
+	if len(keep) > 0 {
+		fmt.Printf("Will keep:   %s\n", strings.Join(keep, ", "))
+	}
+	if !unstickYes && !utils.Confirm(ctx, os.Stdout, "Remove finalizers? The controllers will not run their cleanup. [y/N]: ") {
+		fmt.Println("Aborted")
+		return nil
+	}
+
+	if useNamespaceFinalize {
+		err = finalizeNamespace(ctx, client, name, keep)
+	} else {
+		err = patchFinalizers(ctx, resource, name, current, keep)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d finalizer(s) from %s %s\n", len(remove), mapping.Kind, name)
+	return nil
+}
+
+// printObjectInfo prints deletion state and owners of the object
+func printObjectInfo(kind string, obj *unstructured.Unstructured) {
+	fmt.Printf("Object:    %s/%s\n", kind, obj.GetName())
+	if obj.GetNamespace() != "" {
+		fmt.Printf("Namespace: %s\n", obj.GetNamespace())
+	}
+
+	if ts := obj.GetDeletionTimestamp(); ts != nil {
+		since := ts.Time
+		if grace := obj.GetDeletionGracePeriodSeconds(); grace != nil {
+			since = since.Add(-time.Duration(*grace) * time.Second)
+		}
+		fmt.Printf("Deletion:  requested %s ago\n", utils.FormatAge(time.Since(since)))
+	} else {
+		fmt.Println("Deletion:  not requested")
+	}
+
+	owners := obj.GetOwnerReferences()
+	if len(owners) == 0 {
+		fmt.Println("Owners:    <none>")
+	}
+	for i, owner := range owners {
+		label := "Owners:   "
+		if i > 0 {
+			label = "          "
+		}
+		controller := ""
+		if owner.Controller != nil && *owner.Controller {
+			controller = " (controller)"
+		}
+		fmt.Printf("%s %s/%s%s\n", label, owner.Kind, owner.Name, controller)
+	}
+	fmt.Println()
+}
+
+// printFinalizers prints each finalizer with the component expected to handle it
+func printFinalizers(finalizers []string) {
+	headers := []string{"FINALIZER", "HANDLED BY"}
+	rows := make([][]string, 0, len(finalizers))
+	for _, f := range finalizers {
+		rows = append(rows, []string{f, describeFinalizer(f)})
+	}
+	table.Render(headers, rows)
+}
+
+// describeFinalizer returns the known handler of a finalizer or derives the
+// owning controller from its domain prefix
+func describeFinalizer(finalizer string) string {
+	if desc, ok := knownFinalizers[finalizer]; ok {
+		return desc
+	}
+	if domain, _, ok := strings.Cut(finalizer, "/"); ok {
+		return fmt.Sprintf("external controller (%s)", domain)
+	}
+	return "unknown controller"
+}
+
+// selectFinalizers splits current finalizers into those to remove and those to keep.
+// When requested is empty all finalizers are removed.
+func selectFinalizers(current, requested []string) (remove, keep []string, err error) {
+	if len(requested) == 0 {
+		return current, nil, nil
+	}
+
+	wanted := map[string]bool{}
+	for _, f := range requested {
+		wanted[f] = true
+	}
+	for _, f := range current {
+		if wanted[f] {
+			remove = append(remove, f)
+			delete(wanted, f)
+		} else {
+			keep = append(keep, f)
+		}
+	}
+	for f := range wanted {
+		return nil, nil, fmt.Errorf("finalizer '%s' is not set on the object", f)
+	}
+	return remove, keep, nil
+}
+
+// patchFinalizers replaces metadata.finalizers with keep using a JSON patch
+// guarded by a test operation on the inspected finalizers
+func patchFinalizers(ctx context.Context, resource dynamic.ResourceInterface, name string, current, keep []string) error {
+	ops := []map[string]interface{}{
+		{"op": "test", "path": "/metadata/finalizers", "value": current},
+	}
+	if len(keep) == 0 {
+		ops = append(ops, map[string]interface{}{"op": "remove", "path": "/metadata/finalizers"})
+	} else {
+		ops = append(ops, map[string]interface{}{"op": "replace", "path": "/metadata/finalizers", "value": keep})
+	}
+
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return fmt.Errorf("failed to build patch: %w", err)
+	}
+
+	if _, err := resource.Patch(ctx, name, types.JSONPatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to patch finalizers: %w", err)
+	}
+	return nil
+}
+
+// finalizeNamespace updates spec.finalizers through the namespace finalize subresource
+func finalizeNamespace(ctx context.Context, client *k8s.Client, name string, keep []string) error {
+	ns, err := client.Clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get namespace %s: %w", name, err)
+	}
+
+	ns.Spec.Finalizers = make([]corev1.FinalizerName, 0, len(keep))
+	for _, f := range keep {
+		ns.Spec.Finalizers = append(ns.Spec.Finalizers, corev1.FinalizerName(f))
+	}
+
+	if _, err := client.Clientset.CoreV1().Namespaces().Finalize(ctx, ns, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to finalize namespace %s: %w", name, err)
+	}
+	return nil
+}
+
+// init initializes flags for kube-unstick command
+func init() {
+	unstickRootCmd.Flags().StringVarP(&unstickNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	unstickRootCmd.Flags().StringVarP(&unstickKubeContext, "context", "c", "", "Kubernetes context to use")
+	unstickRootCmd.Flags().StringSliceVar(&unstickFinalizers, "finalizer", nil, "Only remove these finalizers (default: all)")
+	unstickRootCmd.Flags().BoolVarP(&unstickYes, "yes", "y", false, "Do not ask for confirmation")
+	unstickRootCmd.Flags().BoolVar(&unstickForce, "force", false, "Allow removing finalizers from objects that are not being deleted")
+
+	viper.BindPFlag("namespace", unstickRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", unstickRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-unstick
+func main() {
+	k8s.AddVerbosityFlag(unstickRootCmd)
+	k8s.AddRateLimitFlags(unstickRootCmd)
+	config.SetupDefaults(unstickRootCmd)
+	clierr.SetupUsage(unstickRootCmd)
+	cmd, err := unstickRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+var (
+	volNamespace   string
+	volKubeContext string
+	volHelper      bool
+	volImage       string
+	volTimeout     time.Duration
+	volTable       table.Options
+)
+
+// helperMountPath is where helper pods mount the claim
+const helperMountPath = "/volume"
+
+// volRootCmd represents the kube-vol command
+var volRootCmd = &cobra.Command{
+	Use:   "kube-vol",
+	Short: "Browse the content of PersistentVolumeClaims",
+	Long: `kube-vol answers "what's actually on this volume" without writing a debug pod.
+
+Without a subcommand it lists the PersistentVolumeClaims of the namespace and
+the pods mounting them. The subcommands look into a claim:
+
+  ls <claim> [path]           list a directory
+  cat <claim> <path>          print a file
+  get <claim> <path> [local]  download a file
+  du <claim> [path]           disk usage per entry and of the whole volume
+
+Paths are relative to the root of the volume. The commands run over exec in a
+running pod that mounts the whole claim (not a subPath), so nothing is
+scheduled. When there is none, or with --helper (e.g. for distroless images
+without ls and du), a helper pod (default image busybox) mounts the claim
+read-only and is deleted afterwards. A claim used by a pod is mounted on the
+node of that pod, since ReadWriteOnce volumes attach to one node only.
+
+Examples:
+  kube-vol                                   # Claims and their pods
+  kube-vol ls data-postgres-0                # Root of the volume
+  kube-vol ls data-postgres-0 pgdata/pg_wal
+  kube-vol cat uploads config/settings.json
+  kube-vol get uploads reports/2024.csv ./reports.csv
+  kube-vol du data-postgres-0 --helper       # Always use a helper pod`,
+	Args: cobra.NoArgs,
+	RunE: runVolumes,
+}
+
+// lsVolCmd represents the kube-vol ls subcommand
+var lsVolCmd = &cobra.Command{
+	Use:   "ls <claim> [path]",
+	Short: "List a directory of the volume",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := ""
+		if len(args) > 1 {
+			dir = args[1]
+		}
+		return withVolume(args[0], func(v *volumeSession) error {
+			return v.run([]string{"ls", "-lah", v.path(dir)}, os.Stdout)
+		})
+	},
+}
+
+// catVolCmd represents the kube-vol cat subcommand
+var catVolCmd = &cobra.Command{
+	Use:   "cat <claim> <path>",
+	Short: "Print a file of the volume",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withVolume(args[0], func(v *volumeSession) error {
+			return v.run([]string{"cat", v.path(args[1])}, os.Stdout)
+		})
+	},
+}
+
+// getVolCmd represents the kube-vol get subcommand
+var getVolCmd = &cobra.Command{
+	Use:   "get <claim> <path> [local-path]",
+	Short: "Download a file of the volume",
+	Long: `get downloads a single file. The local path defaults to the file name in the
+current directory; an existing local directory keeps the remote file name. The
+local file is only replaced when the download succeeded.
+
+Examples:
+  kube-vol get uploads reports/2024.csv
+  kube-vol get uploads reports/2024.csv /tmp/`,
+	Args: cobra.RangeArgs(2, 3),
+	RunE: runGetVolume,
+}
+
+// duVolCmd represents the kube-vol du subcommand
+var duVolCmd = &cobra.Command{
+	Use:   "du <claim> [path]",
+	Short: "Show disk usage per entry of a directory and of the volume",
+	Long: `du lists the entries of a directory (the volume root by default), largest
+first, followed by the usage of the filesystem compared to the requested size
+of the claim.
+
+Examples:
+  kube-vol du data-postgres-0
+  kube-vol du data-postgres-0 pgdata/base`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runDuVolume,
+}
+
+// runVolumes lists the claims of the namespace with the pods mounting them
+func runVolumes(cmd *cobra.Command, args []string) error {
+	if err := volTable.Validate(); err != nil {
+		return err
+	}
+	client, ns, err := volClient()
+	if err != nil {
+		return err
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	pvcs, err := client.Clientset.CoreV1().PersistentVolumeClaims(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list persistentvolumeclaims: %w", err)
+	}
+	pods, err := client.Clientset.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	mountedBy := map[string][]string{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		for _, vol := range pod.Spec.Volumes {
+			if vol.PersistentVolumeClaim != nil {
+				mountedBy[vol.PersistentVolumeClaim.ClaimName] = append(mountedBy[vol.PersistentVolumeClaim.ClaimName], pod.Name)
+			}
+		}
+	}
+
+	sort.Slice(pvcs.Items, func(i, j int) bool { return pvcs.Items[i].Name < pvcs.Items[j].Name })
+	headers := []string{"NAME", "STATUS", "CAPACITY", "ACCESS-MODES", "STORAGECLASS", "MOUNTED-BY", "AGE"}
+	rows := make([][]string, 0, len(pvcs.Items))
+	for _, pvc := range pvcs.Items {
+		capacity := "-"
+		if q, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+			capacity = q.String()
+		} else if q, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+			capacity = q.String()
+		}
+		modes := make([]string, 0, len(pvc.Spec.AccessModes))
+		for _, mode := range pvc.Spec.AccessModes {
+			modes = append(modes, string(mode))
+		}
+		class := "-"
+		if pvc.Spec.StorageClassName != nil && *pvc.Spec.StorageClassName != "" {
+			class = *pvc.Spec.StorageClassName
+		}
+		users := "-"
+		if names := mountedBy[pvc.Name]; len(names) > 0 {
+			users = strings.Join(names, ",")
+		}
+		rows = append(rows, []string{
+			pvc.Name,
+			string(pvc.Status.Phase),
+			capacity,
+			strings.Join(modes, ","),
+			class,
+			users,
+			utils.FormatAge(time.Since(pvc.CreationTimestamp.Time)),
+		})
+	}
+	volTable.Print(headers, rows, 0)
+	return nil
+}
+
+// runGetVolume downloads a file of the volume
+func runGetVolume(cmd *cobra.Command, args []string) error {
+	local := path.Base(args[1])
+	if len(args) > 2 {
+		local = args[2]
+	}
+	if info, err := os.Stat(local); err == nil && info.IsDir() {
+		local = filepath.Join(local, path.Base(args[1]))
+	}
+
+	return withVolume(args[0], func(v *volumeSession) error {
+		tmp, err := os.CreateTemp(filepath.Dir(local), ".kube-vol-*")
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", local, err)
+		}
+		defer os.Remove(tmp.Name())
+
+		counter := &countingWriter{w: tmp}
+		err = v.run([]string{"cat", v.path(args[1])}, counter)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), local); err != nil {
+			return fmt.Errorf("failed to write %s: %w", local, err)
+		}
+		fmt.Fprintf(os.Stderr, "Downloaded %s:%s to %s (%s)\n", args[0], args[1], local, utils.FormatBytes(counter.n))
+		return nil
+	})
+}
+
+// duScript prints "<KiB>\t<name>" per entry of the directory $0, hidden
+// entries included, then a separator and the df line of the filesystem.
+// Entries that cannot be read are skipped rather than failing the listing.
+const duScript = `cd "$0" || exit 1
+for f in .[!.]* ..?* *; do
+  [ -e "$f" ] || [ -L "$f" ] || continue
+  du -sk -- "$f" 2>/dev/null
+done
+echo ---
+df -Pk . | tail -n 1`
+
+// runDuVolume shows the disk usage of a directory of the volume
+func runDuVolume(cmd *cobra.Command, args []string) error {
+	if err := volTable.Validate(); err != nil {
+		return err
+	}
+	dir := ""
+	if len(args) > 1 {
+		dir = args[1]
+	}
+
+	return withVolume(args[0], func(v *volumeSession) error {
+		var out bytes.Buffer
+		if err := v.run([]string{"sh", "-c", duScript, v.path(dir)}, &out); err != nil {
+			return err
+		}
+		entries, df, _ := strings.Cut(out.String(), "---\n")
+
+		type entry struct {
+			name string
+			size int64
+		}
+		var list []entry
+		var total int64
+		for _, line := range strings.Split(strings.TrimSpace(entries), "\n") {
+			size, name, ok := strings.Cut(line, "\t")
+			kib, err := strconv.ParseInt(size, 10, 64)
+			if !ok || err != nil {
+				continue
+			}
+			list = append(list, entry{name: name, size: kib * 1024})
+			total += kib * 1024
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].size != list[j].size {
+				return list[i].size > list[j].size
+			}
+			return list[i].name < list[j].name
+		})
+
+		rel := strings.TrimPrefix(path.Clean("/"+dir), "/")
+		rows := make([][]string, 0, len(list))
+		for _, e := range list {
+			rows = append(rows, []string{utils.FormatBytes(e.size), path.Join(rel, e.name)})
+		}
+		volTable.Print([]string{"SIZE", "PATH"}, rows, 1)
+		if !volTable.Bordered() {
+			return nil
+		}
+
+		fmt.Printf("\nTotal: %s in %d entries\n", utils.FormatBytes(total), len(list))
+		// df -P: filesystem, 1024-blocks, used, available, capacity, mounted on
+		if fields := strings.Fields(df); len(fields) >= 5 {
+			size, _ := strconv.ParseInt(fields[1], 10, 64)
+			used, _ := strconv.ParseInt(fields[2], 10, 64)
+			fmt.Printf("Volume: %s used of %s (%s)", utils.FormatBytes(used*1024), utils.FormatBytes(size*1024), fields[4])
+			if q, ok := v.claim.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+				fmt.Printf(", claim requests %s", q.String())
+			}
+			fmt.Println()
+		}
+		return nil
+	})
+}
+
+// volumeSession is a container with the claim mounted, where the subcommands
+// run their commands
+type volumeSession struct {
+	client    *k8s.Client
+	ctx       context.Context
+	claim     *corev1.PersistentVolumeClaim
+	namespace string
+	pod       string
+	container string
+	mountPath string
+	helper    bool
+}
+
+// path maps a path relative to the volume root to the path in the container.
+// Paths cannot leave the volume.
+func (v *volumeSession) path(p string) string {
+	return path.Join(v.mountPath, path.Clean("/"+p))
+}
+
+// run executes command in the container, writing its stdout to out. The
+// stderr of the command (e.g. "No such file or directory") becomes the error.
+func (v *volumeSession) run(command []string, out io.Writer) error {
+	var stderr bytes.Buffer
+	err := streamExec(v.ctx, v.client, v.namespace, v.pod, v.container, command, out, &stderr)
+	if err == nil {
+		return nil
+	}
+	if !v.helper && strings.Contains(err.Error(), "executable file not found") {
+		return fmt.Errorf("%s is not available in container %s of pod %s, retry with --helper", command[0], v.container, v.pod)
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("%s", strings.ReplaceAll(msg, v.mountPath+"/", ""))
+	}
+	return fmt.Errorf("%s failed: %w", command[0], err)
+}
+
+// withVolume runs fn with a session on the claim and deletes the helper pod,
+// if one was created, afterwards
+func withVolume(claimName string, fn func(*volumeSession) error) error {
+	client, ns, err := volClient()
+	if err != nil {
+		return err
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	pvc, err := client.Clientset.CoreV1().PersistentVolumeClaims(ns).Get(ctx, claimName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return clierr.Newf(clierr.NotFound, "persistentvolumeclaim %s not found in namespace %s", claimName, ns)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get persistentvolumeclaim %s: %w", claimName, err)
+	}
+
+	pods, err := client.Clientset.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	session := &volumeSession{client: client, ctx: ctx, claim: pvc, namespace: ns}
+	node := ""
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		container, mountPath, mounted := claimMount(&pod, claimName)
+		if !mounted {
+			continue
+		}
+		node = pod.Spec.NodeName
+		if container != "" && !volHelper {
+			session.pod, session.container, session.mountPath = pod.Name, container, mountPath
+			break
+		}
+	}
+
+	if session.pod != "" {
+		fmt.Fprintf(os.Stderr, "Using pod %s (container %s, mounted at %s)\n", session.pod, session.container, session.mountPath)
+		return fn(session)
+	}
+
+	helper, err := startHelperPod(ctx, client, pvc, node)
+	if helper != "" {
+		cleanup := sync.OnceFunc(func() {
+			zero := int64(0)
+			client.Clientset.CoreV1().Pods(ns).Delete(context.Background(), helper, metav1.DeleteOptions{GracePeriodSeconds: &zero})
+		})
+		defer cleanup()
+		defer interrupt.OnExit(cleanup)()
+	}
+	if err != nil {
+		return err
+	}
+	session.pod, session.container, session.mountPath, session.helper = helper, "vol", helperMountPath, true
+	return fn(session)
+}
+
+// claimMount returns the first container of the pod that mounts the whole
+// claim, with its mount path. mounted is also true when the claim is only
+// mounted with a subPath, which does not show the whole volume.
+func claimMount(pod *corev1.Pod, claimName string) (container, mountPath string, mounted bool) {
+	for _, vol := range pod.Spec.Volumes {
+		if vol.PersistentVolumeClaim == nil || vol.PersistentVolumeClaim.ClaimName != claimName {
+			continue
+		}
+		mounted = true
+		for _, c := range pod.Spec.Containers {
+			for _, m := range c.VolumeMounts {
+				if m.Name == vol.Name && m.SubPath == "" && m.SubPathExpr == "" {
+					return c.Name, m.MountPath, true
+				}
+			}
+		}
+	}
+	return "", "", mounted
+}
+
+// startHelperPod creates a pod mounting the claim read-only and waits until
+// it runs. A non-empty node pins the pod to the node the volume is attached
+// to. The name is returned as soon as the pod was created, so it can be
+// cleaned up when starting it fails.
+func startHelperPod(ctx context.Context, client *k8s.Client, pvc *corev1.PersistentVolumeClaim, node string) (string, error) {
+	pods := client.Clientset.CoreV1().Pods(pvc.Namespace)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "kube-vol-",
+			Labels:       map[string]string{"app.kubernetes.io/managed-by": "kube-vol"},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			NodeName:      node,
+			Containers: []corev1.Container{{
+				Name:         "vol",
+				Image:        volImage,
+				Command:      []string{"sleep", "3600"},
+				VolumeMounts: []corev1.VolumeMount{{Name: "volume", MountPath: helperMountPath, ReadOnly: true}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name: "volume",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pvc.Name, ReadOnly: true},
+				},
+			}},
+		},
+	}
+	if node != "" {
+		// The node was picked by the pod using the claim, its taints do not matter
+		pod.Spec.Tolerations = []corev1.Toleration{{Operator: corev1.TolerationOpExists}}
+	}
+
+	created, err := pods.Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create helper pod: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Starting helper pod %s/%s (%s) with %s mounted...\n", pvc.Namespace, created.Name, volImage, pvc.Name)
+
+	deadline := time.Now().Add(volTimeout)
+	for {
+		current, err := pods.Get(ctx, created.Name, metav1.GetOptions{})
+		if err != nil {
+			return created.Name, fmt.Errorf("failed to get helper pod: %w", err)
+		}
+		switch current.Status.Phase {
+		case corev1.PodRunning:
+			return created.Name, nil
+		case corev1.PodFailed, corev1.PodSucceeded:
+			return created.Name, fmt.Errorf("helper pod exited with phase %s", current.Status.Phase)
+		}
+		if time.Now().After(deadline) {
+			return created.Name, clierr.Timeoutf("timeout waiting for helper pod %s to start%s", created.Name, pendingReason(current))
+		}
+		select {
+		case <-ctx.Done():
+			return created.Name, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// pendingReason tells why a pod is not running yet, e.g. unschedulable or an
+// image pull failure, as a suffix for errors
+func pendingReason(pod *corev1.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if w := status.State.Waiting; w != nil && w.Reason != "" && w.Reason != "ContainerCreating" {
+			return fmt.Sprintf(": %s %s", w.Reason, w.Message)
+		}
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse {
+			return ": " + cond.Message
+		}
+	}
+	return ""
+}
+
+// volClient creates the client and resolves the namespace
+func volClient() (*k8s.Client, string, error) {
+	client, err := k8s.NewClient("", volKubeContext)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	ns := volNamespace
+	if ns == "" {
+		if ns, err = k8s.GetCurrentNamespace(volKubeContext); err != nil {
+			return nil, "", fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	return client, ns, nil
+}
+
+// streamExec runs a non-interactive command in the container
+func streamExec(ctx context.Context, client *k8s.Client, namespace, podName, container string, command []string, stdout, stderr io.Writer) error {
+	req := client.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("exec")
+
+	req.VersionedParams(&corev1.PodExecOptions{
+		Container: container,
+		Command:   command,
+		Stdout:    true,
+		Stderr:    true,
+	}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(client.Config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create executor: %w", err)
+	}
+	return executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: stdout, Stderr: stderr})
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// init initializes flags for kube-vol command
+func init() {
+	volRootCmd.PersistentFlags().StringVarP(&volNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	volRootCmd.PersistentFlags().StringVarP(&volKubeContext, "context", "c", "", "Kubernetes context to use")
+	volRootCmd.PersistentFlags().BoolVar(&volHelper, "helper", false, "Always mount the claim in a helper pod, even when a running pod mounts it")
+	volRootCmd.PersistentFlags().StringVar(&volImage, "image", "busybox:1.36", "Image of the helper pod, needs sh, ls, cat, du and df")
+	volRootCmd.PersistentFlags().DurationVar(&volTimeout, "timeout", 2*time.Minute, "How long to wait for the helper pod to start")
+
+	volTable.AddFlags(volRootCmd)
+	volTable.AddFlags(duVolCmd)
+	volRootCmd.AddCommand(lsVolCmd, catVolCmd, getVolCmd, duVolCmd)
+
+	viper.BindPFlag("namespace", volRootCmd.PersistentFlags().Lookup("namespace"))
+	viper.BindPFlag("context", volRootCmd.PersistentFlags().Lookup("context"))
+}
+
+// main is the entry point of kube-vol
+func main() {
+	k8s.AddVerbosityFlag(volRootCmd)
+	k8s.AddRateLimitFlags(volRootCmd)
+	config.SetupDefaults(volRootCmd)
+	clierr.SetupUsage(volRootCmd)
+	cmd, err := volRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
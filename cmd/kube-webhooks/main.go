@@ -0,0 +1,881 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	webhooksNamespace   string
+	webhooksKubeContext string
+	webhooksCheck       bool
+	webhooksTimeout     time.Duration
+	webhooksTable       table.Options
+)
+
+// Colors of backend states and admission results
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// Backend states of the reachability check
+const (
+	backendOK         = "ok"
+	backendNotChecked = "not checked"
+)
+
+// deniedPattern finds the webhook in the message of a denied request
+var deniedPattern = regexp.MustCompile(`admission webhook "([^"]+)" denied the request`)
+
+// webhook is a webhook of a Validating- or MutatingWebhookConfiguration
+type webhook struct {
+	kind              string
+	configuration     string
+	name              string
+	clientConfig      admissionv1.WebhookClientConfig
+	rules             []admissionv1.RuleWithOperations
+	failurePolicy     string
+	namespaceSelector *metav1.LabelSelector
+	objectSelector    *metav1.LabelSelector
+	matchConditions   int
+	timeout           int32
+}
+
+// manifest is one object read from a file
+type manifest struct {
+	file     string
+	document int
+	obj      *unstructured.Unstructured
+}
+
+// webhooksRootCmd represents the kube-webhooks command
+var webhooksRootCmd = &cobra.Command{
+	Use:   "kube-webhooks",
+	Short: "List admission webhooks and check their backends",
+	Long: `kube-webhooks lists the webhooks of all MutatingWebhookConfigurations and
+ValidatingWebhookConfigurations: the service or URL they call, their
+failurePolicy, the namespaces they apply to, the requests they intercept and
+whether their backend answers.
+
+BACKEND checks a service backend the way the API server reaches it: the
+service must exist and have ready endpoints, and a request through the API
+server's service proxy must get an answer. A webhook without caBundle is
+reported too, the API server cannot verify it. URL backends are not checked.
+
+A webhook with failurePolicy Fail whose backend is broken rejects every
+request it matches, a common reason why pods or deployments cannot be
+created. kube-webhooks exits with 1 when it finds one.
+
+Use 'test' to see which webhooks a manifest passes through, what they change
+and which one denies it.
+
+Examples:
+  kube-webhooks                           # All webhooks with backend state
+  kube-webhooks --check=false             # Skip the backend check
+  kube-webhooks test deployment.yaml      # Dry-run through admission
+  helm template ./chart | kube-webhooks test -`,
+	Args: cobra.NoArgs,
+	RunE: runWebhooks,
+}
+
+// testWebhooksCmd represents the kube-webhooks test subcommand
+var testWebhooksCmd = &cobra.Command{
+	Use:   "test <file|dir|->...",
+	Short: "Dry-run manifests to see which webhooks mutate or deny them",
+	Long: `test sends every object of the manifests to the cluster as a server-side
+apply dry-run, so it passes through admission like a real kubectl apply
+without changing anything. For every object it shows:
+
+- the webhooks whose rules, namespaceSelector and objectSelector match the
+  request (CREATE for new objects, UPDATE for existing ones); matchConditions
+  are evaluated by the API server only and are marked
+- the changes admission made: values of fields the manifest sets, added
+  labels and annotations, and added entries of named lists like containers,
+  volumes or env. Defaults of the API server are mixed in, other added fields
+  are left out since they are mostly defaults
+- the webhook that denied the object, with its message
+
+Exits with 1 when an object is denied.
+
+Examples:
+  kube-webhooks test deployment.yaml
+  kube-webhooks test k8s/ -n staging      # Namespace for objects without one
+  helm template ./chart | kube-webhooks test -`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runTest,
+}
+
+// runWebhooks lists all webhooks with the state of their backend
+func runWebhooks(cmd *cobra.Command, args []string) error {
+	if err := webhooksTable.Validate(); err != nil {
+		return err
+	}
+	if webhooksTimeout <= 0 {
+		return clierr.Usagef("--timeout must be positive")
+	}
+	client, err := k8s.NewClient("", webhooksKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	webhooks, err := listWebhooks(ctx, client)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		fmt.Println("No admission webhooks found")
+		return nil
+	}
+
+	var backends map[string]string
+	if webhooksCheck {
+		backends = checkBackends(ctx, client, webhooks)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	headers := []string{"TYPE", "CONFIGURATION", "WEBHOOK", "TARGET", "FAILURE", "NAMESPACES", "RULES", "TIMEOUT", "BACKEND"}
+	rows := make([][]string, 0, len(webhooks))
+	var broken []string
+	for _, w := range webhooks {
+		failure := w.failurePolicy
+		if failure == string(admissionv1.Fail) {
+			failure = colorYellow + failure + colorReset
+		}
+		backend := "-"
+		if webhooksCheck {
+			backend = backends[backendKey(w.clientConfig)]
+			switch {
+			case backend == backendOK:
+				backend = colorGreen + backend + colorReset
+			case backend == backendNotChecked:
+			default:
+				if w.failurePolicy == string(admissionv1.Fail) {
+					broken = append(broken, w.name)
+				}
+				backend = colorRed + backend + colorReset
+			}
+		}
+		rows = append(rows, []string{
+			w.kind,
+			w.configuration,
+			w.name,
+			targetName(w.clientConfig),
+			failure,
+			selectorText(w.namespaceSelector),
+			utils.TruncateString(rulesText(w.rules), 50),
+			fmt.Sprintf("%ds", w.timeout),
+			backend,
+		})
+	}
+	webhooksTable.Print(headers, rows, 2)
+
+	if len(broken) > 0 {
+		return clierr.Newf(clierr.Generic, "%d webhook(s) with failurePolicy Fail have a broken backend and reject the requests they match: %s",
+			len(broken), strings.Join(broken, ", "))
+	}
+	return nil
+}
+
+// listWebhooks returns the webhooks of all configurations, mutating first
+// as the API server calls them, sorted by configuration
+func listWebhooks(ctx context.Context, client *k8s.Client) ([]webhook, error) {
+	api := client.Clientset.AdmissionregistrationV1()
+	mutating, err := api.MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list MutatingWebhookConfigurations: %w", err)
+	}
+	validating, err := api.ValidatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ValidatingWebhookConfigurations: %w", err)
+	}
+
+	var webhooks []webhook
+	sort.Slice(mutating.Items, func(i, j int) bool { return mutating.Items[i].Name < mutating.Items[j].Name })
+	for _, c := range mutating.Items {
+		for _, w := range c.Webhooks {
+			webhooks = append(webhooks, newWebhook("mutating", c.Name, w.Name, w.ClientConfig, w.Rules, w.FailurePolicy,
+				w.NamespaceSelector, w.ObjectSelector, len(w.MatchConditions), w.TimeoutSeconds))
+		}
+	}
+	sort.Slice(validating.Items, func(i, j int) bool { return validating.Items[i].Name < validating.Items[j].Name })
+	for _, c := range validating.Items {
+		for _, w := range c.Webhooks {
+			webhooks = append(webhooks, newWebhook("validating", c.Name, w.Name, w.ClientConfig, w.Rules, w.FailurePolicy,
+				w.NamespaceSelector, w.ObjectSelector, len(w.MatchConditions), w.TimeoutSeconds))
+		}
+	}
+	return webhooks, nil
+}
+
+// newWebhook fills in the defaults of the API server for unset fields
+func newWebhook(kind, configuration, name string, clientConfig admissionv1.WebhookClientConfig, rules []admissionv1.RuleWithOperations,
+	failurePolicy *admissionv1.FailurePolicyType, namespaceSelector, objectSelector *metav1.LabelSelector, matchConditions int, timeout *int32) webhook {
+	w := webhook{
+		kind:              kind,
+		configuration:     configuration,
+		name:              name,
+		clientConfig:      clientConfig,
+		rules:             rules,
+		failurePolicy:     string(admissionv1.Fail),
+		namespaceSelector: namespaceSelector,
+		objectSelector:    objectSelector,
+		matchConditions:   matchConditions,
+		timeout:           10,
+	}
+	if failurePolicy != nil {
+		w.failurePolicy = string(*failurePolicy)
+	}
+	if timeout != nil {
+		w.timeout = *timeout
+	}
+	return w
+}
+
+// targetName returns the service (namespace/name:port/path) or URL a webhook calls
+func targetName(cc admissionv1.WebhookClientConfig) string {
+	if cc.URL != nil {
+		return *cc.URL
+	}
+	if cc.Service == nil {
+		return "-"
+	}
+	target := fmt.Sprintf("svc/%s/%s:%d", cc.Service.Namespace, cc.Service.Name, servicePort(cc.Service))
+	if cc.Service.Path != nil {
+		target += *cc.Service.Path
+	}
+	return target
+}
+
+// servicePort returns the port of a service reference, 443 when unset
+func servicePort(s *admissionv1.ServiceReference) int32 {
+	if s.Port != nil {
+		return *s.Port
+	}
+	return 443
+}
+
+// selectorText describes a namespace selector, "all" when it is empty
+func selectorText(selector *metav1.LabelSelector) string {
+	if selector == nil || (len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0) {
+		return "all"
+	}
+	return metav1.FormatLabelSelector(selector)
+}
+
+// rulesText describes the rules of a webhook like CREATE,UPDATE apps/deployments
+func rulesText(rules []admissionv1.RuleWithOperations) string {
+	parts := make([]string, 0, len(rules))
+	for _, r := range rules {
+		ops := make([]string, len(r.Operations))
+		for i, op := range r.Operations {
+			ops[i] = string(op)
+		}
+		var resources []string
+		for _, group := range r.APIGroups {
+			for _, res := range r.Resources {
+				if group != "" {
+					res = group + "/" + res
+				}
+				resources = append(resources, res)
+			}
+		}
+		parts = append(parts, strings.Join(ops, ",")+" "+strings.Join(resources, ","))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// backendKey identifies the backend of a webhook, several webhooks often
+// share one
+func backendKey(cc admissionv1.WebhookClientConfig) string {
+	key := targetName(cc)
+	if len(cc.CABundle) == 0 {
+		key += " (no caBundle)"
+	}
+	return key
+}
+
+// checkBackends checks every distinct backend concurrently and returns the
+// states by backendKey
+func checkBackends(ctx context.Context, client *k8s.Client, webhooks []webhook) map[string]string {
+	backends := map[string]admissionv1.WebhookClientConfig{}
+	for _, w := range webhooks {
+		backends[backendKey(w.clientConfig)] = w.clientConfig
+	}
+
+	keys := make([]string, 0, len(backends))
+	for key := range backends {
+		keys = append(keys, key)
+	}
+	results := make([]string, len(keys))
+	k8s.FanOut(len(keys), func(i int) {
+		results[i] = checkBackend(ctx, client, backends[keys[i]])
+	})
+
+	states := make(map[string]string, len(keys))
+	for i, key := range keys {
+		states[key] = results[i]
+	}
+	return states
+}
+
+// checkBackend checks that the API server can reach the service of a webhook
+func checkBackend(ctx context.Context, client *k8s.Client, cc admissionv1.WebhookClientConfig) string {
+	if cc.Service == nil {
+		return backendNotChecked
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhooksTimeout)
+	defer cancel()
+	svc := cc.Service
+
+	if _, err := client.Clientset.CoreV1().Services(svc.Namespace).Get(ctx, svc.Name, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "service missing"
+		}
+		return "error: " + errorText(err)
+	}
+	ready := 0
+	if eps, err := client.Clientset.CoreV1().Endpoints(svc.Namespace).Get(ctx, svc.Name, metav1.GetOptions{}); err == nil {
+		for _, subset := range eps.Subsets {
+			ready += len(subset.Addresses)
+		}
+	}
+	if ready == 0 {
+		return "no ready endpoints"
+	}
+
+	// Any answer of the webhook counts, it expects a POST of an AdmissionReview
+	path := "/"
+	if svc.Path != nil {
+		path = *svc.Path
+	}
+	_, err := client.Clientset.CoreV1().Services(svc.Namespace).
+		ProxyGet("https", svc.Name, strconv.Itoa(int(servicePort(svc))), path, nil).DoRaw(ctx)
+	var status apierrors.APIStatus
+	switch {
+	case err == nil:
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return "timeout"
+	case apierrors.IsForbidden(err) && strings.Contains(err.Error(), "services/proxy"):
+		return backendNotChecked
+	case errors.As(err, &status) && status.Status().Code == 503 &&
+		(strings.Contains(status.Status().Message, "error trying to reach service") || strings.Contains(status.Status().Message, "no endpoints available")):
+		return "unreachable"
+	}
+	if len(cc.CABundle) == 0 {
+		return "no caBundle"
+	}
+	return backendOK
+}
+
+// errorText returns the message of an API error without its prefix
+func errorText(err error) string {
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		return status.Status().Message
+	}
+	return err.Error()
+}
+
+// runTest dry-runs every object of the manifests through admission
+func runTest(cmd *cobra.Command, args []string) error {
+	manifests, err := readManifests(args)
+	if err != nil {
+		return err
+	}
+	client, err := k8s.NewClient("", webhooksKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	namespace := webhooksNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(webhooksKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+	dyn, err := client.Dynamic()
+	if err != nil {
+		return err
+	}
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	// Without permission to list them the dry-run still shows the outcome
+	webhooks, err := listWebhooks(ctx, client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v, matching webhooks are not shown\n", err)
+	}
+
+	denied := 0
+	for i, m := range manifests {
+		if i > 0 {
+			fmt.Println()
+		}
+		ok, err := testManifest(ctx, client, dyn, webhooks, m, namespace)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			denied++
+		}
+	}
+	if denied > 0 {
+		return clierr.Newf(clierr.Generic, "%d of %d object(s) rejected", denied, len(manifests))
+	}
+	return nil
+}
+
+// testManifest dry-runs one object and prints the matching webhooks, the
+// changes of admission or why it was rejected. It reports whether the
+// object was admitted.
+func testManifest(ctx context.Context, client *k8s.Client, dyn dynamic.Interface, webhooks []webhook, m manifest, namespace string) (bool, error) {
+	obj := m.obj
+	title := fmt.Sprintf("%s %s (%s#%d)", obj.GetKind(), obj.GetName(), m.file, m.document)
+	gvk := obj.GroupVersionKind()
+	if gvk.Kind == "" || gvk.Version == "" || obj.GetName() == "" {
+		fmt.Printf("%s: %srejected%s\n  apiVersion, kind and metadata.name are required\n", title, colorRed, colorReset)
+		return false, nil
+	}
+	mapping, err := client.ResolveKind(gvk)
+	if err != nil {
+		fmt.Printf("%s: %srejected%s\n  %v\n", title, colorRed, colorReset, err)
+		return false, nil
+	}
+
+	var res dynamic.ResourceInterface = dyn.Resource(mapping.Resource)
+	ns := ""
+	if mapping.Namespaced {
+		if ns = obj.GetNamespace(); ns == "" {
+			ns = namespace
+		}
+		res = dyn.Resource(mapping.Resource).Namespace(ns)
+		title = fmt.Sprintf("%s %s/%s (%s#%d)", obj.GetKind(), ns, obj.GetName(), m.file, m.document)
+	}
+
+	operation := admissionv1.Create
+	objectLabels := []labels.Set{obj.GetLabels()}
+	existing, err := res.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	switch {
+	case err == nil:
+		operation = admissionv1.Update
+		objectLabels = append(objectLabels, existing.GetLabels())
+	case !apierrors.IsNotFound(err):
+		return false, fmt.Errorf("failed to get %s %s: %w", obj.GetKind(), obj.GetName(), err)
+	}
+
+	// The namespace label is set on every namespace, the others need a lookup
+	var namespaceLabels labels.Set
+	switch {
+	case mapping.Resource.Group == "" && mapping.Resource.Resource == "namespaces":
+		namespaceLabels = labels.Merge(obj.GetLabels(), labels.Set{"kubernetes.io/metadata.name": obj.GetName()})
+	case mapping.Namespaced:
+		namespaceLabels = labels.Set{"kubernetes.io/metadata.name": ns}
+		if n, err := client.Clientset.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{}); err == nil {
+			namespaceLabels = labels.Merge(n.Labels, namespaceLabels)
+		}
+	}
+
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return false, err
+	}
+	force := true
+	result, err := res.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		DryRun:       []string{metav1.DryRunAll},
+		FieldManager: "kube-webhooks",
+		Force:        &force,
+	})
+	var status apierrors.APIStatus
+	if err != nil && !errors.As(err, &status) {
+		return false, fmt.Errorf("dry-run of %s %s failed: %w", obj.GetKind(), obj.GetName(), err)
+	}
+
+	switch {
+	case err == nil:
+		fmt.Printf("%s: %sadmitted%s (dry-run %s)\n", title, colorGreen, colorReset, operation)
+	case deniedPattern.MatchString(status.Status().Message):
+		fmt.Printf("%s: %sdenied by %s%s (dry-run %s)\n", title, colorRed, deniedPattern.FindStringSubmatch(status.Status().Message)[1], colorReset, operation)
+	default:
+		fmt.Printf("%s: %srejected%s (dry-run %s)\n", title, colorRed, colorReset, operation)
+	}
+
+	var matched []webhook
+	for _, w := range webhooks {
+		if w.matches(operation, mapping.Resource, mapping.Namespaced, namespaceLabels, objectLabels) {
+			matched = append(matched, w)
+		}
+	}
+	if len(matched) == 0 {
+		fmt.Println("  Webhooks: none match")
+	} else {
+		fmt.Println("  Webhooks, in the order they are called:")
+		for _, w := range matched {
+			note := ""
+			if w.matchConditions > 0 {
+				note = "  (matchConditions not evaluated)"
+			}
+			fmt.Printf("    %-10s  %-45s  %-6s  %s%s\n", w.kind, w.name, w.failurePolicy, w.configuration, note)
+		}
+	}
+
+	if err != nil {
+		fmt.Printf("  %s\n", status.Status().Message)
+		return false, nil
+	}
+	changes := admissionChanges("", obj.Object, result.Object)
+	if len(changes) == 0 {
+		fmt.Println("  Changes: none")
+		return true, nil
+	}
+	fmt.Println("  Changes by admission and defaults:")
+	for _, change := range changes {
+		fmt.Printf("    %s\n", change)
+	}
+	return true, nil
+}
+
+// matches reports whether the API server calls the webhook for a request.
+// matchPolicy Equivalent and matchConditions are not taken into account.
+func (w webhook) matches(operation admissionv1.OperationType, gvr schema.GroupVersionResource, namespaced bool, namespaceLabels labels.Set, objectLabels []labels.Set) bool {
+	ruleMatches := false
+	for _, r := range w.rules {
+		if contains(r.Operations, operation, admissionv1.OperationAll) &&
+			contains(r.APIGroups, gvr.Group, "*") &&
+			contains(r.APIVersions, gvr.Version, "*") &&
+			contains(r.Resources, gvr.Resource, "*", "*/*") &&
+			scopeMatches(r.Scope, namespaced) {
+			ruleMatches = true
+			break
+		}
+	}
+	if !ruleMatches {
+		return false
+	}
+
+	if namespaceLabels != nil && !selectorMatches(w.namespaceSelector, namespaceLabels) {
+		return false
+	}
+	for _, set := range objectLabels {
+		if selectorMatches(w.objectSelector, set) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectorMatches reports whether a webhook selector matches labels, an
+// unset selector matches everything
+func selectorMatches(selector *metav1.LabelSelector, set labels.Set) bool {
+	if selector == nil {
+		return true
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	return err == nil && s.Matches(set)
+}
+
+// contains reports whether values holds value or one of the wildcards
+func contains[T ~string](values []T, value T, wildcards ...T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+		for _, w := range wildcards {
+			if v == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scopeMatches reports whether a rule scope covers namespaced or cluster objects
+func scopeMatches(scope *admissionv1.ScopeType, namespaced bool) bool {
+	if scope == nil || *scope == admissionv1.AllScopes {
+		return true
+	}
+	return (*scope == admissionv1.NamespacedScope) == namespaced
+}
+
+// admissionChanges lists the differences of the admitted object to the
+// manifest: changed values of fields the manifest sets, added labels and
+// annotations, and added or removed entries of named lists. Other fields the
+// manifest does not set are left out, they are mostly defaults.
+func admissionChanges(path string, want, got interface{}) []string {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		gotMap, ok := got.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: %s -> %s", path, valueText(want), valueText(got))}
+		}
+		// Labels and annotations added to an object that had none
+		if path == "metadata" || strings.HasSuffix(path, ".metadata") {
+			metadata := make(map[string]interface{}, len(want)+2)
+			for key, value := range want {
+				metadata[key] = value
+			}
+			for _, key := range []string{"labels", "annotations"} {
+				if _, ok := want[key]; !ok && gotMap[key] != nil {
+					metadata[key] = map[string]interface{}{}
+				}
+			}
+			want = metadata
+		}
+		var changes []string
+		for _, key := range sortedKeys(want) {
+			if _, ok := gotMap[key]; !ok {
+				changes = append(changes, fmt.Sprintf("%s: removed", join(path, key)))
+				continue
+			}
+			changes = append(changes, admissionChanges(join(path, key), want[key], gotMap[key])...)
+		}
+		if strings.HasSuffix(path, "metadata.labels") || strings.HasSuffix(path, "metadata.annotations") {
+			for _, key := range sortedKeys(gotMap) {
+				if _, ok := want[key]; !ok {
+					changes = append(changes, fmt.Sprintf("%s: added %s=%s", path, key, valueText(gotMap[key])))
+				}
+			}
+		}
+		return changes
+	case []interface{}:
+		gotList, ok := got.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: %s -> %s", path, valueText(want), valueText(got))}
+		}
+		wantNamed, gotNamed := byName(want), byName(gotList)
+		if wantNamed != nil && gotNamed != nil {
+			var changes []string
+			for _, item := range want {
+				name := item.(map[string]interface{})["name"].(string)
+				if g, ok := gotNamed[name]; ok {
+					changes = append(changes, admissionChanges(fmt.Sprintf("%s[%s]", path, name), item, g)...)
+				} else {
+					changes = append(changes, fmt.Sprintf("%s: removed %s", path, name))
+				}
+			}
+			for _, item := range gotList {
+				if name := item.(map[string]interface{})["name"].(string); wantNamed[name] == nil {
+					changes = append(changes, fmt.Sprintf("%s: added %s", path, name))
+				}
+			}
+			return changes
+		}
+		if len(want) != len(gotList) {
+			return []string{fmt.Sprintf("%s: %s -> %s", path, valueText(want), valueText(got))}
+		}
+		var changes []string
+		for i := range want {
+			changes = append(changes, admissionChanges(fmt.Sprintf("%s[%d]", path, i), want[i], gotList[i])...)
+		}
+		return changes
+	default:
+		if sameValue(want, got) {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s: %s -> %s", path, valueText(want), valueText(got))}
+	}
+}
+
+// byName indexes a list of objects by their name, nil when an item has none
+func byName(items []interface{}) map[string]interface{} {
+	named := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		name, ok := m["name"].(string)
+		if !ok {
+			return nil
+		}
+		named[name] = m
+	}
+	return named
+}
+
+// sameValue compares scalars of the manifest and the API server, which
+// decode numbers differently and may write quantities canonically
+func sameValue(a, b interface{}) bool {
+	if fmt.Sprint(a) == fmt.Sprint(b) {
+		return true
+	}
+	x, okA := a.(string)
+	y, okB := b.(string)
+	if !okA || !okB {
+		return false
+	}
+	qx, errX := resource.ParseQuantity(x)
+	qy, errY := resource.ParseQuantity(y)
+	return errX == nil && errY == nil && qx.Cmp(qy) == 0
+}
+
+// valueText formats a value for a change line
+func valueText(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return utils.TruncateString(string(data), 60)
+}
+
+// join appends a key to a field path
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readManifests decodes every object of the given files and directories
+func readManifests(paths []string) ([]manifest, error) {
+	var manifests []manifest
+	read := func(name string, r io.Reader) error {
+		decoder := yamlutil.NewYAMLOrJSONDecoder(r, 4096)
+		for document := 1; ; document++ {
+			var obj map[string]interface{}
+			err := decoder.Decode(&obj)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return clierr.Usagef("%s: document %d: %v", name, document, err)
+			}
+			// Empty documents between separators
+			if len(obj) == 0 {
+				continue
+			}
+			u := &unstructured.Unstructured{Object: obj}
+			if u.IsList() {
+				list, err := u.ToList()
+				if err != nil {
+					return clierr.Usagef("%s: document %d: %v", name, document, err)
+				}
+				for i := range list.Items {
+					manifests = append(manifests, manifest{file: name, document: document, obj: &list.Items[i]})
+				}
+				continue
+			}
+			manifests = append(manifests, manifest{file: name, document: document, obj: u})
+		}
+	}
+
+	for _, path := range paths {
+		if path == "-" {
+			if err := read("<stdin>", os.Stdin); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			// Files named explicitly are read whatever their extension
+			switch strings.ToLower(filepath.Ext(file)) {
+			case ".yaml", ".yml", ".json":
+			default:
+				if file != path {
+					return nil
+				}
+			}
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return read(file, f)
+		})
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, clierr.Newf(clierr.NotFound, "%s does not exist", path)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(manifests) == 0 {
+		return nil, clierr.Usagef("no objects found in %s", strings.Join(paths, ", "))
+	}
+	return manifests, nil
+}
+
+// init initializes flags for kube-webhooks command
+func init() {
+	webhooksRootCmd.PersistentFlags().StringVarP(&webhooksKubeContext, "context", "c", "", "Kubernetes context to use")
+	webhooksRootCmd.Flags().BoolVar(&webhooksCheck, "check", true, "Check that the backend of every webhook answers")
+	webhooksRootCmd.Flags().DurationVar(&webhooksTimeout, "timeout", 5*time.Second, "Maximum time to check one backend")
+	webhooksTable.AddFlags(webhooksRootCmd)
+	testWebhooksCmd.Flags().StringVarP(&webhooksNamespace, "namespace", "n", "", "Namespace for objects without one")
+	webhooksRootCmd.AddCommand(testWebhooksCmd)
+
+	viper.BindPFlag("context", webhooksRootCmd.PersistentFlags().Lookup("context"))
+}
+
+// main is the entry point of kube-webhooks
+func main() {
+	k8s.AddVerbosityFlag(webhooksRootCmd)
+	k8s.AddRateLimitFlags(webhooksRootCmd)
+	config.SetupDefaults(webhooksRootCmd)
+	clierr.SetupUsage(webhooksRootCmd)
+	cmd, err := webhooksRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
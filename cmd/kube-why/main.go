@@ -0,0 +1,579 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/kubernetes/podstatus"
+	"kube/pkg/kubernetes/scheduling"
+	"kube/pkg/kubernetes/target"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/table"
+	"kube/pkg/shared/tracing"
+	"kube/pkg/shared/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	whyNamespace   string
+	whyKubeContext string
+)
+
+// maxListedNodes is how many node names are shown for a check
+const maxListedNodes = 5
+
+// availableRe matches the scheduler message "0/12 nodes are available: ..."
+var availableRe = regexp.MustCompile(`^(\d+)/(\d+) nodes are available: (.*)$`)
+
+// countedRe splits "9 Insufficient cpu" into the node count and the reason
+var countedRe = regexp.MustCompile(`^(\d+) (.*)$`)
+
+// reasonSummaries map scheduler reasons to short summaries
+var reasonSummaries = []struct {
+	contains string
+	summary  string
+}{
+	{"untolerated taint", "taint mismatch"},
+	{"didn't match Pod's node affinity/selector", "node affinity/selector mismatch"},
+	{"didn't match pod affinity rules", "pod affinity not satisfied"},
+	{"didn't match pod anti-affinity rules", "pod anti-affinity conflict"},
+	{"didn't satisfy existing pods anti-affinity rules", "anti-affinity of existing pods"},
+	{"didn't match pod topology spread constraints", "topology spread constraints"},
+	{"volume node affinity conflict", "volume node affinity conflict"},
+	{"didn't find available persistent volumes to bind", "no persistent volume to bind"},
+	{"unbound immediate PersistentVolumeClaims", "unbound PersistentVolumeClaims"},
+	{"were unschedulable", "node cordoned"},
+	{"Too many pods", "node pod limit reached"},
+	{"didn't have free ports", "host port in use"},
+	{"exceed max volume count", "volume attach limit reached"},
+}
+
+// schedulingReason is one reason of a FailedScheduling message
+type schedulingReason struct {
+	summary string
+	nodes   int
+	details []string
+}
+
+// whyRootCmd represents the kube-why command
+var whyRootCmd = &cobra.Command{
+	Use:   "kube-why <pod>",
+	Short: "Explain why a pod is not scheduling",
+	Long: `kube-why explains why a Pending pod does not get a node.
+
+It replays the latest FailedScheduling event of the pod and sums up how many
+nodes were rejected for which reason (insufficient cpu: 12 nodes, taint
+mismatch: 3 nodes), then checks what the pod asks for itself:
+
+  Volumes           every PersistentVolumeClaim exists and is bound, or can
+                    be provisioned by its StorageClass
+  Node constraints  how many nodes match the nodeSelector, the required node
+                    affinity and the tolerations, and how many match all of them
+
+The pod name may be partial or a target expression like @latest:deploy/api.
+
+Examples:
+  kube-why api-7f9c4d5b6-xk2lp           # Explain a pending pod
+  kube-why api                           # Partial name
+  kube-why '@latest:deploy/api' -n prod  # Newest pod of a deployment`,
+	Args: cobra.ExactArgs(1),
+	RunE: runWhy,
+}
+
+// runWhy prints the scheduling diagnosis of the pod
+func runWhy(cmd *cobra.Command, args []string) error {
+	client, err := k8s.NewClient("", whyKubeContext)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	namespace := whyNamespace
+	if namespace == "" {
+		if namespace, err = k8s.GetCurrentNamespace(whyKubeContext); err != nil {
+			return fmt.Errorf("failed to get current namespace: %w", err)
+		}
+	}
+
+	ctx, stop := interrupt.Context(client.Context)
+	defer stop()
+
+	pod, err := target.ResolvePod(ctx, client.Clientset, namespace, args[0])
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	fmt.Printf("Pod:           %s/%s\n", pod.Namespace, pod.Name)
+	fmt.Printf("Status:        %s\n", podstatus.Reason(pod))
+	fmt.Printf("Age:           %s\n", utils.FormatAge(now.Sub(pod.CreationTimestamp.Time)))
+	if pod.Spec.NodeName != "" {
+		fmt.Printf("Node:          %s\n", pod.Spec.NodeName)
+		fmt.Println()
+		fmt.Println("The pod is scheduled. Use kube-logs or kube-events if it does not start.")
+		return nil
+	}
+	if pod.Spec.SchedulerName != "" && pod.Spec.SchedulerName != corev1.DefaultSchedulerName {
+		fmt.Printf("Scheduler:     %s\n", pod.Spec.SchedulerName)
+	}
+	fmt.Println()
+
+	if err := printSchedulingEvents(ctx, client, pod, now); err != nil {
+		return err
+	}
+	if err := printVolumes(ctx, client, pod); err != nil {
+		return err
+	}
+	if err := printNodeConstraints(ctx, client, pod); err != nil {
+		return err
+	}
+
+	return clierr.Newf(clierr.Generic, "pod %s is not scheduled", pod.Name)
+}
+
+// printSchedulingEvents summarizes the latest FailedScheduling event per reason
+func printSchedulingEvents(ctx context.Context, client *k8s.Client, pod *corev1.Pod, now time.Time) error {
+	selector := fields.Set{
+		"involvedObject.kind": "Pod",
+		"involvedObject.name": pod.Name,
+		"reason":              "FailedScheduling",
+	}.AsSelector()
+	events, err := client.Clientset.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{FieldSelector: selector.String()})
+	if err != nil {
+		return fmt.Errorf("failed to list events: %w", err)
+	}
+
+	var latest *corev1.Event
+	for i := range events.Items {
+		ev := &events.Items[i]
+		if ev.InvolvedObject.UID != "" && ev.InvolvedObject.UID != pod.UID {
+			continue
+		}
+		if latest == nil || lastSeen(ev).After(lastSeen(latest)) {
+			latest = ev
+		}
+	}
+
+	fmt.Println("Scheduler:")
+	if latest == nil {
+		fmt.Println("  No FailedScheduling events (events expire, by default after 1h).")
+		fmt.Println()
+		return nil
+	}
+
+	count := latest.Count
+	if latest.Series != nil {
+		count = latest.Series.Count
+	}
+	fmt.Printf("  %s, %d time(s), last %s ago\n", latest.Reason, count, utils.FormatAge(now.Sub(lastSeen(latest))))
+
+	total, reasons := parseSchedulingMessage(latest.Message)
+	if len(reasons) == 0 {
+		fmt.Printf("  %s\n", latest.Message)
+		fmt.Println()
+		return nil
+	}
+	headers := []string{"REASON", "NODES", "DETAIL"}
+	rows := make([][]string, 0, len(reasons))
+	for _, r := range reasons {
+		nodes := "-"
+		if r.nodes >= 0 {
+			nodes = fmt.Sprintf("%d/%d", r.nodes, total)
+		}
+		rows = append(rows, []string{r.summary, nodes, utils.TruncateString(strings.Join(r.details, "; "), 80)})
+	}
+	table.Render(headers, rows)
+	fmt.Println()
+	return nil
+}
+
+// lastSeen returns when the event was last observed
+func lastSeen(ev *corev1.Event) time.Time {
+	switch {
+	case ev.Series != nil && !ev.Series.LastObservedTime.IsZero():
+		return ev.Series.LastObservedTime.Time
+	case !ev.LastTimestamp.IsZero():
+		return ev.LastTimestamp.Time
+	case !ev.EventTime.IsZero():
+		return ev.EventTime.Time
+	}
+	return ev.CreationTimestamp.Time
+}
+
+// parseSchedulingMessage parses "0/12 nodes are available: 3 node(s) had
+// untolerated taint {...}, 9 Insufficient cpu. preemption: ..." into the
+// node total and the reasons, most nodes first. Reasons without a node
+// count, like unbound PersistentVolumeClaims, have nodes -1.
+func parseSchedulingMessage(message string) (int, []schedulingReason) {
+	message, _, _ = strings.Cut(message, " preemption:")
+	m := availableRe.FindStringSubmatch(strings.TrimSpace(message))
+	if m == nil {
+		return 0, nil
+	}
+	total, _ := strconv.Atoi(m[2])
+
+	var reasons []schedulingReason
+	index := map[string]int{}
+	for _, item := range splitReasons(strings.TrimSuffix(m[3], ".")) {
+		nodes := -1
+		text := item
+		if cm := countedRe.FindStringSubmatch(item); cm != nil {
+			nodes, _ = strconv.Atoi(cm[1])
+			text = cm[2]
+		}
+		summary := summarizeReason(text)
+		// Taints differ per node group, the taint itself is the useful detail
+		detail := strings.TrimPrefix(text, "node(s) had untolerated taint ")
+		if i, ok := index[summary]; ok {
+			reasons[i].nodes += nodes
+			reasons[i].details = append(reasons[i].details, detail)
+			continue
+		}
+		index[summary] = len(reasons)
+		reasons = append(reasons, schedulingReason{summary: summary, nodes: nodes, details: []string{detail}})
+	}
+	sort.SliceStable(reasons, func(i, j int) bool { return reasons[i].nodes > reasons[j].nodes })
+	return total, reasons
+}
+
+// splitReasons splits the reason list at commas outside of braces, since
+// taints are printed as {key: value}
+func splitReasons(s string) []string {
+	var items []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		items = append(items, rest)
+	}
+	return items
+}
+
+// summarizeReason returns the short summary of a scheduler reason
+func summarizeReason(text string) string {
+	if resource, ok := strings.CutPrefix(text, "Insufficient "); ok {
+		return "insufficient " + resource
+	}
+	for _, s := range reasonSummaries {
+		if strings.Contains(text, s.contains) {
+			return s.summary
+		}
+	}
+	return text
+}
+
+// printVolumes checks that the PersistentVolumeClaims of the pod exist and
+// are bound or can be provisioned
+func printVolumes(ctx context.Context, client *k8s.Client, pod *corev1.Pod) error {
+	const (
+		reset  = "\033[0m"
+		red    = "\033[31m"
+		green  = "\033[32m"
+		yellow = "\033[33m"
+	)
+	var claims []string
+	for _, vol := range pod.Spec.Volumes {
+		switch {
+		case vol.PersistentVolumeClaim != nil:
+			claims = append(claims, vol.PersistentVolumeClaim.ClaimName)
+		case vol.Ephemeral != nil:
+			claims = append(claims, pod.Name+"-"+vol.Name)
+		}
+	}
+	if len(claims) == 0 {
+		fmt.Println("Volumes:       no PersistentVolumeClaims")
+		fmt.Println()
+		return nil
+	}
+
+	headers := []string{"CLAIM", "STATUS", "STORAGECLASS", "DETAIL"}
+	rows := make([][]string, 0, len(claims))
+	for _, name := range claims {
+		pvc, err := client.Clientset.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			rows = append(rows, []string{name, red + "Missing" + reset, "-", "the claim does not exist"})
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get PersistentVolumeClaim %s: %w", name, err)
+		}
+
+		className, classLabel := "", "-"
+		if pvc.Spec.StorageClassName != nil {
+			className = *pvc.Spec.StorageClassName
+			classLabel = utils.OrDash(className)
+		} else if className, err = defaultStorageClass(ctx, client); err != nil {
+			return err
+		} else if className != "" {
+			classLabel = className + " (default)"
+		}
+		switch pvc.Status.Phase {
+		case corev1.ClaimBound:
+			rows = append(rows, []string{name, green + "Bound" + reset, classLabel, "volume " + pvc.Spec.VolumeName})
+		case corev1.ClaimLost:
+			rows = append(rows, []string{name, red + "Lost" + reset, classLabel, "volume " + pvc.Spec.VolumeName + " is gone"})
+		default:
+			waiting, detail, err := pendingClaim(ctx, client, pvc, className)
+			if err != nil {
+				return err
+			}
+			color := red
+			if waiting {
+				color = yellow
+			}
+			rows = append(rows, []string{name, color + string(pvc.Status.Phase) + reset, classLabel, utils.TruncateString(detail, 80)})
+		}
+	}
+	fmt.Println("Volumes:")
+	table.Render(headers, rows)
+	fmt.Println()
+	return nil
+}
+
+// pendingClaim explains a pending claim. waiting is true when the claim only
+// waits for the pod to be scheduled.
+func pendingClaim(ctx context.Context, client *k8s.Client, pvc *corev1.PersistentVolumeClaim, className string) (waiting bool, detail string, err error) {
+	if className == "" && pvc.Spec.StorageClassName == nil {
+		return false, "no storageClassName and no default StorageClass", nil
+	}
+	if className == "" {
+		return false, "storageClassName is empty, a matching PersistentVolume must be created by hand", nil
+	}
+
+	sc, err := client.Clientset.StorageV1().StorageClasses().Get(ctx, className, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, fmt.Sprintf("StorageClass %s does not exist", className), nil
+	}
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get StorageClass %s: %w", className, err)
+	}
+
+	if msg := latestWarning(ctx, client, pvc); msg != "" {
+		return false, msg, nil
+	}
+	if sc.VolumeBindingMode != nil && *sc.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer {
+		return true, "WaitForFirstConsumer, provisioned once the pod has a node", nil
+	}
+	return false, fmt.Sprintf("not provisioned yet by %s", sc.Provisioner), nil
+}
+
+// defaultStorageClass returns the name of the default StorageClass, or ""
+func defaultStorageClass(ctx context.Context, client *k8s.Client) (string, error) {
+	classes, err := client.Clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list storage classes: %w", err)
+	}
+	for _, sc := range classes.Items {
+		if sc.Annotations["storageclass.kubernetes.io/is-default-class"] == "true" {
+			return sc.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// latestWarning returns the message of the latest warning event of the
+// claim, e.g. ProvisioningFailed
+func latestWarning(ctx context.Context, client *k8s.Client, pvc *corev1.PersistentVolumeClaim) string {
+	selector := fields.Set{
+		"involvedObject.kind": "PersistentVolumeClaim",
+		"involvedObject.name": pvc.Name,
+		"type":                corev1.EventTypeWarning,
+	}.AsSelector()
+	events, err := client.Clientset.CoreV1().Events(pvc.Namespace).List(ctx, metav1.ListOptions{FieldSelector: selector.String()})
+	if err != nil {
+		return ""
+	}
+	var latest *corev1.Event
+	for i := range events.Items {
+		if latest == nil || lastSeen(&events.Items[i]).After(lastSeen(latest)) {
+			latest = &events.Items[i]
+		}
+	}
+	if latest == nil {
+		return ""
+	}
+	return latest.Reason + ": " + latest.Message
+}
+
+// printNodeConstraints counts the nodes that pass the nodeSelector, the
+// required node affinity, the tolerations and cordons
+func printNodeConstraints(ctx context.Context, client *k8s.Client, pod *corev1.Pod) error {
+	nodes, err := client.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	var required *corev1.NodeSelector
+	if affinity := pod.Spec.Affinity; affinity != nil && affinity.NodeAffinity != nil {
+		required = affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	}
+
+	var selectorOK, affinityOK, taintsOK, schedulableOK int
+	var fitting []string
+	untolerated := map[string]int{}
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		matchSelector := labels.SelectorFromSet(pod.Spec.NodeSelector).Matches(labels.Set(node.Labels))
+		matchAffinity := required == nil || scheduling.MatchNodeSelector(required, node)
+		taint := scheduling.UntoleratedTaint(pod, node)
+		schedulable := !node.Spec.Unschedulable
+
+		if matchSelector {
+			selectorOK++
+		}
+		if matchAffinity {
+			affinityOK++
+		}
+		if taint == nil {
+			taintsOK++
+		} else {
+			untolerated[taint.ToString()]++
+		}
+		if schedulable {
+			schedulableOK++
+		}
+		if matchSelector && matchAffinity && taint == nil && schedulable {
+			fitting = append(fitting, node.Name)
+		}
+	}
+
+	total := len(nodes.Items)
+	headers := []string{"CHECK", "NODES", "DETAIL"}
+	var rows [][]string
+	selectorDetail := "none"
+	if len(pod.Spec.NodeSelector) > 0 {
+		selectorDetail = labels.SelectorFromSet(pod.Spec.NodeSelector).String()
+	}
+	rows = append(rows, []string{"nodeSelector", countCell(selectorOK, total), selectorDetail})
+	affinityDetail := "none"
+	if required != nil {
+		affinityDetail = fmt.Sprintf("%d term(s), any must match", len(required.NodeSelectorTerms))
+	}
+	rows = append(rows, []string{"required node affinity", countCell(affinityOK, total), affinityDetail})
+	rows = append(rows, []string{"tolerations", countCell(taintsOK, total), taintsDetail(untolerated)})
+	rows = append(rows, []string{"not cordoned", countCell(schedulableOK, total), ""})
+	rows = append(rows, []string{"all of the above", countCell(len(fitting), total), listNodes(fitting)})
+
+	fmt.Println("Node constraints:")
+	table.Render(headers, rows)
+
+	// Pod (anti-)affinity and spread depend on other pods; the events cover them
+	var notes []string
+	if affinity := pod.Spec.Affinity; affinity != nil {
+		if affinity.PodAffinity != nil && len(affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution) > 0 {
+			notes = append(notes, "required pod affinity")
+		}
+		if affinity.PodAntiAffinity != nil && len(affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution) > 0 {
+			notes = append(notes, "required pod anti-affinity")
+		}
+	}
+	for _, c := range pod.Spec.TopologySpreadConstraints {
+		if c.WhenUnsatisfiable == corev1.DoNotSchedule {
+			notes = append(notes, fmt.Sprintf("topology spread on %s (maxSkew %d)", c.TopologyKey, c.MaxSkew))
+		}
+	}
+	if len(notes) > 0 {
+		fmt.Printf("Not checked here since they depend on other pods (see the scheduler reasons): %s\n", strings.Join(notes, ", "))
+	}
+	fmt.Println()
+	return nil
+}
+
+// taintsDetail lists the most common untolerated taints
+func taintsDetail(untolerated map[string]int) string {
+	if len(untolerated) == 0 {
+		return ""
+	}
+	taints := make([]string, 0, len(untolerated))
+	for taint := range untolerated {
+		taints = append(taints, taint)
+	}
+	sort.Slice(taints, func(i, j int) bool {
+		if untolerated[taints[i]] != untolerated[taints[j]] {
+			return untolerated[taints[i]] > untolerated[taints[j]]
+		}
+		return taints[i] < taints[j]
+	})
+	parts := make([]string, 0, 3)
+	for _, taint := range taints {
+		if len(parts) == 3 {
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s (%d)", taint, untolerated[taint]))
+	}
+	return "untolerated: " + strings.Join(parts, ", ")
+}
+
+// countCell formats matching/total nodes, red when none match
+func countCell(n, total int) string {
+	const (
+		reset = "\033[0m"
+		red   = "\033[31m"
+	)
+	if n == 0 {
+		return fmt.Sprintf("%s%d/%d%s", red, n, total, reset)
+	}
+	return fmt.Sprintf("%d/%d", n, total)
+}
+
+// listNodes joins the first node names
+func listNodes(names []string) string {
+	if len(names) <= maxListedNodes {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:maxListedNodes], ", "), len(names)-maxListedNodes)
+}
+
+// init initializes flags for kube-why command
+func init() {
+	whyRootCmd.Flags().StringVarP(&whyNamespace, "namespace", "n", "", "Kubernetes namespace to use")
+	whyRootCmd.Flags().StringVarP(&whyKubeContext, "context", "c", "", "Kubernetes context to use")
+
+	viper.BindPFlag("namespace", whyRootCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("context", whyRootCmd.Flags().Lookup("context"))
+}
+
+// main is the entry point of kube-why
+func main() {
+	k8s.AddVerbosityFlag(whyRootCmd)
+	k8s.AddRateLimitFlags(whyRootCmd)
+	k8s.AddFromDirFlag(whyRootCmd)
+	config.SetupDefaults(whyRootCmd)
+	clierr.SetupUsage(whyRootCmd)
+	cmd, err := whyRootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	interrupt.ExitIfReceived(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(clierr.ExitCode(err))
+	}
+}
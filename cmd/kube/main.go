@@ -5,11 +5,12 @@ import (
 	"os"
 
 	"kube/cmd"
+	"kube/pkg/shared/clierr"
 )
 
 func main() {
 	if err := cmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(clierr.ExitCode(err))
 	}
 }
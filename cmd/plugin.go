@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/tracing"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// pluginPrefix is the executable name prefix of kube plugins
+	pluginPrefix = "kube-"
+	// pluginAnnotation marks subcommands registered for plugins
+	pluginAnnotation = "kube/plugin"
+)
+
+// plugin is a kube-<name> executable found on PATH
+type plugin struct {
+	name string
+	path string
+	// shadowed lists executables with the same name later on PATH
+	shadowed []string
+}
+
+// pluginCmd represents the kube plugin command
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Inspect kube plugins",
+	Long: `Any executable called kube-<name> on PATH that is not one of the built-in tools
+is a plugin and can be run as 'kube <name> [args...]'. Arguments are passed
+through unchanged and the plugin gets the current context and namespace in
+KUBE_CONTEXT and KUBE_NAMESPACE, next to the usual KUBECONFIG.
+
+When several directories on PATH contain the same plugin, the first one wins.
+Plugins cannot override built-in tools or kube subcommands.
+
+Examples:
+  kube plugin list     # Show discovered plugins and conflicts
+  kube cost -A         # Runs kube-cost -A`,
+	Annotations: map[string]string{history.SkipAnnotation: "true"},
+}
+
+// pluginListCmd represents the kube plugin list command
+var pluginListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List plugins found on PATH",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{history.SkipAnnotation: "true"},
+	RunE:        runPluginList,
+}
+
+// runPluginList prints discovered plugins with shadowing and conflict warnings
+func runPluginList(cmd *cobra.Command, args []string) error {
+	plugins := discoverPlugins(cmd.Root())
+	if len(plugins) == 0 {
+		fmt.Println("No plugins found on PATH")
+		return nil
+	}
+
+	fmt.Println("Plugins:")
+	for _, p := range plugins {
+		fmt.Printf("  %-20s %s\n", p.name, p.path)
+		for _, path := range p.shadowed {
+			fmt.Printf("  %-20s   warning: %s is shadowed by %s\n", "", path, p.path)
+		}
+	}
+
+	if ignored := ignoredPlugins(cmd.Root()); len(ignored) > 0 {
+		fmt.Println()
+		fmt.Println("Ignored (same name as a kube subcommand):")
+		for _, path := range ignored {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+	return nil
+}
+
+// registerPlugins adds a pass-through subcommand for every discovered plugin
+func registerPlugins(root *cobra.Command) {
+	for _, p := range discoverPlugins(root) {
+		p := p
+		root.AddCommand(&cobra.Command{
+			Use:                p.name,
+			Short:              "Plugin " + p.path,
+			DisableFlagParsing: true,
+			// The plugin records its own history if it wants to
+			Annotations: map[string]string{history.SkipAnnotation: "true", pluginAnnotation: p.path},
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runPlugin(cmd, p, args)
+			},
+		})
+	}
+}
+
+// runPlugin runs the plugin with args and exits with its exit code
+func runPlugin(cmd *cobra.Command, p plugin, args []string) error {
+	child := exec.Command(p.path, args...)
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	child.Env = os.Environ()
+	if config, err := k8s.LoadRawConfig(); err == nil && config.CurrentContext != "" {
+		namespace, _ := k8s.GetCurrentNamespace(config.CurrentContext)
+		child.Env = append(child.Env,
+			"KUBE_CONTEXT="+config.CurrentContext,
+			"KUBE_NAMESPACE="+namespace,
+		)
+	}
+
+	_, span := tracing.Start(context.Background(), "plugin "+p.name, map[string]interface{}{
+		"plugin.path": p.path,
+	})
+	if span != nil {
+		child.Env = append(child.Env, "TRACEPARENT="+span.TraceParent())
+	}
+
+	if err := child.Start(); err != nil {
+		span.End(err)
+		return fmt.Errorf("failed to start plugin %s: %w", p.path, err)
+	}
+
+	// Ctrl+C reaches the plugin through the terminal; forward SIGTERM explicitly
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signalCh)
+	go func() {
+		for sig := range signalCh {
+			if sig == syscall.SIGTERM {
+				child.Process.Signal(sig)
+			}
+		}
+	}()
+
+	err := child.Wait()
+	span.End(err)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// The plugin reported its own error, only pass on the exit code
+			code := exitErr.ExitCode()
+			if code < 0 {
+				code = 1
+			}
+			tracing.Finish(cmd, err)
+			os.Exit(code)
+		}
+		return fmt.Errorf("failed to run plugin %s: %w", p.path, err)
+	}
+	return nil
+}
+
+// discoverPlugins returns kube-* executables on PATH that are neither built-in
+// tools nor named like a kube subcommand, sorted by name
+func discoverPlugins(root *cobra.Command) []plugin {
+	var plugins []plugin
+	for _, p := range scanPath() {
+		if !reservedPluginName(root, p.name) {
+			plugins = append(plugins, p)
+		}
+	}
+	return plugins
+}
+
+// ignoredPlugins returns paths of plugins that clash with kube subcommands
+func ignoredPlugins(root *cobra.Command) []string {
+	var ignored []string
+	for _, p := range scanPath() {
+		if reservedPluginName(root, p.name) && !isBuiltinTool(p.name) {
+			ignored = append(ignored, p.path)
+		}
+	}
+	return ignored
+}
+
+// scanPath finds all kube-* executables on PATH; the first one of a name wins
+func scanPath() []plugin {
+	byName := map[string]*plugin{}
+	var names []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), pluginPrefix) || len(entry.Name()) == len(pluginPrefix) {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if !isExecutable(path) {
+				continue
+			}
+
+			name := strings.TrimPrefix(entry.Name(), pluginPrefix)
+			if existing, ok := byName[name]; ok {
+				if existing.path != path {
+					existing.shadowed = append(existing.shadowed, path)
+				}
+				continue
+			}
+			byName[name] = &plugin{name: name, path: path}
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	plugins := make([]plugin, 0, len(names))
+	for _, name := range names {
+		plugins = append(plugins, *byName[name])
+	}
+	return plugins
+}
+
+// reservedPluginName reports whether kube-<name> is a built-in tool or <name>
+// is already a kube subcommand
+func reservedPluginName(root *cobra.Command, name string) bool {
+	if isBuiltinTool(name) {
+		return true
+	}
+	switch name {
+	case "help", "completion":
+		return true
+	}
+	for _, cmd := range root.Commands() {
+		if cmd.Annotations[pluginAnnotation] != "" {
+			continue
+		}
+		if cmd.Name() == name || cmd.HasAlias(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBuiltinTool reports whether kube-<name> ships with kube
+func isBuiltinTool(name string) bool {
+	for _, tool := range builtinTools {
+		if tool.name == pluginPrefix+name {
+			return true
+		}
+	}
+	return false
+}
+
+// isExecutable reports whether path is a regular file with an execute bit
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0o111 != 0
+}
+
+// init registers the plugin command
+func init() {
+	pluginCmd.AddCommand(pluginListCmd)
+	rootCmd.AddCommand(pluginCmd)
+}
@@ -0,0 +1,306 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/history"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// defaultPromptFormat is the prompt shown without --format
+const defaultPromptFormat = "{blue}⎈ {context}{reset}:{cyan}{namespace}{reset}"
+
+// promptColors are the ANSI codes of the color placeholders of --format
+var promptColors = map[string]string{
+	"red":     "\033[31m",
+	"green":   "\033[32m",
+	"yellow":  "\033[33m",
+	"blue":    "\033[34m",
+	"magenta": "\033[35m",
+	"cyan":    "\033[36m",
+	"gray":    "\033[90m",
+	"bold":    "\033[1m",
+	"reset":   "\033[0m",
+}
+
+// tmuxColors are the tmux style equivalents of promptColors
+var tmuxColors = map[string]string{
+	"red":     "#[fg=red]",
+	"green":   "#[fg=green]",
+	"yellow":  "#[fg=yellow]",
+	"blue":    "#[fg=blue]",
+	"magenta": "#[fg=magenta]",
+	"cyan":    "#[fg=cyan]",
+	"gray":    "#[fg=brightblack]",
+	"bold":    "#[bold]",
+	"reset":   "#[default]",
+}
+
+// promptCmd represents the kube prompt command
+var promptCmd = &cobra.Command{
+	Use:   "prompt",
+	Short: "Print the current context and namespace for shell prompts",
+	Long: `prompt prints the current context and namespace of the kubeconfig used by the
+kube-* tools, for PS1, starship or tmux status lines. It prints nothing when no
+context is selected.
+
+The parsed kubeconfig is cached in $XDG_CACHE_HOME/kube-cmd/prompt.json (default
+~/.cache) and only parsed again when the file changes, so the prompt stays fast
+with large kubeconfigs. kube-switch-context and kube-switch-namespace change the
+file, so the prompt follows them right away.
+
+--format takes the placeholders {context}, {namespace}, {cluster} and {user},
+and the colors {red}, {green}, {yellow}, {blue}, {magenta}, {cyan}, {gray},
+{bold} and {reset}. --shell wraps colors the way the shell needs them, so line
+editing does not get confused by their width. Colors are left out with
+--no-color or when NO_COLOR is set.
+
+Setup:
+  bash:     PS1='$(kube prompt --shell bash) \w \$ '
+  zsh:      setopt PROMPT_SUBST; PROMPT='$(kube prompt --shell zsh) %~ %# '
+  starship: [custom.kube] command = "kube prompt"  when = true
+  tmux:     set -g status-right '#(kube prompt --shell tmux --watch)'
+
+Examples:
+  kube prompt                                   # ⎈ prod-eu:payments
+  kube prompt --format '{context}/{namespace}'  # prod-eu/payments
+  kube prompt --context-color 'prod*=red'       # Highlight production contexts
+  kube prompt --watch                           # Print a line on every change`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{history.SkipAnnotation: "true", quietConfigAnnotation: "true"},
+	RunE:        runPrompt,
+}
+
+// promptInfo is the part of a kubeconfig shown by the prompt, cached along
+// with the size and modification time of the file it was read from
+type promptInfo struct {
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"modTime"`
+	Context   string    `json:"context,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Cluster   string    `json:"cluster,omitempty"`
+	User      string    `json:"user,omitempty"`
+}
+
+// contextColor colors the contexts matching a shell pattern
+type contextColor struct {
+	pattern string
+	color   string
+}
+
+// runPrompt prints the prompt once, or on every change with --watch
+func runPrompt(cmd *cobra.Command, args []string) error {
+	format, _ := cmd.Flags().GetString("format")
+	shell, _ := cmd.Flags().GetString("shell")
+	noColor, _ := cmd.Flags().GetBool("no-color")
+	watch, _ := cmd.Flags().GetBool("watch")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	colorRules, _ := cmd.Flags().GetStringArray("context-color")
+
+	switch shell {
+	case "none", "bash", "zsh", "tmux":
+	default:
+		return clierr.Usagef("invalid --shell %q, expected none, bash, zsh or tmux", shell)
+	}
+	if interval <= 0 {
+		return clierr.Usagef("--interval must be positive")
+	}
+	var rules []contextColor
+	for _, rule := range colorRules {
+		pattern, color, ok := strings.Cut(rule, "=")
+		if _, known := promptColors[color]; !ok || !known {
+			return clierr.Usagef("invalid --context-color %q, expected pattern=color", rule)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return clierr.Usagef("invalid --context-color pattern %q: %v", pattern, err)
+		}
+		rules = append(rules, contextColor{pattern: pattern, color: color})
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		noColor = true
+	}
+
+	kubeconfig := k8s.KubeconfigPath()
+	if !watch {
+		info, err := loadPromptInfo(kubeconfig)
+		if err != nil {
+			return err
+		}
+		if line := renderPrompt(info, format, shell, noColor, rules); line != "" {
+			fmt.Println(line)
+		}
+		return nil
+	}
+
+	// tmux keeps showing the last line, so only print changes
+	last := "\x00"
+	for {
+		// A kubeconfig caught while being rewritten is read again next time
+		info, err := loadPromptInfo(kubeconfig)
+		if line := renderPrompt(info, format, shell, noColor, rules); err == nil && line != last {
+			fmt.Println(line)
+			last = line
+		}
+		time.Sleep(interval)
+	}
+}
+
+// loadPromptInfo returns the current context of the kubeconfig, from the
+// cache when the file did not change since it was parsed
+func loadPromptInfo(kubeconfig string) (promptInfo, error) {
+	stat, err := os.Stat(kubeconfig)
+	if os.IsNotExist(err) {
+		return promptInfo{}, nil
+	}
+	if err != nil {
+		return promptInfo{}, err
+	}
+
+	cache := readPromptCache()
+	if info, ok := cache[kubeconfig]; ok && info.Size == stat.Size() && info.ModTime.Equal(stat.ModTime()) {
+		return info, nil
+	}
+
+	config, err := clientcmd.LoadFromFile(kubeconfig)
+	if err != nil {
+		return promptInfo{}, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	info := promptInfo{Size: stat.Size(), ModTime: stat.ModTime(), Context: config.CurrentContext}
+	if ctx, ok := config.Contexts[config.CurrentContext]; ok && ctx != nil {
+		info.Namespace = ctx.Namespace
+		info.Cluster = ctx.Cluster
+		info.User = ctx.AuthInfo
+	}
+	if info.Context != "" && info.Namespace == "" {
+		info.Namespace = "default"
+	}
+
+	// A failing cache only costs the next prompt a parse
+	cache[kubeconfig] = info
+	writePromptCache(cache)
+	return info, nil
+}
+
+// renderPrompt fills the placeholders of format for a shell. It returns ""
+// when no context is selected, so prompts do not show an empty marker.
+func renderPrompt(info promptInfo, format, shell string, noColor bool, rules []contextColor) string {
+	if info.Context == "" {
+		return ""
+	}
+
+	color := func(name string) string {
+		if noColor {
+			return ""
+		}
+		switch shell {
+		case "bash":
+			// Readline's markers for invisible characters, \[ and \] only work
+			// in PS1 itself, not in the output of a command substitution
+			return "\001" + promptColors[name] + "\002"
+		case "zsh":
+			return "%{" + promptColors[name] + "%}"
+		case "tmux":
+			return tmuxColors[name]
+		}
+		return promptColors[name]
+	}
+	text := func(s string) string {
+		switch shell {
+		case "zsh":
+			return strings.ReplaceAll(s, "%", "%%")
+		case "tmux":
+			return strings.ReplaceAll(s, "#", "##")
+		}
+		return s
+	}
+
+	contextText := text(info.Context)
+	for _, rule := range rules {
+		if ok, _ := path.Match(rule.pattern, info.Context); ok {
+			contextText = color(rule.color) + contextText + color("reset")
+			break
+		}
+	}
+
+	replacements := []string{
+		"{context}", contextText,
+		"{namespace}", text(info.Namespace),
+		"{cluster}", text(info.Cluster),
+		"{user}", text(info.User),
+	}
+	for name := range promptColors {
+		replacements = append(replacements, "{"+name+"}", color(name))
+	}
+	return strings.NewReplacer(replacements...).Replace(format)
+}
+
+// promptCachePath returns location of the prompt cache.
+// Uses $XDG_CACHE_HOME/kube-cmd/prompt.json (default ~/.cache).
+func promptCachePath() string {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(dir, "kube-cmd", "prompt.json")
+}
+
+// readPromptCache returns the cached prompts by kubeconfig path
+func readPromptCache() map[string]promptInfo {
+	cache := map[string]promptInfo{}
+	if data, err := os.ReadFile(promptCachePath()); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+// writePromptCache stores the cache, replacing the file at once so
+// concurrent prompts of other shells never read half of it
+func writePromptCache(cache map[string]promptInfo) {
+	file := promptCachePath()
+	if file == "" {
+		return
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".prompt-*.json")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || os.Rename(tmp.Name(), file) != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// init registers the prompt subcommand
+func init() {
+	promptCmd.Flags().String("format", defaultPromptFormat, "Prompt format with {context}, {namespace}, {cluster}, {user} and color placeholders")
+	promptCmd.Flags().String("shell", "none", "Wrap colors for the shell: none, bash, zsh or tmux")
+	promptCmd.Flags().Bool("no-color", false, "Leave out colors")
+	promptCmd.Flags().StringArray("context-color", nil, "Color contexts matching a shell pattern, e.g. 'prod*=red' (repeatable)")
+	promptCmd.Flags().Bool("watch", false, "Keep running and print a line whenever the context or namespace changes")
+	promptCmd.Flags().Duration("interval", time.Second, "How often --watch checks the kubeconfig")
+	rootCmd.AddCommand(promptCmd)
+}
@@ -5,12 +5,21 @@ import (
 	"os"
 	"os/exec"
 
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/config"
+	"kube/pkg/shared/history"
+	"kube/pkg/shared/tracing"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var cfgFile string
 
+// quietConfigAnnotation marks commands that must not print which config file
+// is used, like prompt whose output ends up in the shell prompt
+const quietConfigAnnotation = "kube/quiet-config"
+
 // rootCmd is the base command when called without subcommands
 var rootCmd = &cobra.Command{
 	Use:   "kube",
@@ -27,6 +36,41 @@ Available tools:
   kube-exec              Execute commands in pods
   kube-deploy            Update Deployment image and wait for rollout
   kube-rollout           Restart or show rollout status for a Deployment
+  kube-ctx-exec          Run commands against a context
+  kube-unstick           Remove finalizers blocking deletion
+  kube-sniff             Capture pod traffic with tcpdump
+  kube-sts               Manage StatefulSets
+  kube-ds                Inspect DaemonSets and node coverage
+  kube-namespaces        List namespaces with resource footprint
+  kube-clean             Delete finished pods, completed Jobs and stale ReplicaSets
+  kube-resources         Audit CPU/memory requests and limits of workloads
+  kube-events            List events, optionally grouped and filtered
+  kube-auth              Show the current identity and its permissions
+  kube-proxy             Local authenticated API server proxy
+  kube-describe          Describe resources for triage
+  kube-trace             Trace Ingress to container port
+  kube-why               Explain why a pod is not scheduling
+  kube-bench-api         Measure API server latency and error rates
+  kube-export            Export resources to YAML files
+  kube-lint              Validate manifests against the cluster and best practices
+  kube-security          Grade the security posture of pods
+  kube-sa                List ServiceAccounts and mint tokens
+  kube-ctx-sync          Sync kubeconfig contexts from cloud providers
+  kube-gateway           List Gateway API Gateways, GatewayClasses and HTTPRoutes
+  kube-vol               Browse the content of PersistentVolumeClaims
+  kube-curl              Send an HTTP request to a pod or service
+  kube-webhooks          List admission webhooks and check their backends
+  kube-topology          Show how workloads are spread across zones and node pools
+  kube-preflight         Check the active context end to end
+  kube-notify            Send change events of a resource to a webhook or command
+  kube-leases            Show leader election leases and who holds them
+  kube-drain             Plan node drains before touching anything
+
+Use 'kube history' to review and re-run previously executed commands, and
+'kube prompt' to show the current context and namespace in your shell prompt.
+
+Other kube-<name> executables on PATH are plugins and run as 'kube <name>',
+see 'kube plugin --help'.
 
 Use tools individually, or install all with 'make install-all'.`,
 	RunE: listTools,
@@ -35,12 +79,19 @@ Use tools individually, or install all with 'make install-all'.`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() error {
-	return rootCmd.Execute()
+	registerPlugins(rootCmd)
+	clierr.SetupUsage(rootCmd)
+	cmd, err := rootCmd.ExecuteC()
+	history.RecordCommand(cmd, err)
+	tracing.Finish(cmd, err)
+	return err
 }
 
 // init initializes configuration for the root command
 func init() {
-	cobra.OnInitialize(initConfig)
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		initConfig(cmd)
+	}
 
 	// Define flags and configuration settings
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.kube.yaml)")
@@ -53,57 +104,71 @@ func init() {
 }
 
 // initConfig reads config file and environment variables if set
-func initConfig() {
-	if cfgFile != "" {
-		// Use config file from flag
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory
-		home, err := os.UserHomeDir()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error getting home directory: %v\n", err)
-			os.Exit(1)
-		}
-
-		// Look for config in home directory with name ".kube" (no extension)
-		viper.AddConfigPath(home)
-		viper.SetConfigType("yaml")
-		viper.SetConfigName(".kube")
-	}
-
+func initConfig(cmd *cobra.Command) {
 	viper.AutomaticEnv() // read env variables
 
 	// If a config file is found, read it
-	if err := viper.ReadInConfig(); err == nil {
+	if err := config.Load(cfgFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else if viper.ConfigFileUsed() != "" && cmd.Annotations[quietConfigAnnotation] == "" {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
 
+// builtinTools are the kube-* tools shipped with kube
+var builtinTools = []struct {
+	name        string
+	description string
+}{
+	{"kube-pods", "List pods"},
+	{"kube-services", "List services"},
+	{"kube-switch-context", "Switch Kubernetes context"},
+	{"kube-switch-namespace", "Switch namespace"},
+	{"kube-logs", "Show pod logs"},
+	{"kube-port-forward", "Port forward to pods/services"},
+	{"kube-exec", "Execute commands in pods"},
+	{"kube-deploy", "Update image and wait for rollout"},
+	{"kube-rollout", "Restart or show rollout status"},
+	{"kube-ctx-exec", "Run commands against a context"},
+	{"kube-unstick", "Remove finalizers blocking deletion"},
+	{"kube-sniff", "Capture pod traffic with tcpdump"},
+	{"kube-sts", "Manage StatefulSets"},
+	{"kube-ds", "Inspect DaemonSets and node coverage"},
+	{"kube-namespaces", "List namespaces with resource footprint"},
+	{"kube-clean", "Delete finished pods, completed Jobs and stale ReplicaSets"},
+	{"kube-resources", "Audit CPU/memory requests and limits of workloads"},
+	{"kube-events", "List events, optionally grouped and filtered"},
+	{"kube-auth", "Show the current identity and its permissions"},
+	{"kube-proxy", "Local authenticated API server proxy"},
+	{"kube-describe", "Describe resources for triage"},
+	{"kube-trace", "Trace Ingress to container port"},
+	{"kube-why", "Explain why a pod is not scheduling"},
+	{"kube-bench-api", "Measure API server latency and error rates"},
+	{"kube-export", "Export resources to YAML files"},
+	{"kube-lint", "Validate manifests against the cluster and best practices"},
+	{"kube-security", "Grade the security posture of pods"},
+	{"kube-sa", "List ServiceAccounts and mint tokens"},
+	{"kube-ctx-sync", "Sync kubeconfig contexts from cloud providers"},
+	{"kube-gateway", "List Gateway API Gateways, GatewayClasses and HTTPRoutes"},
+	{"kube-vol", "Browse the content of PersistentVolumeClaims"},
+	{"kube-curl", "Send an HTTP request to a pod or service"},
+	{"kube-webhooks", "List admission webhooks and check their backends"},
+	{"kube-topology", "Show how workloads are spread across zones and node pools"},
+	{"kube-preflight", "Check the active context end to end"},
+	{"kube-notify", "Send change events of a resource to a webhook or command"},
+	{"kube-leases", "Show leader election leases and who holds them"},
+	{"kube-drain", "Plan node drains before touching anything"},
+}
+
 // listTools prints the list of available kube-* tools
 func listTools(cmd *cobra.Command, args []string) error {
-	// Supported tools
-	tools := []struct {
-		name        string
-		description string
-	}{
-		{"kube-pods", "List pods"},
-		{"kube-services", "List services"},
-		{"kube-switch-context", "Switch Kubernetes context"},
-		{"kube-switch-namespace", "Switch namespace"},
-		{"kube-logs", "Show pod logs"},
-		{"kube-port-forward", "Port forward to pods/services"},
-		{"kube-exec", "Execute commands in pods"},
-		{"kube-deploy", "Update image and wait for rollout"},
-		{"kube-rollout", "Restart or show rollout status"},
-	}
-
 	fmt.Println("Kubernetes CLI Helper Tools")
 	fmt.Println("===========================")
 	fmt.Println()
 
 	// Check which tools are installed
 	fmt.Println("Available tools:")
-	for _, tool := range tools {
+	for _, tool := range builtinTools {
 		status := "❌ Not installed"
 		if _, err := exec.LookPath(tool.name); err == nil {
 			status = "✅ Installed"
@@ -111,6 +176,14 @@ func listTools(cmd *cobra.Command, args []string) error {
 		fmt.Printf("  %-20s %s - %s\n", tool.name, status, tool.description)
 	}
 
+	if plugins := discoverPlugins(cmd.Root()); len(plugins) > 0 {
+		fmt.Println()
+		fmt.Println("Plugins (run as 'kube <name>'):")
+		for _, plugin := range plugins {
+			fmt.Printf("  %-20s %s\n", plugin.name, plugin.path)
+		}
+	}
+
 	fmt.Println()
 	fmt.Println("Installation:")
 	fmt.Println("  make install-all    # Install all tools")
@@ -124,6 +197,8 @@ func listTools(cmd *cobra.Command, args []string) error {
 	fmt.Println("  kube-logs my-pod -f                    # Follow logs")
 	fmt.Println("  kube-port-forward svc/my-svc 8080:80   # Port forward to service")
 	fmt.Println("  kube-exec my-pod -- bash               # Exec into pod")
+	fmt.Println("  kube history                           # Show recently run commands")
+	fmt.Println("  kube prompt --shell bash               # Context and namespace for PS1")
 
 	return nil
 }
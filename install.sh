@@ -195,7 +195,7 @@ install_tools() {
     cd "$SCRIPT_DIR"
     
     # List of tools
-    TOOLS=("kube" "kube-pods" "kube-services" "kube-switch-context" "kube-switch-namespace" "kube-logs" "kube-port-forward" "kube-exec" "kube-deploy" "kube-rollout")
+    TOOLS=("kube" "kube-pods" "kube-services" "kube-switch-context" "kube-switch-namespace" "kube-logs" "kube-port-forward" "kube-exec" "kube-deploy" "kube-rollout" "kube-ctx-exec" "kube-unstick" "kube-sniff" "kube-sts" "kube-ds" "kube-namespaces" "kube-clean" "kube-resources" "kube-events" "kube-auth" "kube-proxy" "kube-describe" "kube-trace" "kube-why" "kube-bench-api" "kube-export" "kube-lint" "kube-security" "kube-sa" "kube-ctx-sync" "kube-gateway" "kube-vol" "kube-curl" "kube-webhooks" "kube-topology" "kube-preflight" "kube-notify" "kube-leases" "kube-drain")
     
     for tool in "${TOOLS[@]}"; do
         if [[ ! -f "$tool" ]]; then
@@ -230,7 +230,7 @@ install_tools() {
 uninstall_tools() {
     log "Uninstalling kube tools from $INSTALL_DIR..."
     
-    TOOLS=("kube" "kube-pods" "kube-services" "kube-switch-context" "kube-switch-namespace" "kube-logs" "kube-port-forward" "kube-exec" "kube-deploy" "kube-rollout")
+    TOOLS=("kube" "kube-pods" "kube-services" "kube-switch-context" "kube-switch-namespace" "kube-logs" "kube-port-forward" "kube-exec" "kube-deploy" "kube-rollout" "kube-ctx-exec" "kube-unstick" "kube-sniff" "kube-sts" "kube-ds" "kube-namespaces" "kube-clean" "kube-resources" "kube-events" "kube-auth" "kube-proxy" "kube-describe" "kube-trace" "kube-why" "kube-bench-api" "kube-export" "kube-lint" "kube-security" "kube-sa" "kube-ctx-sync" "kube-gateway" "kube-vol" "kube-curl" "kube-webhooks" "kube-topology" "kube-preflight" "kube-notify" "kube-leases" "kube-drain")
     
     for tool in "${TOOLS[@]}"; do
         target="$INSTALL_DIR/$tool"
@@ -254,7 +254,7 @@ uninstall_tools() {
 verify_installation() {
     log "Verifying installation..."
     
-    TOOLS=("kube" "kube-pods" "kube-services" "kube-switch-context" "kube-switch-namespace" "kube-logs" "kube-port-forward" "kube-exec" "kube-deploy" "kube-rollout")
+    TOOLS=("kube" "kube-pods" "kube-services" "kube-switch-context" "kube-switch-namespace" "kube-logs" "kube-port-forward" "kube-exec" "kube-deploy" "kube-rollout" "kube-ctx-exec" "kube-unstick" "kube-sniff" "kube-sts" "kube-ds" "kube-namespaces" "kube-clean" "kube-resources" "kube-events" "kube-auth" "kube-proxy" "kube-describe" "kube-trace" "kube-why" "kube-bench-api" "kube-export" "kube-lint" "kube-security" "kube-sa" "kube-ctx-sync" "kube-gateway" "kube-vol" "kube-curl" "kube-webhooks" "kube-topology" "kube-preflight" "kube-notify" "kube-leases" "kube-drain")
     
     missing_tools=()
     for tool in "${TOOLS[@]}"; do
@@ -0,0 +1,103 @@
+package capacity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Capacity types of a node
+const (
+	// Spot capacity can be reclaimed by the cloud provider at short notice
+	Spot = "spot"
+	// OnDemand capacity stays until the node is removed on purpose
+	OnDemand = "on-demand"
+)
+
+// Type returns Spot or OnDemand from the labels node provisioners and cloud
+// providers put on nodes, or "" when the labels do not tell
+func Type(labels map[string]string) string {
+	// Karpenter, on any cloud
+	switch labels["karpenter.sh/capacity-type"] {
+	case "spot":
+		return Spot
+	case "on-demand", "reserved":
+		return OnDemand
+	}
+	// EKS managed node groups
+	switch labels["eks.amazonaws.com/capacityType"] {
+	case "SPOT":
+		return Spot
+	case "ON_DEMAND", "CAPACITY_BLOCK":
+		return OnDemand
+	}
+	// GKE Spot VMs and the older preemptible VMs
+	if labels["cloud.google.com/gke-spot"] == "true" || labels["cloud.google.com/gke-preemptible"] == "true" {
+		return Spot
+	}
+	if _, ok := labels["cloud.google.com/gke-nodepool"]; ok {
+		return OnDemand
+	}
+	// AKS spot node pools
+	if priority, ok := labels["kubernetes.azure.com/scalesetpriority"]; ok {
+		if priority == "spot" {
+			return Spot
+		}
+		return OnDemand
+	}
+	if _, ok := labels["kubernetes.azure.com/agentpool"]; ok {
+		return OnDemand
+	}
+	// kops, eksctl and spot.io label conventions
+	for _, key := range []string{"node.kubernetes.io/lifecycle", "lifecycle", "spotinst.io/node-lifecycle"} {
+		switch strings.ToLower(labels[key]) {
+		case "spot", "ec2spot", "preemptible":
+			return Spot
+		case "on-demand", "ondemand", "normal", "od":
+			return OnDemand
+		}
+	}
+	return ""
+}
+
+// poolLabels are the labels naming the node pool of a node, by provisioner
+var poolLabels = []string{
+	"karpenter.sh/nodepool",
+	"karpenter.sh/provisioner-name",
+	"eks.amazonaws.com/nodegroup",
+	"alpha.eksctl.io/nodegroup-name",
+	"cloud.google.com/gke-nodepool",
+	"kubernetes.azure.com/agentpool",
+	"doks.digitalocean.com/node-pool",
+	"kops.k8s.io/instancegroup",
+}
+
+// Pool returns the node pool (node group, instance group) a node belongs
+// to, or "" when its labels do not tell
+func Pool(labels map[string]string) string {
+	for _, key := range poolLabels {
+		if pool := labels[key]; pool != "" {
+			return pool
+		}
+	}
+	return ""
+}
+
+// Nodes returns the capacity type of every node by node name. Nodes whose
+// labels do not tell are left out.
+func Nodes(ctx context.Context, clientset kubernetes.Interface) (map[string]string, error) {
+	list, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	types := make(map[string]string, len(list.Items))
+	for _, node := range list.Items {
+		if t := Type(node.Labels); t != "" {
+			types[node.Name] = t
+		}
+	}
+	return types, nil
+}
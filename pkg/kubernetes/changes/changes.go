@@ -0,0 +1,212 @@
+package changes
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"kube/pkg/shared/utils"
+
+	"golang.org/x/term"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxValueLength keeps long annotation values on one line
+const maxValueLength = 60
+
+// ignoredAnnotations change with every apply and only add noise
+var ignoredAnnotations = map[string]bool{
+	"kubectl.kubernetes.io/last-applied-configuration": true,
+}
+
+// Change is one field that differs between before and after
+type Change struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// Deployment returns what differs between two versions of a Deployment
+func Deployment(before, after *appsv1.Deployment) []Change {
+	var changes []Change
+	changes = append(changes, images(&before.Spec.Template.Spec, &after.Spec.Template.Spec)...)
+	changes = appendIfChanged(changes, "replicas", replicas(before.Spec.Replicas), replicas(after.Spec.Replicas))
+	changes = append(changes, annotations("annotation", before.Annotations, after.Annotations)...)
+	changes = append(changes, annotations("template annotation", before.Spec.Template.Annotations, after.Spec.Template.Annotations)...)
+	return append(changes, generation(&before.ObjectMeta, &after.ObjectMeta)...)
+}
+
+// StatefulSet returns what differs between two versions of a StatefulSet
+func StatefulSet(before, after *appsv1.StatefulSet) []Change {
+	var changes []Change
+	changes = append(changes, images(&before.Spec.Template.Spec, &after.Spec.Template.Spec)...)
+	changes = appendIfChanged(changes, "replicas", replicas(before.Spec.Replicas), replicas(after.Spec.Replicas))
+	changes = appendIfChanged(changes, "partition", partition(before), partition(after))
+	changes = append(changes, annotations("annotation", before.Annotations, after.Annotations)...)
+	changes = append(changes, annotations("template annotation", before.Spec.Template.Annotations, after.Spec.Template.Annotations)...)
+	return append(changes, generation(&before.ObjectMeta, &after.ObjectMeta)...)
+}
+
+// DaemonSet returns what differs between two versions of a DaemonSet
+func DaemonSet(before, after *appsv1.DaemonSet) []Change {
+	var changes []Change
+	changes = append(changes, images(&before.Spec.Template.Spec, &after.Spec.Template.Spec)...)
+	changes = append(changes, annotations("annotation", before.Annotations, after.Annotations)...)
+	changes = append(changes, annotations("template annotation", before.Spec.Template.Annotations, after.Spec.Template.Annotations)...)
+	return append(changes, generation(&before.ObjectMeta, &after.ObjectMeta)...)
+}
+
+// Job returns what differs between two versions of a Job
+func Job(before, after *batchv1.Job) []Change {
+	var changes []Change
+	changes = append(changes, images(&before.Spec.Template.Spec, &after.Spec.Template.Spec)...)
+	changes = append(changes, annotations("annotation", before.Annotations, after.Annotations)...)
+	return append(changes, annotations("template annotation", before.Spec.Template.Annotations, after.Spec.Template.Annotations)...)
+}
+
+// CronJob returns what differs between two versions of a CronJob. CronJobs
+// have no generation-driven rollout, the job template applies to the next run.
+func CronJob(before, after *batchv1.CronJob) []Change {
+	var changes []Change
+	changes = append(changes, images(&before.Spec.JobTemplate.Spec.Template.Spec, &after.Spec.JobTemplate.Spec.Template.Spec)...)
+	changes = appendIfChanged(changes, "schedule", before.Spec.Schedule, after.Spec.Schedule)
+	changes = appendIfChanged(changes, "suspend", suspended(before.Spec.Suspend), suspended(after.Spec.Suspend))
+	changes = append(changes, annotations("annotation", before.Annotations, after.Annotations)...)
+	return append(changes, annotations("template annotation", before.Spec.JobTemplate.Spec.Template.Annotations, after.Spec.JobTemplate.Spec.Template.Annotations)...)
+}
+
+// Print writes the changes as a compact before → after summary. Values are
+// colored when stdout is a terminal, so logs of automated runs stay plain.
+func Print(w io.Writer, kind, namespace, name string, changes []Change) {
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "No changes to %s %s/%s\n", kind, namespace, name)
+		return
+	}
+
+	red, green, reset := "", "", ""
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		red, green, reset = "\033[31m", "\033[32m", "\033[0m"
+	}
+
+	width := 0
+	for _, c := range changes {
+		if len(c.Field) > width {
+			width = len(c.Field)
+		}
+	}
+	fmt.Fprintf(w, "Changes to %s %s/%s:\n", kind, namespace, name)
+	for _, c := range changes {
+		fmt.Fprintf(w, "  %-*s  %s%s%s → %s%s%s\n", width, c.Field,
+			red, utils.TruncateString(c.Before, maxValueLength), reset,
+			green, utils.TruncateString(c.After, maxValueLength), reset)
+	}
+}
+
+// images compares container images by container name
+func images(before, after *corev1.PodSpec) []Change {
+	var changes []Change
+	compare := func(prefix string, before, after []corev1.Container) {
+		old := map[string]string{}
+		for _, c := range before {
+			old[c.Name] = c.Image
+		}
+		seen := map[string]bool{}
+		for _, c := range after {
+			seen[c.Name] = true
+			changes = appendIfChanged(changes, prefix+" "+c.Name, valueOrDash(old[c.Name]), c.Image)
+		}
+		for _, c := range before {
+			if !seen[c.Name] {
+				changes = append(changes, Change{prefix + " " + c.Name, c.Image, "-"})
+			}
+		}
+	}
+	compare("image", before.Containers, after.Containers)
+	compare("init image", before.InitContainers, after.InitContainers)
+	return changes
+}
+
+// annotations compares annotation maps, sorted by key
+func annotations(prefix string, before, after map[string]string) []Change {
+	keys := map[string]bool{}
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		if !ignoredAnnotations[key] {
+			sorted = append(sorted, key)
+		}
+	}
+	sort.Strings(sorted)
+
+	var changes []Change
+	for _, key := range sorted {
+		oldValue, hadOld := before[key]
+		newValue, hasNew := after[key]
+		if hadOld == hasNew && oldValue == newValue {
+			continue
+		}
+		if !hadOld {
+			oldValue = "-"
+		}
+		if !hasNew {
+			newValue = "-"
+		}
+		changes = append(changes, Change{prefix + " " + key, oldValue, newValue})
+	}
+	return changes
+}
+
+// generation reports a generation bump, which means the spec changed
+func generation(before, after *metav1.ObjectMeta) []Change {
+	if before.Generation == after.Generation {
+		return nil
+	}
+	return []Change{{"generation", fmt.Sprintf("%d", before.Generation), fmt.Sprintf("%d", after.Generation)}}
+}
+
+// partition returns the rolling update partition of a StatefulSet
+func partition(sts *appsv1.StatefulSet) string {
+	if ru := sts.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil {
+		return fmt.Sprintf("%d", *ru.Partition)
+	}
+	return "-"
+}
+
+// replicas formats the desired replicas, which default to 1
+func replicas(r *int32) string {
+	if r == nil {
+		return "1"
+	}
+	return fmt.Sprintf("%d", *r)
+}
+
+// suspended formats the suspend flag of a CronJob, which defaults to false
+func suspended(suspend *bool) string {
+	return fmt.Sprintf("%t", suspend != nil && *suspend)
+}
+
+// appendIfChanged adds a change when the values differ
+func appendIfChanged(changes []Change, field, before, after string) []Change {
+	if before == after {
+		return changes
+	}
+	return append(changes, Change{field, before, after})
+}
+
+// valueOrDash returns - for empty values
+func valueOrDash(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "-"
+	}
+	return s
+}
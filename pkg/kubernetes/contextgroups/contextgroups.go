@@ -0,0 +1,133 @@
+package contextgroups
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"kube/pkg/shared/clierr"
+	cmdconfig "kube/pkg/shared/config"
+	cmdstate "kube/pkg/shared/state"
+)
+
+// EnvGroup selects the active group for one shell, overriding use-group
+const EnvGroup = "KUBE_CONTEXT_GROUP"
+
+// state is the persisted active group
+type state struct {
+	Group string `json:"group"`
+}
+
+// ConfigPath returns the kube config file that defines the groups,
+// ~/.kube.yaml unless KUBE_CMD_CONFIG names another file
+func ConfigPath() string {
+	if file := os.Getenv(cmdconfig.FileEnv); file != "" {
+		return file
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube.yaml")
+}
+
+// Load returns the groups defined under contextGroups in ~/.kube.yaml,
+// which the tool has loaded. Members are context names or shell patterns
+// like prod-*. Group names come lower case, like all keys of the file.
+func Load() (map[string][]string, error) {
+	groups := map[string][]string{}
+	if err := cmdconfig.UnmarshalKey("contextGroups", &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Members returns the members of a group, matching its name regardless of case
+func Members(groups map[string][]string, group string) ([]string, bool) {
+	members, ok := groups[strings.ToLower(group)]
+	return members, ok
+}
+
+// statePath returns the active group file
+func statePath() string {
+	return cmdstate.Path("context-group.json")
+}
+
+// Active returns the active group, or "" when all contexts are in use
+func Active() string {
+	if group, ok := os.LookupEnv(EnvGroup); ok {
+		return group
+	}
+	data, err := os.ReadFile(statePath())
+	if err != nil {
+		return ""
+	}
+	var s state
+	// A corrupted file only resets the group
+	json.Unmarshal(data, &s)
+	return s.Group
+}
+
+// SetActive persists the active group; "" goes back to all contexts
+func SetActive(group string) error {
+	p := statePath()
+	if p == "" {
+		return fmt.Errorf("cannot determine state location")
+	}
+	if group == "" {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to clear context group: %w", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.Marshal(state{Group: group})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(p, data, 0600); err != nil {
+		return fmt.Errorf("failed to save context group: %w", err)
+	}
+	return nil
+}
+
+// Match returns the contexts of names that belong to the group, sorted
+func Match(members, names []string) []string {
+	var matched []string
+	for _, name := range names {
+		for _, member := range members {
+			if ok, _ := path.Match(member, name); ok {
+				matched = append(matched, name)
+				break
+			}
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+// Filter restricts the context names to the active group. It returns the
+// names unchanged and an empty group when no group is active.
+func Filter(names []string) ([]string, string, error) {
+	group := Active()
+	if group == "" {
+		sorted := append([]string(nil), names...)
+		sort.Strings(sorted)
+		return sorted, "", nil
+	}
+	groups, err := Load()
+	if err != nil {
+		return nil, "", err
+	}
+	members, ok := Members(groups, group)
+	if !ok {
+		return nil, "", clierr.Newf(clierr.NotFound, "context group %q is not defined in %s", group, ConfigPath())
+	}
+	return Match(members, names), group, nil
+}
@@ -0,0 +1,192 @@
+package ctxsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"kube/pkg/shared/clierr"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v4"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// subscriptionsAPIVersion is the ARM API version of the subscription list
+const subscriptionsAPIVersion = "2022-12-01"
+
+// subscription is an Azure subscription the credentials can access
+type subscription struct {
+	ID   string `json:"subscriptionId"`
+	Name string `json:"displayName"`
+}
+
+// aksBackend discovers AKS clusters in every subscription of its scope
+type aksBackend struct {
+	scope Scope
+}
+
+func (b *aksBackend) Discover(ctx context.Context) ([]Cluster, error) {
+	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, clierr.Newf(clierr.Forbidden, "no Azure credentials, log in with az login: %v", err)
+	}
+	subscriptions, err := b.subscriptions(ctx, credential)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(subscriptions))
+	names := map[string]string{}
+	for _, s := range subscriptions {
+		ids = append(ids, s.ID)
+		names[s.ID] = s.Name
+	}
+	return collect(ids, func(id string) ([]Cluster, error) {
+		return b.discoverSubscription(ctx, credential, id, names[id])
+	})
+}
+
+// subscriptions lists the subscriptions the credential can access and picks
+// those of the scope by ID or name. An empty scope picks all of them.
+func (b *aksBackend) subscriptions(ctx context.Context, credential azcore.TokenCredential) ([]subscription, error) {
+	client, err := arm.NewClient("ctxsync", "v1.0.0", credential, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []subscription
+	next := client.Endpoint() + "/subscriptions?api-version=" + subscriptionsAPIVersion
+	for next != "" {
+		req, err := runtime.NewRequest(ctx, http.MethodGet, next)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Pipeline().Do(req)
+		if err == nil && !runtime.HasStatusCode(resp, http.StatusOK) {
+			err = runtime.NewResponseError(resp)
+		}
+		if err != nil {
+			return nil, apiError(ctx, "list Azure subscriptions", azureError(err))
+		}
+		var page struct {
+			Value    []subscription `json:"value"`
+			NextLink string         `json:"nextLink"`
+		}
+		if err := runtime.UnmarshalAsJSON(resp, &page); err != nil {
+			return nil, fmt.Errorf("unexpected list of Azure subscriptions: %w", err)
+		}
+		all = append(all, page.Value...)
+		next = page.NextLink
+	}
+
+	if len(b.scope.Subscriptions) == 0 {
+		return all, nil
+	}
+	var picked []subscription
+	for _, wanted := range b.scope.Subscriptions {
+		found := false
+		for _, s := range all {
+			if strings.EqualFold(s.ID, wanted) || s.Name == wanted {
+				picked = append(picked, s)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, clierr.Newf(clierr.NotFound, "Azure subscription %q not found or not accessible", wanted)
+		}
+	}
+	return picked, nil
+}
+
+// discoverSubscription lists the clusters of one subscription. The API
+// server certificate is only part of the credentials, so it is read from the
+// kubeconfig AKS generates for the signed-in user.
+func (b *aksBackend) discoverSubscription(ctx context.Context, credential azcore.TokenCredential, id, name string) ([]Cluster, error) {
+	client, err := armcontainerservice.NewManagedClustersClient(id, credential, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []Cluster
+	pager := client.NewListPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return clusters, apiError(ctx, "list AKS clusters of "+name, azureError(err))
+		}
+		for _, c := range page.Value {
+			if c.Name == nil || c.ID == nil {
+				continue
+			}
+			if c.Properties == nil || c.Properties.AADProfile == nil {
+				fmt.Fprintf(os.Stderr, "Warning: AKS cluster %s only has local accounts, no exec credentials possible, skipped (use az aks get-credentials)\n", *c.Name)
+				continue
+			}
+			resource, err := arm.ParseResourceID(*c.ID)
+			if err != nil {
+				return clusters, fmt.Errorf("unexpected ID of AKS cluster %s: %w", *c.Name, err)
+			}
+			credentials, err := client.ListClusterUserCredentials(ctx, resource.ResourceGroupName, *c.Name, nil)
+			if err != nil {
+				return clusters, apiError(ctx, "get credentials of AKS cluster "+*c.Name, azureError(err))
+			}
+			var server *api.Cluster
+			if len(credentials.Kubeconfigs) > 0 {
+				if generated, err := clientcmd.Load(credentials.Kubeconfigs[0].Value); err == nil {
+					for _, cluster := range generated.Clusters {
+						server = cluster
+					}
+				}
+			}
+			if server == nil {
+				return clusters, fmt.Errorf("unexpected kubeconfig in the credentials of AKS cluster %s", *c.Name)
+			}
+
+			location := ""
+			if c.Location != nil {
+				location = *c.Location
+			}
+			plugin := execConfig("kubelogin", "Install kubelogin: az aks install-cli",
+				"get-token", "--login", "azurecli", "--server-id", azureServerID)
+			clusters = append(clusters, Cluster{
+				Provider: "aks",
+				// Same as az aks get-credentials
+				Context:  *c.Name,
+				Location: location,
+				Account:  name,
+				Server:   server.Server,
+				CAData:   server.CertificateAuthorityData,
+				Exec:     plugin,
+			})
+		}
+	}
+	return clusters, nil
+}
+
+// azureError shortens the multi-line errors of the Azure SDK to the error
+// code and status, or to the first line for credential errors
+func azureError(err error) error {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		// The default credential lists every credential it tried
+		message, rest, multiline := strings.Cut(err.Error(), "\n")
+		if !multiline || strings.TrimSpace(rest) == "" {
+			return err
+		}
+		return clierr.Newf(clierr.Forbidden, "%s (log in with az login)", strings.TrimSpace(message))
+	}
+	code := clierr.Generic
+	if respErr.StatusCode == http.StatusUnauthorized || respErr.StatusCode == http.StatusForbidden {
+		code = clierr.Forbidden
+	}
+	return clierr.Newf(code, "%s (HTTP %d)", respErr.ErrorCode, respErr.StatusCode)
+}
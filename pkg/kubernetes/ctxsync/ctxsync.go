@@ -0,0 +1,246 @@
+package ctxsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"kube/pkg/shared/clierr"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// execAPIVersion is the credential plugin API of the generated exec stanzas
+const execAPIVersion = "client.authentication.k8s.io/v1beta1"
+
+// azureServerID is the AAD application of the AKS API servers, the audience
+// of the tokens kubelogin requests
+const azureServerID = "6dae42f8-4368-4678-94ff-3960e28e3630"
+
+// Providers are the supported backends, in the order they are listed
+var Providers = []string{"eks", "gke", "aks"}
+
+// Scope limits what a backend scans. Empty lists use the defaults of the
+// provider credentials (the configured region or project) and every
+// subscription the Azure credentials can access.
+type Scope struct {
+	// Profiles are AWS shared config profiles (eks)
+	Profiles []string `mapstructure:"profiles"`
+	// Regions are AWS regions (eks)
+	Regions []string `mapstructure:"regions"`
+	// Projects are Google Cloud projects (gke)
+	Projects []string `mapstructure:"projects"`
+	// Subscriptions are Azure subscription names or IDs (aks)
+	Subscriptions []string `mapstructure:"subscriptions"`
+}
+
+// Cluster is a discovered cluster with what is needed to reach it
+type Cluster struct {
+	Provider string
+	// Context names the kubeconfig context, cluster and user. It follows the
+	// naming of the provider CLI so entries it created are updated in place.
+	Context string
+	// Location is the region or zone
+	Location string
+	// Account is the AWS profile, Google Cloud project or Azure subscription
+	Account string
+	Server  string
+	CAData  []byte
+	Exec    *api.ExecConfig
+}
+
+// Backend discovers the clusters of one cloud provider through its API
+type Backend interface {
+	// Discover lists the clusters the current credentials can access
+	Discover(ctx context.Context) ([]Cluster, error)
+}
+
+// New returns the backend of a provider. Discovery uses the credential chain
+// of the provider SDK, the generated users the credential plugin of the
+// provider:
+//   - eks  AWS SDK profiles; tokens from aws eks get-token
+//   - gke  Google application default credentials; tokens from gke-gcloud-auth-plugin
+//   - aks  Azure default credentials; tokens from kubelogin (Entra ID enabled clusters)
+func New(provider string, scope Scope) (Backend, error) {
+	switch provider {
+	case "eks":
+		return &eksBackend{scope: scope}, nil
+	case "gke":
+		return &gkeBackend{scope: scope}, nil
+	case "aks":
+		return &aksBackend{scope: scope}, nil
+	}
+	return nil, clierr.Usagef("unknown provider '%s', expected %s", provider, strings.Join(Providers, ", "))
+}
+
+// Status is what Merge did with a cluster
+type Status string
+
+const (
+	Added     Status = "added"
+	Updated   Status = "updated"
+	Unchanged Status = "unchanged"
+)
+
+// Merge adds or updates the context, cluster and user entries of every
+// cluster in config. The namespace of existing contexts is kept, the user is
+// replaced by the exec stanza.
+func Merge(config *api.Config, clusters []Cluster) []Status {
+	statuses := make([]Status, len(clusters))
+	for i, c := range clusters {
+		cluster, clusterExists := config.Clusters[c.Context]
+		user, userExists := config.AuthInfos[c.Context]
+		kubeContext, contextExists := config.Contexts[c.Context]
+
+		if !clusterExists || !userExists || !contextExists {
+			statuses[i] = Added
+		} else if cluster.Server != c.Server || !bytes.Equal(cluster.CertificateAuthorityData, c.CAData) ||
+			!reflect.DeepEqual(user.Exec, c.Exec) || kubeContext.Cluster != c.Context || kubeContext.AuthInfo != c.Context {
+			statuses[i] = Updated
+		} else {
+			statuses[i] = Unchanged
+			continue
+		}
+
+		if !clusterExists {
+			cluster = api.NewCluster()
+			config.Clusters[c.Context] = cluster
+		}
+		cluster.Server = c.Server
+		cluster.CertificateAuthority = ""
+		cluster.CertificateAuthorityData = c.CAData
+
+		user = api.NewAuthInfo()
+		user.Exec = c.Exec
+		config.AuthInfos[c.Context] = user
+
+		namespace := ""
+		if contextExists {
+			namespace = kubeContext.Namespace
+		}
+		kubeContext = api.NewContext()
+		kubeContext.Cluster = c.Context
+		kubeContext.AuthInfo = c.Context
+		kubeContext.Namespace = namespace
+		config.Contexts[c.Context] = kubeContext
+	}
+	return statuses
+}
+
+// LoadKubeconfig loads path, or an empty config when it does not exist yet
+func LoadKubeconfig(path string) (*api.Config, error) {
+	config, err := clientcmd.LoadFromFile(path)
+	if os.IsNotExist(err) {
+		return api.NewConfig(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	return config, nil
+}
+
+// execConfig returns an exec stanza for a credential plugin
+func execConfig(command, installHint string, args ...string) *api.ExecConfig {
+	return &api.ExecConfig{
+		Command:         command,
+		Args:            args,
+		APIVersion:      execAPIVersion,
+		InstallHint:     installHint,
+		InteractiveMode: api.IfAvailableExecInteractiveMode,
+	}
+}
+
+// getJSON sends req and decodes the JSON answer into out. Failed requests
+// return the message the provider put in the body.
+func getJSON(client interface {
+	Do(*http.Request) (*http.Response, error)
+}, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		// AWS puts the message at the top, Google below error
+		var failure struct {
+			Message string `json:"message"`
+			Error   struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(data, &failure)
+		message := failure.Message
+		if message == "" {
+			message = failure.Error.Message
+		}
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		code := clierr.Generic
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			code = clierr.Forbidden
+		}
+		return clierr.Newf(code, "%s (HTTP %d)", message, resp.StatusCode)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("unexpected answer: %w", err)
+	}
+	return nil
+}
+
+// apiError describes a failed provider request. Requests cut off by the
+// timeout or an interrupt say so instead of showing the transport error.
+func apiError(ctx context.Context, what string, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return clierr.Newf(clierr.Timeout, "%s did not finish in time", what)
+	}
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return clierr.Wrap(clierr.ExitCode(err), fmt.Errorf("%s: %w", what, err))
+}
+
+// orDefault returns values, or a single empty value meaning the SDK default
+func orDefault(values []string) []string {
+	if len(values) == 0 {
+		return []string{""}
+	}
+	return values
+}
+
+// collect runs discover for every item concurrently and joins the results.
+// The clusters found are returned even when some items failed.
+func collect(items []string, discover func(item string) ([]Cluster, error)) ([]Cluster, error) {
+	results := make([][]Cluster, len(items))
+	errs := make([]error, len(items))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item string) {
+			defer wg.Done()
+			results[i], errs[i] = discover(item)
+		}(i, item)
+	}
+	wg.Wait()
+
+	var clusters []Cluster
+	for _, r := range results {
+		clusters = append(clusters, r...)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Context < clusters[j].Context })
+	return clusters, errors.Join(errs...)
+}
@@ -0,0 +1,78 @@
+package ctxsync
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kube/pkg/shared/clierr"
+)
+
+func TestGetJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		want     string
+		wantErr  string
+		wantCode int
+	}{
+		{
+			name:   "ok",
+			status: http.StatusOK,
+			body:   `{"clusters":["prod"]}`,
+			want:   "prod",
+		},
+		{
+			name:     "aws error",
+			status:   http.StatusForbidden,
+			body:     `{"message":"User is not authorized to perform: eks:ListClusters"}`,
+			wantErr:  "User is not authorized to perform: eks:ListClusters (HTTP 403)",
+			wantCode: clierr.Forbidden,
+		},
+		{
+			name:     "google error",
+			status:   http.StatusNotFound,
+			body:     `{"error":{"code":404,"message":"Project acme not found","status":"NOT_FOUND"}}`,
+			wantErr:  "Project acme not found (HTTP 404)",
+			wantCode: clierr.Generic,
+		},
+		{
+			name:     "no body",
+			status:   http.StatusUnauthorized,
+			wantErr:  "Unauthorized (HTTP 401)",
+			wantCode: clierr.Forbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			var out struct {
+				Clusters []string `json:"clusters"`
+			}
+			err := getJSON(server.Client(), req, &out)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				if code := clierr.ExitCode(err); code != tt.wantCode {
+					t.Errorf("exit code = %d, want %d", code, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(out.Clusters) != 1 || out.Clusters[0] != tt.want {
+				t.Errorf("clusters = %v, want [%s]", out.Clusters, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package ctxsync
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"kube/pkg/shared/clierr"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty body, signed for GET requests
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// eksBackend discovers EKS clusters in every profile and region of its scope
+type eksBackend struct {
+	scope Scope
+}
+
+func (b *eksBackend) Discover(ctx context.Context) ([]Cluster, error) {
+	configs := map[string]aws.Config{}
+	var pairs []string
+	for _, profile := range orDefault(b.scope.Profiles) {
+		var options []func(*awsconfig.LoadOptions) error
+		if profile != "" {
+			options = append(options, awsconfig.WithSharedConfigProfile(profile))
+		}
+		cfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS profile %q: %w", profile, err)
+		}
+		configs[profile] = cfg
+
+		regions := b.scope.Regions
+		if len(regions) == 0 {
+			if cfg.Region == "" {
+				return nil, clierr.Usagef("no AWS region configured for profile %q, pass --region", profile)
+			}
+			regions = []string{cfg.Region}
+		}
+		for _, region := range regions {
+			pairs = append(pairs, profile+"/"+region)
+		}
+	}
+	return collect(pairs, func(pair string) ([]Cluster, error) {
+		profile, region, _ := strings.Cut(pair, "/")
+		return b.discoverRegion(ctx, configs[profile], profile, region)
+	})
+}
+
+// discoverRegion lists and describes the clusters of one profile and region
+func (b *eksBackend) discoverRegion(ctx context.Context, cfg aws.Config, profile, region string) ([]Cluster, error) {
+	var names []string
+	query := url.Values{"maxResults": {"100"}}
+	for {
+		var page struct {
+			Clusters  []string `json:"clusters"`
+			NextToken string   `json:"nextToken"`
+		}
+		if err := b.get(ctx, cfg, region, "/clusters?"+query.Encode(), &page); err != nil {
+			return nil, apiError(ctx, "eks list-clusters in "+region, err)
+		}
+		names = append(names, page.Clusters...)
+		if page.NextToken == "" {
+			break
+		}
+		query.Set("nextToken", page.NextToken)
+	}
+
+	var clusters []Cluster
+	for _, name := range names {
+		var described struct {
+			Cluster struct {
+				Arn                  string `json:"arn"`
+				Endpoint             string `json:"endpoint"`
+				Status               string `json:"status"`
+				CertificateAuthority struct {
+					Data string `json:"data"`
+				} `json:"certificateAuthority"`
+			} `json:"cluster"`
+		}
+		if err := b.get(ctx, cfg, region, "/clusters/"+url.PathEscape(name), &described); err != nil {
+			return clusters, apiError(ctx, "eks describe-cluster "+name, err)
+		}
+		c := described.Cluster
+		if c.Endpoint == "" {
+			fmt.Fprintf(os.Stderr, "Warning: EKS cluster %s in %s has no endpoint yet (status %s), skipped\n", name, region, c.Status)
+			continue
+		}
+		caData, err := base64.StdEncoding.DecodeString(c.CertificateAuthority.Data)
+		if err != nil {
+			return clusters, fmt.Errorf("invalid certificate authority of EKS cluster %s: %w", name, err)
+		}
+
+		// Same as aws eks update-kubeconfig, so its entries are updated in place
+		execArgs := []string{"--region", region, "eks", "get-token", "--cluster-name", name, "--output", "json"}
+		plugin := execConfig("aws", "Install the AWS CLI v2: https://aws.amazon.com/cli/", execArgs...)
+		if profile != "" {
+			plugin.Env = []api.ExecEnvVar{{Name: "AWS_PROFILE", Value: profile}}
+		}
+		clusters = append(clusters, Cluster{
+			Provider: "eks",
+			Context:  c.Arn,
+			Location: region,
+			Account:  profile,
+			Server:   c.Endpoint,
+			CAData:   caData,
+			Exec:     plugin,
+		})
+	}
+	return clusters, nil
+}
+
+// get sends a GET request signed with the credentials of cfg to the EKS API
+// of region and decodes the answer into out
+func (b *eksBackend) get(ctx context.Context, cfg aws.Config, region, path string, out interface{}) error {
+	if cfg.Credentials == nil {
+		return clierr.Newf(clierr.Forbidden, "no AWS credentials, log in with aws sso login or aws configure")
+	}
+	credentials, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, eksEndpoint(region)+path, nil)
+	if err != nil {
+		return err
+	}
+	if err := v4.NewSigner().SignHTTP(ctx, credentials, req, emptyPayloadHash, "eks", region, time.Now()); err != nil {
+		return err
+	}
+	return getJSON(cfg.HTTPClient, req, out)
+}
+
+// eksEndpoint returns the EKS API endpoint of a region
+func eksEndpoint(region string) string {
+	if strings.HasPrefix(region, "cn-") {
+		return "https://eks." + region + ".amazonaws.com.cn"
+	}
+	return "https://eks." + region + ".amazonaws.com"
+}
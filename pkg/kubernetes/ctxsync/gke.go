@@ -0,0 +1,107 @@
+package ctxsync
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"kube/pkg/shared/clierr"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// gkeEndpoint is the Kubernetes Engine API
+const gkeEndpoint = "https://container.googleapis.com/v1"
+
+// gkeScope is the OAuth scope the Kubernetes Engine API requires
+const gkeScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// gkeBackend discovers GKE clusters in every project of its scope
+type gkeBackend struct {
+	scope Scope
+}
+
+func (b *gkeBackend) Discover(ctx context.Context) ([]Cluster, error) {
+	credentials, err := google.FindDefaultCredentials(ctx, gkeScope)
+	if err != nil {
+		return nil, clierr.Newf(clierr.Forbidden, "no Google Cloud credentials, log in with gcloud auth application-default login: %v", err)
+	}
+
+	projects := b.scope.Projects
+	if len(projects) == 0 {
+		// Like gcloud: the environment first, then the project of the credentials
+		project := os.Getenv("CLOUDSDK_CORE_PROJECT")
+		if project == "" {
+			project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+		}
+		if project == "" {
+			project = credentials.ProjectID
+		}
+		if project == "" {
+			return nil, clierr.Usagef("no Google Cloud project configured, pass --project")
+		}
+		projects = []string{project}
+	}
+
+	client := oauth2.NewClient(ctx, credentials.TokenSource)
+	return collect(projects, func(project string) ([]Cluster, error) {
+		return b.discoverProject(ctx, client, project)
+	})
+}
+
+// discoverProject lists the clusters of one project in all locations
+func (b *gkeBackend) discoverProject(ctx context.Context, client *http.Client, project string) ([]Cluster, error) {
+	var list struct {
+		Clusters []struct {
+			Name       string `json:"name"`
+			Location   string `json:"location"`
+			Endpoint   string `json:"endpoint"`
+			Status     string `json:"status"`
+			MasterAuth struct {
+				ClusterCaCertificate string `json:"clusterCaCertificate"`
+			} `json:"masterAuth"`
+		} `json:"clusters"`
+		MissingZones []string `json:"missingZones"`
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gkeEndpoint+"/projects/"+url.PathEscape(project)+"/locations/-/clusters", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := getJSON(client, req, &list); err != nil {
+		return nil, apiError(ctx, "list GKE clusters of "+project, err)
+	}
+	if len(list.MissingZones) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: GKE did not answer for %s in project %s, their clusters are missing\n", strings.Join(list.MissingZones, ", "), project)
+	}
+
+	var clusters []Cluster
+	for _, c := range list.Clusters {
+		if c.Endpoint == "" {
+			fmt.Fprintf(os.Stderr, "Warning: GKE cluster %s in %s has no endpoint yet (status %s), skipped\n", c.Name, c.Location, c.Status)
+			continue
+		}
+		caData, err := base64.StdEncoding.DecodeString(c.MasterAuth.ClusterCaCertificate)
+		if err != nil {
+			return clusters, fmt.Errorf("invalid certificate authority of GKE cluster %s: %w", c.Name, err)
+		}
+		plugin := execConfig("gke-gcloud-auth-plugin",
+			"Install gke-gcloud-auth-plugin: gcloud components install gke-gcloud-auth-plugin")
+		plugin.ProvideClusterInfo = true
+		clusters = append(clusters, Cluster{
+			Provider: "gke",
+			// Same as gcloud container clusters get-credentials
+			Context:  fmt.Sprintf("gke_%s_%s_%s", project, c.Location, c.Name),
+			Location: c.Location,
+			Account:  project,
+			Server:   "https://" + c.Endpoint,
+			CAData:   caData,
+			Exec:     plugin,
+		})
+	}
+	return clusters, nil
+}
@@ -0,0 +1,513 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/workloads"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/imagepolicy"
+	"kube/pkg/shared/utils"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Finding is one way a container differs from what it is supposed to run
+type Finding struct {
+	Container string
+	// Check names what differs: container, image, command, args, env NAME,
+	// envFrom, digest, configmap/NAME or secret/NAME
+	Check    string
+	Expected string
+	Actual   string
+}
+
+// Report is the drift of one pod
+type Report struct {
+	// Owner is the workload the pod was compared with, like deploy/web. It is
+	// empty for pods without a Deployment, StatefulSet or DaemonSet.
+	Owner    string
+	Findings []Finding
+	// Warnings are checks that could not be done, e.g. on unreadable Secrets
+	Warnings []string
+}
+
+// ownerAliases are the short kind names used in Report.Owner
+var ownerAliases = map[string]string{
+	workloads.KindDeployment:  "deploy",
+	workloads.KindStatefulSet: "sts",
+	workloads.KindDaemonSet:   "ds",
+}
+
+// Checker finds drift between pods and what they should run. Owners, their
+// pods, ConfigMaps, Secrets and registry digests are cached, so checking all
+// pods of a namespace costs a few requests per workload.
+type Checker struct {
+	clientset kubernetes.Interface
+	registry  bool
+
+	owners   map[string]workloads.Workload
+	siblings map[string][]corev1.Pod
+	modified map[string]time.Time
+	failed   map[string]error
+	digests  map[string]string
+}
+
+// NewChecker returns a Checker. With registry the tags of running images are
+// resolved with the registry API and compared with the digests the
+// containers run; otherwise the digests of sibling pods are compared.
+func NewChecker(clientset kubernetes.Interface, registry bool) *Checker {
+	return &Checker{
+		clientset: clientset,
+		registry:  registry,
+		owners:    map[string]workloads.Workload{},
+		siblings:  map[string][]corev1.Pod{},
+		modified:  map[string]time.Time{},
+		failed:    map[string]error{},
+		digests:   map[string]string{},
+	}
+}
+
+// Pod compares pod with the current template of its workload, the image
+// digests it should run and the ConfigMaps and Secrets its containers only
+// read at start
+func (c *Checker) Pod(ctx context.Context, pod *corev1.Pod, now time.Time) (Report, error) {
+	var report Report
+	owner, err := c.owner(ctx, pod)
+	if err != nil {
+		return report, err
+	}
+	if owner != nil {
+		report.Owner = ownerAliases[owner.Kind()] + "/" + owner.GetName()
+		report.Findings = append(report.Findings, templateFindings(&owner.GetPodTemplate().Spec, &pod.Spec, report.Owner)...)
+	}
+
+	digests, warnings, err := c.digestFindings(ctx, pod, owner)
+	if err != nil {
+		return report, err
+	}
+	report.Findings = append(report.Findings, digests...)
+	report.Warnings = append(report.Warnings, warnings...)
+
+	config, warnings := c.configFindings(ctx, pod, now)
+	report.Findings = append(report.Findings, config...)
+	report.Warnings = append(report.Warnings, warnings...)
+	return report, nil
+}
+
+// owner returns the Deployment, StatefulSet or DaemonSet of pod. Jobs and
+// other controllers are skipped since their pods are not replaced when the
+// template changes.
+func (c *Checker) owner(ctx context.Context, pod *corev1.Pod) (workloads.Workload, error) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil, nil
+	}
+	kind, name := ref.Kind, ref.Name
+	switch kind {
+	case "ReplicaSet":
+		rs, err := c.clientset.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get replicaset %s: %w", name, err)
+		}
+		rsRef := metav1.GetControllerOf(rs)
+		if rsRef == nil || rsRef.Kind != workloads.KindDeployment {
+			return nil, nil
+		}
+		kind, name = workloads.KindDeployment, rsRef.Name
+	case workloads.KindStatefulSet, workloads.KindDaemonSet:
+	default:
+		return nil, nil
+	}
+
+	key := pod.Namespace + "/" + kind + "/" + name
+	if w, ok := c.owners[key]; ok {
+		return w, nil
+	}
+	w, err := workloads.Get(ctx, c.clientset, kind, pod.Namespace, name)
+	if clierr.ExitCode(err) == clierr.NotFound {
+		// The owner is being deleted, its pods follow
+		w, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.owners[key] = w
+	return w, nil
+}
+
+// templateFindings compares the containers of spec with those of the
+// template. Env vars only set on the pod are ignored since admission webhooks
+// commonly add them; containers only in the pod (injected sidecars) too.
+func templateFindings(template, spec *corev1.PodSpec, owner string) []Finding {
+	var findings []Finding
+	expected := append(append([]corev1.Container{}, template.InitContainers...), template.Containers...)
+	for _, want := range expected {
+		got := findContainer(spec, want.Name)
+		if got == nil {
+			findings = append(findings, Finding{want.Name, "container", "in " + owner, "missing"})
+			continue
+		}
+		findings = appendIfDiffers(findings, want.Name, "image", want.Image, got.Image)
+		findings = appendIfDiffers(findings, want.Name, "command", formatCommand(want.Command), formatCommand(got.Command))
+		findings = appendIfDiffers(findings, want.Name, "args", formatCommand(want.Args), formatCommand(got.Args))
+
+		env := map[string]string{}
+		for _, e := range got.Env {
+			env[e.Name] = formatEnv(e)
+		}
+		for _, e := range want.Env {
+			value, ok := env[e.Name]
+			if !ok {
+				value = "(unset)"
+			}
+			findings = appendIfDiffers(findings, want.Name, "env "+e.Name, formatEnv(e), value)
+		}
+		findings = appendIfDiffers(findings, want.Name, "envFrom", formatEnvFrom(want.EnvFrom), formatEnvFrom(got.EnvFrom))
+	}
+	return findings
+}
+
+// appendIfDiffers appends a finding when the expected and actual values differ
+func appendIfDiffers(findings []Finding, container, check, expected, actual string) []Finding {
+	if expected == actual {
+		return findings
+	}
+	return append(findings, Finding{container, check, expected, actual})
+}
+
+// findContainer returns the init or app container of spec with the given name
+func findContainer(spec *corev1.PodSpec, name string) *corev1.Container {
+	for _, list := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for i := range list {
+			if list[i].Name == name {
+				return &list[i]
+			}
+		}
+	}
+	return nil
+}
+
+// formatCommand joins a command or args, quoting words with spaces
+func formatCommand(words []string) string {
+	if len(words) == 0 {
+		return "(image default)"
+	}
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		if w == "" || strings.ContainsAny(w, " \t\n'\"") {
+			w = fmt.Sprintf("%q", w)
+		}
+		quoted[i] = w
+	}
+	return strings.Join(quoted, " ")
+}
+
+// formatEnv describes the value of an env var, or where it comes from
+func formatEnv(e corev1.EnvVar) string {
+	from := e.ValueFrom
+	switch {
+	case from == nil:
+		return e.Value
+	case from.ConfigMapKeyRef != nil:
+		return fmt.Sprintf("configmap/%s key %s", from.ConfigMapKeyRef.Name, from.ConfigMapKeyRef.Key)
+	case from.SecretKeyRef != nil:
+		return fmt.Sprintf("secret/%s key %s", from.SecretKeyRef.Name, from.SecretKeyRef.Key)
+	case from.FieldRef != nil:
+		return "field " + from.FieldRef.FieldPath
+	case from.ResourceFieldRef != nil:
+		return "resource " + from.ResourceFieldRef.Resource
+	}
+	return ""
+}
+
+// formatEnvFrom lists the sources of envFrom
+func formatEnvFrom(sources []corev1.EnvFromSource) string {
+	if len(sources) == 0 {
+		return "(none)"
+	}
+	names := make([]string, 0, len(sources))
+	for _, s := range sources {
+		name := ""
+		switch {
+		case s.ConfigMapRef != nil:
+			name = "configmap/" + s.ConfigMapRef.Name
+		case s.SecretRef != nil:
+			name = "secret/" + s.SecretRef.Name
+		}
+		if s.Prefix != "" {
+			name += " prefix " + s.Prefix
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// digestFindings compares the image digests the containers run with the
+// digest the spec pins, the registry serves or the newest sibling runs
+func (c *Checker) digestFindings(ctx context.Context, pod *corev1.Pod, owner workloads.Workload) ([]Finding, []string, error) {
+	var findings []Finding
+	var warnings []string
+	for _, status := range runningStatuses(pod) {
+		container := findContainer(&pod.Spec, status.Name)
+		running := repoDigest(status.ImageID)
+		if container == nil || running == "" {
+			continue
+		}
+		ref, err := imagepolicy.Parse(container.Image)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case ref.Digest != "":
+			findings = appendIfDiffers(findings, status.Name, "digest", shortDigest(ref.Digest)+" (pinned)", shortDigest(running))
+		case c.registry:
+			digest, ok := c.digests[container.Image]
+			if !ok {
+				if digest, err = imagepolicy.Digest(ctx, container.Image); err != nil {
+					warnings = append(warnings, fmt.Sprintf("%s: %v", status.Name, err))
+				}
+				c.digests[container.Image] = digest
+			}
+			if digest != "" {
+				findings = appendIfDiffers(findings, status.Name, "digest", shortDigest(digest)+" (registry)", shortDigest(running))
+			}
+		case owner != nil:
+			siblings, err := c.ownerPods(ctx, pod.Namespace, owner)
+			if err != nil {
+				return nil, nil, err
+			}
+			newest, count, total := newestDigest(siblings, status.Name, container.Image)
+			if newest != "" && newest != running {
+				expected := fmt.Sprintf("%s (newest, %d of %d pods)", shortDigest(newest), count, total)
+				findings = append(findings, Finding{status.Name, "digest", expected, shortDigest(running)})
+			}
+		}
+	}
+	return findings, warnings, nil
+}
+
+// ownerPods lists the pods of a workload
+func (c *Checker) ownerPods(ctx context.Context, namespace string, owner workloads.Workload) ([]corev1.Pod, error) {
+	key := namespace + "/" + owner.Kind() + "/" + owner.GetName()
+	if pods, ok := c.siblings[key]; ok {
+		return pods, nil
+	}
+	selector, err := owner.Selector()
+	if err != nil {
+		return nil, err
+	}
+	list, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of %s %s: %w", strings.ToLower(owner.Kind()), owner.GetName(), err)
+	}
+	c.siblings[key] = list.Items
+	return list.Items, nil
+}
+
+// newestDigest returns the digest run by the most recently started container
+// with the given name and image, and how many of the containers run it. A tag
+// pushed again after some pods pulled it shows up as differing digests.
+func newestDigest(pods []corev1.Pod, name, image string) (string, int, int) {
+	var newest string
+	var newestStart time.Time
+	counts := map[string]int{}
+	total := 0
+	for i := range pods {
+		container := findContainer(&pods[i].Spec, name)
+		if container == nil || container.Image != image {
+			continue
+		}
+		for _, status := range runningStatuses(&pods[i]) {
+			digest := repoDigest(status.ImageID)
+			if status.Name != name || digest == "" {
+				continue
+			}
+			counts[digest]++
+			total++
+			if started := status.State.Running.StartedAt.Time; newest == "" || started.After(newestStart) {
+				newest, newestStart = digest, started
+			}
+		}
+	}
+	return newest, counts[newest], total
+}
+
+// runningStatuses returns the statuses of the running init and app containers
+func runningStatuses(pod *corev1.Pod) []corev1.ContainerStatus {
+	var running []corev1.ContainerStatus
+	for _, list := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range list {
+			if status.State.Running != nil {
+				running = append(running, status)
+			}
+		}
+	}
+	return running
+}
+
+// repoDigest returns the registry digest of an imageID like
+// docker.io/library/nginx@sha256:... or docker-pullable://nginx@sha256:...
+// Local image IDs without a repository digest return "".
+func repoDigest(imageID string) string {
+	if _, digest, ok := strings.Cut(imageID, "@"); ok {
+		return digest
+	}
+	return ""
+}
+
+// shortDigest shortens sha256:<64 hex> to sha256:<12 hex>
+func shortDigest(digest string) string {
+	if algorithm, hex, ok := strings.Cut(digest, ":"); ok && len(hex) > 12 {
+		return algorithm + ":" + hex[:12]
+	}
+	return digest
+}
+
+// configFindings reports ConfigMaps and Secrets changed after a container
+// started that the container only reads at start: env vars, envFrom and
+// subPath mounts. Other volume mounts are updated by the kubelet.
+func (c *Checker) configFindings(ctx context.Context, pod *corev1.Pod, now time.Time) ([]Finding, []string) {
+	var findings []Finding
+	var warnings []string
+	for _, status := range runningStatuses(pod) {
+		container := findContainer(&pod.Spec, status.Name)
+		if container == nil {
+			continue
+		}
+		started := status.State.Running.StartedAt.Time
+		refs := startupRefs(pod, container)
+		for _, ref := range sortedKeys(refs) {
+			modified, err := c.lastModified(ctx, pod.Namespace, ref)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: cannot check %s: %v", status.Name, ref, err))
+				continue
+			}
+			if modified.After(started) {
+				expected := fmt.Sprintf("changed %s ago (%s)", utils.FormatAge(now.Sub(modified)), refs[ref])
+				actual := fmt.Sprintf("started %s ago", utils.FormatAge(now.Sub(started)))
+				findings = append(findings, Finding{status.Name, ref, expected, actual})
+			}
+		}
+	}
+	return findings, warnings
+}
+
+// startupRefs returns the ConfigMaps and Secrets a container reads at start,
+// as configmap/NAME or secret/NAME with how they are used
+func startupRefs(pod *corev1.Pod, container *corev1.Container) map[string]string {
+	refs := map[string]string{}
+	use := func(ref, how string) {
+		if refs[ref] == "" {
+			refs[ref] = how
+		}
+	}
+	for _, e := range container.Env {
+		switch from := e.ValueFrom; {
+		case from == nil:
+		case from.ConfigMapKeyRef != nil:
+			use("configmap/"+from.ConfigMapKeyRef.Name, "env")
+		case from.SecretKeyRef != nil:
+			use("secret/"+from.SecretKeyRef.Name, "env")
+		}
+	}
+	for _, s := range container.EnvFrom {
+		switch {
+		case s.ConfigMapRef != nil:
+			use("configmap/"+s.ConfigMapRef.Name, "envFrom")
+		case s.SecretRef != nil:
+			use("secret/"+s.SecretRef.Name, "envFrom")
+		}
+	}
+
+	volumes := map[string]corev1.Volume{}
+	for _, v := range pod.Spec.Volumes {
+		volumes[v.Name] = v
+	}
+	for _, m := range container.VolumeMounts {
+		if m.SubPath == "" && m.SubPathExpr == "" {
+			continue
+		}
+		v := volumes[m.Name]
+		switch {
+		case v.ConfigMap != nil:
+			use("configmap/"+v.ConfigMap.Name, "subPath")
+		case v.Secret != nil:
+			use("secret/"+v.Secret.SecretName, "subPath")
+		case v.Projected != nil:
+			for _, s := range v.Projected.Sources {
+				switch {
+				case s.ConfigMap != nil:
+					use("configmap/"+s.ConfigMap.Name, "subPath")
+				case s.Secret != nil:
+					use("secret/"+s.Secret.Name, "subPath")
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// lastModified returns when a ConfigMap or Secret was last written. Objects
+// have no modification time; the newest managed fields entry is the closest,
+// the creation time when there are none. Missing objects (optional
+// references) return the zero time.
+func (c *Checker) lastModified(ctx context.Context, namespace, ref string) (time.Time, error) {
+	key := namespace + "/" + ref
+	if t, ok := c.modified[key]; ok {
+		return t, nil
+	}
+	if err, ok := c.failed[key]; ok {
+		return time.Time{}, err
+	}
+	kind, name, _ := strings.Cut(ref, "/")
+	var meta *metav1.ObjectMeta
+	var err error
+	if kind == "configmap" {
+		var cm *corev1.ConfigMap
+		if cm, err = c.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			meta = &cm.ObjectMeta
+		}
+	} else {
+		var secret *corev1.Secret
+		if secret, err = c.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			meta = &secret.ObjectMeta
+		}
+	}
+	if apierrors.IsNotFound(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		c.failed[key] = err
+		return time.Time{}, err
+	}
+
+	modified := meta.CreationTimestamp.Time
+	for _, entry := range meta.ManagedFields {
+		if entry.Time != nil && entry.Time.After(modified) {
+			modified = entry.Time.Time
+		}
+	}
+	c.modified[key] = modified
+	return modified, nil
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
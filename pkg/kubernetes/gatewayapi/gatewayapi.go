@@ -0,0 +1,410 @@
+package gatewayapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+// Group is the API group of the Gateway API resources
+const Group = "gateway.networking.k8s.io"
+
+// GatewayClass is the subset of a GatewayClass the tools show
+type GatewayClass struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		ControllerName string `json:"controllerName"`
+	} `json:"spec"`
+	Status struct {
+		Conditions []metav1.Condition `json:"conditions"`
+	} `json:"status"`
+}
+
+// Gateway is the subset of a Gateway the tools show
+type Gateway struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		GatewayClassName string     `json:"gatewayClassName"`
+		Listeners        []Listener `json:"listeners"`
+	} `json:"spec"`
+	Status struct {
+		Addresses []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"addresses"`
+		Conditions []metav1.Condition `json:"conditions"`
+		Listeners  []ListenerStatus   `json:"listeners"`
+	} `json:"status"`
+}
+
+// Listener is a port, protocol and hostname a Gateway accepts traffic on
+type Listener struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+	Port     int32  `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// ListenerStatus is the status the controller reports for a listener
+type ListenerStatus struct {
+	Name           string             `json:"name"`
+	AttachedRoutes int32              `json:"attachedRoutes"`
+	Conditions     []metav1.Condition `json:"conditions"`
+}
+
+// HTTPRoute is the subset of an HTTPRoute the tools show
+type HTTPRoute struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		ParentRefs []ParentRef `json:"parentRefs"`
+		Hostnames  []string    `json:"hostnames"`
+		Rules      []struct {
+			BackendRefs []BackendRef `json:"backendRefs"`
+		} `json:"rules"`
+	} `json:"spec"`
+	Status struct {
+		Parents []RouteParentStatus `json:"parents"`
+	} `json:"status"`
+}
+
+// ParentRef names the Gateway (and optionally the listener) a route attaches to
+type ParentRef struct {
+	Group       *string `json:"group"`
+	Kind        *string `json:"kind"`
+	Namespace   string  `json:"namespace"`
+	Name        string  `json:"name"`
+	SectionName string  `json:"sectionName"`
+	Port        *int32  `json:"port"`
+}
+
+// BackendRef is a Service (or other backend) traffic of a rule is sent to
+type BackendRef struct {
+	Group     *string `json:"group"`
+	Kind      *string `json:"kind"`
+	Namespace string  `json:"namespace"`
+	Name      string  `json:"name"`
+	Port      *int32  `json:"port"`
+	Weight    *int32  `json:"weight"`
+}
+
+// RouteParentStatus is the status a controller reports for one parent of a route
+type RouteParentStatus struct {
+	ParentRef      ParentRef          `json:"parentRef"`
+	ControllerName string             `json:"controllerName"`
+	Conditions     []metav1.Condition `json:"conditions"`
+}
+
+// Reader lists Gateway API resources with the dynamic client, in the version
+// the cluster serves (v1, or v1beta1 on older installations)
+type Reader struct {
+	client *k8s.Client
+	dyn    dynamic.Interface
+}
+
+// NewReader returns a Reader for the cluster of client
+func NewReader(client *k8s.Client) (*Reader, error) {
+	dyn, err := client.Dynamic()
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{client: client, dyn: dyn}, nil
+}
+
+// GatewayClasses lists all GatewayClasses
+func (r *Reader) GatewayClasses(ctx context.Context) ([]GatewayClass, error) {
+	var list struct {
+		Items []GatewayClass `json:"items"`
+	}
+	err := r.list(ctx, "gatewayclasses", "", &list)
+	sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Name < list.Items[j].Name })
+	return list.Items, err
+}
+
+// Gateways lists the Gateways of namespace, all namespaces when empty
+func (r *Reader) Gateways(ctx context.Context, namespace string) ([]Gateway, error) {
+	var list struct {
+		Items []Gateway `json:"items"`
+	}
+	err := r.list(ctx, "gateways", namespace, &list)
+	sort.Slice(list.Items, func(i, j int) bool { return lessMeta(&list.Items[i].ObjectMeta, &list.Items[j].ObjectMeta) })
+	return list.Items, err
+}
+
+// HTTPRoutes lists the HTTPRoutes of namespace, all namespaces when empty
+func (r *Reader) HTTPRoutes(ctx context.Context, namespace string) ([]HTTPRoute, error) {
+	var list struct {
+		Items []HTTPRoute `json:"items"`
+	}
+	err := r.list(ctx, "httproutes", namespace, &list)
+	sort.Slice(list.Items, func(i, j int) bool { return lessMeta(&list.Items[i].ObjectMeta, &list.Items[j].ObjectMeta) })
+	return list.Items, err
+}
+
+// list reads a resource of the group into out, a struct with an Items field
+func (r *Reader) list(ctx context.Context, resource, namespace string, out interface{}) error {
+	mapping, err := r.client.ResolveResource(resource + "." + Group)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return clierr.Newf(clierr.NotFound, "the Gateway API is not installed in this cluster (no %s.%s resource)", resource, Group)
+		}
+		return err
+	}
+	list, err := r.dyn.Resource(mapping.Resource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", resource, err)
+	}
+	data, err := list.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", resource, err)
+	}
+	return nil
+}
+
+// lessMeta orders objects by namespace and name
+func lessMeta(a, b *metav1.ObjectMeta) bool {
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
+
+// ConditionSummary formats the status of a condition type as True, False
+// with its reason, or Unknown when not reported yet
+func ConditionSummary(conditions []metav1.Condition, conditionType string) (metav1.ConditionStatus, string) {
+	c := meta.FindStatusCondition(conditions, conditionType)
+	switch {
+	case c == nil:
+		return metav1.ConditionUnknown, "Unknown"
+	case c.Status == metav1.ConditionTrue:
+		return c.Status, "True"
+	case c.Reason != "":
+		return c.Status, string(c.Status) + " (" + c.Reason + ")"
+	}
+	return c.Status, string(c.Status)
+}
+
+// ListenerConflicts returns the conflict of every conflicting listener by
+// name. Conflicts the controller reports (Conflicted=True) are used as they
+// are; the spec is checked as well, since a Gateway whose controller is down
+// or missing reports nothing: listeners sharing a port need compatible
+// protocols (the same, or HTTPS and TLS) that are told apart by hostname
+// (not TCP or UDP), and distinct hostnames.
+func ListenerConflicts(gw *Gateway) map[string]string {
+	conflicts := map[string]string{}
+	for _, status := range gw.Status.Listeners {
+		if c := meta.FindStatusCondition(status.Conditions, "Conflicted"); c != nil && c.Status == metav1.ConditionTrue {
+			conflicts[status.Name] = c.Reason
+		}
+	}
+
+	byPort := map[int32][]Listener{}
+	for _, l := range gw.Spec.Listeners {
+		byPort[l.Port] = append(byPort[l.Port], l)
+	}
+	for port, listeners := range byPort {
+		if len(listeners) < 2 {
+			continue
+		}
+		for i, l := range listeners {
+			for j, other := range listeners {
+				if i == j {
+					continue
+				}
+				reason := ""
+				switch {
+				case protocolFamily(l.Protocol) != protocolFamily(other.Protocol) || !shareable(l.Protocol):
+					reason = fmt.Sprintf("ProtocolConflict with %s on port %d", other.Name, port)
+				case l.Hostname == other.Hostname:
+					reason = fmt.Sprintf("HostnameConflict with %s on port %d", other.Name, port)
+				}
+				if reason != "" && conflicts[l.Name] == "" {
+					conflicts[l.Name] = reason
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// protocolFamily groups the protocols that can share a port
+func protocolFamily(protocol string) string {
+	if protocol == "TLS" {
+		return "HTTPS"
+	}
+	return protocol
+}
+
+// shareable reports whether listeners of protocol can share a port by hostname
+func shareable(protocol string) bool {
+	switch protocol {
+	case "HTTP", "HTTPS", "TLS":
+		return true
+	}
+	return false
+}
+
+// Attachment is the state of a route at one of its parents
+type Attachment struct {
+	Parent string
+	// State is Accepted, NotAccepted, RefsUnresolved or Pending (no status
+	// from a controller yet)
+	State  string
+	Reason string
+}
+
+// Attachments returns the state of a route at each of its parentRefs
+func Attachments(route *HTTPRoute) []Attachment {
+	var attachments []Attachment
+	for _, ref := range route.Spec.ParentRefs {
+		a := Attachment{Parent: FormatParent(route.Namespace, ref), State: "Pending"}
+		for _, status := range route.Status.Parents {
+			if !sameParent(route.Namespace, ref, status.ParentRef) {
+				continue
+			}
+			accepted := meta.FindStatusCondition(status.Conditions, "Accepted")
+			resolved := meta.FindStatusCondition(status.Conditions, "ResolvedRefs")
+			switch {
+			case accepted == nil:
+			case accepted.Status != metav1.ConditionTrue:
+				a.State, a.Reason = "NotAccepted", accepted.Reason
+			case resolved != nil && resolved.Status != metav1.ConditionTrue:
+				a.State, a.Reason = "RefsUnresolved", resolved.Reason
+			default:
+				a.State = "Accepted"
+			}
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments
+}
+
+// FormatParent formats a parentRef as [namespace/]name[/section][:port]
+func FormatParent(routeNamespace string, ref ParentRef) string {
+	name := ref.Name
+	if ref.Namespace != "" && ref.Namespace != routeNamespace {
+		name = ref.Namespace + "/" + name
+	}
+	if ref.SectionName != "" {
+		name += "/" + ref.SectionName
+	}
+	if ref.Port != nil {
+		name += fmt.Sprintf(":%d", *ref.Port)
+	}
+	return name
+}
+
+// sameParent compares a parentRef of the spec with one of the status
+func sameParent(routeNamespace string, a, b ParentRef) bool {
+	namespace := func(ref ParentRef) string {
+		if ref.Namespace == "" {
+			return routeNamespace
+		}
+		return ref.Namespace
+	}
+	return a.Name == b.Name && namespace(a) == namespace(b) && a.SectionName == b.SectionName &&
+		((a.Port == nil) == (b.Port == nil)) && (a.Port == nil || *a.Port == *b.Port)
+}
+
+// IsService reports whether a backendRef points at a core Service, the default
+func (b BackendRef) IsService() bool {
+	return (b.Group == nil || *b.Group == "") && (b.Kind == nil || *b.Kind == "Service")
+}
+
+// Backend is the health of a Service a route sends traffic to
+type Backend struct {
+	Namespace string
+	Name      string
+	Port      int32
+	// Found is false when the Service does not exist
+	Found    bool
+	Ready    int
+	NotReady int
+}
+
+// BackendChecker counts the ready endpoints of backend Services, caching per
+// Service since many rules share backends
+type BackendChecker struct {
+	client *k8s.Client
+	cache  map[string]Backend
+}
+
+// NewBackendChecker returns a BackendChecker
+func NewBackendChecker(client *k8s.Client) *BackendChecker {
+	return &BackendChecker{client: client, cache: map[string]Backend{}}
+}
+
+// Check returns the health of a Service backendRef of a route in namespace
+func (c *BackendChecker) Check(ctx context.Context, namespace string, ref BackendRef) (Backend, error) {
+	if ref.Namespace != "" {
+		namespace = ref.Namespace
+	}
+	b := Backend{Namespace: namespace, Name: ref.Name}
+	if ref.Port != nil {
+		b.Port = *ref.Port
+	}
+	key := fmt.Sprintf("%s/%s:%d", b.Namespace, b.Name, b.Port)
+	if cached, ok := c.cache[key]; ok {
+		return cached, nil
+	}
+
+	svc, err := c.client.Clientset.CoreV1().Services(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		c.cache[key] = b
+		return b, nil
+	}
+	if err != nil {
+		return b, fmt.Errorf("failed to get service %s/%s: %w", namespace, ref.Name, err)
+	}
+	b.Found = true
+
+	// Endpoints are published per port name, find the name of the port
+	portName := ""
+	for _, p := range svc.Spec.Ports {
+		if p.Port == b.Port {
+			portName = p.Name
+		}
+	}
+	slices, err := c.client.Clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + svc.Name,
+	})
+	if err != nil {
+		return b, fmt.Errorf("failed to list endpointslices: %w", err)
+	}
+	for _, slice := range slices.Items {
+		if !slicePublishes(slice, portName) {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready == nil || *ep.Conditions.Ready {
+				b.Ready++
+			} else {
+				b.NotReady++
+			}
+		}
+	}
+	c.cache[key] = b
+	return b, nil
+}
+
+// slicePublishes reports whether an EndpointSlice has the named port
+func slicePublishes(slice discoveryv1.EndpointSlice, portName string) bool {
+	for _, p := range slice.Ports {
+		if p.Name != nil && *p.Name == portName {
+			return true
+		}
+	}
+	return false
+}
@@ -4,12 +4,12 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"path/filepath"
+	"sync"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 )
 
 // Client wraps Kubernetes client with helper methods
@@ -17,6 +17,14 @@ type Client struct {
 	Clientset *kubernetes.Clientset
 	Config    *rest.Config
 	Context   context.Context
+
+	// contextName is the context the client was created for, "" for the
+	// current one
+	contextName string
+
+	// mapper caches discovery for ResolveResource
+	mapper     meta.RESTMapper
+	mapperOnce sync.Once
 }
 
 // NewClient creates a new Kubernetes client
@@ -26,15 +34,18 @@ func NewClient(kubeconfig string, contextName string) (*Client, error) {
 	var err error
 
 	if kubeconfig == "" {
-		// Try to find kubeconfig file at default location
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfig = filepath.Join(home, ".kube", "config")
-		}
+		// Try to find kubeconfig file from KUBECONFIG or default location
+		kubeconfig = KubeconfigPath()
 	}
 
-	// Check if running inside cluster
-	if _, err := os.Stat("/var/run/secrets/kubernetes.io/serviceaccount/token"); err == nil {
-		// Use in-cluster config
+	if FromDir != "" {
+		// Offline: answer from exported manifests, kubeconfig is not needed
+		config, err = offlineConfig(FromDir)
+		if err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat("/var/run/secrets/kubernetes.io/serviceaccount/token"); err == nil {
+		// Running inside cluster, use in-cluster config
 		config, err = rest.InClusterConfig()
 		if err != nil {
 			return nil, fmt.Errorf("failed to create in-cluster config: %w", err)
@@ -65,6 +76,12 @@ func NewClient(kubeconfig string, contextName string) (*Client, error) {
 		}
 	}
 
+	if err := applyRateLimit(config); err != nil {
+		return nil, err
+	}
+	wrapVerbose(config)
+	wrapTracing(config)
+
 	// Create clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -72,9 +89,10 @@ func NewClient(kubeconfig string, contextName string) (*Client, error) {
 	}
 
 	return &Client{
-		Clientset: clientset,
-		Config:    config,
-		Context:   context.Background(),
+		Clientset:   clientset,
+		Config:      config,
+		Context:     context.Background(),
+		contextName: contextName,
 	}, nil
 }
 
@@ -85,18 +103,17 @@ func (c *Client) SetNamespace(namespace string) {
 }
 
 // GetCurrentNamespace returns current namespace from kubeconfig for specified context.
-// If namespace is not found, returns "default".
+// If namespace is not found, or when reading from --from-dir, returns "default".
 func GetCurrentNamespace(contextName string) (string, error) {
-	// Determine default kubeconfig path
-	kubeconfigPath := ""
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfigPath = filepath.Join(home, ".kube", "config")
+	// A snapshot has no context to take the namespace from
+	if FromDir != "" {
+		return "default", nil
 	}
 
 	// Load raw config from kubeconfig
-	rawCfg, err := clientcmd.LoadFromFile(kubeconfigPath)
+	rawCfg, err := LoadRawConfig()
 	if err != nil {
-		return "", fmt.Errorf("failed to load kubeconfig: %w", err)
+		return "", err
 	}
 
 	// Determine context to use
@@ -0,0 +1,99 @@
+package k8s
+
+import (
+	"os"
+	"strconv"
+	"sync"
+
+	"kube/pkg/shared/clierr"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/rest"
+)
+
+// Client rate limit defaults. client-go's own 5 QPS makes tools that list
+// many namespaces or contexts crawl, unlimited clients cause the API server
+// to throttle everyone with 429s.
+const (
+	DefaultQPS   = 50
+	DefaultBurst = 100
+)
+
+// MaxParallel is the number of contexts or namespaces fan-out features work
+// on at once
+const MaxParallel = 8
+
+var (
+	// QPS is the sustained request rate of a client, -1 disables the limit
+	QPS float32 = DefaultQPS
+	// Burst is the number of requests a client may send at once above QPS
+	Burst int = DefaultBurst
+)
+
+// sharedClients are the clients of SharedClient by context name
+var (
+	sharedClientsMu sync.Mutex
+	sharedClients   = map[string]*Client{}
+)
+
+// AddRateLimitFlags registers the persistent --qps and --burst flags on the
+// command. KUBE_QPS and KUBE_BURST are used as defaults.
+func AddRateLimitFlags(cmd *cobra.Command) {
+	qps := float64(DefaultQPS)
+	if v, err := strconv.ParseFloat(os.Getenv("KUBE_QPS"), 32); err == nil {
+		qps = v
+	}
+	burst := DefaultBurst
+	if v, err := strconv.Atoi(os.Getenv("KUBE_BURST")); err == nil {
+		burst = v
+	}
+	cmd.PersistentFlags().Float32Var(&QPS, "qps", float32(qps), "Maximum API requests per second per cluster (-1 for no limit)")
+	cmd.PersistentFlags().IntVar(&Burst, "burst", burst, "API requests allowed at once above --qps")
+}
+
+// applyRateLimit sets QPS and Burst on config
+func applyRateLimit(config *rest.Config) error {
+	switch {
+	case QPS == 0 || QPS < -1:
+		return clierr.Usagef("--qps must be positive, or -1 for no limit")
+	case QPS > 0 && Burst < 1:
+		return clierr.Usagef("--burst must be at least 1")
+	}
+	config.QPS = QPS
+	config.Burst = Burst
+	return nil
+}
+
+// SharedClient returns one client per context for the whole command, so
+// requests to a cluster share its rate limit and discovery cache no matter
+// how many namespaces or goroutines use it. The client must not be changed.
+func SharedClient(contextName string) (*Client, error) {
+	sharedClientsMu.Lock()
+	defer sharedClientsMu.Unlock()
+	if client, ok := sharedClients[contextName]; ok {
+		return client, nil
+	}
+	client, err := NewClient("", contextName)
+	if err != nil {
+		return nil, err
+	}
+	sharedClients[contextName] = client
+	return client, nil
+}
+
+// FanOut calls fn for 0..n-1 with at most MaxParallel calls running at once
+// and returns when all of them did
+func FanOut(n int, fn func(i int)) {
+	sem := make(chan struct{}, MaxParallel)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,57 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/util/homedir"
+)
+
+// KubeconfigPath returns path to the kubeconfig file used by the tools.
+// The first entry of KUBECONFIG takes precedence over ~/.kube/config.
+func KubeconfigPath() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		for _, p := range filepath.SplitList(env) {
+			if p != "" {
+				return p
+			}
+		}
+	}
+
+	if home := homedir.HomeDir(); home != "" {
+		return filepath.Join(home, ".kube", "config")
+	}
+
+	return ""
+}
+
+// LoadRawConfig loads the kubeconfig returned by KubeconfigPath
+func LoadRawConfig() (*api.Config, error) {
+	config, err := clientcmd.LoadFromFile(KubeconfigPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	return config, nil
+}
+
+// MinifyForContext returns a copy of config that only contains the given
+// context and the cluster and user it references. Relative certificate, key,
+// token and exec paths are made absolute so the copy can be written anywhere.
+func MinifyForContext(config *api.Config, contextName string) (*api.Config, error) {
+	if _, ok := config.Contexts[contextName]; !ok {
+		return nil, fmt.Errorf("context '%s' not found", contextName)
+	}
+
+	minified := config.DeepCopy()
+	minified.CurrentContext = contextName
+	if err := api.MinifyConfig(minified); err != nil {
+		return nil, fmt.Errorf("failed to minify kubeconfig: %w", err)
+	}
+	if err := clientcmd.ResolveLocalPaths(minified); err != nil {
+		return nil, fmt.Errorf("failed to resolve kubeconfig paths: %w", err)
+	}
+	return minified, nil
+}
@@ -0,0 +1,440 @@
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+// FromDir is a directory of exported manifests that clients read from
+// instead of a cluster, set by --from-dir
+var FromDir string
+
+// AddFromDirFlag registers the persistent --from-dir flag on the command, for
+// tools that only read and can work on a snapshot of a cluster
+func AddFromDirFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&FromDir, "from-dir", "", "Read resources from a directory of exported YAML or JSON instead of the cluster")
+}
+
+// snapshotClusterDir holds cluster-scoped resources in kube-export output
+const snapshotClusterDir = "_cluster"
+
+// irregularResources are kinds whose resource name is not the guessed plural
+var irregularResources = map[string]string{
+	"Endpoints": "endpoints",
+}
+
+// offlineConfig returns a config whose requests are answered from the
+// manifests below dir. Any layout works: kube-export output, files of
+// 'kubectl get -o yaml' lists or a 'kubectl cluster-info dump' directory.
+func offlineConfig(dir string) (*rest.Config, error) {
+	snapshot, err := loadSnapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &rest.Config{Host: "http://snapshot", Transport: snapshot}, nil
+}
+
+// snapshotResource is a resource type found in a snapshot
+type snapshotResource struct {
+	gvr        schema.GroupVersionResource
+	kind       string
+	namespaced bool
+	objects    []*unstructured.Unstructured
+}
+
+// snapshot serves GET requests from manifests read from a directory. It is
+// read-only: writes, watches and streaming subresources are refused.
+type snapshot struct {
+	dir string
+	// resources by group and resource name, objects of any version
+	resources map[schema.GroupResource]*snapshotResource
+}
+
+// loadSnapshot reads every YAML and JSON manifest below dir
+func loadSnapshot(dir string) (*snapshot, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("snapshot %s is not a directory", dir)
+	}
+
+	var objects []*unstructured.Unstructured
+	// Directory of an object in kube-export layout, for objects without namespace
+	dirNamespace := map[*unstructured.Unstructured]string{}
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		found, err := decodeManifests(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		rel, _ := filepath.Rel(dir, path)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		for _, obj := range found {
+			if len(parts) == 3 {
+				dirNamespace[obj] = parts[0]
+			}
+		}
+		objects = append(objects, found...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", dir, err)
+	}
+
+	// Plurals and scopes of custom resources come from their definitions
+	type crdNames struct {
+		plural     string
+		namespaced bool
+	}
+	crds := map[schema.GroupKind]crdNames{}
+	for _, obj := range objects {
+		if obj.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+		plural, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "plural")
+		scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+		crds[schema.GroupKind{Group: group, Kind: kind}] = crdNames{plural: plural, namespaced: scope == "Namespaced"}
+	}
+
+	s := &snapshot{dir: dir, resources: map[schema.GroupResource]*snapshotResource{}}
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+		if plural, ok := irregularResources[gvk.Kind]; ok {
+			gvr.Resource = plural
+		}
+		crd, isCRD := crds[gvk.GroupKind()]
+		if isCRD && crd.plural != "" {
+			gvr.Resource = crd.plural
+		}
+
+		if obj.GetNamespace() == "" && dirNamespace[obj] != "" && dirNamespace[obj] != snapshotClusterDir {
+			obj.SetNamespace(dirNamespace[obj])
+		}
+		r := s.resources[gvr.GroupResource()]
+		if r == nil {
+			r = &snapshotResource{gvr: gvr, kind: gvk.Kind, namespaced: isCRD && crd.namespaced}
+			s.resources[gvr.GroupResource()] = r
+		}
+		r.namespaced = r.namespaced || obj.GetNamespace() != ""
+		r.objects = append(r.objects, obj)
+	}
+
+	for _, r := range s.resources {
+		for _, obj := range r.objects {
+			if r.namespaced && obj.GetNamespace() == "" {
+				obj.SetNamespace("default")
+			}
+		}
+		sort.Slice(r.objects, func(i, j int) bool {
+			a, b := r.objects[i], r.objects[j]
+			if a.GetNamespace() != b.GetNamespace() {
+				return a.GetNamespace() < b.GetNamespace()
+			}
+			return a.GetName() < b.GetName()
+		})
+	}
+	return s, nil
+}
+
+// documentSeparator splits multi-document YAML
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// decodeManifests decodes the objects of a file, expanding lists. Documents
+// that are not Kubernetes objects (no kind or name) are skipped.
+func decodeManifests(data []byte) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	for _, doc := range documentSeparator.Split(string(data), -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		jsonData, err := yaml.YAMLToJSON([]byte(doc))
+		if err != nil {
+			return nil, err
+		}
+		var content map[string]interface{}
+		if err := json.Unmarshal(jsonData, &content); err != nil || content == nil {
+			continue
+		}
+		obj := &unstructured.Unstructured{Object: content}
+		if !obj.IsList() {
+			if obj.GetKind() != "" && obj.GetAPIVersion() != "" && obj.GetName() != "" {
+				objects = append(objects, obj)
+			}
+			continue
+		}
+
+		// Items of typed lists may leave out their kind
+		itemKind := strings.TrimSuffix(obj.GetKind(), "List")
+		list, err := obj.ToList()
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			item := &list.Items[i]
+			if item.GetKind() == "" && itemKind != "" {
+				item.SetKind(itemKind)
+			}
+			if item.GetAPIVersion() == "" {
+				item.SetAPIVersion(obj.GetAPIVersion())
+			}
+			if item.GetKind() != "" && item.GetName() != "" {
+				objects = append(objects, item)
+			}
+		}
+	}
+	return objects, nil
+}
+
+// RoundTrip answers a request from the snapshot
+func (s *snapshot) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return s.status(req, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed,
+			fmt.Sprintf("the snapshot %s is read-only", s.dir)), nil
+	}
+	if req.URL.Query().Get("watch") == "true" {
+		return s.status(req, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed,
+			"watching is not possible on a snapshot"), nil
+	}
+
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case req.URL.Path == "/version":
+		return s.respond(req, map[string]string{"major": "", "minor": "", "gitVersion": "snapshot", "platform": "snapshot"}), nil
+	case len(parts) == 1 && parts[0] == "api":
+		return s.respond(req, metav1.APIVersions{
+			TypeMeta: metav1.TypeMeta{Kind: "APIVersions"},
+			Versions: []string{"v1"},
+		}), nil
+	case len(parts) == 1 && parts[0] == "apis":
+		return s.respond(req, s.groups()), nil
+	case len(parts) == 2 && parts[0] == "api":
+		return s.respond(req, s.resourceList(schema.GroupVersion{Version: parts[1]})), nil
+	case len(parts) == 3 && parts[0] == "apis":
+		return s.respond(req, s.resourceList(schema.GroupVersion{Group: parts[1], Version: parts[2]})), nil
+	case len(parts) > 2 && parts[0] == "api":
+		return s.serve(req, schema.GroupVersion{Version: parts[1]}, parts[2:]), nil
+	case len(parts) > 3 && parts[0] == "apis":
+		return s.serve(req, schema.GroupVersion{Group: parts[1], Version: parts[2]}, parts[3:]), nil
+	}
+	return s.status(req, http.StatusNotFound, metav1.StatusReasonNotFound, "the server could not find the requested resource"), nil
+}
+
+// serve answers a list or get of a resource, path is what follows the version
+func (s *snapshot) serve(req *http.Request, gv schema.GroupVersion, path []string) *http.Response {
+	namespace := ""
+	if len(path) >= 3 && path[0] == "namespaces" && path[2] != "status" && path[2] != "finalize" {
+		namespace, path = path[1], path[2:]
+	}
+	resource, name, subresource := path[0], "", ""
+	if len(path) > 1 {
+		name = path[1]
+	}
+	if len(path) > 2 {
+		subresource = path[2]
+	}
+	if subresource != "" && subresource != "status" {
+		return s.status(req, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed,
+			fmt.Sprintf("%s/%s is not available on a snapshot", resource, subresource))
+	}
+
+	r := s.resources[schema.GroupResource{Group: gv.Group, Resource: resource}]
+	if r == nil && schemeKind(gv, resource) == "" {
+		// APIs such as metrics that the snapshot has nothing of are not installed
+		return s.status(req, http.StatusNotFound, metav1.StatusReasonNotFound, "the server could not find the requested resource")
+	}
+
+	if name != "" {
+		if r != nil {
+			for _, obj := range r.objects {
+				if obj.GetName() == name && obj.GetNamespace() == namespace {
+					return s.respond(req, obj.Object)
+				}
+			}
+		}
+		return s.status(req, http.StatusNotFound, metav1.StatusReasonNotFound,
+			fmt.Sprintf("%s %q not found in snapshot", resource, name))
+	}
+
+	labelSelector, err := labels.Parse(req.URL.Query().Get("labelSelector"))
+	if err != nil {
+		return s.status(req, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+	}
+	fieldSelector, err := fields.ParseSelector(req.URL.Query().Get("fieldSelector"))
+	if err != nil {
+		return s.status(req, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+	}
+
+	kind := schemeKind(gv, resource)
+	items := []interface{}{}
+	if r != nil {
+		kind = r.kind
+		for _, obj := range r.objects {
+			if namespace != "" && obj.GetNamespace() != namespace {
+				continue
+			}
+			if !labelSelector.Matches(labels.Set(obj.GetLabels())) || !fieldSelector.Matches(objectFields(obj, fieldSelector)) {
+				continue
+			}
+			items = append(items, obj.Object)
+		}
+	}
+	return s.respond(req, map[string]interface{}{
+		"apiVersion": gv.String(),
+		"kind":       kind + "List",
+		"metadata":   map[string]interface{}{"resourceVersion": "0"},
+		"items":      items,
+	})
+}
+
+// schemeKind returns the kind of a built-in resource, so that resources the
+// snapshot has no objects of list as empty
+func schemeKind(gv schema.GroupVersion, resource string) string {
+	for gvk := range scheme.Scheme.AllKnownTypes() {
+		if gvk.GroupVersion() != gv || strings.HasSuffix(gvk.Kind, "List") {
+			continue
+		}
+		guessed, _ := meta.UnsafeGuessKindToResource(gvk)
+		if plural, ok := irregularResources[gvk.Kind]; ok {
+			guessed.Resource = plural
+		}
+		if guessed.Resource == resource {
+			return gvk.Kind
+		}
+	}
+	return ""
+}
+
+// objectFields returns the fields a field selector refers to, read from the
+// object by their path (metadata.name, spec.nodeName, status.phase)
+func objectFields(obj *unstructured.Unstructured, selector fields.Selector) fields.Set {
+	set := fields.Set{}
+	for _, req := range selector.Requirements() {
+		value, found, _ := unstructured.NestedFieldNoCopy(obj.Object, strings.Split(req.Field, ".")...)
+		if found {
+			set[req.Field] = fmt.Sprint(value)
+		}
+	}
+	return set
+}
+
+// groups returns the API groups of the snapshot for discovery
+func (s *snapshot) groups() *metav1.APIGroupList {
+	versions := map[string]map[string]bool{}
+	for _, r := range s.resources {
+		if r.gvr.Group == "" {
+			continue
+		}
+		if versions[r.gvr.Group] == nil {
+			versions[r.gvr.Group] = map[string]bool{}
+		}
+		versions[r.gvr.Group][r.gvr.Version] = true
+	}
+
+	list := &metav1.APIGroupList{TypeMeta: metav1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"}}
+	for group, vs := range versions {
+		g := metav1.APIGroup{Name: group}
+		for v := range vs {
+			g.Versions = append(g.Versions, metav1.GroupVersionForDiscovery{GroupVersion: group + "/" + v, Version: v})
+		}
+		sort.Slice(g.Versions, func(i, j int) bool { return g.Versions[i].Version < g.Versions[j].Version })
+		g.PreferredVersion = g.Versions[len(g.Versions)-1]
+		list.Groups = append(list.Groups, g)
+	}
+	sort.Slice(list.Groups, func(i, j int) bool { return list.Groups[i].Name < list.Groups[j].Name })
+	return list
+}
+
+// resourceList returns the resources of a group version for discovery
+func (s *snapshot) resourceList(gv schema.GroupVersion) *metav1.APIResourceList {
+	list := &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: gv.String(),
+	}
+	for _, r := range s.resources {
+		if r.gvr.GroupVersion() != gv {
+			continue
+		}
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:       r.gvr.Resource,
+			Kind:       r.kind,
+			Namespaced: r.namespaced,
+			Verbs:      metav1.Verbs{"get", "list"},
+		})
+	}
+	sort.Slice(list.APIResources, func(i, j int) bool { return list.APIResources[i].Name < list.APIResources[j].Name })
+	return list
+}
+
+// respond returns body as a JSON response
+func (s *snapshot) respond(req *http.Request, body interface{}) *http.Response {
+	return s.response(req, http.StatusOK, body)
+}
+
+// status returns an API error response
+func (s *snapshot) status(req *http.Request, code int, reason metav1.StatusReason, message string) *http.Response {
+	return s.response(req, code, &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Code:     int32(code),
+		Reason:   reason,
+		Message:  message,
+	})
+}
+
+// response encodes body into a response to req
+func (s *snapshot) response(req *http.Request, code int, body interface{}) *http.Response {
+	data, err := json.Marshal(body)
+	if err != nil {
+		code = http.StatusInternalServerError
+		data = []byte(err.Error())
+	}
+	return &http.Response{
+		StatusCode: code,
+		Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(data)),
+		Request:    req,
+	}
+}
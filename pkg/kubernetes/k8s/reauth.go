@@ -0,0 +1,102 @@
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"kube/pkg/shared/utils"
+
+	"golang.org/x/term"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// reauthMu makes concurrent callers wait for one re-authentication instead
+// of prompting at the same time
+var reauthMu sync.Mutex
+
+// IsAuthError reports whether the API server rejected the credentials, or
+// the credential plugin could not get new ones, e.g. when an SSO token
+// expired during a long session
+func IsAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if apierrors.IsUnauthorized(err) {
+		return true
+	}
+	// Stream upgrades (exec, attach, port-forward) report the status as text
+	msg := err.Error()
+	return strings.Contains(msg, "Unauthorized") ||
+		strings.Contains(msg, "the server has asked for the client to provide credentials") ||
+		strings.Contains(msg, "getting credentials: ")
+}
+
+// Reauthenticate returns a new client for the same context after the API
+// server rejected the credentials of c. The exec credential plugin of the
+// kubeconfig user (kubelogin, aws, gke-gcloud-auth-plugin) runs again and
+// the kubeconfig is read again, so a login in another terminal is picked
+// up. When that is not enough and stdin is a terminal, the user is asked to
+// log in and press Enter, like sudo asks for the password again.
+func (c *Client) Reauthenticate(ctx context.Context) (*Client, error) {
+	if FromDir != "" {
+		return nil, errors.New("snapshots have no credentials to renew")
+	}
+	reauthMu.Lock()
+	defer reauthMu.Unlock()
+
+	for {
+		fresh, err := NewClient("", c.contextName)
+		if err == nil {
+			// Discovery needs an authenticated user on practically every cluster
+			err = fresh.Clientset.Discovery().RESTClient().Get().AbsPath("/api").Do(ctx).Error()
+		}
+		switch {
+		case err == nil:
+			fmt.Fprintln(os.Stderr, "Re-authenticated, continuing")
+			return fresh, nil
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case !IsAuthError(err):
+			return nil, err
+		case !term.IsTerminal(int(os.Stdin.Fd())):
+			return nil, fmt.Errorf("credentials were rejected and cannot be renewed without a terminal: %w", err)
+		}
+
+		fmt.Fprintf(os.Stderr, "\nCredentials for context %q were rejected: %v\n", c.contextLabel(), utils.FirstLine(err.Error()))
+		fmt.Fprint(os.Stderr, "Log in again (e.g. in another terminal), then press Enter to retry, Ctrl+C to stop: ")
+		if err := waitForEnter(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// contextLabel names the context of the client for messages
+func (c *Client) contextLabel() string {
+	if c.contextName != "" {
+		return c.contextName
+	}
+	if config, err := LoadRawConfig(); err == nil {
+		return config.CurrentContext
+	}
+	return "current"
+}
+
+// waitForEnter reads a line from stdin, or returns when ctx is cancelled
+func waitForEnter(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		done <- err
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
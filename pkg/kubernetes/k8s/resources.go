@@ -0,0 +1,74 @@
+package k8s
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+// ResourceMapping describes a resolved API resource
+type ResourceMapping struct {
+	Resource   schema.GroupVersionResource
+	Kind       string
+	Namespaced bool
+}
+
+// ResolveResource resolves a user supplied resource name to its API resource.
+// Accepts kinds, plural/singular names and short names, optionally qualified
+// with a group, e.g. "deploy", "Deployment", "ingresses.networking.k8s.io".
+// The discovery data is fetched once per client.
+func (c *Client) ResolveResource(name string) (*ResourceMapping, error) {
+	mapper := c.restMapper()
+
+	gvk, err := mapper.KindFor(schema.ParseGroupResource(name).WithVersion(""))
+	if err != nil {
+		return nil, fmt.Errorf("unknown resource type %q: %w", name, err)
+	}
+
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map resource type %q: %w", name, err)
+	}
+
+	return &ResourceMapping{
+		Resource:   mapping.Resource,
+		Kind:       gvk.Kind,
+		Namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+	}, nil
+}
+
+// ResolveKind resolves the apiVersion and kind of a manifest to its API resource
+func (c *Client) ResolveKind(gvk schema.GroupVersionKind) (*ResourceMapping, error) {
+	mapping, err := c.restMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("unknown kind %s: %w", gvk.GroupKind(), err)
+	}
+	return &ResourceMapping{
+		Resource:   mapping.Resource,
+		Kind:       gvk.Kind,
+		Namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+	}, nil
+}
+
+// restMapper returns the discovery-backed mapper, created on first use.
+// Shared clients are used from several goroutines, so it is created once.
+func (c *Client) restMapper() meta.RESTMapper {
+	c.mapperOnce.Do(func() {
+		discoveryClient := memory.NewMemCacheClient(c.Clientset.Discovery())
+		c.mapper = restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient), discoveryClient)
+	})
+	return c.mapper
+}
+
+// Dynamic returns a dynamic client for arbitrary resource types
+func (c *Client) Dynamic() (dynamic.Interface, error) {
+	client, err := dynamic.NewForConfig(c.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	return client, nil
+}
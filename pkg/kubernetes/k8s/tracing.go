@@ -0,0 +1,59 @@
+package k8s
+
+import (
+	"net/http"
+
+	"kube/pkg/shared/tracing"
+
+	"k8s.io/client-go/rest"
+)
+
+// wrapTracing records a client span for every API request when OTLP export is
+// configured, and propagates it with a W3C traceparent header so the request
+// can be correlated with API server traces
+func wrapTracing(config *rest.Config) {
+	if !tracing.Enabled() {
+		return
+	}
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &tracingTransport{next: rt}
+	})
+}
+
+// tracingTransport wraps requests passing through it in spans
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracing.StartClient(req.Context(), "HTTP "+req.Method, map[string]interface{}{
+		"http.request.method": req.Method,
+		"url.full":            req.URL.String(),
+		"server.address":      req.URL.Host,
+	})
+
+	req = req.Clone(ctx)
+	req.Header.Set("traceparent", span.TraceParent())
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		span.End(err)
+		return resp, err
+	}
+	span.SetAttr("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		span.End(&statusError{status: resp.Status})
+	} else {
+		span.End(nil)
+	}
+	return resp, nil
+}
+
+// statusError marks a span failed by an HTTP error status
+type statusError struct {
+	status string
+}
+
+func (e *statusError) Error() string {
+	return e.status
+}
@@ -0,0 +1,183 @@
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/rest"
+)
+
+// Verbosity controls API request logging, similar to kubectl -v:
+//
+//	6  method, URL, status and duration of every request
+//	7  plus request headers (credentials redacted)
+//	8  plus request and response bodies, truncated
+//	9  plus full bodies
+//
+// Secret data and known credential fields are always redacted.
+var Verbosity int
+
+// maxBodyLog is the body size logged at verbosity 8
+const maxBodyLog = 1024
+
+// AddVerbosityFlag registers the persistent -v/--verbosity flag on the command.
+// KUBE_VERBOSITY is used as default.
+func AddVerbosityFlag(cmd *cobra.Command) {
+	def, _ := strconv.Atoi(os.Getenv("KUBE_VERBOSITY"))
+	cmd.PersistentFlags().IntVarP(&Verbosity, "verbosity", "v", def, "API request log level (6: requests, 7: headers, 8: bodies, 9: full bodies)")
+}
+
+// wrapVerbose adds request logging to config when Verbosity is high enough
+func wrapVerbose(config *rest.Config) {
+	if Verbosity < 6 {
+		return
+	}
+	level := Verbosity
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &debugTransport{next: rt, level: level}
+	})
+}
+
+// debugTransport logs requests passing through it to stderr
+type debugTransport struct {
+	next  http.RoundTripper
+	level int
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Upgraded connections (exec, port-forward) and watches are streams: never read their bodies
+	streaming := req.Header.Get("Upgrade") != "" || req.URL.Query().Get("watch") == "true" || req.URL.Query().Get("follow") == "true"
+
+	if t.level >= 7 {
+		for name, values := range req.Header {
+			logf("Request Header: %s: %s", name, redactHeader(name, strings.Join(values, ", ")))
+		}
+	}
+	if t.level >= 8 && req.Body != nil && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			body.Close()
+			logf("Request Body: %s", t.formatBody(data))
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		logf("%s %s failed after %s: %v", req.Method, req.URL, elapsed, err)
+		return resp, err
+	}
+	logf("%s %s %s in %s", req.Method, req.URL, resp.Status, elapsed)
+
+	if t.level >= 7 {
+		for name, values := range resp.Header {
+			logf("Response Header: %s: %s", name, strings.Join(values, ", "))
+		}
+	}
+	if t.level >= 8 && !streaming && resp.StatusCode != http.StatusSwitchingProtocols && resp.Body != nil {
+		data, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		if readErr == nil {
+			logf("Response Body: %s", t.formatBody(data))
+		}
+	}
+	return resp, nil
+}
+
+// formatBody redacts credentials and truncates the body below level 9
+func (t *debugTransport) formatBody(data []byte) string {
+	body := string(redactBody(data))
+	if t.level < 9 && len(body) > maxBodyLog {
+		body = fmt.Sprintf("%s... (%d bytes, use -v 9 for full bodies)", body[:maxBodyLog], len(body))
+	}
+	return body
+}
+
+// redactHeader hides credentials in request headers
+func redactHeader(name, value string) string {
+	switch strings.ToLower(name) {
+	case "authorization", "proxy-authorization", "cookie":
+		if scheme, _, ok := strings.Cut(value, " "); ok {
+			return scheme + " <redacted>"
+		}
+		return "<redacted>"
+	}
+	return value
+}
+
+// credentialKeys are JSON fields whose values are redacted anywhere in a body
+var credentialKeys = map[string]bool{
+	"token":           true,
+	"password":        true,
+	"client-key-data": true,
+	"clientKeyData":   true,
+}
+
+// lastAppliedAnnotation repeats the full object, including Secret data
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// redactBody replaces Secret data and credential fields in JSON bodies.
+// Non-JSON bodies are returned unchanged.
+func redactBody(data []byte) []byte {
+	var obj interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return data
+	}
+	redactValue(obj, false)
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+// redactValue walks decoded JSON; inSecret is true inside a Secret or SecretList
+func redactValue(v interface{}, inSecret bool) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if kind, _ := val["kind"].(string); kind == "Secret" || kind == "SecretList" {
+			inSecret = true
+		}
+		for key, child := range val {
+			secretField := key == "data" || key == "stringData" || key == lastAppliedAnnotation
+			if (inSecret && secretField) || credentialKeys[key] {
+				val[key] = redactLeaves(child)
+				continue
+			}
+			redactValue(child, inSecret)
+		}
+	case []interface{}:
+		for _, item := range val {
+			redactValue(item, inSecret)
+		}
+	}
+}
+
+// redactLeaves replaces all string values below v
+func redactLeaves(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			val[key] = redactLeaves(child)
+		}
+		return val
+	case string:
+		return "<redacted>"
+	}
+	return v
+}
+
+// logf writes a verbose log line to stderr
+func logf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "[%s] %s\n", time.Now().Format("15:04:05.000"), fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,222 @@
+package podstatus
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// nodeLostReason is set by the node lifecycle controller on pods of unreachable nodes
+const nodeLostReason = "NodeLost"
+
+// Counts are the container counters shown in the READY and RESTARTS columns
+type Counts struct {
+	// Ready and Total count app containers
+	Ready int
+	Total int
+	// SidecarsReady and Sidecars count native sidecars (restartable init containers)
+	SidecarsReady int
+	Sidecars      int
+	// Restarts sums the restarts of all containers, including init containers
+	Restarts int32
+}
+
+// Reason returns the pod status the way kubectl prints it: Terminating,
+// Init:1/3, CrashLoopBackOff, ImagePullBackOff, Completed, Evicted, Unknown
+// for pods on lost nodes, NotReady, or the phase.
+func Reason(pod *corev1.Pod) string {
+	reason := string(pod.Status.Phase)
+	if pod.Status.Reason != "" {
+		reason = pod.Status.Reason
+	}
+
+	// Pods held back by scheduling gates are not considered for scheduling at all
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Reason == corev1.PodReasonSchedulingGated {
+			reason = corev1.PodReasonSchedulingGated
+		}
+	}
+
+	initReason, initializing := InitReason(pod)
+	if initializing {
+		reason = initReason
+	}
+	if !initializing || isInitialized(pod) {
+		// The last container with a reason wins, like in kubectl
+		hasRunning := false
+		for i := len(pod.Status.ContainerStatuses) - 1; i >= 0; i-- {
+			state := pod.Status.ContainerStatuses[i].State
+			switch {
+			case state.Waiting != nil && state.Waiting.Reason != "":
+				reason = state.Waiting.Reason
+			case state.Terminated != nil && state.Terminated.Reason != "":
+				reason = state.Terminated.Reason
+			case state.Terminated != nil && state.Terminated.Signal != 0:
+				reason = fmt.Sprintf("Signal:%d", state.Terminated.Signal)
+			case state.Terminated != nil:
+				reason = fmt.Sprintf("ExitCode:%d", state.Terminated.ExitCode)
+			case pod.Status.ContainerStatuses[i].Ready && state.Running != nil:
+				hasRunning = true
+			}
+		}
+
+		// A completed container next to running ones does not complete the pod
+		if reason == "Completed" && hasRunning {
+			reason = "NotReady"
+			if IsReady(pod) {
+				reason = string(corev1.PodRunning)
+			}
+		}
+	}
+
+	if pod.DeletionTimestamp != nil {
+		if pod.Status.Reason == nodeLostReason {
+			return "Unknown"
+		}
+		return "Terminating"
+	}
+	return reason
+}
+
+// InitReason returns the init progress while the pod initializes. The first
+// init container that has not finished decides it, e.g. Init:1/3,
+// Init:CrashLoopBackOff or Init:ExitCode:1. A native sidecar counts as
+// finished once it has started.
+func InitReason(pod *corev1.Pod) (string, bool) {
+	sidecars := Sidecars(pod)
+	for i, status := range pod.Status.InitContainerStatuses {
+		terminated := status.State.Terminated
+		waiting := status.State.Waiting
+		switch {
+		case terminated != nil && terminated.ExitCode == 0:
+			continue
+		case sidecars[status.Name] && status.Started != nil && *status.Started:
+			continue
+		case terminated != nil:
+			switch {
+			case terminated.Reason != "":
+				return "Init:" + terminated.Reason, true
+			case terminated.Signal != 0:
+				return fmt.Sprintf("Init:Signal:%d", terminated.Signal), true
+			default:
+				return fmt.Sprintf("Init:ExitCode:%d", terminated.ExitCode), true
+			}
+		case waiting != nil && waiting.Reason != "" && waiting.Reason != "PodInitializing":
+			return "Init:" + waiting.Reason, true
+		default:
+			return fmt.Sprintf("Init:%d/%d", i, len(pod.Spec.InitContainers)), true
+		}
+	}
+	return "", false
+}
+
+// ContainerCounts counts ready app containers and native sidecars and sums the
+// restarts. Like kubectl, a container is ready when it is running and ready.
+func ContainerCounts(pod *corev1.Pod) Counts {
+	counts := Counts{Total: len(pod.Spec.Containers)}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Ready && status.State.Running != nil {
+			counts.Ready++
+		}
+		counts.Restarts += status.RestartCount
+	}
+
+	sidecars := Sidecars(pod)
+	counts.Sidecars = len(sidecars)
+	for _, status := range pod.Status.InitContainerStatuses {
+		if sidecars[status.Name] && status.Ready && status.State.Running != nil {
+			counts.SidecarsReady++
+		}
+		counts.Restarts += status.RestartCount
+	}
+	return counts
+}
+
+// Sidecars returns the names of init containers with restartPolicy Always,
+// which keep running next to the app containers
+func Sidecars(pod *corev1.Pod) map[string]bool {
+	sidecars := map[string]bool{}
+	for _, c := range pod.Spec.InitContainers {
+		if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			sidecars[c.Name] = true
+		}
+	}
+	return sidecars
+}
+
+// ReadinessGates returns how many of the pod's readiness gates are true
+func ReadinessGates(pod *corev1.Pod) (ready, total int) {
+	for _, gate := range pod.Spec.ReadinessGates {
+		total++
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == gate.ConditionType && cond.Status == corev1.ConditionTrue {
+				ready++
+				break
+			}
+		}
+	}
+	return ready, total
+}
+
+// Stage is a pod condition in the order pods go through them. Status is
+// empty while the condition is not reported yet.
+type Stage struct {
+	Type    corev1.PodConditionType
+	Status  corev1.ConditionStatus
+	Reason  string
+	Message string
+	Gate    bool
+}
+
+// podStages is the order pods pass the built-in conditions in
+var podStages = []corev1.PodConditionType{
+	corev1.PodScheduled,
+	corev1.PodInitialized,
+	corev1.ContainersReady,
+	corev1.PodReady,
+}
+
+// Stages returns PodScheduled, Initialized, ContainersReady and Ready
+// followed by the pod's readiness gates
+func Stages(pod *corev1.Pod) []Stage {
+	stages := make([]Stage, 0, len(podStages)+len(pod.Spec.ReadinessGates))
+	for _, condType := range podStages {
+		stages = append(stages, stageOf(pod, condType, false))
+	}
+	for _, gate := range pod.Spec.ReadinessGates {
+		stages = append(stages, stageOf(pod, gate.ConditionType, true))
+	}
+	return stages
+}
+
+// stageOf looks up the condition of a stage
+func stageOf(pod *corev1.Pod, condType corev1.PodConditionType, gate bool) Stage {
+	stage := Stage{Type: condType, Gate: gate}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == condType {
+			stage.Status, stage.Reason, stage.Message = cond.Status, cond.Reason, cond.Message
+			break
+		}
+	}
+	return stage
+}
+
+// IsReady reports whether the pod Ready condition is true
+func IsReady(pod *corev1.Pod) bool {
+	return conditionTrue(pod, corev1.PodReady)
+}
+
+// isInitialized reports whether the pod Initialized condition is true
+func isInitialized(pod *corev1.Pod) bool {
+	return conditionTrue(pod, corev1.PodInitialized)
+}
+
+// conditionTrue reports whether the pod condition is true
+func conditionTrue(pod *corev1.Pod, condType corev1.PodConditionType) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == condType {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,376 @@
+package podstatus
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// always is the restartPolicy of native sidecars
+var always = corev1.ContainerRestartPolicyAlways
+
+func running(name string, ready bool) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:  name,
+		Ready: ready,
+		State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+	}
+}
+
+func waiting(name, reason string, restarts int32) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:         name,
+		RestartCount: restarts,
+		State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}},
+	}
+}
+
+func terminated(name, reason string, exitCode int32) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:  name,
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: reason, ExitCode: exitCode}},
+	}
+}
+
+func condition(condType corev1.PodConditionType, status corev1.ConditionStatus) corev1.PodCondition {
+	return corev1.PodCondition{Type: condType, Status: status}
+}
+
+func containers(names ...string) []corev1.Container {
+	out := make([]corev1.Container, 0, len(names))
+	for _, name := range names {
+		out = append(out, corev1.Container{Name: name})
+	}
+	return out
+}
+
+func TestReason(t *testing.T) {
+	now := metav1.Now()
+	started := true
+
+	tests := []struct {
+		name string
+		pod  corev1.Pod
+		want string
+	}{
+		{
+			name: "running",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					Conditions:        []corev1.PodCondition{condition(corev1.PodInitialized, corev1.ConditionTrue), condition(corev1.PodReady, corev1.ConditionTrue)},
+					ContainerStatuses: []corev1.ContainerStatus{running("app", true)},
+				},
+			},
+			want: "Running",
+		},
+		{
+			name: "pending without statuses",
+			pod:  corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}},
+			want: "Pending",
+		},
+		{
+			name: "crash loop",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					Conditions:        []corev1.PodCondition{condition(corev1.PodInitialized, corev1.ConditionTrue)},
+					ContainerStatuses: []corev1.ContainerStatus{waiting("app", "CrashLoopBackOff", 5)},
+				},
+			},
+			want: "CrashLoopBackOff",
+		},
+		{
+			name: "last container with a reason wins",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("a", "b")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodPending,
+					ContainerStatuses: []corev1.ContainerStatus{waiting("a", "CrashLoopBackOff", 1), waiting("b", "ImagePullBackOff", 0)},
+				},
+			},
+			want: "CrashLoopBackOff",
+		},
+		{
+			name: "init progress",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{InitContainers: containers("one", "two", "three"), Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodPending,
+					InitContainerStatuses: []corev1.ContainerStatus{
+						terminated("one", "Completed", 0),
+						running("two", false),
+						waiting("three", "PodInitializing", 0),
+					},
+					ContainerStatuses: []corev1.ContainerStatus{waiting("app", "PodInitializing", 0)},
+				},
+			},
+			want: "Init:1/3",
+		},
+		{
+			name: "init crash loop",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{InitContainers: containers("migrate"), Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:                 corev1.PodPending,
+					InitContainerStatuses: []corev1.ContainerStatus{waiting("migrate", "CrashLoopBackOff", 3)},
+				},
+			},
+			want: "Init:CrashLoopBackOff",
+		},
+		{
+			name: "init exit code",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{InitContainers: containers("migrate"), Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:                 corev1.PodPending,
+					InitContainerStatuses: []corev1.ContainerStatus{terminated("migrate", "", 1)},
+				},
+			},
+			want: "Init:ExitCode:1",
+		},
+		{
+			name: "started sidecar counts as finished",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "proxy", RestartPolicy: &always}, {Name: "migrate"}},
+					Containers:     containers("app"),
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodPending,
+					InitContainerStatuses: []corev1.ContainerStatus{
+						{Name: "proxy", Started: &started, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+						running("migrate", false),
+					},
+				},
+			},
+			want: "Init:1/2",
+		},
+		{
+			name: "completed",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("job")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodSucceeded,
+					Conditions:        []corev1.PodCondition{condition(corev1.PodInitialized, corev1.ConditionTrue)},
+					ContainerStatuses: []corev1.ContainerStatus{terminated("job", "Completed", 0)},
+				},
+			},
+			want: "Completed",
+		},
+		{
+			name: "completed next to a running container",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("setup", "app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					Conditions:        []corev1.PodCondition{condition(corev1.PodInitialized, corev1.ConditionTrue), condition(corev1.PodReady, corev1.ConditionFalse)},
+					ContainerStatuses: []corev1.ContainerStatus{terminated("setup", "Completed", 0), running("app", true)},
+				},
+			},
+			want: "NotReady",
+		},
+		{
+			name: "completed next to a running container in a ready pod",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("setup", "app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					Conditions:        []corev1.PodCondition{condition(corev1.PodInitialized, corev1.ConditionTrue), condition(corev1.PodReady, corev1.ConditionTrue)},
+					ContainerStatuses: []corev1.ContainerStatus{terminated("setup", "Completed", 0), running("app", true)},
+				},
+			},
+			want: "Running",
+		},
+		{
+			name: "evicted",
+			pod:  corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"}},
+			want: "Evicted",
+		},
+		{
+			name: "scheduling gated",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase:      corev1.PodPending,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonSchedulingGated}},
+			}},
+			want: "SchedulingGated",
+		},
+		{
+			name: "terminating",
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now},
+				Spec:       corev1.PodSpec{Containers: containers("app")},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					ContainerStatuses: []corev1.ContainerStatus{waiting("app", "CrashLoopBackOff", 2)},
+				},
+			},
+			want: "Terminating",
+		},
+		{
+			name: "terminating on a lost node",
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now},
+				Status:     corev1.PodStatus{Phase: corev1.PodRunning, Reason: nodeLostReason},
+			},
+			want: "Unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Reason(&tt.pod); got != tt.want {
+				t.Errorf("Reason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerCounts(t *testing.T) {
+	tests := []struct {
+		name string
+		pod  corev1.Pod
+		want Counts
+	}{
+		{
+			name: "no statuses",
+			pod:  corev1.Pod{Spec: corev1.PodSpec{Containers: containers("a", "b")}},
+			want: Counts{Total: 2},
+		},
+		{
+			name: "ready needs running",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{Containers: containers("a", "b", "c")},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+					running("a", true),
+					running("b", false),
+					{Name: "c", Ready: true, RestartCount: 1, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}},
+				}},
+			},
+			want: Counts{Ready: 1, Total: 3, Restarts: 1},
+		},
+		{
+			name: "sidecars and init restarts",
+			pod: corev1.Pod{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "proxy", RestartPolicy: &always}, {Name: "migrate"}},
+					Containers:     containers("app"),
+				},
+				Status: corev1.PodStatus{
+					InitContainerStatuses: []corev1.ContainerStatus{
+						running("proxy", true),
+						{Name: "migrate", RestartCount: 2, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}},
+					},
+					ContainerStatuses: []corev1.ContainerStatus{waiting("app", "CrashLoopBackOff", 4)},
+				},
+			},
+			want: Counts{Ready: 0, Total: 1, SidecarsReady: 1, Sidecars: 1, Restarts: 6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContainerCounts(&tt.pod); got != tt.want {
+				t.Errorf("ContainerCounts() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsReady(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []corev1.PodCondition
+		want       bool
+	}{
+		{name: "no conditions", want: false},
+		{name: "ready", conditions: []corev1.PodCondition{condition(corev1.PodReady, corev1.ConditionTrue)}, want: true},
+		{name: "not ready", conditions: []corev1.PodCondition{condition(corev1.PodReady, corev1.ConditionFalse)}, want: false},
+		{name: "unknown", conditions: []corev1.PodCondition{condition(corev1.PodReady, corev1.ConditionUnknown)}, want: false},
+		{name: "only containers ready", conditions: []corev1.PodCondition{condition(corev1.ContainersReady, corev1.ConditionTrue)}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Status: corev1.PodStatus{Conditions: tt.conditions}}
+			if got := IsReady(pod); got != tt.want {
+				t.Errorf("IsReady() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadinessGates(t *testing.T) {
+	gates := []corev1.PodReadinessGate{{ConditionType: "example.com/lb"}, {ConditionType: "example.com/dns"}}
+
+	tests := []struct {
+		name       string
+		gates      []corev1.PodReadinessGate
+		conditions []corev1.PodCondition
+		wantReady  int
+		wantTotal  int
+	}{
+		{name: "no gates", conditions: []corev1.PodCondition{condition(corev1.PodReady, corev1.ConditionTrue)}},
+		{name: "not reported", gates: gates, wantTotal: 2},
+		{
+			name:       "one true",
+			gates:      gates,
+			conditions: []corev1.PodCondition{condition("example.com/lb", corev1.ConditionTrue), condition("example.com/dns", corev1.ConditionFalse)},
+			wantReady:  1,
+			wantTotal:  2,
+		},
+		{
+			name:       "all true",
+			gates:      gates,
+			conditions: []corev1.PodCondition{condition("example.com/dns", corev1.ConditionTrue), condition("example.com/lb", corev1.ConditionTrue)},
+			wantReady:  2,
+			wantTotal:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				Spec:   corev1.PodSpec{ReadinessGates: tt.gates},
+				Status: corev1.PodStatus{Conditions: tt.conditions},
+			}
+			ready, total := ReadinessGates(pod)
+			if ready != tt.wantReady || total != tt.wantTotal {
+				t.Errorf("ReadinessGates() = %d/%d, want %d/%d", ready, total, tt.wantReady, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestStages(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{ReadinessGates: []corev1.PodReadinessGate{{ConditionType: "example.com/lb"}}},
+		Status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+			condition(corev1.PodReady, corev1.ConditionFalse),
+			condition(corev1.PodScheduled, corev1.ConditionTrue),
+			{Type: corev1.ContainersReady, Status: corev1.ConditionFalse, Reason: "ContainersNotReady", Message: "containers with unready status: [app]"},
+			condition(corev1.PodInitialized, corev1.ConditionTrue),
+		}},
+	}
+
+	want := []Stage{
+		{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+		{Type: corev1.PodInitialized, Status: corev1.ConditionTrue},
+		{Type: corev1.ContainersReady, Status: corev1.ConditionFalse, Reason: "ContainersNotReady", Message: "containers with unready status: [app]"},
+		{Type: corev1.PodReady, Status: corev1.ConditionFalse},
+		{Type: "example.com/lb", Gate: true},
+	}
+
+	got := Stages(pod)
+	if len(got) != len(want) {
+		t.Fatalf("Stages() returned %d stages, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("stage %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,561 @@
+package rolloutstatus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/interrupt"
+	"kube/pkg/shared/tracing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultProgressDeadline matches the API server default for progressDeadlineSeconds
+const defaultProgressDeadline = 600
+
+const (
+	// RevisionAnnotation holds the revision number the deployment controller
+	// assigns to every rollout
+	RevisionAnnotation = "deployment.kubernetes.io/revision"
+	// ChangeCauseAnnotation records why a rollout was made
+	ChangeCauseAnnotation = "kubernetes.io/change-cause"
+)
+
+// Status is the computed rollout state of a Deployment, StatefulSet, DaemonSet or Job
+type Status struct {
+	Desired            int32
+	Total              int32
+	Updated            int32
+	Ready              int32
+	Available          int32
+	Generation         int64
+	ObservedGeneration int64
+	Message            string
+	Done               bool
+	// Revision and ChangeCause are set for Deployments from their annotations
+	Revision    string
+	ChangeCause string
+	// ProgressDeadline is when the controller gives up on an unfinished
+	// Deployment rollout that makes no progress, zero when not known
+	ProgressDeadline time.Time
+}
+
+// DesiredReplicas returns spec.replicas, defaulting to 1 when unset like the API server does
+func DesiredReplicas(dep *appsv1.Deployment) int32 {
+	if dep.Spec.Replicas == nil {
+		return 1
+	}
+	return *dep.Spec.Replicas
+}
+
+// Compute returns the rollout state of a Deployment.
+// It follows 'kubectl rollout status': the controller must have observed the
+// latest generation, the Progressing condition must not report a deadline
+// failure, and all replicas must be updated and available with no old
+// replicas left. Paused deployments return an error since they never progress.
+func Compute(dep *appsv1.Deployment) (Status, error) {
+	st := Status{
+		Desired:            DesiredReplicas(dep),
+		Total:              dep.Status.Replicas,
+		Updated:            dep.Status.UpdatedReplicas,
+		Ready:              dep.Status.ReadyReplicas,
+		Available:          dep.Status.AvailableReplicas,
+		Generation:         dep.Generation,
+		ObservedGeneration: dep.Status.ObservedGeneration,
+		Revision:           dep.Annotations[RevisionAnnotation],
+		ChangeCause:        dep.Annotations[ChangeCauseAnnotation],
+	}
+
+	if dep.Generation > dep.Status.ObservedGeneration {
+		st.Message = "Waiting for deployment spec update to be observed..."
+		return st, nil
+	}
+
+	if dep.Spec.Paused {
+		return st, fmt.Errorf("deployment %s is paused, resume it to continue the rollout", dep.Name)
+	}
+
+	progressing := Condition(dep, appsv1.DeploymentProgressing)
+	if progressing != nil && progressing.Reason == "ProgressDeadlineExceeded" {
+		return st, fmt.Errorf("deployment %s exceeded its progress deadline: %s", dep.Name, progressing.Message)
+	}
+
+	// The controller restarts the deadline whenever the rollout makes progress
+	if progressing != nil && progressing.Status == corev1.ConditionTrue && progressing.Reason != "NewReplicaSetAvailable" {
+		deadline := int32(defaultProgressDeadline)
+		if dep.Spec.ProgressDeadlineSeconds != nil {
+			deadline = *dep.Spec.ProgressDeadlineSeconds
+		}
+		st.ProgressDeadline = progressing.LastUpdateTime.Add(time.Duration(deadline) * time.Second)
+	}
+
+	switch {
+	case st.Updated < st.Desired:
+		st.Message = fmt.Sprintf("Waiting for rollout to finish: %d out of %d new replicas have been updated...", st.Updated, st.Desired)
+	case st.Total > st.Updated:
+		st.Message = fmt.Sprintf("Waiting for rollout to finish: %d old replicas are pending termination...", st.Total-st.Updated)
+	case st.Available < st.Updated:
+		st.Message = fmt.Sprintf("Waiting for rollout to finish: %d of %d updated replicas are available...", st.Available, st.Updated)
+	case st.Desired == 0:
+		st.Message = fmt.Sprintf("Deployment %s is scaled to zero, nothing to roll out", dep.Name)
+		st.Done = true
+	default:
+		st.Message = fmt.Sprintf("Deployment %s successfully rolled out (%d/%d available)", dep.Name, st.Available, st.Desired)
+		if available := Condition(dep, appsv1.DeploymentAvailable); available != nil && available.Status != corev1.ConditionTrue {
+			st.Message += fmt.Sprintf(" - warning: Available condition is %s (%s)", available.Status, available.Reason)
+		}
+		st.Done = true
+	}
+	return st, nil
+}
+
+// DescribeStrategy summarizes how the rollout replaces pods
+func DescribeStrategy(dep *appsv1.Deployment) string {
+	desired := DesiredReplicas(dep)
+
+	if dep.Spec.Strategy.Type == appsv1.RecreateDeploymentStrategyType {
+		return fmt.Sprintf("Strategy: Recreate (all %d old pods are stopped before new ones start)", desired)
+	}
+
+	surge, unavailable := "25%", "25%"
+	if ru := dep.Spec.Strategy.RollingUpdate; ru != nil {
+		if ru.MaxSurge != nil {
+			surge = ru.MaxSurge.String()
+		}
+		if ru.MaxUnavailable != nil {
+			unavailable = ru.MaxUnavailable.String()
+		}
+	}
+	return fmt.Sprintf("Strategy: RollingUpdate (replicas %d, maxSurge %s, maxUnavailable %s)", desired, surge, unavailable)
+}
+
+// Condition returns the condition of the given type, or nil
+func Condition(dep *appsv1.Deployment, condType appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range dep.Status.Conditions {
+		if dep.Status.Conditions[i].Type == condType {
+			return &dep.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// DefaultTimeout returns progressDeadlineSeconds plus a margin, the longest
+// a healthy controller needs before it reports a stalled rollout
+func DefaultTimeout(dep *appsv1.Deployment) time.Duration {
+	deadline := int32(defaultProgressDeadline)
+	if dep.Spec.ProgressDeadlineSeconds != nil {
+		deadline = *dep.Spec.ProgressDeadlineSeconds
+	}
+	return time.Duration(deadline)*time.Second + time.Minute
+}
+
+// Wait polls the Deployment until the rollout completes, fails, or timeout
+// expires. A zero timeout uses DefaultTimeout. onUpdate, if set, is called
+// with every observed state before completion is evaluated.
+func Wait(ctx context.Context, clientset kubernetes.Interface, ns, name string, timeout time.Duration, onUpdate func(*appsv1.Deployment, Status)) (err error) {
+	ctx, span := tracing.Start(ctx, "rollout wait", map[string]interface{}{
+		"k8s.namespace.name":  ns,
+		"k8s.deployment.name": name,
+	})
+	defer func() { span.End(err) }()
+
+	dep, err := clientset.AppsV1().Deployments(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment during rollout: %w", err)
+	}
+	if timeout == 0 {
+		timeout = DefaultTimeout(dep)
+	}
+
+	return poll(ctx, timeout, "deployment "+name, func(first bool) (Status, error) {
+		if !first {
+			if dep, err = clientset.AppsV1().Deployments(ns).Get(ctx, name, metav1.GetOptions{}); err != nil {
+				return Status{}, fmt.Errorf("failed to get deployment during rollout: %w", err)
+			}
+		}
+		st, err := Compute(dep)
+		if err == nil && onUpdate != nil {
+			onUpdate(dep, st)
+		}
+		return st, err
+	})
+}
+
+// StatefulSetDesiredReplicas returns spec.replicas, defaulting to 1 when unset
+func StatefulSetDesiredReplicas(sts *appsv1.StatefulSet) int32 {
+	if sts.Spec.Replicas == nil {
+		return 1
+	}
+	return *sts.Spec.Replicas
+}
+
+// StatefulSetPartition returns the rolling update partition, 0 when unset
+func StatefulSetPartition(sts *appsv1.StatefulSet) int32 {
+	ru := sts.Spec.UpdateStrategy.RollingUpdate
+	if ru == nil || ru.Partition == nil {
+		return 0
+	}
+	return *ru.Partition
+}
+
+// ComputeStatefulSet returns the rollout state of a StatefulSet following
+// 'kubectl rollout status': all pods must be ready and, for partitioned
+// rollouts, only ordinals >= partition need the update revision.
+// OnDelete StatefulSets return an error because their pods are only replaced manually.
+func ComputeStatefulSet(sts *appsv1.StatefulSet) (Status, error) {
+	st := Status{
+		Desired:            StatefulSetDesiredReplicas(sts),
+		Total:              sts.Status.Replicas,
+		Updated:            sts.Status.UpdatedReplicas,
+		Ready:              sts.Status.ReadyReplicas,
+		Available:          sts.Status.AvailableReplicas,
+		Generation:         sts.Generation,
+		ObservedGeneration: sts.Status.ObservedGeneration,
+	}
+
+	if sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return st, fmt.Errorf("statefulset %s uses the OnDelete strategy, pods are only updated when deleted", sts.Name)
+	}
+
+	if sts.Status.ObservedGeneration == 0 || sts.Generation > sts.Status.ObservedGeneration {
+		st.Message = "Waiting for statefulset spec update to be observed..."
+		return st, nil
+	}
+
+	if st.Ready < st.Desired {
+		st.Message = fmt.Sprintf("Waiting for %d pods to be ready...", st.Desired-st.Ready)
+		return st, nil
+	}
+
+	if partition := StatefulSetPartition(sts); partition > 0 {
+		want := st.Desired - partition
+		if want < 0 {
+			want = 0
+		}
+		if st.Updated < want {
+			st.Message = fmt.Sprintf("Waiting for partitioned roll out to finish: %d out of %d new pods have been updated...", st.Updated, want)
+			return st, nil
+		}
+		st.Message = fmt.Sprintf("Partitioned roll out complete: %d new pods have been updated (ordinals >= %d)", st.Updated, partition)
+		st.Done = true
+		return st, nil
+	}
+
+	if sts.Status.UpdateRevision != sts.Status.CurrentRevision {
+		st.Message = fmt.Sprintf("Waiting for statefulset rolling update to complete %d pods at revision %s...", st.Updated, sts.Status.UpdateRevision)
+		return st, nil
+	}
+
+	st.Message = fmt.Sprintf("StatefulSet rolling update complete %d pods at revision %s", st.Ready, sts.Status.CurrentRevision)
+	st.Done = true
+	return st, nil
+}
+
+// WaitStatefulSet polls the StatefulSet until the rollout completes, fails, or
+// timeout expires (default 10m). onUpdate, if set, is called with every observed state.
+func WaitStatefulSet(ctx context.Context, clientset kubernetes.Interface, ns, name string, timeout time.Duration, onUpdate func(*appsv1.StatefulSet, Status)) (err error) {
+	ctx, span := tracing.Start(ctx, "rollout wait", map[string]interface{}{
+		"k8s.namespace.name":   ns,
+		"k8s.statefulset.name": name,
+	})
+	defer func() { span.End(err) }()
+
+	if timeout == 0 {
+		timeout = defaultProgressDeadline * time.Second
+	}
+
+	return poll(ctx, timeout, "statefulset "+name, func(bool) (Status, error) {
+		sts, err := clientset.AppsV1().StatefulSets(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return Status{}, fmt.Errorf("failed to get statefulset during rollout: %w", err)
+		}
+		st, err := ComputeStatefulSet(sts)
+		if err == nil && onUpdate != nil {
+			onUpdate(sts, st)
+		}
+		return st, err
+	})
+}
+
+// ComputeDaemonSet returns the rollout state of a DaemonSet following
+// 'kubectl rollout status': every scheduled node must run an updated pod and
+// all of them must be available. OnDelete DaemonSets return an error because
+// their pods are only replaced manually.
+func ComputeDaemonSet(ds *appsv1.DaemonSet) (Status, error) {
+	st := Status{
+		Desired:            ds.Status.DesiredNumberScheduled,
+		Total:              ds.Status.CurrentNumberScheduled,
+		Updated:            ds.Status.UpdatedNumberScheduled,
+		Ready:              ds.Status.NumberReady,
+		Available:          ds.Status.NumberAvailable,
+		Generation:         ds.Generation,
+		ObservedGeneration: ds.Status.ObservedGeneration,
+	}
+
+	if ds.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType {
+		return st, fmt.Errorf("daemonset %s uses the OnDelete strategy, pods are only updated when deleted", ds.Name)
+	}
+
+	if ds.Generation > ds.Status.ObservedGeneration {
+		st.Message = "Waiting for daemon set spec update to be observed..."
+		return st, nil
+	}
+
+	if st.Updated < st.Desired {
+		st.Message = fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d out of %d new pods have been updated...", ds.Name, st.Updated, st.Desired)
+		return st, nil
+	}
+
+	if st.Available < st.Desired {
+		st.Message = fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d of %d updated pods are available...", ds.Name, st.Available, st.Desired)
+		return st, nil
+	}
+
+	st.Message = fmt.Sprintf("daemon set %q successfully rolled out", ds.Name)
+	st.Done = true
+	return st, nil
+}
+
+// WaitDaemonSet polls the DaemonSet until the rollout completes, fails, or
+// timeout expires (default 10m). onUpdate, if set, is called with every observed state.
+func WaitDaemonSet(ctx context.Context, clientset kubernetes.Interface, ns, name string, timeout time.Duration, onUpdate func(*appsv1.DaemonSet, Status)) (err error) {
+	ctx, span := tracing.Start(ctx, "rollout wait", map[string]interface{}{
+		"k8s.namespace.name": ns,
+		"k8s.daemonset.name": name,
+	})
+	defer func() { span.End(err) }()
+
+	if timeout == 0 {
+		timeout = defaultProgressDeadline * time.Second
+	}
+
+	return poll(ctx, timeout, "daemonset "+name, func(bool) (Status, error) {
+		ds, err := clientset.AppsV1().DaemonSets(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return Status{}, fmt.Errorf("failed to get daemonset during rollout: %w", err)
+		}
+		st, err := ComputeDaemonSet(ds)
+		if err == nil && onUpdate != nil {
+			onUpdate(ds, st)
+		}
+		return st, err
+	})
+}
+
+// ComputeJob returns the state of a Job. Jobs have no rollout, they are done
+// once the Complete condition is set; a Failed condition is an error.
+func ComputeJob(job *batchv1.Job) (Status, error) {
+	completions := int32(1)
+	if job.Spec.Completions != nil {
+		completions = *job.Spec.Completions
+	}
+	st := Status{
+		Desired:            completions,
+		Total:              job.Status.Active + job.Status.Succeeded + job.Status.Failed,
+		Ready:              job.Status.Active,
+		Available:          job.Status.Succeeded,
+		Generation:         job.Generation,
+		ObservedGeneration: job.Generation,
+	}
+
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobFailed:
+			return st, fmt.Errorf("job %s failed: %s", job.Name, cond.Message)
+		case batchv1.JobComplete:
+			st.Message = fmt.Sprintf("job %q completed: %d/%d succeeded", job.Name, job.Status.Succeeded, completions)
+			st.Done = true
+			return st, nil
+		}
+	}
+
+	st.Message = fmt.Sprintf("Waiting for job %q to complete: %d/%d succeeded, %d active...", job.Name, job.Status.Succeeded, completions, job.Status.Active)
+	return st, nil
+}
+
+// WaitJob polls the Job until it completes, fails, or timeout expires
+// (default 10m). onUpdate, if set, is called with every observed state.
+func WaitJob(ctx context.Context, clientset kubernetes.Interface, ns, name string, timeout time.Duration, onUpdate func(*batchv1.Job, Status)) (err error) {
+	ctx, span := tracing.Start(ctx, "rollout wait", map[string]interface{}{
+		"k8s.namespace.name": ns,
+		"k8s.job.name":       name,
+	})
+	defer func() { span.End(err) }()
+
+	if timeout == 0 {
+		timeout = defaultProgressDeadline * time.Second
+	}
+
+	return poll(ctx, timeout, "job "+name, func(bool) (Status, error) {
+		job, err := clientset.BatchV1().Jobs(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return Status{}, fmt.Errorf("failed to get job during wait: %w", err)
+		}
+		st, err := ComputeJob(job)
+		if err == nil && onUpdate != nil {
+			onUpdate(job, st)
+		}
+		return st, err
+	})
+}
+
+// poll calls check every second until it reports Done, returns an error, or timeout expires
+func poll(ctx context.Context, timeout time.Duration, what string, check func(first bool) (Status, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for first := true; ; first = false {
+		st, err := check(first)
+		if err != nil {
+			if ctx.Err() != nil {
+				return waitError(ctx, timeout, what)
+			}
+			return err
+		}
+		if st.Done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return waitError(ctx, timeout, what)
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// waitError tells a wait that timed out from one cancelled by the caller
+func waitError(ctx context.Context, timeout time.Duration, what string) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return clierr.Timeoutf("timeout after %s waiting for rollout of %s", timeout, what)
+	}
+	return fmt.Errorf("stopped waiting for rollout of %s: %w", what, context.Cause(ctx))
+}
+
+// Progress event phases
+const (
+	PhaseStarted     = "started"
+	PhaseProgressing = "progressing"
+	PhaseComplete    = "complete"
+	PhaseFailed      = "failed"
+	PhaseTimeout     = "timeout"
+	PhaseInterrupted = "interrupted"
+)
+
+// Event is one line of --progress-format json. Field names are part of the
+// output format, CI scripts parse them.
+type Event struct {
+	Timestamp         time.Time  `json:"timestamp"`
+	Phase             string     `json:"phase"`
+	Kind              string     `json:"kind"`
+	Namespace         string     `json:"namespace"`
+	Name              string     `json:"name"`
+	Stage             string     `json:"stage,omitempty"`
+	Revision          string     `json:"revision,omitempty"`
+	DesiredReplicas   int32      `json:"desiredReplicas"`
+	UpdatedReplicas   int32      `json:"updatedReplicas"`
+	ReadyReplicas     int32      `json:"readyReplicas"`
+	AvailableReplicas int32      `json:"availableReplicas"`
+	ProgressDeadline  *time.Time `json:"progressDeadline,omitempty"`
+	Message           string     `json:"message"`
+}
+
+// Emitter writes the progress of one rollout wait as JSON Lines, one Event
+// per observed change, so CI systems can follow it without parsing text
+type Emitter struct {
+	w       *json.Encoder
+	base    Event
+	last    Status
+	emitted bool
+}
+
+// NewEmitter returns an Emitter writing events of a workload to w. Stage is
+// set for the stages of a rollout plan and may be empty.
+func NewEmitter(w io.Writer, kind, namespace, name, stage string) *Emitter {
+	return &Emitter{
+		w:    json.NewEncoder(w),
+		base: Event{Kind: kind, Namespace: namespace, Name: name, Stage: stage},
+	}
+}
+
+// Started emits the started event with a message like "updated image to X"
+func (e *Emitter) Started(message string) {
+	event := e.base
+	event.Phase, event.Message = PhaseStarted, message
+	e.write(event)
+}
+
+// Update emits a progressing or complete event when st differs from the last
+// one. It is meant as the onUpdate callback of the waits.
+func (e *Emitter) Update(st Status) {
+	// Deadlines move with every poll, they do not count as a change
+	compare := st
+	compare.ProgressDeadline = e.last.ProgressDeadline
+	if e.emitted && compare == e.last {
+		return
+	}
+	e.last, e.emitted = st, true
+
+	phase := PhaseProgressing
+	if st.Done {
+		phase = PhaseComplete
+	}
+	e.write(e.event(phase, st, st.Message))
+}
+
+// Finish emits the final event for the error a wait returned: nothing after a
+// complete event, otherwise failed, timeout or interrupted with the error as
+// message
+func (e *Emitter) Finish(err error) {
+	switch {
+	case err == nil && e.last.Done:
+		return
+	case err == nil:
+		e.write(e.event(PhaseComplete, e.last, e.last.Message))
+		return
+	}
+	phase := PhaseFailed
+	switch {
+	case clierr.ExitCode(err) == clierr.Timeout:
+		phase = PhaseTimeout
+	case errors.Is(err, interrupt.ErrInterrupted):
+		phase = PhaseInterrupted
+	}
+	e.write(e.event(phase, e.last, err.Error()))
+}
+
+// event fills an Event with the counters of st
+func (e *Emitter) event(phase string, st Status, message string) Event {
+	event := e.base
+	event.Phase = phase
+	event.Revision = st.Revision
+	event.DesiredReplicas = st.Desired
+	event.UpdatedReplicas = st.Updated
+	event.ReadyReplicas = st.Ready
+	event.AvailableReplicas = st.Available
+	if !st.Done && !st.ProgressDeadline.IsZero() {
+		deadline := st.ProgressDeadline.UTC()
+		event.ProgressDeadline = &deadline
+	}
+	event.Message = message
+	return event
+}
+
+// write stamps and writes one event. Errors are ignored like those of
+// printing progress text; a closed pipe must not fail the rollout.
+func (e *Emitter) write(event Event) {
+	event.Timestamp = time.Now().UTC()
+	_ = e.w.Encode(event)
+}
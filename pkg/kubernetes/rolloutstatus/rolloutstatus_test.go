@@ -0,0 +1,195 @@
+package rolloutstatus
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deployment builds a Deployment at generation 2 whose status has caught up
+// with the spec
+func deployment(replicas *int32, total, updated, available int32) appsv1.Deployment {
+	return appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: replicas},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 2,
+			Replicas:           total,
+			UpdatedReplicas:    updated,
+			ReadyReplicas:      available,
+			AvailableReplicas:  available,
+		},
+	}
+}
+
+func progressing(reason, message string, updated time.Time) appsv1.DeploymentCondition {
+	return appsv1.DeploymentCondition{
+		Type:           appsv1.DeploymentProgressing,
+		Status:         corev1.ConditionTrue,
+		Reason:         reason,
+		Message:        message,
+		LastUpdateTime: metav1.NewTime(updated),
+	}
+}
+
+func TestCompute(t *testing.T) {
+	zero, three := int32(0), int32(3)
+	updated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		dep          appsv1.Deployment
+		edit         func(*appsv1.Deployment)
+		wantDesired  int32
+		wantDone     bool
+		wantMessage  string
+		wantErr      string
+		wantDeadline time.Time
+	}{
+		{
+			name:        "nil replicas default to one",
+			dep:         deployment(nil, 1, 1, 1),
+			wantDesired: 1,
+			wantDone:    true,
+			wantMessage: "Deployment web successfully rolled out (1/1 available)",
+		},
+		{
+			name:        "nil replicas waiting for the new one",
+			dep:         deployment(nil, 1, 0, 1),
+			wantDesired: 1,
+			wantMessage: "Waiting for rollout to finish: 0 out of 1 new replicas have been updated...",
+		},
+		{
+			name:        "scaled to zero",
+			dep:         deployment(&zero, 0, 0, 0),
+			wantDesired: 0,
+			wantDone:    true,
+			wantMessage: "Deployment web is scaled to zero, nothing to roll out",
+		},
+		{
+			name:        "scaling to zero with old replicas left",
+			dep:         deployment(&zero, 2, 0, 2),
+			wantDesired: 0,
+			wantMessage: "Waiting for rollout to finish: 2 old replicas are pending termination...",
+		},
+		{
+			name:        "old replicas pending termination",
+			dep:         deployment(&three, 4, 3, 3),
+			wantDesired: 3,
+			wantMessage: "Waiting for rollout to finish: 1 old replicas are pending termination...",
+		},
+		{
+			name:        "updated replicas not yet available",
+			dep:         deployment(&three, 3, 3, 2),
+			wantDesired: 3,
+			wantMessage: "Waiting for rollout to finish: 2 of 3 updated replicas are available...",
+		},
+		{
+			name: "observed generation lags behind",
+			dep:  deployment(&three, 3, 3, 3),
+			edit: func(dep *appsv1.Deployment) {
+				dep.Generation = 3
+				// Checked before paused, the controller may not have seen the pause yet
+				dep.Spec.Paused = true
+			},
+			wantDesired: 3,
+			wantMessage: "Waiting for deployment spec update to be observed...",
+		},
+		{
+			name:        "paused",
+			dep:         deployment(&three, 3, 1, 3),
+			edit:        func(dep *appsv1.Deployment) { dep.Spec.Paused = true },
+			wantDesired: 3,
+			wantErr:     "deployment web is paused, resume it to continue the rollout",
+		},
+		{
+			name: "progress deadline exceeded",
+			dep:  deployment(&three, 3, 1, 2),
+			edit: func(dep *appsv1.Deployment) {
+				cond := progressing("ProgressDeadlineExceeded", `ReplicaSet "web-5d8f" has timed out progressing.`, updated)
+				cond.Status = corev1.ConditionFalse
+				dep.Status.Conditions = []appsv1.DeploymentCondition{cond}
+			},
+			wantDesired: 3,
+			wantErr:     `deployment web exceeded its progress deadline: ReplicaSet "web-5d8f" has timed out progressing.`,
+		},
+		{
+			name: "progressing with the default deadline",
+			dep:  deployment(&three, 3, 1, 2),
+			edit: func(dep *appsv1.Deployment) {
+				dep.Status.Conditions = []appsv1.DeploymentCondition{progressing("ReplicaSetUpdated", "", updated)}
+			},
+			wantDesired:  3,
+			wantMessage:  "Waiting for rollout to finish: 1 out of 3 new replicas have been updated...",
+			wantDeadline: updated.Add(defaultProgressDeadline * time.Second),
+		},
+		{
+			name: "progressing with its own deadline",
+			dep:  deployment(&three, 3, 1, 2),
+			edit: func(dep *appsv1.Deployment) {
+				deadline := int32(120)
+				dep.Spec.ProgressDeadlineSeconds = &deadline
+				dep.Status.Conditions = []appsv1.DeploymentCondition{progressing("ReplicaSetUpdated", "", updated)}
+			},
+			wantDesired:  3,
+			wantMessage:  "Waiting for rollout to finish: 1 out of 3 new replicas have been updated...",
+			wantDeadline: updated.Add(2 * time.Minute),
+		},
+		{
+			name: "complete rollout has no deadline",
+			dep:  deployment(&three, 3, 3, 3),
+			edit: func(dep *appsv1.Deployment) {
+				dep.Status.Conditions = []appsv1.DeploymentCondition{progressing("NewReplicaSetAvailable", "", updated)}
+			},
+			wantDesired: 3,
+			wantDone:    true,
+			wantMessage: "Deployment web successfully rolled out (3/3 available)",
+		},
+		{
+			name: "done with the Available condition false",
+			dep:  deployment(&three, 3, 3, 3),
+			edit: func(dep *appsv1.Deployment) {
+				dep.Status.Conditions = []appsv1.DeploymentCondition{{
+					Type:   appsv1.DeploymentAvailable,
+					Status: corev1.ConditionFalse,
+					Reason: "MinimumReplicasUnavailable",
+				}}
+			},
+			wantDesired: 3,
+			wantDone:    true,
+			wantMessage: "Deployment web successfully rolled out (3/3 available) - warning: Available condition is False (MinimumReplicasUnavailable)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dep := tt.dep
+			if tt.edit != nil {
+				tt.edit(&dep)
+			}
+			st, err := Compute(&dep)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Compute() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Compute() error = %v", err)
+			}
+			if st.Desired != tt.wantDesired {
+				t.Errorf("Desired = %d, want %d", st.Desired, tt.wantDesired)
+			}
+			if st.Done != tt.wantDone {
+				t.Errorf("Done = %v, want %v", st.Done, tt.wantDone)
+			}
+			if st.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", st.Message, tt.wantMessage)
+			}
+			if !st.ProgressDeadline.Equal(tt.wantDeadline) {
+				t.Errorf("ProgressDeadline = %v, want %v", st.ProgressDeadline, tt.wantDeadline)
+			}
+		})
+	}
+}
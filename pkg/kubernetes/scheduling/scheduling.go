@@ -0,0 +1,164 @@
+package scheduling
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// nodeSelectorOps maps node selector operators to label selector operators
+var nodeSelectorOps = map[corev1.NodeSelectorOperator]selection.Operator{
+	corev1.NodeSelectorOpIn:           selection.In,
+	corev1.NodeSelectorOpNotIn:        selection.NotIn,
+	corev1.NodeSelectorOpExists:       selection.Exists,
+	corev1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	corev1.NodeSelectorOpGt:           selection.GreaterThan,
+	corev1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+// MatchesNode reports whether the node passes the nodeSelector, the required
+// node affinity and the taints for the pod
+func MatchesNode(pod *corev1.Pod, node *corev1.Node) bool {
+	return MatchesNodeSelector(pod, node) && MatchesNodeAffinity(pod, node) && UntoleratedTaint(pod, node) == nil
+}
+
+// MatchesNodeSelector reports whether the node has every label of the pod's
+// nodeSelector
+func MatchesNodeSelector(pod *corev1.Pod, node *corev1.Node) bool {
+	return labels.SelectorFromSet(pod.Spec.NodeSelector).Matches(labels.Set(node.Labels))
+}
+
+// MatchesNodeAffinity reports whether the node matches the required node
+// affinity of the pod. Pods without one match every node.
+func MatchesNodeAffinity(pod *corev1.Pod, node *corev1.Node) bool {
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true
+	}
+	return MatchNodeSelector(affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution, node)
+}
+
+// MatchNodeSelector reports whether the node matches any of the terms
+func MatchNodeSelector(ns *corev1.NodeSelector, node *corev1.Node) bool {
+	for _, term := range ns.NodeSelectorTerms {
+		if matchTerm(term, node) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTerm reports whether the node matches all expressions and fields of the term
+func matchTerm(term corev1.NodeSelectorTerm, node *corev1.Node) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+	for _, expr := range term.MatchExpressions {
+		if !matchRequirement(expr, labels.Set(node.Labels)) {
+			return false
+		}
+	}
+	for _, expr := range term.MatchFields {
+		if expr.Key != "metadata.name" || !matchRequirement(expr, labels.Set{"metadata.name": node.Name}) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchRequirement evaluates one node selector requirement against a label set
+func matchRequirement(expr corev1.NodeSelectorRequirement, set labels.Set) bool {
+	op, ok := nodeSelectorOps[expr.Operator]
+	if !ok {
+		return false
+	}
+	req, err := labels.NewRequirement(expr.Key, op, expr.Values)
+	if err != nil {
+		return false
+	}
+	return req.Matches(set)
+}
+
+// UntoleratedTaint returns the first NoSchedule or NoExecute taint of the
+// node that the pod does not tolerate
+func UntoleratedTaint(pod *corev1.Pod, node *corev1.Node) *corev1.Taint {
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for j := range pod.Spec.Tolerations {
+			if pod.Spec.Tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return taint
+		}
+	}
+	return nil
+}
+
+// PodRequests computes what the scheduler accounts for a pod: app
+// containers and native sidecars add up, each regular init container needs
+// its own request plus the sidecars started before it, plus the overhead
+func PodRequests(pod *corev1.Pod) corev1.ResourceList {
+	requests := effective(pod, func(r corev1.ResourceRequirements) corev1.ResourceList { return r.Requests })
+	AddResources(requests, pod.Spec.Overhead)
+	return requests
+}
+
+// PodLimits computes the pod limits like PodRequests. The overhead is only
+// added when the containers set limits.
+func PodLimits(pod *corev1.Pod) corev1.ResourceList {
+	limits := effective(pod, func(r corev1.ResourceRequirements) corev1.ResourceList { return r.Limits })
+	if len(limits) > 0 {
+		AddResources(limits, pod.Spec.Overhead)
+	}
+	return limits
+}
+
+// effective sums the resources picked from each container the way the
+// scheduler does, without the overhead
+func effective(pod *corev1.Pod, pick func(corev1.ResourceRequirements) corev1.ResourceList) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		AddResources(total, pick(c.Resources))
+	}
+
+	sidecars := corev1.ResourceList{}
+	init := corev1.ResourceList{}
+	for _, c := range pod.Spec.InitContainers {
+		if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			AddResources(sidecars, pick(c.Resources))
+			AddResources(total, pick(c.Resources))
+			continue
+		}
+		step := corev1.ResourceList{}
+		AddResources(step, sidecars)
+		AddResources(step, pick(c.Resources))
+		MaxResources(init, step)
+	}
+	MaxResources(total, init)
+	return total
+}
+
+// AddResources adds src to dst
+func AddResources(dst, src corev1.ResourceList) {
+	for name, q := range src {
+		sum := dst[name]
+		sum.Add(q)
+		dst[name] = sum
+	}
+}
+
+// MaxResources raises dst to src where src is larger
+func MaxResources(dst, src corev1.ResourceList) {
+	for name, q := range src {
+		if current, ok := dst[name]; !ok || q.Cmp(current) > 0 {
+			dst[name] = q.DeepCopy()
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package scheduling
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMatchNodeSelector(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node-a",
+		Labels: map[string]string{"zone": "a", "cores": "8"},
+	}}
+	term := func(exprs ...corev1.NodeSelectorRequirement) corev1.NodeSelectorTerm {
+		return corev1.NodeSelectorTerm{MatchExpressions: exprs}
+	}
+
+	tests := []struct {
+		name  string
+		terms []corev1.NodeSelectorTerm
+		want  bool
+	}{
+		{name: "in", terms: []corev1.NodeSelectorTerm{term(corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a", "b"}})}, want: true},
+		{name: "not in", terms: []corev1.NodeSelectorTerm{term(corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpNotIn, Values: []string{"a"}})}, want: false},
+		{name: "exists", terms: []corev1.NodeSelectorTerm{term(corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpExists})}, want: true},
+		{name: "does not exist", terms: []corev1.NodeSelectorTerm{term(corev1.NodeSelectorRequirement{Key: "gpu", Operator: corev1.NodeSelectorOpDoesNotExist})}, want: true},
+		{name: "gt", terms: []corev1.NodeSelectorTerm{term(corev1.NodeSelectorRequirement{Key: "cores", Operator: corev1.NodeSelectorOpGt, Values: []string{"4"}})}, want: true},
+		{name: "lt", terms: []corev1.NodeSelectorTerm{term(corev1.NodeSelectorRequirement{Key: "cores", Operator: corev1.NodeSelectorOpLt, Values: []string{"4"}})}, want: false},
+		{name: "expressions are anded", terms: []corev1.NodeSelectorTerm{term(
+			corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}},
+			corev1.NodeSelectorRequirement{Key: "gpu", Operator: corev1.NodeSelectorOpExists},
+		)}, want: false},
+		{name: "terms are ored", terms: []corev1.NodeSelectorTerm{
+			term(corev1.NodeSelectorRequirement{Key: "gpu", Operator: corev1.NodeSelectorOpExists}),
+			term(corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}),
+		}, want: true},
+		{name: "empty term matches nothing", terms: []corev1.NodeSelectorTerm{{}}, want: false},
+		{name: "node name field", terms: []corev1.NodeSelectorTerm{{MatchFields: []corev1.NodeSelectorRequirement{{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"node-a"}}}}}, want: true},
+		{name: "unsupported field", terms: []corev1.NodeSelectorTerm{{MatchFields: []corev1.NodeSelectorRequirement{{Key: "spec.unschedulable", Operator: corev1.NodeSelectorOpExists}}}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchNodeSelector(&corev1.NodeSelector{NodeSelectorTerms: tt.terms}, node); got != tt.want {
+				t.Errorf("MatchNodeSelector() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUntoleratedTaint(t *testing.T) {
+	node := &corev1.Node{Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+		{Key: "soft", Effect: corev1.TaintEffectPreferNoSchedule},
+		{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule},
+	}}}
+
+	tests := []struct {
+		name        string
+		tolerations []corev1.Toleration
+		want        string
+	}{
+		{name: "no tolerations", want: "dedicated"},
+		{name: "tolerated by value", tolerations: []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "gpu", Effect: corev1.TaintEffectNoSchedule}}},
+		{name: "tolerated by exists", tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}}},
+		{name: "wrong value", tolerations: []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "db"}}, want: "dedicated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Tolerations: tt.tolerations}}
+			got := ""
+			if taint := UntoleratedTaint(pod, node); taint != nil {
+				got = taint.Key
+			}
+			if got != tt.want {
+				t.Errorf("UntoleratedTaint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPodRequests(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	container := func(name, cpu, memory string) corev1.Container {
+		return corev1.Container{Name: name, Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}}}
+	}
+	sidecar := func(name, cpu, memory string) corev1.Container {
+		c := container(name, cpu, memory)
+		c.RestartPolicy = &always
+		return c
+	}
+
+	tests := []struct {
+		name       string
+		spec       corev1.PodSpec
+		wantCPU    string
+		wantMemory string
+	}{
+		{
+			name:       "app containers add up",
+			spec:       corev1.PodSpec{Containers: []corev1.Container{container("a", "100m", "64Mi"), container("b", "200m", "64Mi")}},
+			wantCPU:    "300m",
+			wantMemory: "128Mi",
+		},
+		{
+			name: "bigger init container wins",
+			spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{container("migrate", "1", "32Mi")},
+				Containers:     []corev1.Container{container("app", "250m", "256Mi")},
+			},
+			wantCPU:    "1",
+			wantMemory: "256Mi",
+		},
+		{
+			name: "sidecars add to the app and to later init containers",
+			spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{
+					container("before", "900m", "16Mi"),
+					sidecar("proxy", "100m", "64Mi"),
+					container("after", "900m", "16Mi"),
+				},
+				Containers: []corev1.Container{container("app", "500m", "128Mi")},
+			},
+			wantCPU:    "1",
+			wantMemory: "192Mi",
+		},
+		{
+			name: "overhead",
+			spec: corev1.PodSpec{
+				Containers: []corev1.Container{container("app", "500m", "128Mi")},
+				Overhead:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+			},
+			wantCPU:    "750m",
+			wantMemory: "192Mi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PodRequests(&corev1.Pod{Spec: tt.spec})
+			if cpu := resource.MustParse(tt.wantCPU); got.Cpu().Cmp(cpu) != 0 {
+				t.Errorf("cpu = %s, want %s", got.Cpu(), tt.wantCPU)
+			}
+			if memory := resource.MustParse(tt.wantMemory); got.Memory().Cmp(memory) != 0 {
+				t.Errorf("memory = %s, want %s", got.Memory(), tt.wantMemory)
+			}
+		})
+	}
+}
+
+func TestPodLimitsOverhead(t *testing.T) {
+	overhead := corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")}
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}, Overhead: overhead}}
+	if limits := PodLimits(pod); len(limits) != 0 {
+		t.Errorf("PodLimits() without container limits = %v, want none", limits)
+	}
+
+	pod.Spec.Containers[0].Resources.Limits = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}
+	limits := PodLimits(pod)
+	if got := limits.Cpu(); got.Cmp(resource.MustParse("1250m")) != 0 {
+		t.Errorf("PodLimits() cpu = %s, want 1250m", got)
+	}
+}
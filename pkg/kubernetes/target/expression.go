@@ -0,0 +1,143 @@
+package target
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+
+	"kube/pkg/kubernetes/podstatus"
+	"kube/pkg/kubernetes/workloads"
+	"kube/pkg/shared/clierr"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// IsExpression reports whether s is a target expression such as @latest:deploy/backend
+func IsExpression(s string) bool {
+	return strings.HasPrefix(s, "@latest:") || strings.HasPrefix(s, "@random:")
+}
+
+// ResolveExpression resolves a target expression to a ready pod.
+//
+//	@latest:<ref>   the most recently created ready pod
+//	@random:<ref>   a random ready pod
+//
+// ref is <kind>/<name> of a Deployment, StatefulSet, DaemonSet, ReplicaSet,
+// Job or Service (short names like deploy/ or svc/ work), or "-l <selector>".
+func ResolveExpression(ctx context.Context, clientset kubernetes.Interface, namespace, expr string) (*corev1.Pod, error) {
+	mode, ref, ok := strings.Cut(strings.TrimPrefix(expr, "@"), ":")
+	if !ok || (mode != "latest" && mode != "random") {
+		return nil, clierr.Usagef("invalid target expression %q, expected @latest:<ref> or @random:<ref>", expr)
+	}
+
+	selector, err := Selector(ctx, clientset, namespace, strings.TrimSpace(ref))
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	var ready []corev1.Pod
+	for _, pod := range list.Items {
+		if pod.DeletionTimestamp == nil && podstatus.IsReady(&pod) {
+			ready = append(ready, pod)
+		}
+	}
+	if len(ready) == 0 {
+		return nil, clierr.Newf(clierr.NotFound, "no ready pod found for %s (%d pods match selector %s)", ref, len(list.Items), selector)
+	}
+
+	pick := ready[0]
+	if mode == "random" {
+		pick = ready[rand.Intn(len(ready))]
+	} else {
+		for _, pod := range ready[1:] {
+			if pod.CreationTimestamp.After(pick.CreationTimestamp.Time) {
+				pick = pod
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Using pod %s (%s of %d ready)\n", pick.Name, mode, len(ready))
+	return &pick, nil
+}
+
+// IsWorkload reports whether ref is a <kind>/<name> target of a workload
+// owning pods, e.g. deploy/backend, sts/db, ds/agent, rs/web-5d8f or
+// job/migrate
+func IsWorkload(ref string) bool {
+	kind, name, ok := strings.Cut(ref, "/")
+	if !ok || name == "" || strings.Contains(name, "/") {
+		return false
+	}
+	switch strings.ToLower(kind) {
+	case "rs", "replicaset", "replicasets":
+		return true
+	}
+	workloadKind, err := workloads.ParseKind(kind)
+	return err == nil && workloadKind != workloads.KindCronJob
+}
+
+// Selector returns the pod label selector of a workload or service
+// reference (<kind>/<name>) or of a -l selector
+func Selector(ctx context.Context, clientset kubernetes.Interface, namespace, ref string) (string, error) {
+	for _, prefix := range []string{"--selector=", "--selector ", "-l=", "-l "} {
+		if strings.HasPrefix(ref, prefix) {
+			selector := strings.TrimSpace(strings.TrimPrefix(ref, prefix))
+			if _, err := labels.Parse(selector); err != nil || selector == "" {
+				return "", clierr.Usagef("invalid label selector %q", selector)
+			}
+			return selector, nil
+		}
+	}
+
+	kind, name, ok := strings.Cut(ref, "/")
+	if !ok || name == "" {
+		return "", clierr.Usagef("invalid target %q, expected <kind>/<name> or -l <selector>", ref)
+	}
+
+	switch strings.ToLower(kind) {
+	case "rs", "replicaset", "replicasets":
+		obj, err := clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to get replicaset %s: %w", name, err)
+		}
+		s, err := metav1.LabelSelectorAsSelector(obj.Spec.Selector)
+		if err != nil {
+			return "", fmt.Errorf("invalid selector on %s: %w", ref, err)
+		}
+		return s.String(), nil
+	case "svc", "service", "services":
+		obj, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to get service %s: %w", name, err)
+		}
+		if len(obj.Spec.Selector) == 0 {
+			return "", fmt.Errorf("service %s has no selector", name)
+		}
+		return labels.SelectorFromSet(obj.Spec.Selector).String(), nil
+	}
+
+	// CronJobs own no pods directly, their Jobs do
+	workloadKind, err := workloads.ParseKind(kind)
+	if err != nil || workloadKind == workloads.KindCronJob {
+		return "", clierr.Usagef("unsupported target kind %q", kind)
+	}
+	w, err := workloads.Get(ctx, clientset, workloadKind, namespace, name)
+	if err != nil {
+		return "", err
+	}
+	s, err := w.Selector()
+	if err != nil {
+		return "", err
+	}
+	return s.String(), nil
+}
@@ -0,0 +1,185 @@
+package target
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/podstatus"
+	"kube/pkg/shared/clierr"
+	"kube/pkg/shared/utils"
+
+	"golang.org/x/term"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ResolvePod returns the pod called name. When no pod has that exact name,
+// pods whose name starts with (or else contains) name are candidates: a single
+// candidate is used directly, several are offered in an interactive picker
+// when stdin is a terminal. Target expressions like @latest:deploy/backend are
+// resolved with ResolveExpression, svc/<name> with ResolveServicePod, and a
+// workload like deploy/backend or job/migrate to its newest ready pod.
+// Messages go to stderr to keep stdout clean.
+//
+// A namespace in the target (<ns>/<pod>, svc/<ns>/<name>, deploy/<ns>/<name>,
+// @latest:deploy/<ns>/<name>) overrides namespace; callers should use the
+// namespace of the returned pod.
+func ResolvePod(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (*corev1.Pod, error) {
+	if ns, ref := SplitNamespace(name); ns != "" {
+		namespace, name = ns, ref
+	}
+	if IsExpression(name) {
+		return ResolveExpression(ctx, clientset, namespace, name)
+	}
+	if service, ok := serviceName(name); ok {
+		return ResolveServicePod(ctx, clientset, namespace, service)
+	}
+	if IsWorkload(name) {
+		return ResolveExpression(ctx, clientset, namespace, "@latest:"+name)
+	}
+
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return pod, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get pod %s: %w", name, err)
+	}
+	notFound := err
+
+	list, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	candidates := matchPods(list.Items, name)
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("failed to get pod %s: %w", name, notFound)
+	case 1:
+		fmt.Fprintf(os.Stderr, "Using pod %s\n", candidates[0].Name)
+		return &candidates[0], nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		names := make([]string, len(candidates))
+		for i := range candidates {
+			names[i] = candidates[i].Name
+		}
+		return nil, clierr.Usagef("pod name %q is ambiguous, matches: %s", name, strings.Join(names, ", "))
+	}
+	return pickPod(candidates, name)
+}
+
+// SplitNamespace extracts the namespace of a namespace qualified target:
+//
+//	<ns>/<pod>                  -> <ns>, <pod>
+//	svc/<ns>/<name>             -> <ns>, svc/<name>
+//	<kind>/<ns>/<name>          -> <ns>, <kind>/<name>
+//	@latest:<kind>/<ns>/<name>  -> <ns>, @latest:<kind>/<name>
+//
+// Other targets, including label selectors, are returned unchanged with an
+// empty namespace.
+func SplitNamespace(ref string) (string, string) {
+	prefix, rest := "", ref
+	if IsExpression(ref) {
+		i := strings.Index(ref, ":") + 1
+		prefix, rest = ref[:i], ref[i:]
+		if strings.HasPrefix(rest, "-") {
+			return "", ref
+		}
+	}
+
+	parts := strings.Split(rest, "/")
+	switch {
+	case len(parts) == 3 && parts[0] != "" && parts[1] != "" && parts[2] != "":
+		return parts[1], prefix + parts[0] + "/" + parts[2]
+	case len(parts) == 2 && prefix == "" && parts[0] != "" && parts[1] != "":
+		if _, ok := serviceName(rest); !ok && !IsWorkload(rest) {
+			return parts[0], parts[1]
+		}
+	}
+	return "", ref
+}
+
+// serviceName returns the name of a svc/<name> or service/<name> target
+func serviceName(ref string) (string, bool) {
+	kind, name, ok := strings.Cut(ref, "/")
+	if !ok || strings.Contains(name, "/") {
+		return "", false
+	}
+	switch strings.ToLower(kind) {
+	case "svc", "service", "services":
+		return name, name != ""
+	}
+	return "", false
+}
+
+// ResolveServicePod returns the first pod backing the service, taken from
+// the ready addresses of its Endpoints
+func ResolveServicePod(ctx context.Context, clientset kubernetes.Interface, namespace, service string) (*corev1.Pod, error) {
+	eps, err := clientset.CoreV1().Endpoints(namespace).Get(ctx, service, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get endpoints for service %s: %w", service, err)
+	}
+	for _, subset := range eps.Subsets {
+		for _, addr := range subset.Addresses {
+			if addr.TargetRef == nil || addr.TargetRef.Kind != "Pod" || addr.TargetRef.Name == "" {
+				continue
+			}
+			pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, addr.TargetRef.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get pod %s: %w", addr.TargetRef.Name, err)
+			}
+			fmt.Fprintf(os.Stderr, "Using pod %s of service %s\n", pod.Name, service)
+			return pod, nil
+		}
+	}
+	return nil, clierr.Newf(clierr.NotFound, "no backing pod found for service %s", service)
+}
+
+// matchPods returns pods whose name has the given prefix, falling back to
+// pods containing it, sorted by name
+func matchPods(pods []corev1.Pod, name string) []corev1.Pod {
+	var prefixed, contained []corev1.Pod
+	for _, pod := range pods {
+		switch {
+		case strings.HasPrefix(pod.Name, name):
+			prefixed = append(prefixed, pod)
+		case strings.Contains(pod.Name, name):
+			contained = append(contained, pod)
+		}
+	}
+
+	matches := prefixed
+	if len(matches) == 0 {
+		matches = contained
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Name < matches[j].Name })
+	return matches
+}
+
+// pickPod lets the user choose one of the candidates by number
+func pickPod(candidates []corev1.Pod, name string) (*corev1.Pod, error) {
+	fmt.Fprintf(os.Stderr, "Multiple pods match %q:\n", name)
+	for i, pod := range candidates {
+		fmt.Fprintf(os.Stderr, "  %d. %-50s %-12s %s\n", i+1, pod.Name, podstatus.Reason(&pod),
+			utils.FormatAge(time.Since(pod.CreationTimestamp.Time)))
+	}
+	fmt.Fprintf(os.Stderr, "Select pod [1-%d]: ", len(candidates))
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	choice, err := strconv.Atoi(strings.TrimSpace(answer))
+	if err != nil || choice < 1 || choice > len(candidates) {
+		return nil, clierr.Usagef("invalid selection %q", strings.TrimSpace(answer))
+	}
+	return &candidates[choice-1], nil
+}
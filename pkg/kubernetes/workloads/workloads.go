@@ -0,0 +1,431 @@
+package workloads
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/changes"
+	"kube/pkg/kubernetes/rolloutstatus"
+	"kube/pkg/shared/clierr"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Workload kinds
+const (
+	KindDeployment  = "Deployment"
+	KindStatefulSet = "StatefulSet"
+	KindDaemonSet   = "DaemonSet"
+	KindJob         = "Job"
+	KindCronJob     = "CronJob"
+)
+
+// restartedAtAnnotation is the pod template annotation kubectl rollout restart sets
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// kindAliases maps the prefixes of kind/name targets to workload kinds
+var kindAliases = map[string]string{
+	"deploy":       KindDeployment,
+	"deployment":   KindDeployment,
+	"deployments":  KindDeployment,
+	"sts":          KindStatefulSet,
+	"statefulset":  KindStatefulSet,
+	"statefulsets": KindStatefulSet,
+	"ds":           KindDaemonSet,
+	"daemonset":    KindDaemonSet,
+	"daemonsets":   KindDaemonSet,
+	"job":          KindJob,
+	"jobs":         KindJob,
+	"cj":           KindCronJob,
+	"cronjob":      KindCronJob,
+	"cronjobs":     KindCronJob,
+}
+
+// Workload is a controller with a pod template, so tools can update images,
+// restart and wait without special-casing each kind
+type Workload interface {
+	metav1.Object
+
+	// Kind returns the workload kind, e.g. Deployment
+	Kind() string
+	// GetPodTemplate returns the pod template, changes to it are kept by Update
+	GetPodTemplate() *corev1.PodTemplateSpec
+	// Selector returns the selector of the pods the workload manages
+	Selector() (labels.Selector, error)
+	// SetImage sets the image of the named container, or of all containers
+	// when container is empty
+	SetImage(container, image string) error
+	// RolloutStatus computes the rollout state like 'kubectl rollout status'
+	RolloutStatus() (rolloutstatus.Status, error)
+	// Changes lists what differs from an earlier copy of the same workload
+	Changes(before Workload) []changes.Change
+	// Copy returns a deep copy
+	Copy() Workload
+	// Update writes the workload and returns the stored version
+	Update(ctx context.Context, clientset kubernetes.Interface) (Workload, error)
+	// Wait polls until the rollout completes, calling onUpdate with every state
+	Wait(ctx context.Context, clientset kubernetes.Interface, timeout time.Duration, onUpdate func(rolloutstatus.Status)) error
+}
+
+// ParseKind resolves a kind alias such as deploy, sts or cronjob
+func ParseKind(alias string) (string, error) {
+	kind, ok := kindAliases[strings.ToLower(alias)]
+	if !ok {
+		return "", clierr.Usagef("unknown workload kind %q (use deploy/, sts/, ds/, job/ or cronjob/)", alias)
+	}
+	return kind, nil
+}
+
+// ParseTarget splits a kind/name target. A plain name is a Deployment.
+func ParseTarget(target string) (string, string, error) {
+	alias, name, ok := strings.Cut(target, "/")
+	if !ok {
+		return KindDeployment, target, nil
+	}
+	kind, err := ParseKind(alias)
+	if err != nil {
+		return "", "", err
+	}
+	if name == "" {
+		return "", "", clierr.Usagef("missing name in %q", target)
+	}
+	return kind, name, nil
+}
+
+// Get fetches a workload by kind and name
+func Get(ctx context.Context, clientset kubernetes.Interface, kind, namespace, name string) (Workload, error) {
+	var w Workload
+	var err error
+	switch kind {
+	case KindDeployment:
+		var obj *appsv1.Deployment
+		if obj, err = clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			w = &Deployment{obj}
+		}
+	case KindStatefulSet:
+		var obj *appsv1.StatefulSet
+		if obj, err = clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			w = &StatefulSet{obj}
+		}
+	case KindDaemonSet:
+		var obj *appsv1.DaemonSet
+		if obj, err = clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			w = &DaemonSet{obj}
+		}
+	case KindJob:
+		var obj *batchv1.Job
+		if obj, err = clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			w = &Job{obj}
+		}
+	case KindCronJob:
+		var obj *batchv1.CronJob
+		if obj, err = clientset.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			w = &CronJob{obj}
+		}
+	default:
+		return nil, clierr.Usagef("unsupported workload kind %q", kind)
+	}
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, clierr.Newf(clierr.NotFound, "%s %s not found in namespace %s", strings.ToLower(kind), name, namespace)
+		}
+		return nil, fmt.Errorf("failed to get %s %s: %w", strings.ToLower(kind), name, err)
+	}
+	return w, nil
+}
+
+// Restart triggers a new rollout by touching the restartedAt annotation of
+// the pod template, like 'kubectl rollout restart'
+func Restart(w Workload, now time.Time) error {
+	switch w.Kind() {
+	case KindJob, KindCronJob:
+		return clierr.Usagef("%s %s cannot be restarted, it has no rollout", strings.ToLower(w.Kind()), w.GetName())
+	}
+	tmpl := w.GetPodTemplate()
+	if tmpl.Annotations == nil {
+		tmpl.Annotations = map[string]string{}
+	}
+	tmpl.Annotations[restartedAtAnnotation] = now.Format(time.RFC3339)
+	return nil
+}
+
+// setImage sets the image of the named container or of all containers
+func setImage(w Workload, container, image string) error {
+	spec := &w.GetPodTemplate().Spec
+	if container == "" {
+		for i := range spec.Containers {
+			spec.Containers[i].Image = image
+		}
+		return nil
+	}
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == container {
+			spec.Containers[i].Image = image
+			return nil
+		}
+	}
+	for i := range spec.InitContainers {
+		if spec.InitContainers[i].Name == container {
+			spec.InitContainers[i].Image = image
+			return nil
+		}
+	}
+	return clierr.Newf(clierr.NotFound, "%s %s has no container %q", strings.ToLower(w.Kind()), w.GetName(), container)
+}
+
+// selector converts a workload label selector
+func selector(w Workload, s *metav1.LabelSelector) (labels.Selector, error) {
+	sel, err := metav1.LabelSelectorAsSelector(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector on %s %s: %w", strings.ToLower(w.Kind()), w.GetName(), err)
+	}
+	return sel, nil
+}
+
+// Deployment is a Deployment workload
+type Deployment struct {
+	*appsv1.Deployment
+}
+
+// Kind returns Deployment
+func (d *Deployment) Kind() string { return KindDeployment }
+
+// GetPodTemplate returns the pod template
+func (d *Deployment) GetPodTemplate() *corev1.PodTemplateSpec { return &d.Spec.Template }
+
+// Selector returns the pod selector
+func (d *Deployment) Selector() (labels.Selector, error) { return selector(d, d.Spec.Selector) }
+
+// SetImage sets a container image
+func (d *Deployment) SetImage(container, image string) error { return setImage(d, container, image) }
+
+// RolloutStatus computes the rollout state
+func (d *Deployment) RolloutStatus() (rolloutstatus.Status, error) {
+	return rolloutstatus.Compute(d.Deployment)
+}
+
+// Changes lists what differs from before
+func (d *Deployment) Changes(before Workload) []changes.Change {
+	return changes.Deployment(before.(*Deployment).Deployment, d.Deployment)
+}
+
+// Copy returns a deep copy
+func (d *Deployment) Copy() Workload { return &Deployment{d.DeepCopy()} }
+
+// Update writes the Deployment
+func (d *Deployment) Update(ctx context.Context, clientset kubernetes.Interface) (Workload, error) {
+	updated, err := clientset.AppsV1().Deployments(d.Namespace).Update(ctx, d.Deployment, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update deployment: %w", err)
+	}
+	return &Deployment{updated}, nil
+}
+
+// Wait waits for the rollout
+func (d *Deployment) Wait(ctx context.Context, clientset kubernetes.Interface, timeout time.Duration, onUpdate func(rolloutstatus.Status)) error {
+	return rolloutstatus.Wait(ctx, clientset, d.Namespace, d.Name, timeout, func(_ *appsv1.Deployment, st rolloutstatus.Status) {
+		onUpdate(st)
+	})
+}
+
+// StatefulSet is a StatefulSet workload
+type StatefulSet struct {
+	*appsv1.StatefulSet
+}
+
+// Kind returns StatefulSet
+func (s *StatefulSet) Kind() string { return KindStatefulSet }
+
+// GetPodTemplate returns the pod template
+func (s *StatefulSet) GetPodTemplate() *corev1.PodTemplateSpec { return &s.Spec.Template }
+
+// Selector returns the pod selector
+func (s *StatefulSet) Selector() (labels.Selector, error) { return selector(s, s.Spec.Selector) }
+
+// SetImage sets a container image
+func (s *StatefulSet) SetImage(container, image string) error { return setImage(s, container, image) }
+
+// RolloutStatus computes the rollout state
+func (s *StatefulSet) RolloutStatus() (rolloutstatus.Status, error) {
+	return rolloutstatus.ComputeStatefulSet(s.StatefulSet)
+}
+
+// Changes lists what differs from before
+func (s *StatefulSet) Changes(before Workload) []changes.Change {
+	return changes.StatefulSet(before.(*StatefulSet).StatefulSet, s.StatefulSet)
+}
+
+// Copy returns a deep copy
+func (s *StatefulSet) Copy() Workload { return &StatefulSet{s.DeepCopy()} }
+
+// Update writes the StatefulSet
+func (s *StatefulSet) Update(ctx context.Context, clientset kubernetes.Interface) (Workload, error) {
+	updated, err := clientset.AppsV1().StatefulSets(s.Namespace).Update(ctx, s.StatefulSet, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update statefulset: %w", err)
+	}
+	return &StatefulSet{updated}, nil
+}
+
+// Wait waits for the rollout
+func (s *StatefulSet) Wait(ctx context.Context, clientset kubernetes.Interface, timeout time.Duration, onUpdate func(rolloutstatus.Status)) error {
+	return rolloutstatus.WaitStatefulSet(ctx, clientset, s.Namespace, s.Name, timeout, func(_ *appsv1.StatefulSet, st rolloutstatus.Status) {
+		onUpdate(st)
+	})
+}
+
+// DaemonSet is a DaemonSet workload
+type DaemonSet struct {
+	*appsv1.DaemonSet
+}
+
+// Kind returns DaemonSet
+func (d *DaemonSet) Kind() string { return KindDaemonSet }
+
+// GetPodTemplate returns the pod template
+func (d *DaemonSet) GetPodTemplate() *corev1.PodTemplateSpec { return &d.Spec.Template }
+
+// Selector returns the pod selector
+func (d *DaemonSet) Selector() (labels.Selector, error) { return selector(d, d.Spec.Selector) }
+
+// SetImage sets a container image
+func (d *DaemonSet) SetImage(container, image string) error { return setImage(d, container, image) }
+
+// RolloutStatus computes the rollout state
+func (d *DaemonSet) RolloutStatus() (rolloutstatus.Status, error) {
+	return rolloutstatus.ComputeDaemonSet(d.DaemonSet)
+}
+
+// Changes lists what differs from before
+func (d *DaemonSet) Changes(before Workload) []changes.Change {
+	return changes.DaemonSet(before.(*DaemonSet).DaemonSet, d.DaemonSet)
+}
+
+// Copy returns a deep copy
+func (d *DaemonSet) Copy() Workload { return &DaemonSet{d.DeepCopy()} }
+
+// Update writes the DaemonSet
+func (d *DaemonSet) Update(ctx context.Context, clientset kubernetes.Interface) (Workload, error) {
+	updated, err := clientset.AppsV1().DaemonSets(d.Namespace).Update(ctx, d.DaemonSet, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update daemonset: %w", err)
+	}
+	return &DaemonSet{updated}, nil
+}
+
+// Wait waits for the rollout
+func (d *DaemonSet) Wait(ctx context.Context, clientset kubernetes.Interface, timeout time.Duration, onUpdate func(rolloutstatus.Status)) error {
+	return rolloutstatus.WaitDaemonSet(ctx, clientset, d.Namespace, d.Name, timeout, func(_ *appsv1.DaemonSet, st rolloutstatus.Status) {
+		onUpdate(st)
+	})
+}
+
+// Job is a Job workload. Its pod template is immutable, so SetImage and
+// Update only work on Jobs that are about to be recreated.
+type Job struct {
+	*batchv1.Job
+}
+
+// Kind returns Job
+func (j *Job) Kind() string { return KindJob }
+
+// GetPodTemplate returns the pod template
+func (j *Job) GetPodTemplate() *corev1.PodTemplateSpec { return &j.Spec.Template }
+
+// Selector returns the pod selector
+func (j *Job) Selector() (labels.Selector, error) { return selector(j, j.Spec.Selector) }
+
+// SetImage sets a container image
+func (j *Job) SetImage(container, image string) error { return setImage(j, container, image) }
+
+// RolloutStatus reports whether the Job completed
+func (j *Job) RolloutStatus() (rolloutstatus.Status, error) {
+	return rolloutstatus.ComputeJob(j.Job)
+}
+
+// Changes lists what differs from before
+func (j *Job) Changes(before Workload) []changes.Change {
+	return changes.Job(before.(*Job).Job, j.Job)
+}
+
+// Copy returns a deep copy
+func (j *Job) Copy() Workload { return &Job{j.DeepCopy()} }
+
+// Update writes the Job
+func (j *Job) Update(ctx context.Context, clientset kubernetes.Interface) (Workload, error) {
+	updated, err := clientset.BatchV1().Jobs(j.Namespace).Update(ctx, j.Job, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update job (the pod template of a Job is immutable): %w", err)
+	}
+	return &Job{updated}, nil
+}
+
+// Wait waits for the Job to complete
+func (j *Job) Wait(ctx context.Context, clientset kubernetes.Interface, timeout time.Duration, onUpdate func(rolloutstatus.Status)) error {
+	return rolloutstatus.WaitJob(ctx, clientset, j.Namespace, j.Name, timeout, func(_ *batchv1.Job, st rolloutstatus.Status) {
+		onUpdate(st)
+	})
+}
+
+// CronJob is a CronJob workload. It has no rollout: the job template is
+// used from the next scheduled run on.
+type CronJob struct {
+	*batchv1.CronJob
+}
+
+// Kind returns CronJob
+func (c *CronJob) Kind() string { return KindCronJob }
+
+// GetPodTemplate returns the pod template of the job template
+func (c *CronJob) GetPodTemplate() *corev1.PodTemplateSpec { return &c.Spec.JobTemplate.Spec.Template }
+
+// Selector returns the selector of the job template, usually empty since
+// the Job controller generates it
+func (c *CronJob) Selector() (labels.Selector, error) {
+	return selector(c, c.Spec.JobTemplate.Spec.Selector)
+}
+
+// SetImage sets a container image
+func (c *CronJob) SetImage(container, image string) error { return setImage(c, container, image) }
+
+// RolloutStatus is always done, CronJobs have nothing to roll out
+func (c *CronJob) RolloutStatus() (rolloutstatus.Status, error) {
+	return rolloutstatus.Status{
+		Generation:         c.Generation,
+		ObservedGeneration: c.Generation,
+		Message:            fmt.Sprintf("cronjob %q has no rollout, the next scheduled job uses the new template", c.Name),
+		Done:               true,
+	}, nil
+}
+
+// Changes lists what differs from before
+func (c *CronJob) Changes(before Workload) []changes.Change {
+	return changes.CronJob(before.(*CronJob).CronJob, c.CronJob)
+}
+
+// Copy returns a deep copy
+func (c *CronJob) Copy() Workload { return &CronJob{c.DeepCopy()} }
+
+// Update writes the CronJob
+func (c *CronJob) Update(ctx context.Context, clientset kubernetes.Interface) (Workload, error) {
+	updated, err := clientset.BatchV1().CronJobs(c.Namespace).Update(ctx, c.CronJob, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update cronjob: %w", err)
+	}
+	return &CronJob{updated}, nil
+}
+
+// Wait returns immediately, there is no rollout to wait for
+func (c *CronJob) Wait(ctx context.Context, clientset kubernetes.Interface, timeout time.Duration, onUpdate func(rolloutstatus.Status)) error {
+	st, _ := c.RolloutStatus()
+	onUpdate(st)
+	return nil
+}
@@ -0,0 +1,97 @@
+package agefilter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"kube/pkg/shared/clierr"
+
+	"github.com/spf13/cobra"
+)
+
+// Filter selects objects by creation time with --older-than and --newer-than
+type Filter struct {
+	OlderThan string
+	NewerThan string
+
+	older time.Duration
+	newer time.Duration
+}
+
+// AddFlags registers --older-than and --newer-than on the command
+func (f *Filter) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.OlderThan, "older-than", "", "Only show objects created longer ago than this, e.g. 7d, 12h, 1w")
+	cmd.Flags().StringVar(&f.NewerThan, "newer-than", "", "Only show objects created within this duration, e.g. 1h, 30m")
+}
+
+// Validate parses the flag values. Call it before Match.
+func (f *Filter) Validate() error {
+	var err error
+	if f.OlderThan != "" {
+		if f.older, err = ParseAge(f.OlderThan); err != nil {
+			return clierr.Usagef("invalid --older-than: %v", err)
+		}
+	}
+	if f.NewerThan != "" {
+		if f.newer, err = ParseAge(f.NewerThan); err != nil {
+			return clierr.Usagef("invalid --newer-than: %v", err)
+		}
+	}
+	if f.older > 0 && f.newer > 0 && f.older >= f.newer {
+		return clierr.Usagef("--older-than %s and --newer-than %s match nothing", f.OlderThan, f.NewerThan)
+	}
+	return nil
+}
+
+// Active reports whether any age filter is set
+func (f *Filter) Active() bool {
+	return f.older > 0 || f.newer > 0
+}
+
+// Match reports whether an object created at created passes the filter
+func (f *Filter) Match(created, now time.Time) bool {
+	age := now.Sub(created)
+	if f.older > 0 && age < f.older {
+		return false
+	}
+	if f.newer > 0 && age > f.newer {
+		return false
+	}
+	return true
+}
+
+// ParseAge parses a duration like FormatAge prints it: Go durations (90s, 1h30m)
+// plus d (days) and w (weeks), e.g. 7d or 1w2d
+func ParseAge(s string) (time.Duration, error) {
+	rest := strings.TrimSpace(s)
+	var total time.Duration
+	for _, unit := range []struct {
+		suffix string
+		size   time.Duration
+	}{{"w", 7 * 24 * time.Hour}, {"d", 24 * time.Hour}} {
+		i := strings.Index(rest, unit.suffix)
+		if i < 0 {
+			continue
+		}
+		n, err := strconv.Atoi(rest[:i])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not a duration", s)
+		}
+		total += time.Duration(n) * unit.size
+		rest = rest[i+1:]
+	}
+
+	if rest != "" {
+		d, err := time.ParseDuration(rest)
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("%q is not a duration", s)
+		}
+		total += d
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("%q is not a positive duration", s)
+	}
+	return total, nil
+}
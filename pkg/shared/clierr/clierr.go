@@ -0,0 +1,120 @@
+package clierr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Exit codes shared by every binary so scripts can branch on the failure type
+const (
+	// Generic is used for errors without a more specific category
+	Generic = 1
+	// Usage means invalid arguments or flags
+	Usage = 2
+	// NotFound means the requested object does not exist
+	NotFound = 3
+	// Forbidden means the credentials are missing or not allowed to perform the request
+	Forbidden = 4
+	// Timeout means a wait or request did not finish in time
+	Timeout = 5
+	// Conflict means the object was modified concurrently or already exists
+	Conflict = 6
+	// Interrupted means the command was stopped by SIGINT or SIGTERM, 128+SIGINT like shells
+	Interrupted = 130
+)
+
+// Error attaches an exit code to an error
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap attaches the exit code to err, nil stays nil
+func Wrap(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Newf formats an error with the exit code
+func Newf(code int, format string, args ...interface{}) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// Usagef formats a usage error (exit code 2)
+func Usagef(format string, args ...interface{}) error {
+	return Newf(Usage, format, args...)
+}
+
+// Timeoutf formats a timeout error (exit code 5)
+func Timeoutf(format string, args ...interface{}) error {
+	return Newf(Timeout, format, args...)
+}
+
+// ExitCode returns the exit code for err. Explicit categories win; otherwise
+// Kubernetes API errors and context deadlines anywhere in the chain are mapped.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var cliErr *Error
+	if errors.As(err, &cliErr) {
+		return cliErr.Code
+	}
+
+	switch {
+	case apierrors.IsNotFound(err):
+		return NotFound
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		return Forbidden
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err), errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	case apierrors.IsConflict(err), apierrors.IsAlreadyExists(err):
+		return Conflict
+	case apierrors.IsBadRequest(err), apierrors.IsInvalid(err):
+		return Usage
+	}
+	return Generic
+}
+
+// IsServerResponse reports whether err is an HTTP error answered by the
+// server, as opposed to a connection, TLS or credential failure
+func IsServerResponse(err error) bool {
+	var status apierrors.APIStatus
+	return errors.As(err, &status)
+}
+
+// SetupUsage marks flag parsing and argument validation errors of root and
+// all its subcommands as usage errors
+func SetupUsage(root *cobra.Command) {
+	root.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return Wrap(Usage, err)
+	})
+
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		if validate := cmd.Args; validate != nil {
+			cmd.Args = func(c *cobra.Command, args []string) error {
+				return Wrap(Usage, validate(c, args))
+			}
+		}
+		for _, sub := range cmd.Commands() {
+			walk(sub)
+		}
+	}
+	walk(root)
+}
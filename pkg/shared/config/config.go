@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// FileEnv names a config file to use instead of $HOME/.kube.yaml
+const FileEnv = "KUBE_CMD_CONFIG"
+
+// Load reads the config file into viper: file when set, else the file named
+// by KUBE_CMD_CONFIG, else $HOME/.kube.yaml (.yml and .json work too).
+// A missing default file is not an error, tools then run with their defaults.
+func Load(file string) error {
+	if file == "" {
+		file = os.Getenv(FileEnv)
+	}
+	if file != "" {
+		viper.SetConfigFile(file)
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("failed to get home directory: %w", err)
+		}
+		// Look for config in home directory with name ".kube" (no extension)
+		viper.AddConfigPath(home)
+		viper.SetConfigType("yaml")
+		viper.SetConfigName(".kube")
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	return nil
+}
+
+// UnmarshalKey decodes the section at key, e.g. "deploy.imagePolicy", into
+// out. Keys of the section are matched case-insensitively.
+func UnmarshalKey(key string, out interface{}) error {
+	if err := viper.UnmarshalKey(key, out); err != nil {
+		return fmt.Errorf("invalid %s in %s: %w", key, viper.ConfigFileUsed(), err)
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kube/pkg/shared/clierr"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// defaults is the state of SetupDefaults: the command being run, the flags
+// whose value came from the config file, and when the file was read
+var defaults struct {
+	root    *cobra.Command
+	extra   []string
+	cmd     *cobra.Command
+	fromEnv map[string]bool
+	applied map[string]bool
+	modTime time.Time
+}
+
+// SetupDefaults makes the flags of a tool and its subcommands configurable.
+// A flag takes its default from an environment variable or from the section
+// of the tool in the config file, e.g. for kube-logs --tail:
+//
+//	KUBE_LOGS_TAIL=200
+//	logs:
+//	  tail: 200
+//
+// Flags of subcommands nest under the subcommand (pods.evict.max-unavailable,
+// KUBE_PODS_EVICT_MAX_UNAVAILABLE). Flags given on the command line win over
+// the environment, which wins over the config file. Keys of the section that
+// are no flag fail the command, so typos do not go unnoticed; extra names
+// keys the tool reads itself, like deploy.imagePolicy. --help lists the keys.
+func SetupDefaults(root *cobra.Command, extra ...string) {
+	defaults.root, defaults.extra = root, extra
+	root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		defaults.cmd = cmd
+		defaults.fromEnv, defaults.applied = map[string]bool{}, map[string]bool{}
+		if err := Load(""); err != nil {
+			return clierr.Wrap(clierr.Usage, err)
+		}
+		defaults.modTime = fileModTime()
+		return applyDefaults(cmd)
+	}
+
+	cobra.AddTemplateFunc("configDefaults", defaultsHelp)
+	root.SetHelpTemplate(root.HelpTemplate() + `{{with configDefaults .}}
+{{.}}{{end}}`)
+}
+
+// ReloadDefaults reads the config file again when it changed since it was
+// last read and applies the defaults to the flags that were not given on the
+// command line, so long-running commands like kube-pods --refresh pick up
+// edits. It reports whether the file was reloaded. On errors the previous
+// values stay in place.
+func ReloadDefaults() (bool, error) {
+	if defaults.cmd == nil || viper.ConfigFileUsed() == "" {
+		return false, nil
+	}
+	modTime := fileModTime()
+	if modTime.Equal(defaults.modTime) {
+		return false, nil
+	}
+	defaults.modTime = modTime
+	if err := viper.ReadInConfig(); err != nil {
+		return false, fmt.Errorf("failed to reload config file: %w", err)
+	}
+	if err := validateSection(); err != nil {
+		return false, err
+	}
+
+	// Flags whose key was removed go back to their built-in default
+	previous := defaults.applied
+	defaults.applied = map[string]bool{}
+	for name := range previous {
+		if flag := defaults.cmd.Flags().Lookup(name); flag != nil && !viper.IsSet(flagKey(defaults.cmd, flag)) {
+			if err := setFlag(flag, flag.DefValue); err != nil {
+				return false, err
+			}
+		}
+	}
+	if err := applyDefaults(defaults.cmd); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// applyDefaults sets the flags of cmd that were not given on the command
+// line from the environment or the config file
+func applyDefaults(cmd *cobra.Command) error {
+	if err := validateSection(); err != nil {
+		return err
+	}
+
+	var err error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed || flag.Name == "help" || defaults.fromEnv[flag.Name] {
+			return
+		}
+		key := flagKey(cmd, flag)
+		if value, ok := os.LookupEnv(envName(key)); ok {
+			if setErr := flag.Value.Set(value); setErr != nil {
+				err = clierr.Usagef("invalid %s=%q: %v", envName(key), value, setErr)
+			}
+			defaults.fromEnv[flag.Name] = true
+			return
+		}
+		if !viper.IsSet(key) {
+			return
+		}
+		if setErr := setFlag(flag, viper.Get(key)); setErr != nil {
+			err = clierr.Usagef("invalid %s in %s: %v", key, viper.ConfigFileUsed(), setErr)
+			return
+		}
+		defaults.applied[flag.Name] = true
+	})
+	return err
+}
+
+// setFlag sets a flag to a config value. Lists replace the values of slice
+// flags; a slice flag's default is written like [a,b].
+func setFlag(flag *pflag.Flag, value interface{}) error {
+	slice, isSlice := flag.Value.(pflag.SliceValue)
+	switch v := value.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		if isSlice {
+			return slice.Replace(values)
+		}
+		return flag.Value.Set(strings.Join(values, ","))
+	case string:
+		if isSlice && strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]") {
+			if v = strings.Trim(v, "[]"); v == "" {
+				return slice.Replace(nil)
+			}
+			return slice.Replace(strings.Split(v, ","))
+		}
+		return flag.Value.Set(v)
+	case map[string]interface{}:
+		return fmt.Errorf("expected a value, not a section")
+	default:
+		return flag.Value.Set(fmt.Sprint(v))
+	}
+}
+
+// validateSection fails on keys in the section of the tool that are neither
+// a flag of the tool or its subcommands nor one of the extra keys
+func validateSection() error {
+	valid := validKeys()
+	section := sectionName(defaults.root) + "."
+	for _, key := range viper.AllKeys() {
+		if !strings.HasPrefix(key, section) || valid[key] {
+			continue
+		}
+		known := false
+		for _, extra := range defaults.extra {
+			prefix := strings.ToLower(section + extra)
+			if key == prefix || strings.HasPrefix(key, prefix+".") {
+				known = true
+			}
+		}
+		if known {
+			continue
+		}
+		if suggestion := closestKey(key, valid); suggestion != "" {
+			return clierr.Usagef("unknown key %s in %s, did you mean %s?", key, viper.ConfigFileUsed(), suggestion)
+		}
+		return clierr.Usagef("unknown key %s in %s, see %s --help for the keys", key, viper.ConfigFileUsed(), defaults.root.Name())
+	}
+	return nil
+}
+
+// validKeys returns the config keys of all flags of the tool
+func validKeys() map[string]bool {
+	valid := map[string]bool{}
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+			valid[flagKey(cmd, flag)] = true
+		})
+		cmd.PersistentFlags().VisitAll(func(flag *pflag.Flag) {
+			valid[flagKey(cmd, flag)] = true
+		})
+		for _, sub := range cmd.Commands() {
+			walk(sub)
+		}
+	}
+	walk(defaults.root)
+	delete(valid, sectionName(defaults.root)+".help")
+	return valid
+}
+
+// flagKey returns the config key of a flag of cmd: the section of the tool,
+// the subcommands down to the one defining the flag, and the flag name.
+// Persistent flags of the tool are shared by its subcommands.
+func flagKey(cmd *cobra.Command, flag *pflag.Flag) string {
+	owner := cmd
+	if cmd.LocalFlags().Lookup(flag.Name) == nil {
+		for c := cmd.Parent(); c != nil; c = c.Parent() {
+			if c.PersistentFlags().Lookup(flag.Name) != nil {
+				owner = c
+				break
+			}
+		}
+	}
+	var path []string
+	for c := owner; c != nil && c.HasParent(); c = c.Parent() {
+		path = append([]string{c.Name()}, path...)
+	}
+	parts := append([]string{sectionName(defaults.root)}, path...)
+	return strings.ToLower(strings.Join(append(parts, flag.Name), "."))
+}
+
+// envName returns the environment variable of a config key,
+// logs.tail -> KUBE_LOGS_TAIL
+func envName(key string) string {
+	return "KUBE_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// sectionName returns the config section of a tool, kube-logs -> logs
+func sectionName(root *cobra.Command) string {
+	return strings.TrimPrefix(root.Name(), "kube-")
+}
+
+// fileModTime returns the modification time of the config file in use
+func fileModTime() time.Time {
+	info, err := os.Stat(viper.ConfigFileUsed())
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// defaultsHelp lists the config keys and environment variables of the flags
+// of cmd for --help
+func defaultsHelp(cmd *cobra.Command) string {
+	if defaults.root == nil {
+		return ""
+	}
+	var rows []string
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Name == "help" || flag.Hidden {
+			return
+		}
+		key := flagKey(cmd, flag)
+		rows = append(rows, fmt.Sprintf("  --%s\t%s\t%s", flag.Name, key, envName(key)))
+	})
+	if len(rows) == 0 {
+		return ""
+	}
+	sort.Strings(rows)
+
+	// Help runs before the config file is read for the command
+	if viper.ConfigFileUsed() == "" {
+		Load("")
+	}
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		file = "$HOME/.kube.yaml or $" + FileEnv
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Defaults from the environment and %s, flags on the command line win:\n", file)
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(w, row)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// closestKey returns the valid key closest to key by edit distance, when it
+// is close enough to be a typo
+func closestKey(key string, valid map[string]bool) string {
+	best, bestDistance := "", 3
+	for candidate := range valid {
+		if d := editDistance(key, candidate); d < bestDistance || (d == bestDistance && best != "" && candidate < best) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance of a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
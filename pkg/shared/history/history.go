@@ -0,0 +1,284 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/state"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// maxEntries is the number of entries kept when the file is compacted
+	maxEntries = 1000
+	// compactSize is the file size that triggers compaction
+	compactSize = 512 * 1024
+	// SkipAnnotation disables recording for a command when set to "true"
+	SkipAnnotation = "history.skip"
+	// redacted replaces secrets in the recorded arguments
+	redacted = "REDACTED"
+)
+
+// secretWords mark the flags whose values are not recorded, like --token,
+// --client-key or --db-password. Header values are redacted too but keep the
+// header name.
+var secretWords = map[string]bool{
+	"apikey":     true,
+	"auth":       true,
+	"credential": true,
+	"key":        true,
+	"passwd":     true,
+	"password":   true,
+	"secret":     true,
+	"token":      true,
+}
+
+// Entry is a single recorded invocation
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Command   string    `json:"command"`
+	Args      []string  `json:"args"`
+	Context   string    `json:"context,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+	// Redacted is set when secrets were removed from Args, so the entry
+	// cannot be re-run as recorded
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// Path returns location of the history file.
+// Uses $XDG_STATE_HOME/kube-cmd/history.jsonl (default ~/.local/state).
+func Path() string {
+	return state.Path("history.jsonl")
+}
+
+// Enabled reports whether recording is enabled (disable with KUBE_NO_HISTORY=1)
+func Enabled() bool {
+	v := os.Getenv("KUBE_NO_HISTORY")
+	return v == "" || v == "0" || v == "false"
+}
+
+// Record appends an entry to the history file
+func Record(entry Entry) error {
+	path := Path()
+	if path == "" {
+		return fmt.Errorf("cannot determine history location")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Size() > compactSize {
+		return compact(path)
+	}
+	return nil
+}
+
+// Load returns all recorded entries, oldest first
+func Load() ([]Entry, error) {
+	f, err := os.Open(Path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue // skip corrupted lines
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// RecordCommand records the invocation of an executed cobra command.
+// Errors are ignored: history must never break the actual command.
+func RecordCommand(cmd *cobra.Command, runErr error) {
+	if cmd == nil || !Enabled() || cmd.Annotations[SkipAnnotation] == "true" {
+		return
+	}
+	if help, _ := cmd.Flags().GetBool("help"); help {
+		return
+	}
+
+	entry := Entry{
+		Time:    time.Now(),
+		Command: cmd.Root().Name(),
+		Success: runErr == nil,
+	}
+	entry.Args, entry.Redacted = redactArgs(os.Args[1:])
+	if runErr != nil {
+		entry.Error = runErr.Error()
+	}
+
+	entry.Context = flagValue(cmd, "context")
+	entry.Namespace = flagValue(cmd, "namespace")
+	if entry.Context == "" || entry.Namespace == "" {
+		if config, err := k8s.LoadRawConfig(); err == nil {
+			if entry.Context == "" {
+				entry.Context = config.CurrentContext
+			}
+			if entry.Namespace == "" {
+				entry.Namespace = "default"
+				if ctx, ok := config.Contexts[entry.Context]; ok && ctx.Namespace != "" {
+					entry.Namespace = ctx.Namespace
+				}
+			}
+		}
+	}
+
+	Record(entry)
+}
+
+// redactArgs returns a copy of args without the values of secret flags,
+// without the user info of URLs, like the credentials of a --push URL, and
+// without the command after --, whose flags are unknown. It reports whether
+// anything was redacted.
+func redactArgs(args []string) ([]string, bool) {
+	out := make([]string, 0, len(args))
+	secretNext, changed := false, false
+	for i, arg := range args {
+		switch {
+		case secretNext:
+			out = append(out, redactFlagValue(args[i-1], arg))
+			secretNext = false
+		case arg == "--":
+			if i+1 < len(args) {
+				return append(out, arg, redacted), true
+			}
+			out = append(out, arg)
+		case isSecretFlag(arg):
+			out = append(out, arg)
+			secretNext = true
+		default:
+			out = append(out, redactURL(arg))
+			if name, value, ok := strings.Cut(arg, "="); ok && isSecretFlag(name) {
+				out[i] = name + "=" + redactFlagValue(name, value)
+			} else if strings.HasPrefix(arg, "-H") && !strings.HasPrefix(arg, "--") && len(arg) > 2 {
+				out[i] = "-H" + redactFlagValue("-H", arg[2:])
+			}
+		}
+		if out[i] != arg {
+			changed = true
+		}
+	}
+	return out, changed
+}
+
+// isSecretFlag reports whether flag is -H, --header or a long flag with a
+// secret word in its name, like --client-secret or --api-keys
+func isSecretFlag(flag string) bool {
+	if flag == "-H" || flag == "--header" {
+		return true
+	}
+	if !strings.HasPrefix(flag, "--") {
+		return false
+	}
+	words := strings.FieldsFunc(strings.ToLower(flag[2:]), func(r rune) bool {
+		return r == '-' || r == '_' || r == '.'
+	})
+	for _, word := range words {
+		if secretWords[word] || secretWords[strings.TrimSuffix(word, "s")] {
+			return true
+		}
+	}
+	return false
+}
+
+// redactFlagValue redacts the value of a secret flag, keeping the name of headers
+func redactFlagValue(flag, value string) string {
+	if flag == "-H" || flag == "--header" {
+		if name, _, ok := strings.Cut(value, ":"); ok {
+			return name + ": " + redacted
+		}
+	}
+	return redacted
+}
+
+// redactURL replaces the user info of a URL argument or flag value
+func redactURL(arg string) string {
+	prefix, value := "", arg
+	if name, v, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(name, "-") {
+		prefix, value = name+"=", v
+	}
+	if !strings.Contains(value, "://") {
+		return arg
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return arg
+	}
+	u.User = url.User(redacted)
+	return prefix + u.String()
+}
+
+// flagValue returns value of a string flag if the command defines it
+func flagValue(cmd *cobra.Command, name string) string {
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil || flag.Value.Type() != "string" {
+		return ""
+	}
+	return flag.Value.String()
+}
+
+// compact rewrites the history file keeping only the newest maxEntries
+func compact(path string) error {
+	entries, err := Load()
+	if err != nil {
+		return err
+	}
+	if len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,298 @@
+package imagepolicy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"kube/pkg/shared/clierr"
+)
+
+// Policy restricts the images that may be deployed. It is read from the
+// deploy.imagePolicy section of the config file.
+type Policy struct {
+	// DenyLatest rejects the :latest tag
+	DenyLatest bool `mapstructure:"denyLatest"`
+	// RequireTag rejects images without a tag or digest
+	RequireTag bool `mapstructure:"requireTag"`
+	// TagPattern is a regular expression tags must match, e.g. semver
+	TagPattern string `mapstructure:"tagPattern"`
+	// VerifyRegistry checks that the tag exists in the registry
+	VerifyRegistry bool `mapstructure:"verifyRegistry"`
+
+	pattern *regexp.Regexp
+}
+
+// Validate compiles the tag pattern. Call it before Check.
+func (p *Policy) Validate() error {
+	if p.TagPattern == "" {
+		return nil
+	}
+	pattern, err := regexp.Compile(p.TagPattern)
+	if err != nil {
+		return clierr.Usagef("invalid deploy.imagePolicy.tagPattern %q: %v", p.TagPattern, err)
+	}
+	p.pattern = pattern
+	return nil
+}
+
+// Reference is a parsed image reference
+type Reference struct {
+	// Registry is the registry host, registry-1.docker.io for Docker Hub
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// dockerHub is the registry of images without a registry host
+const dockerHub = "registry-1.docker.io"
+
+// Parse splits an image reference like repo/app:1.2, ghcr.io/org/app@sha256:...
+// or localhost:5000/app into its parts. Docker Hub images get the library/
+// prefix of official images.
+func Parse(image string) (Reference, error) {
+	var ref Reference
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.Digest = name[:i], name[i+1:]
+	}
+	// A colon after the last slash separates the tag, before it the port
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+	}
+	if name == "" || strings.HasSuffix(name, "/") {
+		return ref, clierr.Usagef("invalid image reference %q", image)
+	}
+
+	first, rest, found := strings.Cut(name, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.Registry, ref.Repository = first, rest
+	} else {
+		ref.Registry, ref.Repository = dockerHub, name
+		if !found {
+			ref.Repository = "library/" + name
+		}
+	}
+	return ref, nil
+}
+
+// Check returns an error describing the first rule image violates
+func (p Policy) Check(image string) error {
+	ref, err := Parse(image)
+	if err != nil {
+		return err
+	}
+	switch {
+	case ref.Digest != "":
+		// Pinned by digest, the tag is informational only
+		return nil
+	case ref.Tag == "" && p.RequireTag:
+		return fmt.Errorf("image %s has no tag", image)
+	case ref.Tag == "latest" && p.DenyLatest:
+		return fmt.Errorf("image %s uses the latest tag", image)
+	case p.pattern != nil && !p.pattern.MatchString(ref.Tag):
+		return fmt.Errorf("tag %q of image %s does not match %s", ref.Tag, image, p.TagPattern)
+	}
+	return nil
+}
+
+// manifestTypes are the manifest formats accepted when checking a tag
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Verify checks with the registry API that the tag or digest of image exists.
+// Anonymous access is tried first; credentials come from the "auth" entries
+// of the Docker config file (credential helpers are not supported).
+func Verify(ctx context.Context, image string) error {
+	_, err := Digest(ctx, image)
+	return err
+}
+
+// Digest returns the digest the registry serves for the tag of image, the
+// digest a pull would resolve to now. Authentication works like Verify.
+func Digest(ctx context.Context, image string) (string, error) {
+	ref, err := Parse(image)
+	if err != nil {
+		return "", err
+	}
+	version := ref.Digest
+	if version == "" {
+		version = ref.Tag
+	}
+	if version == "" {
+		version = "latest"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", ref.Registry, ref.Repository, version)
+	resp, err := headManifest(ctx, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		authorization, err := authorize(ctx, ref, resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return "", err
+		}
+		if resp, err = headManifest(ctx, manifestURL, authorization); err != nil {
+			return "", err
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Header.Get("Docker-Content-Digest"), nil
+	case http.StatusNotFound:
+		return "", clierr.Newf(clierr.NotFound, "image %s not found in registry %s", image, ref.Registry)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "", clierr.Newf(clierr.Forbidden, "not allowed to read %s from registry %s (%s), log in with docker login", ref.Repository, ref.Registry, resp.Status)
+	}
+	return "", fmt.Errorf("registry %s answered %s for %s", ref.Registry, resp.Status, image)
+}
+
+// headManifest requests the manifest headers
+func headManifest(ctx context.Context, manifestURL, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach registry: %w", err)
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// authorize answers a registry challenge: Basic with the stored credentials,
+// Bearer with a token from the realm of the challenge
+func authorize(ctx context.Context, ref Reference, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	username, password := credentials(ref.Registry)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if username == "" {
+			return "", clierr.Newf(clierr.Forbidden, "registry %s requires credentials, log in with docker login", ref.Registry)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("registry %s uses unsupported authentication %q", ref.Registry, scheme)
+	}
+
+	values := parseChallenge(params)
+	tokenURL, err := url.Parse(values["realm"])
+	if err != nil || values["realm"] == "" {
+		return "", fmt.Errorf("registry %s sent an invalid auth challenge %q", ref.Registry, challenge)
+	}
+	query := tokenURL.Query()
+	if service := values["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", "repository:"+ref.Repository+":pull")
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", clierr.Newf(clierr.Forbidden, "registry %s refused a token for %s: %s", ref.Registry, ref.Repository, resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid token response from %s: %w", tokenURL.Host, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// challengeParam matches key="value" pairs of a WWW-Authenticate header
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// parseChallenge returns the parameters of a WWW-Authenticate challenge
+func parseChallenge(params string) map[string]string {
+	values := map[string]string{}
+	for _, m := range challengeParam.FindAllStringSubmatch(params, -1) {
+		values[strings.ToLower(m[1])] = m[2]
+	}
+	return values
+}
+
+// credentials returns the login stored by docker login for the registry,
+// from $DOCKER_CONFIG/config.json (default ~/.docker)
+func credentials(registry string) (string, string) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", ""
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", ""
+	}
+	var cfg struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if json.Unmarshal(data, &cfg) != nil {
+		return "", ""
+	}
+
+	keys := []string{registry, "https://" + registry}
+	if registry == dockerHub {
+		keys = append(keys, "https://index.docker.io/v1/", "index.docker.io", "docker.io")
+	}
+	for _, key := range keys {
+		entry, ok := cfg.Auths[key]
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			continue
+		}
+		if username, password, ok := strings.Cut(string(decoded), ":"); ok {
+			return username, password
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,103 @@
+package interrupt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"kube/pkg/shared/clierr"
+)
+
+// ErrInterrupted is the cancellation cause of contexts returned by Context
+var ErrInterrupted = errors.New("interrupted")
+
+var (
+	install  sync.Once
+	received atomic.Bool
+	root     context.Context
+	cancel   context.CancelCauseFunc
+
+	mu       sync.Mutex
+	cleanups = map[int]func(){}
+	nextID   int
+)
+
+// Context returns a context that is cancelled on SIGINT or SIGTERM. Commands
+// pass it to API requests, watches and streams so they stop, close what they
+// opened and return. A second signal runs the OnExit functions and exits at
+// once, for commands stuck somewhere that ignores the context.
+func Context(parent context.Context) (context.Context, context.CancelFunc) {
+	install.Do(func() {
+		root, cancel = context.WithCancelCause(context.Background())
+		signals := make(chan os.Signal, 2)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-signals
+			received.Store(true)
+			cancel(ErrInterrupted)
+			<-signals
+			runCleanups()
+			os.Exit(clierr.Interrupted)
+		}()
+	})
+
+	ctx, cancelCtx := context.WithCancelCause(parent)
+	stop := context.AfterFunc(root, func() { cancelCtx(ErrInterrupted) })
+	return ctx, func() {
+		stop()
+		cancelCtx(context.Canceled)
+	}
+}
+
+// Received reports whether SIGINT or SIGTERM was received since Context was
+// first called
+func Received() bool {
+	return received.Load()
+}
+
+// OnExit registers fn to run before a forced exit on the second signal, and
+// by ExitIfReceived. Use it for state that must not outlive the process, like
+// a terminal in raw mode. The returned function unregisters fn.
+func OnExit(fn func()) func() {
+	mu.Lock()
+	defer mu.Unlock()
+	id := nextID
+	nextID++
+	cleanups[id] = fn
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(cleanups, id)
+	}
+}
+
+// ExitIfReceived exits with clierr.Interrupted when the command was stopped
+// by a signal, so scripts can tell an interrupted run from a finished one.
+// Binaries call it with the error of the command once it returned; the error
+// is printed first since it may tell where to resume.
+func ExitIfReceived(err error) {
+	if !Received() {
+		return
+	}
+	runCleanups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	os.Exit(clierr.Interrupted)
+}
+
+// runCleanups runs and unregisters the OnExit functions
+func runCleanups() {
+	mu.Lock()
+	fns := cleanups
+	cleanups = map[int]func(){}
+	mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
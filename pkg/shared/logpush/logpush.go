@@ -0,0 +1,264 @@
+package logpush
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize     = 10000
+	batchSize     = 500
+	flushInterval = time.Second
+)
+
+// Entry is a single log line with its labels
+type Entry struct {
+	Time   time.Time
+	Line   string
+	Labels map[string]string
+}
+
+// sink sends a batch of entries to a log backend
+type sink interface {
+	send(client *http.Client, entries []Entry) error
+}
+
+// Pusher ships log lines to a backend in the background.
+// Lines are queued without blocking; when the queue is full they are dropped
+// and counted so a slow backend never stalls the terminal output.
+type Pusher struct {
+	target  string
+	sink    sink
+	client  *http.Client
+	entries chan Entry
+	done    chan struct{}
+
+	mu      sync.Mutex
+	dropped int
+	failed  int
+	lastErr error
+}
+
+// New creates a Pusher from a spec of the form <backend>=<url>.
+// Supported backends:
+//   - loki=<url>     Loki push API (/loki/api/v1/push is appended when no path is given)
+//   - elastic=<url>  Elasticsearch bulk API, url must include the index (http://es:9200/logs)
+//   - http=<url>     generic endpoint receiving newline-delimited JSON documents
+func New(spec string) (*Pusher, error) {
+	backend, url, ok := strings.Cut(spec, "=")
+	if !ok || url == "" {
+		return nil, fmt.Errorf("invalid push target '%s', expected <loki|elastic|http>=<url>", spec)
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("invalid push url '%s', must start with http:// or https://", url)
+	}
+
+	var s sink
+	switch backend {
+	case "loki":
+		s = &lokiSink{url: lokiPushURL(url)}
+	case "elastic", "elk":
+		s = &elasticSink{url: strings.TrimSuffix(url, "/")}
+	case "http":
+		s = &httpSink{url: url}
+	default:
+		return nil, fmt.Errorf("unknown push backend '%s', expected loki, elastic or http", backend)
+	}
+
+	p := &Pusher{
+		target:  spec,
+		sink:    s,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		entries: make(chan Entry, queueSize),
+		done:    make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// Push queues an entry for shipping
+func (p *Pusher) Push(entry Entry) {
+	select {
+	case p.entries <- entry:
+	default:
+		p.mu.Lock()
+		p.dropped++
+		p.mu.Unlock()
+	}
+}
+
+// Close flushes queued entries and reports lines that could not be shipped
+func (p *Pusher) Close() error {
+	close(p.entries)
+	<-p.done
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failed > 0 {
+		return fmt.Errorf("push to %s: %d line(s) failed, %d dropped: %w", p.target, p.failed, p.dropped, p.lastErr)
+	}
+	if p.dropped > 0 {
+		return fmt.Errorf("push to %s: %d line(s) dropped because the backend could not keep up", p.target, p.dropped)
+	}
+	return nil
+}
+
+// run batches queued entries by size and interval
+func (p *Pusher) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Entry, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := p.sink.send(p.client, batch); err != nil {
+			p.mu.Lock()
+			p.failed += len(batch)
+			p.lastErr = err
+			p.mu.Unlock()
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry, ok := <-p.entries:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// post sends body and treats non-2xx responses as errors
+func post(client *http.Client, url, contentType string, body []byte) error {
+	resp, err := client.Post(url, contentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// lokiPushURL appends the push API path when url has no path
+func lokiPushURL(url string) string {
+	rest := url[strings.Index(url, "://")+3:]
+	if !strings.Contains(strings.TrimSuffix(rest, "/"), "/") {
+		return strings.TrimSuffix(url, "/") + "/loki/api/v1/push"
+	}
+	return url
+}
+
+// lokiSink ships entries to the Loki push API, one stream per label set
+type lokiSink struct {
+	url string
+}
+
+func (s *lokiSink) send(client *http.Client, entries []Entry) error {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+
+	streams := map[string]*stream{}
+	var order []string
+	for _, e := range entries {
+		key := labelKey(e.Labels)
+		st, ok := streams[key]
+		if !ok {
+			st = &stream{Stream: e.Labels}
+			streams[key] = st
+			order = append(order, key)
+		}
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(e.Time.UnixNano(), 10), e.Line})
+	}
+
+	payload := struct {
+		Streams []*stream `json:"streams"`
+	}{}
+	for _, key := range order {
+		payload.Streams = append(payload.Streams, streams[key])
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(client, s.url, "application/json", body)
+}
+
+// elasticSink ships entries with the Elasticsearch bulk API
+type elasticSink struct {
+	url string
+}
+
+func (s *elasticSink) send(client *http.Client, entries []Entry) error {
+	// url is <base>/<index>; the bulk endpoint lives under the index
+	var buf bytes.Buffer
+	for _, e := range entries {
+		buf.WriteString(`{"index":{}}` + "\n")
+		if err := writeDocument(&buf, e); err != nil {
+			return err
+		}
+	}
+	return post(client, s.url+"/_bulk", "application/x-ndjson", buf.Bytes())
+}
+
+// httpSink posts entries as newline-delimited JSON documents
+type httpSink struct {
+	url string
+}
+
+func (s *httpSink) send(client *http.Client, entries []Entry) error {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		if err := writeDocument(&buf, e); err != nil {
+			return err
+		}
+	}
+	return post(client, s.url, "application/x-ndjson", buf.Bytes())
+}
+
+// writeDocument writes an entry as a flat JSON document followed by a newline
+func writeDocument(buf *bytes.Buffer, e Entry) error {
+	doc := make(map[string]string, len(e.Labels)+2)
+	for k, v := range e.Labels {
+		doc[k] = v
+	}
+	doc["@timestamp"] = e.Time.UTC().Format(time.RFC3339Nano)
+	doc["message"] = e.Line
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	buf.WriteByte('\n')
+	return nil
+}
+
+// labelKey builds a stable key for a label set
+func labelKey(labels map[string]string) string {
+	data, _ := json.Marshal(labels) // map keys are marshaled in sorted order
+	return string(data)
+}
@@ -0,0 +1,111 @@
+package sanitize
+
+import (
+	"io"
+)
+
+// state is where the writer is within a control sequence
+type state int
+
+const (
+	text state = iota
+	escape
+	csi
+	control // OSC, DCS, SOS, PM or APC string, ended by BEL or ST
+	controlEsc
+	c1Lead // 0xC2, the first byte of a UTF-8 encoded C1 control
+)
+
+// Writer removes terminal control sequences from everything written through
+// it: CSI sequences (colors, cursor movement, screen clearing), OSC and other
+// control strings (window titles, hyperlinks, clipboard writes), C1 controls
+// and C0 controls other than tab and newline. Carriage returns are dropped
+// too, so output cannot overwrite itself. Sequences split across writes are
+// handled.
+type Writer struct {
+	w     io.Writer
+	state state
+	buf   []byte
+}
+
+// NewWriter returns a Writer that writes the scrubbed output to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write scrubs p and writes the rest. It reports len(p) on success since
+// removed bytes count as written.
+func (s *Writer) Write(p []byte) (int, error) {
+	out := s.buf[:0]
+	for _, b := range p {
+		switch s.state {
+		case escape:
+			switch b {
+			case '[':
+				s.state = csi
+			case ']', 'P', 'X', '^', '_':
+				s.state = control
+			default:
+				// Two-byte sequences like ESC c (reset) or ESC 7 (save cursor)
+				s.state = text
+			}
+		case csi:
+			// Parameters and intermediates end with a final byte 0x40-0x7E
+			if b >= 0x40 && b <= 0x7e {
+				s.state = text
+			}
+		case control:
+			switch b {
+			case 0x07:
+				s.state = text
+			case 0x1b:
+				s.state = controlEsc
+			}
+		case controlEsc:
+			if b == '\\' {
+				s.state = text
+			} else {
+				s.state = control
+			}
+		case c1Lead:
+			switch {
+			case b == 0x9b:
+				s.state = csi
+			case b == 0x90 || b == 0x98 || b == 0x9d || b == 0x9e || b == 0x9f:
+				s.state = control
+			case b >= 0x80 && b <= 0x9f:
+				s.state = text
+			default:
+				out = append(out, 0xc2)
+				s.state = text
+				out = s.text(out, b)
+			}
+		default:
+			out = s.text(out, b)
+		}
+	}
+	s.buf = out
+	if len(out) > 0 {
+		if _, err := s.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// text handles a byte outside of a sequence
+func (s *Writer) text(out []byte, b byte) []byte {
+	switch {
+	case b == 0x1b:
+		s.state = escape
+	case b == 0xc2:
+		s.state = c1Lead
+	case b == '\n' || b == '\t':
+		out = append(out, b)
+	case b < 0x20 || b == 0x7f:
+		// Other C0 controls, including carriage return, bell and backspace
+	default:
+		out = append(out, b)
+	}
+	return out
+}
@@ -0,0 +1,178 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"kube/pkg/kubernetes/k8s"
+	"kube/pkg/shared/clierr"
+)
+
+// Last is the target that repeats the last used pod or port-forward,
+// like cd - in the shell
+const Last = "-"
+
+// State is what the tools remember between runs
+type State struct {
+	// PreviousContext is the context kube-switch-context last switched away from
+	PreviousContext string `json:"previousContext,omitempty"`
+	// Pod is the pod kube-logs, kube-exec or kube-port-forward last worked with
+	Pod *Pod `json:"pod,omitempty"`
+	// Forward is the last port-forward started
+	Forward *Forward `json:"forward,omitempty"`
+}
+
+// Pod is a pod a command worked with
+type Pod struct {
+	Context   string    `json:"context,omitempty"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Container string    `json:"container,omitempty"`
+	Used      time.Time `json:"used"`
+}
+
+// Forward is a port-forward as it was given on the command line, so a
+// service target picks a current pod when it is repeated
+type Forward struct {
+	Context   string    `json:"context,omitempty"`
+	Namespace string    `json:"namespace"`
+	Target    string    `json:"target"`
+	Ports     string    `json:"ports"`
+	Used      time.Time `json:"used"`
+}
+
+// Dir returns the directory of the state files of the tools.
+// Uses $XDG_STATE_HOME/kube-cmd (default ~/.local/state).
+func Dir() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "kube-cmd")
+}
+
+// Path returns location of a state file, or "" when there is no home
+// directory to keep it in
+func Path(name string) string {
+	dir := Dir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
+
+// Load returns the remembered state, empty when nothing was remembered yet
+func Load() (State, error) {
+	var s State
+	data, err := os.ReadFile(Path("last.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return s, fmt.Errorf("failed to read state: %w", err)
+	}
+	// A corrupted file only loses what was remembered
+	json.Unmarshal(data, &s)
+	return s, nil
+}
+
+// Update changes the remembered state with fn. The file is replaced at once,
+// so tools running at the same time never read half of it.
+func Update(fn func(s *State)) error {
+	path := Path("last.json")
+	if path == "" {
+		return fmt.Errorf("cannot determine state location")
+	}
+	s, err := Load()
+	if err != nil {
+		return err
+	}
+	fn(&s)
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".last-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}
+
+// RememberPod records the pod a command worked with for the - target. An
+// empty context is the current one. Errors are ignored: remembering must
+// never break the actual command.
+func RememberPod(pod Pod) {
+	if k8s.FromDir != "" {
+		return
+	}
+	pod.Context = contextName(pod.Context)
+	pod.Used = time.Now()
+	Update(func(s *State) { s.Pod = &pod })
+}
+
+// RememberForward records a port-forward for kube-port-forward -
+func RememberForward(forward Forward) {
+	forward.Context = contextName(forward.Context)
+	forward.Used = time.Now()
+	Update(func(s *State) { s.Forward = &forward })
+}
+
+// contextName returns name, or the current context when it is empty, so the
+// pod is found again after switching contexts
+func contextName(name string) string {
+	if name != "" {
+		return name
+	}
+	if config, err := k8s.LoadRawConfig(); err == nil {
+		return config.CurrentContext
+	}
+	return ""
+}
+
+// LastPod returns the pod last used by kube-logs, kube-exec or
+// kube-port-forward
+func LastPod() (Pod, error) {
+	s, err := Load()
+	if err != nil {
+		return Pod{}, err
+	}
+	if s.Pod == nil {
+		return Pod{}, clierr.Newf(clierr.NotFound, "no pod used yet, - repeats the pod of the last kube-logs, kube-exec or kube-port-forward")
+	}
+	return *s.Pod, nil
+}
+
+// LastForward returns the last port-forward
+func LastForward() (Forward, error) {
+	s, err := Load()
+	if err != nil {
+		return Forward{}, err
+	}
+	if s.Forward == nil {
+		return Forward{}, clierr.Newf(clierr.NotFound, "no port-forward started yet")
+	}
+	return *s.Forward, nil
+}
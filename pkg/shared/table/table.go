@@ -0,0 +1,283 @@
+package table
+
+import (
+	"bufio"
+	"encoding/csv"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"kube/pkg/shared/clierr"
+
+	"github.com/spf13/cobra"
+)
+
+var ansi = regexp.MustCompile("\\x1b\\[[0-9;]*m")
+
+// Options controls how list commands print their results
+type Options struct {
+	// Quiet prints only the name column, one value per line
+	Quiet bool
+	// NoHeaders prints aligned rows without headers, borders or colors
+	NoHeaders bool
+	// Output is table, csv, markdown or one of the extra formats the
+	// command prints itself
+	Output string
+
+	extra []string
+}
+
+// formats are the output formats Print renders
+var formats = []string{"table", "csv", "markdown"}
+
+// AddFlags registers -q/--quiet, --no-headers and -o/--output on the command.
+// extra lists output formats the command handles itself, e.g. jsonl.
+func (o *Options) AddFlags(cmd *cobra.Command, extra ...string) {
+	o.extra = extra
+	cmd.Flags().BoolVarP(&o.Quiet, "quiet", "q", false, "Only print names, one per line")
+	cmd.Flags().BoolVar(&o.NoHeaders, "no-headers", false, "Print rows without headers, borders or colors")
+	cmd.Flags().StringVarP(&o.Output, "output", "o", "table", "Output format: "+o.formatList())
+}
+
+// Validate checks the output flags. Call it before creating the client.
+func (o *Options) Validate() error {
+	valid := false
+	for _, format := range append(formats[:len(formats):len(formats)], o.extra...) {
+		valid = valid || o.Output == format
+	}
+	switch {
+	case !valid && o.Output != "":
+		return clierr.Usagef("unsupported output format %q (use %s)", o.Output, o.formatList())
+	case o.Quiet && (o.Output == "csv" || o.Output == "markdown"):
+		return clierr.Usagef("--quiet cannot be used with -o %s", o.Output)
+	case o.NoHeaders && o.Output == "markdown":
+		return clierr.Usagef("--no-headers cannot be used with -o markdown")
+	}
+	return nil
+}
+
+// Bordered reports whether Print renders the bordered table, the only
+// format that leaves room for notes and totals around it
+func (o Options) Bordered() bool {
+	return !o.Quiet && !o.NoHeaders && (o.Output == "" || o.Output == "table")
+}
+
+// formatList returns the accepted output formats for messages
+func (o Options) formatList() string {
+	all := append(formats[:len(formats):len(formats)], o.extra...)
+	return strings.Join(all[:len(all)-1], ", ") + " or " + all[len(all)-1]
+}
+
+// Output is buffered and flushed in chunks at line boundaries, so large
+// listings go out in a few big writes without partial lines in between
+const (
+	bufferSize = 64 * 1024
+	flushSize  = 32 * 1024
+)
+
+// Print renders rows according to the options.
+// nameColumn is the index of the column printed with --quiet.
+func (o Options) Print(headers []string, rows [][]string, nameColumn int) {
+	switch {
+	case o.Quiet:
+		w := newWriter()
+		for _, row := range rows {
+			w.WriteString(StripANSI(row[nameColumn]))
+			endLine(w)
+		}
+		w.Flush()
+	case o.Output == "csv":
+		renderCSV(headers, rows, !o.NoHeaders)
+	case o.Output == "markdown":
+		renderMarkdown(headers, rows)
+	case o.NoHeaders:
+		renderPlain(rows)
+	default:
+		Render(headers, rows)
+	}
+}
+
+// Render prints an ASCII table with simple borders
+// headers: column headers, rows: row data
+func Render(headers []string, rows [][]string) {
+	all := make([][]string, 0, len(rows)+1)
+	all = append(all, headers)
+	all = append(all, rows...)
+	widths := columnWidths(all)
+
+	w := newWriter()
+	writeSeparator(w, widths)
+	writeBorderedRow(w, headers, widths)
+	writeSeparator(w, widths)
+	for _, row := range rows {
+		writeBorderedRow(w, row, widths)
+	}
+	writeSeparator(w, widths)
+	w.Flush()
+}
+
+// renderPlain prints rows as space-aligned columns without colors,
+// suitable for awk, cut and xargs
+func renderPlain(rows [][]string) {
+	plain := make([][]string, len(rows))
+	for i, row := range rows {
+		plain[i] = make([]string, len(row))
+		for c, cell := range row {
+			if cell == "" {
+				cell = "-"
+			}
+			plain[i][c] = StripANSI(cell)
+		}
+	}
+
+	widths := columnWidths(plain)
+	w := newWriter()
+	for _, row := range plain {
+		// The last column is not padded, lines carry no trailing spaces
+		if n := len(row); n > 0 {
+			writeRow(w, row[:n-1], widths, "   ")
+			if n > 1 {
+				w.WriteString("   ")
+			}
+			w.WriteString(strings.TrimRight(row[n-1], " "))
+		}
+		endLine(w)
+	}
+	w.Flush()
+}
+
+// renderCSV prints rows as CSV without colors, for spreadsheets
+func renderCSV(headers []string, rows [][]string, withHeaders bool) {
+	w := newWriter()
+	cw := csv.NewWriter(w)
+	if withHeaders {
+		cw.Write(headers)
+	}
+	for _, row := range rows {
+		plain := make([]string, len(row))
+		for c, cell := range row {
+			plain[c] = StripANSI(cell)
+		}
+		cw.Write(plain)
+	}
+	cw.Flush()
+	w.Flush()
+}
+
+// renderMarkdown prints a GitHub-flavored Markdown table without colors,
+// padded so it also reads well as plain text
+func renderMarkdown(headers []string, rows [][]string) {
+	escape := strings.NewReplacer("|", "\\|", "\n", " ")
+	all := make([][]string, 0, len(rows)+1)
+	for _, row := range append([][]string{headers}, rows...) {
+		plain := make([]string, len(row))
+		for c, cell := range row {
+			plain[c] = escape.Replace(StripANSI(cell))
+		}
+		all = append(all, plain)
+	}
+	widths := columnWidths(all)
+	for i := range widths {
+		// The delimiter row needs at least three dashes
+		if widths[i] < 3 {
+			widths[i] = 3
+		}
+	}
+
+	w := newWriter()
+	writeBorderedRow(w, all[0], widths)
+	w.WriteByte('|')
+	for _, width := range widths {
+		w.WriteString(" " + strings.Repeat("-", width) + " |")
+	}
+	endLine(w)
+	for _, row := range all[1:] {
+		writeBorderedRow(w, row, widths)
+	}
+	w.Flush()
+}
+
+// DisplayWidth returns display length (excluding ANSI codes), counting
+// runes so glyphs like ✓ take one column
+func DisplayWidth(s string) int {
+	if strings.IndexByte(s, '\x1b') < 0 {
+		return utf8.RuneCountInString(s)
+	}
+	return utf8.RuneCountInString(StripANSI(s))
+}
+
+// StripANSI removes ANSI color codes
+func StripANSI(s string) string {
+	if strings.IndexByte(s, '\x1b') < 0 {
+		return s
+	}
+	return ansi.ReplaceAllString(s, "")
+}
+
+// columnWidths returns the widest cell of every column
+func columnWidths(rows [][]string) []int {
+	var widths []int
+	for _, row := range rows {
+		for c, cell := range row {
+			if c >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := DisplayWidth(cell); w > widths[c] {
+				widths[c] = w
+			}
+		}
+	}
+	return widths
+}
+
+// newWriter returns a buffered writer on stdout
+func newWriter() *bufio.Writer {
+	return bufio.NewWriterSize(os.Stdout, bufferSize)
+}
+
+// endLine ends the current line and flushes once a chunk has accumulated
+func endLine(w *bufio.Writer) {
+	w.WriteByte('\n')
+	if w.Buffered() >= flushSize {
+		w.Flush()
+	}
+}
+
+// writeRow writes the cells left-aligned to their column widths, joined by sep
+func writeRow(w *bufio.Writer, cols []string, widths []int, sep string) {
+	for i, col := range cols {
+		if i > 0 {
+			w.WriteString(sep)
+		}
+		w.WriteString(col)
+		writePadding(w, widths[i]-DisplayWidth(col))
+	}
+}
+
+// writeBorderedRow writes a table row between | borders
+func writeBorderedRow(w *bufio.Writer, cols []string, widths []int) {
+	w.WriteString("| ")
+	writeRow(w, cols, widths, " | ")
+	w.WriteString(" |")
+	endLine(w)
+}
+
+// writeSeparator writes a border line based on column widths
+func writeSeparator(w *bufio.Writer, widths []int) {
+	w.WriteByte('+')
+	for _, width := range widths {
+		for i := 0; i < width+2; i++ {
+			w.WriteByte('-')
+		}
+		w.WriteByte('+')
+	}
+	endLine(w)
+}
+
+// writePadding writes n spaces
+func writePadding(w *bufio.Writer, n int) {
+	for ; n > 0; n-- {
+		w.WriteByte(' ')
+	}
+}
@@ -0,0 +1,73 @@
+package table
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// benchRows builds a pods-like listing with colored status cells
+func benchRows(n int) ([]string, [][]string) {
+	headers := []string{"NAMESPACE", "NAME", "READY", "STATUS", "RESTARTS", "AGE", "NODE"}
+	rows := make([][]string, 0, n)
+	for i := 0; i < n; i++ {
+		status := "\033[32mRunning\033[0m"
+		if i%50 == 0 {
+			status = "\033[31mCrashLoopBackOff\033[0m"
+		}
+		rows = append(rows, []string{
+			fmt.Sprintf("team-%d", i%20),
+			fmt.Sprintf("api-%d-7c9f8d6b5-x%04d", i%300, i),
+			"1/1",
+			status,
+			fmt.Sprint(i % 7),
+			fmt.Sprintf("%dd", i%90),
+			fmt.Sprintf("node-pool-a-%03d", i%40),
+		})
+	}
+	return headers, rows
+}
+
+// discardStdout points os.Stdout at /dev/null for the benchmark
+func discardStdout(b *testing.B) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	b.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+}
+
+func BenchmarkRender(b *testing.B) {
+	headers, rows := benchRows(5000)
+	discardStdout(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Render(headers, rows)
+	}
+}
+
+// BenchmarkRenderPrintln is the unbuffered baseline: one write per row
+func BenchmarkRenderPrintln(b *testing.B) {
+	headers, rows := benchRows(5000)
+	discardStdout(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		all := append([][]string{headers}, rows...)
+		widths := columnWidths(all)
+		for _, row := range all {
+			cells := make([]string, len(row))
+			for j, col := range row {
+				cells[j] = col + strings.Repeat(" ", widths[j]-DisplayWidth(col))
+			}
+			fmt.Println("| " + strings.Join(cells, " | ") + " |")
+		}
+	}
+}
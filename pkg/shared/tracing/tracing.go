@@ -0,0 +1,232 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing is configured with the standard OpenTelemetry environment variables:
+//
+//	OTEL_EXPORTER_OTLP_TRACES_ENDPOINT  full URL of the OTLP/HTTP traces endpoint
+//	OTEL_EXPORTER_OTLP_ENDPOINT         base URL, /v1/traces is appended
+//	OTEL_EXPORTER_OTLP_HEADERS          extra headers, key=value,key=value
+//	OTEL_SERVICE_NAME                   service.name (default kube-cmd)
+//	OTEL_RESOURCE_ATTRIBUTES            extra resource attributes, key=value,...
+//	OTEL_SDK_DISABLED=true              disable tracing
+//	TRACEPARENT                         W3C parent of the command span, e.g. from CI
+//
+// Spans are batched by the OpenTelemetry SDK and exported over OTLP/HTTP, the
+// rest when the command finishes.
+
+// flushTimeout bounds the export when the command finishes, so an unreachable
+// collector does not hold up the command
+const flushTimeout = 5 * time.Second
+
+var (
+	processStart = time.Now()
+
+	initOnce sync.Once
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+
+	rootOnce sync.Once
+	root     trace.Span
+
+	// exportErr is the first error the SDK reported while exporting in the background
+	errMu     sync.Mutex
+	exportErr error
+)
+
+// Span is a single timed operation
+type Span struct {
+	span trace.Span
+}
+
+// Enabled reports whether an OTLP endpoint is configured
+func Enabled() bool {
+	initOnce.Do(setup)
+	return provider != nil
+}
+
+// Start begins a span as child of the span in ctx (or of the command span).
+// It returns a nil span when tracing is disabled; all Span methods accept nil.
+func Start(ctx context.Context, name string, attrs map[string]interface{}) (context.Context, *Span) {
+	return start(ctx, name, trace.SpanKindInternal, attrs)
+}
+
+// StartClient begins a client span, used for outgoing requests
+func StartClient(ctx context.Context, name string, attrs map[string]interface{}) (context.Context, *Span) {
+	return start(ctx, name, trace.SpanKindClient, attrs)
+}
+
+func start(ctx context.Context, name string, kind trace.SpanKind, attrs map[string]interface{}) (context.Context, *Span) {
+	if !Enabled() {
+		return ctx, nil
+	}
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = trace.ContextWithSpan(ctx, commandSpan())
+	}
+
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		kvs = append(kvs, keyValue(k, v))
+	}
+	ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(kvs...))
+	return ctx, &Span{span: span}
+}
+
+// FromContext returns the span stored in ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil || !Enabled() {
+		return nil
+	}
+	span := trace.SpanFromContext(ctx)
+	if !span.SpanContext().IsValid() {
+		return nil
+	}
+	return &Span{span: span}
+}
+
+// SetAttr records an attribute on the span
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(keyValue(key, value))
+}
+
+// End finishes the span, marking it failed when err is not nil
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.span.SetStatus(codes.Error, err.Error())
+	} else {
+		s.span.SetStatus(codes.Ok, "")
+	}
+	s.span.End()
+}
+
+// TraceParent returns the W3C traceparent header value for the span
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(trace.ContextWithSpan(context.Background(), s.span), carrier)
+	return carrier.Get("traceparent")
+}
+
+// Finish ends the command span named after the executed command and exports
+// all spans. Export errors are reported on stderr and never fail the command.
+func Finish(cmd *cobra.Command, runErr error) {
+	if !Enabled() {
+		return
+	}
+	span := &Span{span: commandSpan()}
+	if cmd != nil {
+		span.span.SetName(cmd.CommandPath())
+	}
+	span.End(runErr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	err := provider.ForceFlush(ctx)
+	provider.Shutdown(ctx)
+
+	errMu.Lock()
+	if err == nil {
+		err = exportErr
+	}
+	errMu.Unlock()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to export traces: %v\n", err)
+	}
+}
+
+// commandSpan returns the root span covering the whole process
+func commandSpan() trace.Span {
+	rootOnce.Do(func() {
+		// Continue a trace started by the caller, e.g. a CI pipeline
+		parent := propagation.TraceContext{}.Extract(context.Background(),
+			propagation.MapCarrier{"traceparent": os.Getenv("TRACEPARENT")})
+		_, root = tracer.Start(parent, strings.Join(os.Args, " "),
+			trace.WithTimestamp(processStart),
+			trace.WithAttributes(attribute.String("process.command_args", strings.Join(os.Args, " "))))
+	})
+	return root
+}
+
+// setup configures the OTLP exporter from the environment. The exporter reads
+// the endpoint and headers itself; tracing stays off without an endpoint.
+func setup() {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return
+	}
+	if os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return
+	}
+
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: tracing disabled: %v\n", err)
+		return
+	}
+	// The environment overrides the default service name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "kube-cmd")),
+		resource.WithFromEnv())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: invalid OTEL_RESOURCE_ATTRIBUTES: %v\n", err)
+	}
+
+	// Batches exported while the command runs report their errors here
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		errMu.Lock()
+		if exportErr == nil {
+			exportErr = err
+		}
+		errMu.Unlock()
+	}))
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	tracer = provider.Tracer("kube-cmd")
+}
+
+// keyValue converts an attribute value to its OTLP type
+func keyValue(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int32:
+		return attribute.Int64(key, int64(v))
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case string:
+		return attribute.String(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
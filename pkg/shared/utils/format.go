@@ -55,3 +55,11 @@ func TruncateString(s string, maxLength int) string {
 	}
 	return s[:maxLength-3] + "..."
 }
+
+// OrDash returns s, or "-" for an empty table cell
+func OrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Confirm prints prompt to out and reports whether the answer on stdin is y
+// or yes. It returns false once ctx is cancelled, so an interrupt aborts the
+// question instead of waiting for Enter.
+func Confirm(ctx context.Context, out io.Writer, prompt string) bool {
+	fmt.Fprint(out, prompt)
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer <- line
+	}()
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(out)
+		return false
+	case line := <-answer:
+		line = strings.ToLower(strings.TrimSpace(line))
+		return line == "y" || line == "yes"
+	}
+}
@@ -0,0 +1,19 @@
+package utils
+
+import "strings"
+
+// FirstLine returns the first line of s
+func FirstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// Contains reports whether list contains s
+func Contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}